@@ -50,6 +50,8 @@ impl MatchingEngineService for MatchingEngineServer {
             Status::invalid_argument(format!("Invalid order: {}", e))
         })?;
 
+        let order_id = order.id;
+
         // Submit to orderbook
         let result = self
             .orderbook_manager
@@ -61,7 +63,8 @@ impl MatchingEngineService for MatchingEngineServer {
             })?;
 
         // Build response
-        let response = build_order_response(result);
+        let mut response = build_order_response(result);
+        response.order_id = order_id.to_string();
         Ok(Response::new(response))
     }
 
@@ -88,6 +91,9 @@ impl MatchingEngineService for MatchingEngineServer {
             } else {
                 "Order not found".to_string()
             },
+            remaining_quantity: cancelled
+                .map(|order| order.remaining_quantity.to_string())
+                .unwrap_or_default(),
         }))
     }
 
@@ -164,7 +170,7 @@ fn parse_order_request(req: &OrderRequest) -> Result<Order> {
         _ => TimeInForce::GTC,
     };
 
-    Ok(Order::new(
+    let mut order = Order::new(
         account_id,
         req.symbol.clone(),
         side,
@@ -175,7 +181,14 @@ fn parse_order_request(req: &OrderRequest) -> Result<Order> {
         req.post_only,
         req.client_order_id.clone(),
         0, // Will be set by orderbook
-    ))
+    );
+
+    // Keep the caller's ID so trades reference the persisted order
+    if let Some(id) = &req.order_id {
+        order.id = Uuid::from_str(id)?;
+    }
+
+    Ok(order)
 }
 
 fn build_order_response(result: MatchResult) -> OrderResponse {
@@ -185,27 +198,73 @@ fn build_order_response(result: MatchResult) -> OrderResponse {
             status: "filled".to_string(),
             message: format!("{} trades executed", trades.len()),
             trades_count: trades.len() as u32,
+            order_id: String::new(),
+            remaining_quantity: "0".to_string(),
         },
-        MatchResult::PartiallyFilled(trades, _) => OrderResponse {
+        MatchResult::PartiallyFilled(trades, order) => OrderResponse {
             success: true,
             status: "partial".to_string(),
             message: format!("{} trades executed, order partially filled", trades.len()),
             trades_count: trades.len() as u32,
+            order_id: String::new(),
+            remaining_quantity: order.remaining_quantity.to_string(),
         },
-        MatchResult::Added(_) => OrderResponse {
+        MatchResult::Added(order) => OrderResponse {
             success: true,
             status: "new".to_string(),
             message: "Order added to orderbook".to_string(),
             trades_count: 0,
+            order_id: String::new(),
+            remaining_quantity: order.remaining_quantity.to_string(),
         },
         MatchResult::Rejected(reason) => OrderResponse {
             success: false,
             status: "rejected".to_string(),
             message: reason,
             trades_count: 0,
+            order_id: String::new(),
+            remaining_quantity: String::new(),
         },
     }
 }
 
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn limit_buy(order_id: Option<&str>) -> OrderRequest {
+        OrderRequest {
+            account_id: Uuid::new_v4().to_string(),
+            symbol: "BTC-GBP".to_string(),
+            side: "buy".to_string(),
+            order_type: "limit".to_string(),
+            price: Some("50000".to_string()),
+            quantity: "0.5".to_string(),
+            time_in_force: "GTC".to_string(),
+            post_only: false,
+            client_order_id: None,
+            order_id: order_id.map(|id| id.to_string()),
+        }
+    }
+
+    #[test]
+    fn test_parse_order_request_keeps_caller_order_id() {
+        let id = Uuid::new_v4();
+        let order = parse_order_request(&limit_buy(Some(&id.to_string()))).unwrap();
+
+        assert_eq!(order.id, id);
+    }
 
+    #[test]
+    fn test_parse_order_request_generates_order_id() {
+        let first = parse_order_request(&limit_buy(None)).unwrap();
+        let second = parse_order_request(&limit_buy(None)).unwrap();
 
+        assert_ne!(first.id, second.id);
+    }
+
+    #[test]
+    fn test_parse_order_request_rejects_invalid_order_id() {
+        assert!(parse_order_request(&limit_buy(Some("not-a-uuid"))).is_err());
+    }
+}
@@ -0,0 +1,10 @@
+-- Rollback: 000011_add_order_engine_state
+DROP INDEX IF EXISTS idx_orders_account_client_order_id;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS status_message;
+ALTER TABLE orders DROP COLUMN IF EXISTS trades_count;
+
+UPDATE orders SET status = 'rejected' WHERE status = 'pending';
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('new', 'partial', 'filled', 'cancelled', 'rejected', 'expired'));
@@ -0,0 +1,16 @@
+-- BitCurrent Exchange - Order Engine State
+-- Migration: 000011_add_order_engine_state
+
+-- 'pending' covers the window between persisting an order and the matching
+-- engine acknowledging it
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'new', 'partial', 'filled', 'cancelled', 'rejected', 'expired'));
+
+-- Matching engine response
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS trades_count INT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status_message TEXT;
+
+-- client_order_id is unique per account so resubmissions are idempotent
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_account_client_order_id
+    ON orders(account_id, client_order_id) WHERE client_order_id IS NOT NULL;
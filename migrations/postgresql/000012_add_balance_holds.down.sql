@@ -0,0 +1,5 @@
+-- Rollback: 000012_add_balance_holds
+ALTER TABLE orders DROP COLUMN IF EXISTS cancelled_quantity;
+
+DROP TRIGGER IF EXISTS update_balance_holds_updated_at ON balance_holds;
+DROP TABLE IF EXISTS balance_holds;
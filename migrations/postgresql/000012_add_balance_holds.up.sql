@@ -0,0 +1,36 @@
+-- BitCurrent Exchange - Balance Holds
+-- Migration: 000012_add_balance_holds
+
+-- A hold is the reserved_balance earmarked for one order (or withdrawal).
+-- Fills consume it; whatever is left is released back to available_balance
+-- once the reference is finished.
+CREATE TABLE IF NOT EXISTS balance_holds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    currency VARCHAR(10) NOT NULL,
+    amount DECIMAL(36, 18) NOT NULL,
+    consumed DECIMAL(36, 18) DEFAULT 0 NOT NULL,
+    released DECIMAL(36, 18) DEFAULT 0 NOT NULL,
+    reference_type VARCHAR(20) NOT NULL,
+    reference_id UUID NOT NULL,
+    status VARCHAR(20) DEFAULT 'active' NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    closed_at TIMESTAMPTZ,
+    CONSTRAINT balance_holds_amount_check CHECK (amount > 0),
+    CONSTRAINT balance_holds_remaining_check CHECK (consumed >= 0 AND released >= 0 AND consumed + released <= amount),
+    CONSTRAINT balance_holds_reference_type_check CHECK (reference_type IN ('order', 'withdrawal')),
+    CONSTRAINT balance_holds_status_check CHECK (status IN ('active', 'closed')),
+    UNIQUE(reference_type, reference_id)
+);
+
+CREATE INDEX idx_balance_holds_account_currency ON balance_holds(account_id, currency);
+CREATE INDEX idx_balance_holds_active ON balance_holds(created_at) WHERE status = 'active';
+
+CREATE TRIGGER update_balance_holds_updated_at BEFORE UPDATE ON balance_holds
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Unfilled quantity the engine removed when the order ended (cancel, IOC or
+-- market remainder, rejection). An order is settled once
+-- filled_quantity + cancelled_quantity = quantity.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancelled_quantity DECIMAL(36, 18) DEFAULT 0 NOT NULL;
@@ -0,0 +1,10 @@
+-- Rollback: 000013_add_trade_settlement
+DROP INDEX IF EXISTS idx_trades_symbol_sequence_id;
+ALTER TABLE trades ADD CONSTRAINT trades_sequence_id_key UNIQUE (sequence_id);
+
+DELETE FROM accounts WHERE id = '00000000-0000-0000-0000-000000000100';
+DELETE FROM users WHERE id = '00000000-0000-0000-0000-000000000001';
+
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_type_check;
+ALTER TABLE accounts ADD CONSTRAINT accounts_type_check
+    CHECK (account_type IN ('spot', 'margin', 'institutional'));
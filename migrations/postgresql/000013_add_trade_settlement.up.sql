@@ -0,0 +1,21 @@
+-- BitCurrent Exchange - Trade Settlement
+-- Migration: 000013_add_trade_settlement
+
+-- System accounts hold the exchange's own balances (trading fees first)
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_type_check;
+ALTER TABLE accounts ADD CONSTRAINT accounts_type_check
+    CHECK (account_type IN ('spot', 'margin', 'institutional', 'system'));
+
+INSERT INTO users (id, email, email_verified, password_hash, kyc_level, kyc_status, status)
+VALUES ('00000000-0000-0000-0000-000000000001', 'system@bitcurrent.co.uk', TRUE, '!', 3, 'approved', 'active')
+ON CONFLICT (id) DO NOTHING;
+
+-- Trading fee account
+INSERT INTO accounts (id, user_id, account_type, status)
+VALUES ('00000000-0000-0000-0000-000000000100', '00000000-0000-0000-0000-000000000001', 'system', 'active')
+ON CONFLICT (id) DO NOTHING;
+
+-- The engine sequences trades per order book, so sequence_id is only
+-- unique within a symbol
+ALTER TABLE trades DROP CONSTRAINT IF EXISTS trades_sequence_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trades_symbol_sequence_id ON trades(symbol, sequence_id);
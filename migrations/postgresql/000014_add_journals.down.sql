@@ -0,0 +1,23 @@
+-- Rollback: 000014_add_journals
+DELETE FROM wallets WHERE account_id IN (
+    '00000000-0000-0000-0000-000000000101',
+    '00000000-0000-0000-0000-000000000102'
+);
+DELETE FROM accounts WHERE id IN (
+    '00000000-0000-0000-0000-000000000101',
+    '00000000-0000-0000-0000-000000000102'
+);
+
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS wallets_available_check;
+ALTER TABLE wallets ADD CONSTRAINT wallets_available_check CHECK (available_balance >= 0);
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS wallets_balance_check;
+ALTER TABLE wallets ADD CONSTRAINT wallets_balance_check CHECK (balance >= 0);
+ALTER TABLE wallets DROP COLUMN IF EXISTS allow_negative;
+
+DROP TRIGGER IF EXISTS ledger_entries_journal_balanced ON ledger_entries;
+DROP FUNCTION IF EXISTS check_journal_balanced();
+
+DROP INDEX IF EXISTS idx_ledger_journal_id;
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS journal_id;
+
+DROP TABLE IF EXISTS journals;
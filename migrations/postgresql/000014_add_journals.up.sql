@@ -0,0 +1,66 @@
+-- BitCurrent Exchange - Journals
+-- Migration: 000014_add_journals
+
+-- A journal is one balanced set of ledger entries: for every currency its
+-- entries sum to zero. Money entering or leaving the exchange is posted
+-- against a system account standing for where it is actually held.
+CREATE TABLE IF NOT EXISTS journals (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    journal_type VARCHAR(20) NOT NULL,
+    reference_id UUID,
+    reference_type VARCHAR(20),
+    description TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT journals_type_check CHECK (journal_type IN ('deposit', 'withdrawal', 'trade', 'fee', 'transfer', 'adjustment', 'reward'))
+);
+
+CREATE INDEX idx_journals_reference ON journals(reference_type, reference_id);
+CREATE INDEX idx_journals_created_at ON journals(created_at DESC);
+
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS journal_id UUID REFERENCES journals(id);
+CREATE INDEX idx_ledger_journal_id ON ledger_entries(journal_id);
+
+-- Checked at commit, once every entry of the journal has been written
+CREATE OR REPLACE FUNCTION check_journal_balanced()
+RETURNS TRIGGER AS $$
+DECLARE
+    unbalanced VARCHAR(10);
+BEGIN
+    SELECT currency INTO unbalanced
+    FROM ledger_entries
+    WHERE journal_id = NEW.journal_id
+    GROUP BY currency
+    HAVING SUM(amount) <> 0
+    LIMIT 1;
+
+    IF unbalanced IS NOT NULL THEN
+        RAISE EXCEPTION 'journal % does not balance in %', NEW.journal_id, unbalanced;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER ledger_entries_journal_balanced
+    AFTER INSERT OR UPDATE ON ledger_entries
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW
+    WHEN (NEW.journal_id IS NOT NULL)
+    EXECUTE FUNCTION check_journal_balanced();
+
+-- System accounts mirroring external holdings carry the other side of
+-- customer balances, so they run negative
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS allow_negative BOOLEAN DEFAULT FALSE NOT NULL;
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS wallets_balance_check;
+ALTER TABLE wallets ADD CONSTRAINT wallets_balance_check CHECK (allow_negative OR balance >= 0);
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS wallets_available_check;
+ALTER TABLE wallets ADD CONSTRAINT wallets_available_check CHECK (allow_negative OR available_balance >= 0);
+
+-- Crypto held in the exchange's hot wallet
+INSERT INTO accounts (id, user_id, account_type, status)
+VALUES ('00000000-0000-0000-0000-000000000101', '00000000-0000-0000-0000-000000000001', 'system', 'active')
+ON CONFLICT (id) DO NOTHING;
+
+-- Fiat held in the bank safeguarding account
+INSERT INTO accounts (id, user_id, account_type, status)
+VALUES ('00000000-0000-0000-0000-000000000102', '00000000-0000-0000-0000-000000000001', 'system', 'active')
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,2 @@
+-- Rollback: 000015_add_idempotency_keys
+DROP TABLE IF EXISTS idempotency_keys;
@@ -0,0 +1,24 @@
+-- BitCurrent Exchange - Idempotency Keys
+-- Migration: 000015_add_idempotency_keys
+
+-- Responses to mutating requests, keyed by the caller's Idempotency-Key so
+-- a retry replays the original outcome instead of applying it twice.
+-- scope separates services and, at the edge, users. claim_token identifies
+-- the request currently holding the key so one whose claim was taken over
+-- cannot complete it.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    scope VARCHAR(100) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    claim_token UUID NOT NULL,
+    status VARCHAR(20) DEFAULT 'processing' NOT NULL,
+    response_status INTEGER,
+    response_content_type VARCHAR(100),
+    response_body BYTEA,
+    locked_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (scope, idempotency_key),
+    CONSTRAINT idempotency_keys_status_check CHECK (status IN ('processing', 'completed'))
+);
@@ -0,0 +1,4 @@
+-- Rollback: 000016_add_deposit_addresses
+
+DROP TABLE IF EXISTS deposit_addresses;
+DROP TABLE IF EXISTS hd_index_counters;
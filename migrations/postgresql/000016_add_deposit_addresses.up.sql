@@ -0,0 +1,29 @@
+-- BitCurrent Exchange - HD Deposit Addresses
+-- Migration: 000016_add_deposit_addresses
+
+-- Next unused BIP32 address index per chain. Indexes are handed out under
+-- a row lock so two accounts never share an address, and are never reused.
+CREATE TABLE IF NOT EXISTS hd_index_counters (
+    chain VARCHAR(20) PRIMARY KEY,
+    next_index BIGINT DEFAULT 0 NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT hd_index_counters_next_index_check CHECK (next_index >= 0 AND next_index < 2147483648)
+);
+
+INSERT INTO hd_index_counters (chain) VALUES ('bitcoin'), ('ethereum')
+ON CONFLICT (chain) DO NOTHING;
+
+-- Deposit addresses derived from the account-level xpubs
+-- (m/84'/0'/0'/0/i for Bitcoin, m/44'/60'/0'/0/i for Ethereum)
+CREATE TABLE IF NOT EXISTS deposit_addresses (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    account_id UUID NOT NULL REFERENCES accounts(id),
+    chain VARCHAR(20) NOT NULL REFERENCES hd_index_counters(chain),
+    derivation_index BIGINT NOT NULL,
+    derivation_path VARCHAR(50) NOT NULL,
+    address VARCHAR(100) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (chain, derivation_index)
+);
+
+CREATE INDEX idx_deposit_addresses_account ON deposit_addresses(account_id, chain, created_at DESC);
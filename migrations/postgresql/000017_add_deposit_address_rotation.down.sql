@@ -0,0 +1,8 @@
+-- Rollback: 000017_add_deposit_address_rotation
+
+DROP INDEX IF EXISTS idx_deposit_addresses_unfunded;
+DROP INDEX IF EXISTS idx_deposit_addresses_account;
+CREATE INDEX idx_deposit_addresses_account ON deposit_addresses(account_id, chain, created_at DESC);
+
+ALTER TABLE deposit_addresses DROP COLUMN IF EXISTS funded_at;
+ALTER TABLE deposit_addresses DROP COLUMN IF EXISTS currency;
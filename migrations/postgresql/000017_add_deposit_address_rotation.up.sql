@@ -0,0 +1,21 @@
+-- BitCurrent Exchange - Deposit Address Rotation
+-- Migration: 000017_add_deposit_address_rotation
+
+-- Addresses are issued per account, currency and network. An address is
+-- reused until it first receives funds, after which the next request gets
+-- a fresh one. Funded addresses stay watched.
+ALTER TABLE deposit_addresses ADD COLUMN IF NOT EXISTS currency VARCHAR(10);
+ALTER TABLE deposit_addresses ADD COLUMN IF NOT EXISTS funded_at TIMESTAMPTZ;
+
+UPDATE deposit_addresses SET currency = CASE chain WHEN 'bitcoin' THEN 'BTC' ELSE 'ETH' END
+WHERE currency IS NULL;
+
+ALTER TABLE deposit_addresses ALTER COLUMN currency SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_deposit_addresses_account;
+CREATE INDEX idx_deposit_addresses_account ON deposit_addresses(account_id, currency, chain, created_at DESC);
+
+-- At most one address awaiting funds per account, currency and network
+CREATE UNIQUE INDEX idx_deposit_addresses_unfunded
+    ON deposit_addresses(account_id, currency, chain)
+    WHERE funded_at IS NULL;
@@ -0,0 +1,11 @@
+-- Rollback: 000018_add_deposit_scanning
+
+DROP TABLE IF EXISTS chain_scan_state;
+
+DROP INDEX IF EXISTS idx_deposits_block_height;
+DROP INDEX IF EXISTS idx_deposits_txid_vout;
+
+ALTER TABLE deposits DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE deposits DROP COLUMN IF EXISTS block_hash;
+ALTER TABLE deposits DROP COLUMN IF EXISTS block_height;
+ALTER TABLE deposits DROP COLUMN IF EXISTS vout;
@@ -0,0 +1,21 @@
+-- BitCurrent Exchange - On-Chain Deposit Discovery
+-- Migration: 000018_add_deposit_scanning
+
+-- Deposits found by scanning blocks are identified by their output, so one
+-- transaction can pay several watched addresses
+ALTER TABLE deposits ADD COLUMN IF NOT EXISTS vout INT;
+ALTER TABLE deposits ADD COLUMN IF NOT EXISTS block_height BIGINT;
+ALTER TABLE deposits ADD COLUMN IF NOT EXISTS block_hash VARCHAR(64);
+ALTER TABLE deposits ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP;
+
+CREATE UNIQUE INDEX idx_deposits_txid_vout ON deposits(txid, vout);
+CREATE INDEX idx_deposits_block_height ON deposits(network, block_height);
+
+-- Last block the deposit listener has scanned per chain, so a restart
+-- resumes where it stopped
+CREATE TABLE IF NOT EXISTS chain_scan_state (
+    chain VARCHAR(20) PRIMARY KEY,
+    last_height BIGINT NOT NULL,
+    last_hash VARCHAR(64) NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
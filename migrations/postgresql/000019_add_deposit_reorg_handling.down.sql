@@ -0,0 +1,11 @@
+-- Rollback: 000019_add_deposit_reorg_handling
+
+DROP TABLE IF EXISTS scanned_blocks;
+
+ALTER TABLE deposits DROP COLUMN IF EXISTS reversed_at;
+ALTER TABLE deposits DROP COLUMN IF EXISTS orphaned_at;
+
+UPDATE deposits SET status = 'failed' WHERE status = 'orphaned';
+ALTER TABLE deposits DROP CONSTRAINT IF EXISTS deposits_status_check;
+ALTER TABLE deposits ADD CONSTRAINT deposits_status_check
+    CHECK (status IN ('pending', 'confirmed', 'credited', 'failed'));
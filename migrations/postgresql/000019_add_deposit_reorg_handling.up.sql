@@ -0,0 +1,22 @@
+-- BitCurrent Exchange - Deposit Reorg Handling
+-- Migration: 000019_add_deposit_reorg_handling
+
+-- Deposits whose block left the active chain are orphaned. A credited
+-- deposit is reversed when it is orphaned, or its account is frozen if
+-- the funds have already left.
+ALTER TABLE deposits DROP CONSTRAINT IF EXISTS deposits_status_check;
+ALTER TABLE deposits ADD CONSTRAINT deposits_status_check
+    CHECK (status IN ('pending', 'confirmed', 'credited', 'failed', 'orphaned'));
+
+ALTER TABLE deposits ADD COLUMN IF NOT EXISTS orphaned_at TIMESTAMPTZ;
+ALTER TABLE deposits ADD COLUMN IF NOT EXISTS reversed_at TIMESTAMPTZ;
+
+-- Hashes of recently scanned blocks, compared with the node's chain to
+-- find the fork point after a reorg
+CREATE TABLE IF NOT EXISTS scanned_blocks (
+    chain VARCHAR(20) NOT NULL,
+    height BIGINT NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    scanned_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chain, height)
+);
@@ -0,0 +1,6 @@
+-- Rollback: 000020_add_deposit_confirmation_tiers
+
+DROP INDEX IF EXISTS idx_deposits_unsettled;
+ALTER TABLE deposits DROP CONSTRAINT IF EXISTS deposits_withdrawable_confirmations_check;
+ALTER TABLE deposits DROP COLUMN IF EXISTS withdrawable_at;
+ALTER TABLE deposits DROP COLUMN IF EXISTS withdrawable_confirmations;
@@ -0,0 +1,22 @@
+-- BitCurrent Exchange - Deposit Confirmation Tiers
+-- Migration: 000020_add_deposit_confirmation_tiers
+
+-- required_confirmations is when a deposit is credited for trading;
+-- withdrawable_confirmations is when its funds may leave the exchange.
+-- Both are resolved from the confirmation policy when the row is created.
+ALTER TABLE deposits ADD COLUMN IF NOT EXISTS withdrawable_confirmations INT;
+ALTER TABLE deposits ADD COLUMN IF NOT EXISTS withdrawable_at TIMESTAMPTZ;
+
+UPDATE deposits SET withdrawable_confirmations = required_confirmations
+WHERE withdrawable_confirmations IS NULL;
+UPDATE deposits SET withdrawable_at = credited_at
+WHERE status = 'credited' AND withdrawable_at IS NULL;
+
+ALTER TABLE deposits ALTER COLUMN withdrawable_confirmations SET DEFAULT 6;
+ALTER TABLE deposits ALTER COLUMN withdrawable_confirmations SET NOT NULL;
+ALTER TABLE deposits ADD CONSTRAINT deposits_withdrawable_confirmations_check
+    CHECK (withdrawable_confirmations >= required_confirmations);
+
+-- Credited deposits still counting towards withdrawability
+CREATE INDEX idx_deposits_unsettled ON deposits(account_id, currency)
+    WHERE status = 'credited' AND withdrawable_at IS NULL;
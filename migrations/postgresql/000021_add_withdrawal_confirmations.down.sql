@@ -0,0 +1,9 @@
+-- Rollback: 000021_add_withdrawal_confirmations
+
+DROP INDEX IF EXISTS idx_withdrawals_processing;
+
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS block_hash;
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS required_confirmations;
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS confirmations;
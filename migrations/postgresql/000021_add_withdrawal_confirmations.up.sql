@@ -0,0 +1,14 @@
+-- BitCurrent Exchange - Withdrawal Confirmation Tracking
+-- Migration: 000021_add_withdrawal_confirmations
+
+-- Processing withdrawals are followed on chain (or at the bank for GBP)
+-- until they complete, or fail if the transaction is dropped or reverted
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS confirmations INT NOT NULL DEFAULT 0;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS required_confirmations INT;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS block_hash VARCHAR(66);
+-- Last time the transaction was seen in the mempool or a block; one not
+-- seen for long enough has been dropped
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX idx_withdrawals_processing ON withdrawals(processed_at) WHERE status = 'processing';
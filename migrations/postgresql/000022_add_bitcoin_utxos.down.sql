@@ -0,0 +1,9 @@
+-- Rollback: 000022_add_bitcoin_utxos
+
+DELETE FROM hd_index_counters WHERE chain = 'bitcoin-change';
+
+DROP INDEX IF EXISTS idx_withdrawals_bitcoin_transaction;
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS bitcoin_transaction_id;
+
+DROP TABLE IF EXISTS bitcoin_utxos;
+DROP TABLE IF EXISTS bitcoin_transactions;
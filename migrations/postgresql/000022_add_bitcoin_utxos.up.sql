@@ -0,0 +1,52 @@
+-- BitCurrent Exchange - Bitcoin UTXO Tracking and PSBT Withdrawals
+-- Migration: 000022_add_bitcoin_utxos
+
+-- Withdrawal transactions built from our own UTXOs. The unsigned
+-- transaction is kept as a BIP174 PSBT until the signers have signed it.
+CREATE TABLE IF NOT EXISTS bitcoin_transactions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    txid VARCHAR(64) NOT NULL UNIQUE,
+    psbt TEXT NOT NULL,
+    fee_sats BIGINT NOT NULL,
+    fee_rate BIGINT NOT NULL,
+    vsize INT NOT NULL,
+    status VARCHAR(20) DEFAULT 'unsigned' NOT NULL,
+    broadcast_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT bitcoin_transactions_fee_check CHECK (fee_sats > 0 AND fee_rate > 0),
+    CONSTRAINT bitcoin_transactions_status_check CHECK (status IN ('unsigned', 'broadcast', 'confirmed', 'failed'))
+);
+
+CREATE INDEX idx_bitcoin_transactions_status ON bitcoin_transactions(status);
+
+-- Outputs the exchange can spend: deposits found by the block scanner and
+-- change from our own withdrawals. Change stays pending until its
+-- transaction confirms.
+CREATE TABLE IF NOT EXISTS bitcoin_utxos (
+    txid VARCHAR(64) NOT NULL,
+    vout INT NOT NULL,
+    amount_sats BIGINT NOT NULL,
+    address VARCHAR(100) NOT NULL,
+    script_pub_key VARCHAR(140) NOT NULL,
+    derivation_path VARCHAR(50) NOT NULL,
+    block_height BIGINT,
+    status VARCHAR(20) DEFAULT 'available' NOT NULL,
+    spent_by UUID REFERENCES bitcoin_transactions(id),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (txid, vout),
+    CONSTRAINT bitcoin_utxos_amount_check CHECK (amount_sats > 0),
+    CONSTRAINT bitcoin_utxos_status_check CHECK (status IN ('pending', 'available', 'spent', 'orphaned'))
+);
+
+CREATE INDEX idx_bitcoin_utxos_available ON bitcoin_utxos(amount_sats DESC) WHERE status = 'available';
+CREATE INDEX idx_bitcoin_utxos_spent_by ON bitcoin_utxos(spent_by) WHERE spent_by IS NOT NULL;
+CREATE INDEX idx_bitcoin_utxos_block_height ON bitcoin_utxos(block_height);
+
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS bitcoin_transaction_id UUID REFERENCES bitcoin_transactions(id);
+CREATE INDEX idx_withdrawals_bitcoin_transaction ON withdrawals(bitcoin_transaction_id) WHERE bitcoin_transaction_id IS NOT NULL;
+
+-- Change addresses come from the xpub's internal branch (m/84'/0'/0'/1/i)
+INSERT INTO hd_index_counters (chain) VALUES ('bitcoin-change')
+ON CONFLICT (chain) DO NOTHING;
@@ -0,0 +1,7 @@
+-- Rollback: 000023_add_withdrawal_batching
+
+DROP INDEX IF EXISTS idx_withdrawals_approved;
+
+ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS withdrawals_bitcoin_output_unique;
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS network_fee_sats;
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS bitcoin_output_index;
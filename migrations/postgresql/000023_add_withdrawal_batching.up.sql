@@ -0,0 +1,13 @@
+-- BitCurrent Exchange - Batched Bitcoin Withdrawals
+-- Migration: 000023_add_withdrawal_batching
+
+-- Several withdrawals can share one Bitcoin transaction. Each is tied to
+-- its output, and carries its share of the network fee in satoshis.
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS bitcoin_output_index INT;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS network_fee_sats BIGINT;
+
+ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_bitcoin_output_unique
+    UNIQUE (bitcoin_transaction_id, bitcoin_output_index);
+
+-- Approved withdrawals waiting for the next batch
+CREATE INDEX idx_withdrawals_approved ON withdrawals(currency, approved_at) WHERE status = 'approved';
@@ -0,0 +1,16 @@
+-- Rollback: 000024_add_bitcoin_fee_bumping
+
+DROP TABLE IF EXISTS withdrawal_txids;
+
+DROP INDEX IF EXISTS idx_bitcoin_transactions_parent;
+
+UPDATE bitcoin_transactions SET status = 'unsigned' WHERE status = 'signed';
+UPDATE bitcoin_transactions SET status = 'failed' WHERE status = 'replaced';
+ALTER TABLE bitcoin_transactions DROP CONSTRAINT IF EXISTS bitcoin_transactions_status_check;
+ALTER TABLE bitcoin_transactions ADD CONSTRAINT bitcoin_transactions_status_check
+    CHECK (status IN ('unsigned', 'broadcast', 'confirmed', 'failed'));
+ALTER TABLE bitcoin_transactions DROP CONSTRAINT IF EXISTS bitcoin_transactions_kind_check;
+
+ALTER TABLE bitcoin_transactions DROP COLUMN IF EXISTS broadcast_height;
+ALTER TABLE bitcoin_transactions DROP COLUMN IF EXISTS parent_id;
+ALTER TABLE bitcoin_transactions DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,33 @@
+-- BitCurrent Exchange - Bitcoin Withdrawal Fee Bumping
+-- Migration: 000024_add_bitcoin_fee_bumping
+
+-- A stuck withdrawal transaction is bumped by a BIP125 replacement paying
+-- the same outputs, or by a child spending its change (CPFP). parent_id is
+-- the transaction replaced, or the one the child pays for.
+ALTER TABLE bitcoin_transactions ADD COLUMN IF NOT EXISTS kind VARCHAR(20) DEFAULT 'payment' NOT NULL;
+ALTER TABLE bitcoin_transactions ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES bitcoin_transactions(id);
+ALTER TABLE bitcoin_transactions ADD COLUMN IF NOT EXISTS broadcast_height BIGINT;
+
+ALTER TABLE bitcoin_transactions ADD CONSTRAINT bitcoin_transactions_kind_check
+    CHECK (kind IN ('payment', 'replacement', 'cpfp'));
+-- A fully signed transaction is stored as signed before it is sent to the
+-- node, and stays signed until a broadcast gets through.
+ALTER TABLE bitcoin_transactions DROP CONSTRAINT IF EXISTS bitcoin_transactions_status_check;
+ALTER TABLE bitcoin_transactions ADD CONSTRAINT bitcoin_transactions_status_check
+    CHECK (status IN ('unsigned', 'signed', 'broadcast', 'replaced', 'confirmed', 'failed'));
+
+CREATE INDEX idx_bitcoin_transactions_parent ON bitcoin_transactions(parent_id) WHERE parent_id IS NOT NULL;
+
+-- Every transaction broadcast for a withdrawal, with the withdrawal's share
+-- of its fee in satoshis. A replaced transaction can still be mined instead
+-- of its replacement, so none are forgotten.
+CREATE TABLE IF NOT EXISTS withdrawal_txids (
+    withdrawal_id UUID NOT NULL REFERENCES withdrawals(id),
+    txid VARCHAR(64) NOT NULL,
+    bitcoin_transaction_id UUID NOT NULL REFERENCES bitcoin_transactions(id),
+    fee_sats BIGINT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (withdrawal_id, txid)
+);
+
+CREATE INDEX idx_withdrawal_txids_txid ON withdrawal_txids(txid);
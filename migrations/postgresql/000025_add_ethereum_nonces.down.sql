@@ -0,0 +1,4 @@
+-- Rollback: 000025_add_ethereum_nonces
+
+DROP TABLE IF EXISTS ethereum_nonces;
+DROP TABLE IF EXISTS ethereum_accounts;
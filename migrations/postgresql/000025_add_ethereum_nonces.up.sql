@@ -0,0 +1,40 @@
+-- BitCurrent Exchange - Ethereum Hot Wallet Nonces
+-- Migration: 000025_add_ethereum_nonces
+
+-- The next fresh nonce for each hot wallet address. Its row is locked while
+-- a nonce is allocated, so replicas never hand out the same one.
+CREATE TABLE IF NOT EXISTS ethereum_accounts (
+    address VARCHAR(42) PRIMARY KEY,
+    next_nonce BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Every nonce handed out, with the signed transaction currently using it.
+-- A released nonce belonged to a dropped transaction and is reused before
+-- any fresh one, so the gap does not hold up later transactions. A stuck
+-- transaction is replaced at the same nonce; the hashes it had before stay
+-- in previous_txids, as any of them may still be mined.
+CREATE TABLE IF NOT EXISTS ethereum_nonces (
+    address VARCHAR(42) NOT NULL REFERENCES ethereum_accounts(address),
+    nonce BIGINT NOT NULL,
+    status VARCHAR(20) DEFAULT 'reserved' NOT NULL,
+    withdrawal_id UUID REFERENCES withdrawals(id),
+    txid VARCHAR(66),
+    previous_txids TEXT[] DEFAULT '{}' NOT NULL,
+    to_address VARCHAR(42),
+    value_wei NUMERIC(78, 0),
+    data BYTEA,
+    gas_limit BIGINT,
+    max_fee_per_gas NUMERIC(78, 0),
+    max_priority_fee_per_gas NUMERIC(78, 0),
+    broadcast_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (address, nonce),
+    CONSTRAINT ethereum_nonces_status_check
+        CHECK (status IN ('reserved', 'broadcast', 'confirmed', 'released'))
+);
+
+CREATE INDEX idx_ethereum_nonces_withdrawal ON ethereum_nonces(withdrawal_id) WHERE withdrawal_id IS NOT NULL;
+CREATE INDEX idx_ethereum_nonces_released ON ethereum_nonces(address, nonce) WHERE status = 'released';
+CREATE INDEX idx_ethereum_nonces_broadcast ON ethereum_nonces(broadcast_at) WHERE status = 'broadcast';
@@ -0,0 +1,9 @@
+-- Rollback: 000026_add_token_deposits
+
+DELETE FROM scanned_blocks WHERE chain = 'ethereum';
+DELETE FROM chain_scan_state WHERE chain = 'ethereum';
+UPDATE deposits SET block_hash = NULL WHERE network = 'ethereum';
+
+ALTER TABLE chain_scan_state ALTER COLUMN last_hash TYPE VARCHAR(64);
+ALTER TABLE scanned_blocks ALTER COLUMN hash TYPE VARCHAR(64);
+ALTER TABLE deposits ALTER COLUMN block_hash TYPE VARCHAR(64);
@@ -0,0 +1,9 @@
+-- BitCurrent Exchange - ERC-20 Token Deposits
+-- Migration: 000026_add_token_deposits
+
+-- Ethereum block hashes carry a 0x prefix, two characters longer than
+-- Bitcoin's. Token deposits are identified by their transaction and log
+-- index, stored in vout.
+ALTER TABLE deposits ALTER COLUMN block_hash TYPE VARCHAR(66);
+ALTER TABLE scanned_blocks ALTER COLUMN hash TYPE VARCHAR(66);
+ALTER TABLE chain_scan_state ALTER COLUMN last_hash TYPE VARCHAR(66);
@@ -0,0 +1,44 @@
+-- Rollback: 000027_add_deposit_sweeps
+
+DROP TABLE IF EXISTS sweeps;
+
+UPDATE bitcoin_transactions SET kind = 'payment' WHERE kind = 'consolidation';
+ALTER TABLE bitcoin_transactions DROP CONSTRAINT IF EXISTS bitcoin_transactions_kind_check;
+ALTER TABLE bitcoin_transactions ADD CONSTRAINT bitcoin_transactions_kind_check
+    CHECK (kind IN ('payment', 'replacement', 'cpfp'));
+
+-- Fold the deposit address and network fee accounts back into the hot
+-- wallet. The accounts stay, as their ledger entries refer to them.
+DO $$
+DECLARE
+    held RECORD;
+    moved UUID;
+BEGIN
+    FOR held IN
+        SELECT account_id, currency, balance
+        FROM wallets
+        WHERE account_id IN ('00000000-0000-0000-0000-000000000103', '00000000-0000-0000-0000-000000000104')
+          AND balance <> 0
+    LOOP
+        INSERT INTO journals (journal_type, description)
+        VALUES ('adjustment', 'Deposit sweeping rolled back')
+        RETURNING id INTO moved;
+
+        UPDATE wallets
+        SET balance = balance + held.balance,
+            available_balance = available_balance + held.balance,
+            updated_at = NOW()
+        WHERE account_id = '00000000-0000-0000-0000-000000000101' AND currency = held.currency;
+        UPDATE wallets
+        SET balance = 0, available_balance = 0, updated_at = NOW()
+        WHERE account_id = held.account_id AND currency = held.currency;
+
+        INSERT INTO ledger_entries (journal_id, account_id, currency, amount, balance_after, entry_type, description)
+        SELECT moved, account_id, currency,
+               CASE WHEN account_id = held.account_id THEN -held.balance ELSE held.balance END,
+               balance, 'adjustment', 'Deposit sweeping rolled back'
+        FROM wallets
+        WHERE account_id IN ('00000000-0000-0000-0000-000000000101', held.account_id)
+          AND currency = held.currency;
+    END LOOP;
+END $$;
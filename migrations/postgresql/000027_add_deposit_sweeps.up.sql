@@ -0,0 +1,104 @@
+-- BitCurrent Exchange - Deposit Address Sweeping
+-- Migration: 000027_add_deposit_sweeps
+
+-- Crypto sitting on customer Ethereum deposit addresses until it is swept
+-- into the hot wallet. Bitcoin deposit outputs are spent directly by the
+-- hot wallet's signers, so they stay with the hot wallet account.
+INSERT INTO accounts (id, user_id, account_type, status)
+VALUES ('00000000-0000-0000-0000-000000000103', '00000000-0000-0000-0000-000000000001', 'system', 'active')
+ON CONFLICT (id) DO NOTHING;
+
+-- Network fees the exchange pays to move its own funds
+INSERT INTO accounts (id, user_id, account_type, status)
+VALUES ('00000000-0000-0000-0000-000000000104', '00000000-0000-0000-0000-000000000001', 'system', 'active')
+ON CONFLICT (id) DO NOTHING;
+
+-- Ethereum deposits credited so far were posted against the hot wallet;
+-- they are still on their deposit addresses
+DO $$
+DECLARE
+    held RECORD;
+    moved UUID;
+BEGIN
+    FOR held IN
+        SELECT currency, SUM(amount) AS amount
+        FROM ledger_entries
+        WHERE account_id = '00000000-0000-0000-0000-000000000101'
+          AND reference_type = 'deposit'
+          AND currency <> 'BTC'
+        GROUP BY currency
+        HAVING SUM(amount) <> 0
+    LOOP
+        INSERT INTO wallets (account_id, currency, wallet_type, allow_negative)
+        VALUES ('00000000-0000-0000-0000-000000000103', held.currency, 'hot', TRUE)
+        ON CONFLICT (account_id, currency) DO NOTHING;
+
+        INSERT INTO journals (journal_type, description)
+        VALUES ('adjustment', 'Deposits held on Ethereum deposit addresses')
+        RETURNING id INTO moved;
+
+        UPDATE wallets
+        SET balance = balance - held.amount,
+            available_balance = available_balance - held.amount,
+            updated_at = NOW()
+        WHERE account_id = '00000000-0000-0000-0000-000000000101' AND currency = held.currency;
+        UPDATE wallets
+        SET balance = balance + held.amount,
+            available_balance = available_balance + held.amount,
+            updated_at = NOW()
+        WHERE account_id = '00000000-0000-0000-0000-000000000103' AND currency = held.currency;
+
+        INSERT INTO ledger_entries (journal_id, account_id, currency, amount, balance_after, entry_type, description)
+        SELECT moved, account_id, currency,
+               CASE WHEN account_id = '00000000-0000-0000-0000-000000000101' THEN -held.amount ELSE held.amount END,
+               balance, 'adjustment', 'Deposits held on Ethereum deposit addresses'
+        FROM wallets
+        WHERE account_id IN ('00000000-0000-0000-0000-000000000101', '00000000-0000-0000-0000-000000000103')
+          AND currency = held.currency;
+    END LOOP;
+END $$;
+
+-- Bitcoin deposit outputs consolidated into one hot wallet output
+ALTER TABLE bitcoin_transactions DROP CONSTRAINT IF EXISTS bitcoin_transactions_kind_check;
+ALTER TABLE bitcoin_transactions ADD CONSTRAINT bitcoin_transactions_kind_check
+    CHECK (kind IN ('payment', 'replacement', 'cpfp', 'consolidation'));
+
+-- Every move of deposited funds into the hot wallet. A Bitcoin sweep is a
+-- consolidation transaction signed through its PSBT. An Ethereum sweep is
+-- a transfer out of one deposit address, stored unsigned with its signing
+-- hash for the offline deposit key; a token sweep first waits in funding
+-- for the hot wallet's gas top-up at topup_nonce. Amounts are in the
+-- currency's units; fee is in BTC or ETH.
+CREATE TABLE IF NOT EXISTS sweeps (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    chain VARCHAR(20) NOT NULL,
+    currency VARCHAR(10) NOT NULL,
+    amount DECIMAL(36, 18) NOT NULL,
+    fee DECIMAL(36, 18),
+    status VARCHAR(20) DEFAULT 'unsigned' NOT NULL,
+    bitcoin_transaction_id UUID REFERENCES bitcoin_transactions(id),
+    from_address VARCHAR(42),
+    derivation_path VARCHAR(50),
+    to_address VARCHAR(42),
+    nonce BIGINT,
+    value_wei NUMERIC(78, 0),
+    data BYTEA,
+    gas_limit BIGINT,
+    max_fee_per_gas NUMERIC(78, 0),
+    max_priority_fee_per_gas NUMERIC(78, 0),
+    signing_hash VARCHAR(66),
+    txid VARCHAR(66),
+    topup_nonce BIGINT,
+    topup_wei NUMERIC(78, 0),
+    failure_reason TEXT,
+    broadcast_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT sweeps_amount_check CHECK (amount > 0),
+    CONSTRAINT sweeps_status_check CHECK (status IN ('funding', 'unsigned', 'broadcast', 'confirmed', 'failed'))
+);
+
+CREATE INDEX idx_sweeps_open ON sweeps(chain, status) WHERE status IN ('funding', 'unsigned', 'broadcast');
+CREATE INDEX idx_sweeps_from_address ON sweeps(from_address) WHERE from_address IS NOT NULL;
+CREATE UNIQUE INDEX idx_sweeps_bitcoin_transaction ON sweeps(bitcoin_transaction_id) WHERE bitcoin_transaction_id IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Rollback: 000028_add_multisig_transactions
+
+DROP TABLE IF EXISTS multisig_signatures;
+DROP TABLE IF EXISTS multisig_transactions;
@@ -0,0 +1,36 @@
+-- BitCurrent Exchange - Multi-Signature Wallet Transactions
+-- Migration: 000028_add_multisig_transactions
+
+-- Spends from the hot, warm and cold P2WSH multisig wallets, held as PSBTs
+-- until required_signatures signers have signed every input
+CREATE TABLE IF NOT EXISTS multisig_transactions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    wallet_type VARCHAR(10) NOT NULL,
+    address VARCHAR(100) NOT NULL,
+    txid VARCHAR(64) NOT NULL,
+    psbt TEXT NOT NULL,
+    description TEXT,
+    required_signatures INT NOT NULL,
+    status VARCHAR(20) DEFAULT 'pending' NOT NULL,
+    broadcast_at TIMESTAMPTZ,
+    cancelled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT multisig_transactions_wallet_type_check CHECK (wallet_type IN ('hot', 'warm', 'cold')),
+    CONSTRAINT multisig_transactions_status_check CHECK (status IN ('pending', 'broadcast', 'cancelled')),
+    CONSTRAINT multisig_transactions_required_check CHECK (required_signatures > 0)
+);
+
+CREATE INDEX idx_multisig_transactions_pending ON multisig_transactions(wallet_type, created_at) WHERE status = 'pending';
+CREATE UNIQUE INDEX idx_multisig_transactions_txid ON multisig_transactions(txid) WHERE status <> 'cancelled';
+
+-- One signer's verified signatures of a multisig transaction, one per
+-- input in input order
+CREATE TABLE IF NOT EXISTS multisig_signatures (
+    transaction_id UUID NOT NULL REFERENCES multisig_transactions(id) ON DELETE CASCADE,
+    signer_index INT NOT NULL,
+    signer_key VARCHAR(66) NOT NULL,
+    signatures BYTEA[] NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (transaction_id, signer_index)
+);
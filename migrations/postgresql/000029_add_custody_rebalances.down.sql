@@ -0,0 +1,8 @@
+-- Rollback: 000029_add_custody_rebalances
+
+DROP TABLE IF EXISTS custody_rebalances;
+
+UPDATE bitcoin_transactions SET kind = 'payment' WHERE kind = 'rebalance';
+ALTER TABLE bitcoin_transactions DROP CONSTRAINT IF EXISTS bitcoin_transactions_kind_check;
+ALTER TABLE bitcoin_transactions ADD CONSTRAINT bitcoin_transactions_kind_check
+    CHECK (kind IN ('payment', 'replacement', 'cpfp', 'consolidation'));
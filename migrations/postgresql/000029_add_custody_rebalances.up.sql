@@ -0,0 +1,48 @@
+-- BitCurrent Exchange - Hot/Warm/Cold Custody Rebalancing
+-- Migration: 000029_add_custody_rebalances
+
+-- Hot wallet outputs sent to cold storage
+ALTER TABLE bitcoin_transactions DROP CONSTRAINT IF EXISTS bitcoin_transactions_kind_check;
+ALTER TABLE bitcoin_transactions ADD CONSTRAINT bitcoin_transactions_kind_check
+    CHECK (kind IN ('payment', 'replacement', 'cpfp', 'consolidation', 'rebalance'));
+
+-- Moves between the hot, warm and cold wallets proposed to bring custody
+-- back to its target split. A move out of the hot wallet is a PSBT for the
+-- hot wallet's signers; one out of the warm wallet is a multisig
+-- transaction. A top-up pays the hot wallet address at derivation_path,
+-- output output_index, which joins the spendable set once confirmed.
+-- Amounts and fee are in the currency's units.
+CREATE TABLE IF NOT EXISTS custody_rebalances (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    currency VARCHAR(10) NOT NULL,
+    from_tier VARCHAR(10) NOT NULL,
+    to_tier VARCHAR(10) NOT NULL,
+    amount DECIMAL(36, 18) NOT NULL,
+    fee DECIMAL(36, 18),
+    status VARCHAR(20) DEFAULT 'proposed' NOT NULL,
+    multisig_transaction_id UUID REFERENCES multisig_transactions(id),
+    bitcoin_transaction_id UUID REFERENCES bitcoin_transactions(id),
+    to_address VARCHAR(100) NOT NULL,
+    output_index INT NOT NULL,
+    derivation_path VARCHAR(50),
+    txid VARCHAR(64),
+    reason TEXT,
+    failure_reason TEXT,
+    broadcast_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT custody_rebalances_amount_check CHECK (amount > 0),
+    CONSTRAINT custody_rebalances_tier_check CHECK (
+        from_tier IN ('hot', 'warm', 'cold') AND to_tier IN ('hot', 'warm', 'cold') AND from_tier <> to_tier
+    ),
+    CONSTRAINT custody_rebalances_status_check CHECK (status IN ('proposed', 'broadcast', 'confirmed', 'cancelled', 'failed')),
+    CONSTRAINT custody_rebalances_transaction_check CHECK (
+        (multisig_transaction_id IS NULL) <> (bitcoin_transaction_id IS NULL)
+    )
+);
+
+-- One move out of each wallet at a time
+CREATE UNIQUE INDEX idx_custody_rebalances_open ON custody_rebalances(currency, from_tier) WHERE status IN ('proposed', 'broadcast');
+CREATE UNIQUE INDEX idx_custody_rebalances_multisig ON custody_rebalances(multisig_transaction_id) WHERE multisig_transaction_id IS NOT NULL;
+CREATE UNIQUE INDEX idx_custody_rebalances_bitcoin ON custody_rebalances(bitcoin_transaction_id) WHERE bitcoin_transaction_id IS NOT NULL;
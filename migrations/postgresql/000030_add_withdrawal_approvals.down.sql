@@ -0,0 +1,10 @@
+-- Rollback: 000030_add_withdrawal_approvals
+
+DROP INDEX IF EXISTS idx_withdrawals_pending;
+DROP TABLE IF EXISTS withdrawal_approvals;
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS required_approvals;
+
+UPDATE withdrawals SET status = 'cancelled' WHERE status IN ('rejected', 'expired');
+ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS withdrawals_status_check;
+ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_status_check
+    CHECK (status IN ('pending', 'approved', 'processing', 'completed', 'failed', 'cancelled'));
@@ -0,0 +1,27 @@
+-- BitCurrent Exchange - Withdrawal Approvals
+-- Migration: 000030_add_withdrawal_approvals
+
+-- Pending withdrawals need as many distinct admin approvals as their
+-- currency's value band requires. One rejection ends the request, and
+-- requests left unapproved too long expire.
+ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS withdrawals_status_check;
+ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_status_check
+    CHECK (status IN ('pending', 'approved', 'processing', 'completed', 'failed', 'cancelled', 'rejected', 'expired'));
+
+-- Approvals needed when the withdrawal was last decided on
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS required_approvals SMALLINT;
+
+-- Every approval and rejection, with the approver's reason
+CREATE TABLE IF NOT EXISTS withdrawal_approvals (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    withdrawal_id UUID NOT NULL REFERENCES withdrawals(id) ON DELETE CASCADE,
+    approver_id UUID NOT NULL REFERENCES users(id),
+    decision VARCHAR(10) NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT withdrawal_approvals_decision_check CHECK (decision IN ('approved', 'rejected')),
+    CONSTRAINT withdrawal_approvals_reason_check CHECK (reason <> ''),
+    CONSTRAINT withdrawal_approvals_approver_unique UNIQUE (withdrawal_id, approver_id)
+);
+
+CREATE INDEX idx_withdrawals_pending ON withdrawals(created_at) WHERE status = 'pending';
@@ -0,0 +1,4 @@
+-- Rollback: 000031_add_trade_dead_letters
+
+DROP INDEX IF EXISTS idx_trade_dead_letters_unresolved;
+DROP TABLE IF EXISTS trade_dead_letters;
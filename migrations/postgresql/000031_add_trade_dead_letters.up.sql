@@ -0,0 +1,21 @@
+-- BitCurrent Exchange - Trade Dead Letters
+-- Migration: 000031_add_trade_dead_letters
+
+-- Trade events the ledger could not book: malformed payloads, and trades
+-- that kept failing with an error retrying cannot fix. Their offsets are
+-- committed, so each needs investigating and replaying by hand.
+CREATE TABLE IF NOT EXISTS trade_dead_letters (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    topic VARCHAR(255) NOT NULL,
+    partition INTEGER NOT NULL,
+    "offset" BIGINT NOT NULL,
+    key BYTEA,
+    payload BYTEA NOT NULL,
+    error TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMPTZ,
+    CONSTRAINT trade_dead_letters_offset_unique UNIQUE (topic, partition, "offset")
+);
+
+CREATE INDEX idx_trade_dead_letters_unresolved ON trade_dead_letters(created_at) WHERE resolved_at IS NULL;
@@ -12,10 +12,13 @@ import (
 
 	"github.com/bitcurrent-exchange/platform/services/api-gateway/internal/handlers"
 	"github.com/bitcurrent-exchange/platform/services/api-gateway/internal/middleware"
+	"github.com/bitcurrent-exchange/platform/services/api-gateway/internal/ordergateway"
+	"github.com/bitcurrent-exchange/platform/services/api-gateway/internal/settlement"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/auth"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/cache"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/config"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/idempotency"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/logger"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -79,14 +82,36 @@ func main() {
 		config.GetDuration("jwt.expiry"),
 	)
 
+	// Orders are placed through the order gateway
+	orderGateway := ordergateway.NewClient(config.GetString("order_gateway.url"), config.GetDuration("order_gateway.timeout"), log)
+
+	// Crypto deposit addresses come from the settlement service's HD wallet,
+	// and withdrawals are requested there so their funds are held
+	settlementClient := settlement.NewClient(config.GetString("settlement.url"), config.GetDuration("settlement.timeout"), log)
+
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(db, jwtManager, log)
 	passwordResetHandler := handlers.NewPasswordResetHandler(db, log)
 	userHandler := handlers.NewUserHandler(db, log)
-	orderHandler := handlers.NewOrderHandler(db, log)
-	accountHandler := handlers.NewAccountHandler(db, log)
+	orderHandler := handlers.NewOrderHandler(db, orderGateway, log)
+	accountHandler := handlers.NewAccountHandler(db, settlementClient, log)
 	marketHandler := handlers.NewMarketHandler(db, redisCache, log)
 	taxHandler := handlers.NewTaxHandler(db, log)
+	adminHandler := handlers.NewAdminHandler(settlementClient, log)
+
+	// Retried orders and fund movements replay their first response. Keys
+	// are scoped per user so clients cannot collide with each other.
+	idempotent := idempotency.Middleware(
+		idempotency.NewPostgresStore(db, config.GetDuration("idempotency.ttl")),
+		idempotency.Config{
+			Scope: "api-gateway",
+			ScopeFunc: func(r *http.Request) string {
+				userID, _ := r.Context().Value("user_id").(string)
+				return userID
+			},
+		},
+		log,
+	)
 
 	// Setup router
 	router := mux.NewRouter()
@@ -128,7 +153,7 @@ func main() {
 	protected.Use(middleware.RateLimitMiddleware(redisCache, log))
 
 	// Order management
-	protected.HandleFunc("/orders", orderHandler.PlaceOrder).Methods("POST")
+	protected.Handle("/orders", idempotent(http.HandlerFunc(orderHandler.PlaceOrder))).Methods("POST")
 	protected.HandleFunc("/orders", orderHandler.ListOrders).Methods("GET")
 	protected.HandleFunc("/orders/{id}", orderHandler.GetOrder).Methods("GET")
 	protected.HandleFunc("/orders/{id}", orderHandler.CancelOrder).Methods("DELETE")
@@ -138,10 +163,18 @@ func main() {
 	protected.HandleFunc("/accounts/{id}/transactions", accountHandler.GetTransactions).Methods("GET")
 
 	// Deposits and withdrawals
-	protected.HandleFunc("/deposits", accountHandler.InitiateDeposit).Methods("POST")
-	protected.HandleFunc("/withdrawals", accountHandler.RequestWithdrawal).Methods("POST")
+	protected.Handle("/deposits", idempotent(http.HandlerFunc(accountHandler.InitiateDeposit))).Methods("POST")
+	protected.Handle("/withdrawals", idempotent(http.HandlerFunc(accountHandler.RequestWithdrawal))).Methods("POST")
 	protected.HandleFunc("/withdrawals/{id}", accountHandler.GetWithdrawal).Methods("GET")
 
+	// Withdrawal approvals, decided as the admin the token was issued to
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.AdminMiddleware(log))
+	admin.HandleFunc("/withdrawals/approvals", adminHandler.ListWithdrawalApprovals).Methods("GET")
+	admin.HandleFunc("/withdrawals/{id}/approvals", adminHandler.GetWithdrawalApprovals).Methods("GET")
+	admin.Handle("/withdrawals/{id}/approve", idempotent(http.HandlerFunc(adminHandler.ApproveWithdrawal))).Methods("POST")
+	admin.Handle("/withdrawals/{id}/reject", idempotent(http.HandlerFunc(adminHandler.RejectWithdrawal))).Methods("POST")
+
 	// User profile
 	protected.HandleFunc("/profile", authHandler.GetProfile).Methods("GET")
 	protected.HandleFunc("/profile", authHandler.UpdateProfile).Methods("PUT")
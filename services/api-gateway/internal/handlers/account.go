@@ -4,24 +4,30 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/bitcurrent-exchange/platform/services/api-gateway/internal/settlement"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/auth"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/idempotency"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
 type AccountHandler struct {
-	db     *database.PostgresDB
-	logger *zap.Logger
+	db         *database.PostgresDB
+	settlement *settlement.Client
+	logger     *zap.Logger
 }
 
-func NewAccountHandler(db *database.PostgresDB, logger *zap.Logger) *AccountHandler {
+func NewAccountHandler(db *database.PostgresDB, settlementClient *settlement.Client, logger *zap.Logger) *AccountHandler {
 	return &AccountHandler{
-		db:     db,
-		logger: logger,
+		db:         db,
+		settlement: settlementClient,
+		logger:     logger,
 	}
 }
 
@@ -182,21 +188,40 @@ func (h *AccountHandler) InitiateDeposit(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	amount, err := decimal.ParseAmount(req.Amount, req.Currency)
+	if err != nil || !amount.IsPositive() {
+		respondError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	// TODO: For crypto, generate deposit address via settlement service
 	// TODO: For fiat (GBP), generate reference code and return bank details
 
+	// Crypto deposits go to the account's HD-derived address
+	var depositAddress *settlement.DepositAddress
+	if req.Currency != "GBP" {
+		depositAddress, err = h.settlement.DepositAddress(ctx, claims.AccountID, req.Currency)
+		if err != nil {
+			h.respondSettlementError(w, err, "Failed to generate deposit address")
+			return
+		}
+	}
+
 	// Create deposit record
 	var depositID string
+	var address, network *string
+	if depositAddress != nil {
+		address, network = &depositAddress.Address, &depositAddress.Network
+	}
 	query := `
-		INSERT INTO deposits (account_id, currency, amount, status)
-		VALUES ($1, $2, $3, 'pending')
+		INSERT INTO deposits (account_id, currency, amount, address, network, status)
+		VALUES ($1, $2, $3, $4, $5, 'pending')
 		RETURNING id
 	`
 
-	err := h.db.Pool.QueryRow(ctx, query, claims.AccountID, req.Currency, req.Amount).Scan(&depositID)
+	err = h.db.Pool.QueryRow(ctx, query, claims.AccountID, req.Currency, amount, address, network).Scan(&depositID)
 	if err != nil {
 		h.logger.Error("Failed to create deposit", zap.Error(err))
 		respondError(w, http.StatusInternalServerError, "Failed to initiate deposit")
@@ -212,7 +237,7 @@ func (h *AccountHandler) InitiateDeposit(w http.ResponseWriter, r *http.Request)
 	response := map[string]interface{}{
 		"deposit_id": depositID,
 		"currency":   req.Currency,
-		"amount":     req.Amount,
+		"amount":     amount.String(),
 		"status":     "pending",
 	}
 
@@ -225,13 +250,26 @@ func (h *AccountHandler) InitiateDeposit(w http.ResponseWriter, r *http.Request)
 			"bank_name":      "ClearBank Ltd",
 		}
 	} else {
-		// For crypto, would include deposit address
-		response["address"] = "0x..." // TODO: Generate real address
+		response["address"] = depositAddress.Address
+		response["network"] = depositAddress.Network
 	}
 
 	respondJSON(w, http.StatusCreated, response)
 }
 
+// respondSettlementError passes settlement rejections through and puts
+// transport failures behind a 503
+func (h *AccountHandler) respondSettlementError(w http.ResponseWriter, err error, message string) {
+	var sErr *settlement.Error
+	if errors.As(err, &sErr) && sErr.StatusCode < http.StatusInternalServerError {
+		respondError(w, sErr.StatusCode, sErr.Message)
+		return
+	}
+
+	h.logger.Error(message, zap.Error(err))
+	respondError(w, http.StatusServiceUnavailable, message)
+}
+
 type WithdrawalRequest struct {
 	Currency string `json:"currency"`
 	Amount   string `json:"amount"`
@@ -258,45 +296,44 @@ func (h *AccountHandler) RequestWithdrawal(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	amount, err := decimal.ParseAmount(req.Amount, req.Currency)
+	if err != nil || !amount.IsPositive() {
+		respondError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	// TODO: Check available balance
 	// TODO: Call compliance service for AML checks
 	// TODO: Apply daily/monthly withdrawal limits
 
-	// Create withdrawal record
-	var withdrawalID string
-	query := `
-		INSERT INTO withdrawals (account_id, currency, amount, address, status)
-		VALUES ($1, $2, $3, $4, 'pending')
-		RETURNING id
-	`
-
-	err := h.db.Pool.QueryRow(
-		ctx, query,
-		claims.AccountID, req.Currency, req.Amount, req.Address,
-	).Scan(&withdrawalID)
-
+	// Settlement holds the amount plus fee from the available balance. The
+	// caller's key goes with it, so if this request dies after settlement
+	// has taken it, the retry gets the same withdrawal back.
+	var forwardKey string
+	if key := r.Header.Get(idempotency.HeaderKey); key != "" {
+		forwardKey = idempotency.ForwardKey(claims.UserID.String(), key)
+	}
+	withdrawal, err := h.settlement.RequestWithdrawal(ctx, claims.AccountID, req.Currency, amount, req.Address, forwardKey)
 	if err != nil {
-		h.logger.Error("Failed to create withdrawal", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to request withdrawal")
+		h.respondSettlementError(w, err, "Failed to request withdrawal")
 		return
 	}
 
 	h.logger.Info("Withdrawal requested",
-		zap.String("withdrawal_id", withdrawalID),
+		zap.String("withdrawal_id", withdrawal.ID.String()),
 		zap.String("account_id", claims.AccountID.String()),
-		zap.String("currency", req.Currency),
+		zap.String("currency", withdrawal.Currency),
 	)
 
-	// TODO: Publish to Kafka for settlement service to process
-
 	respondJSON(w, http.StatusCreated, map[string]interface{}{
-		"withdrawal_id": withdrawalID,
-		"currency":      req.Currency,
-		"amount":        req.Amount,
-		"status":        "pending",
+		"withdrawal_id": withdrawal.ID.String(),
+		"currency":      withdrawal.Currency,
+		"amount":        withdrawal.Amount.String(),
+		"fee":           withdrawal.Fee.String(),
+		"held_amount":   withdrawal.HeldAmount.String(),
+		"status":        withdrawal.Status,
 		"message":       "Withdrawal request received and pending approval",
 	})
 }
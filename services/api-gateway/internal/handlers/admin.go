@@ -0,0 +1,121 @@
+// BitCurrent Exchange - Admin Handlers
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/api-gateway/internal/settlement"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/auth"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// AdminHandler serves the withdrawal approval queue to admins. The
+// approver is always the admin the request's token was issued to.
+type AdminHandler struct {
+	settlement *settlement.Client
+	logger     *zap.Logger
+}
+
+func NewAdminHandler(settlementClient *settlement.Client, logger *zap.Logger) *AdminHandler {
+	return &AdminHandler{
+		settlement: settlementClient,
+		logger:     logger,
+	}
+}
+
+type WithdrawalDecisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ListWithdrawalApprovals returns the withdrawals waiting for approval
+func (h *AdminHandler) ListWithdrawalApprovals(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*auth.Claims)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	queue, err := h.settlement.ApprovalQueue(ctx, claims.UserID)
+	if err != nil {
+		h.respondSettlementError(w, err, "Failed to list approval queue")
+		return
+	}
+	respondJSON(w, http.StatusOK, queue)
+}
+
+// GetWithdrawalApprovals returns every approval and rejection of a withdrawal
+func (h *AdminHandler) GetWithdrawalApprovals(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*auth.Claims)
+	withdrawalID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid withdrawal ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	decisions, err := h.settlement.WithdrawalApprovals(ctx, claims.UserID, withdrawalID)
+	if err != nil {
+		h.respondSettlementError(w, err, "Failed to list approvals")
+		return
+	}
+	respondJSON(w, http.StatusOK, decisions)
+}
+
+// ApproveWithdrawal records the admin's approval of a withdrawal
+func (h *AdminHandler) ApproveWithdrawal(w http.ResponseWriter, r *http.Request) {
+	h.decideWithdrawal(w, r, true)
+}
+
+// RejectWithdrawal records the admin's rejection of a withdrawal
+func (h *AdminHandler) RejectWithdrawal(w http.ResponseWriter, r *http.Request) {
+	h.decideWithdrawal(w, r, false)
+}
+
+func (h *AdminHandler) decideWithdrawal(w http.ResponseWriter, r *http.Request, approve bool) {
+	claims := r.Context().Value("claims").(*auth.Claims)
+	withdrawalID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid withdrawal ID")
+		return
+	}
+
+	var req WithdrawalDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	result, err := h.settlement.DecideWithdrawal(ctx, claims.UserID, withdrawalID, approve, req.Reason)
+	if err != nil {
+		h.respondSettlementError(w, err, "Failed to record decision")
+		return
+	}
+
+	h.logger.Info("Withdrawal decision recorded",
+		zap.String("withdrawal_id", withdrawalID.String()),
+		zap.String("approver_id", claims.UserID.String()),
+		zap.Bool("approved", approve),
+	)
+	respondJSON(w, http.StatusOK, result)
+}
+
+func (h *AdminHandler) respondSettlementError(w http.ResponseWriter, err error, message string) {
+	var sErr *settlement.Error
+	if errors.As(err, &sErr) && sErr.StatusCode < http.StatusInternalServerError {
+		respondError(w, sErr.StatusCode, sErr.Message)
+		return
+	}
+
+	h.logger.Error(message, zap.Error(err))
+	respondError(w, http.StatusServiceUnavailable, message)
+}
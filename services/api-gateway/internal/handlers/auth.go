@@ -73,9 +73,11 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var userID, accountID uuid.UUID
 	var email, passwordHash, status string
 	var kycLevel int
+	var isAdmin bool
 
 	query := `
-		SELECT u.id, u.email, u.password_hash, u.kyc_level, u.status, a.id as account_id
+		SELECT u.id, u.email, u.password_hash, u.kyc_level, u.status, a.id as account_id,
+		       COALESCE(u.is_admin, FALSE)
 		FROM users u
 		LEFT JOIN accounts a ON u.id = a.user_id AND a.account_type = 'spot'
 		WHERE u.email = $1 AND u.status = 'active'
@@ -83,7 +85,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	`
 
 	err := h.db.Pool.QueryRow(ctx, query, req.Email).Scan(
-		&userID, &email, &passwordHash, &kycLevel, &status, &accountID,
+		&userID, &email, &passwordHash, &kycLevel, &status, &accountID, &isAdmin,
 	)
 	if err != nil {
 		h.logger.Warn("Login failed - user not found",
@@ -101,15 +103,19 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate tokens
-	token, err := h.jwtManager.GenerateToken(userID, accountID, email, "user", kycLevel)
+	// Generate tokens; admin routes are open to admins' tokens only
+	role := auth.RoleUser
+	if isAdmin {
+		role = auth.RoleAdmin
+	}
+	token, err := h.jwtManager.GenerateToken(userID, accountID, email, role, kycLevel)
 	if err != nil {
 		h.logger.Error("Failed to generate token", zap.Error(err))
 		respondError(w, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
-	refreshToken, err := h.jwtManager.GenerateToken(userID, accountID, email, "user", kycLevel)
+	refreshToken, err := h.jwtManager.GenerateToken(userID, accountID, email, role, kycLevel)
 	if err != nil {
 		h.logger.Error("Failed to generate refresh token", zap.Error(err))
 		respondError(w, http.StatusInternalServerError, "Failed to generate refresh token")
@@ -226,7 +232,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("User registered", zap.String("user_id", userID.String()))
 
 	// Generate token for immediate login
-	token, _ := h.jwtManager.GenerateToken(userID, accountID, req.Email, "user", 0)
+	token, _ := h.jwtManager.GenerateToken(userID, accountID, req.Email, auth.RoleUser, 0)
 
 	respondJSON(w, http.StatusCreated, map[string]interface{}{
 		"token": token,
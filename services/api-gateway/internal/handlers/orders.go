@@ -4,37 +4,43 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/bitcurrent-exchange/platform/services/api-gateway/internal/ordergateway"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/auth"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
 type OrderHandler struct {
-	db     *database.PostgresDB
-	logger *zap.Logger
+	db           *database.PostgresDB
+	orderGateway *ordergateway.Client
+	logger       *zap.Logger
 }
 
-func NewOrderHandler(db *database.PostgresDB, logger *zap.Logger) *OrderHandler {
+func NewOrderHandler(db *database.PostgresDB, orderGateway *ordergateway.Client, logger *zap.Logger) *OrderHandler {
 	return &OrderHandler{
-		db:     db,
-		logger: logger,
+		db:           db,
+		orderGateway: orderGateway,
+		logger:       logger,
 	}
 }
 
 type PlaceOrderRequest struct {
-	Symbol      string  `json:"symbol"`
-	Side        string  `json:"side"`
-	OrderType   string  `json:"order_type"`
-	Price       *string `json:"price,omitempty"`
-	Quantity    string  `json:"quantity"`
-	TimeInForce string  `json:"time_in_force,omitempty"`
-	PostOnly    bool    `json:"post_only,omitempty"`
+	Symbol        string  `json:"symbol"`
+	Side          string  `json:"side"`
+	OrderType     string  `json:"order_type"`
+	Price         *string `json:"price,omitempty"`
+	Quantity      string  `json:"quantity"`
+	TimeInForce   string  `json:"time_in_force,omitempty"`
+	PostOnly      bool    `json:"post_only,omitempty"`
+	ClientOrderID *string `json:"client_order_id,omitempty"`
 }
 
 type OrderResponse struct {
@@ -75,69 +81,76 @@ func (h *OrderHandler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.TimeInForce == "" {
-		req.TimeInForce = "GTC"
-	}
-
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
-
-	// Begin transaction
-	tx, err := h.db.Pool.Begin(ctx)
-	if err != nil {
-		h.logger.Error("Failed to begin transaction", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to place order")
+	quantity, err := decimal.NewFromString(req.Quantity)
+	if err != nil || !quantity.IsPositive() {
+		respondError(w, http.StatusBadRequest, "Invalid quantity")
 		return
 	}
-	defer tx.Rollback(ctx)
 
-	// TODO: Check balance (for buy orders)
-	// TODO: Call order-gateway service for risk checks
-	// TODO: Forward to matching engine via gRPC
+	if req.Price != nil {
+		price, err := decimal.NewFromString(*req.Price)
+		if err != nil || !price.IsPositive() {
+			respondError(w, http.StatusBadRequest, "Invalid price")
+			return
+		}
+	}
 
-	// Insert order into database
-	var orderID uuid.UUID
-	query := `
-		INSERT INTO orders (
-			account_id, symbol, side, order_type, price, quantity,
-			status, time_in_force, post_only
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id
-	`
+	if req.TimeInForce == "" {
+		req.TimeInForce = "GTC"
+	}
 
-	err = tx.QueryRow(
-		ctx, query,
-		claims.AccountID, req.Symbol, req.Side, req.OrderType,
-		req.Price, req.Quantity, "new", req.TimeInForce, req.PostOnly,
-	).Scan(&orderID)
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
 
+	// The order gateway runs risk checks, holds the funds in the ledger and
+	// places the order on the book
+	result, err := h.orderGateway.SubmitOrder(ctx, ordergateway.SubmitOrderRequest{
+		AccountID:     claims.AccountID.String(),
+		Symbol:        req.Symbol,
+		Side:          req.Side,
+		OrderType:     req.OrderType,
+		Price:         req.Price,
+		Quantity:      req.Quantity,
+		TimeInForce:   req.TimeInForce,
+		PostOnly:      req.PostOnly,
+		ClientOrderID: req.ClientOrderID,
+	})
 	if err != nil {
-		h.logger.Error("Failed to insert order", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to place order")
+		h.respondGatewayError(w, err, "Failed to place order")
 		return
 	}
 
-	// Commit transaction
-	if err := tx.Commit(ctx); err != nil {
-		h.logger.Error("Failed to commit transaction", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to place order")
+	if result.Status == "rejected" {
+		respondJSON(w, http.StatusUnprocessableEntity, map[string]string{
+			"error":     http.StatusText(http.StatusUnprocessableEntity),
+			"message":   result.Message,
+			"violation": result.Violation,
+			"order_id":  result.OrderID,
+		})
 		return
 	}
 
 	h.logger.Info("Order placed",
-		zap.String("order_id", orderID.String()),
+		zap.String("order_id", result.OrderID),
 		zap.String("account_id", claims.AccountID.String()),
+		zap.String("status", result.Status),
 	)
 
-	respondJSON(w, http.StatusCreated, OrderResponse{
-		ID:             orderID.String(),
+	// A pending order reached the engine but its outcome is not yet known
+	statusCode := http.StatusCreated
+	if result.Status == "pending" {
+		statusCode = http.StatusAccepted
+	}
+
+	respondJSON(w, statusCode, OrderResponse{
+		ID:             result.OrderID,
 		Symbol:         req.Symbol,
 		Side:           req.Side,
 		OrderType:      req.OrderType,
 		Price:          req.Price,
 		Quantity:       req.Quantity,
 		FilledQuantity: "0",
-		Status:         "new",
+		Status:         result.Status,
 		TimeInForce:    req.TimeInForce,
 		CreatedAt:      time.Now().Format(time.RFC3339),
 	})
@@ -267,11 +280,17 @@ func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
+	id, err := uuid.Parse(orderID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+
 	// Verify ownership and check if cancellable
 	var accountID uuid.UUID
 	var status string
 	checkQuery := `SELECT account_id, status FROM orders WHERE id = $1`
-	err := h.db.Pool.QueryRow(ctx, checkQuery, orderID).Scan(&accountID, &status)
+	err = h.db.Pool.QueryRow(ctx, checkQuery, id).Scan(&accountID, &status)
 
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Order not found")
@@ -288,19 +307,9 @@ func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Call matching engine to cancel order via gRPC
-
-	// Update order status
-	updateQuery := `
-		UPDATE orders
-		SET status = 'cancelled', updated_at = NOW(), cancelled_at = NOW()
-		WHERE id = $1 AND account_id = $2
-	`
-
-	_, err = h.db.Pool.Exec(ctx, updateQuery, orderID, claims.AccountID)
-	if err != nil {
-		h.logger.Error("Failed to cancel order", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to cancel order")
+	// The order gateway pulls it from the book and releases the held funds
+	if err := h.orderGateway.CancelOrder(ctx, id, claims.AccountID); err != nil {
+		h.respondGatewayError(w, err, "Failed to cancel order")
 		return
 	}
 
@@ -314,3 +323,15 @@ func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// respondGatewayError passes order gateway rejections through and hides
+// transport failures behind a 503
+func (h *OrderHandler) respondGatewayError(w http.ResponseWriter, err error, message string) {
+	var gwErr *ordergateway.Error
+	if errors.As(err, &gwErr) && gwErr.StatusCode < http.StatusInternalServerError {
+		respondError(w, gwErr.StatusCode, gwErr.Message)
+		return
+	}
+
+	h.logger.Error(message, zap.Error(err))
+	respondError(w, http.StatusServiceUnavailable, message)
+}
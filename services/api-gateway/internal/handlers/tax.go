@@ -8,6 +8,7 @@ import (
 
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/auth"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"go.uber.org/zap"
 )
 
@@ -23,24 +24,31 @@ func NewTaxHandler(db *database.PostgresDB, logger *zap.Logger) *TaxHandler {
 	}
 }
 
+var (
+	// UK CGT annual exempt amount 2024-25
+	cgtAllowance = decimal.RequireFromString("3000.00")
+	// Basic rate for capital gains; higher rate taxpayers pay 24%
+	cgtBasicRate = decimal.RequireFromString("0.18")
+)
+
 type TaxTransaction struct {
-	Date      string  `json:"date"`
-	Type      string  `json:"type"`
-	Asset     string  `json:"asset"`
-	Amount    float64 `json:"amount"`
-	CostBasis float64 `json:"cost_basis"`
-	Proceeds  float64 `json:"proceeds"`
-	GainLoss  float64 `json:"gain_loss"`
+	Date      string          `json:"date"`
+	Type      string          `json:"type"`
+	Asset     string          `json:"asset"`
+	Amount    decimal.Decimal `json:"amount"`
+	CostBasis decimal.Decimal `json:"cost_basis"`
+	Proceeds  decimal.Decimal `json:"proceeds"`
+	GainLoss  decimal.Decimal `json:"gain_loss"`
 }
 
 type TaxSummary struct {
 	TaxYear       string           `json:"tax_year"`
-	TotalGains    float64          `json:"total_gains"`
-	TotalLosses   float64          `json:"total_losses"`
-	NetGainLoss   float64          `json:"net_gain_loss"`
-	Allowance     float64          `json:"allowance"`
-	TaxableAmount float64          `json:"taxable_amount"`
-	EstimatedTax  float64          `json:"estimated_tax"`
+	TotalGains    decimal.Decimal  `json:"total_gains"`
+	TotalLosses   decimal.Decimal  `json:"total_losses"`
+	NetGainLoss   decimal.Decimal  `json:"net_gain_loss"`
+	Allowance     decimal.Decimal  `json:"allowance"`
+	TaxableAmount decimal.Decimal  `json:"taxable_amount"`
+	EstimatedTax  decimal.Decimal  `json:"estimated_tax"`
 	Transactions  []TaxTransaction `json:"transactions"`
 }
 
@@ -107,7 +115,7 @@ func (h *TaxHandler) GetTaxReport(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	var transactions []TaxTransaction
-	var totalGains, totalLosses float64
+	totalGains, totalLosses := decimal.Zero, decimal.Zero
 
 	for rows.Next() {
 		var tx TaxTransaction
@@ -121,33 +129,28 @@ func (h *TaxHandler) GetTaxReport(w http.ResponseWriter, r *http.Request) {
 		tx.Date = dateTime.Format("2006-01-02")
 		transactions = append(transactions, tx)
 
-		if tx.GainLoss > 0 {
-			totalGains += tx.GainLoss
+		if tx.GainLoss.IsPositive() {
+			totalGains = totalGains.Add(tx.GainLoss)
 		} else {
-			totalLosses += -tx.GainLoss
+			totalLosses = totalLosses.Add(tx.GainLoss.Neg())
 		}
 	}
 
 	// For NEW accounts: transactions will be empty, all values will be 0.00
-	netGainLoss := totalGains - totalLosses
-	allowance := 3000.00 // UK CGT allowance 2024-25
-	taxableAmount := netGainLoss - allowance
-	if taxableAmount < 0 {
-		taxableAmount = 0
-	}
+	netGainLoss := totalGains.Sub(totalLosses)
+	taxableAmount := decimal.Max(netGainLoss.Sub(cgtAllowance), decimal.Zero)
 
 	// Assume basic rate (18%) for capital gains - user should verify their actual rate
-	// Higher rate taxpayers pay 24%
-	estimatedTax := taxableAmount * 0.18
+	estimatedTax := taxableAmount.Mul(cgtBasicRate)
 
 	summary := TaxSummary{
 		TaxYear:       taxYear,
-		TotalGains:    totalGains,
-		TotalLosses:   totalLosses,
-		NetGainLoss:   netGainLoss,
-		Allowance:     allowance,
-		TaxableAmount: taxableAmount,
-		EstimatedTax:  estimatedTax,
+		TotalGains:    totalGains.RoundCurrency("GBP", decimal.RoundHalfUp),
+		TotalLosses:   totalLosses.RoundCurrency("GBP", decimal.RoundHalfUp),
+		NetGainLoss:   netGainLoss.RoundCurrency("GBP", decimal.RoundHalfUp),
+		Allowance:     cgtAllowance,
+		TaxableAmount: taxableAmount.RoundCurrency("GBP", decimal.RoundHalfUp),
+		EstimatedTax:  estimatedTax.RoundCurrency("GBP", decimal.RoundHalfUp),
 		Transactions:  transactions,
 	}
 
@@ -57,6 +57,32 @@ func AuthMiddleware(jwtManager *auth.JWTManager, logger *zap.Logger) mux.Middlew
 	}
 }
 
+// AdminMiddleware lets through only requests AuthMiddleware authenticated
+// with an admin token
+func AdminMiddleware(logger *zap.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(*auth.Claims)
+			if !ok {
+				respondUnauthorized(w, "Missing authorization")
+				return
+			}
+			if claims.Role != auth.RoleAdmin {
+				logger.Warn("Admin route refused",
+					zap.String("user_id", claims.UserID.String()),
+					zap.String("path", r.URL.Path),
+				)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"error": "Forbidden", "message": "Admin access required"}`))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func respondUnauthorized(w http.ResponseWriter, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusUnauthorized)
@@ -0,0 +1,133 @@
+// BitCurrent Exchange - Order Gateway Client
+package ordergateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Error is a non-success reply from the order gateway
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("order gateway returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Client calls the order gateway's internal order API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+// NewClient creates an order gateway client for the service at baseURL
+func NewClient(baseURL string, timeout time.Duration, logger *zap.Logger) *Client {
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+		logger:     logger,
+	}
+}
+
+type SubmitOrderRequest struct {
+	AccountID     string  `json:"account_id"`
+	Symbol        string  `json:"symbol"`
+	Side          string  `json:"side"`
+	OrderType     string  `json:"order_type"`
+	Price         *string `json:"price,omitempty"`
+	Quantity      string  `json:"quantity"`
+	TimeInForce   string  `json:"time_in_force,omitempty"`
+	PostOnly      bool    `json:"post_only,omitempty"`
+	ClientOrderID *string `json:"client_order_id,omitempty"`
+}
+
+// SubmitOrderResponse is the gateway's verdict on an order. Status is
+// "rejected" for risk, balance or engine rejections and "pending" when the
+// engine's answer was lost.
+type SubmitOrderResponse struct {
+	Success     bool   `json:"success"`
+	OrderID     string `json:"order_id,omitempty"`
+	Status      string `json:"status"`
+	TradesCount uint32 `json:"trades_count"`
+	Violation   string `json:"violation,omitempty"`
+	Message     string `json:"message"`
+}
+
+// reply covers both the order responses and the gateway's error body
+type reply struct {
+	SubmitOrderResponse
+	Error string `json:"error"`
+}
+
+// SubmitOrder runs risk checks, holds funds and places the order on the book
+func (c *Client) SubmitOrder(ctx context.Context, req SubmitOrderRequest) (*SubmitOrderResponse, error) {
+	statusCode, body, err := c.post(ctx, "/internal/v1/orders/submit", req)
+	if err != nil {
+		return nil, err
+	}
+
+	if body.Status == "" {
+		return nil, &Error{StatusCode: statusCode, Message: body.Message}
+	}
+	return &body.SubmitOrderResponse, nil
+}
+
+// CancelOrder removes the account's order from the book
+func (c *Client) CancelOrder(ctx context.Context, orderID, accountID uuid.UUID) error {
+	payload := map[string]string{"account_id": accountID.String()}
+
+	statusCode, body, err := c.post(ctx, "/internal/v1/orders/"+orderID.String()+"/cancel", payload)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusOK {
+		return &Error{StatusCode: statusCode, Message: body.Message}
+	}
+	return nil
+}
+
+func (c *Client) post(ctx context.Context, path string, payload interface{}) (int, *reply, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("order gateway request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body reply
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		c.logger.Warn("Unreadable order gateway response",
+			zap.String("path", path),
+			zap.Int("status", resp.StatusCode),
+			zap.Error(err),
+		)
+		return resp.StatusCode, nil, &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	}
+
+	return resp.StatusCode, &body, nil
+}
@@ -0,0 +1,215 @@
+// BitCurrent Exchange - Settlement Service Client
+package settlement
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/idempotency"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Error is a non-success reply from the settlement service
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("settlement service returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Client calls the settlement service's internal API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+// NewClient creates a settlement client for the service at baseURL
+func NewClient(baseURL string, timeout time.Duration, logger *zap.Logger) *Client {
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+		logger:     logger,
+	}
+}
+
+// DepositAddress is where an account sends deposits of a currency
+type DepositAddress struct {
+	Address string `json:"address"`
+	Network string `json:"network"`
+}
+
+// DepositAddress returns the account's current deposit address for
+// currency, generating one if it has none or its last one has been funded
+func (c *Client) DepositAddress(ctx context.Context, accountID uuid.UUID, currency string) (*DepositAddress, error) {
+	payload := map[string]string{
+		"account_id": accountID.String(),
+		"currency":   currency,
+	}
+
+	var address DepositAddress
+	status, err := c.post(ctx, "/internal/v1/deposits/address", payload, &address)
+	if err != nil {
+		return nil, err
+	}
+	if address.Address == "" {
+		return nil, &Error{StatusCode: status, Message: "no deposit address returned"}
+	}
+	return &address, nil
+}
+
+// Withdrawal is a requested withdrawal. Its amount plus fee is held from the
+// account's balance until it completes, fails or is rejected.
+type Withdrawal struct {
+	ID         uuid.UUID       `json:"id"`
+	Currency   string          `json:"currency"`
+	Amount     decimal.Decimal `json:"amount"`
+	Fee        decimal.Decimal `json:"fee"`
+	HeldAmount decimal.Decimal `json:"held_amount"`
+	Address    string          `json:"address,omitempty"`
+	Status     string          `json:"status"`
+}
+
+// RequestWithdrawal requests a withdrawal of amount from the account. An
+// account without enough withdrawable balance is refused with a 422. A
+// non-empty idempotencyKey is sent on, so a retry after a lost reply gets
+// the withdrawal already requested rather than a second one.
+func (c *Client) RequestWithdrawal(ctx context.Context, accountID uuid.UUID, currency string, amount decimal.Decimal, address, idempotencyKey string) (*Withdrawal, error) {
+	payload := map[string]string{
+		"account_id": accountID.String(),
+		"currency":   currency,
+		"amount":     amount.String(),
+		"address":    address,
+	}
+
+	var header http.Header
+	if idempotencyKey != "" {
+		header = http.Header{idempotency.HeaderKey: []string{idempotencyKey}}
+	}
+
+	var withdrawal Withdrawal
+	if _, err := c.do(ctx, http.MethodPost, "/internal/v1/withdrawals", header, payload, &withdrawal); err != nil {
+		return nil, err
+	}
+	return &withdrawal, nil
+}
+
+// AdminHeader carries the ID of the authenticated admin a request is made
+// for. The settlement service trusts it only from the gateway.
+const AdminHeader = "X-Admin-ID"
+
+// ApprovalQueue returns the withdrawals waiting for approval as the
+// settlement service lists them
+func (c *Client) ApprovalQueue(ctx context.Context, adminID uuid.UUID) (json.RawMessage, error) {
+	var queue json.RawMessage
+	if _, err := c.do(ctx, http.MethodGet, "/internal/v1/withdrawals/approvals", adminHeader(adminID), nil, &queue); err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+// WithdrawalApprovals returns every approval and rejection of a withdrawal
+func (c *Client) WithdrawalApprovals(ctx context.Context, adminID, withdrawalID uuid.UUID) (json.RawMessage, error) {
+	var decisions json.RawMessage
+	path := "/internal/v1/withdrawals/" + withdrawalID.String() + "/approvals"
+	if _, err := c.do(ctx, http.MethodGet, path, adminHeader(adminID), nil, &decisions); err != nil {
+		return nil, err
+	}
+	return decisions, nil
+}
+
+// DecideWithdrawal records adminID approving or, if approve is false,
+// rejecting a withdrawal, returning the settlement service's result
+func (c *Client) DecideWithdrawal(ctx context.Context, adminID, withdrawalID uuid.UUID, approve bool, reason string) (json.RawMessage, error) {
+	decision := "/reject"
+	if approve {
+		decision = "/approve"
+	}
+	payload := map[string]string{"reason": reason}
+
+	var result json.RawMessage
+	path := "/internal/v1/withdrawals/" + withdrawalID.String() + decision
+	if _, err := c.do(ctx, http.MethodPost, path, adminHeader(adminID), payload, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func adminHeader(adminID uuid.UUID) http.Header {
+	return http.Header{AdminHeader: []string{adminID.String()}}
+}
+
+// post sends payload to path and decodes a 2xx reply into out, returning
+// the reply's status. Other replies become an *Error carrying the service's
+// message.
+func (c *Client) post(ctx context.Context, path string, payload interface{}, out interface{}) (int, error) {
+	return c.do(ctx, http.MethodPost, path, nil, payload, out)
+}
+
+// do sends a request with header and, unless it is nil, payload as its
+// JSON body, and handles the reply as post does
+func (c *Client) do(ctx context.Context, method, path string, header http.Header, payload interface{}, out interface{}) (int, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return 0, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return 0, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("settlement request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to read settlement response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var rejection struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(body, &rejection); err != nil || rejection.Message == "" {
+			rejection.Message = http.StatusText(resp.StatusCode)
+		}
+		return resp.StatusCode, &Error{StatusCode: resp.StatusCode, Message: rejection.Message}
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		c.logger.Warn("Unreadable settlement response",
+			zap.String("path", path),
+			zap.Int("status", resp.StatusCode),
+			zap.Error(err),
+		)
+		return resp.StatusCode, &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	}
+	return resp.StatusCode, nil
+}
@@ -47,4 +47,3 @@ require (
 // Future integrations
 // github.com/onfido/onfido-go (KYC verification)
 // Custom Chainalysis SDK (AML screening)
-
@@ -8,9 +8,13 @@ import (
 	"time"
 
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"go.uber.org/zap"
 )
 
+// highValueThreshold flags transactions for manual review (£10,000)
+var highValueThreshold = decimal.RequireFromString("10000")
+
 type AMLHandler struct {
 	db     *database.PostgresDB
 	logger *zap.Logger
@@ -46,6 +50,12 @@ func (h *AMLHandler) CheckTransaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	amount, err := decimal.NewFromString(req.Amount)
+	if err != nil || amount.IsNegative() {
+		respondError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
@@ -67,10 +77,8 @@ func (h *AMLHandler) CheckTransaction(w http.ResponseWriter, r *http.Request) {
 	// Simple rule: Flag high-value transactions for manual review
 	// TODO: Use dailyVolume for velocity checks
 	_ = dailyVolume // Placeholder until velocity checks implemented
-	// TODO: Implement proper decimal comparison
-	const highValueThreshold = "10000" // £10,000
 
-	if req.Amount > highValueThreshold {
+	if amount.GreaterThan(highValueThreshold) {
 		response.Flags = append(response.Flags, "high_value_transaction")
 		response.RiskScore += 30
 	}
@@ -119,8 +127,8 @@ func (h *AMLHandler) GetAlerts(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *AMLHandler) getDailyVolume(ctx context.Context, accountID string) (string, error) {
-	var volume string
+func (h *AMLHandler) getDailyVolume(ctx context.Context, accountID string) (decimal.Decimal, error) {
+	var volume decimal.Decimal
 	query := `
 		SELECT COALESCE(SUM(quantity * price), 0)
 		FROM trades
@@ -7,13 +7,18 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/bitcurrent-exchange/platform/services/ledger-service/internal/handlers"
+	"github.com/bitcurrent-exchange/platform/services/ledger-service/internal/trades"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/config"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/holds"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/idempotency"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/logger"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
@@ -56,10 +61,53 @@ func main() {
 	}
 	defer db.Close()
 
+	// Hold reconciler releases holds the order flow missed and reports orphans
+	holdConfig := holds.DefaultReconcilerConfig()
+	if d := config.GetDuration("ledger.hold_reconcile_interval"); d > 0 {
+		holdConfig.Interval = d
+	}
+	if d := config.GetDuration("ledger.hold_stale_after"); d > 0 {
+		holdConfig.StaleAfter = d
+	}
+	holdReconciler := holds.NewReconciler(db, holdConfig, log)
+
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go holdReconciler.Start(bgCtx)
+
+	// Book matching engine trades into the ledger
+	tradeSource := trades.NewKafkaSource(trades.KafkaConfig{
+		Brokers: strings.Split(config.GetString("kafka.brokers"), ","),
+		Topic:   config.GetString("kafka.topics.trades"),
+		GroupID: "ledger-service-trades",
+	})
+	defer tradeSource.Close()
+
+	feeAccountID := trades.DefaultFeeAccountID
+	if s := config.GetString("ledger.fee_account_id"); s != "" {
+		if feeAccountID, err = uuid.Parse(s); err != nil {
+			log.Fatal("Invalid ledger.fee_account_id", zap.Error(err))
+		}
+	}
+	consumerConfig := trades.DefaultConsumerConfig()
+	if n := config.GetInt("ledger.trade_max_attempts"); n > 0 {
+		consumerConfig.MaxAttempts = n
+	}
+	tradeConsumer := trades.NewConsumer(tradeSource, trades.NewSettler(db, feeAccountID, log), trades.NewDeadLetterTable(db), consumerConfig, log)
+	go tradeConsumer.Run(bgCtx)
+
 	// Initialize handlers
 	balanceHandler := handlers.NewBalanceHandler(db, log)
 	transactionHandler := handlers.NewTransactionHandler(db, log)
-	reconciliationHandler := handlers.NewReconciliationHandler(db, log)
+	journalHandler := handlers.NewJournalHandler(db, log)
+
+	// Retried mutations replay their first response
+	idempotent := idempotency.Middleware(
+		idempotency.NewPostgresStore(db, config.GetDuration("idempotency.ttl")),
+		idempotency.Config{Scope: "ledger-service"},
+		log,
+	)
+	reconciliationHandler := handlers.NewReconciliationHandler(db, holdReconciler, log)
 
 	// Setup router
 	router := mux.NewRouter()
@@ -80,17 +128,22 @@ func main() {
 	// Balance operations
 	internal.HandleFunc("/balances/{account_id}", balanceHandler.GetBalances).Methods("GET")
 	internal.HandleFunc("/balances/{account_id}/{currency}", balanceHandler.GetBalance).Methods("GET")
-	internal.HandleFunc("/balances/reserve", balanceHandler.ReserveBalance).Methods("POST")
-	internal.HandleFunc("/balances/release", balanceHandler.ReleaseBalance).Methods("POST")
-	internal.HandleFunc("/balances/update", balanceHandler.UpdateBalance).Methods("POST")
+	internal.Handle("/balances/reserve", idempotent(http.HandlerFunc(balanceHandler.ReserveBalance))).Methods("POST")
+	internal.Handle("/balances/release", idempotent(http.HandlerFunc(balanceHandler.ReleaseBalance))).Methods("POST")
+	internal.Handle("/balances/update", idempotent(http.HandlerFunc(balanceHandler.UpdateBalance))).Methods("POST")
 
 	// Transaction operations
-	internal.HandleFunc("/transactions", transactionHandler.CreateTransaction).Methods("POST")
+	internal.Handle("/transactions", idempotent(http.HandlerFunc(transactionHandler.CreateTransaction))).Methods("POST")
 	internal.HandleFunc("/transactions/{account_id}", transactionHandler.ListTransactions).Methods("GET")
 
+	// Journal operations
+	internal.Handle("/journals", idempotent(http.HandlerFunc(journalHandler.CreateJournal))).Methods("POST")
+	internal.HandleFunc("/journals/{id}", journalHandler.GetJournal).Methods("GET")
+
 	// Reconciliation
 	internal.HandleFunc("/reconciliation/run", reconciliationHandler.RunReconciliation).Methods("POST")
 	internal.HandleFunc("/reconciliation/report", reconciliationHandler.GetReport).Methods("GET")
+	internal.HandleFunc("/reconciliation/holds", reconciliationHandler.RunHoldReconciliation).Methods("POST")
 
 	// Start HTTP server
 	addr := fmt.Sprintf("%s:%d",
@@ -120,6 +173,7 @@ func main() {
 	<-quit
 
 	log.Info("Shutting down Ledger Service...")
+	stopBackground()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
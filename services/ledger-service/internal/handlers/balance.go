@@ -4,10 +4,13 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/holds"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5"
@@ -105,11 +108,15 @@ func (h *BalanceHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, balance)
 }
 
+// ReserveBalanceRequest places a hold for an order or withdrawal. The
+// reference is the idempotency key: repeating a request returns the
+// original hold.
 type ReserveBalanceRequest struct {
-	AccountID string `json:"account_id"`
-	Currency  string `json:"currency"`
-	Amount    string `json:"amount"`
-	Reference string `json:"reference"`
+	AccountID     string `json:"account_id"`
+	Currency      string `json:"currency"`
+	Amount        string `json:"amount"`
+	ReferenceType string `json:"reference_type,omitempty"` // defaults to "order"
+	ReferenceID   string `json:"reference_id"`
 }
 
 func (h *BalanceHandler) ReserveBalance(w http.ResponseWriter, r *http.Request) {
@@ -119,11 +126,27 @@ func (h *BalanceHandler) ReserveBalance(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if req.AccountID == "" || req.Currency == "" || req.Amount == "" {
+	if req.AccountID == "" || req.Currency == "" || req.Amount == "" || req.ReferenceID == "" {
 		respondError(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
 
+	accountID, err := uuid.Parse(req.AccountID)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid account ID")
+		return
+	}
+
+	referenceType, referenceID, ok := parseReference(w, req.ReferenceType, req.ReferenceID)
+	if !ok {
+		return
+	}
+
+	amount, ok := parsePositiveAmount(w, req.Amount, req.Currency)
+	if !ok {
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
@@ -136,34 +159,19 @@ func (h *BalanceHandler) ReserveBalance(w http.ResponseWriter, r *http.Request)
 	}
 	defer tx.Rollback(ctx)
 
-	// Lock wallet row for update
-	var availableBalance string
-	lockQuery := `
-		SELECT available_balance
-		FROM wallets
-		WHERE account_id = $1 AND currency = $2
-		FOR UPDATE
-	`
-	err = tx.QueryRow(ctx, lockQuery, req.AccountID, req.Currency).Scan(&availableBalance)
-	if err != nil {
+	hold, created, err := holds.Place(ctx, tx, accountID, req.Currency, amount, referenceType, referenceID)
+	switch {
+	case errors.Is(err, holds.ErrWalletNotFound):
 		respondError(w, http.StatusNotFound, "Wallet not found")
 		return
-	}
-
-	// TODO: Check if available_balance >= amount (requires decimal comparison)
-
-	// Update balances (move from available to reserved)
-	updateQuery := `
-		UPDATE wallets
-		SET available_balance = available_balance - $1,
-		    reserved_balance = reserved_balance + $1,
-		    updated_at = NOW()
-		WHERE account_id = $2 AND currency = $3
-	`
-
-	_, err = tx.Exec(ctx, updateQuery, req.Amount, req.AccountID, req.Currency)
-	if err != nil {
-		h.logger.Error("Failed to update balances", zap.Error(err))
+	case errors.Is(err, holds.ErrInsufficientBalance):
+		respondError(w, http.StatusUnprocessableEntity, "Insufficient available balance")
+		return
+	case errors.Is(err, holds.ErrHoldMismatch):
+		respondError(w, http.StatusConflict, "A different hold already exists for this reference")
+		return
+	case err != nil:
+		h.logger.Error("Failed to place hold", zap.Error(err))
 		respondError(w, http.StatusInternalServerError, "Failed to reserve balance")
 		return
 	}
@@ -175,22 +183,31 @@ func (h *BalanceHandler) ReserveBalance(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !created {
+		respondJSON(w, http.StatusOK, hold)
+		return
+	}
+
 	h.logger.Info("Balance reserved",
 		zap.String("account_id", req.AccountID),
 		zap.String("currency", req.Currency),
-		zap.String("amount", req.Amount),
+		zap.String("amount", amount.String()),
+		zap.String("reference_type", referenceType),
+		zap.String("reference_id", req.ReferenceID),
 	)
 
-	respondJSON(w, http.StatusOK, map[string]string{
-		"message": "Balance reserved successfully",
-	})
+	respondJSON(w, http.StatusCreated, hold)
 }
 
+// ReleaseBalanceRequest returns what is left of a hold to available balance
 type ReleaseBalanceRequest struct {
-	AccountID string `json:"account_id"`
-	Currency  string `json:"currency"`
-	Amount    string `json:"amount"`
-	Reference string `json:"reference"`
+	ReferenceType string `json:"reference_type,omitempty"` // defaults to "order"
+	ReferenceID   string `json:"reference_id"`
+}
+
+type ReleaseBalanceResponse struct {
+	Hold     *holds.Hold     `json:"hold"`
+	Released decimal.Decimal `json:"released"`
 }
 
 func (h *BalanceHandler) ReleaseBalance(w http.ResponseWriter, r *http.Request) {
@@ -200,6 +217,16 @@ func (h *BalanceHandler) ReleaseBalance(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if req.ReferenceID == "" {
+		respondError(w, http.StatusBadRequest, "Missing required fields")
+		return
+	}
+
+	referenceType, referenceID, ok := parseReference(w, req.ReferenceType, req.ReferenceID)
+	if !ok {
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
@@ -212,18 +239,13 @@ func (h *BalanceHandler) ReleaseBalance(w http.ResponseWriter, r *http.Request)
 	}
 	defer tx.Rollback(ctx)
 
-	// Update balances (move from reserved to available)
-	updateQuery := `
-		UPDATE wallets
-		SET reserved_balance = reserved_balance - $1,
-		    available_balance = available_balance + $1,
-		    updated_at = NOW()
-		WHERE account_id = $2 AND currency = $3
-	`
-
-	_, err = tx.Exec(ctx, updateQuery, req.Amount, req.AccountID, req.Currency)
+	hold, released, err := holds.Release(ctx, tx, referenceType, referenceID)
+	if errors.Is(err, holds.ErrHoldNotFound) {
+		respondError(w, http.StatusNotFound, "Hold not found")
+		return
+	}
 	if err != nil {
-		h.logger.Error("Failed to update balances", zap.Error(err))
+		h.logger.Error("Failed to release hold", zap.Error(err))
 		respondError(w, http.StatusInternalServerError, "Failed to release balance")
 		return
 	}
@@ -235,27 +257,38 @@ func (h *BalanceHandler) ReleaseBalance(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	h.logger.Info("Balance released",
-		zap.String("account_id", req.AccountID),
-		zap.String("currency", req.Currency),
-		zap.String("amount", req.Amount),
-	)
+	if released.IsPositive() {
+		h.logger.Info("Balance released",
+			zap.String("account_id", hold.AccountID.String()),
+			zap.String("currency", hold.Currency),
+			zap.String("amount", released.String()),
+			zap.String("reference_type", referenceType),
+			zap.String("reference_id", req.ReferenceID),
+		)
+	}
 
-	respondJSON(w, http.StatusOK, map[string]string{
-		"message": "Balance released successfully",
+	respondJSON(w, http.StatusOK, ReleaseBalanceResponse{
+		Hold:     hold,
+		Released: released,
 	})
 }
 
 type UpdateBalanceRequest struct {
-	AccountID     string  `json:"account_id"`
-	Currency      string  `json:"currency"`
-	Amount        string  `json:"amount"`
-	EntryType     string  `json:"entry_type"`
-	ReferenceID   *string `json:"reference_id,omitempty"`
-	ReferenceType *string `json:"reference_type,omitempty"`
-	Description   string  `json:"description,omitempty"`
+	AccountID string `json:"account_id"`
+	// ContraAccountID takes the other side of the journal. Deposits and
+	// withdrawals default to the custody account, fees and rewards to the
+	// fee account.
+	ContraAccountID *string `json:"contra_account_id,omitempty"`
+	Currency        string  `json:"currency"`
+	Amount          string  `json:"amount"`
+	EntryType       string  `json:"entry_type"`
+	ReferenceID     *string `json:"reference_id,omitempty"`
+	ReferenceType   *string `json:"reference_type,omitempty"`
+	Description     string  `json:"description,omitempty"`
 }
 
+// UpdateBalance moves one account's balance, posting the other side of the
+// journal to a contra account
 func (h *BalanceHandler) UpdateBalance(w http.ResponseWriter, r *http.Request) {
 	var req UpdateBalanceRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -263,81 +296,11 @@ func (h *BalanceHandler) UpdateBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.AccountID == "" || req.Currency == "" || req.Amount == "" || req.EntryType == "" {
-		respondError(w, http.StatusBadRequest, "Missing required fields")
-		return
-	}
-
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	// Begin transaction for double-entry accounting
-	tx, err := h.db.Pool.Begin(ctx)
-	if err != nil {
-		h.logger.Error("Failed to begin transaction", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to update balance")
-		return
-	}
-	defer tx.Rollback(ctx)
-
-	// Lock wallet row
-	var currentBalance string
-	lockQuery := `SELECT balance FROM wallets WHERE account_id = $1 AND currency = $2 FOR UPDATE`
-	err = tx.QueryRow(ctx, lockQuery, req.AccountID, req.Currency).Scan(&currentBalance)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			respondError(w, http.StatusNotFound, "Wallet not found")
-		} else {
-			h.logger.Error("Failed to lock wallet", zap.Error(err))
-			respondError(w, http.StatusInternalServerError, "Failed to update balance")
-		}
-		return
-	}
-
-	// Update wallet balance
-	updateQuery := `
-		UPDATE wallets
-		SET balance = balance + $1,
-		    available_balance = available_balance + $1,
-		    updated_at = NOW()
-		WHERE account_id = $2 AND currency = $3
-		RETURNING balance
-	`
-
-	var newBalance string
-	err = tx.QueryRow(ctx, updateQuery, req.Amount, req.AccountID, req.Currency).Scan(&newBalance)
-	if err != nil {
-		h.logger.Error("Failed to update balance", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to update balance")
-		return
-	}
-
-	// Create ledger entry
-	ledgerQuery := `
-		INSERT INTO ledger_entries (
-			account_id, currency, amount, balance_after,
-			entry_type, reference_id, reference_type, description
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id
-	`
-
-	var ledgerID uuid.UUID
-	err = tx.QueryRow(
-		ctx, ledgerQuery,
-		req.AccountID, req.Currency, req.Amount, newBalance,
-		req.EntryType, req.ReferenceID, req.ReferenceType, req.Description,
-	).Scan(&ledgerID)
-
-	if err != nil {
-		h.logger.Error("Failed to create ledger entry", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to create ledger entry")
-		return
-	}
-
-	// Commit transaction
-	if err := tx.Commit(ctx); err != nil {
-		h.logger.Error("Failed to commit transaction", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to update balance")
+	entry, journalID, ok := postSingleEntry(ctx, w, h.db, h.logger, singleEntryRequest(req))
+	if !ok {
 		return
 	}
 
@@ -345,19 +308,53 @@ func (h *BalanceHandler) UpdateBalance(w http.ResponseWriter, r *http.Request) {
 		zap.String("account_id", req.AccountID),
 		zap.String("currency", req.Currency),
 		zap.String("amount", req.Amount),
-		zap.String("new_balance", newBalance),
-		zap.String("ledger_id", ledgerID.String()),
+		zap.String("new_balance", entry.BalanceAfter.String()),
+		zap.String("journal_id", journalID.String()),
 	)
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"message":     "Balance updated successfully",
-		"new_balance": newBalance,
-		"ledger_id":   ledgerID.String(),
+		"new_balance": entry.BalanceAfter.String(),
+		"ledger_id":   entry.ID.String(),
+		"journal_id":  journalID.String(),
 	})
 }
 
 // Helper functions
 
+// parsePositiveAmount parses amount at the currency's precision, writing a 400
+// response if it is malformed or not strictly positive.
+func parsePositiveAmount(w http.ResponseWriter, amount, currency string) (decimal.Decimal, bool) {
+	d, err := decimal.ParseAmount(amount, currency)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid amount")
+		return decimal.Zero, false
+	}
+	if !d.IsPositive() {
+		respondError(w, http.StatusBadRequest, "Amount must be positive")
+		return decimal.Zero, false
+	}
+	return d, true
+}
+
+// parseReference validates a hold reference, writing a 400 response if it
+// is not usable
+func parseReference(w http.ResponseWriter, referenceType, referenceID string) (string, uuid.UUID, bool) {
+	if referenceType == "" {
+		referenceType = holds.ReferenceOrder
+	}
+	if !holds.ValidReferenceType(referenceType) {
+		respondError(w, http.StatusBadRequest, "Invalid reference type")
+		return "", uuid.Nil, false
+	}
+	id, err := uuid.Parse(referenceID)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid reference ID")
+		return "", uuid.Nil, false
+	}
+	return referenceType, id, true
+}
+
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
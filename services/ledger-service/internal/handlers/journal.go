@@ -0,0 +1,277 @@
+// BitCurrent Exchange - Journal Handler
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+type JournalHandler struct {
+	db     *database.PostgresDB
+	logger *zap.Logger
+}
+
+func NewJournalHandler(db *database.PostgresDB, logger *zap.Logger) *JournalHandler {
+	return &JournalHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+type PostingRequest struct {
+	AccountID string `json:"account_id"`
+	Currency  string `json:"currency"`
+	Amount    string `json:"amount"`
+	EntryType string `json:"entry_type,omitempty"`
+}
+
+type CreateJournalRequest struct {
+	JournalType   string           `json:"journal_type"`
+	ReferenceID   *string          `json:"reference_id,omitempty"`
+	ReferenceType *string          `json:"reference_type,omitempty"`
+	Description   string           `json:"description,omitempty"`
+	Postings      []PostingRequest `json:"postings"`
+}
+
+type JournalResponse struct {
+	JournalID uuid.UUID       `json:"journal_id"`
+	Entries   []journal.Entry `json:"entries"`
+}
+
+// CreateJournal books a balanced set of postings across accounts
+func (h *JournalHandler) CreateJournal(w http.ResponseWriter, r *http.Request) {
+	var req CreateJournalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	j := &journal.Journal{
+		Type:          req.JournalType,
+		ReferenceType: req.ReferenceType,
+		Description:   req.Description,
+	}
+	if !parseJournalReference(w, req.ReferenceID, j) {
+		return
+	}
+
+	for _, p := range req.Postings {
+		accountID, err := uuid.Parse(p.AccountID)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid account ID")
+			return
+		}
+		amount, err := decimal.ParseAmount(p.Amount, p.Currency)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid amount")
+			return
+		}
+		j.Postings = append(j.Postings, journal.Posting{
+			AccountID: accountID,
+			Currency:  p.Currency,
+			Amount:    amount,
+			EntryType: p.EntryType,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	entries, err := postJournal(ctx, h.db, j)
+	if err != nil {
+		respondJournalError(w, h.logger, err)
+		return
+	}
+
+	h.logger.Info("Journal posted",
+		zap.String("journal_id", j.ID.String()),
+		zap.String("journal_type", j.Type),
+		zap.Int("postings", len(entries)),
+	)
+
+	respondJSON(w, http.StatusCreated, JournalResponse{
+		JournalID: j.ID,
+		Entries:   entries,
+	})
+}
+
+// GetJournal returns a journal's ledger entries
+func (h *JournalHandler) GetJournal(w http.ResponseWriter, r *http.Request) {
+	journalID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid journal ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT id, account_id, currency, amount, balance_after, entry_type
+		FROM ledger_entries
+		WHERE journal_id = $1
+		ORDER BY created_at, id
+	`
+	rows, err := h.db.Pool.Query(ctx, query, journalID)
+	if err != nil {
+		h.logger.Error("Failed to query journal", zap.Error(err))
+		respondError(w, http.StatusInternalServerError, "Failed to fetch journal")
+		return
+	}
+	defer rows.Close()
+
+	entries := []journal.Entry{}
+	for rows.Next() {
+		var e journal.Entry
+		if err := rows.Scan(&e.ID, &e.AccountID, &e.Currency, &e.Amount, &e.BalanceAfter, &e.EntryType); err != nil {
+			h.logger.Error("Failed to scan ledger entry", zap.Error(err))
+			respondError(w, http.StatusInternalServerError, "Failed to fetch journal")
+			return
+		}
+		entries = append(entries, e)
+	}
+
+	if len(entries) == 0 {
+		respondError(w, http.StatusNotFound, "Journal not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, JournalResponse{
+		JournalID: journalID,
+		Entries:   entries,
+	})
+}
+
+// singleEntryRequest is the shape of the older one-account endpoints. The
+// other side of the journal goes to ContraAccountID, or to the system
+// account implied by the entry type.
+type singleEntryRequest struct {
+	AccountID       string
+	ContraAccountID *string
+	Currency        string
+	Amount          string
+	EntryType       string
+	ReferenceID     *string
+	ReferenceType   *string
+	Description     string
+}
+
+// postSingleEntry books amount to the account against its contra account
+// and returns the account's entry. It writes the error response itself.
+func postSingleEntry(ctx context.Context, w http.ResponseWriter, db *database.PostgresDB, logger *zap.Logger, req singleEntryRequest) (*journal.Entry, uuid.UUID, bool) {
+	if req.AccountID == "" || req.Currency == "" || req.Amount == "" || req.EntryType == "" {
+		respondError(w, http.StatusBadRequest, "Missing required fields")
+		return nil, uuid.Nil, false
+	}
+
+	accountID, err := uuid.Parse(req.AccountID)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid account ID")
+		return nil, uuid.Nil, false
+	}
+
+	amount, err := decimal.ParseAmount(req.Amount, req.Currency)
+	if err != nil || amount.IsZero() {
+		respondError(w, http.StatusBadRequest, "Invalid amount")
+		return nil, uuid.Nil, false
+	}
+
+	var contraID uuid.UUID
+	if req.ContraAccountID != nil {
+		if contraID, err = uuid.Parse(*req.ContraAccountID); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid contra account ID")
+			return nil, uuid.Nil, false
+		}
+	} else if contraID = defaultContraAccount(req.EntryType, req.Currency); contraID == uuid.Nil {
+		respondError(w, http.StatusBadRequest, "contra_account_id is required for "+req.EntryType+" entries")
+		return nil, uuid.Nil, false
+	}
+	if contraID == accountID {
+		respondError(w, http.StatusBadRequest, "Contra account must differ from account")
+		return nil, uuid.Nil, false
+	}
+
+	j := &journal.Journal{
+		Type:          req.EntryType,
+		ReferenceType: req.ReferenceType,
+		Description:   req.Description,
+		Postings: []journal.Posting{
+			{AccountID: accountID, Currency: req.Currency, Amount: amount},
+			{AccountID: contraID, Currency: req.Currency, Amount: amount.Neg()},
+		},
+	}
+	if !parseJournalReference(w, req.ReferenceID, j) {
+		return nil, uuid.Nil, false
+	}
+
+	entries, err := postJournal(ctx, db, j)
+	if err != nil {
+		respondJournalError(w, logger, err)
+		return nil, uuid.Nil, false
+	}
+	return &entries[0], j.ID, true
+}
+
+// defaultContraAccount picks the system account on the other side of a
+// single-account entry, or uuid.Nil if the caller has to name one
+func defaultContraAccount(entryType, currency string) uuid.UUID {
+	switch entryType {
+	case journal.TypeDeposit, journal.TypeWithdrawal:
+		return journal.CustodyAccount(currency)
+	case journal.TypeFee, journal.TypeReward:
+		return journal.FeeAccountID
+	}
+	return uuid.Nil
+}
+
+func postJournal(ctx context.Context, db *database.PostgresDB, j *journal.Journal) ([]journal.Entry, error) {
+	var entries []journal.Entry
+	err := db.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		entries, err = journal.Post(ctx, tx, j)
+		return err
+	})
+	return entries, err
+}
+
+func parseJournalReference(w http.ResponseWriter, referenceID *string, j *journal.Journal) bool {
+	if referenceID == nil || *referenceID == "" {
+		return true
+	}
+	id, err := uuid.Parse(*referenceID)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid reference ID")
+		return false
+	}
+	j.ReferenceID = &id
+	return true
+}
+
+func respondJournalError(w http.ResponseWriter, logger *zap.Logger, err error) {
+	switch {
+	case errors.Is(err, journal.ErrInvalidType):
+		respondError(w, http.StatusBadRequest, "Invalid journal or entry type")
+	case errors.Is(err, journal.ErrEmptyJournal), errors.Is(err, journal.ErrZeroPosting):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, journal.ErrUnbalanced):
+		respondError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, journal.ErrInsufficientBalance):
+		respondError(w, http.StatusUnprocessableEntity, "Insufficient available balance")
+	case errors.Is(err, journal.ErrAccountNotFound):
+		respondError(w, http.StatusNotFound, "Account not found")
+	default:
+		logger.Error("Failed to post journal", zap.Error(err))
+		respondError(w, http.StatusInternalServerError, "Failed to post journal")
+	}
+}
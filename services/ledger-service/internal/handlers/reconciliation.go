@@ -7,18 +7,21 @@ import (
 	"time"
 
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/holds"
 	"go.uber.org/zap"
 )
 
 type ReconciliationHandler struct {
-	db     *database.PostgresDB
-	logger *zap.Logger
+	db             *database.PostgresDB
+	holdReconciler *holds.Reconciler
+	logger         *zap.Logger
 }
 
-func NewReconciliationHandler(db *database.PostgresDB, logger *zap.Logger) *ReconciliationHandler {
+func NewReconciliationHandler(db *database.PostgresDB, holdReconciler *holds.Reconciler, logger *zap.Logger) *ReconciliationHandler {
 	return &ReconciliationHandler{
-		db:     db,
-		logger: logger,
+		db:             db,
+		holdReconciler: holdReconciler,
+		logger:         logger,
 	}
 }
 
@@ -149,3 +152,19 @@ func (h *ReconciliationHandler) GetReport(w http.ResponseWriter, r *http.Request
 	// For now, run a fresh reconciliation
 	h.RunReconciliation(w, r)
 }
+
+// RunHoldReconciliation releases holds of settled orders and lists the
+// orphaned ones without waiting for the next scheduled pass
+func (h *ReconciliationHandler) RunHoldReconciliation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+
+	report, err := h.holdReconciler.RunOnce(ctx)
+	if err != nil {
+		h.logger.Error("Hold reconciliation failed", zap.Error(err))
+		respondError(w, http.StatusInternalServerError, "Hold reconciliation failed")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
@@ -27,6 +27,7 @@ func NewTransactionHandler(db *database.PostgresDB, logger *zap.Logger) *Transac
 
 type Transaction struct {
 	ID            string  `json:"id"`
+	JournalID     *string `json:"journal_id,omitempty"`
 	AccountID     string  `json:"account_id"`
 	Currency      string  `json:"currency"`
 	Amount        string  `json:"amount"`
@@ -39,15 +40,18 @@ type Transaction struct {
 }
 
 type CreateTransactionRequest struct {
-	AccountID     string  `json:"account_id"`
-	Currency      string  `json:"currency"`
-	Amount        string  `json:"amount"`
-	EntryType     string  `json:"entry_type"`
-	ReferenceID   *string `json:"reference_id,omitempty"`
-	ReferenceType *string `json:"reference_type,omitempty"`
-	Description   string  `json:"description,omitempty"`
+	AccountID       string  `json:"account_id"`
+	ContraAccountID *string `json:"contra_account_id,omitempty"`
+	Currency        string  `json:"currency"`
+	Amount          string  `json:"amount"`
+	EntryType       string  `json:"entry_type"`
+	ReferenceID     *string `json:"reference_id,omitempty"`
+	ReferenceType   *string `json:"reference_type,omitempty"`
+	Description     string  `json:"description,omitempty"`
 }
 
+// CreateTransaction records a transaction on one account as a two-sided
+// journal against its contra account
 func (h *TransactionHandler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
 	var req CreateTransactionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -55,88 +59,25 @@ func (h *TransactionHandler) CreateTransaction(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	if req.AccountID == "" || req.Currency == "" || req.Amount == "" || req.EntryType == "" {
-		respondError(w, http.StatusBadRequest, "Missing required fields")
-		return
-	}
-
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	// Begin transaction
-	tx, err := h.db.Pool.Begin(ctx)
-	if err != nil {
-		h.logger.Error("Failed to begin transaction", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to create transaction")
-		return
-	}
-	defer tx.Rollback(ctx)
-
-	// Get current balance
-	var currentBalance string
-	balanceQuery := `SELECT balance FROM wallets WHERE account_id = $1 AND currency = $2 FOR UPDATE`
-	err = tx.QueryRow(ctx, balanceQuery, req.AccountID, req.Currency).Scan(&currentBalance)
-	if err != nil {
-		respondError(w, http.StatusNotFound, "Wallet not found")
-		return
-	}
-
-	// Update wallet balance
-	updateQuery := `
-		UPDATE wallets
-		SET balance = balance + $1,
-		    available_balance = available_balance + $1,
-		    updated_at = NOW()
-		WHERE account_id = $2 AND currency = $3
-		RETURNING balance
-	`
-
-	var newBalance string
-	err = tx.QueryRow(ctx, updateQuery, req.Amount, req.AccountID, req.Currency).Scan(&newBalance)
-	if err != nil {
-		h.logger.Error("Failed to update balance", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to update balance")
-		return
-	}
-
-	// Create ledger entry
-	var transactionID string
-	ledgerQuery := `
-		INSERT INTO ledger_entries (
-			account_id, currency, amount, balance_after,
-			entry_type, reference_id, reference_type, description
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id
-	`
-
-	err = tx.QueryRow(
-		ctx, ledgerQuery,
-		req.AccountID, req.Currency, req.Amount, newBalance,
-		req.EntryType, req.ReferenceID, req.ReferenceType, req.Description,
-	).Scan(&transactionID)
-
-	if err != nil {
-		h.logger.Error("Failed to create ledger entry", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to create transaction")
-		return
-	}
-
-	// Commit transaction
-	if err := tx.Commit(ctx); err != nil {
-		h.logger.Error("Failed to commit transaction", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to create transaction")
+	entry, journalID, ok := postSingleEntry(ctx, w, h.db, h.logger, singleEntryRequest(req))
+	if !ok {
 		return
 	}
 
 	h.logger.Info("Transaction created",
-		zap.String("transaction_id", transactionID),
+		zap.String("transaction_id", entry.ID.String()),
+		zap.String("journal_id", journalID.String()),
 		zap.String("account_id", req.AccountID),
 		zap.String("amount", req.Amount),
 	)
 
 	respondJSON(w, http.StatusCreated, map[string]interface{}{
-		"transaction_id": transactionID,
-		"new_balance":    newBalance,
+		"transaction_id": entry.ID.String(),
+		"journal_id":     journalID.String(),
+		"new_balance":    entry.BalanceAfter.String(),
 	})
 }
 
@@ -154,7 +95,7 @@ func (h *TransactionHandler) ListTransactions(w http.ResponseWriter, r *http.Req
 	defer cancel()
 
 	query := `
-		SELECT id, account_id, currency, amount, balance_after,
+		SELECT id, journal_id, account_id, currency, amount, balance_after,
 		       entry_type, reference_id, reference_type, description, created_at
 		FROM ledger_entries
 		WHERE account_id = $1
@@ -193,7 +134,7 @@ func (h *TransactionHandler) ListTransactions(w http.ResponseWriter, r *http.Req
 		var description *string
 
 		err := rows.Scan(
-			&tx.ID, &tx.AccountID, &tx.Currency, &tx.Amount, &tx.BalanceAfter,
+			&tx.ID, &tx.JournalID, &tx.AccountID, &tx.Currency, &tx.Amount, &tx.BalanceAfter,
 			&tx.EntryType, &tx.ReferenceID, &tx.ReferenceType, &description, &createdAt,
 		)
 		if err != nil {
@@ -0,0 +1,221 @@
+// BitCurrent Exchange - Trade Consumer
+package trades
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/holds"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// TradeSettler books a trade, returning false if it was already booked
+type TradeSettler interface {
+	Settle(ctx context.Context, t *TradeEvent) (bool, error)
+}
+
+// ConsumerConfig controls when the consumer gives up on a trade
+type ConsumerConfig struct {
+	// MaxAttempts is how many times a trade failing with a permanent error
+	// is tried before it is dead-lettered
+	MaxAttempts int
+}
+
+// DefaultConsumerConfig returns the consumer defaults
+func DefaultConsumerConfig() ConsumerConfig {
+	return ConsumerConfig{
+		MaxAttempts: 5,
+	}
+}
+
+// Consumer feeds trade events from a Source into a TradeSettler.
+//
+// An event's offset is committed only after its trade is booked, and
+// booking is idempotent on the trade ID, so redelivery after a crash or
+// rebalance applies each trade exactly once. A trade that fails with a
+// transient error, such as the database being unreachable, is retried until
+// it succeeds: skipping it would leave balances wrong. One the ledger
+// rejects, such as an unbalanced journal, is dead-lettered after
+// MaxAttempts so the trades behind it are not held up.
+type Consumer struct {
+	source      Source
+	settler     TradeSettler
+	deadLetters DeadLetters
+	maxAttempts int
+	maxBackoff  time.Duration
+	logger      *zap.Logger
+}
+
+// NewConsumer creates a trade consumer
+func NewConsumer(source Source, settler TradeSettler, deadLetters DeadLetters, cfg ConsumerConfig, logger *zap.Logger) *Consumer {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultConsumerConfig().MaxAttempts
+	}
+	return &Consumer{
+		source:      source,
+		settler:     settler,
+		deadLetters: deadLetters,
+		maxAttempts: cfg.MaxAttempts,
+		maxBackoff:  30 * time.Second,
+		logger:      logger,
+	}
+}
+
+// Run consumes trade events until ctx is cancelled
+func (c *Consumer) Run(ctx context.Context) error {
+	c.logger.Info("Starting trade consumer")
+
+	for {
+		msg, err := c.source.Fetch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				c.logger.Info("Trade consumer stopped")
+				return ctx.Err()
+			}
+			c.logger.Error("Failed to fetch trade event", zap.Error(err))
+			if !c.sleep(ctx, time.Second) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		if err := c.handle(ctx, msg); err != nil {
+			return err
+		}
+
+		// A failed commit only means the event is redelivered and skipped
+		if err := c.source.Commit(ctx, msg); err != nil && ctx.Err() == nil {
+			c.logger.Warn("Failed to commit trade event offset",
+				zap.Int("partition", msg.Partition),
+				zap.Int64("offset", msg.Offset),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// handle books one event, retrying failures with backoff, or dead-letters
+// it. It only returns an error when ctx is cancelled.
+func (c *Consumer) handle(ctx context.Context, msg Message) error {
+	event, err := DecodeEvent(msg.Value)
+	if err != nil {
+		// Malformed events can never be booked
+		c.logger.Error("Dead-lettering malformed trade event",
+			zap.Int("partition", msg.Partition),
+			zap.Int64("offset", msg.Offset),
+			zap.ByteString("payload", msg.Value),
+			zap.Error(err),
+		)
+		return c.deadLetter(ctx, msg, 0, err)
+	}
+
+	backoff := 100 * time.Millisecond
+	rejected := 0
+	for attempt := 1; ; attempt++ {
+		_, err := c.settler.Settle(ctx, event)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		permanent := isPermanent(err)
+		c.logger.Error("Failed to settle trade",
+			zap.String("trade_id", event.ID.String()),
+			zap.Int("attempt", attempt),
+			zap.Bool("permanent", permanent),
+			zap.Error(err),
+		)
+
+		if permanent {
+			if rejected++; rejected >= c.maxAttempts {
+				c.logger.Error("Dead-lettering trade event",
+					zap.String("trade_id", event.ID.String()),
+					zap.Int("partition", msg.Partition),
+					zap.Int64("offset", msg.Offset),
+				)
+				return c.deadLetter(ctx, msg, attempt, err)
+			}
+		}
+
+		if !c.sleep(ctx, backoff) {
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+// deadLetter records msg so its offset can be committed. It retries until
+// the record is written: committing without it would lose the trade.
+func (c *Consumer) deadLetter(ctx context.Context, msg Message, attempts int, cause error) error {
+	backoff := 100 * time.Millisecond
+	for {
+		err := c.deadLetters.Record(ctx, msg, attempts, cause)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		c.logger.Error("Failed to dead-letter trade event",
+			zap.Int("partition", msg.Partition),
+			zap.Int64("offset", msg.Offset),
+			zap.Error(err),
+		)
+
+		if !c.sleep(ctx, backoff) {
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+// isPermanent reports whether a settlement error fails the same way every
+// time: the ledger rejecting the trade, a missing trading pair, or the
+// database rejecting the data. Anything else, like a lost connection or a
+// serialization failure, may succeed on retry.
+func isPermanent(err error) bool {
+	for _, target := range []error{
+		pgx.ErrNoRows,
+		journal.ErrEmptyJournal,
+		journal.ErrInvalidType,
+		journal.ErrZeroPosting,
+		journal.ErrUnbalanced,
+		journal.ErrAccountNotFound,
+		journal.ErrInsufficientBalance,
+		holds.ErrWalletNotFound,
+		holds.ErrInsufficientBalance,
+		holds.ErrHoldMismatch,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	// Data exceptions and integrity constraint violations
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && len(pgErr.Code) == 5 {
+		class := pgErr.Code[:2]
+		return class == "22" || class == "23"
+	}
+	return false
+}
+
+func (c *Consumer) sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,257 @@
+package trades
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/holds"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// fakeSettler books trades into a set keyed by trade ID, like the trades
+// table's primary key
+type fakeSettler struct {
+	mu       sync.Mutex
+	booked   map[uuid.UUID]int
+	attempts int
+	failures int
+	failWith error
+}
+
+func newFakeSettler() *fakeSettler {
+	return &fakeSettler{booked: make(map[uuid.UUID]int)}
+}
+
+func (f *fakeSettler) Settle(ctx context.Context, t *TradeEvent) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.attempts++
+	if f.failures > 0 {
+		f.failures--
+		if f.failWith != nil {
+			return false, f.failWith
+		}
+		return false, errors.New("database unavailable")
+	}
+	if f.booked[t.ID] > 0 {
+		return false, nil
+	}
+	f.booked[t.ID]++
+	return true, nil
+}
+
+func (f *fakeSettler) bookedCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.booked)
+}
+
+// fakeDeadLetters keeps dead letters in memory
+type fakeDeadLetters struct {
+	mu       sync.Mutex
+	messages []Message
+	attempts []int
+}
+
+func (f *fakeDeadLetters) Record(ctx context.Context, msg Message, attempts int, cause error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, msg)
+	f.attempts = append(f.attempts, attempts)
+	return nil
+}
+
+func newTestConsumer(source Source, settler TradeSettler) (*Consumer, *fakeDeadLetters) {
+	deadLetters := &fakeDeadLetters{}
+	consumer := NewConsumer(source, settler, deadLetters, ConsumerConfig{MaxAttempts: 3}, zap.NewNop())
+	consumer.maxBackoff = time.Millisecond
+	return consumer, deadLetters
+}
+
+func testTrade(t *testing.T) (*TradeEvent, []byte) {
+	t.Helper()
+	trade := &TradeEvent{
+		ID:              uuid.New(),
+		Symbol:          "BTC-GBP",
+		BuyerOrderID:    uuid.New(),
+		SellerOrderID:   uuid.New(),
+		BuyerAccountID:  uuid.New(),
+		SellerAccountID: uuid.New(),
+		Price:           decimal.RequireFromString("50000.00"),
+		Quantity:        decimal.RequireFromString("0.5"),
+		BuyerFee:        decimal.RequireFromString("25.00"),
+		SellerFee:       decimal.RequireFromString("12.50"),
+		ExecutedAt:      time.Now().UTC(),
+		SequenceID:      1,
+	}
+	data, err := json.Marshal(trade)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trade, data
+}
+
+// runConsumer runs c until the source has committed offset, then stops it
+func runConsumer(t *testing.T, c *Consumer, source *MemorySource, offset int64) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for source.Committed() < offset {
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatalf("consumer did not commit offset %d (committed %d)", offset, source.Committed())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestDecodeEventValidates(t *testing.T) {
+	trade, data := testTrade(t)
+
+	decoded, err := DecodeEvent(data)
+	if err != nil {
+		t.Fatalf("DecodeEvent() error = %v", err)
+	}
+	if decoded.ID != trade.ID || !decoded.Price.Equal(trade.Price) {
+		t.Errorf("DecodeEvent() = %+v, want %+v", decoded, trade)
+	}
+
+	trade.Quantity = decimal.Zero
+	data, _ = json.Marshal(trade)
+	if _, err := DecodeEvent(data); err == nil {
+		t.Error("expected error for zero quantity")
+	}
+	if _, err := DecodeEvent([]byte("not json")); err == nil {
+		t.Error("expected error for malformed payload")
+	}
+}
+
+func TestConsumerAppliesRedeliveredTradeOnce(t *testing.T) {
+	source := NewMemorySource()
+	settler := newFakeSettler()
+	consumer, _ := newTestConsumer(source, settler)
+
+	_, first := testTrade(t)
+	_, second := testTrade(t)
+	source.Publish(first)
+	source.Publish(second)
+	runConsumer(t, consumer, source, 1)
+
+	// Simulate a crash before the commit landed: everything is redelivered
+	source.mu.Lock()
+	source.committed = -1
+	source.mu.Unlock()
+	source.Rewind()
+	runConsumer(t, consumer, source, 1)
+
+	if got := settler.bookedCount(); got != 2 {
+		t.Errorf("booked %d trades, want 2", got)
+	}
+	if settler.attempts != 4 {
+		t.Errorf("settle attempts = %d, want 4", settler.attempts)
+	}
+}
+
+func TestConsumerDeadLettersMalformedEvents(t *testing.T) {
+	source := NewMemorySource()
+	settler := newFakeSettler()
+	consumer, deadLetters := newTestConsumer(source, settler)
+
+	_, valid := testTrade(t)
+	source.Publish([]byte(`{"id":"not-a-uuid"}`))
+	source.Publish(valid)
+	runConsumer(t, consumer, source, 1)
+
+	if got := settler.bookedCount(); got != 1 {
+		t.Errorf("booked %d trades, want 1", got)
+	}
+	if len(deadLetters.messages) != 1 || deadLetters.messages[0].Offset != 0 {
+		t.Errorf("dead letters = %+v, want the malformed event", deadLetters.messages)
+	}
+}
+
+// Transient failures are retried past MaxAttempts until the trade books
+func TestConsumerRetriesFailedSettlement(t *testing.T) {
+	source := NewMemorySource()
+	settler := newFakeSettler()
+	settler.failures = 4
+	consumer, deadLetters := newTestConsumer(source, settler)
+
+	_, data := testTrade(t)
+	source.Publish(data)
+	runConsumer(t, consumer, source, 0)
+
+	if got := settler.bookedCount(); got != 1 {
+		t.Errorf("booked %d trades, want 1", got)
+	}
+	if settler.attempts != 5 {
+		t.Errorf("settle attempts = %d, want 5", settler.attempts)
+	}
+	if len(deadLetters.messages) != 0 {
+		t.Errorf("dead-lettered %d events, want none", len(deadLetters.messages))
+	}
+}
+
+// A trade the ledger keeps rejecting is dead-lettered after MaxAttempts and
+// the trades behind it are still booked
+func TestConsumerDeadLettersRejectedTrade(t *testing.T) {
+	source := NewMemorySource()
+	settler := newFakeSettler()
+	settler.failures = 3
+	settler.failWith = fmt.Errorf("failed to book trade: %w", journal.ErrInsufficientBalance)
+	consumer, deadLetters := newTestConsumer(source, settler)
+
+	_, rejected := testTrade(t)
+	_, next := testTrade(t)
+	source.Publish(rejected)
+	source.Publish(next)
+	runConsumer(t, consumer, source, 1)
+
+	if len(deadLetters.messages) != 1 || deadLetters.messages[0].Offset != 0 || deadLetters.attempts[0] != 3 {
+		t.Errorf("dead letters = %+v after %v attempts, want offset 0 after 3", deadLetters.messages, deadLetters.attempts)
+	}
+	if got := settler.bookedCount(); got != 1 {
+		t.Errorf("booked %d trades, want 1", got)
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unbalanced journal", fmt.Errorf("failed to book trade: %w", journal.ErrUnbalanced), true},
+		{"hold mismatch", holds.ErrHoldMismatch, true},
+		{"unknown pair", fmt.Errorf("failed to load trading pair: %w", pgx.ErrNoRows), true},
+		{"sequence collision", &pgconn.PgError{Code: "23505"}, true},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, false},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, false},
+		{"connection lost", errors.New("conn closed"), false},
+		{"timeout", context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := isPermanent(tt.err); got != tt.want {
+			t.Errorf("%s: isPermanent() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
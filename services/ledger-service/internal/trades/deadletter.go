@@ -0,0 +1,41 @@
+// BitCurrent Exchange - Trade Dead Letters
+package trades
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+)
+
+// DeadLetters keeps trade events the consumer gave up on, so they can be
+// investigated and replayed by hand
+type DeadLetters interface {
+	Record(ctx context.Context, msg Message, attempts int, cause error) error
+}
+
+// DeadLetterTable records dead letters in the trade_dead_letters table
+type DeadLetterTable struct {
+	db *database.PostgresDB
+}
+
+// NewDeadLetterTable creates a dead letter store on db
+func NewDeadLetterTable(db *database.PostgresDB) *DeadLetterTable {
+	return &DeadLetterTable{db: db}
+}
+
+// Record stores msg with the error that stopped it. Recording the same
+// message again, after its offset failed to commit, keeps the first record.
+func (d *DeadLetterTable) Record(ctx context.Context, msg Message, attempts int, cause error) error {
+	query := `
+		INSERT INTO trade_dead_letters (topic, partition, "offset", key, payload, error, attempts)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (topic, partition, "offset") DO NOTHING
+	`
+	_, err := d.db.Pool.Exec(ctx, query,
+		msg.Topic, msg.Partition, msg.Offset, msg.Key, msg.Value, cause.Error(), attempts)
+	if err != nil {
+		return fmt.Errorf("failed to record dead letter: %w", err)
+	}
+	return nil
+}
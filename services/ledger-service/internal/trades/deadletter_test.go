@@ -0,0 +1,32 @@
+package trades
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+func TestDeadLetterTableRecord(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	deadLetters := NewDeadLetterTable(database.New(mock, zap.NewNop()))
+
+	msg := Message{Topic: "trades", Partition: 2, Offset: 41, Key: []byte("BTC-GBP"), Value: []byte(`{"id":"x"}`)}
+	mock.ExpectExec("INSERT INTO trade_dead_letters").
+		WithArgs("trades", 2, int64(41), msg.Key, msg.Value, "hold already exists with different terms", 5).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	if err := deadLetters.Record(context.Background(), msg, 5, errors.New("hold already exists with different terms")); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
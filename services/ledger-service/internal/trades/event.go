@@ -0,0 +1,54 @@
+// BitCurrent Exchange - Trade Events
+package trades
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+)
+
+// TradeEvent is a match published by the matching engine. Fees are in the
+// quote currency.
+type TradeEvent struct {
+	ID              uuid.UUID       `json:"id"`
+	Symbol          string          `json:"symbol"`
+	BuyerOrderID    uuid.UUID       `json:"buyer_order_id"`
+	SellerOrderID   uuid.UUID       `json:"seller_order_id"`
+	BuyerAccountID  uuid.UUID       `json:"buyer_account_id"`
+	SellerAccountID uuid.UUID       `json:"seller_account_id"`
+	Price           decimal.Decimal `json:"price"`
+	Quantity        decimal.Decimal `json:"quantity"`
+	BuyerFee        decimal.Decimal `json:"buyer_fee"`
+	SellerFee       decimal.Decimal `json:"seller_fee"`
+	ExecutedAt      time.Time       `json:"executed_at"`
+	SequenceID      uint64          `json:"sequence_id"`
+}
+
+// DecodeEvent parses and validates a trade event payload
+func DecodeEvent(data []byte) (*TradeEvent, error) {
+	var t TradeEvent
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid trade event: %w", err)
+	}
+
+	switch {
+	case t.ID == uuid.Nil:
+		return nil, errors.New("trade event missing id")
+	case t.Symbol == "":
+		return nil, errors.New("trade event missing symbol")
+	case t.BuyerOrderID == uuid.Nil || t.SellerOrderID == uuid.Nil:
+		return nil, errors.New("trade event missing order id")
+	case t.BuyerAccountID == uuid.Nil || t.SellerAccountID == uuid.Nil:
+		return nil, errors.New("trade event missing account id")
+	case !t.Price.IsPositive() || !t.Quantity.IsPositive():
+		return nil, errors.New("trade event price and quantity must be positive")
+	case t.BuyerFee.IsNegative() || t.SellerFee.IsNegative():
+		return nil, errors.New("trade event fees must not be negative")
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,193 @@
+// BitCurrent Exchange - Trade Settlement
+package trades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/holds"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// DefaultFeeAccountID is the system account seeded to collect trading fees
+var DefaultFeeAccountID = journal.FeeAccountID
+
+// settledCondition is true once an order is final and every unit of it is
+// filled or cancelled, so nothing more can draw on its hold
+const settledCondition = `status IN ('filled', 'cancelled', 'rejected', 'expired')
+	AND filled_quantity + cancelled_quantity >= quantity`
+
+// Settler books matched trades into wallets and the ledger
+type Settler struct {
+	db           *database.PostgresDB
+	feeAccountID uuid.UUID
+	logger       *zap.Logger
+}
+
+// NewSettler creates a settler crediting fees to feeAccountID
+func NewSettler(db *database.PostgresDB, feeAccountID uuid.UUID, logger *zap.Logger) *Settler {
+	return &Settler{
+		db:           db,
+		feeAccountID: feeAccountID,
+		logger:       logger,
+	}
+}
+
+// Settle books a trade in a single transaction: the trade row, both sides'
+// base and quote movements, fees into the fee account, hold consumption and
+// order fill state. It returns false if the trade was already booked, which
+// makes redelivered events harmless.
+func (s *Settler) Settle(ctx context.Context, t *TradeEvent) (bool, error) {
+	var applied bool
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		applied, err = s.settle(ctx, tx, t)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if applied {
+		s.logger.Info("Trade settled",
+			zap.String("trade_id", t.ID.String()),
+			zap.String("symbol", t.Symbol),
+			zap.String("price", t.Price.String()),
+			zap.String("quantity", t.Quantity.String()),
+		)
+	}
+	return applied, nil
+}
+
+func (s *Settler) settle(ctx context.Context, tx pgx.Tx, t *TradeEvent) (bool, error) {
+	var base, quote string
+	pairQuery := `SELECT base_currency, quote_currency FROM trading_pairs WHERE symbol = $1`
+	if err := tx.QueryRow(ctx, pairQuery, t.Symbol).Scan(&base, &quote); err != nil {
+		return false, fmt.Errorf("failed to load trading pair %s: %w", t.Symbol, err)
+	}
+
+	// Quote amounts are booked at the currency's precision. Rounding the
+	// buyer up and the seller down keeps the exchange whole; the difference
+	// goes to the fee account with the fees.
+	notional := t.Price.Mul(t.Quantity)
+	buyerPays := notional.RoundCurrency(quote, decimal.RoundUp)
+	sellerGets := notional.RoundCurrency(quote, decimal.RoundDown)
+	buyerFee := t.BuyerFee.RoundCurrency(quote, decimal.RoundHalfUp)
+	sellerFee := decimal.Min(t.SellerFee.RoundCurrency(quote, decimal.RoundHalfUp), sellerGets)
+	feeIncome := decimal.Sum(buyerFee, sellerFee, buyerPays.Sub(sellerGets))
+
+	// The trade row is the exactly-once guard: a redelivered event conflicts
+	// on its ID. Another trade reusing a sequence number is an error, not a
+	// duplicate.
+	var tradeID uuid.UUID
+	insertQuery := `
+		INSERT INTO trades (
+			id, symbol, buyer_order_id, seller_order_id, buyer_account_id, seller_account_id,
+			price, quantity, buyer_fee, seller_fee, buyer_fee_currency, seller_fee_currency,
+			executed_at, sequence_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11, $12, $13)
+		ON CONFLICT (id) DO NOTHING
+		RETURNING id
+	`
+	err := tx.QueryRow(ctx, insertQuery,
+		t.ID, t.Symbol, t.BuyerOrderID, t.SellerOrderID, t.BuyerAccountID, t.SellerAccountID,
+		t.Price, t.Quantity, buyerFee, sellerFee, quote, t.ExecutedAt, int64(t.SequenceID),
+	).Scan(&tradeID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Debug("Trade already settled", zap.String("trade_id", t.ID.String()))
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record trade: %w", err)
+	}
+
+	// Lock holds before wallets, each in a fixed order, so concurrent
+	// settlements on shared accounts cannot deadlock
+	orderIDs := []uuid.UUID{t.BuyerOrderID, t.SellerOrderID}
+	sort.Slice(orderIDs, func(i, j int) bool { return orderIDs[i].String() < orderIDs[j].String() })
+
+	orderHolds := make(map[uuid.UUID]*holds.Hold, 2)
+	for _, id := range orderIDs {
+		hold, err := holds.Get(ctx, tx, holds.ReferenceOrder, id)
+		if errors.Is(err, holds.ErrHoldNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		orderHolds[id] = hold
+	}
+
+	// Holds cover the seller's base and the buyer's quote and fee; the
+	// seller's fee comes out of the proceeds credited just before it
+	postings := []journal.Posting{
+		{AccountID: t.SellerAccountID, Currency: base, Amount: t.Quantity.Neg(), Hold: orderHolds[t.SellerOrderID]},
+		{AccountID: t.BuyerAccountID, Currency: base, Amount: t.Quantity},
+		{AccountID: t.BuyerAccountID, Currency: quote, Amount: buyerPays.Neg(), Hold: orderHolds[t.BuyerOrderID]},
+		{AccountID: t.SellerAccountID, Currency: quote, Amount: sellerGets},
+		{AccountID: t.BuyerAccountID, Currency: quote, Amount: buyerFee.Neg(), EntryType: journal.TypeFee, Hold: orderHolds[t.BuyerOrderID]},
+		{AccountID: t.SellerAccountID, Currency: quote, Amount: sellerFee.Neg(), EntryType: journal.TypeFee},
+		{AccountID: s.feeAccountID, Currency: quote, Amount: feeIncome, EntryType: journal.TypeFee},
+	}
+
+	referenceType := "trade"
+	j := &journal.Journal{
+		Type:          journal.TypeTrade,
+		ReferenceType: &referenceType,
+		ReferenceID:   &t.ID,
+		Description:   fmt.Sprintf("%s trade %s @ %s", t.Symbol, t.Quantity, t.Price),
+		// Fees and sub-penny proceeds can round to nothing
+		Postings: journal.NonZero(postings...),
+	}
+
+	if _, err := journal.Post(ctx, tx, j); err != nil {
+		return false, fmt.Errorf("failed to book trade %s: %w", t.ID, err)
+	}
+
+	for _, id := range []uuid.UUID{t.BuyerOrderID, t.SellerOrderID} {
+		if err := fillOrder(ctx, tx, id, t.Quantity); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// fillOrder records a fill and releases the order's hold remainder once the
+// order is settled. Orders still pending engine acknowledgement keep their
+// status; the order gateway sets it from the engine's reply.
+func fillOrder(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, quantity decimal.Decimal) error {
+	query := `
+		UPDATE orders
+		SET filled_quantity = filled_quantity + $1,
+		    remaining_quantity = GREATEST(quantity - filled_quantity - $1, 0),
+		    status = CASE
+		        WHEN status NOT IN ('new', 'partial') THEN status
+		        WHEN filled_quantity + $1 >= quantity THEN 'filled'
+		        ELSE 'partial'
+		    END,
+		    filled_at = CASE WHEN filled_quantity + $1 >= quantity THEN NOW() ELSE filled_at END,
+		    updated_at = NOW()
+		WHERE id = $2
+		RETURNING ` + settledCondition
+
+	var settled bool
+	if err := tx.QueryRow(ctx, query, quantity, orderID).Scan(&settled); err != nil {
+		return fmt.Errorf("failed to record fill on order %s: %w", orderID, err)
+	}
+	if !settled {
+		return nil
+	}
+
+	if _, _, err := holds.Release(ctx, tx, holds.ReferenceOrder, orderID); err != nil && !errors.Is(err, holds.ErrHoldNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package trades
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/holds"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+// amount matches a decimal argument by value rather than representation
+type amount string
+
+func (a amount) Match(v interface{}) bool {
+	d, ok := v.(decimal.Decimal)
+	return ok && d.Equal(decimal.RequireFromString(string(a)))
+}
+
+func newTestSettler(t *testing.T) (*Settler, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+	return NewSettler(database.New(mock, zap.NewNop()), DefaultFeeAccountID, zap.NewNop()), mock
+}
+
+func holdRow(orderID, accountID uuid.UUID, currency, held string) *pgxmock.Rows {
+	return pgxmock.NewRows([]string{
+		"id", "account_id", "currency", "amount", "consumed", "released",
+		"reference_type", "reference_id", "status", "created_at", "closed_at",
+	}).AddRow(
+		uuid.New(), accountID, currency, decimal.RequireFromString(held), decimal.Zero, decimal.Zero,
+		holds.ReferenceOrder, orderID, holds.StatusActive, time.Now(), nil,
+	)
+}
+
+func sortedPair(a, b uuid.UUID) (uuid.UUID, uuid.UUID) {
+	if b.String() < a.String() {
+		return b, a
+	}
+	return a, b
+}
+
+func TestSettleBooksBothSidesAndFees(t *testing.T) {
+	settler, mock := newTestSettler(t)
+	trade := &TradeEvent{
+		ID:              uuid.New(),
+		Symbol:          "BTC-GBP",
+		BuyerOrderID:    uuid.New(),
+		SellerOrderID:   uuid.New(),
+		BuyerAccountID:  uuid.New(),
+		SellerAccountID: uuid.New(),
+		Price:           decimal.RequireFromString("50000.01"),
+		Quantity:        decimal.RequireFromString("0.333"),
+		BuyerFee:        decimal.RequireFromString("16.650003"),
+		SellerFee:       decimal.RequireFromString("8.325001"),
+		ExecutedAt:      time.Now().UTC(),
+		SequenceID:      42,
+	}
+	buyer, seller, fees := trade.BuyerAccountID, trade.SellerAccountID, DefaultFeeAccountID
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT base_currency, quote_currency FROM trading_pairs").
+		WithArgs("BTC-GBP").
+		WillReturnRows(pgxmock.NewRows([]string{"base_currency", "quote_currency"}).AddRow("BTC", "GBP"))
+	mock.ExpectQuery("INSERT INTO trades").
+		WithArgs(trade.ID, "BTC-GBP", trade.BuyerOrderID, trade.SellerOrderID, buyer, seller,
+			amount("50000.01"), amount("0.333"), amount("16.65"), amount("8.33"), "GBP", trade.ExecutedAt, int64(42)).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(trade.ID))
+
+	// Holds are locked in order ID order
+	heldFor := map[uuid.UUID]*pgxmock.Rows{
+		trade.BuyerOrderID:  holdRow(trade.BuyerOrderID, buyer, "GBP", "16700.00"),
+		trade.SellerOrderID: holdRow(trade.SellerOrderID, seller, "BTC", "0.333"),
+	}
+	first, second := sortedPair(trade.BuyerOrderID, trade.SellerOrderID)
+	for _, id := range []uuid.UUID{first, second} {
+		mock.ExpectQuery("FROM balance_holds").
+			WithArgs(holds.ReferenceOrder, id).
+			WillReturnRows(heldFor[id])
+	}
+
+	// The seller's fee is not held, so comes out of available balance
+	for i := 0; i < 5; i++ {
+		mock.ExpectQuery("INSERT INTO wallets").
+			WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"available_balance", "allow_negative"}).AddRow(decimal.NewFromInt(100), false))
+	}
+
+	journalID := uuid.New()
+	mock.ExpectQuery("INSERT INTO journals").
+		WithArgs("trade", &trade.ID, pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(journalID))
+
+	postings := []struct {
+		account  uuid.UUID
+		currency string
+		amount   string
+		covered  string // drawn from the hold; empty for none
+	}{
+		{seller, "BTC", "-0.333", "0.333"},
+		{buyer, "BTC", "0.333", ""},
+		{buyer, "GBP", "-16650.01", "16650.01"},
+		{seller, "GBP", "16650.00", ""},
+		{buyer, "GBP", "-16.65", "16.65"},
+		{seller, "GBP", "-8.33", ""},
+		{fees, "GBP", "24.99", ""}, // both fees plus the rounding penny
+	}
+	for _, p := range postings {
+		covered := "0"
+		if p.covered != "" {
+			covered = p.covered
+			mock.ExpectExec("UPDATE balance_holds SET consumed").
+				WithArgs(amount(p.covered), pgxmock.AnyArg()).
+				WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		}
+		mock.ExpectQuery("UPDATE wallets").
+			WithArgs(amount(p.amount), amount(covered), p.account, p.currency).
+			WillReturnRows(pgxmock.NewRows([]string{"balance"}).AddRow(decimal.NewFromInt(100000)))
+		mock.ExpectQuery("INSERT INTO ledger_entries").
+			WithArgs(journalID, p.account, p.currency, amount(p.amount), pgxmock.AnyArg(),
+				pgxmock.AnyArg(), &trade.ID, pgxmock.AnyArg(), pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	}
+
+	// The buyer's order is now settled and its remainder released; the
+	// seller's is still open
+	mock.ExpectQuery("UPDATE orders").
+		WithArgs(amount("0.333"), trade.BuyerOrderID).
+		WillReturnRows(pgxmock.NewRows([]string{"settled"}).AddRow(true))
+	mock.ExpectQuery("FROM balance_holds").
+		WithArgs(holds.ReferenceOrder, trade.BuyerOrderID).
+		WillReturnRows(holdRow(trade.BuyerOrderID, buyer, "GBP", "16700.00"))
+	mock.ExpectExec("UPDATE wallets").
+		WithArgs(pgxmock.AnyArg(), buyer, "GBP").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery("UPDATE balance_holds").
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(holdRow(trade.BuyerOrderID, buyer, "GBP", "16700.00"))
+	mock.ExpectQuery("UPDATE orders").
+		WithArgs(amount("0.333"), trade.SellerOrderID).
+		WillReturnRows(pgxmock.NewRows([]string{"settled"}).AddRow(false))
+	mock.ExpectCommit()
+
+	applied, err := settler.Settle(context.Background(), trade)
+	if err != nil {
+		t.Fatalf("Settle() error = %v", err)
+	}
+	if !applied {
+		t.Error("Settle() = false, want true")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSettleSkipsDuplicateTrade(t *testing.T) {
+	settler, mock := newTestSettler(t)
+	trade, _ := testTrade(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT base_currency, quote_currency FROM trading_pairs").
+		WithArgs("BTC-GBP").
+		WillReturnRows(pgxmock.NewRows([]string{"base_currency", "quote_currency"}).AddRow("BTC", "GBP"))
+	args := make([]interface{}, 13)
+	for i := range args {
+		args[i] = pgxmock.AnyArg()
+	}
+	// ON CONFLICT (id) DO NOTHING returns no row for a trade already booked
+	mock.ExpectQuery("INSERT INTO trades .* ON CONFLICT \\(id\\) DO NOTHING").
+		WithArgs(args...).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+
+	applied, err := settler.Settle(context.Background(), trade)
+	if err != nil {
+		t.Fatalf("Settle() error = %v", err)
+	}
+	if applied {
+		t.Error("Settle() = true for an already booked trade")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A different trade reusing a book's sequence number is not a redelivery
+func TestSettleFailsOnSequenceCollision(t *testing.T) {
+	settler, mock := newTestSettler(t)
+	trade, _ := testTrade(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT base_currency, quote_currency FROM trading_pairs").
+		WithArgs("BTC-GBP").
+		WillReturnRows(pgxmock.NewRows([]string{"base_currency", "quote_currency"}).AddRow("BTC", "GBP"))
+	args := make([]interface{}, 13)
+	for i := range args {
+		args[i] = pgxmock.AnyArg()
+	}
+	mock.ExpectQuery("INSERT INTO trades").
+		WithArgs(args...).
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "idx_trades_symbol_sequence_id"})
+	mock.ExpectRollback()
+
+	if applied, err := settler.Settle(context.Background(), trade); err == nil || applied {
+		t.Errorf("Settle() = %v, %v; want an error", applied, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,163 @@
+// BitCurrent Exchange - Trade Event Sources
+package trades
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Message is one trade event as delivered by a Source
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+}
+
+// Source delivers trade events at least once. Messages that are not
+// committed are delivered again after a restart or rebalance.
+type Source interface {
+	Fetch(ctx context.Context) (Message, error)
+	Commit(ctx context.Context, msg Message) error
+	Close() error
+}
+
+// KafkaConfig holds the trade topic subscription
+type KafkaConfig struct {
+	Brokers []string
+	Topic   string
+	GroupID string
+}
+
+// KafkaSource reads trade events from a Kafka consumer group
+type KafkaSource struct {
+	reader *kafka.Reader
+}
+
+// NewKafkaSource joins the consumer group. Offsets are committed explicitly,
+// only after a trade has been booked.
+func NewKafkaSource(cfg KafkaConfig) *KafkaSource {
+	return &KafkaSource{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:        cfg.Brokers,
+			Topic:          cfg.Topic,
+			GroupID:        cfg.GroupID,
+			MinBytes:       1,
+			MaxBytes:       10e6,
+			MaxWait:        500 * time.Millisecond,
+			CommitInterval: 0, // synchronous commits
+			StartOffset:    kafka.FirstOffset,
+		}),
+	}
+}
+
+func (s *KafkaSource) Fetch(ctx context.Context) (Message, error) {
+	m, err := s.reader.FetchMessage(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Key:       m.Key,
+		Value:     m.Value,
+	}, nil
+}
+
+func (s *KafkaSource) Commit(ctx context.Context, msg Message) error {
+	return s.reader.CommitMessages(ctx, kafka.Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	})
+}
+
+func (s *KafkaSource) Close() error {
+	return s.reader.Close()
+}
+
+// MemorySource is an in-process Source for tests and local runs without
+// Kafka. It behaves like a single-partition topic.
+type MemorySource struct {
+	mu        sync.Mutex
+	messages  []Message
+	next      int
+	committed int64
+	notify    chan struct{}
+}
+
+// NewMemorySource creates an empty in-memory topic
+func NewMemorySource() *MemorySource {
+	return &MemorySource{
+		committed: -1,
+		notify:    make(chan struct{}, 1),
+	}
+}
+
+// Publish appends a message to the topic
+func (s *MemorySource) Publish(value []byte) {
+	s.mu.Lock()
+	s.messages = append(s.messages, Message{
+		Topic:  "trades",
+		Offset: int64(len(s.messages)),
+		Value:  value,
+	})
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Rewind simulates a consumer restart: delivery resumes after the last
+// committed offset, so uncommitted messages are delivered again
+func (s *MemorySource) Rewind() {
+	s.mu.Lock()
+	s.next = int(s.committed + 1)
+	s.mu.Unlock()
+}
+
+// Committed returns the last committed offset, or -1
+func (s *MemorySource) Committed() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.committed
+}
+
+func (s *MemorySource) Fetch(ctx context.Context) (Message, error) {
+	for {
+		s.mu.Lock()
+		if s.next < len(s.messages) {
+			msg := s.messages[s.next]
+			s.next++
+			s.mu.Unlock()
+			return msg, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		case <-s.notify:
+		}
+	}
+}
+
+func (s *MemorySource) Commit(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	if msg.Offset > s.committed {
+		s.committed = msg.Offset
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemorySource) Close() error {
+	return nil
+}
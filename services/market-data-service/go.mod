@@ -44,4 +44,3 @@ require (
 	golang.org/x/text v0.30.0 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
 )
-
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/bitcurrent-exchange/platform/services/order-gateway/internal/handlers"
+	"github.com/bitcurrent-exchange/platform/services/order-gateway/internal/ledger"
+	"github.com/bitcurrent-exchange/platform/services/order-gateway/internal/matching"
 	"github.com/bitcurrent-exchange/platform/services/order-gateway/internal/risk"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/config"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
@@ -58,10 +60,34 @@ func main() {
 	defer db.Close()
 
 	// Initialize risk engine
-	riskEngine := risk.NewRiskEngine(db, log)
+	riskEngine := risk.NewRiskEngine(db, risk.LoadConfig(), log)
+
+	// Initialize matching engine client
+	engineConfig := matching.DefaultConfig()
+	if addr := config.GetString("matching_engine.addr"); addr != "" {
+		engineConfig.Addr = addr
+	}
+	if n := config.GetInt("matching_engine.pool_size"); n > 0 {
+		engineConfig.PoolSize = n
+	}
+	if d := config.GetDuration("matching_engine.timeout"); d > 0 {
+		engineConfig.Timeout = d
+	}
+	if config.IsSet("matching_engine.max_retries") {
+		engineConfig.MaxRetries = config.GetInt("matching_engine.max_retries")
+	}
+
+	engine, err := matching.NewClient(engineConfig, log)
+	if err != nil {
+		log.Fatal("Failed to create matching engine client", zap.Error(err))
+	}
+	defer engine.Close()
+
+	// Ledger holds funds for each accepted order
+	ledgerClient := ledger.NewClient(config.GetString("ledger.url"), config.GetDuration("ledger.timeout"), log)
 
 	// Initialize handlers
-	orderHandler := handlers.NewOrderHandler(db, riskEngine, log)
+	orderHandler := handlers.NewOrderHandler(db, riskEngine, engine, ledgerClient, log)
 
 	// Setup router
 	router := mux.NewRouter()
@@ -80,6 +106,7 @@ func main() {
 	internal := router.PathPrefix("/internal/v1").Subrouter()
 	internal.HandleFunc("/orders/validate", orderHandler.ValidateOrder).Methods("POST")
 	internal.HandleFunc("/orders/submit", orderHandler.SubmitOrder).Methods("POST")
+	internal.HandleFunc("/orders/{id}/cancel", orderHandler.CancelOrder).Methods("POST")
 
 	// Start HTTP server
 	addr := fmt.Sprintf("%s:%d",
@@ -4,25 +4,38 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/bitcurrent-exchange/platform/services/order-gateway/internal/ledger"
+	"github.com/bitcurrent-exchange/platform/services/order-gateway/internal/matching"
+	"github.com/bitcurrent-exchange/platform/services/order-gateway/internal/matching/matchingpb"
 	"github.com/bitcurrent-exchange/platform/services/order-gateway/internal/risk"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
 )
 
 type OrderHandler struct {
 	db         *database.PostgresDB
 	riskEngine *risk.RiskEngine
+	engine     *matching.Client
+	ledger     *ledger.Client
 	logger     *zap.Logger
 }
 
-func NewOrderHandler(db *database.PostgresDB, riskEngine *risk.RiskEngine, logger *zap.Logger) *OrderHandler {
+func NewOrderHandler(db *database.PostgresDB, riskEngine *risk.RiskEngine, engine *matching.Client, ledgerClient *ledger.Client, logger *zap.Logger) *OrderHandler {
 	return &OrderHandler{
 		db:         db,
 		riskEngine: riskEngine,
+		engine:     engine,
+		ledger:     ledgerClient,
 		logger:     logger,
 	}
 }
@@ -39,8 +52,9 @@ type ValidateOrderRequest struct {
 }
 
 type ValidateOrderResponse struct {
-	Valid   bool   `json:"valid"`
-	Message string `json:"message,omitempty"`
+	Valid     bool   `json:"valid"`
+	Violation string `json:"violation,omitempty"`
+	Message   string `json:"message,omitempty"`
 }
 
 func (h *OrderHandler) ValidateOrder(w http.ResponseWriter, r *http.Request) {
@@ -65,20 +79,29 @@ func (h *OrderHandler) ValidateOrder(w http.ResponseWriter, r *http.Request) {
 		OrderType: req.OrderType,
 		Price:     req.Price,
 		Quantity:  req.Quantity,
+		PostOnly:  req.PostOnly,
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	// Run risk checks
-	if err := h.riskEngine.CheckOrder(ctx, order); err != nil {
+	if _, err := h.riskEngine.CheckOrder(ctx, order); err != nil {
+		violation, ok := risk.ViolationOf(err)
+		if !ok {
+			h.logger.Error("Risk checks failed to run", zap.Error(err))
+			respondError(w, http.StatusServiceUnavailable, "Risk checks unavailable")
+			return
+		}
+
 		h.logger.Warn("Order validation failed",
 			zap.String("account_id", req.AccountID),
 			zap.Error(err),
 		)
 		respondJSON(w, http.StatusOK, ValidateOrderResponse{
-			Valid:   false,
-			Message: err.Error(),
+			Valid:     false,
+			Violation: string(violation),
+			Message:   err.Error(),
 		})
 		return
 	}
@@ -90,21 +113,24 @@ func (h *OrderHandler) ValidateOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 type SubmitOrderRequest struct {
-	AccountID   string  `json:"account_id"`
-	Symbol      string  `json:"symbol"`
-	Side        string  `json:"side"`
-	OrderType   string  `json:"order_type"`
-	Price       *string `json:"price,omitempty"`
-	Quantity    string  `json:"quantity"`
-	TimeInForce string  `json:"time_in_force,omitempty"`
-	PostOnly    bool    `json:"post_only,omitempty"`
+	AccountID     string  `json:"account_id"`
+	Symbol        string  `json:"symbol"`
+	Side          string  `json:"side"`
+	OrderType     string  `json:"order_type"`
+	Price         *string `json:"price,omitempty"`
+	Quantity      string  `json:"quantity"`
+	TimeInForce   string  `json:"time_in_force,omitempty"`
+	PostOnly      bool    `json:"post_only,omitempty"`
+	ClientOrderID *string `json:"client_order_id,omitempty"`
 }
 
 type SubmitOrderResponse struct {
-	Success bool   `json:"success"`
-	OrderID string `json:"order_id,omitempty"`
-	Status  string `json:"status"`
-	Message string `json:"message"`
+	Success     bool   `json:"success"`
+	OrderID     string `json:"order_id,omitempty"`
+	Status      string `json:"status"`
+	TradesCount uint32 `json:"trades_count"`
+	Violation   string `json:"violation,omitempty"`
+	Message     string `json:"message"`
 }
 
 func (h *OrderHandler) SubmitOrder(w http.ResponseWriter, r *http.Request) {
@@ -121,6 +147,30 @@ func (h *OrderHandler) SubmitOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.TimeInForce == "" {
+		req.TimeInForce = "GTC"
+	}
+	if req.ClientOrderID != nil && *req.ClientOrderID == "" {
+		req.ClientOrderID = nil
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// A resubmitted client_order_id returns the original order unchanged
+	if req.ClientOrderID != nil {
+		existing, err := h.findByClientOrderID(ctx, accountID, *req.ClientOrderID)
+		if err != nil {
+			h.logger.Error("Failed to look up client order ID", zap.Error(err))
+			respondError(w, http.StatusInternalServerError, "Failed to submit order")
+			return
+		}
+		if existing != nil {
+			respondJSON(w, http.StatusOK, existing)
+			return
+		}
+	}
+
 	// Create order object for risk checks
 	order := &risk.Order{
 		AccountID: accountID,
@@ -129,46 +179,413 @@ func (h *OrderHandler) SubmitOrder(w http.ResponseWriter, r *http.Request) {
 		OrderType: req.OrderType,
 		Price:     req.Price,
 		Quantity:  req.Quantity,
+		PostOnly:  req.PostOnly,
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
-
 	// Run risk checks
-	if err := h.riskEngine.CheckOrder(ctx, order); err != nil {
+	reservation, err := h.riskEngine.CheckOrder(ctx, order)
+	if err != nil {
+		violation, ok := risk.ViolationOf(err)
+		if !ok {
+			h.logger.Error("Risk checks failed to run", zap.Error(err))
+			respondError(w, http.StatusServiceUnavailable, "Risk checks unavailable")
+			return
+		}
+
 		h.logger.Warn("Order failed risk checks",
 			zap.String("account_id", req.AccountID),
 			zap.Error(err),
 		)
 		respondJSON(w, http.StatusOK, SubmitOrderResponse{
-			Success: false,
-			Status:  "rejected",
-			Message: err.Error(),
+			Success:   false,
+			Status:    "rejected",
+			Violation: string(violation),
+			Message:   err.Error(),
 		})
 		return
 	}
 
-	// TODO: Reserve balance for buy orders
+	// Persist before submitting so the engine and trades reference our ID.
+	// The unique (account_id, client_order_id) index settles concurrent
+	// resubmissions: the loser replays the winner's order.
+	var orderID uuid.UUID
+	insertQuery := `
+		INSERT INTO orders (
+			account_id, symbol, side, order_type, price, quantity, remaining_quantity,
+			status, time_in_force, post_only, client_order_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $6, 'pending', $7, $8, $9)
+		ON CONFLICT (account_id, client_order_id) WHERE client_order_id IS NOT NULL DO NOTHING
+		RETURNING id
+	`
+
+	err = h.db.Pool.QueryRow(
+		ctx, insertQuery,
+		accountID, req.Symbol, req.Side, req.OrderType, req.Price, req.Quantity,
+		req.TimeInForce, req.PostOnly, req.ClientOrderID,
+	).Scan(&orderID)
+	if errors.Is(err, pgx.ErrNoRows) && req.ClientOrderID != nil {
+		existing, err := h.findByClientOrderID(ctx, accountID, *req.ClientOrderID)
+		if err != nil || existing == nil {
+			h.logger.Error("Failed to load duplicate order", zap.Error(err))
+			respondError(w, http.StatusInternalServerError, "Failed to submit order")
+			return
+		}
+		respondJSON(w, http.StatusOK, existing)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to insert order", zap.Error(err))
+		respondError(w, http.StatusInternalServerError, "Failed to submit order")
+		return
+	}
+
+	// Hold the funds before the engine can match the order. The hold is keyed
+	// by order ID, so the checks above racing another order cannot
+	// over-commit the account: the ledger has the final say.
+	if err := h.ledger.HoldForOrder(ctx, orderID, accountID, reservation.Currency, reservation.Amount); err != nil {
+		h.handleHoldError(ctx, w, orderID, err)
+		return
+	}
+
+	engineReq := &matchingpb.OrderRequest{
+		AccountId:     accountID.String(),
+		Symbol:        req.Symbol,
+		Side:          req.Side,
+		OrderType:     req.OrderType,
+		Price:         req.Price,
+		Quantity:      req.Quantity,
+		TimeInForce:   req.TimeInForce,
+		PostOnly:      req.PostOnly,
+		ClientOrderId: req.ClientOrderID,
+		OrderId:       proto.String(orderID.String()),
+	}
+
+	engineResp, err := h.engine.SubmitOrder(ctx, engineReq)
+	if err != nil {
+		h.handleSubmitError(ctx, w, orderID, err)
+		return
+	}
 
-	// TODO: Forward to matching engine via gRPC
-	// For now, just log and return success
-	h.logger.Info("Order passed risk checks, would forward to matching engine",
+	// Work out how much of the order the engine threw away. IOC and market
+	// orders never rest, so a partial fill is final. The ledger may already
+	// have booked fills (including maker fills after the order rested), so
+	// the engine's status never moves the order backwards.
+	status := engineResp.Status
+	cancelledQuantity := "0"
+	switch {
+	case !engineResp.Success:
+		status = "rejected"
+		cancelledQuantity = req.Quantity
+	case status == "partial" && (strings.EqualFold(req.TimeInForce, "IOC") || req.OrderType == "market"):
+		status = "cancelled"
+		cancelledQuantity = engineResp.RemainingQuantity
+	}
+
+	updateQuery := `
+		UPDATE orders
+		SET status = CASE
+		        WHEN $1 IN ('new', 'partial') AND filled_quantity >= quantity THEN 'filled'
+		        WHEN $1 = 'new' AND filled_quantity > 0 THEN 'partial'
+		        ELSE $1
+		    END,
+		    trades_count = $2,
+		    status_message = $3,
+		    cancelled_quantity = $4,
+		    filled_at = CASE WHEN $1 = 'filled' THEN COALESCE(filled_at, NOW()) ELSE filled_at END,
+		    cancelled_at = CASE WHEN $1 = 'cancelled' THEN NOW() ELSE cancelled_at END,
+		    updated_at = NOW()
+		WHERE id = $5
+		RETURNING ` + settledColumn
+
+	var settled bool
+	err = h.db.Pool.QueryRow(ctx, updateQuery, status, int64(engineResp.TradesCount), engineResp.Message, cancelledQuantity, orderID).Scan(&settled)
+	if err != nil {
+		// The engine has the order; the trade consumer will catch the row up
+		h.logger.Error("Failed to record engine response",
+			zap.String("order_id", orderID.String()),
+			zap.Error(err),
+		)
+	} else if settled {
+		h.releaseHold(ctx, orderID)
+	}
+
+	h.logger.Info("Order submitted to matching engine",
+		zap.String("order_id", orderID.String()),
 		zap.String("account_id", req.AccountID),
 		zap.String("symbol", req.Symbol),
 		zap.String("side", req.Side),
+		zap.String("status", status),
+		zap.Uint32("trades_count", engineResp.TradesCount),
 	)
 
-	// Mock order ID
-	orderID := uuid.New().String()
-
 	respondJSON(w, http.StatusOK, SubmitOrderResponse{
+		Success:     engineResp.Success,
+		OrderID:     orderID.String(),
+		Status:      status,
+		TradesCount: engineResp.TradesCount,
+		Message:     engineResp.Message,
+	})
+}
+
+// handleSubmitError records a failed engine call. If the request never left
+// this service the order is rejected; otherwise its fate is unknown and it is
+// left pending rather than risk contradicting the book.
+func (h *OrderHandler) handleSubmitError(ctx context.Context, w http.ResponseWriter, orderID uuid.UUID, err error) {
+	h.logger.Error("Matching engine submit failed",
+		zap.String("order_id", orderID.String()),
+		zap.Error(err),
+	)
+
+	if matching.NotDelivered(err) {
+		h.rejectOrder(ctx, orderID, "matching engine unavailable")
+
+		respondJSON(w, http.StatusServiceUnavailable, SubmitOrderResponse{
+			Success: false,
+			OrderID: orderID.String(),
+			Status:  "rejected",
+			Message: "Matching engine unavailable",
+		})
+		return
+	}
+
+	query := `UPDATE orders SET status_message = $1, updated_at = NOW() WHERE id = $2`
+	if _, dbErr := h.db.Pool.Exec(ctx, query, "engine response not received", orderID); dbErr != nil {
+		h.logger.Error("Failed to annotate pending order", zap.Error(dbErr))
+	}
+
+	respondJSON(w, http.StatusGatewayTimeout, SubmitOrderResponse{
+		Success: false,
+		OrderID: orderID.String(),
+		Status:  "pending",
+		Message: "Order submission outcome unknown",
+	})
+}
+
+type CancelOrderRequest struct {
+	AccountID string `json:"account_id"`
+}
+
+type CancelOrderResponse struct {
+	Success bool   `json:"success"`
+	OrderID string `json:"order_id"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// CancelOrder pulls a resting order from the book and releases its hold
+// once every fill it had before the cancel has been applied
+func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	var req CancelOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	accountID, err := uuid.Parse(req.AccountID)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid account ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var symbol, status string
+	query := `SELECT symbol, status FROM orders WHERE id = $1 AND account_id = $2`
+	err = h.db.Pool.QueryRow(ctx, query, orderID, accountID).Scan(&symbol, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		respondError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to load order", zap.Error(err))
+		respondError(w, http.StatusInternalServerError, "Failed to cancel order")
+		return
+	}
+
+	if status != "new" && status != "partial" {
+		respondError(w, http.StatusConflict, "Order cannot be cancelled in status "+status)
+		return
+	}
+
+	engineResp, err := h.engine.CancelOrder(ctx, &matchingpb.CancelOrderRequest{
+		Symbol:  symbol,
+		OrderId: orderID.String(),
+	})
+	if err != nil {
+		h.logger.Error("Matching engine cancel failed",
+			zap.String("order_id", orderID.String()),
+			zap.Error(err),
+		)
+		respondError(w, http.StatusServiceUnavailable, "Matching engine unavailable")
+		return
+	}
+	if !engineResp.Success {
+		// Filled (or already cancelled) after we read it; fills will settle it
+		respondError(w, http.StatusConflict, "Order is no longer on the book")
+		return
+	}
+
+	cancelledQuantity, err := decimal.NewFromString(engineResp.RemainingQuantity)
+	if err != nil {
+		// Leave the hold for the reconciler to report rather than guess
+		h.logger.Error("Engine returned invalid remaining quantity",
+			zap.String("order_id", orderID.String()),
+			zap.String("remaining_quantity", engineResp.RemainingQuantity),
+		)
+		cancelledQuantity = decimal.Zero
+	}
+
+	updateQuery := `
+		UPDATE orders
+		SET status = 'cancelled',
+		    cancelled_quantity = $1,
+		    cancelled_at = NOW(),
+		    updated_at = NOW()
+		WHERE id = $2
+		RETURNING ` + settledColumn
+
+	var settled bool
+	if err := h.db.Pool.QueryRow(ctx, updateQuery, cancelledQuantity, orderID).Scan(&settled); err != nil {
+		h.logger.Error("Failed to record cancellation",
+			zap.String("order_id", orderID.String()),
+			zap.Error(err),
+		)
+		respondError(w, http.StatusInternalServerError, "Order cancelled but not recorded")
+		return
+	}
+
+	if settled {
+		h.releaseHold(ctx, orderID)
+	}
+
+	h.logger.Info("Order cancelled",
+		zap.String("order_id", orderID.String()),
+		zap.String("account_id", req.AccountID),
+		zap.String("cancelled_quantity", cancelledQuantity.String()),
+	)
+
+	respondJSON(w, http.StatusOK, CancelOrderResponse{
 		Success: true,
-		OrderID: orderID,
-		Status:  "accepted",
-		Message: "Order submitted to matching engine",
+		OrderID: orderID.String(),
+		Status:  "cancelled",
+		Message: "Order cancelled",
 	})
 }
 
+// handleHoldError rejects an order whose funds could not be held. If the
+// ledger's answer was lost the hold may exist, so it is released as well.
+func (h *OrderHandler) handleHoldError(ctx context.Context, w http.ResponseWriter, orderID uuid.UUID, err error) {
+	if errors.Is(err, ledger.ErrInsufficientBalance) || errors.Is(err, ledger.ErrWalletNotFound) {
+		h.rejectOrder(ctx, orderID, "insufficient balance")
+
+		respondJSON(w, http.StatusOK, SubmitOrderResponse{
+			Success:   false,
+			OrderID:   orderID.String(),
+			Status:    "rejected",
+			Violation: string(risk.ViolationInsufficientBalance),
+			Message:   "Insufficient available balance",
+		})
+		return
+	}
+
+	h.logger.Error("Failed to hold order funds",
+		zap.String("order_id", orderID.String()),
+		zap.Error(err),
+	)
+	h.rejectOrder(ctx, orderID, "ledger unavailable")
+
+	respondJSON(w, http.StatusServiceUnavailable, SubmitOrderResponse{
+		Success: false,
+		OrderID: orderID.String(),
+		Status:  "rejected",
+		Message: "Ledger unavailable",
+	})
+}
+
+// settledColumn reports whether an order is final and every unit of it is
+// accounted for, so nothing more can draw on its hold
+const settledColumn = `status IN ('filled', 'cancelled', 'rejected', 'expired')
+	AND filled_quantity + cancelled_quantity >= quantity`
+
+// rejectOrder marks an order the engine never accepted as rejected and
+// returns its hold
+func (h *OrderHandler) rejectOrder(ctx context.Context, orderID uuid.UUID, reason string) {
+	query := `
+		UPDATE orders
+		SET status = 'rejected', status_message = $1, cancelled_quantity = quantity, updated_at = NOW()
+		WHERE id = $2
+	`
+	if _, err := h.db.Pool.Exec(ctx, query, reason, orderID); err != nil {
+		h.logger.Error("Failed to reject order",
+			zap.String("order_id", orderID.String()),
+			zap.Error(err),
+		)
+		return
+	}
+
+	h.releaseHold(ctx, orderID)
+}
+
+// releaseHold returns what is left of a settled order's hold. Failures are
+// only logged: the ledger's hold reconciler releases it later.
+func (h *OrderHandler) releaseHold(ctx context.Context, orderID uuid.UUID) {
+	released, err := h.ledger.ReleaseOrderHold(ctx, orderID)
+	if err != nil {
+		h.logger.Error("Failed to release order hold",
+			zap.String("order_id", orderID.String()),
+			zap.Error(err),
+		)
+		return
+	}
+
+	if released.IsPositive() {
+		h.logger.Info("Order hold released",
+			zap.String("order_id", orderID.String()),
+			zap.String("released", released.String()),
+		)
+	}
+}
+
+// findByClientOrderID returns the stored outcome of a previous submission,
+// or nil if the client order ID has not been seen
+func (h *OrderHandler) findByClientOrderID(ctx context.Context, accountID uuid.UUID, clientOrderID string) (*SubmitOrderResponse, error) {
+	var resp SubmitOrderResponse
+	var orderID uuid.UUID
+	var tradesCount int64
+	var message *string
+
+	query := `
+		SELECT id, status, trades_count, status_message
+		FROM orders
+		WHERE account_id = $1 AND client_order_id = $2
+	`
+
+	err := h.db.Pool.QueryRow(ctx, query, accountID, clientOrderID).Scan(&orderID, &resp.Status, &tradesCount, &message)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp.OrderID = orderID.String()
+	resp.TradesCount = uint32(tradesCount)
+	resp.Success = resp.Status != "rejected" && resp.Status != "pending"
+	resp.Message = "Duplicate client_order_id; returning original order"
+	if message != nil {
+		resp.Message = *message
+	}
+
+	return &resp, nil
+}
+
 // Helper functions
 
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
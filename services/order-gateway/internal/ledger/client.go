@@ -0,0 +1,144 @@
+// BitCurrent Exchange - Ledger Service Client
+package ledger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrInsufficientBalance means the account cannot cover the hold
+	ErrInsufficientBalance = errors.New("insufficient available balance")
+	// ErrWalletNotFound means the account has no wallet in the currency
+	ErrWalletNotFound = errors.New("wallet not found")
+)
+
+// Client talks to the ledger service's internal balance API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+// NewClient creates a ledger client for the service at baseURL
+func NewClient(baseURL string, timeout time.Duration, logger *zap.Logger) *Client {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+		logger:     logger,
+	}
+}
+
+type reserveRequest struct {
+	AccountID     string          `json:"account_id"`
+	Currency      string          `json:"currency"`
+	Amount        decimal.Decimal `json:"amount"`
+	ReferenceType string          `json:"reference_type"`
+	ReferenceID   string          `json:"reference_id"`
+}
+
+type releaseRequest struct {
+	ReferenceType string `json:"reference_type"`
+	ReferenceID   string `json:"reference_id"`
+}
+
+type releaseResponse struct {
+	Released decimal.Decimal `json:"released"`
+}
+
+// HoldForOrder reserves amount of currency against the order. It is safe to
+// repeat: the ledger keys holds by order ID.
+func (c *Client) HoldForOrder(ctx context.Context, orderID, accountID uuid.UUID, currency string, amount decimal.Decimal) error {
+	req := reserveRequest{
+		AccountID:     accountID.String(),
+		Currency:      currency,
+		Amount:        amount,
+		ReferenceType: "order",
+		ReferenceID:   orderID.String(),
+	}
+
+	status, body, err := c.post(ctx, "/internal/v1/balances/reserve", req)
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusUnprocessableEntity:
+		return ErrInsufficientBalance
+	case http.StatusNotFound:
+		return ErrWalletNotFound
+	}
+	return fmt.Errorf("ledger reserve failed with status %d: %s", status, body)
+}
+
+// ReleaseOrderHold returns what is left of the order's hold to the
+// account's available balance
+func (c *Client) ReleaseOrderHold(ctx context.Context, orderID uuid.UUID) (decimal.Decimal, error) {
+	req := releaseRequest{
+		ReferenceType: "order",
+		ReferenceID:   orderID.String(),
+	}
+
+	status, body, err := c.post(ctx, "/internal/v1/balances/release", req)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	switch status {
+	case http.StatusOK:
+		var resp releaseResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return decimal.Zero, fmt.Errorf("invalid ledger release response: %w", err)
+		}
+		c.logger.Debug("Order hold released",
+			zap.String("order_id", orderID.String()),
+			zap.String("released", resp.Released.String()),
+		)
+		return resp.Released, nil
+	case http.StatusNotFound:
+		// Nothing was ever held for this order
+		return decimal.Zero, nil
+	}
+	return decimal.Zero, fmt.Errorf("ledger release failed with status %d: %s", status, body)
+}
+
+func (c *Client) post(ctx context.Context, path string, payload interface{}) (int, []byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ledger request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return 0, nil, fmt.Errorf("failed to read ledger response: %w", err)
+	}
+
+	return resp.StatusCode, buf.Bytes(), nil
+}
@@ -0,0 +1,215 @@
+// BitCurrent Exchange - Matching Engine gRPC Client
+package matching
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/order-gateway/internal/matching/matchingpb"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Config holds matching engine connection settings
+type Config struct {
+	Addr         string
+	PoolSize     int           // number of HTTP/2 connections to spread calls over
+	Timeout      time.Duration // per-attempt deadline
+	MaxRetries   int           // retries for idempotent calls only
+	RetryBackoff time.Duration // initial backoff, doubled per attempt
+}
+
+// DefaultConfig returns settings suitable for local development
+func DefaultConfig() Config {
+	return Config{
+		Addr:         "localhost:9090",
+		PoolSize:     4,
+		Timeout:      2 * time.Second,
+		MaxRetries:   3,
+		RetryBackoff: 50 * time.Millisecond,
+	}
+}
+
+// Client is a pooled matching engine client.
+//
+// SubmitOrder is never retried: the engine does not deduplicate, so a retry
+// after a lost response could place the order twice. CancelOrder and
+// GetOrderBook are safe to repeat and are retried on transient failures.
+type Client struct {
+	conns   []*grpc.ClientConn
+	clients []matchingpb.MatchingEngineClient
+	next    atomic.Uint32
+	config  Config
+	logger  *zap.Logger
+}
+
+// NewClient dials PoolSize connections to the matching engine. Connections
+// are established lazily, so this does not fail if the engine is down.
+func NewClient(cfg Config, logger *zap.Logger) (*Client, error) {
+	return newClient(cfg, logger)
+}
+
+// newClient dials with opts added to the defaults, letting tests swap the
+// network for an in-process listener
+func newClient(cfg Config, logger *zap.Logger, opts ...grpc.DialOption) (*Client, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("matching engine address is required")
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 1
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultConfig().Timeout
+	}
+
+	c := &Client{config: cfg, logger: logger}
+
+	for i := 0; i < cfg.PoolSize; i++ {
+		dialOpts := append([]grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithKeepaliveParams(keepalive.ClientParameters{
+				Time:                30 * time.Second,
+				Timeout:             10 * time.Second,
+				PermitWithoutStream: true,
+			}),
+		}, opts...)
+		conn, err := grpc.NewClient(cfg.Addr, dialOpts...)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("failed to create matching engine connection: %w", err)
+		}
+		c.conns = append(c.conns, conn)
+		c.clients = append(c.clients, matchingpb.NewMatchingEngineClient(conn))
+	}
+
+	logger.Info("Matching engine client created",
+		zap.String("addr", cfg.Addr),
+		zap.Int("pool_size", cfg.PoolSize),
+	)
+
+	return c, nil
+}
+
+// Close closes all pooled connections
+func (c *Client) Close() error {
+	var firstErr error
+	for _, conn := range c.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// pick returns the next client in round-robin order
+func (c *Client) pick() matchingpb.MatchingEngineClient {
+	n := c.next.Add(1)
+	return c.clients[int(n)%len(c.clients)]
+}
+
+// SubmitOrder sends an order to the engine. It is attempted exactly once.
+func (c *Client) SubmitOrder(ctx context.Context, req *matchingpb.OrderRequest) (*matchingpb.OrderResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	var p peer.Peer
+	resp, err := c.pick().SubmitOrder(ctx, req, grpc.Peer(&p))
+	return resp, delivery(err, &p)
+}
+
+// CancelOrder cancels a resting order, retrying transient failures
+func (c *Client) CancelOrder(ctx context.Context, req *matchingpb.CancelOrderRequest) (*matchingpb.CancelOrderResponse, error) {
+	var resp *matchingpb.CancelOrderResponse
+	err := c.withRetry(ctx, "CancelOrder", func(ctx context.Context) error {
+		var err error
+		var p peer.Peer
+		resp, err = c.pick().CancelOrder(ctx, req, grpc.Peer(&p))
+		return delivery(err, &p)
+	})
+	return resp, err
+}
+
+// GetOrderBook returns a depth snapshot, retrying transient failures
+func (c *Client) GetOrderBook(ctx context.Context, req *matchingpb.GetOrderBookRequest) (*matchingpb.GetOrderBookResponse, error) {
+	var resp *matchingpb.GetOrderBookResponse
+	err := c.withRetry(ctx, "GetOrderBook", func(ctx context.Context) error {
+		var err error
+		var p peer.Peer
+		resp, err = c.pick().GetOrderBook(ctx, req, grpc.Peer(&p))
+		return delivery(err, &p)
+	})
+	return resp, err
+}
+
+// withRetry runs call with a per-attempt deadline, retrying retryable
+// errors with exponential backoff until MaxRetries or ctx is done
+func (c *Client) withRetry(ctx context.Context, method string, call func(context.Context) error) error {
+	backoff := c.config.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+		err := call(attemptCtx)
+		cancel()
+
+		if err == nil || !IsRetryable(err) || attempt >= c.config.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		c.logger.Warn("Retrying matching engine call",
+			zap.String("method", method),
+			zap.Int("attempt", attempt+1),
+			zap.Error(err),
+		)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// IsRetryable reports whether a call that failed with err may be repeated
+func IsRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// undeliveredError is a failed call that never opened a stream to the
+// engine, so the engine cannot have seen it. It keeps the call's status.
+type undeliveredError struct {
+	err error
+}
+
+func (e *undeliveredError) Error() string              { return e.err.Error() }
+func (e *undeliveredError) Unwrap() error              { return e.err }
+func (e *undeliveredError) GRPCStatus() *status.Status { return status.Convert(e.err) }
+
+// delivery marks err undelivered if the call got no peer. gRPC records the
+// peer once a stream is open, so an Unavailable from the engine itself or
+// from a connection lost mid-call is not mistaken for one never sent.
+func delivery(err error, p *peer.Peer) error {
+	if err != nil && p.Addr == nil {
+		return &undeliveredError{err: err}
+	}
+	return err
+}
+
+// NotDelivered reports whether err means the request never reached the
+// engine (no connection could be used), so the order is not on the book
+func NotDelivered(err error) bool {
+	var undelivered *undeliveredError
+	return errors.As(err, &undelivered)
+}
@@ -0,0 +1,212 @@
+package matching
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/order-gateway/internal/matching/matchingpb"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeEngine fails each call with the next of errs, then succeeds
+type fakeEngine struct {
+	matchingpb.UnimplementedMatchingEngineServer
+
+	mu    sync.Mutex
+	errs  []error
+	calls int
+	times []time.Time
+}
+
+func (e *fakeEngine) next() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls++
+	e.times = append(e.times, time.Now())
+	if len(e.errs) == 0 {
+		return nil
+	}
+	err := e.errs[0]
+	if len(e.errs) > 1 {
+		e.errs = e.errs[1:]
+	}
+	return err
+}
+
+func (e *fakeEngine) SubmitOrder(context.Context, *matchingpb.OrderRequest) (*matchingpb.OrderResponse, error) {
+	if err := e.next(); err != nil {
+		return nil, err
+	}
+	return &matchingpb.OrderResponse{Success: true, Status: "new"}, nil
+}
+
+func (e *fakeEngine) CancelOrder(context.Context, *matchingpb.CancelOrderRequest) (*matchingpb.CancelOrderResponse, error) {
+	if err := e.next(); err != nil {
+		return nil, err
+	}
+	return &matchingpb.CancelOrderResponse{Success: true}, nil
+}
+
+func (e *fakeEngine) callCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls
+}
+
+// newTestClient serves engine over an in-process listener. The listener is
+// returned so tests can take the engine down.
+func newTestClient(t *testing.T, engine *fakeEngine, cfg Config) (*Client, *bufconn.Listener) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	matchingpb.RegisterMatchingEngineServer(server, engine)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	cfg.Addr = "passthrough:///bufnet"
+	client, err := newClient(cfg, zap.NewNop(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, lis
+}
+
+func testConfig() Config {
+	return Config{
+		PoolSize:     1,
+		Timeout:      time.Second,
+		MaxRetries:   3,
+		RetryBackoff: 10 * time.Millisecond,
+	}
+}
+
+func TestCancelOrderRetriesUnavailable(t *testing.T) {
+	engine := &fakeEngine{errs: []error{
+		status.Error(codes.Unavailable, "restarting"),
+		status.Error(codes.Unavailable, "restarting"),
+		nil,
+	}}
+	client, _ := newTestClient(t, engine, testConfig())
+
+	resp, err := client.CancelOrder(context.Background(), &matchingpb.CancelOrderRequest{Symbol: "BTC-GBP", OrderId: "1"})
+	if err != nil {
+		t.Fatalf("CancelOrder() error = %v", err)
+	}
+	if !resp.Success || engine.callCount() != 3 {
+		t.Errorf("success = %v after %d calls, want true after 3", resp.Success, engine.callCount())
+	}
+}
+
+func TestCancelOrderDoesNotRetryInvalidArgument(t *testing.T) {
+	engine := &fakeEngine{errs: []error{status.Error(codes.InvalidArgument, "bad order id")}}
+	client, _ := newTestClient(t, engine, testConfig())
+
+	_, err := client.CancelOrder(context.Background(), &matchingpb.CancelOrderRequest{Symbol: "BTC-GBP", OrderId: "x"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CancelOrder() error = %v, want InvalidArgument", err)
+	}
+	if engine.callCount() != 1 {
+		t.Errorf("calls = %d, want 1", engine.callCount())
+	}
+}
+
+// Retries stop at MaxRetries, each waiting twice as long as the last
+func TestRetryLimitAndBackoff(t *testing.T) {
+	engine := &fakeEngine{errs: []error{status.Error(codes.Unavailable, "overloaded")}}
+	cfg := testConfig()
+	cfg.MaxRetries = 2
+	cfg.RetryBackoff = 20 * time.Millisecond
+	client, _ := newTestClient(t, engine, cfg)
+
+	_, err := client.CancelOrder(context.Background(), &matchingpb.CancelOrderRequest{Symbol: "BTC-GBP", OrderId: "1"})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("CancelOrder() error = %v, want Unavailable", err)
+	}
+	if engine.callCount() != 3 {
+		t.Fatalf("calls = %d, want 3", engine.callCount())
+	}
+	if gap := engine.times[1].Sub(engine.times[0]); gap < 20*time.Millisecond {
+		t.Errorf("first backoff = %s, want at least 20ms", gap)
+	}
+	if gap := engine.times[2].Sub(engine.times[1]); gap < 40*time.Millisecond {
+		t.Errorf("second backoff = %s, want at least 40ms", gap)
+	}
+}
+
+// A caller giving up during backoff stops the retries
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	engine := &fakeEngine{errs: []error{status.Error(codes.Unavailable, "overloaded")}}
+	cfg := testConfig()
+	cfg.MaxRetries = 10
+	cfg.RetryBackoff = time.Second
+	client, _ := newTestClient(t, engine, cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.CancelOrder(ctx, &matchingpb.CancelOrderRequest{Symbol: "BTC-GBP", OrderId: "1"})
+	if err != context.DeadlineExceeded {
+		t.Errorf("CancelOrder() error = %v, want context.DeadlineExceeded", err)
+	}
+	if engine.callCount() != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("%d calls over %s, want 1 call ending at the deadline", engine.callCount(), time.Since(start))
+	}
+}
+
+func TestSubmitOrderIsNotRetried(t *testing.T) {
+	engine := &fakeEngine{errs: []error{status.Error(codes.Unavailable, "shutting down"), nil}}
+	client, _ := newTestClient(t, engine, testConfig())
+
+	_, err := client.SubmitOrder(context.Background(), &matchingpb.OrderRequest{Symbol: "BTC-GBP"})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("SubmitOrder() error = %v, want Unavailable", err)
+	}
+	if engine.callCount() != 1 {
+		t.Errorf("calls = %d, want 1", engine.callCount())
+	}
+}
+
+func TestNotDelivered(t *testing.T) {
+	// The engine answering Unavailable has seen the order
+	engine := &fakeEngine{errs: []error{status.Error(codes.Unavailable, "shutting down")}}
+	client, _ := newTestClient(t, engine, testConfig())
+	_, err := client.SubmitOrder(context.Background(), &matchingpb.OrderRequest{Symbol: "BTC-GBP"})
+	if err == nil || NotDelivered(err) {
+		t.Errorf("engine Unavailable: NotDelivered(%v) = true, want false", err)
+	}
+
+	// So has one rejecting it
+	engine = &fakeEngine{errs: []error{status.Error(codes.InvalidArgument, "bad side")}}
+	client, _ = newTestClient(t, engine, testConfig())
+	_, err = client.SubmitOrder(context.Background(), &matchingpb.OrderRequest{Symbol: "BTC-GBP"})
+	if err == nil || NotDelivered(err) {
+		t.Errorf("InvalidArgument: NotDelivered(%v) = true, want false", err)
+	}
+
+	// An engine that cannot be reached has not
+	engine = &fakeEngine{}
+	client, lis := newTestClient(t, engine, testConfig())
+	lis.Close()
+	_, err = client.SubmitOrder(context.Background(), &matchingpb.OrderRequest{Symbol: "BTC-GBP"})
+	if status.Code(err) != codes.Unavailable || !NotDelivered(err) {
+		t.Errorf("engine down: error = %v, NotDelivered = %v, want Unavailable and true", err, NotDelivered(err))
+	}
+	if engine.callCount() != 0 {
+		t.Errorf("engine down: calls = %d, want 0", engine.callCount())
+	}
+
+	if NotDelivered(nil) {
+		t.Error("NotDelivered(nil) = true")
+	}
+}
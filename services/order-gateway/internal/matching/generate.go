@@ -0,0 +1,4 @@
+// BitCurrent Exchange - Matching Engine Client Code Generation
+package matching
+
+//go:generate protoc -I ../../../../matching-engine/proto --go_out=matchingpb --go_opt=paths=source_relative --go-grpc_out=matchingpb --go-grpc_opt=paths=source_relative matching.proto
@@ -0,0 +1,87 @@
+// BitCurrent Exchange - Risk Engine Configuration
+package risk
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/config"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+)
+
+// Config holds the tunable risk limits
+type Config struct {
+	// MaxPriceDeviation is the fat-finger band around the mid price as a
+	// fraction (0.10 = limit orders may be at most 10% away from mid)
+	MaxPriceDeviation decimal.Decimal
+
+	// DailyVolumeLimits maps KYC level to the maximum notional an account
+	// may trade per day, in VolumeLimitCurrency
+	DailyVolumeLimits   map[int]decimal.Decimal
+	VolumeLimitCurrency string
+
+	// PositionLimits caps the base-currency holding (balance plus open buy
+	// orders) per currency. Currencies without an entry are not limited.
+	PositionLimits map[string]decimal.Decimal
+}
+
+// DefaultConfig returns the limits documented in the service README
+func DefaultConfig() Config {
+	return Config{
+		MaxPriceDeviation: decimal.RequireFromString("0.10"),
+		DailyVolumeLimits: map[int]decimal.Decimal{
+			0: decimal.RequireFromString("1000"),
+			1: decimal.RequireFromString("5000"),
+			2: decimal.RequireFromString("50000"),
+			3: decimal.RequireFromString("500000"),
+		},
+		VolumeLimitCurrency: "GBP",
+		PositionLimits: map[string]decimal.Decimal{
+			"BTC":   decimal.RequireFromString("25"),
+			"ETH":   decimal.RequireFromString("250"),
+			"SOL":   decimal.RequireFromString("25000"),
+			"MATIC": decimal.RequireFromString("2500000"),
+			"ADA":   decimal.RequireFromString("2500000"),
+		},
+	}
+}
+
+// LoadConfig builds the risk config from the service configuration,
+// falling back to DefaultConfig for anything not set:
+//
+//	risk:
+//	  max_price_deviation: "0.10"
+//	  volume_limit_currency: "GBP"
+//	  daily_volume_limits: {"0": "1000", "1": "5000"}
+//	  position_limits: {"BTC": "25"}
+func LoadConfig() Config {
+	cfg := DefaultConfig()
+
+	if s := config.GetString("risk.max_price_deviation"); s != "" {
+		if d, err := decimal.NewFromString(s); err == nil && d.IsPositive() {
+			cfg.MaxPriceDeviation = d
+		}
+	}
+
+	if s := config.GetString("risk.volume_limit_currency"); s != "" {
+		cfg.VolumeLimitCurrency = strings.ToUpper(s)
+	}
+
+	for level, s := range config.GetStringMapString("risk.daily_volume_limits") {
+		l, err := strconv.Atoi(level)
+		if err != nil {
+			continue
+		}
+		if d, err := decimal.NewFromString(s); err == nil && !d.IsNegative() {
+			cfg.DailyVolumeLimits[l] = d
+		}
+	}
+
+	for currency, s := range config.GetStringMapString("risk.position_limits") {
+		if d, err := decimal.NewFromString(s); err == nil && d.IsPositive() {
+			cfg.PositionLimits[strings.ToUpper(currency)] = d
+		}
+	}
+
+	return cfg
+}
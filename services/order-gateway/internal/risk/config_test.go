@@ -0,0 +1,86 @@
+package risk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/config"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+)
+
+func loadTestConfig(t *testing.T, yaml string) Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(config.EnvConfigFile, path)
+	if err := config.Load("order-gateway"); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return LoadConfig()
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg := loadTestConfig(t, "server:\n  port: 8081\n")
+	want := DefaultConfig()
+
+	if !cfg.MaxPriceDeviation.Equal(want.MaxPriceDeviation) {
+		t.Errorf("MaxPriceDeviation = %s, want %s", cfg.MaxPriceDeviation, want.MaxPriceDeviation)
+	}
+	if cfg.VolumeLimitCurrency != "GBP" {
+		t.Errorf("VolumeLimitCurrency = %s, want GBP", cfg.VolumeLimitCurrency)
+	}
+	if len(cfg.DailyVolumeLimits) != len(want.DailyVolumeLimits) || len(cfg.PositionLimits) != len(want.PositionLimits) {
+		t.Errorf("limits = %v / %v, want defaults", cfg.DailyVolumeLimits, cfg.PositionLimits)
+	}
+}
+
+// Valid overrides replace or add to the defaults; invalid ones are ignored
+func TestLoadConfigOverrides(t *testing.T) {
+	cfg := loadTestConfig(t, `
+risk:
+  max_price_deviation: "0.05"
+  volume_limit_currency: "eur"
+  daily_volume_limits:
+    "1": "7500"
+    "4": "1000000"
+    "gold": "1"
+    "2": "-5"
+  position_limits:
+    btc: "10"
+    doge: "1000"
+    eth: "0"
+`)
+
+	if !cfg.MaxPriceDeviation.Equal(decimal.RequireFromString("0.05")) {
+		t.Errorf("MaxPriceDeviation = %s, want 0.05", cfg.MaxPriceDeviation)
+	}
+	if cfg.VolumeLimitCurrency != "EUR" {
+		t.Errorf("VolumeLimitCurrency = %s, want EUR", cfg.VolumeLimitCurrency)
+	}
+
+	volume := map[int]string{0: "1000", 1: "7500", 2: "50000", 4: "1000000"}
+	for level, want := range volume {
+		if got := cfg.DailyVolumeLimits[level]; !got.Equal(decimal.RequireFromString(want)) {
+			t.Errorf("DailyVolumeLimits[%d] = %s, want %s", level, got, want)
+		}
+	}
+
+	position := map[string]string{"BTC": "10", "DOGE": "1000", "ETH": "250"}
+	for currency, want := range position {
+		if got := cfg.PositionLimits[currency]; !got.Equal(decimal.RequireFromString(want)) {
+			t.Errorf("PositionLimits[%s] = %s, want %s", currency, got, want)
+		}
+	}
+}
+
+func TestLoadConfigIgnoresInvalidDeviation(t *testing.T) {
+	for _, value := range []string{"abc", "-0.1", "0"} {
+		cfg := loadTestConfig(t, "risk:\n  max_price_deviation: \""+value+"\"\n")
+		if !cfg.MaxPriceDeviation.Equal(DefaultConfig().MaxPriceDeviation) {
+			t.Errorf("max_price_deviation %q: got %s, want default", value, cfg.MaxPriceDeviation)
+		}
+	}
+}
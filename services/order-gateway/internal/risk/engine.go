@@ -3,10 +3,13 @@ package risk
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 )
 
@@ -21,8 +24,35 @@ const (
 	ViolationAccountRestricted        RiskViolation = "account_restricted"
 	ViolationOrderSizeTooSmall        RiskViolation = "order_size_too_small"
 	ViolationOrderSizeTooLarge        RiskViolation = "order_size_too_large"
+	ViolationInvalidOrder             RiskViolation = "invalid_order"
+	ViolationTradingPairUnavailable   RiskViolation = "trading_pair_unavailable"
+	ViolationMarketPriceUnavailable   RiskViolation = "market_price_unavailable"
 )
 
+// RiskError is returned when an order is rejected by a risk check.
+// Any other error from CheckOrder means the checks could not be run.
+type RiskError struct {
+	Violation RiskViolation
+	Reason    string
+}
+
+func (e *RiskError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Violation, e.Reason)
+}
+
+func reject(v RiskViolation, format string, args ...interface{}) error {
+	return &RiskError{Violation: v, Reason: fmt.Sprintf(format, args...)}
+}
+
+// ViolationOf returns the violation carried by err, if any
+func ViolationOf(err error) (RiskViolation, bool) {
+	var riskErr *RiskError
+	if errors.As(err, &riskErr) {
+		return riskErr.Violation, true
+	}
+	return "", false
+}
+
 type Order struct {
 	AccountID uuid.UUID
 	Symbol    string
@@ -30,164 +60,489 @@ type Order struct {
 	OrderType string
 	Price     *string
 	Quantity  string
+	PostOnly  bool
+}
+
+// tradingPair is the subset of trading_pairs used by the checks
+type tradingPair struct {
+	Symbol            string
+	BaseCurrency      string
+	QuoteCurrency     string
+	MinOrderSize      decimal.Decimal
+	MaxOrderSize      decimal.NullDecimal
+	MinPrice          decimal.NullDecimal
+	MaxPrice          decimal.NullDecimal
+	PricePrecision    int32
+	QuantityPrecision int32
+	MakerFeeBps       int64
+	TakerFeeBps       int64
+	Status            string
+}
+
+// marketPrices is a snapshot of the book used for pricing checks
+type marketPrices struct {
+	BestBid   decimal.NullDecimal
+	BestAsk   decimal.NullDecimal
+	LastPrice decimal.NullDecimal
+}
+
+// Mid returns the mid price, falling back to whichever side of the book
+// exists and then to the last trade
+func (m marketPrices) Mid() (decimal.Decimal, bool) {
+	switch {
+	case m.BestBid.Valid && m.BestAsk.Valid:
+		mid, err := m.BestBid.Decimal.Add(m.BestAsk.Decimal).Div(decimal.NewFromInt(2), 18, decimal.RoundHalfEven)
+		return mid, err == nil
+	case m.BestBid.Valid:
+		return m.BestBid.Decimal, true
+	case m.BestAsk.Valid:
+		return m.BestAsk.Decimal, true
+	case m.LastPrice.Valid:
+		return m.LastPrice.Decimal, true
+	}
+	return decimal.Zero, false
+}
+
+// checkedOrder carries the parsed order and market data between checks
+type checkedOrder struct {
+	*Order
+	pair     *tradingPair
+	quantity decimal.Decimal
+	price    decimal.Decimal // limit price, or worst-case fill price for market orders
+	touch    decimal.Decimal // best opposite price a market order is expected to fill at
+	market   marketPrices
+	kycLevel int
+}
+
+// notional returns quantity * price in the quote currency
+func (o *checkedOrder) notional() decimal.Decimal {
+	return o.quantity.Mul(o.price)
+}
+
+// tradedNotional returns the notional the order is expected to trade:
+// limit orders at their price, market orders at the touch without the
+// slippage allowance reserved for them
+func (o *checkedOrder) tradedNotional() decimal.Decimal {
+	if o.Price == nil {
+		return o.quantity.Mul(o.touch)
+	}
+	return o.notional()
+}
+
+// feeBps returns the worst-case fee rate for the order
+func (o *checkedOrder) feeBps() int64 {
+	if o.PostOnly {
+		return o.pair.MakerFeeBps
+	}
+	return o.pair.TakerFeeBps
 }
 
 type RiskEngine struct {
 	db     *database.PostgresDB
+	config Config
 	logger *zap.Logger
 }
 
-func NewRiskEngine(db *database.PostgresDB, logger *zap.Logger) *RiskEngine {
+func NewRiskEngine(db *database.PostgresDB, cfg Config, logger *zap.Logger) *RiskEngine {
 	return &RiskEngine{
 		db:     db,
+		config: cfg,
 		logger: logger,
 	}
 }
 
-// CheckOrder performs all pre-trade risk checks
-func (e *RiskEngine) CheckOrder(ctx context.Context, order *Order) error {
+// Reservation is the balance an accepted order must hold until it settles:
+// the base quantity for sells, worst-case notional plus fees for buys
+type Reservation struct {
+	Currency string
+	Amount   decimal.Decimal
+}
+
+// CheckOrder performs all pre-trade risk checks and returns the balance the
+// order must reserve. Rejections are returned as *RiskError; any other error
+// means the checks could not be completed.
+func (e *RiskEngine) CheckOrder(ctx context.Context, order *Order) (*Reservation, error) {
+	if order.Side != "buy" && order.Side != "sell" {
+		return nil, reject(ViolationInvalidOrder, "invalid side %q", order.Side)
+	}
+
+	quantity, err := decimal.NewFromString(order.Quantity)
+	if err != nil || !quantity.IsPositive() {
+		return nil, reject(ViolationInvalidOrder, "invalid quantity %q", order.Quantity)
+	}
+
+	co := &checkedOrder{Order: order, quantity: quantity}
+
+	if order.Price != nil {
+		price, err := decimal.NewFromString(*order.Price)
+		if err != nil || !price.IsPositive() {
+			return nil, reject(ViolationInvalidOrder, "invalid price %q", *order.Price)
+		}
+		co.price = price
+	} else if order.OrderType == "limit" {
+		return nil, reject(ViolationInvalidOrder, "price required for limit orders")
+	}
+
 	// 1. Check account status
-	if err := e.checkAccountStatus(ctx, order.AccountID); err != nil {
-		return err
+	if co.kycLevel, err = e.checkAccountStatus(ctx, order.AccountID); err != nil {
+		return nil, err
 	}
 
-	// 2. Check order size limits
-	if err := e.checkOrderSize(ctx, order); err != nil {
-		return err
+	if co.pair, err = e.loadTradingPair(ctx, order.Symbol); err != nil {
+		return nil, err
+	}
+
+	if co.market, err = e.loadMarketPrices(ctx, order.Symbol); err != nil {
+		return nil, err
 	}
 
-	// 3. Check balance for buy orders
-	if order.Side == "buy" {
-		if err := e.checkBalance(ctx, order); err != nil {
-			return err
+	// Market orders are priced at the touch on the opposite side of the book
+	if order.Price == nil {
+		if err := e.estimateMarketPrice(co); err != nil {
+			return nil, err
 		}
 	}
 
+	// 2. Check order size limits
+	if err := e.checkOrderSize(ctx, co); err != nil {
+		return nil, err
+	}
+
+	// 3. Check balance
+	if err := e.checkBalance(ctx, co); err != nil {
+		return nil, err
+	}
+
 	// 4. Check position limits
-	if err := e.checkPositionLimits(ctx, order); err != nil {
-		return err
+	if err := e.checkPositionLimits(ctx, co); err != nil {
+		return nil, err
 	}
 
 	// 5. Check daily volume limits
-	if err := e.checkDailyVolume(ctx, order); err != nil {
-		return err
+	if err := e.checkDailyVolume(ctx, co); err != nil {
+		return nil, err
 	}
 
 	// 6. Fat finger protection (price deviation check)
 	if order.Price != nil {
-		if err := e.checkPriceDeviation(ctx, order); err != nil {
-			return err
+		if err := e.checkPriceDeviation(ctx, co); err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	currency, amount := requiredBalance(co)
+	return &Reservation{Currency: currency, Amount: amount}, nil
 }
 
-func (e *RiskEngine) checkAccountStatus(ctx context.Context, accountID uuid.UUID) error {
-	var status string
-	query := `SELECT status FROM accounts WHERE id = $1`
+func (e *RiskEngine) checkAccountStatus(ctx context.Context, accountID uuid.UUID) (int, error) {
+	var status, userStatus string
+	var kycLevel int
+	query := `
+		SELECT a.status, u.status, COALESCE(u.kyc_level, 0)
+		FROM accounts a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.id = $1
+	`
 
-	err := e.db.Pool.QueryRow(ctx, query, accountID).Scan(&status)
+	err := e.db.Pool.QueryRow(ctx, query, accountID).Scan(&status, &userStatus, &kycLevel)
 	if err != nil {
-		return fmt.Errorf("%v: account not found", ViolationAccountRestricted)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, reject(ViolationAccountRestricted, "account not found")
+		}
+		return 0, fmt.Errorf("failed to load account: %w", err)
 	}
 
 	if status != "active" {
-		return fmt.Errorf("%v: account status is %s", ViolationAccountRestricted, status)
+		return 0, reject(ViolationAccountRestricted, "account status is %s", status)
+	}
+	if userStatus != "active" {
+		return 0, reject(ViolationAccountRestricted, "user status is %s", userStatus)
 	}
 
-	return nil
+	return kycLevel, nil
+}
+
+func (e *RiskEngine) loadTradingPair(ctx context.Context, symbol string) (*tradingPair, error) {
+	var p tradingPair
+	query := `
+		SELECT symbol, base_currency, quote_currency, min_order_size, max_order_size,
+		       min_price, max_price, COALESCE(price_precision, 8), COALESCE(quantity_precision, 8),
+		       COALESCE(maker_fee_bps, 0), COALESCE(taker_fee_bps, 0), status
+		FROM trading_pairs
+		WHERE symbol = $1
+	`
+
+	err := e.db.Pool.QueryRow(ctx, query, symbol).Scan(
+		&p.Symbol, &p.BaseCurrency, &p.QuoteCurrency, &p.MinOrderSize, &p.MaxOrderSize,
+		&p.MinPrice, &p.MaxPrice, &p.PricePrecision, &p.QuantityPrecision,
+		&p.MakerFeeBps, &p.TakerFeeBps, &p.Status,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, reject(ViolationTradingPairUnavailable, "unknown trading pair %s", symbol)
+		}
+		return nil, fmt.Errorf("failed to load trading pair: %w", err)
+	}
+
+	if p.Status != "active" {
+		return nil, reject(ViolationTradingPairUnavailable, "%s is %s", symbol, p.Status)
+	}
+
+	return &p, nil
 }
 
-func (e *RiskEngine) checkOrderSize(ctx context.Context, order *Order) error {
-	var minSize, maxSize *string
-	query := `SELECT min_order_size, max_order_size FROM trading_pairs WHERE symbol = $1`
+func (e *RiskEngine) loadMarketPrices(ctx context.Context, symbol string) (marketPrices, error) {
+	var m marketPrices
+	query := `
+		SELECT
+			(SELECT MAX(price) FROM orders
+			 WHERE symbol = $1 AND side = 'buy' AND status IN ('new', 'partial') AND price IS NOT NULL) AS best_bid,
+			(SELECT MIN(price) FROM orders
+			 WHERE symbol = $1 AND side = 'sell' AND status IN ('new', 'partial') AND price IS NOT NULL) AS best_ask,
+			(SELECT price FROM trades
+			 WHERE symbol = $1 ORDER BY executed_at DESC LIMIT 1) AS last_price
+	`
 
-	err := e.db.Pool.QueryRow(ctx, query, order.Symbol).Scan(&minSize, &maxSize)
+	err := e.db.Pool.QueryRow(ctx, query, symbol).Scan(&m.BestBid, &m.BestAsk, &m.LastPrice)
 	if err != nil {
-		return fmt.Errorf("invalid trading pair: %s", order.Symbol)
+		return m, fmt.Errorf("failed to load market prices: %w", err)
+	}
+
+	return m, nil
+}
+
+// estimateMarketPrice sets the price a market order is expected to fill at.
+// Buys are priced at the top of the fat-finger band above the best ask so the
+// balance check covers slippage through the book; the unpadded touch is kept
+// for the volume check.
+func (e *RiskEngine) estimateMarketPrice(o *checkedOrder) error {
+	var ref decimal.NullDecimal
+	if o.Side == "buy" {
+		ref = o.market.BestAsk
+	} else {
+		ref = o.market.BestBid
+	}
+
+	if !ref.Valid {
+		return reject(ViolationMarketPriceUnavailable, "no resting liquidity for %s market %s", o.Symbol, o.Side)
+	}
+
+	o.touch = ref.Decimal
+	o.price = ref.Decimal
+	if o.Side == "buy" {
+		o.price = ref.Decimal.Mul(decimal.NewFromInt(1).Add(e.config.MaxPriceDeviation))
+	}
+
+	return nil
+}
+
+func (e *RiskEngine) checkOrderSize(ctx context.Context, o *checkedOrder) error {
+	p := o.pair
+
+	if o.quantity.LessThan(p.MinOrderSize) {
+		return reject(ViolationOrderSizeTooSmall, "quantity %s below minimum %s", o.quantity, p.MinOrderSize)
+	}
+	if p.MaxOrderSize.Valid && o.quantity.GreaterThan(p.MaxOrderSize.Decimal) {
+		return reject(ViolationOrderSizeTooLarge, "quantity %s above maximum %s", o.quantity, p.MaxOrderSize.Decimal)
+	}
+	if !o.quantity.Truncate(p.QuantityPrecision).Equal(o.quantity) {
+		return reject(ViolationInvalidOrder, "quantity %s exceeds %d decimal places", o.quantity, p.QuantityPrecision)
+	}
+
+	if o.Price == nil {
+		return nil
 	}
 
-	// TODO: Implement proper decimal comparison
-	// For now, basic string checks
+	if !o.price.Truncate(p.PricePrecision).Equal(o.price) {
+		return reject(ViolationInvalidOrder, "price %s exceeds %d decimal places", o.price, p.PricePrecision)
+	}
+	if p.MinPrice.Valid && o.price.LessThan(p.MinPrice.Decimal) {
+		return reject(ViolationInvalidOrder, "price %s below minimum %s", o.price, p.MinPrice.Decimal)
+	}
+	if p.MaxPrice.Valid && o.price.GreaterThan(p.MaxPrice.Decimal) {
+		return reject(ViolationInvalidOrder, "price %s above maximum %s", o.price, p.MaxPrice.Decimal)
+	}
 
 	return nil
 }
 
-func (e *RiskEngine) checkBalance(ctx context.Context, order *Order) error {
-	// For buy orders, need to have enough quote currency
-	// Extract quote currency from symbol (e.g., BTC-GBP -> GBP)
-	quoteCurrency := "GBP" // Simplified - should parse from symbol
+// requiredBalance returns the currency and amount the order needs available:
+// notional plus fees in the quote currency for buys, quantity in the base
+// currency for sells (sell fees are taken from the proceeds)
+func requiredBalance(o *checkedOrder) (string, decimal.Decimal) {
+	if o.Side == "sell" {
+		return o.pair.BaseCurrency, o.quantity
+	}
+
+	notional := o.notional()
+	fee := notional.Mul(decimal.New(o.feeBps(), 4))
+	required := notional.Add(fee).RoundCurrency(o.pair.QuoteCurrency, decimal.RoundUp)
+
+	return o.pair.QuoteCurrency, required
+}
 
-	var availableBalance string
+func (e *RiskEngine) checkBalance(ctx context.Context, o *checkedOrder) error {
+	currency, required := requiredBalance(o)
+
+	var availableBalance decimal.Decimal
 	query := `SELECT available_balance FROM wallets WHERE account_id = $1 AND currency = $2`
 
-	err := e.db.Pool.QueryRow(ctx, query, order.AccountID, quoteCurrency).Scan(&availableBalance)
+	err := e.db.Pool.QueryRow(ctx, query, o.AccountID, currency).Scan(&availableBalance)
 	if err != nil {
-		return fmt.Errorf("%v: wallet not found", ViolationInsufficientBalance)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return reject(ViolationInsufficientBalance, "no %s wallet", currency)
+		}
+		return fmt.Errorf("failed to load balance: %w", err)
 	}
 
-	// TODO: Calculate required balance (price * quantity + fees)
-	// TODO: Compare with available balance using decimal arithmetic
+	if availableBalance.LessThan(required) {
+		return reject(ViolationInsufficientBalance, "requires %s %s, available %s", required, currency, availableBalance)
+	}
 
 	e.logger.Debug("Balance check passed",
-		zap.String("account_id", order.AccountID.String()),
-		zap.String("available", availableBalance),
+		zap.String("account_id", o.AccountID.String()),
+		zap.String("currency", currency),
+		zap.String("required", required.String()),
+		zap.String("available", availableBalance.String()),
 	)
 
 	return nil
 }
 
-func (e *RiskEngine) checkPositionLimits(ctx context.Context, order *Order) error {
-	// TODO: Query current position for the symbol
-	// TODO: Calculate new position after order
-	// TODO: Check against position limits (from config or database)
+func (e *RiskEngine) checkPositionLimits(ctx context.Context, o *checkedOrder) error {
+	// Sells only reduce the position
+	if o.Side != "buy" {
+		return nil
+	}
+
+	limit, ok := e.config.PositionLimits[o.pair.BaseCurrency]
+	if !ok {
+		return nil
+	}
+
+	// Current position is the wallet balance plus everything still to fill
+	// on open buy orders for the same base currency
+	query := `
+		SELECT
+			COALESCE((SELECT balance FROM wallets WHERE account_id = $1 AND currency = $2), 0) +
+			COALESCE((
+				SELECT SUM(o.quantity - o.filled_quantity)
+				FROM orders o
+				JOIN trading_pairs p ON p.symbol = o.symbol
+				WHERE o.account_id = $1 AND p.base_currency = $2
+				  AND o.side = 'buy' AND o.status IN ('new', 'partial')
+			), 0)
+	`
+
+	var position decimal.Decimal
+	if err := e.db.Pool.QueryRow(ctx, query, o.AccountID, o.pair.BaseCurrency).Scan(&position); err != nil {
+		return fmt.Errorf("failed to load position: %w", err)
+	}
+
+	newPosition := position.Add(o.quantity)
+	if newPosition.GreaterThan(limit) {
+		return reject(ViolationPositionLimitExceeded, "position would be %s %s, limit %s",
+			newPosition, o.pair.BaseCurrency, limit)
+	}
+
 	return nil
 }
 
-func (e *RiskEngine) checkDailyVolume(ctx context.Context, order *Order) error {
-	// Query today's trading volume
+func (e *RiskEngine) checkDailyVolume(ctx context.Context, o *checkedOrder) error {
+	limit, ok := e.config.DailyVolumeLimits[o.kycLevel]
+	if !ok {
+		limit = e.config.DailyVolumeLimits[0]
+	}
+
+	// Query today's trading volume in each quote currency
 	query := `
-		SELECT COALESCE(SUM(quantity * price), 0) as volume
-		FROM trades
-		WHERE (buyer_account_id = $1 OR seller_account_id = $1)
-		  AND executed_at > CURRENT_DATE
+		SELECT p.quote_currency, COALESCE(SUM(t.quantity * t.price), 0) as volume
+		FROM trades t
+		JOIN trading_pairs p ON p.symbol = t.symbol
+		WHERE (t.buyer_account_id = $1 OR t.seller_account_id = $1)
+		  AND t.executed_at > CURRENT_DATE
+		GROUP BY p.quote_currency
 	`
 
-	var dailyVolume string
-	err := e.db.Pool.QueryRow(ctx, query, order.AccountID).Scan(&dailyVolume)
+	rows, err := e.db.Pool.Query(ctx, query, o.AccountID)
 	if err != nil {
-		e.logger.Error("Failed to query daily volume", zap.Error(err))
-		return nil // Fail open on error
+		return fmt.Errorf("failed to load daily volume: %w", err)
+	}
+	defer rows.Close()
+
+	volumes := map[string]decimal.Decimal{}
+	for rows.Next() {
+		var currency string
+		var volume decimal.Decimal
+		if err := rows.Scan(&currency, &volume); err != nil {
+			return fmt.Errorf("failed to scan daily volume: %w", err)
+		}
+		volumes[currency] = volume
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load daily volume: %w", err)
+	}
+	volumes[o.pair.QuoteCurrency] = volumes[o.pair.QuoteCurrency].Add(o.tradedNotional())
+
+	// Volume in other quote currencies counts at the current mid price of
+	// its pair against the limit currency; without one the order is refused
+	// rather than let through unchecked
+	limitCurrency := e.config.VolumeLimitCurrency
+	total := decimal.Zero
+	for currency, volume := range volumes {
+		if currency != limitCurrency && !volume.IsZero() {
+			rate, err := e.conversionRate(ctx, currency, limitCurrency)
+			if err != nil {
+				return err
+			}
+			volume = volume.Mul(rate)
+		}
+		total = total.Add(volume)
 	}
 
-	// TODO: Check against daily limit based on KYC tier
-	// TODO: Calculate order notional value
-	// TODO: Compare total volume
+	if total.GreaterThan(limit) {
+		return reject(ViolationDailyVolumeLimitExceeded, "daily volume would be %s %s, KYC level %d limit %s",
+			total.RoundCurrency(limitCurrency, decimal.RoundUp), limitCurrency, o.kycLevel, limit)
+	}
 
 	return nil
 }
 
-func (e *RiskEngine) checkPriceDeviation(ctx context.Context, order *Order) error {
-	// Get mid price from market
-	var midPrice *string
-	query := `
-		SELECT (
-			SELECT price FROM orders 
-			WHERE symbol = $1 AND side = 'sell' AND status IN ('new', 'partial')
-			ORDER BY price ASC LIMIT 1
-		) as best_ask
-	`
+// conversionRate prices one unit of currency in the target currency at the
+// mid of the currency-target pair
+func (e *RiskEngine) conversionRate(ctx context.Context, currency, target string) (decimal.Decimal, error) {
+	symbol := currency + "-" + target
+	market, err := e.loadMarketPrices(ctx, symbol)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	rate, ok := market.Mid()
+	if !ok {
+		return decimal.Zero, reject(ViolationMarketPriceUnavailable, "no %s price to value %s volume in %s", symbol, currency, target)
+	}
+	return rate, nil
+}
 
-	err := e.db.Pool.QueryRow(ctx, query, order.Symbol).Scan(&midPrice)
-	if err != nil || midPrice == nil {
+func (e *RiskEngine) checkPriceDeviation(ctx context.Context, o *checkedOrder) error {
+	mid, ok := o.market.Mid()
+	if !ok {
 		// No market price available, allow order
 		return nil
 	}
 
-	// TODO: Calculate deviation percentage
-	// TODO: Check if deviation > 10% threshold
-	// const maxDeviationPercent = 0.10
+	deviation, err := o.price.Sub(mid).Abs().Div(mid, 6, decimal.RoundHalfUp)
+	if err != nil {
+		return nil
+	}
+
+	if deviation.GreaterThan(e.config.MaxPriceDeviation) {
+		return reject(ViolationPriceDeviationExceeded, "price %s is %s%% from mid %s, limit %s%%",
+			o.price,
+			deviation.Mul(decimal.NewFromInt(100)).Round(2, decimal.RoundHalfUp),
+			mid.Round(o.pair.PricePrecision, decimal.RoundHalfUp),
+			e.config.MaxPriceDeviation.Mul(decimal.NewFromInt(100)).Round(2, decimal.RoundHalfUp),
+		)
+	}
 
 	return nil
 }
@@ -0,0 +1,360 @@
+package risk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+func nullDecimal(s string) decimal.NullDecimal {
+	return decimal.NullDecimal{Decimal: decimal.RequireFromString(s), Valid: true}
+}
+
+// btcGBP is the pair the tests trade: 20bps taker, 10bps maker
+func btcGBP() *tradingPair {
+	return &tradingPair{
+		Symbol:            "BTC-GBP",
+		BaseCurrency:      "BTC",
+		QuoteCurrency:     "GBP",
+		MinOrderSize:      decimal.RequireFromString("0.0001"),
+		MaxOrderSize:      nullDecimal("10"),
+		MinPrice:          nullDecimal("1"),
+		MaxPrice:          nullDecimal("1000000"),
+		PricePrecision:    2,
+		QuantityPrecision: 8,
+		MakerFeeBps:       10,
+		TakerFeeBps:       20,
+		Status:            "active",
+	}
+}
+
+func TestRequiredBalance(t *testing.T) {
+	tests := []struct {
+		name     string
+		side     string
+		postOnly bool
+		quantity string
+		price    string
+		currency string
+		want     string
+	}{
+		{"sell holds base quantity", "sell", false, "0.5", "50000", "BTC", "0.5"},
+		{"buy holds notional plus taker fee", "buy", false, "0.5", "50000", "GBP", "25050"},
+		{"post-only buy holds maker fee", "buy", true, "0.5", "50000", "GBP", "25025"},
+		{"buy rounds up to pence", "buy", false, "0.00012345", "50000.01", "GBP", "6.19"},
+	}
+
+	for _, tt := range tests {
+		o := &checkedOrder{
+			Order:    &Order{Side: tt.side, PostOnly: tt.postOnly},
+			pair:     btcGBP(),
+			quantity: decimal.RequireFromString(tt.quantity),
+			price:    decimal.RequireFromString(tt.price),
+		}
+		currency, amount := requiredBalance(o)
+		if currency != tt.currency || !amount.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("%s: requiredBalance() = %s %s, want %s %s", tt.name, amount, currency, tt.want, tt.currency)
+		}
+	}
+}
+
+func TestMarketPricesMid(t *testing.T) {
+	tests := []struct {
+		name   string
+		market marketPrices
+		want   string
+		ok     bool
+	}{
+		{"both sides", marketPrices{BestBid: nullDecimal("99"), BestAsk: nullDecimal("101"), LastPrice: nullDecimal("90")}, "100", true},
+		{"bid only", marketPrices{BestBid: nullDecimal("99"), LastPrice: nullDecimal("90")}, "99", true},
+		{"ask only", marketPrices{BestAsk: nullDecimal("101"), LastPrice: nullDecimal("90")}, "101", true},
+		{"last trade", marketPrices{LastPrice: nullDecimal("90")}, "90", true},
+		{"empty", marketPrices{}, "0", false},
+	}
+
+	for _, tt := range tests {
+		mid, ok := tt.market.Mid()
+		if ok != tt.ok || !mid.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("%s: Mid() = %s, %v, want %s, %v", tt.name, mid, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCheckOrderSize(t *testing.T) {
+	engine := NewRiskEngine(nil, DefaultConfig(), zap.NewNop())
+
+	tests := []struct {
+		name     string
+		quantity string
+		price    string // empty for market orders
+		want     RiskViolation
+	}{
+		{"within limits", "0.5", "50000", ""},
+		{"below minimum", "0.00001", "50000", ViolationOrderSizeTooSmall},
+		{"above maximum", "11", "50000", ViolationOrderSizeTooLarge},
+		{"quantity precision", "0.123456789", "50000", ViolationInvalidOrder},
+		{"price precision", "0.5", "50000.001", ViolationInvalidOrder},
+		{"below minimum price", "0.5", "0.5", ViolationInvalidOrder},
+		{"above maximum price", "0.5", "2000000", ViolationInvalidOrder},
+		{"market order skips price checks", "0.5", "", ""},
+	}
+
+	for _, tt := range tests {
+		o := &checkedOrder{
+			Order:    &Order{Side: "buy"},
+			pair:     btcGBP(),
+			quantity: decimal.RequireFromString(tt.quantity),
+		}
+		if tt.price != "" {
+			o.Price = &tt.price
+			o.price = decimal.RequireFromString(tt.price)
+		} else {
+			// Padded market price is never checked against the tick size
+			o.price = decimal.RequireFromString("55110.0001")
+		}
+
+		err := engine.checkOrderSize(context.Background(), o)
+		got, _ := ViolationOf(err)
+		if got != tt.want {
+			t.Errorf("%s: checkOrderSize() = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// riskFixture is the state the engine's queries return. Checks run in
+// order, so a rejected order stops at its stage and leaves the rest unread.
+type riskFixture struct {
+	accountStatus string
+	kycLevel      int
+	pairStatus    string
+	bestAsk       *string
+	available     string
+	position      string
+	volume        string
+}
+
+func defaultFixture() riskFixture {
+	ask := "50100"
+	return riskFixture{
+		accountStatus: "active",
+		kycLevel:      2,
+		pairStatus:    "active",
+		bestAsk:       &ask,
+		available:     "100000",
+		position:      "1",
+		volume:        "0",
+	}
+}
+
+const (
+	stageAccount = iota
+	stagePair
+	stageMarket
+	stageBalance
+	stagePosition
+	stageVolume
+)
+
+func (f riskFixture) expect(mock pgxmock.PgxPoolIface, accountID uuid.UUID, through int) {
+	mock.ExpectQuery("FROM accounts a").
+		WithArgs(accountID).
+		WillReturnRows(pgxmock.NewRows([]string{"status", "user_status", "kyc_level"}).
+			AddRow(f.accountStatus, "active", f.kycLevel))
+	if through == stageAccount {
+		return
+	}
+
+	p := btcGBP()
+	mock.ExpectQuery("FROM trading_pairs").
+		WithArgs("BTC-GBP").
+		WillReturnRows(pgxmock.NewRows([]string{
+			"symbol", "base_currency", "quote_currency", "min_order_size", "max_order_size",
+			"min_price", "max_price", "price_precision", "quantity_precision",
+			"maker_fee_bps", "taker_fee_bps", "status",
+		}).AddRow(p.Symbol, p.BaseCurrency, p.QuoteCurrency, "0.0001", "10", "1", "1000000",
+			p.PricePrecision, p.QuantityPrecision, p.MakerFeeBps, p.TakerFeeBps, f.pairStatus))
+	if through == stagePair {
+		return
+	}
+
+	var ask interface{}
+	if f.bestAsk != nil {
+		ask = *f.bestAsk
+	}
+	mock.ExpectQuery("AS best_bid").
+		WithArgs("BTC-GBP").
+		WillReturnRows(pgxmock.NewRows([]string{"best_bid", "best_ask", "last_price"}).
+			AddRow("49900", ask, "50000"))
+	if through == stageMarket {
+		return
+	}
+
+	mock.ExpectQuery("SELECT available_balance FROM wallets").
+		WithArgs(accountID, "GBP").
+		WillReturnRows(pgxmock.NewRows([]string{"available_balance"}).AddRow(f.available))
+	if through == stageBalance {
+		return
+	}
+
+	mock.ExpectQuery("o.quantity - o.filled_quantity").
+		WithArgs(accountID, "BTC").
+		WillReturnRows(pgxmock.NewRows([]string{"position"}).AddRow(f.position))
+	if through == stagePosition {
+		return
+	}
+
+	mock.ExpectQuery("t.quantity \\* t.price").
+		WithArgs(accountID).
+		WillReturnRows(pgxmock.NewRows([]string{"quote_currency", "volume"}).AddRow("GBP", f.volume))
+}
+
+func TestCheckOrderViolations(t *testing.T) {
+	price := func(s string) *string { return &s }
+
+	tests := []struct {
+		name    string
+		order   Order
+		fixture func(*riskFixture)
+		through int
+		want    RiskViolation
+	}{
+		{"invalid side", Order{Side: "short", Quantity: "1"}, nil, -1, ViolationInvalidOrder},
+		{"limit without price", Order{Side: "buy", OrderType: "limit", Quantity: "1"}, nil, -1, ViolationInvalidOrder},
+		{"account restricted", Order{Side: "buy", OrderType: "limit", Price: price("50000"), Quantity: "0.5"},
+			func(f *riskFixture) { f.accountStatus = "suspended" }, stageAccount, ViolationAccountRestricted},
+		{"pair halted", Order{Side: "buy", OrderType: "limit", Price: price("50000"), Quantity: "0.5"},
+			func(f *riskFixture) { f.pairStatus = "halted" }, stagePair, ViolationTradingPairUnavailable},
+		{"no liquidity for market buy", Order{Side: "buy", OrderType: "market", Quantity: "0.5"},
+			func(f *riskFixture) { f.bestAsk = nil }, stageMarket, ViolationMarketPriceUnavailable},
+		{"order too small", Order{Side: "buy", OrderType: "limit", Price: price("50000"), Quantity: "0.00001"},
+			nil, stageMarket, ViolationOrderSizeTooSmall},
+		{"order too large", Order{Side: "buy", OrderType: "limit", Price: price("50000"), Quantity: "12"},
+			nil, stageMarket, ViolationOrderSizeTooLarge},
+		{"insufficient balance", Order{Side: "buy", OrderType: "limit", Price: price("50000"), Quantity: "0.5"},
+			func(f *riskFixture) { f.available = "25049.99" }, stageBalance, ViolationInsufficientBalance},
+		{"position limit", Order{Side: "buy", OrderType: "limit", Price: price("50000"), Quantity: "0.5"},
+			func(f *riskFixture) { f.position = "24.8" }, stagePosition, ViolationPositionLimitExceeded},
+		{"daily volume", Order{Side: "buy", OrderType: "limit", Price: price("50000"), Quantity: "0.5"},
+			func(f *riskFixture) { f.volume = "30000" }, stageVolume, ViolationDailyVolumeLimitExceeded},
+		{"price deviation", Order{Side: "buy", OrderType: "limit", Price: price("60000"), Quantity: "0.1"},
+			nil, stageVolume, ViolationPriceDeviationExceeded},
+	}
+
+	for _, tt := range tests {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine := NewRiskEngine(database.New(mock, zap.NewNop()), DefaultConfig(), zap.NewNop())
+
+		order := tt.order
+		order.AccountID = uuid.New()
+		order.Symbol = "BTC-GBP"
+		fixture := defaultFixture()
+		if tt.fixture != nil {
+			tt.fixture(&fixture)
+		}
+		if tt.through >= 0 {
+			fixture.expect(mock, order.AccountID, tt.through)
+		}
+
+		_, err = engine.CheckOrder(context.Background(), &order)
+		if got, _ := ViolationOf(err); got != tt.want {
+			t.Errorf("%s: CheckOrder() error = %v, want %s", tt.name, err, tt.want)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		mock.Close()
+	}
+}
+
+// A market buy reserves at the top of the deviation band but counts towards
+// daily volume at the best ask
+func TestMarketBuyVolumeUsesBestAsk(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	engine := NewRiskEngine(database.New(mock, zap.NewNop()), DefaultConfig(), zap.NewNop())
+
+	// 0.9 BTC at the 50100 ask is 45090; padded by 10% it would be 49599,
+	// which with 4000 already traded would pass the 50000 limit
+	order := Order{AccountID: uuid.New(), Symbol: "BTC-GBP", Side: "buy", OrderType: "market", Quantity: "0.9"}
+	fixture := defaultFixture()
+	fixture.volume = "4000"
+	fixture.expect(mock, order.AccountID, stageVolume)
+
+	reservation, err := engine.CheckOrder(context.Background(), &order)
+	if err != nil {
+		t.Fatalf("CheckOrder() error = %v", err)
+	}
+	// 49599 notional plus the 20bps taker fee
+	if reservation.Currency != "GBP" || !reservation.Amount.Equal(decimal.RequireFromString("49698.2")) {
+		t.Errorf("reservation = %s %s, want 49698.20 GBP", reservation.Amount, reservation.Currency)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Volume on pairs quoted in other currencies counts towards the GBP limit at
+// the mid of its GBP pair, and is refused when there is no such price
+func TestDailyVolumeConvertsQuoteCurrency(t *testing.T) {
+	price := "0.05"
+	ethBTC := &tradingPair{Symbol: "ETH-BTC", BaseCurrency: "ETH", QuoteCurrency: "BTC"}
+
+	tests := []struct {
+		name     string
+		quantity string
+		btcGBP   interface{} // best bid on BTC-GBP, nil for an empty book
+		want     RiskViolation
+	}{
+		// 10000 GBP + (0.3 + 8 * 0.05) BTC at 50000 = 45000 GBP
+		{"within limit", "8", "50000", ""},
+		// 10000 GBP + (0.3 + 10.0002 * 0.05) BTC at 50000 = 50000.50 GBP
+		{"over limit", "10.0002", "50000", ViolationDailyVolumeLimitExceeded},
+		{"no conversion price", "8", nil, ViolationMarketPriceUnavailable},
+	}
+
+	for _, tt := range tests {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine := NewRiskEngine(database.New(mock, zap.NewNop()), DefaultConfig(), zap.NewNop())
+
+		o := &checkedOrder{
+			Order:    &Order{AccountID: uuid.New(), Symbol: "ETH-BTC", Side: "buy", Price: &price},
+			pair:     ethBTC,
+			quantity: decimal.RequireFromString(tt.quantity),
+			price:    decimal.RequireFromString(price),
+			kycLevel: 2,
+		}
+
+		mock.ExpectQuery("t.quantity \\* t.price").
+			WithArgs(o.AccountID).
+			WillReturnRows(pgxmock.NewRows([]string{"quote_currency", "volume"}).
+				AddRow("GBP", "10000").
+				AddRow("BTC", "0.3"))
+		mock.ExpectQuery("AS best_bid").
+			WithArgs("BTC-GBP").
+			WillReturnRows(pgxmock.NewRows([]string{"best_bid", "best_ask", "last_price"}).
+				AddRow(tt.btcGBP, nil, nil))
+
+		err = engine.checkDailyVolume(context.Background(), o)
+		if got, _ := ViolationOf(err); got != tt.want {
+			t.Errorf("%s: checkDailyVolume() error = %v, want %q", tt.name, err, tt.want)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		mock.Close()
+	}
+}
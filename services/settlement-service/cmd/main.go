@@ -10,9 +10,15 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/banking"
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
 	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/handlers"
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/withdrawal"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/config"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/idempotency"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/logger"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -55,9 +61,116 @@ func main() {
 	}
 	defer db.Close()
 
+	// Deposit addresses are derived from account-level xpubs only
+	hdWallet, err := wallet.NewHDWallet(wallet.HDConfig{
+		Network:            config.GetString("wallet.network"),
+		BitcoinXpub:        config.GetString("wallet.bitcoin_xpub"),
+		EthereumXpub:       config.GetString("wallet.ethereum_xpub"),
+		BitcoinFingerprint: config.GetString("wallet.bitcoin_fingerprint"),
+	}, log)
+	if err != nil {
+		log.Fatal("Failed to initialize HD wallet", zap.Error(err))
+	}
+	addressAllocator := wallet.NewAddressAllocator(db, hdWallet, log)
+
+	// Every issued address is watched for deposits
+	watchList := blockchain.NewWatchList()
+	loadCtx, loadCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	addresses, err := addressAllocator.All(loadCtx)
+	loadCancel()
+	if err != nil {
+		log.Fatal("Failed to load deposit addresses", zap.Error(err))
+	}
+	for _, addr := range addresses {
+		watchList.Watch(blockchain.WatchedAddress{
+			AccountID: addr.AccountID,
+			Currency:  addr.Currency,
+			Network:   addr.Chain,
+			Address:   addr.Address,
+		})
+	}
+	log.Info("Deposit watch-list loaded", zap.Int("addresses", watchList.Len()))
+
+	// deposits.confirmations overrides the default tiers per currency and network
+	confirmationPolicy := blockchain.DefaultConfirmationPolicy()
+	if config.IsSet("deposits.confirmations") {
+		var tiers map[string]map[string][]blockchain.ConfirmationTier
+		if err := config.UnmarshalKey("deposits.confirmations", &tiers); err != nil {
+			log.Fatal("Failed to read deposit confirmation tiers", zap.Error(err))
+		}
+		overrides, err := blockchain.NewConfirmationPolicy(tiers)
+		if err != nil {
+			log.Fatal("Invalid deposit confirmation tiers", zap.Error(err))
+		}
+		confirmationPolicy = confirmationPolicy.Merge(overrides)
+	}
+
+	// ERC-20 tokens: mainnet USDC and USDT unless ethereum.tokens lists
+	// tokens by symbol with their contract and decimals
+	var tokenList []blockchain.Token
+	if config.IsSet("ethereum.tokens") {
+		var configured map[string]blockchain.Token
+		if err := config.UnmarshalKey("ethereum.tokens", &configured); err != nil {
+			log.Fatal("Failed to read Ethereum tokens", zap.Error(err))
+		}
+		for symbol, token := range configured {
+			token.Symbol = symbol
+			if token.Network == "" {
+				token.Network = wallet.ChainEthereum
+			}
+			tokenList = append(tokenList, token)
+		}
+	} else if config.GetInt64("ethereum.chain_id") == 1 {
+		tokenList = blockchain.MainnetTokens
+	}
+	tokens, err := blockchain.NewTokenRegistry(tokenList)
+	if err != nil {
+		log.Fatal("Invalid Ethereum tokens", zap.Error(err))
+	}
+	for _, token := range tokens.Tokens(wallet.ChainEthereum) {
+		wallet.RegisterChainCurrency(wallet.ChainEthereum, token.Symbol)
+	}
+
+	// withdrawals.approvals.bands overrides the default value bands per currency
+	approvalPolicy := withdrawal.DefaultApprovalPolicy()
+	if config.IsSet("withdrawals.approvals.bands") {
+		var bands map[string][]withdrawal.ApprovalBand
+		if err := config.UnmarshalKey("withdrawals.approvals.bands", &bands); err != nil {
+			log.Fatal("Failed to read withdrawal approval bands", zap.Error(err))
+		}
+		overrides, err := withdrawal.NewApprovalPolicy(bands)
+		if err != nil {
+			log.Fatal("Invalid withdrawal approval bands", zap.Error(err))
+		}
+		approvalPolicy = approvalPolicy.Merge(overrides)
+	}
+	approvals := withdrawal.NewApprovals(db, approvalPolicy, withdrawal.ApprovalConfig{
+		Interval:    config.GetDuration("withdrawals.approvals.interval"),
+		ExpireAfter: config.GetDuration("withdrawals.approvals.expire_after"),
+	}, log)
+
+	// withdrawals.fees is the flat fee per withdrawal by currency
+	withdrawalFees := make(map[string]decimal.Decimal)
+	for currency, fee := range config.GetStringMapString("withdrawals.fees") {
+		amount, err := decimal.ParseAmount(fee, currency)
+		if err != nil || amount.IsNegative() {
+			log.Fatal("Invalid withdrawal fee", zap.String("currency", currency), zap.String("fee", fee))
+		}
+		withdrawalFees[currency] = amount
+	}
+	withdrawalRequests := withdrawal.NewRequests(db, withdrawalFees, log)
+
 	// Initialize handlers
-	depositHandler := handlers.NewDepositHandler(db, log)
-	withdrawalHandler := handlers.NewWithdrawalHandler(db, log)
+	depositHandler := handlers.NewDepositHandler(db, addressAllocator, watchList, confirmationPolicy, log)
+	withdrawalHandler := handlers.NewWithdrawalHandler(db, withdrawalRequests, log)
+	approvalHandler := handlers.NewApprovalHandler(approvals, log)
+
+	// Retried mutations replay their first response
+	idempotent := idempotency.Middleware(
+		idempotency.NewPostgresStore(db, config.GetDuration("idempotency.ttl")),
+		idempotency.Config{Scope: "settlement-service"},
+		log,
+	)
 
 	// Setup router
 	router := mux.NewRouter()
@@ -77,13 +190,19 @@ func main() {
 
 	// Deposit operations
 	internal.HandleFunc("/deposits/address", depositHandler.GenerateAddress).Methods("POST")
-	internal.HandleFunc("/deposits/process", depositHandler.ProcessDeposit).Methods("POST")
+	internal.Handle("/deposits/process", idempotent(http.HandlerFunc(depositHandler.ProcessDeposit))).Methods("POST")
 	internal.HandleFunc("/deposits/{id}", depositHandler.GetDeposit).Methods("GET")
 
 	// Withdrawal operations
-	internal.HandleFunc("/withdrawals/process", withdrawalHandler.ProcessWithdrawal).Methods("POST")
+	internal.Handle("/withdrawals", idempotent(http.HandlerFunc(withdrawalHandler.RequestWithdrawal))).Methods("POST")
 	internal.HandleFunc("/withdrawals/{id}/status", withdrawalHandler.GetWithdrawalStatus).Methods("GET")
 
+	// Admin approval queue
+	internal.HandleFunc("/withdrawals/approvals", approvalHandler.ListQueue).Methods("GET")
+	internal.HandleFunc("/withdrawals/{id}/approvals", approvalHandler.ListDecisions).Methods("GET")
+	internal.Handle("/withdrawals/{id}/approve", idempotent(http.HandlerFunc(approvalHandler.Approve))).Methods("POST")
+	internal.Handle("/withdrawals/{id}/reject", idempotent(http.HandlerFunc(approvalHandler.Reject))).Methods("POST")
+
 	// Start HTTP server
 	addr := fmt.Sprintf("%s:%d",
 		config.GetString("server.host"),
@@ -98,7 +217,188 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	// TODO: Start blockchain listeners for deposits in goroutines
+	// Scan new Bitcoin blocks for deposits to watched addresses
+	listenerCtx, stopListeners := context.WithCancel(context.Background())
+	defer stopListeners()
+	var btcClient *blockchain.BitcoinClient
+	var btcTxBuilder *withdrawal.BitcoinTxBuilder
+	if rpcURL := config.GetString("bitcoin.rpc_url"); rpcURL != "" {
+		btcClient = blockchain.NewBitcoinClient(blockchain.BitcoinConfig{
+			RPCURL:  rpcURL,
+			RPCUser: config.GetString("bitcoin.rpc_user"),
+			RPCPass: config.GetString("bitcoin.rpc_pass"),
+			Network: config.GetString("wallet.network"),
+		}, log)
+		listener := blockchain.NewDepositListener(btcClient, nil, nil, watchList, confirmationPolicy, db, log)
+		go listener.StartBitcoinListener(listenerCtx)
+
+		// Withdrawals are built as PSBTs from our UTXOs for the signers
+		if hdWallet.Enabled(wallet.ChainBitcoin) {
+			btcTxBuilder = withdrawal.NewBitcoinTxBuilder(db, btcClient, hdWallet, log)
+			btcTxHandler := handlers.NewBitcoinTxHandler(btcTxBuilder, log)
+			internal.HandleFunc("/bitcoin/transactions/{id}", btcTxHandler.GetTransaction).Methods("GET")
+			internal.Handle("/bitcoin/transactions/{id}/signatures", idempotent(http.HandlerFunc(btcTxHandler.SubmitSignatures))).Methods("POST")
+
+			// Bump the fee of withdrawals stuck in the mempool
+			bumper := withdrawal.NewFeeBumper(db, btcClient, btcTxBuilder, withdrawal.BumpConfig{
+				Interval:   config.GetDuration("withdrawals.fee_bump.interval"),
+				StuckAfter: config.GetInt64("withdrawals.fee_bump.stuck_after"),
+				MaxFeeRate: config.GetInt64("withdrawals.fee_bump.max_fee_rate"),
+				MaxFee:     config.GetInt64("withdrawals.fee_bump.max_fee_sats"),
+			}, log)
+			go bumper.Start(listenerCtx)
+		}
+	} else {
+		log.Warn("bitcoin.rpc_url not set, Bitcoin deposit listener disabled")
+	}
+
+	// Hot, warm and cold P2WSH multisig wallets collect their signers'
+	// signatures here; a wallet without signer keys is left out
+	multiSigWallets := make(map[string]*wallet.MultiSigWallet)
+	if btcClient != nil {
+		for _, policy := range []wallet.MultiSigConfig{wallet.HotWalletConfig, wallet.WarmWalletConfig, wallet.ColdWalletConfig} {
+			keys := config.GetStringSlice("multisig." + policy.WalletType + ".signer_keys")
+			if len(keys) == 0 {
+				continue
+			}
+			policy.SignerKeys = keys
+			policy.Network = config.GetString("wallet.network")
+			msw, err := wallet.NewMultiSigWallet(db, btcClient, policy, log)
+			if err != nil {
+				log.Fatal("Invalid multi-sig wallet", zap.String("wallet_type", policy.WalletType), zap.Error(err))
+			}
+			multiSigWallets[policy.WalletType] = msw
+			log.Info("Multi-sig wallet loaded",
+				zap.String("wallet_type", policy.WalletType),
+				zap.String("address", msw.Address()),
+			)
+		}
+	}
+	if len(multiSigWallets) > 0 {
+		multiSigHandler := handlers.NewMultiSigHandler(multiSigWallets, log)
+		internal.HandleFunc("/multisig/{wallet}/transactions", multiSigHandler.ListPending).Methods("GET")
+		internal.HandleFunc("/multisig/{wallet}/transactions/{id}", multiSigHandler.GetTransaction).Methods("GET")
+		internal.Handle("/multisig/{wallet}/transactions/{id}/signatures", idempotent(http.HandlerFunc(multiSigHandler.SubmitSignature))).Methods("POST")
+	}
+
+	// Follow Ethereum deposits through their receipts and scan token
+	// transfers to watched addresses
+	var ethClient *blockchain.EthereumClient
+	var ethTxSender *withdrawal.EthereumTxSender
+	if rpcURL := config.GetString("ethereum.rpc_url"); rpcURL != "" {
+		ethClient = blockchain.NewEthereumClient(blockchain.EthereumConfig{
+			RPCURL:  rpcURL,
+			ChainID: config.GetInt64("ethereum.chain_id"),
+			Network: config.GetString("wallet.network"),
+		}, log)
+		listener := blockchain.NewDepositListener(nil, ethClient, tokens, watchList, confirmationPolicy, db, log)
+		go listener.StartEthereumListener(listenerCtx)
+
+		// Replace hot wallet transactions stuck in the mempool
+		if key := config.GetString("ethereum.hot_wallet_key"); key != "" {
+			signer, err := wallet.NewEthereumKeySigner(key)
+			if err != nil {
+				log.Fatal("Invalid Ethereum hot wallet key", zap.Error(err))
+			}
+			ethTxSender = withdrawal.NewEthereumTxSender(db, ethClient, signer, withdrawal.EthereumSendConfig{
+				Interval:     config.GetDuration("withdrawals.ethereum.replace_interval"),
+				StuckAfter:   config.GetDuration("withdrawals.ethereum.stuck_after"),
+				MaxFeePerGas: config.GetInt64("withdrawals.ethereum.max_fee_per_gas"),
+			}, log)
+			go ethTxSender.Start(listenerCtx)
+		}
+	} else {
+		log.Warn("ethereum.rpc_url not set, Ethereum deposit listener disabled")
+	}
+
+	// Sweep deposit addresses into the hot wallet; Ethereum sweeps wait for
+	// the offline deposit key's signature
+	if btcTxBuilder != nil || ethTxSender != nil {
+		minEth, err := decimal.NewFromString(config.GetString("sweeps.min_eth_amount"))
+		if err != nil {
+			log.Fatal("Invalid sweeps.min_eth_amount", zap.Error(err))
+		}
+		minToken, err := decimal.NewFromString(config.GetString("sweeps.min_token_amount"))
+		if err != nil {
+			log.Fatal("Invalid sweeps.min_token_amount", zap.Error(err))
+		}
+		sweeper := withdrawal.NewSweeper(db, btcClient, btcTxBuilder, ethClient, ethTxSender, tokens, withdrawal.SweepConfig{
+			Interval:       config.GetDuration("sweeps.interval"),
+			MaxFeeRate:     config.GetInt64("sweeps.max_fee_rate"),
+			MinInputs:      config.GetInt("sweeps.min_inputs"),
+			MaxInputs:      config.GetInt("sweeps.max_inputs"),
+			MinEthAmount:   minEth,
+			MinTokenAmount: minToken,
+			Confirmations:  config.GetInt("sweeps.confirmations"),
+			SignTimeout:    config.GetDuration("sweeps.sign_timeout"),
+			DropAfter:      config.GetDuration("sweeps.drop_after"),
+		}, log)
+		sweepHandler := handlers.NewSweepHandler(sweeper, log)
+		internal.HandleFunc("/sweeps/unsigned", sweepHandler.ListUnsigned).Methods("GET")
+		internal.HandleFunc("/sweeps/{id}", sweepHandler.GetSweep).Methods("GET")
+		internal.Handle("/sweeps/{id}/signature", idempotent(http.HandlerFunc(sweepHandler.SubmitSignature))).Methods("POST")
+		go sweeper.Start(listenerCtx)
+	}
+
+	// Keep custody at its hot/warm/cold split; Bitcoin moves are proposed
+	// to the hot wallet's signers or the warm multisig wallet's
+	if btcTxBuilder != nil || ethTxSender != nil {
+		minBitcoin, err := decimal.NewFromString(config.GetString("custody.min_bitcoin_amount"))
+		if err != nil {
+			log.Fatal("Invalid custody.min_bitcoin_amount", zap.Error(err))
+		}
+		tolerance, err := decimal.NewFromString(config.GetString("custody.tolerance"))
+		if err != nil {
+			log.Fatal("Invalid custody.tolerance", zap.Error(err))
+		}
+		rebalancer := withdrawal.NewRebalancer(db, btcClient, btcTxBuilder,
+			multiSigWallets["warm"], multiSigWallets["cold"], ethTxSender, tokens, withdrawal.RebalanceConfig{
+				Interval:            config.GetDuration("custody.interval"),
+				Thresholds:          wallet.DefaultThresholds,
+				Tolerance:           tolerance,
+				CoverageWindow:      config.GetDuration("custody.coverage_window"),
+				Lookback:            config.GetDuration("custody.lookback"),
+				MinBitcoinAmount:    minBitcoin,
+				DropAfter:           config.GetDuration("custody.drop_after"),
+				EthereumWarmAddress: config.GetString("custody.ethereum.warm_address"),
+				EthereumColdAddress: config.GetString("custody.ethereum.cold_address"),
+			}, log)
+		custodyHandler := handlers.NewCustodyHandler(rebalancer, log)
+		internal.HandleFunc("/custody/split", custodyHandler.GetSplit).Methods("GET")
+		internal.HandleFunc("/custody/rebalances", custodyHandler.ListRebalances).Methods("GET")
+		go rebalancer.Start(listenerCtx)
+	}
+
+	// Follow processing withdrawals until they complete or fail
+	var bank withdrawal.PaymentStatusSource
+	if baseURL := config.GetString("modulr.base_url"); baseURL != "" {
+		bank = banking.NewModulrClient(banking.ModulrConfig{
+			BaseURL:   baseURL,
+			APIKey:    config.GetString("modulr.api_key"),
+			APISecret: config.GetString("modulr.api_secret"),
+		}, log)
+	}
+	monitorConfig := withdrawal.DefaultMonitorConfig()
+	if d := config.GetDuration("withdrawals.monitor_interval"); d > 0 {
+		monitorConfig.Interval = d
+	}
+	if d := config.GetDuration("withdrawals.drop_after"); d > 0 {
+		monitorConfig.DropAfter = d
+	}
+	monitor := withdrawal.NewMonitor(db, btcClient, ethClient, bank, confirmationPolicy, monitorConfig, log)
+	go monitor.Start(listenerCtx)
+
+	// Pay approved withdrawals, batching Bitcoin ones when enabled
+	processor := withdrawal.NewProcessor(db, btcClient, ethClient, tokens, btcTxBuilder, ethTxSender, withdrawal.ProcessorConfig{
+		Interval: config.GetDuration("withdrawals.process_interval"),
+		Batch: withdrawal.BatchConfig{
+			Enabled: config.GetBool("withdrawals.batch.enabled"),
+			Window:  config.GetDuration("withdrawals.batch.window"),
+			MaxSize: config.GetInt("withdrawals.batch.max_size"),
+		},
+	}, log)
+	go processor.Start(listenerCtx)
+	go approvals.Start(listenerCtx)
 
 	// Start server
 	go func() {
@@ -114,6 +414,7 @@ func main() {
 	<-quit
 
 	log.Info("Shutting down Settlement Service...")
+	stopListeners()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
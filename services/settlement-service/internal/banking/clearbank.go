@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"go.uber.org/zap"
 )
 
@@ -67,7 +68,7 @@ func NewClearBankClient(config ClearBankConfig, logger *zap.Logger) (*ClearBankC
 type FasterPaymentRequest struct {
 	EndToEndID          string  `json:"endToEndId"`
 	Reference           string  `json:"reference"`
-	Amount              float64 `json:"amount"`
+	Amount              decimal.Decimal `json:"amount"`
 	CreditorAccountName string  `json:"creditorAccount.name"`
 	CreditorSortCode    string  `json:"creditorAccount.sortCode"`
 	CreditorAccountNumber string `json:"creditorAccount.accountNumber"`
@@ -88,7 +89,7 @@ func (c *ClearBankClient) SendFasterPayment(ctx context.Context, req FasterPayme
 	requestBody := map[string]interface{}{
 		"endToEndId": req.EndToEndID,
 		"reference":  req.Reference,
-		"amount":     req.Amount,
+		"amount":     json.Number(req.Amount.StringCurrency("GBP")),
 		"creditorAccount": map[string]string{
 			"name":          req.CreditorAccountName,
 			"sortCode":      req.CreditorSortCode,
@@ -115,7 +116,7 @@ func (c *ClearBankClient) SendFasterPayment(ctx context.Context, req FasterPayme
 
 	c.logger.Info("Sending Faster Payment",
 		zap.String("end_to_end_id", req.EndToEndID),
-		zap.Float64("amount", req.Amount),
+		zap.String("amount", req.Amount.String()),
 	)
 
 	resp, err := c.httpClient.Do(httpReq)
@@ -147,32 +148,32 @@ func (c *ClearBankClient) SendFasterPayment(ctx context.Context, req FasterPayme
 }
 
 // GetAccountBalance gets the current account balance
-func (c *ClearBankClient) GetAccountBalance(ctx context.Context, accountID string) (float64, error) {
+func (c *ClearBankClient) GetAccountBalance(ctx context.Context, accountID string) (decimal.Decimal, error) {
 	url := fmt.Sprintf("%s/v1/accounts/%s", c.baseURL, accountID)
 
 	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 
 	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("API error: status %d", resp.StatusCode)
+		return decimal.Zero, fmt.Errorf("API error: status %d", resp.StatusCode)
 	}
 
 	var account struct {
-		Balance float64 `json:"balance"`
+		Balance decimal.Decimal `json:"balance"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 
 	return account.Balance, nil
@@ -211,7 +212,7 @@ func (c *ClearBankClient) GetTransactions(ctx context.Context, accountID string,
 // Transaction represents a bank transaction
 type Transaction struct {
 	ID            string    `json:"id"`
-	Amount        float64   `json:"amount"`
+	Amount        decimal.Decimal `json:"amount"`
 	Reference     string    `json:"reference"`
 	Direction     string    `json:"direction"` // "inbound", "outbound"
 	Status        string    `json:"status"`
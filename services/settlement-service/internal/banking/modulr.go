@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"go.uber.org/zap"
 )
 
@@ -46,7 +47,12 @@ func NewModulrClient(config ModulrConfig, logger *zap.Logger) *ModulrClient {
 func (m *ModulrClient) CreatePayment(ctx context.Context, payment PaymentRequest) (*PaymentResponse, error) {
 	url := fmt.Sprintf("%s/payments", m.baseURL)
 
-	jsonData, err := json.Marshal(payment)
+	// Modulr expects the amount as a JSON number; json.Number keeps it exact
+	type paymentBody PaymentRequest
+	jsonData, err := json.Marshal(struct {
+		paymentBody
+		Amount json.Number `json:"amount"`
+	}{paymentBody(payment), json.Number(payment.Amount.StringCurrency("GBP"))})
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +67,7 @@ func (m *ModulrClient) CreatePayment(ctx context.Context, payment PaymentRequest
 
 	m.logger.Info("Creating Modulr payment",
 		zap.String("reference", payment.Reference),
-		zap.Float64("amount", payment.Amount),
+		zap.String("amount", payment.Amount.String()),
 	)
 
 	resp, err := m.httpClient.Do(httpReq)
@@ -90,7 +96,7 @@ func (m *ModulrClient) CreatePayment(ctx context.Context, payment PaymentRequest
 // PaymentRequest represents a payment request
 type PaymentRequest struct {
 	Reference     string  `json:"reference"`
-	Amount        float64 `json:"amount"`
+	Amount        decimal.Decimal `json:"amount"`
 	Currency      string  `json:"currency"`
 	SortCode      string  `json:"sortCode"`
 	AccountNumber string  `json:"accountNumber"`
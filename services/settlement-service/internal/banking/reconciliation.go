@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/withdrawal"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 )
 
@@ -109,7 +112,7 @@ func (r *PaymentReconciliationEngine) reconcileTransaction(ctx context.Context,
 
 			r.logger.Warn("Unmatched inbound transaction",
 				zap.String("reference", tx.Reference),
-				zap.Float64("amount", tx.Amount),
+				zap.String("amount", tx.Amount.String()),
 			)
 
 			// TODO: Create deposit record automatically or flag for manual review
@@ -163,7 +166,14 @@ func (r *PaymentReconciliationEngine) reconcileTransaction(ctx context.Context,
 	return nil
 }
 
-func (r *PaymentReconciliationEngine) creditGBPDeposit(ctx context.Context, depositID uuid.UUID, bankTxID string, amount float64) error {
+func (r *PaymentReconciliationEngine) creditGBPDeposit(ctx context.Context, depositID uuid.UUID, bankTxID string, amount decimal.Decimal) error {
+	if !amount.IsPositive() {
+		return fmt.Errorf("invalid deposit amount: %s", amount)
+	}
+	if err := decimal.CheckPrecision(amount, "GBP"); err != nil {
+		return err
+	}
+
 	// Begin transaction
 	tx, err := r.db.Pool.Begin(ctx)
 	if err != nil {
@@ -173,7 +183,7 @@ func (r *PaymentReconciliationEngine) creditGBPDeposit(ctx context.Context, depo
 
 	// Get deposit details
 	var accountID uuid.UUID
-	var expectedAmount string
+	var expectedAmount decimal.Decimal
 	query := `
 		SELECT account_id, amount FROM deposits WHERE id = $1
 	`
@@ -182,26 +192,33 @@ func (r *PaymentReconciliationEngine) creditGBPDeposit(ctx context.Context, depo
 		return err
 	}
 
-	// Verify amount matches (TODO: use decimal comparison)
-	// For now, just log
+	// Verify amount matches. The customer may send a different amount to the
+	// one they declared; we credit what actually arrived.
+	if !amount.Equal(expectedAmount) {
+		r.logger.Warn("GBP deposit amount differs from expected",
+			zap.String("deposit_id", depositID.String()),
+			zap.String("expected", expectedAmount.String()),
+			zap.String("received", amount.String()),
+		)
+	}
 
 	// Update deposit status
 	updateDepositQuery := `
 		UPDATE deposits
 		SET status = 'credited',
-		    txid = $1,
+		    amount = $1,
+		    txid = $2,
 		    credited_at = NOW(),
 		    updated_at = NOW()
-		WHERE id = $2
+		WHERE id = $3
 	`
 
-	_, err = tx.Exec(ctx, updateDepositQuery, bankTxID, depositID)
+	_, err = tx.Exec(ctx, updateDepositQuery, amount, bankTxID, depositID)
 	if err != nil {
 		return err
 	}
 
 	// Credit wallet
-	amountStr := fmt.Sprintf("%.2f", amount)
 	updateWalletQuery := `
 		UPDATE wallets
 		SET balance = balance + $1,
@@ -211,8 +228,8 @@ func (r *PaymentReconciliationEngine) creditGBPDeposit(ctx context.Context, depo
 		RETURNING balance
 	`
 
-	var newBalance string
-	err = tx.QueryRow(ctx, updateWalletQuery, amountStr, accountID).Scan(&newBalance)
+	var newBalance decimal.Decimal
+	err = tx.QueryRow(ctx, updateWalletQuery, amount, accountID).Scan(&newBalance)
 	if err != nil {
 		return err
 	}
@@ -225,7 +242,7 @@ func (r *PaymentReconciliationEngine) creditGBPDeposit(ctx context.Context, depo
 		) VALUES ($1, 'GBP', $2, $3, 'deposit', $4, 'deposit', 'GBP deposit via Faster Payments')
 	`
 
-	_, err = tx.Exec(ctx, ledgerQuery, accountID, amountStr, newBalance, depositID)
+	_, err = tx.Exec(ctx, ledgerQuery, accountID, amount, newBalance, depositID)
 	if err != nil {
 		return err
 	}
@@ -238,7 +255,7 @@ func (r *PaymentReconciliationEngine) creditGBPDeposit(ctx context.Context, depo
 	r.logger.Info("GBP deposit credited",
 		zap.String("deposit_id", depositID.String()),
 		zap.String("bank_tx_id", bankTxID),
-		zap.Float64("amount", amount),
+		zap.String("amount", amount.String()),
 	)
 
 	return nil
@@ -251,10 +268,20 @@ func (r *PaymentReconciliationEngine) completeGBPWithdrawal(ctx context.Context,
 		    txid = $1,
 		    completed_at = NOW(),
 		    updated_at = NOW()
-		WHERE id = $2
+		WHERE id = $2 AND status <> 'completed'
 	`
 
-	_, err := r.db.Pool.Exec(ctx, query, bankTxID, withdrawalID)
+	// Completing the withdrawal and debiting its held funds commit together
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, query, bankTxID, withdrawalID)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return nil
+		}
+		return withdrawal.DebitWithdrawalHold(ctx, tx, withdrawalID)
+	})
 	if err != nil {
 		return err
 	}
@@ -286,7 +313,7 @@ func (r *PaymentReconciliationEngine) checkUnprocessedDeposits(ctx context.Conte
 	for rows.Next() {
 		var id uuid.UUID
 		var accountID uuid.UUID
-		var amount string
+		var amount decimal.Decimal
 		var createdAt time.Time
 
 		if err := rows.Scan(&id, &accountID, &amount, &createdAt); err != nil {
@@ -296,7 +323,7 @@ func (r *PaymentReconciliationEngine) checkUnprocessedDeposits(ctx context.Conte
 		report.Issues = append(report.Issues, ReconciliationIssue{
 			Type:        "delayed_deposit",
 			Reference:   id.String(),
-			Amount:      0, // Parse from string
+			Amount:      amount,
 			Description: fmt.Sprintf("Deposit pending for %v", time.Since(createdAt)),
 		})
 	}
@@ -315,7 +342,7 @@ type ReconciliationReport struct {
 type ReconciliationIssue struct {
 	Type        string  `json:"type"`
 	Reference   string  `json:"reference"`
-	Amount      float64 `json:"amount"`
+	Amount      decimal.Decimal `json:"amount"`
 	Description string  `json:"description"`
 }
 
@@ -11,6 +11,7 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"go.uber.org/zap"
 )
 
@@ -150,49 +151,55 @@ type BankAccount struct {
 	AccountType   string  `json:"account_type"`
 	DisplayName   string  `json:"display_name"`
 	Currency      string  `json:"currency"`
-	Balance       float64 `json:"balance"`
+	Balance       decimal.Decimal `json:"balance"`
 }
 
 // GetBalance retrieves account balance
-func (t *TrueLayerClient) GetBalance(ctx context.Context, accessToken, accountID string) (float64, error) {
+func (t *TrueLayerClient) GetBalance(ctx context.Context, accessToken, accountID string) (decimal.Decimal, error) {
 	endpoint := fmt.Sprintf("%s/data/v1/accounts/%s/balance", t.baseURL, accountID)
 
 	httpReq, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 
 	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 
 	resp, err := t.httpClient.Do(httpReq)
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 	defer resp.Body.Close()
 
 	var balanceResp struct {
 		Results []struct {
-			Current float64 `json:"current"`
+			Current decimal.Decimal `json:"current"`
 		} `json:"results"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&balanceResp); err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 
 	if len(balanceResp.Results) == 0 {
-		return 0, fmt.Errorf("no balance data")
+		return decimal.Zero, fmt.Errorf("no balance data")
 	}
 
 	return balanceResp.Results[0].Current, nil
 }
 
 // CreatePaymentRequest creates a payment request for instant deposit
-func (t *TrueLayerClient) CreatePaymentRequest(ctx context.Context, accessToken string, amount float64, reference string) (string, error) {
+func (t *TrueLayerClient) CreatePaymentRequest(ctx context.Context, accessToken string, amount decimal.Decimal, reference string) (string, error) {
 	endpoint := fmt.Sprintf("%s/payments", t.baseURL)
 
+	// Convert to pence; rejects sub-penny amounts rather than truncating
+	pence, err := amount.MinorUnits(decimal.ScaleOf("GBP"))
+	if err != nil {
+		return "", err
+	}
+
 	paymentReq := map[string]interface{}{
-		"amount_in_minor": int(amount * 100), // Convert to pence
+		"amount_in_minor": pence.Int64(),
 		"currency":        "GBP",
 		"payment_method": map[string]interface{}{
 			"type": "bank_transfer",
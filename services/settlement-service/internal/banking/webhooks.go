@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
@@ -46,7 +47,7 @@ type ClearBankWebhookPayload struct {
 	Version       int       `json:"Version"`
 	Timestamp     time.Time `json:"Timestamp"`
 	TransactionID string    `json:"TransactionId"`
-	Amount        float64   `json:"Amount"`
+	Amount        decimal.Decimal `json:"Amount"`
 	Reference     string    `json:"Reference"`
 	Direction     string    `json:"Direction"`
 	Status        string    `json:"Status"`
@@ -126,7 +127,7 @@ func (h *WebhookHandler) processInboundPayment(ctx context.Context, payload Clea
 		// No matching deposit, create one
 		h.logger.Warn("Received payment with no matching deposit",
 			zap.String("reference", payload.Reference),
-			zap.Float64("amount", payload.Amount),
+			zap.String("amount", payload.Amount.String()),
 		)
 
 		// TODO: Create deposit record or flag for manual review
@@ -141,7 +142,7 @@ func (h *WebhookHandler) processInboundPayment(ctx context.Context, payload Clea
 
 	h.logger.Info("Inbound payment processed",
 		zap.String("deposit_id", depositID),
-		zap.Float64("amount", payload.Amount),
+		zap.String("amount", payload.Amount.String()),
 	)
 }
 
@@ -190,7 +191,7 @@ func (h *WebhookHandler) processSettledPayment(ctx context.Context, payload Clea
 type ModulrWebhookPayload struct {
 	Type      string    `json:"type"`
 	ID        string    `json:"id"`
-	Amount    float64   `json:"amount"`
+	Amount    decimal.Decimal `json:"amount"`
 	Reference string    `json:"reference"`
 	Status    string    `json:"status"`
 	CreatedAt time.Time `json:"createdAt"`
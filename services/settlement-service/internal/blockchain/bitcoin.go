@@ -4,11 +4,14 @@ package blockchain
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"go.uber.org/zap"
 )
 
@@ -65,8 +68,86 @@ type RPCError struct {
 	Message string `json:"message"`
 }
 
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%s (code: %d)", e.Message, e.Code)
+}
+
+// rpcInvalidAddressOrKey is RPC_INVALID_ADDRESS_OR_KEY, returned for
+// unknown transactions
+const rpcInvalidAddressOrKey = -5
+
+// rpcVerifyAlreadyInChain is RPC_VERIFY_ALREADY_IN_CHAIN, returned when a
+// broadcast transaction has already been mined
+const rpcVerifyAlreadyInChain = -27
+
+// ErrTransactionNotFound means the node does not know the transaction
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// ErrAlreadyInChain means a broadcast transaction is already in a block
+var ErrAlreadyInChain = errors.New("transaction already in block chain")
+
+// ErrAlreadyInMempool means a broadcast transaction is already in the
+// node's mempool
+var ErrAlreadyInMempool = errors.New("transaction already in mempool")
+
+// rpcDeserializationError is RPC_DESERIALIZATION_ERROR, returned for a
+// transaction that cannot be decoded
+const rpcDeserializationError = -22
+
+// rpcVerifyRejected is RPC_VERIFY_REJECTED, returned for a transaction
+// failing consensus or policy checks
+const rpcVerifyRejected = -26
+
+// IsBroadcastRejected reports whether a SendRawTransaction error is a
+// definite consensus or policy rejection, which sending the same
+// transaction again will not change. A conflict with a transaction in the
+// mempool, missing inputs (RPC_VERIFY_ERROR), a node still warming up
+// (RPC_IN_WARMUP) and transport failures are not: the transaction may yet
+// be accepted, or an earlier copy of it already have been.
+func IsBroadcastRejected(err error) bool {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	switch rpcErr.Code {
+	case rpcDeserializationError:
+		return true
+	case rpcVerifyRejected:
+		return !strings.Contains(rpcErr.Message, "txn-mempool-conflict")
+	}
+	return false
+}
+
+func isAlreadyInMempool(rpcErr *RPCError) bool {
+	return (rpcErr.Code == rpcVerifyRejected || rpcErr.Code == rpcVerifyAlreadyInChain) &&
+		(strings.Contains(rpcErr.Message, "txn-already-in-mempool") || strings.Contains(rpcErr.Message, "txn-already-known"))
+}
+
+func isNotFound(err error) bool {
+	var rpcErr *RPCError
+	return errors.As(err, &rpcErr) && rpcErr.Code == rpcInvalidAddressOrKey
+}
+
 // callRPC makes an RPC call to Bitcoin Core
 func (c *BitcoinClient) callRPC(method string, params []interface{}) (interface{}, error) {
+	raw, err := c.call(method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode numbers as json.Number so BTC amounts are never rounded through float64
+	var result interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+
+	return result, nil
+}
+
+// call makes an RPC call and returns the raw result
+func (c *BitcoinClient) call(method string, params []interface{}) (json.RawMessage, error) {
 	request := RPCRequest{
 		JSONRPC: "1.0",
 		ID:      fmt.Sprintf("%d", time.Now().Unix()),
@@ -98,13 +179,16 @@ func (c *BitcoinClient) callRPC(method string, params []interface{}) (interface{
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	var rpcResp RPCResponse
+	var rpcResp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
 	if err := json.Unmarshal(body, &rpcResp); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
 	if rpcResp.Error != nil {
-		return nil, fmt.Errorf("RPC error: %s (code: %d)", rpcResp.Error.Message, rpcResp.Error.Code)
+		return nil, fmt.Errorf("RPC error: %w", rpcResp.Error)
 	}
 
 	return rpcResp.Result, nil
@@ -117,41 +201,159 @@ func (c *BitcoinClient) GetBlockHeight() (int64, error) {
 		return 0, err
 	}
 
-	height, ok := result.(float64)
+	height, ok := result.(json.Number)
 	if !ok {
 		return 0, fmt.Errorf("unexpected response type")
 	}
 
-	return int64(height), nil
+	return height.Int64()
+}
+
+// Block is a block as returned by getblock with verbosity 2
+type Block struct {
+	Hash              string    `json:"hash"`
+	Height            int64     `json:"height"`
+	PreviousBlockHash string    `json:"previousblockhash"`
+	Tx                []BlockTx `json:"tx"`
+}
+
+// BlockTx is a decoded transaction within a Block
+type BlockTx struct {
+	TxID string     `json:"txid"`
+	Vout []TxOutput `json:"vout"`
+}
+
+// TxOutput is a transaction output. Value is in BTC.
+type TxOutput struct {
+	Value        json.Number `json:"value"`
+	N            uint32      `json:"n"`
+	ScriptPubKey struct {
+		Hex     string `json:"hex"`
+		Address string `json:"address"`
+		// Addresses is set instead of Address before Bitcoin Core 22
+		Addresses []string `json:"addresses"`
+	} `json:"scriptPubKey"`
+}
+
+// Address returns the address an output pays, or "" for non-standard
+// outputs
+func (o TxOutput) Address() string {
+	if o.ScriptPubKey.Address != "" {
+		return o.ScriptPubKey.Address
+	}
+	if len(o.ScriptPubKey.Addresses) == 1 {
+		return o.ScriptPubKey.Addresses[0]
+	}
+	return ""
+}
+
+// Amount returns the output value as a decimal
+func (o TxOutput) Amount() (decimal.Decimal, error) {
+	return decimal.NewFromString(o.Value.String())
+}
+
+// GetBlockHash returns the hash of the block at height on the active chain
+func (c *BitcoinClient) GetBlockHash(height int64) (string, error) {
+	result, err := c.callRPC("getblockhash", []interface{}{height})
+	if err != nil {
+		return "", err
+	}
+
+	hash, ok := result.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected response type")
+	}
+
+	return hash, nil
+}
+
+// GetBlock returns a block with its transactions decoded
+func (c *BitcoinClient) GetBlock(hash string) (*Block, error) {
+	raw, err := c.call("getblock", []interface{}{hash, 2})
+	if err != nil {
+		return nil, err
+	}
+
+	var block Block
+	if err := json.Unmarshal(raw, &block); err != nil {
+		return nil, fmt.Errorf("failed to decode block %s: %w", hash, err)
+	}
+
+	return &block, nil
 }
 
 // GetBalance returns the balance for an address
-func (c *BitcoinClient) GetBalance(address string) (float64, error) {
+func (c *BitcoinClient) GetBalance(address string) (decimal.Decimal, error) {
 	// Use listunspent to get balance for address
 	result, err := c.callRPC("listunspent", []interface{}{0, 9999999, []string{address}})
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 
 	unspent, ok := result.([]interface{})
 	if !ok {
-		return 0, fmt.Errorf("unexpected response type")
+		return decimal.Zero, fmt.Errorf("unexpected response type")
 	}
 
-	var totalBalance float64
+	totalBalance := decimal.Zero
 	for _, utxo := range unspent {
 		utxoMap, ok := utxo.(map[string]interface{})
 		if !ok {
 			continue
 		}
-		if amount, ok := utxoMap["amount"].(float64); ok {
-			totalBalance += amount
+		raw, ok := utxoMap["amount"].(json.Number)
+		if !ok {
+			continue
+		}
+		amount, err := decimal.NewFromString(raw.String())
+		if err != nil {
+			return decimal.Zero, fmt.Errorf("invalid utxo amount %q: %w", raw, err)
 		}
+		totalBalance = totalBalance.Add(amount)
 	}
 
 	return totalBalance, nil
 }
 
+// ScannedOutput is a confirmed unspent output found by ScanAddress
+type ScannedOutput struct {
+	TxID         string      `json:"txid"`
+	Vout         uint32      `json:"vout"`
+	ScriptPubKey string      `json:"scriptPubKey"`
+	Amount       json.Number `json:"amount"`
+	Height       int64       `json:"height"`
+}
+
+// AddressScan is the confirmed unspent outputs paying an address
+type AddressScan struct {
+	Total    json.Number     `json:"total_amount"`
+	Unspents []ScannedOutput `json:"unspents"`
+}
+
+// ScanAddress finds the confirmed unspent outputs paying an address in the
+// UTXO set. Unlike GetBalance it works for addresses the node's wallet does
+// not watch, such as the multisig wallets, but each call scans the whole
+// set.
+func (c *BitcoinClient) ScanAddress(address string) (*AddressScan, error) {
+	raw, err := c.call("scantxoutset", []interface{}{"start", []string{"addr(" + address + ")"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var scan struct {
+		AddressScan
+		Success bool `json:"success"`
+	}
+	if err := json.Unmarshal(raw, &scan); err != nil {
+		return nil, fmt.Errorf("failed to decode scan of %s: %w", address, err)
+	}
+	if !scan.Success {
+		return nil, fmt.Errorf("scan of %s did not complete", address)
+	}
+
+	return &scan.AddressScan, nil
+}
+
 // GetTransaction gets transaction details
 func (c *BitcoinClient) GetTransaction(txid string) (map[string]interface{}, error) {
 	result, err := c.callRPC("gettransaction", []interface{}{txid})
@@ -167,6 +369,87 @@ func (c *BitcoinClient) GetTransaction(txid string) (map[string]interface{}, err
 	return tx, nil
 }
 
+// WalletTransaction is a wallet transaction as returned by gettransaction.
+// Confirmations is negative when the transaction conflicts with one in the
+// active chain.
+type WalletTransaction struct {
+	TxID          string `json:"txid"`
+	Confirmations int64  `json:"confirmations"`
+	BlockHash     string `json:"blockhash"`
+	BlockHeight   int64  `json:"blockheight"`
+}
+
+// GetWalletTransaction returns a transaction sent or received by the node's
+// wallet, or ErrTransactionNotFound
+func (c *BitcoinClient) GetWalletTransaction(txid string) (*WalletTransaction, error) {
+	raw, err := c.call("gettransaction", []interface{}{txid})
+	if isNotFound(err) {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tx WalletTransaction
+	if err := json.Unmarshal(raw, &tx); err != nil {
+		return nil, fmt.Errorf("failed to decode transaction %s: %w", txid, err)
+	}
+
+	return &tx, nil
+}
+
+// RawTransaction is a transaction as returned by getrawtransaction.
+// Confirmations is zero while it is in the mempool.
+type RawTransaction struct {
+	TxID          string `json:"txid"`
+	Confirmations int64  `json:"confirmations"`
+	BlockHash     string `json:"blockhash"`
+}
+
+// GetRawTransaction returns a transaction in the mempool or, with -txindex,
+// any block, or ErrTransactionNotFound. Transactions the wallet did not
+// send, such as signed PSBTs, are only visible this way.
+func (c *BitcoinClient) GetRawTransaction(txid string) (*RawTransaction, error) {
+	raw, err := c.call("getrawtransaction", []interface{}{txid, true})
+	if isNotFound(err) {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tx RawTransaction
+	if err := json.Unmarshal(raw, &tx); err != nil {
+		return nil, fmt.Errorf("failed to decode transaction %s: %w", txid, err)
+	}
+
+	return &tx, nil
+}
+
+// InMempool reports whether a transaction is in the node's mempool
+func (c *BitcoinClient) InMempool(txid string) (bool, error) {
+	_, err := c.call("getmempoolentry", []interface{}{txid})
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AbandonTransaction marks a wallet transaction that is neither confirmed
+// nor in the mempool as abandoned, so the wallet stops rebroadcasting it and
+// can spend its inputs again
+func (c *BitcoinClient) AbandonTransaction(txid string) error {
+	_, err := c.call("abandontransaction", []interface{}{txid})
+	if isNotFound(err) {
+		return ErrTransactionNotFound
+	}
+	return err
+}
+
 // GetConfirmations returns the number of confirmations for a transaction
 func (c *BitcoinClient) GetConfirmations(txid string) (int, error) {
 	tx, err := c.GetTransaction(txid)
@@ -174,17 +457,29 @@ func (c *BitcoinClient) GetConfirmations(txid string) (int, error) {
 		return 0, err
 	}
 
-	confirmations, ok := tx["confirmations"].(float64)
+	confirmations, ok := tx["confirmations"].(json.Number)
 	if !ok {
 		return 0, nil
 	}
 
-	return int(confirmations), nil
+	n, err := confirmations.Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
 }
 
-// SendToAddress sends BTC to an address
-func (c *BitcoinClient) SendToAddress(address string, amount float64) (string, error) {
-	result, err := c.callRPC("sendtoaddress", []interface{}{address, amount})
+// SendToAddress sends BTC to an address. The amount must not have more than
+// 8 decimal places.
+func (c *BitcoinClient) SendToAddress(address string, amount decimal.Decimal) (string, error) {
+	if err := decimal.CheckPrecision(amount, "BTC"); err != nil {
+		return "", err
+	}
+
+	// json.Number is written verbatim, so bitcoind sees the exact amount
+	btcAmount := json.Number(amount.StringCurrency("BTC"))
+	result, err := c.callRPC("sendtoaddress", []interface{}{address, btcAmount})
 	if err != nil {
 		return "", err
 	}
@@ -197,12 +492,40 @@ func (c *BitcoinClient) SendToAddress(address string, amount float64) (string, e
 	c.logger.Info("Bitcoin transaction sent",
 		zap.String("txid", txid),
 		zap.String("address", address),
-		zap.Float64("amount", amount),
+		zap.String("amount", amount.String()),
 	)
 
 	return txid, nil
 }
 
+// SendRawTransaction broadcasts a fully signed transaction, given as hex,
+// and returns its txid. A transaction the node rejects returns its
+// *RPCError, which IsBroadcastRejected classifies; one already in the
+// mempool returns ErrAlreadyInMempool and one already mined
+// ErrAlreadyInChain.
+func (c *BitcoinClient) SendRawTransaction(txHex string) (string, error) {
+	result, err := c.callRPC("sendrawtransaction", []interface{}{txHex})
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && isAlreadyInMempool(rpcErr) {
+		return "", ErrAlreadyInMempool
+	}
+	if errors.As(err, &rpcErr) && rpcErr.Code == rpcVerifyAlreadyInChain {
+		return "", ErrAlreadyInChain
+	}
+	if err != nil {
+		return "", err
+	}
+
+	txid, ok := result.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected response type")
+	}
+
+	c.logger.Info("Bitcoin transaction broadcast", zap.String("txid", txid))
+
+	return txid, nil
+}
+
 // ValidateAddress validates a Bitcoin address
 func (c *BitcoinClient) ValidateAddress(address string) (bool, error) {
 	result, err := c.callRPC("validateaddress", []interface{}{address})
@@ -223,22 +546,29 @@ func (c *BitcoinClient) ValidateAddress(address string) (bool, error) {
 	return isValid, nil
 }
 
-// EstimateFee estimates transaction fee
-func (c *BitcoinClient) EstimateFee(blocks int) (float64, error) {
+// EstimateFee estimates the fee rate in BTC/kvB
+func (c *BitcoinClient) EstimateFee(blocks int) (decimal.Decimal, error) {
+	// Default fee if estimation fails
+	defaultFeeRate := decimal.RequireFromString("0.00001") // 1 sat/vB
+
 	result, err := c.callRPC("estimatesmartfee", []interface{}{blocks})
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 
 	estimate, ok := result.(map[string]interface{})
 	if !ok {
-		return 0, fmt.Errorf("unexpected response type")
+		return decimal.Zero, fmt.Errorf("unexpected response type")
 	}
 
-	feeRate, ok := estimate["feerate"].(float64)
+	raw, ok := estimate["feerate"].(json.Number)
 	if !ok {
-		// Return default fee if estimation fails
-		return 0.00001, nil // 1 sat/vB
+		return defaultFeeRate, nil
+	}
+
+	feeRate, err := decimal.NewFromString(raw.String())
+	if err != nil {
+		return defaultFeeRate, nil
 	}
 
 	return feeRate, nil
@@ -0,0 +1,177 @@
+// BitCurrent Exchange - Deposit Confirmation Policy
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+)
+
+// ErrNoConfirmationPolicy means no tiers are configured for a currency on
+// a network
+var ErrNoConfirmationPolicy = errors.New("no confirmation policy for currency and network")
+
+// ConfirmationTier sets the confirmations needed for deposits up to
+// MaxAmount. The last tier of a policy has no MaxAmount.
+type ConfirmationTier struct {
+	// MaxAmount is the largest deposit the tier covers, empty for no limit
+	MaxAmount string `mapstructure:"max_amount"`
+	// Credit is the confirmations before the deposit can be traded
+	Credit int `mapstructure:"credit"`
+	// Withdraw is the confirmations before it can be withdrawn
+	Withdraw int `mapstructure:"withdraw"`
+}
+
+// ConfirmationRequirement is a deposit's resolved thresholds
+type ConfirmationRequirement struct {
+	Credit   int
+	Withdraw int
+}
+
+type confirmationTier struct {
+	maxAmount *decimal.Decimal
+	ConfirmationRequirement
+}
+
+// ConfirmationPolicy resolves how many confirmations a deposit needs from
+// its currency, network and amount: small deposits are credited sooner,
+// large ones wait longer, and every deposit is tradable before it is
+// withdrawable
+type ConfirmationPolicy struct {
+	tiers map[string][]confirmationTier
+}
+
+// DefaultConfirmationTiers is used for anything not configured under
+// deposits.confirmations, keyed by currency then network
+var DefaultConfirmationTiers = map[string]map[string][]ConfirmationTier{
+	"BTC": {
+		"bitcoin": {
+			{MaxAmount: "0.1", Credit: 1, Withdraw: 3},
+			{MaxAmount: "1", Credit: 3, Withdraw: 6},
+			{MaxAmount: "10", Credit: 6, Withdraw: 6},
+			{Credit: 6, Withdraw: 12},
+		},
+	},
+	"ETH": {
+		"ethereum": {
+			{MaxAmount: "1", Credit: 6, Withdraw: 12},
+			{MaxAmount: "50", Credit: 12, Withdraw: 24},
+			{Credit: 24, Withdraw: 64},
+		},
+	},
+	"MATIC": {
+		"ethereum": {
+			{MaxAmount: "1000", Credit: 12, Withdraw: 24},
+			{Credit: 24, Withdraw: 64},
+		},
+	},
+	"USDC": {
+		"ethereum": {
+			{MaxAmount: "10000", Credit: 12, Withdraw: 24},
+			{Credit: 24, Withdraw: 64},
+		},
+	},
+	"USDT": {
+		"ethereum": {
+			{MaxAmount: "10000", Credit: 12, Withdraw: 24},
+			{Credit: 24, Withdraw: 64},
+		},
+	},
+}
+
+// NewConfirmationPolicy builds a policy from tiers keyed by currency then
+// network. Tiers must be in increasing MaxAmount order, end with an
+// unbounded tier, and never allow withdrawal before credit.
+func NewConfirmationPolicy(rules map[string]map[string][]ConfirmationTier) (*ConfirmationPolicy, error) {
+	p := &ConfirmationPolicy{tiers: make(map[string][]confirmationTier)}
+	for currency, networks := range rules {
+		for network, tiers := range networks {
+			resolved, err := resolveTiers(tiers)
+			if err != nil {
+				return nil, fmt.Errorf("%s on %s: %w", currency, network, err)
+			}
+			p.tiers[policyKey(currency, network)] = resolved
+		}
+	}
+	return p, nil
+}
+
+// DefaultConfirmationPolicy returns the policy for DefaultConfirmationTiers
+func DefaultConfirmationPolicy() *ConfirmationPolicy {
+	p, err := NewConfirmationPolicy(DefaultConfirmationTiers)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Merge returns a policy using overrides where set and p elsewhere
+func (p *ConfirmationPolicy) Merge(overrides *ConfirmationPolicy) *ConfirmationPolicy {
+	merged := &ConfirmationPolicy{tiers: make(map[string][]confirmationTier)}
+	for k, t := range p.tiers {
+		merged.tiers[k] = t
+	}
+	for k, t := range overrides.tiers {
+		merged.tiers[k] = t
+	}
+	return merged
+}
+
+// Resolve returns the thresholds for a deposit
+func (p *ConfirmationPolicy) Resolve(currency, network string, amount decimal.Decimal) (ConfirmationRequirement, error) {
+	tiers, ok := p.tiers[policyKey(currency, network)]
+	if !ok {
+		return ConfirmationRequirement{}, fmt.Errorf("%w: %s on %s", ErrNoConfirmationPolicy, currency, network)
+	}
+	for _, t := range tiers {
+		if t.maxAmount == nil || amount.LessThanOrEqual(*t.maxAmount) {
+			return t.ConfirmationRequirement, nil
+		}
+	}
+	// Unreachable: the last tier is unbounded
+	return tiers[len(tiers)-1].ConfirmationRequirement, nil
+}
+
+func resolveTiers(tiers []ConfirmationTier) ([]confirmationTier, error) {
+	if len(tiers) == 0 {
+		return nil, errors.New("no tiers")
+	}
+
+	resolved := make([]confirmationTier, len(tiers))
+	for i, t := range tiers {
+		if t.Credit < 1 {
+			return nil, fmt.Errorf("tier %d: credit confirmations must be at least 1", i)
+		}
+		if t.Withdraw < t.Credit {
+			return nil, fmt.Errorf("tier %d: withdraw confirmations below credit confirmations", i)
+		}
+		resolved[i].ConfirmationRequirement = ConfirmationRequirement{Credit: t.Credit, Withdraw: t.Withdraw}
+
+		last := i == len(tiers)-1
+		if t.MaxAmount == "" {
+			if !last {
+				return nil, fmt.Errorf("tier %d: only the last tier may be unbounded", i)
+			}
+			continue
+		}
+		if last {
+			return nil, errors.New("last tier must be unbounded")
+		}
+		max, err := decimal.NewFromString(t.MaxAmount)
+		if err != nil || !max.IsPositive() {
+			return nil, fmt.Errorf("tier %d: invalid max_amount %q", i, t.MaxAmount)
+		}
+		if i > 0 && !max.GreaterThan(*resolved[i-1].maxAmount) {
+			return nil, fmt.Errorf("tier %d: max_amount must increase", i)
+		}
+		resolved[i].maxAmount = &max
+	}
+	return resolved, nil
+}
+
+// Config keys are lowercased, so currency and network are normalised
+func policyKey(currency, network string) string {
+	return strings.ToUpper(currency) + ":" + strings.ToLower(network)
+}
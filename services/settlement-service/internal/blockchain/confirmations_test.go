@@ -0,0 +1,85 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+)
+
+func TestConfirmationPolicyResolve(t *testing.T) {
+	policy := DefaultConfirmationPolicy()
+
+	tests := []struct {
+		currency string
+		network  string
+		amount   string
+		want     ConfirmationRequirement
+	}{
+		{"BTC", "bitcoin", "0.01", ConfirmationRequirement{Credit: 1, Withdraw: 3}},
+		{"BTC", "bitcoin", "0.1", ConfirmationRequirement{Credit: 1, Withdraw: 3}},
+		{"BTC", "bitcoin", "0.10000001", ConfirmationRequirement{Credit: 3, Withdraw: 6}},
+		{"BTC", "bitcoin", "10", ConfirmationRequirement{Credit: 6, Withdraw: 6}},
+		{"BTC", "bitcoin", "250", ConfirmationRequirement{Credit: 6, Withdraw: 12}},
+		{"btc", "Bitcoin", "0.5", ConfirmationRequirement{Credit: 3, Withdraw: 6}},
+		{"ETH", "ethereum", "51", ConfirmationRequirement{Credit: 24, Withdraw: 64}},
+		{"MATIC", "ethereum", "1000", ConfirmationRequirement{Credit: 12, Withdraw: 24}},
+	}
+
+	for _, tt := range tests {
+		got, err := policy.Resolve(tt.currency, tt.network, decimal.RequireFromString(tt.amount))
+		if err != nil {
+			t.Errorf("Resolve(%s, %s, %s) error = %v", tt.currency, tt.network, tt.amount, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%s, %s, %s) = %+v, want %+v", tt.currency, tt.network, tt.amount, got, tt.want)
+		}
+	}
+
+	if _, err := policy.Resolve("BTC", "ethereum", decimal.NewFromInt(1)); !errors.Is(err, ErrNoConfirmationPolicy) {
+		t.Errorf("Resolve(BTC, ethereum) error = %v, want ErrNoConfirmationPolicy", err)
+	}
+}
+
+func TestConfirmationPolicyMerge(t *testing.T) {
+	overrides, err := NewConfirmationPolicy(map[string]map[string][]ConfirmationTier{
+		"btc": {"bitcoin": {{Credit: 2, Withdraw: 4}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := DefaultConfirmationPolicy().Merge(overrides)
+
+	got, _ := policy.Resolve("BTC", "bitcoin", decimal.NewFromInt(100))
+	if want := (ConfirmationRequirement{Credit: 2, Withdraw: 4}); got != want {
+		t.Errorf("overridden BTC = %+v, want %+v", got, want)
+	}
+	got, _ = policy.Resolve("ETH", "ethereum", decimal.NewFromInt(1))
+	if want := (ConfirmationRequirement{Credit: 6, Withdraw: 12}); got != want {
+		t.Errorf("default ETH = %+v, want %+v", got, want)
+	}
+}
+
+func TestNewConfirmationPolicyRejectsInvalidTiers(t *testing.T) {
+	tests := map[string][]ConfirmationTier{
+		"empty":                  {},
+		"zero credit":            {{Credit: 0, Withdraw: 1}},
+		"withdraw before credit": {{Credit: 3, Withdraw: 1}},
+		"bounded last tier":      {{MaxAmount: "1", Credit: 1, Withdraw: 1}},
+		"unbounded middle tier":  {{Credit: 1, Withdraw: 1}, {Credit: 2, Withdraw: 2}},
+		"bad amount":             {{MaxAmount: "lots", Credit: 1, Withdraw: 1}, {Credit: 2, Withdraw: 2}},
+		"decreasing amounts": {
+			{MaxAmount: "5", Credit: 1, Withdraw: 1},
+			{MaxAmount: "2", Credit: 2, Withdraw: 2},
+			{Credit: 3, Withdraw: 3},
+		},
+	}
+
+	for name, tiers := range tests {
+		_, err := NewConfirmationPolicy(map[string]map[string][]ConfirmationTier{"BTC": {"bitcoin": tiers}})
+		if err == nil {
+			t.Errorf("%s: NewConfirmationPolicy() succeeded, want error", name)
+		}
+	}
+}
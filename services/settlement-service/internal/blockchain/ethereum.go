@@ -2,21 +2,32 @@
 package blockchain
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
 )
 
-// EthereumClient handles Ethereum blockchain operations
-// TODO: Integrate github.com/ethereum/go-ethereum
+// EthereumClient talks to an Ethereum node over JSON-RPC
 type EthereumClient struct {
-	rpcURL  string
-	chainID int64
-	network string // "mainnet", "goerli", "sepolia"
-	logger  *zap.Logger
+	rpcURL       string
+	chainID      int64
+	network      string // "mainnet", "goerli", "sepolia"
+	pollInterval time.Duration
+	logger       *zap.Logger
+	httpClient   *http.Client
+	requestID    atomic.Uint64
 }
 
 // EthereumConfig holds Ethereum configuration
@@ -24,127 +35,475 @@ type EthereumConfig struct {
 	RPCURL  string
 	ChainID int64
 	Network string
+	// PollInterval is how often MonitorAddress looks for new blocks
+	PollInterval time.Duration
 }
 
-// NewEthereumClient creates a new Ethereum client
+// feeHistoryBlocks is how many recent blocks priority fees are sampled from
+const feeHistoryBlocks = 10
+
+// NewEthereumClient creates a new Ethereum JSON-RPC client
 func NewEthereumClient(config EthereumConfig, logger *zap.Logger) *EthereumClient {
+	if config.PollInterval <= 0 {
+		config.PollInterval = 15 * time.Second // Block time
+	}
 	return &EthereumClient{
-		rpcURL:  config.RPCURL,
-		chainID: config.ChainID,
-		network: config.Network,
-		logger:  logger,
+		rpcURL:       config.RPCURL,
+		chainID:      config.ChainID,
+		network:      config.Network,
+		pollInterval: config.PollInterval,
+		logger:       logger,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
 	}
 }
 
-// GetBalance returns the ETH balance for an address
-func (c *EthereumClient) GetBalance(address string) (*big.Int, error) {
-	// TODO: Implement with go-ethereum
-	// client.BalanceAt(ctx, common.HexToAddress(address), nil)
-	
-	c.logger.Debug("Getting Ethereum balance", zap.String("address", address))
-	
-	// Mock balance for now
-	balance := big.NewInt(1000000000000000000) // 1 ETH in wei
-	return balance, nil
+// ChainID returns the configured EIP-155 chain ID
+func (c *EthereumClient) ChainID() int64 {
+	return c.chainID
 }
 
-// GetTokenBalance returns ERC20 token balance
-func (c *EthereumClient) GetTokenBalance(address string, tokenContract string) (*big.Int, error) {
-	// TODO: Implement ERC20 balanceOf call
-	// Use ABI and call the balanceOf function
-	
-	c.logger.Debug("Getting token balance",
-		zap.String("address", address),
-		zap.String("token", tokenContract),
-	)
-	
-	return big.NewInt(0), nil
+// call makes a JSON-RPC 2.0 call and decodes the result into result. A
+// null result leaves result untouched.
+func (c *EthereumClient) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      c.requestID.Add(1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.rpcURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("RPC call failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var rpcResp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.Unmarshal(body, &rpcResp); err != nil {
+		return fmt.Errorf("failed to unmarshal %s response (HTTP %d): %w", method, resp.StatusCode, err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("RPC error: %w", rpcResp.Error)
+	}
+
+	if len(rpcResp.Result) == 0 || string(rpcResp.Result) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(rpcResp.Result, result); err != nil {
+		return fmt.Errorf("failed to unmarshal %s result: %w", method, err)
+	}
+	return nil
 }
 
-// GetTransactionReceipt gets transaction receipt
-func (c *EthereumClient) GetTransactionReceipt(txHash string) (map[string]interface{}, error) {
-	// TODO: Implement with go-ethereum
-	// client.TransactionReceipt(ctx, common.HexToHash(txHash))
-	
-	receipt := map[string]interface{}{
-		"transactionHash": txHash,
-		"status":          "1", // Success
-		"blockNumber":     "12345678",
-		"confirmations":   12,
+// parseQuantity decodes a hex-encoded JSON-RPC quantity such as "0x1a"
+func parseQuantity(s string) (*big.Int, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if digits == "" || len(digits) == len(s) {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	n, ok := new(big.Int).SetString(digits, 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	return n, nil
+}
+
+func parseUint64(s string) (uint64, error) {
+	n, err := parseQuantity(s)
+	if err != nil {
+		return 0, err
+	}
+	if !n.IsUint64() {
+		return 0, fmt.Errorf("quantity %q overflows uint64", s)
+	}
+	return n.Uint64(), nil
+}
+
+// encodeQuantity encodes n as a JSON-RPC quantity
+func encodeQuantity(n *big.Int) string {
+	return "0x" + n.Text(16)
+}
+
+// BlockNumber returns the number of the most recent block
+func (c *EthereumClient) BlockNumber(ctx context.Context) (uint64, error) {
+	var result string
+	if err := c.call(ctx, "eth_blockNumber", nil, &result); err != nil {
+		return 0, err
+	}
+	return parseUint64(result)
+}
+
+// GetBalance returns the ETH balance for an address in wei
+func (c *EthereumClient) GetBalance(ctx context.Context, address string) (*big.Int, error) {
+	var result string
+	if err := c.call(ctx, "eth_getBalance", []interface{}{address, "latest"}, &result); err != nil {
+		return nil, err
+	}
+	return parseQuantity(result)
+}
+
+// GetTransactionCount returns the number of transactions an address has
+// sent as of block ("latest" or "pending"), which is its next nonce
+func (c *EthereumClient) GetTransactionCount(ctx context.Context, address, block string) (uint64, error) {
+	var result string
+	if err := c.call(ctx, "eth_getTransactionCount", []interface{}{address, block}, &result); err != nil {
+		return 0, err
+	}
+	return parseUint64(result)
+}
+
+// HasTransaction reports whether the node knows a transaction, mined or in
+// its mempool
+func (c *EthereumClient) HasTransaction(ctx context.Context, txHash string) (bool, error) {
+	var tx *struct {
+		Hash string `json:"hash"`
+	}
+	if err := c.call(ctx, "eth_getTransactionByHash", []interface{}{txHash}, &tx); err != nil {
+		return false, err
+	}
+	return tx != nil, nil
+}
+
+// GetTokenBalance returns an address's balance of an ERC-20 token in the
+// token's smallest unit
+func (c *EthereumClient) GetTokenBalance(ctx context.Context, address, tokenContract string) (*big.Int, error) {
+	data, err := encodeBalanceOf(address)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.Call(ctx, CallMsg{To: tokenContract, Data: data}, "latest")
+	if err != nil {
+		return nil, err
+	}
+	if len(result) != 32 {
+		return nil, fmt.Errorf("unexpected balanceOf result of %d bytes from %s", len(result), tokenContract)
+	}
+	return new(big.Int).SetBytes(result), nil
+}
+
+// BlockHash returns the hash of the block at number on the node's chain
+func (c *EthereumClient) BlockHash(ctx context.Context, number uint64) (string, error) {
+	var block *struct {
+		Hash string `json:"hash"`
+	}
+	params := []interface{}{encodeQuantity(new(big.Int).SetUint64(number)), false}
+	if err := c.call(ctx, "eth_getBlockByNumber", params, &block); err != nil {
+		return "", err
+	}
+	if block == nil {
+		return "", fmt.Errorf("block %d not found", number)
+	}
+	return block.Hash, nil
+}
+
+// Receipt is the receipt of a mined transaction
+type Receipt struct {
+	TxHash      string
+	BlockHash   string
+	BlockNumber uint64
+	// Status is 1 for success and 0 for a reverted transaction
+	Status            uint64
+	GasUsed           uint64
+	EffectiveGasPrice *big.Int
+}
+
+// Confirmations counts the receipt's block and those above it up to tip
+func (r *Receipt) Confirmations(tip uint64) int {
+	if tip < r.BlockNumber {
+		// The node served the receipt before its head caught up
+		return 0
+	}
+	return int(tip-r.BlockNumber) + 1
+}
+
+// GetTransactionReceipt returns the receipt of a mined transaction, or
+// nil while the transaction is pending or unknown to the node
+func (c *EthereumClient) GetTransactionReceipt(ctx context.Context, txHash string) (*Receipt, error) {
+	var raw *struct {
+		TransactionHash   string `json:"transactionHash"`
+		BlockHash         string `json:"blockHash"`
+		BlockNumber       string `json:"blockNumber"`
+		Status            string `json:"status"`
+		GasUsed           string `json:"gasUsed"`
+		EffectiveGasPrice string `json:"effectiveGasPrice"`
+	}
+	if err := c.call(ctx, "eth_getTransactionReceipt", []interface{}{txHash}, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil || raw.BlockNumber == "" {
+		return nil, nil
+	}
+
+	receipt := &Receipt{TxHash: raw.TransactionHash, BlockHash: raw.BlockHash}
+	var err error
+	if receipt.BlockNumber, err = parseUint64(raw.BlockNumber); err != nil {
+		return nil, err
+	}
+	if receipt.Status, err = parseUint64(raw.Status); err != nil {
+		return nil, err
+	}
+	if receipt.GasUsed, err = parseUint64(raw.GasUsed); err != nil {
+		return nil, err
+	}
+	if raw.EffectiveGasPrice != "" {
+		if receipt.EffectiveGasPrice, err = parseQuantity(raw.EffectiveGasPrice); err != nil {
+			return nil, err
+		}
 	}
-	
 	return receipt, nil
 }
 
-// SendTransaction sends ETH to an address
-func (c *EthereumClient) SendTransaction(toAddress string, amount *big.Int, gasPrice *big.Int) (string, error) {
-	// TODO: Implement actual transaction sending
-	// 1. Create transaction
-	// 2. Sign with private key
-	// 3. Broadcast to network
-	
-	txHash := fmt.Sprintf("0x%s", generateRandomHash(64))
-	
-	c.logger.Info("Ethereum transaction sent",
-		zap.String("txhash", txHash),
-		zap.String("to", toAddress),
-		zap.String("amount", amount.String()),
-	)
-	
+// SendTransaction broadcasts a signed, RLP-encoded transaction and returns
+// its hash. Known rejections wrap ErrAlreadyKnown, ErrNonceTooLow,
+// ErrReplacementUnderpriced or ErrInsufficientGasFunds.
+func (c *EthereumClient) SendTransaction(ctx context.Context, signedTx []byte) (string, error) {
+	var txHash string
+	if err := c.call(ctx, "eth_sendRawTransaction", []interface{}{"0x" + hex.EncodeToString(signedTx)}, &txHash); err != nil {
+		return "", classifySendError(err)
+	}
+
+	c.logger.Info("Ethereum transaction sent", zap.String("txhash", txHash))
+
 	return txHash, nil
 }
 
-// SendTokenTransaction sends ERC20 tokens
-func (c *EthereumClient) SendTokenTransaction(tokenContract, toAddress string, amount *big.Int) (string, error) {
-	// TODO: Implement ERC20 transfer
-	// Use ABI to call transfer function
-	
-	txHash := fmt.Sprintf("0x%s", generateRandomHash(64))
-	
-	c.logger.Info("Token transaction sent",
-		zap.String("txhash", txHash),
-		zap.String("token", tokenContract),
-		zap.String("to", toAddress),
-	)
-	
-	return txHash, nil
+// Broadcast rejections worth telling apart. Nodes only report these in the
+// error message, so they are matched on geth's wording.
+var (
+	ErrAlreadyKnown           = errors.New("already known")
+	ErrNonceTooLow            = errors.New("nonce too low")
+	ErrReplacementUnderpriced = errors.New("replacement transaction underpriced")
+	ErrInsufficientGasFunds   = errors.New("insufficient funds for gas * price + value")
+)
+
+// classifySendError maps a node's rejection to one of the errors above,
+// keeping the RPC error in the chain
+func classifySendError(err error) error {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return err
+	}
+	message := strings.ToLower(rpcErr.Message)
+	for _, known := range []error{ErrAlreadyKnown, ErrNonceTooLow, ErrReplacementUnderpriced, ErrInsufficientGasFunds} {
+		if strings.Contains(message, known.Error()) {
+			return fmt.Errorf("%w: %w", known, err)
+		}
+	}
+	return err
 }
 
-// GetConfirmations returns number of confirmations for a transaction
-func (c *EthereumClient) GetConfirmations(txHash string) (int, error) {
-	// TODO: Implement with go-ethereum
-	// Get current block number
-	// Get transaction block number
-	// Return difference
-	
-	// Mock confirmations
-	return 15, nil
+// GetConfirmations returns the number of confirmations for a transaction,
+// counting its own block, or 0 while it is not mined
+func (c *EthereumClient) GetConfirmations(ctx context.Context, txHash string) (int, error) {
+	receipt, err := c.GetTransactionReceipt(ctx, txHash)
+	if err != nil || receipt == nil {
+		return 0, err
+	}
+	tip, err := c.BlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return receipt.Confirmations(tip), nil
 }
 
-// EstimateGas estimates gas for a transaction
-func (c *EthereumClient) EstimateGas(toAddress string, amount *big.Int) (uint64, error) {
-	// TODO: Implement with go-ethereum
-	// client.EstimateGas(ctx, ethereum.CallMsg{...})
-	
-	// Default gas limit for ETH transfer
-	return 21000, nil
+// CallMsg describes a transaction for gas estimation
+type CallMsg struct {
+	From  string
+	To    string
+	Value *big.Int
+	Data  []byte
 }
 
-// GetGasPrice gets current gas price
-func (c *EthereumClient) GetGasPrice() (*big.Int, error) {
-	// TODO: Implement with go-ethereum
-	// client.SuggestGasPrice(ctx)
-	
-	// Mock gas price (30 gwei)
-	gasPrice := big.NewInt(30000000000)
-	return gasPrice, nil
+// EstimateGas estimates the gas a transaction will use
+func (c *EthereumClient) EstimateGas(ctx context.Context, msg CallMsg) (uint64, error) {
+	var result string
+	if err := c.call(ctx, "eth_estimateGas", []interface{}{callArg(msg)}, &result); err != nil {
+		return 0, err
+	}
+	return parseUint64(result)
+}
+
+// Call executes msg against block without creating a transaction and
+// returns its output
+func (c *EthereumClient) Call(ctx context.Context, msg CallMsg, block string) ([]byte, error) {
+	var result string
+	if err := c.call(ctx, "eth_call", []interface{}{callArg(msg), block}, &result); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(strings.TrimPrefix(result, "0x"))
 }
 
-// ValidateAddress validates an Ethereum address
+func callArg(msg CallMsg) map[string]interface{} {
+	arg := map[string]interface{}{"to": msg.To}
+	if msg.From != "" {
+		arg["from"] = msg.From
+	}
+	if msg.Value != nil {
+		arg["value"] = encodeQuantity(msg.Value)
+	}
+	if len(msg.Data) > 0 {
+		arg["data"] = "0x" + hex.EncodeToString(msg.Data)
+	}
+	return arg
+}
+
+// Log is an event emitted by a contract
+type Log struct {
+	Address     string
+	Topics      []string
+	Data        []byte
+	BlockNumber uint64
+	BlockHash   string
+	TxHash      string
+	Index       uint64
+}
+
+// LogFilter selects the logs of blocks FromBlock to ToBlock inclusive
+// emitted by any of Addresses. Topics match by position, each position
+// matching any of its values; an empty position matches anything.
+type LogFilter struct {
+	FromBlock uint64
+	ToBlock   uint64
+	Addresses []string
+	Topics    [][]string
+}
+
+// GetLogs returns the logs matching q
+func (c *EthereumClient) GetLogs(ctx context.Context, q LogFilter) ([]Log, error) {
+	topics := make([]interface{}, len(q.Topics))
+	for i, t := range q.Topics {
+		if len(t) > 0 {
+			topics[i] = t
+		}
+	}
+	filter := map[string]interface{}{
+		"fromBlock": encodeQuantity(new(big.Int).SetUint64(q.FromBlock)),
+		"toBlock":   encodeQuantity(new(big.Int).SetUint64(q.ToBlock)),
+		"address":   q.Addresses,
+		"topics":    topics,
+	}
+
+	var raw []struct {
+		Address         string   `json:"address"`
+		Topics          []string `json:"topics"`
+		Data            string   `json:"data"`
+		BlockNumber     string   `json:"blockNumber"`
+		BlockHash       string   `json:"blockHash"`
+		TransactionHash string   `json:"transactionHash"`
+		LogIndex        string   `json:"logIndex"`
+		Removed         bool     `json:"removed"`
+	}
+	if err := c.call(ctx, "eth_getLogs", []interface{}{filter}, &raw); err != nil {
+		return nil, err
+	}
+
+	logs := make([]Log, 0, len(raw))
+	for _, r := range raw {
+		if r.Removed {
+			continue
+		}
+		l := Log{Address: r.Address, Topics: r.Topics, BlockHash: r.BlockHash, TxHash: r.TransactionHash}
+		var err error
+		if l.Data, err = hex.DecodeString(strings.TrimPrefix(r.Data, "0x")); err != nil {
+			return nil, fmt.Errorf("invalid log data: %w", err)
+		}
+		if l.BlockNumber, err = parseUint64(r.BlockNumber); err != nil {
+			return nil, err
+		}
+		if l.Index, err = parseUint64(r.LogIndex); err != nil {
+			return nil, err
+		}
+		logs = append(logs, l)
+	}
+	return logs, nil
+}
+
+// FeeSuggestion holds EIP-1559 fee parameters in wei per gas
+type FeeSuggestion struct {
+	// BaseFee is the base fee of the next block
+	BaseFee *big.Int
+	// PriorityFee is the median tip paid in recent blocks
+	PriorityFee *big.Int
+	// MaxFeePerGas leaves room for the base fee to double
+	MaxFeePerGas *big.Int
+}
+
+// SuggestFees derives fees from eth_feeHistory over recent blocks
+func (c *EthereumClient) SuggestFees(ctx context.Context) (*FeeSuggestion, error) {
+	var history struct {
+		BaseFeePerGas []string   `json:"baseFeePerGas"`
+		Reward        [][]string `json:"reward"`
+	}
+	params := []interface{}{encodeQuantity(big.NewInt(feeHistoryBlocks)), "latest", []int{50}}
+	if err := c.call(ctx, "eth_feeHistory", params, &history); err != nil {
+		return nil, err
+	}
+	if len(history.BaseFeePerGas) == 0 {
+		return nil, errors.New("fee history has no base fees")
+	}
+
+	// The last base fee is for the block after the newest in the range
+	baseFee, err := parseQuantity(history.BaseFeePerGas[len(history.BaseFeePerGas)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	tips := make([]*big.Int, 0, len(history.Reward))
+	for _, reward := range history.Reward {
+		if len(reward) == 0 {
+			continue
+		}
+		tip, err := parseQuantity(reward[0])
+		if err != nil {
+			return nil, err
+		}
+		tips = append(tips, tip)
+	}
+	priorityFee := new(big.Int)
+	if len(tips) > 0 {
+		sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+		priorityFee = tips[len(tips)/2]
+	}
+
+	maxFee := new(big.Int).Mul(baseFee, big.NewInt(2))
+	maxFee.Add(maxFee, priorityFee)
+	return &FeeSuggestion{BaseFee: baseFee, PriorityFee: priorityFee, MaxFeePerGas: maxFee}, nil
+}
+
+// GetGasPrice returns the price per gas a transaction included in the next
+// block is expected to pay: its base fee plus the suggested tip
+func (c *EthereumClient) GetGasPrice(ctx context.Context) (*big.Int, error) {
+	fees, err := c.SuggestFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Add(fees.BaseFee, fees.PriorityFee), nil
+}
+
+// ValidateAddress checks an address is 0x followed by 40 hex digits
 func (c *EthereumClient) ValidateAddress(address string) bool {
-	// TODO: Implement proper validation
-	// Check if it's a valid hex string with 0x prefix and 40 chars
-	
 	if len(address) != 42 {
 		return false
 	}
@@ -153,20 +512,21 @@ func (c *EthereumClient) ValidateAddress(address string) bool {
 		return false
 	}
 	
-	return true
+	_, err := hex.DecodeString(address[2:])
+	return err == nil
 }
 
-// MonitorAddress monitors an address for incoming transactions
+// MonitorAddress polls for new blocks and calls callback for every
+// transaction in them sending ETH to address, starting from the current tip
 func (c *EthereumClient) MonitorAddress(ctx context.Context, address string, callback func(txHash string, amount *big.Int)) error {
-	// TODO: Implement WebSocket subscription or polling
-	// Subscribe to new blocks
-	// Check transactions in each block
-	// Call callback for matching address
-	
 	c.logger.Info("Monitoring Ethereum address", zap.String("address", address))
 	
-	// Mock monitoring (would be replaced with actual implementation)
-	ticker := time.NewTicker(15 * time.Second) // Block time
+	last, err := c.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	
+	ticker := time.NewTicker(c.pollInterval)
 	defer ticker.Stop()
 	
 	for {
@@ -174,11 +534,54 @@ func (c *EthereumClient) MonitorAddress(ctx context.Context, address string, cal
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-ticker.C:
-			// Check for new transactions (mock)
-			c.logger.Debug("Checking for new transactions", zap.String("address", address))
+			tip, err := c.BlockNumber(ctx)
+			if err != nil {
+				c.logger.Warn("Failed to get Ethereum block number", zap.Error(err))
+				continue
+			}
+			for ; last < tip; last++ {
+				if err := c.scanBlockForAddress(ctx, last+1, address, callback); err != nil {
+					c.logger.Warn("Failed to scan Ethereum block",
+						zap.Uint64("block", last+1),
+						zap.Error(err),
+					)
+					break
+				}
+			}
 		}
 	}
 }
 
+// scanBlockForAddress calls callback for each transaction in a block that
+// sends value to address
+func (c *EthereumClient) scanBlockForAddress(ctx context.Context, number uint64, address string, callback func(txHash string, amount *big.Int)) error {
+	var block *struct {
+		Transactions []struct {
+			Hash  string  `json:"hash"`
+			To    *string `json:"to"`
+			Value string  `json:"value"`
+		} `json:"transactions"`
+	}
+	params := []interface{}{encodeQuantity(new(big.Int).SetUint64(number)), true}
+	if err := c.call(ctx, "eth_getBlockByNumber", params, &block); err != nil {
+		return err
+	}
+	if block == nil {
+		return fmt.Errorf("block %d not found", number)
+	}
 
-
+	for _, tx := range block.Transactions {
+		// Contract creations have no recipient
+		if tx.To == nil || !strings.EqualFold(*tx.To, address) {
+			continue
+		}
+		value, err := parseQuantity(tx.Value)
+		if err != nil {
+			return err
+		}
+		if value.Sign() > 0 {
+			callback(tx.Hash, value)
+		}
+	}
+	return nil
+}
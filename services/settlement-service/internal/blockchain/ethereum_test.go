@@ -0,0 +1,170 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+const ethAddress = "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"
+
+func TestEthereumClientBalance(t *testing.T) {
+	node := newFakeEthNode(t, 100)
+	wei, _ := new(big.Int).SetString("123456789012345678901", 10)
+	node.balances[strings.ToLower(ethAddress)] = wei
+
+	got, err := node.client().GetBalance(context.Background(), ethAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Cmp(wei) != 0 {
+		t.Errorf("GetBalance() = %s, want %s", got, wei)
+	}
+}
+
+func TestEthereumClientReceipts(t *testing.T) {
+	node := newFakeEthNode(t, 100)
+	client := node.client()
+	ctx := context.Background()
+
+	// Pending transactions have no receipt and no confirmations
+	receipt, err := client.GetTransactionReceipt(ctx, "0x01")
+	if err != nil || receipt != nil {
+		t.Fatalf("GetTransactionReceipt(pending) = %v, %v, want nil", receipt, err)
+	}
+	confirmations, err := client.GetConfirmations(ctx, "0x01")
+	if err != nil || confirmations != 0 {
+		t.Fatalf("GetConfirmations(pending) = %d, %v, want 0", confirmations, err)
+	}
+
+	node.include("0x01", 95, "0x1")
+	node.include("0x02", 100, "0x0")
+
+	receipt, err = client.GetTransactionReceipt(ctx, "0x01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.BlockNumber != 95 || receipt.Status != 1 || receipt.GasUsed != 21000 || receipt.EffectiveGasPrice.Int64() != 1e9 {
+		t.Errorf("receipt = %+v", receipt)
+	}
+	if confirmations, _ := client.GetConfirmations(ctx, "0x01"); confirmations != 6 {
+		t.Errorf("GetConfirmations() = %d, want 6", confirmations)
+	}
+
+	reverted, err := client.GetTransactionReceipt(ctx, "0x02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reverted.Status != 0 || reverted.Confirmations(100) != 1 {
+		t.Errorf("reverted receipt = %+v", reverted)
+	}
+}
+
+func TestEthereumClientFees(t *testing.T) {
+	node := newFakeEthNode(t, 100)
+	node.baseFees = []string{"0x3b9aca00", "0x4a817c800", "0x5d21dba00"} // 1, 20, 25 gwei
+	node.rewards = [][]string{{"0x77359400"}, {"0x3b9aca00"}}            // 2, 1 gwei
+	client := node.client()
+
+	fees, err := client.SuggestFees(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The next block's base fee, the median tip and room for the base fee to double
+	if fees.BaseFee.Int64() != 25e9 || fees.PriorityFee.Int64() != 2e9 || fees.MaxFeePerGas.Int64() != 52e9 {
+		t.Errorf("SuggestFees() = %s/%s/%s", fees.BaseFee, fees.PriorityFee, fees.MaxFeePerGas)
+	}
+
+	price, err := client.GetGasPrice(context.Background())
+	if err != nil || price.Int64() != 27e9 {
+		t.Errorf("GetGasPrice() = %v, %v, want 27 gwei", price, err)
+	}
+
+	gas, err := client.EstimateGas(context.Background(), CallMsg{To: ethAddress, Value: big.NewInt(1)})
+	if err != nil || gas != 21000 {
+		t.Errorf("EstimateGas() = %d, %v, want 21000", gas, err)
+	}
+}
+
+func TestEthereumClientSendTransaction(t *testing.T) {
+	node := newFakeEthNode(t, 100)
+	client := node.client()
+
+	hash, err := client.SendTransaction(context.Background(), []byte{0x02, 0xf8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != "0x"+strings.Repeat("ab", 32) || len(node.sent) != 1 || node.sent[0] != "0x02f8" {
+		t.Errorf("SendTransaction() = %s, sent %v", hash, node.sent)
+	}
+
+	node.reject = &RPCError{Code: -32000, Message: "nonce too low"}
+	_, err = client.SendTransaction(context.Background(), []byte{0x02})
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Message != "nonce too low" {
+		t.Errorf("SendTransaction() error = %v, want the node's RPC error", err)
+	}
+}
+
+func TestEthereumClientHonoursContext(t *testing.T) {
+	node := newFakeEthNode(t, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := node.client().BlockNumber(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("BlockNumber() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestMonitorAddress(t *testing.T) {
+	node := newFakeEthNode(t, 100)
+	client := node.client()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	to, other := strings.ToLower(ethAddress), "0x0000000000000000000000000000000000000001"
+	found := make(chan string, 4)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.MonitorAddress(ctx, ethAddress, func(txHash string, amount *big.Int) {
+			found <- txHash + "/" + amount.String()
+		})
+	}()
+
+	// Wait for the monitor to read the tip before mining past it
+	for {
+		node.mu.Lock()
+		started := len(node.requests) > 0
+		node.mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	node.mine(fakeEthTx{Hash: "0xa1", To: &to, Value: "0x64"}, fakeEthTx{Hash: "0xa2", To: &other, Value: "0x1"})
+	node.mine(fakeEthTx{Hash: "0xa3", Value: "0x1"}, fakeEthTx{Hash: "0xa4", To: &to, Value: "0x0"})
+	node.mine(fakeEthTx{Hash: "0xa5", To: &to, Value: "0x2"})
+
+	for _, want := range []string{"0xa1/100", "0xa5/2"} {
+		select {
+		case got := <-found:
+			if got != want {
+				t.Errorf("callback = %s, want %s", got, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("MonitorAddress() = %v, want context.Canceled", err)
+	}
+	select {
+	case got := <-found:
+		t.Errorf("unexpected callback %s", got)
+	default:
+	}
+}
@@ -0,0 +1,153 @@
+// BitCurrent Exchange - Ethereum Transaction Signing
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+// dynamicFeeTxType is the EIP-2718 type byte of EIP-1559 transactions
+const dynamicFeeTxType = 0x02
+
+// ErrSignerMismatch means a signature does not recover to the signer's
+// address
+var ErrSignerMismatch = errors.New("signature does not match the signer's address")
+
+// DynamicFeeTx is an EIP-1559 (type 2) transaction. Fees are in wei per
+// gas; the sender pays the block's base fee plus up to GasTipCap, never
+// more than GasFeeCap in total.
+type DynamicFeeTx struct {
+	ChainID   *big.Int
+	Nonce     uint64
+	GasTipCap *big.Int
+	GasFeeCap *big.Int
+	Gas       uint64
+	To        string
+	Value     *big.Int
+	Data      []byte
+}
+
+// EthereumSigner signs for an Ethereum account. The key may be held in
+// memory or behind an HSM or remote signing service.
+type EthereumSigner interface {
+	// Address returns the account's address
+	Address() string
+	// SignHash signs a 32-byte hash, returning [R || S || V] with V the
+	// recovery id, 0 or 1
+	SignHash(ctx context.Context, hash []byte) ([]byte, error)
+}
+
+// fields returns the RLP-encoded unsigned fields, with an empty access list
+func (tx *DynamicFeeTx) fields() ([][]byte, error) {
+	to, err := decodeAddress(tx.To)
+	if err != nil {
+		return nil, err
+	}
+	if tx.ChainID == nil || tx.ChainID.Sign() <= 0 {
+		return nil, errors.New("transaction has no chain ID")
+	}
+	return [][]byte{
+		rlpBig(tx.ChainID),
+		rlpUint(tx.Nonce),
+		rlpBig(tx.GasTipCap),
+		rlpBig(tx.GasFeeCap),
+		rlpUint(tx.Gas),
+		rlpBytes(to),
+		rlpBig(tx.Value),
+		rlpBytes(tx.Data),
+		rlpList(),
+	}, nil
+}
+
+// SigningHash returns the hash the sender signs
+func (tx *DynamicFeeTx) SigningHash() ([]byte, error) {
+	fields, err := tx.fields()
+	if err != nil {
+		return nil, err
+	}
+	return keccak256(append([]byte{dynamicFeeTxType}, rlpList(fields...)...)), nil
+}
+
+// EncodeSigned returns the raw transaction for eth_sendRawTransaction given
+// an [R || S || V] signature
+func (tx *DynamicFeeTx) EncodeSigned(sig []byte) ([]byte, error) {
+	if len(sig) != 65 || sig[64] > 1 {
+		return nil, errors.New("invalid signature")
+	}
+	fields, err := tx.fields()
+	if err != nil {
+		return nil, err
+	}
+	fields = append(fields,
+		rlpUint(uint64(sig[64])),
+		rlpBig(new(big.Int).SetBytes(sig[:32])),
+		rlpBig(new(big.Int).SetBytes(sig[32:64])),
+	)
+	return append([]byte{dynamicFeeTxType}, rlpList(fields...)...), nil
+}
+
+// SignTransaction signs tx, checking the signature recovers to the
+// signer's address, and returns the raw transaction and its hash
+func SignTransaction(ctx context.Context, signer EthereumSigner, tx *DynamicFeeTx) ([]byte, string, error) {
+	hash, err := tx.SigningHash()
+	if err != nil {
+		return nil, "", err
+	}
+	sig, err := signer.SignHash(ctx, hash)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	if len(sig) != 65 || sig[64] > 1 {
+		return nil, "", errors.New("signer returned an invalid signature")
+	}
+
+	// RecoverCompact takes [27 + V || R || S]
+	compact := append([]byte{27 + sig[64]}, sig[:64]...)
+	pub, _, err := ecdsa.RecoverCompact(compact, hash)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrSignerMismatch, err)
+	}
+	want, err := decodeAddress(signer.Address())
+	if err != nil {
+		return nil, "", err
+	}
+	if !bytes.Equal(keccak256(pub.SerializeUncompressed()[1:])[12:], want) {
+		return nil, "", ErrSignerMismatch
+	}
+
+	raw, err := tx.EncodeSigned(sig)
+	if err != nil {
+		return nil, "", err
+	}
+	return raw, TransactionHash(raw), nil
+}
+
+// TransactionHash returns the hash of a raw transaction
+func TransactionHash(raw []byte) string {
+	return "0x" + hex.EncodeToString(keccak256(raw))
+}
+
+// decodeAddress decodes a 0x-prefixed 20-byte address
+func decodeAddress(address string) ([]byte, error) {
+	if len(address) != 42 || address[:2] != "0x" {
+		return nil, fmt.Errorf("invalid Ethereum address %q", address)
+	}
+	b, err := hex.DecodeString(address[2:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Ethereum address %q", address)
+	}
+	return b, nil
+}
+
+func keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
+)
+
+func TestRLP(t *testing.T) {
+	long := strings.Repeat("a", 56)
+	tests := map[string]struct {
+		got  []byte
+		want string
+	}{
+		"empty string": {rlpBytes(nil), "80"},
+		"single byte":  {rlpBytes([]byte{0x0f}), "0f"},
+		"dog":          {rlpBytes([]byte("dog")), "83646f67"},
+		"long string":  {rlpBytes([]byte(long)), "b838" + hex.EncodeToString([]byte(long))},
+		"zero":         {rlpUint(0), "80"},
+		"1024":         {rlpUint(1024), "820400"},
+		"empty list":   {rlpList(), "c0"},
+		"cat dog":      {rlpList(rlpBytes([]byte("cat")), rlpBytes([]byte("dog"))), "c88363617483646f67"},
+		// [ [], [[]], [ [], [[]] ] ]
+		"set theory": {rlpList(rlpList(), rlpList(rlpList()), rlpList(rlpList(), rlpList(rlpList()))), "c7c0c1c0c3c0c1c0"},
+	}
+	for name, tt := range tests {
+		if got := hex.EncodeToString(tt.got); got != tt.want {
+			t.Errorf("%s: %s, want %s", name, got, tt.want)
+		}
+	}
+}
+
+// badSigner claims one address and signs with the key of another
+type badSigner struct{ *wallet.EthereumKeySigner }
+
+func (badSigner) Address() string { return ethAddress }
+
+func TestSignTransaction(t *testing.T) {
+	// The EIP-155 example key
+	signer, err := wallet.NewEthereumKeySigner(strings.Repeat("46", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := &DynamicFeeTx{
+		ChainID:   big.NewInt(1),
+		Nonce:     9,
+		GasTipCap: big.NewInt(2e9),
+		GasFeeCap: big.NewInt(52e9),
+		Gas:       21000,
+		To:        "0x3535353535353535353535353535353535353535",
+		Value:     big.NewInt(1e18),
+	}
+
+	raw, hash, err := SignTransaction(context.Background(), signer, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Type 2, then a list of 12 fields ending in V, R and S
+	if raw[0] != 0x02 || raw[1] < 0xf7 {
+		t.Fatalf("raw transaction %x is not a typed list", raw)
+	}
+	if hash != TransactionHash(raw) || len(hash) != 66 {
+		t.Errorf("hash = %s", hash)
+	}
+	unsigned, _ := tx.SigningHash()
+	if bytes.Contains(raw, unsigned) {
+		t.Error("raw transaction contains its signing hash")
+	}
+
+	// Signing is deterministic (RFC 6979)
+	again, _, err := SignTransaction(context.Background(), signer, tx)
+	if err != nil || !bytes.Equal(raw, again) {
+		t.Error("signing the same transaction twice gave different results")
+	}
+
+	// Any field change changes what is signed
+	tx.Nonce++
+	changed, _ := tx.SigningHash()
+	if bytes.Equal(unsigned, changed) {
+		t.Error("nonce is not covered by the signing hash")
+	}
+
+	if _, _, err := SignTransaction(context.Background(), badSigner{signer}, tx); !errors.Is(err, ErrSignerMismatch) {
+		t.Errorf("SignTransaction(wrong key) error = %v, want ErrSignerMismatch", err)
+	}
+	tx.To = "0x35"
+	if _, _, err := SignTransaction(context.Background(), signer, tx); err == nil {
+		t.Error("SignTransaction accepted an invalid recipient")
+	}
+}
@@ -0,0 +1,234 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeEthTx is a transaction in a fakeEthNode block
+type fakeEthTx struct {
+	Hash  string  `json:"hash"`
+	To    *string `json:"to"`
+	Value string  `json:"value"`
+}
+
+// fakeEthLog is a log in a fakeEthNode block
+type fakeEthLog struct {
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	BlockNumber     string   `json:"blockNumber"`
+	BlockHash       string   `json:"blockHash"`
+	TransactionHash string   `json:"transactionHash"`
+	LogIndex        string   `json:"logIndex"`
+}
+
+// fakeEthNode is an Ethereum JSON-RPC stand-in serving balances, receipts,
+// blocks, logs and fee history from memory, and recording raw transactions
+// sent
+type fakeEthNode struct {
+	mu       sync.Mutex
+	height   uint64
+	balances map[string]*big.Int
+	receipts map[string]map[string]string
+	blocks   map[uint64][]fakeEthTx
+	logs     []fakeEthLog
+	// tokenBalances are keyed by lowercase contract then owner
+	tokenBalances map[string]map[string]*big.Int
+	// baseFees and rewards are returned by eth_feeHistory
+	baseFees []string
+	rewards  [][]string
+	gas      uint64
+	sent     []string
+	reject   *RPCError
+	requests []string
+	server   *httptest.Server
+}
+
+func newFakeEthNode(t *testing.T, height uint64) *fakeEthNode {
+	n := &fakeEthNode{
+		height:   height,
+		balances: make(map[string]*big.Int),
+		receipts: make(map[string]map[string]string),
+		blocks:   make(map[uint64][]fakeEthTx),
+		gas:      21000,
+
+		tokenBalances: make(map[string]map[string]*big.Int),
+	}
+	n.server = httptest.NewServer(http.HandlerFunc(n.serve))
+	t.Cleanup(n.server.Close)
+	return n
+}
+
+func (n *fakeEthNode) client() *EthereumClient {
+	return NewEthereumClient(EthereumConfig{
+		RPCURL:       n.server.URL,
+		ChainID:      1337,
+		Network:      "regtest",
+		PollInterval: 10 * time.Millisecond,
+	}, zap.NewNop())
+}
+
+// mine advances the chain by one block holding txs
+func (n *fakeEthNode) mine(txs ...fakeEthTx) uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.height++
+	n.blocks[n.height] = txs
+	return n.height
+}
+
+// include records a receipt for txHash in block number
+func (n *fakeEthNode) include(txHash string, number uint64, status string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.receipts[strings.ToLower(txHash)] = map[string]string{
+		"transactionHash":   txHash,
+		"blockHash":         "0xb10c",
+		"blockNumber":       encodeQuantity(new(big.Int).SetUint64(number)),
+		"status":            status,
+		"gasUsed":           "0x5208",
+		"effectiveGasPrice": "0x3b9aca00",
+	}
+}
+
+// fakeBlockHash is the hash of the block at number
+func fakeBlockHash(number uint64) string {
+	return fmt.Sprintf("0x%064x", number)
+}
+
+// emit adds a log of an ERC-20 Transfer of amount from contract to the
+// current block, returning its transaction hash
+func (n *fakeEthNode) emit(contract, from, to string, amount int64) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	index := len(n.logs)
+	txHash := fmt.Sprintf("0x%064x", 0xdead0000+index)
+	n.logs = append(n.logs, fakeEthLog{
+		Address:         contract,
+		Topics:          []string{transferTopic, addressTopic(from), addressTopic(to)},
+		Data:            fmt.Sprintf("0x%064x", amount),
+		BlockNumber:     encodeQuantity(new(big.Int).SetUint64(n.height)),
+		BlockHash:       fakeBlockHash(n.height),
+		TransactionHash: txHash,
+		LogIndex:        encodeQuantity(big.NewInt(int64(index))),
+	})
+	return txHash
+}
+
+func addressTopic(address string) string {
+	return "0x" + strings.Repeat("0", 24) + strings.ToLower(strings.TrimPrefix(address, "0x"))
+}
+
+func (n *fakeEthNode) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+		ID     json.RawMessage   `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.requests = append(n.requests, req.Method)
+
+	param := func(i int) string {
+		var s string
+		if i < len(req.Params) {
+			json.Unmarshal(req.Params[i], &s)
+		}
+		return s
+	}
+
+	var result interface{}
+	var rpcErr *RPCError
+	switch req.Method {
+	case "eth_blockNumber":
+		result = encodeQuantity(new(big.Int).SetUint64(n.height))
+	case "eth_getBalance":
+		balance, ok := n.balances[strings.ToLower(param(0))]
+		if !ok {
+			balance = new(big.Int)
+		}
+		result = encodeQuantity(balance)
+	case "eth_getTransactionReceipt":
+		// Unknown and pending transactions have a null receipt
+		if receipt, ok := n.receipts[strings.ToLower(param(0))]; ok {
+			result = receipt
+		}
+	case "eth_getBlockByNumber":
+		number, err := parseUint64(param(0))
+		if err != nil || number > n.height {
+			break
+		}
+		txs := n.blocks[number]
+		if txs == nil {
+			txs = []fakeEthTx{}
+		}
+		result = map[string]interface{}{"number": param(0), "hash": fakeBlockHash(number), "transactions": txs}
+	case "eth_getLogs":
+		var filter struct {
+			FromBlock string     `json:"fromBlock"`
+			ToBlock   string     `json:"toBlock"`
+			Address   []string   `json:"address"`
+			Topics    [][]string `json:"topics"`
+		}
+		json.Unmarshal(req.Params[0], &filter)
+		from, _ := parseUint64(filter.FromBlock)
+		to, _ := parseUint64(filter.ToBlock)
+		logs := []fakeEthLog{}
+		for _, l := range n.logs {
+			number, _ := parseUint64(l.BlockNumber)
+			if number < from || number > to || l.Topics[0] != filter.Topics[0][0] {
+				continue
+			}
+			for _, a := range filter.Address {
+				if strings.EqualFold(a, l.Address) {
+					logs = append(logs, l)
+				}
+			}
+		}
+		result = logs
+	case "eth_call":
+		var call struct {
+			To   string `json:"to"`
+			Data string `json:"data"`
+		}
+		json.Unmarshal(req.Params[0], &call)
+		// balanceOf: the selector then the owner as the last 20 bytes
+		owner := "0x" + call.Data[len(call.Data)-40:]
+		balance, ok := n.tokenBalances[strings.ToLower(call.To)][owner]
+		if !ok {
+			balance = new(big.Int)
+		}
+		result = fmt.Sprintf("0x%064x", balance)
+	case "eth_feeHistory":
+		result = map[string]interface{}{"baseFeePerGas": n.baseFees, "reward": n.rewards}
+	case "eth_estimateGas":
+		result = encodeQuantity(new(big.Int).SetUint64(n.gas))
+	case "eth_sendRawTransaction":
+		if n.reject != nil {
+			rpcErr = n.reject
+			break
+		}
+		n.sent = append(n.sent, param(0))
+		result = "0x" + strings.Repeat("ab", 32)
+	default:
+		rpcErr = &RPCError{Code: -32601, Message: "the method " + req.Method + " does not exist/is not available"}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result, "error": rpcErr})
+}
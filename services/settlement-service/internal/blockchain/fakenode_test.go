@@ -0,0 +1,145 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// fakeNode is a Bitcoin Core JSON-RPC stand-in serving getblockcount,
+// getblockhash and getblock from an in-memory chain that can be forked.
+// Blocks on abandoned branches stay retrievable by hash, as in bitcoind.
+// Only verbosity 2 blocks, with decoded transactions, are served.
+type fakeNode struct {
+	mu     sync.Mutex
+	chain  []*Block
+	blocks map[string]*Block
+	served []int64 // heights of blocks returned by getblock
+	server *httptest.Server
+}
+
+// newFakeNode starts a node with blocks 0..height on branch "a"
+func newFakeNode(t *testing.T, height int64) *fakeNode {
+	n := &fakeNode{blocks: make(map[string]*Block)}
+	for h := int64(0); h <= height; h++ {
+		n.mine("a")
+	}
+	n.server = httptest.NewServer(http.HandlerFunc(n.serve))
+	t.Cleanup(n.server.Close)
+	return n
+}
+
+func (n *fakeNode) client() *BitcoinClient {
+	return NewBitcoinClient(BitcoinConfig{RPCURL: n.server.URL, Network: "regtest"}, zap.NewNop())
+}
+
+// mine appends a block to the active chain
+func (n *fakeNode) mine(branch string) *Block {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	height := int64(len(n.chain))
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", branch, height)))
+	block := &Block{Hash: hex.EncodeToString(sum[:]), Height: height}
+	if height > 0 {
+		block.PreviousBlockHash = n.chain[height-1].Hash
+	}
+	n.chain = append(n.chain, block)
+	n.blocks[block.Hash] = block
+	return block
+}
+
+// fork abandons every block above height and mines length blocks on a new
+// branch in their place
+func (n *fakeNode) fork(height int64, branch string, length int) {
+	n.mu.Lock()
+	n.chain = n.chain[:height+1]
+	n.mu.Unlock()
+
+	for i := 0; i < length; i++ {
+		n.mine(branch)
+	}
+}
+
+// pay adds a transaction paying address to the active block at height
+func (n *fakeNode) pay(height int64, txid, address, value string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	out := TxOutput{Value: json.Number(value)}
+	out.ScriptPubKey.Address = address
+	block := n.chain[height]
+	block.Tx = append(block.Tx, BlockTx{TxID: txid, Vout: []TxOutput{out}})
+}
+
+func (n *fakeNode) hashAt(height int64) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.chain[height].Hash
+}
+
+// servedHeights returns the heights of blocks fetched so far
+func (n *fakeNode) servedHeights() []int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]int64(nil), n.served...)
+}
+
+func (n *fakeNode) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var result interface{}
+	var rpcErr *RPCError
+	switch req.Method {
+	case "getblockcount":
+		result = len(n.chain) - 1
+	case "getblockhash":
+		var height int64
+		json.Unmarshal(req.Params[0], &height)
+		if height < 0 || height >= int64(len(n.chain)) {
+			rpcErr = &RPCError{Code: -8, Message: "Block height out of range"}
+			break
+		}
+		result = n.chain[height].Hash
+	case "getblock":
+		var hash string
+		var verbosity int
+		json.Unmarshal(req.Params[0], &hash)
+		if len(req.Params) > 1 {
+			json.Unmarshal(req.Params[1], &verbosity)
+		}
+		block, ok := n.blocks[hash]
+		if !ok {
+			rpcErr = &RPCError{Code: -5, Message: "Block not found"}
+			break
+		}
+		if verbosity != 2 {
+			rpcErr = &RPCError{Code: -8, Message: "fake node only serves verbosity 2 blocks"}
+			break
+		}
+		n.served = append(n.served, block.Height)
+		result = block
+	default:
+		rpcErr = &RPCError{Code: -32601, Message: "Method not found"}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "error": rpcErr, "id": "1"})
+}
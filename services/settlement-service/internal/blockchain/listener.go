@@ -3,18 +3,28 @@ package blockchain
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 )
 
+const networkBitcoin = "bitcoin"
+
 // DepositListener monitors blockchain for incoming deposits
 type DepositListener struct {
 	btcClient *BitcoinClient
 	ethClient *EthereumClient
+	tokens    *TokenRegistry
+	watchList *WatchList
+	policy    *ConfirmationPolicy
 	db        *database.PostgresDB
 	logger    *zap.Logger
 }
@@ -23,12 +33,18 @@ type DepositListener struct {
 func NewDepositListener(
 	btcClient *BitcoinClient,
 	ethClient *EthereumClient,
+	tokens *TokenRegistry,
+	watchList *WatchList,
+	policy *ConfirmationPolicy,
 	db *database.PostgresDB,
 	logger *zap.Logger,
 ) *DepositListener {
 	return &DepositListener{
 		btcClient: btcClient,
 		ethClient: ethClient,
+		tokens:    tokens,
+		watchList: watchList,
+		policy:    policy,
 		db:        db,
 		logger:    logger,
 	}
@@ -48,6 +64,9 @@ func (l *DepositListener) StartBitcoinListener(ctx context.Context) error {
 			return ctx.Err()
 			
 		case <-ticker.C:
+			if err := l.scanBitcoinBlocks(ctx); err != nil {
+				l.logger.Error("Failed to scan Bitcoin blocks", zap.Error(err))
+			}
 			if err := l.checkBitcoinDeposits(ctx); err != nil {
 				l.logger.Error("Failed to check Bitcoin deposits", zap.Error(err))
 			}
@@ -69,6 +88,9 @@ func (l *DepositListener) StartEthereumListener(ctx context.Context) error {
 			return ctx.Err()
 			
 		case <-ticker.C:
+			if err := l.scanTokenTransfers(ctx); err != nil {
+				l.logger.Error("Failed to scan token transfers", zap.Error(err))
+			}
 			if err := l.checkEthereumDeposits(ctx); err != nil {
 				l.logger.Error("Failed to check Ethereum deposits", zap.Error(err))
 			}
@@ -76,14 +98,255 @@ func (l *DepositListener) StartEthereumListener(ctx context.Context) error {
 	}
 }
 
+// scanBitcoinBlocks scans every block since the last scanned height for
+// outputs paying watched addresses, after rewinding past any reorg. A
+// listener with no saved height starts at the current tip.
+func (l *DepositListener) scanBitcoinBlocks(ctx context.Context) error {
+	if err := l.checkBitcoinReorg(ctx); err != nil {
+		return err
+	}
+
+	tip, err := l.btcClient.GetBlockHeight()
+	if err != nil {
+		return err
+	}
+
+	last, err := l.lastScannedHeight(ctx, networkBitcoin)
+	if err != nil {
+		return err
+	}
+	if last < 0 {
+		last = tip - 1
+	}
+
+	for height := last + 1; height <= tip; height++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		hash, err := l.btcClient.GetBlockHash(height)
+		if err != nil {
+			return fmt.Errorf("failed to get block hash at %d: %w", height, err)
+		}
+		block, err := l.btcClient.GetBlock(hash)
+		if err != nil {
+			return err
+		}
+		if err := l.scanBitcoinBlock(ctx, block, tip); err != nil {
+			return fmt.Errorf("failed to scan block %d: %w", height, err)
+		}
+	}
+
+	return nil
+}
+
+// scanBitcoinBlock records deposits to watched addresses in block and
+// advances the scan height in the same transaction
+func (l *DepositListener) scanBitcoinBlock(ctx context.Context, block *Block, tip int64) error {
+	found := 0
+	err := l.db.WithTx(ctx, func(tx pgx.Tx) error {
+		for _, btx := range block.Tx {
+			for _, out := range btx.Vout {
+				watched, ok := l.watchList.Lookup(networkBitcoin, out.Address())
+				if !ok {
+					continue
+				}
+				amount, err := out.Amount()
+				if err != nil || !amount.IsPositive() {
+					l.logger.Warn("Skipping output with invalid amount",
+						zap.String("txid", btx.TxID),
+						zap.Uint32("vout", out.N),
+						zap.String("value", out.Value.String()),
+					)
+					continue
+				}
+
+				// An unconfigured asset stops the scan rather than skip the deposit
+				required, err := l.policy.Resolve(watched.Currency, watched.Network, amount)
+				if err != nil {
+					return err
+				}
+
+				recorded, err := recordDeposit(ctx, tx, watched, btx.TxID, out, amount, required, block, tip)
+				if err != nil {
+					return err
+				}
+				if recorded {
+					found++
+					l.logger.Info("Deposit detected",
+						zap.String("account_id", watched.AccountID.String()),
+						zap.String("address", watched.Address),
+						zap.String("txid", btx.TxID),
+						zap.Uint32("vout", out.N),
+						zap.String("amount", amount.String()),
+						zap.Int64("height", block.Height),
+					)
+				}
+			}
+		}
+
+		return saveScannedBlock(ctx, tx, networkBitcoin, block.Height, block.Hash)
+	})
+	if err != nil {
+		return err
+	}
+
+	l.logger.Debug("Scanned Bitcoin block",
+		zap.Int64("height", block.Height),
+		zap.String("hash", block.Hash),
+		zap.Int("transactions", len(block.Tx)),
+		zap.Int("deposits", found),
+	)
+	return nil
+}
+
+// recordDeposit inserts a deposit for an output paying a watched address.
+// The output joins our UTXO set, unspendable until the deposit is
+// withdrawable. It reports false if the output was already recorded.
+func recordDeposit(ctx context.Context, tx pgx.Tx, watched WatchedAddress, txid string, out TxOutput, amount decimal.Decimal, required ConfirmationRequirement, block *Block, tip int64) (bool, error) {
+	vout := out.N
+	recorded, err := insertDeposit(ctx, tx, watched, watched.Currency, txid, int(vout), amount, required, block.Height, block.Hash, tip)
+	if err != nil || !recorded {
+		return false, err
+	}
+
+	sats, err := amount.MinorUnits(8)
+	if err != nil {
+		return false, err
+	}
+	// Spent outputs revived by a reorg stay spent by our transaction
+	_, err = tx.Exec(ctx, `
+		INSERT INTO bitcoin_utxos (txid, vout, amount_sats, address, script_pub_key, derivation_path, block_height, status)
+		SELECT $1, $2, $3, address, $4, derivation_path, $5, 'pending'
+		FROM deposit_addresses
+		WHERE chain = $6 AND address = $7
+		ON CONFLICT (txid, vout) DO UPDATE
+		SET block_height = EXCLUDED.block_height,
+		    status = CASE WHEN bitcoin_utxos.spent_by IS NOT NULL THEN 'spent' ELSE 'pending' END,
+		    updated_at = NOW()
+		WHERE bitcoin_utxos.status = 'orphaned'
+	`, txid, int(vout), sats.Int64(), out.ScriptPubKey.Hex, block.Height, watched.Network, watched.Address)
+	if err != nil {
+		return false, fmt.Errorf("failed to record deposit UTXO: %w", err)
+	}
+	return true, nil
+}
+
+// insertDeposit inserts a deposit of currency to a watched address, where
+// vout identifies the transfer within its transaction, and marks the
+// address funded so the account's next request rotates it. A transfer
+// orphaned by a reorg and mined again on the new branch is revived; a
+// credit that was never reversed (the account was frozen instead) stands.
+// It reports false if the transfer was already recorded.
+func insertDeposit(ctx context.Context, tx pgx.Tx, watched WatchedAddress, currency, txid string, vout int, amount decimal.Decimal, required ConfirmationRequirement, height int64, hash string, tip int64) (bool, error) {
+	var depositID uuid.UUID
+	err := tx.QueryRow(ctx, `
+		INSERT INTO deposits (
+			account_id, currency, amount, address, txid, vout, network,
+			block_height, block_hash, confirmations, required_confirmations,
+			withdrawable_confirmations, status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, 'pending')
+		ON CONFLICT (txid, vout) DO UPDATE
+		SET block_height = EXCLUDED.block_height,
+		    block_hash = EXCLUDED.block_hash,
+		    confirmations = EXCLUDED.confirmations,
+		    status = CASE
+		        WHEN deposits.credited_at IS NOT NULL AND deposits.reversed_at IS NULL THEN 'credited'
+		        ELSE 'pending'
+		    END,
+		    orphaned_at = NULL,
+		    updated_at = NOW()
+		WHERE deposits.status = 'orphaned'
+		RETURNING id
+	`, watched.AccountID, currency, amount, watched.Address, txid, vout, watched.Network,
+		height, hash, tip-height+1, required.Credit, required.Withdraw,
+	).Scan(&depositID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record deposit: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE deposit_addresses
+		SET funded_at = NOW()
+		WHERE chain = $1 AND address = $2 AND funded_at IS NULL
+	`, watched.Network, watched.Address)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark deposit address funded: %w", err)
+	}
+	return true, nil
+}
+
+// lastScannedHeight returns the last scanned height on chain, or -1 if the
+// chain has never been scanned
+func (l *DepositListener) lastScannedHeight(ctx context.Context, chain string) (int64, error) {
+	var height int64
+	err := l.db.Pool.QueryRow(ctx, `
+		SELECT last_height FROM chain_scan_state WHERE chain = $1
+	`, chain).Scan(&height)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load scan state: %w", err)
+	}
+	return height, nil
+}
+
+// saveScannedBlock records a scanned block's hash for reorg detection,
+// forgetting blocks too deep to matter, and advances the scan state
+func saveScannedBlock(ctx context.Context, tx pgx.Tx, chain string, height int64, hash string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO scanned_blocks (chain, height, hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (chain, height) DO UPDATE
+		SET hash = EXCLUDED.hash, scanned_at = NOW()
+	`, chain, height, hash)
+	if err != nil {
+		return fmt.Errorf("failed to record scanned block: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM scanned_blocks WHERE chain = $1 AND height <= $2
+	`, chain, height-maxReorgDepth)
+	if err != nil {
+		return fmt.Errorf("failed to prune scanned blocks: %w", err)
+	}
+
+	return saveScanState(ctx, tx, chain, height, hash)
+}
+
+func saveScanState(ctx context.Context, tx pgx.Tx, chain string, height int64, hash string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO chain_scan_state (chain, last_height, last_hash, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (chain) DO UPDATE
+		SET last_height = EXCLUDED.last_height,
+		    last_hash = EXCLUDED.last_hash,
+		    updated_at = NOW()
+	`, chain, height, hash)
+	if err != nil {
+		return fmt.Errorf("failed to save scan state: %w", err)
+	}
+	return nil
+}
+
 func (l *DepositListener) checkBitcoinDeposits(ctx context.Context) error {
-	// Query all pending Bitcoin deposits
+	tip, err := l.btcClient.GetBlockHeight()
+	if err != nil {
+		return err
+	}
+
+	// Query Bitcoin deposits not yet withdrawable
 	query := `
-		SELECT id, account_id, address, amount, txid, confirmations
+		SELECT id, account_id, address, amount, txid, block_height, block_hash, status,
+		       confirmations, required_confirmations, withdrawable_confirmations
 		FROM deposits
 		WHERE currency = 'BTC' 
-		  AND status IN ('pending', 'confirmed')
-		  AND confirmations < required_confirmations
+		  AND status IN ('pending', 'confirmed', 'credited')
+		  AND withdrawable_at IS NULL
 	`
 	
 	rows, err := l.db.Pool.Query(ctx, query)
@@ -97,50 +360,256 @@ func (l *DepositListener) checkBitcoinDeposits(ctx context.Context) error {
 		var accountID uuid.UUID
 		var address, amount string
 		var txid *string
+		var blockHeight *int64
+		var blockHash *string
+		var status string
 		var currentConfirmations int
+		var required ConfirmationRequirement
 		
-		if err := rows.Scan(&depositID, &accountID, &address, &amount, &txid, &currentConfirmations); err != nil {
+		if err := rows.Scan(&depositID, &accountID, &address, &amount, &txid, &blockHeight, &blockHash, &status,
+			&currentConfirmations, &required.Credit, &required.Withdraw); err != nil {
 			l.logger.Error("Failed to scan deposit", zap.Error(err))
 			continue
 		}
-		
-		// If we have a txid, check confirmations
-		if txid != nil {
-			confirmations, err := l.btcClient.GetConfirmations(*txid)
+
+		// Deposits without a txid are intents; the block scanner records
+		// the actual transfer
+		if txid == nil {
+			continue
+		}
+
+		// Scanned deposits count confirmations from their block; the
+		// wallet RPC only knows about the node's own transactions
+		var confirmations int
+		if blockHeight != nil {
+			// Never count confirmations on a block that has left the
+			// chain; the next scan orphans the deposit
+			if blockHash != nil {
+				hash, err := l.btcClient.GetBlockHash(*blockHeight)
+				if err != nil || hash != *blockHash {
+					l.logger.Warn("Deposit block no longer on active chain",
+						zap.String("deposit_id", depositID.String()),
+						zap.Int64("height", *blockHeight),
+					)
+					continue
+				}
+			}
+			confirmations = int(tip - *blockHeight + 1)
+		} else {
+			confirmations, err = l.btcClient.GetConfirmations(*txid)
 			if err != nil {
 				l.logger.Error("Failed to get confirmations", zap.String("txid", *txid), zap.Error(err))
 				continue
 			}
+		}
 			
-			// Update confirmations in database
-			if confirmations != currentConfirmations {
-				l.updateDepositConfirmations(ctx, depositID, confirmations)
+		// Update confirmations in database
+		if confirmations != currentConfirmations {
+			l.updateDepositConfirmations(ctx, depositID, confirmations)
+		}
+
+		l.settleDeposit(ctx, depositID, accountID, "BTC", amount, status, confirmations, required)
+	}
+	
+	return nil
+}
+
+// settleDeposit credits a deposit for trading once it reaches its credit
+// threshold and releases it for withdrawal at its withdraw threshold
+func (l *DepositListener) settleDeposit(ctx context.Context, depositID, accountID uuid.UUID, currency, amount, status string, confirmations int, required ConfirmationRequirement) {
+	if status != "credited" && confirmations >= required.Credit {
+		if err := l.creditDeposit(ctx, depositID, accountID, currency, amount); err != nil {
+			l.logger.Error("Failed to credit deposit", zap.String("deposit_id", depositID.String()), zap.Error(err))
+			return
+		}
+	}
+	if confirmations >= required.Withdraw {
+		if err := l.markWithdrawable(ctx, depositID); err != nil {
+			l.logger.Error("Failed to mark deposit withdrawable", zap.String("deposit_id", depositID.String()), zap.Error(err))
+		}
+	}
+}
+
+// markWithdrawable releases a deposit for withdrawal. A Bitcoin deposit's
+// output becomes spendable by our withdrawals at the same depth.
+func (l *DepositListener) markWithdrawable(ctx context.Context, depositID uuid.UUID) error {
+	released := false
+	err := l.db.WithTx(ctx, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `
+			UPDATE deposits
+			SET withdrawable_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND status = 'credited' AND withdrawable_at IS NULL
+		`, depositID)
+		if err != nil || result.RowsAffected() == 0 {
+			return err
+		}
+		released = true
+
+		_, err = tx.Exec(ctx, `
+			UPDATE bitcoin_utxos u
+			SET status = 'available', updated_at = NOW()
+			FROM deposits d
+			WHERE d.id = $1 AND u.txid = d.txid AND u.vout = d.vout AND u.status = 'pending'
+		`, depositID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if released {
+		l.logger.Info("Deposit withdrawable", zap.String("deposit_id", depositID.String()))
+	}
+	return nil
+}
+
+// tokenScanRange is the most blocks scanned for token transfers at once.
+// Only the last block of each range is kept for reorg detection, so ranges
+// are kept well below maxReorgDepth.
+const tokenScanRange = 20
+
+// errChainMoved means the node switched branches while a range was being
+// scanned; the range is scanned again on the next pass
+var errChainMoved = errors.New("chain changed during scan")
+
+// scanTokenTransfers records ERC-20 transfers to watched addresses in every
+// block since the last scanned height, after rewinding past any reorg. A
+// listener with no saved height starts at the current tip.
+func (l *DepositListener) scanTokenTransfers(ctx context.Context) error {
+	tokens := l.tokens.Tokens(networkEthereum)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	tipHeight := func() (int64, error) {
+		tip, err := l.ethClient.BlockNumber(ctx)
+		return int64(tip), err
+	}
+	hashAt := func(height int64) (string, error) {
+		return l.ethClient.BlockHash(ctx, uint64(height))
+	}
+	if err := l.checkReorg(ctx, networkEthereum, tipHeight, hashAt); err != nil {
+		return err
+	}
+
+	tip, err := tipHeight()
+	if err != nil {
+		return err
+	}
+	last, err := l.lastScannedHeight(ctx, networkEthereum)
+	if err != nil {
+		return err
+	}
+	if last < 0 {
+		last = tip - 1
+	}
+
+	for from := last + 1; from <= tip; from += tokenScanRange {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		to := min(from+tokenScanRange-1, tip)
+		if err := l.scanTokenRange(ctx, tokens, from, to, tip, hashAt); err != nil {
+			return fmt.Errorf("failed to scan blocks %d to %d: %w", from, to, err)
+		}
+	}
+	return nil
+}
+
+// scanTokenRange records token deposits in blocks from to to and advances
+// the scan height in the same transaction. Amounts are in each token's own
+// decimals.
+func (l *DepositListener) scanTokenRange(ctx context.Context, tokens []Token, from, to, tip int64, hashAt func(int64) (string, error)) error {
+	hash, err := hashAt(to)
+	if err != nil {
+		return err
+	}
+	transfers, err := l.ethClient.TokenTransfers(ctx, tokens, uint64(from), uint64(to))
+	if err != nil {
+		return err
+	}
+	// Logs from one branch saved with the hash of another would hide the
+	// reorg from the next pass
+	if again, err := hashAt(to); err != nil || again != hash {
+		if err != nil {
+			return err
+		}
+		return errChainMoved
+	}
+
+	found := 0
+	err = l.db.WithTx(ctx, func(tx pgx.Tx) error {
+		for _, t := range transfers {
+			watched, ok := l.watchList.Lookup(networkEthereum, t.To)
+			if !ok {
+				continue
 			}
-			
-			// Credit account if confirmed
-			if confirmations >= 6 { // Bitcoin requires 6 confirmations
-				l.creditDeposit(ctx, depositID, accountID, "BTC", amount)
+			amount := decimal.NewFromBigInt(t.Amount, t.Token.Decimals)
+			if !amount.IsPositive() {
+				// Zero-value transfers are address-poisoning spam
+				continue
+			}
+
+			// An unconfigured asset stops the scan rather than skip the deposit
+			required, err := l.policy.Resolve(t.Token.Symbol, networkEthereum, amount)
+			if err != nil {
+				return err
+			}
+
+			recorded, err := insertDeposit(ctx, tx, watched, t.Token.Symbol, t.TxHash, int(t.LogIndex), amount, required,
+				int64(t.BlockNumber), t.BlockHash, tip)
+			if err != nil {
+				return err
+			}
+			if recorded {
+				found++
+				l.logger.Info("Token deposit detected",
+					zap.String("account_id", watched.AccountID.String()),
+					zap.String("address", watched.Address),
+					zap.String("currency", t.Token.Symbol),
+					zap.String("txid", t.TxHash),
+					zap.Uint64("log_index", t.LogIndex),
+					zap.String("amount", amount.String()),
+					zap.Uint64("height", t.BlockNumber),
+				)
 			}
-		} else {
-			// No txid yet, check address balance
-			// TODO: Implement address monitoring
 		}
+
+		return saveScannedBlock(ctx, tx, networkEthereum, to, hash)
+	})
+	if err != nil {
+		return err
 	}
-	
+
+	l.logger.Debug("Scanned Ethereum blocks for token transfers",
+		zap.Int64("from", from),
+		zap.Int64("to", to),
+		zap.Int("transfers", len(transfers)),
+		zap.Int("deposits", found),
+	)
 	return nil
 }
 
+// checkEthereumDeposits follows Ethereum and token deposits through their
+// receipts until they are withdrawable
 func (l *DepositListener) checkEthereumDeposits(ctx context.Context) error {
-	// Query all pending Ethereum deposits
+	tip, err := l.ethClient.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Query Ethereum deposits not yet withdrawable
 	query := `
-		SELECT id, account_id, address, amount, txid, confirmations
+		SELECT id, account_id, currency, address, amount, txid, block_hash, status,
+		       confirmations, required_confirmations, withdrawable_confirmations
 		FROM deposits
-		WHERE currency IN ('ETH', 'MATIC')
-		  AND status IN ('pending', 'confirmed')
-		  AND confirmations < required_confirmations
+		WHERE currency = ANY($1)
+		  AND status IN ('pending', 'confirmed', 'credited')
+		  AND withdrawable_at IS NULL
 	`
+	currencies := append([]string{"ETH", "MATIC"}, l.tokens.Symbols()...)
 	
-	rows, err := l.db.Pool.Query(ctx, query)
+	rows, err := l.db.Pool.Query(ctx, query, currencies)
 	if err != nil {
 		return err
 	}
@@ -149,31 +618,44 @@ func (l *DepositListener) checkEthereumDeposits(ctx context.Context) error {
 	for rows.Next() {
 		var depositID uuid.UUID
 		var accountID uuid.UUID
-		var address, amount string
-		var txid *string
+		var currency, address, amount, status string
+		var txid, blockHash *string
 		var currentConfirmations int
+		var required ConfirmationRequirement
 		
-		if err := rows.Scan(&depositID, &accountID, &address, &amount, &txid, &currentConfirmations); err != nil {
+		if err := rows.Scan(&depositID, &accountID, &currency, &address, &amount, &txid, &blockHash, &status,
+			&currentConfirmations, &required.Credit, &required.Withdraw); err != nil {
 			continue
 		}
 		
 		// If we have a txid, check confirmations
 		if txid != nil {
-			confirmations, err := l.ethClient.GetConfirmations(*txid)
+			receipt, err := l.ethClient.GetTransactionReceipt(ctx, *txid)
 			if err != nil {
 				l.logger.Error("Failed to get confirmations", zap.String("txid", *txid), zap.Error(err))
 				continue
 			}
+			confirmations := 0
+			if receipt != nil {
+				confirmations = receipt.Confirmations(tip)
+			}
+			
+			// Scanned deposits never count confirmations on a block that has
+			// left the chain; the next scan orphans the deposit
+			if blockHash != nil && (receipt == nil || !strings.EqualFold(receipt.BlockHash, *blockHash)) {
+				l.logger.Warn("Deposit block no longer on active chain",
+					zap.String("deposit_id", depositID.String()),
+					zap.String("txid", *txid),
+				)
+				continue
+			}
 			
 			// Update confirmations
 			if confirmations != currentConfirmations {
 				l.updateDepositConfirmations(ctx, depositID, confirmations)
 			}
 			
-			// Credit account if confirmed (ETH requires 12 confirmations)
-			if confirmations >= 12 {
-				l.creditDeposit(ctx, depositID, accountID, "ETH", amount)
-			}
+			l.settleDeposit(ctx, depositID, accountID, currency, amount, status, confirmations, required)
 		}
 	}
 	
@@ -202,75 +684,52 @@ func (l *DepositListener) updateDepositConfirmations(ctx context.Context, deposi
 }
 
 func (l *DepositListener) creditDeposit(ctx context.Context, depositID, accountID uuid.UUID, currency, amount string) error {
-	// Begin transaction
-	tx, err := l.db.Pool.Begin(ctx)
+	value, err := decimal.NewFromString(amount)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid deposit amount %q: %w", amount, err)
 	}
-	defer tx.Rollback(ctx)
-	
-	// Update deposit status
-	updateDepositQuery := `
-		UPDATE deposits
-		SET status = 'credited', credited_at = NOW(), updated_at = NOW()
-		WHERE id = $1 AND status != 'credited'
-	`
-	
-	result, err := tx.Exec(ctx, updateDepositQuery, depositID)
-	if err != nil {
-		return err
-	}
-	
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		// Already credited
+
+	var newBalance decimal.Decimal
+	credited := false
+	err = l.db.WithTx(ctx, func(tx pgx.Tx) error {
+		// Update deposit status
+		updateDepositQuery := `
+			UPDATE deposits
+			SET status = 'credited', credited_at = NOW(), reversed_at = NULL, updated_at = NOW()
+			WHERE id = $1 AND status IN ('pending', 'confirmed')
+		`
+
+		result, err := tx.Exec(ctx, updateDepositQuery, depositID)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			// Already credited or orphaned
+			return nil
+		}
+
+		newBalance, err = postDepositJournal(ctx, tx, journal.Journal{
+			Type:        journal.TypeDeposit,
+			ReferenceID: &depositID,
+			Description: "Cryptocurrency deposit",
+		}, accountID, currency, value)
+		if err != nil {
+			return err
+		}
+		credited = true
 		return nil
-	}
-	
-	// Update wallet balance
-	updateWalletQuery := `
-		UPDATE wallets
-		SET balance = balance + $1,
-		    available_balance = available_balance + $1,
-		    updated_at = NOW()
-		WHERE account_id = $2 AND currency = $3
-		RETURNING balance
-	`
-	
-	var newBalance string
-	err = tx.QueryRow(ctx, updateWalletQuery, amount, accountID, currency).Scan(&newBalance)
-	if err != nil {
-		return err
-	}
-	
-	// Create ledger entry
-	ledgerQuery := `
-		INSERT INTO ledger_entries (
-			account_id, currency, amount, balance_after,
-			entry_type, reference_id, reference_type, description
-		) VALUES ($1, $2, $3, $4, 'deposit', $5, 'deposit', 'Cryptocurrency deposit')
-	`
-	
-	_, err = tx.Exec(ctx, ledgerQuery, accountID, currency, amount, newBalance, depositID)
-	if err != nil {
+	})
+	if err != nil || !credited {
 		return err
 	}
-	
-	// Commit transaction
-	if err := tx.Commit(ctx); err != nil {
-		return err
-	}
-	
+
 	l.logger.Info("Deposit credited",
 		zap.String("deposit_id", depositID.String()),
 		zap.String("account_id", accountID.String()),
 		zap.String("currency", currency),
 		zap.String("amount", amount),
-		zap.String("new_balance", newBalance),
+		zap.String("new_balance", newBalance.String()),
 	)
-	
+
 	return nil
 }
-
-
-
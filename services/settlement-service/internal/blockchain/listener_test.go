@@ -0,0 +1,116 @@
+package blockchain
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+)
+
+func expectNoScannedBlocks(mock pgxmock.PgxPoolIface) {
+	mock.ExpectQuery("SELECT height, hash FROM scanned_blocks").
+		WithArgs(networkBitcoin, maxReorgDepth).
+		WillReturnRows(pgxmock.NewRows([]string{"height", "hash"}))
+}
+
+func expectLastScanned(mock pgxmock.PgxPoolIface, height int64) {
+	mock.ExpectQuery("SELECT last_height FROM chain_scan_state").
+		WithArgs(networkBitcoin).
+		WillReturnRows(pgxmock.NewRows([]string{"last_height"}).AddRow(height))
+}
+
+// expectDeposit expects tx's first output, paying depositAddress, to be
+// recorded from the block at height with the tip at tip, requiring the
+// default policy's confirmations for its value
+func expectDeposit(mock pgxmock.PgxPoolIface, node *fakeNode, accountID uuid.UUID, txid, value string, sats, height, tip int64) {
+	required, _ := DefaultConfirmationPolicy().Resolve("BTC", networkBitcoin, decimal.RequireFromString(value))
+	mock.ExpectQuery("INSERT INTO deposits").
+		WithArgs(accountID, "BTC", amount(value), depositAddress, txid, 0, networkBitcoin,
+			height, node.hashAt(height), tip-height+1, required.Credit, required.Withdraw).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectExec("UPDATE deposit_addresses").
+		WithArgs(networkBitcoin, depositAddress).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("INSERT INTO bitcoin_utxos").
+		WithArgs(txid, 0, sats, "", height, networkBitcoin, depositAddress).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+}
+
+// A listener that has never scanned starts at the tip, recording outputs
+// to watched addresses and ignoring the rest
+func TestScanBitcoinBlocksStartsAtTip(t *testing.T) {
+	node := newFakeNode(t, 3)
+	node.pay(2, "tx-old", depositAddress, "1")
+	node.pay(3, "tx-other", "bcrt1qnjg0jd8228aq7egyzacy8cys3knf9xvrudm7fw", "2")
+	node.pay(3, "tx-1", depositAddress, "0.25")
+	l, mock, accountID := newTestListener(t, node)
+
+	expectNoScannedBlocks(mock)
+	mock.ExpectQuery("SELECT last_height FROM chain_scan_state").
+		WithArgs(networkBitcoin).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectBegin()
+	expectDeposit(mock, node, accountID, "tx-1", "0.25", 25000000, 3, 3)
+	expectScannedBlock(mock, 3, node.hashAt(3))
+	mock.ExpectCommit()
+
+	if err := l.scanBitcoinBlocks(context.Background()); err != nil {
+		t.Fatalf("scanBitcoinBlocks() error = %v", err)
+	}
+	if got := node.servedHeights(); !reflect.DeepEqual(got, []int64{3}) {
+		t.Errorf("scanned heights = %v, want [3]", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// After a restart scanning resumes from the saved height: blocks mined
+// while the listener was down are scanned, and nothing before them is
+// scanned again
+func TestScanBitcoinBlocksResumesAfterRestart(t *testing.T) {
+	node := newFakeNode(t, 3)
+	node.pay(3, "tx-1", depositAddress, "0.25")
+	scanned := chainHashes(node, 3)
+
+	// Mined while the listener was down
+	node.mine("a")
+	node.mine("a")
+	node.pay(5, "tx-2", depositAddress, "0.1")
+
+	l, mock, accountID := newTestListener(t, node)
+	expectScannedBlocks(mock, scanned, 1, 3)
+	expectLastScanned(mock, 3)
+
+	mock.ExpectBegin()
+	expectScannedBlock(mock, 4, node.hashAt(4))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	expectDeposit(mock, node, accountID, "tx-2", "0.1", 10000000, 5, 5)
+	expectScannedBlock(mock, 5, node.hashAt(5))
+	mock.ExpectCommit()
+
+	if err := l.scanBitcoinBlocks(context.Background()); err != nil {
+		t.Fatalf("scanBitcoinBlocks() error = %v", err)
+	}
+	if got := node.servedHeights(); !reflect.DeepEqual(got, []int64{4, 5}) {
+		t.Errorf("scanned heights = %v, want [4 5]", got)
+	}
+
+	// Caught up, so the next pass fetches no blocks
+	expectScannedBlocks(mock, chainHashes(node, 5), 3, 5)
+	expectLastScanned(mock, 5)
+	if err := l.scanBitcoinBlocks(context.Background()); err != nil {
+		t.Fatalf("scanBitcoinBlocks() error = %v", err)
+	}
+	if got := node.servedHeights(); len(got) != 2 {
+		t.Errorf("scanned heights = %v, want no more after catching up", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
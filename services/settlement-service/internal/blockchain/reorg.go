@@ -0,0 +1,262 @@
+// BitCurrent Exchange - Chain Reorganisation Handling
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// maxReorgDepth is how many scanned block hashes are kept for finding a
+// fork point. A deeper reorg stops the scanner for manual recovery.
+const maxReorgDepth = 100
+
+// ErrReorgTooDeep means no scanned block is still on the node's chain
+var ErrReorgTooDeep = errors.New("chain reorganisation deeper than scanned history")
+
+// custodyAccount returns the system account holding deposits of currency.
+// Bitcoin deposit outputs are spent directly by the hot wallet's signers;
+// everything else stays on its deposit address until swept.
+func custodyAccount(currency string) uuid.UUID {
+	if currency == "BTC" {
+		return journal.HotWalletAccountID
+	}
+	return journal.DepositAddressAccountID
+}
+
+type scannedBlock struct {
+	Height int64
+	Hash   string
+}
+
+// checkBitcoinReorg rewinds Bitcoin deposit scanning past any fork
+func (l *DepositListener) checkBitcoinReorg(ctx context.Context) error {
+	return l.checkReorg(ctx, networkBitcoin, l.btcClient.GetBlockHeight, l.btcClient.GetBlockHash)
+}
+
+// checkReorg compares the hashes of recently scanned blocks on chain with
+// the node's. If the chain has forked it rewinds scanning to the last
+// common block and orphans the deposits seen above it; blocks on the new
+// branch are then scanned as usual, reviving any deposit mined again.
+func (l *DepositListener) checkReorg(ctx context.Context, chain string, tipHeight func() (int64, error), hashAt func(int64) (string, error)) error {
+	blocks, err := l.recentScannedBlocks(ctx, chain)
+	if err != nil || len(blocks) == 0 {
+		return err
+	}
+
+	tip, err := tipHeight()
+	if err != nil {
+		return err
+	}
+
+	// blocks are newest first
+	var fork *scannedBlock
+	for i := range blocks {
+		if blocks[i].Height > tip {
+			continue
+		}
+		hash, err := hashAt(blocks[i].Height)
+		if err != nil {
+			return fmt.Errorf("failed to get block hash at %d: %w", blocks[i].Height, err)
+		}
+		if hash == blocks[i].Hash {
+			fork = &blocks[i]
+			break
+		}
+	}
+
+	if fork == nil {
+		l.logger.Error("Chain reorganisation deeper than scanned history, deposit scanning stopped",
+			zap.String("chain", chain),
+			zap.Int64("scanned_height", blocks[0].Height),
+			zap.Int64("oldest_tracked", blocks[len(blocks)-1].Height),
+		)
+		return ErrReorgTooDeep
+	}
+	if fork.Height == blocks[0].Height {
+		return nil
+	}
+
+	l.logger.Warn("Chain reorganisation detected",
+		zap.String("chain", chain),
+		zap.Int64("scanned_height", blocks[0].Height),
+		zap.Int64("fork_height", fork.Height),
+		zap.String("fork_hash", fork.Hash),
+	)
+	return l.rewind(ctx, chain, *fork)
+}
+
+func (l *DepositListener) recentScannedBlocks(ctx context.Context, chain string) ([]scannedBlock, error) {
+	rows, err := l.db.Pool.Query(ctx, `
+		SELECT height, hash
+		FROM scanned_blocks
+		WHERE chain = $1
+		ORDER BY height DESC
+		LIMIT $2
+	`, chain, maxReorgDepth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scanned blocks: %w", err)
+	}
+	defer rows.Close()
+
+	var blocks []scannedBlock
+	for rows.Next() {
+		var b scannedBlock
+		if err := rows.Scan(&b.Height, &b.Hash); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
+
+type orphanedDeposit struct {
+	ID         uuid.UUID
+	AccountID  uuid.UUID
+	Currency   string
+	Amount     decimal.Decimal
+	Status     string
+	CreditedAt *time.Time
+	ReversedAt *time.Time
+}
+
+// rewind orphans every deposit and UTXO above the fork and moves the scan
+// state back to it, in one transaction
+func (l *DepositListener) rewind(ctx context.Context, chain string, fork scannedBlock) error {
+	return l.db.WithTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT id, account_id, currency, amount, status, credited_at, reversed_at
+			FROM deposits
+			WHERE network = $1 AND block_height > $2 AND status <> 'orphaned'
+			ORDER BY block_height, id
+			FOR UPDATE
+		`, chain, fork.Height)
+		if err != nil {
+			return fmt.Errorf("failed to load deposits above fork: %w", err)
+		}
+		var deposits []orphanedDeposit
+		for rows.Next() {
+			var d orphanedDeposit
+			if err := rows.Scan(&d.ID, &d.AccountID, &d.Currency, &d.Amount, &d.Status, &d.CreditedAt, &d.ReversedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			deposits = append(deposits, d)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, d := range deposits {
+			if err := l.orphanDeposit(ctx, tx, d); err != nil {
+				return err
+			}
+		}
+
+		if chain == networkBitcoin {
+			if _, err := tx.Exec(ctx, `
+				UPDATE bitcoin_utxos
+				SET status = 'orphaned', updated_at = NOW()
+				WHERE block_height > $1 AND status <> 'orphaned'
+			`, fork.Height); err != nil {
+				return fmt.Errorf("failed to orphan UTXOs above fork: %w", err)
+			}
+		}
+
+		if _, err := tx.Exec(ctx, `
+			DELETE FROM scanned_blocks WHERE chain = $1 AND height > $2
+		`, chain, fork.Height); err != nil {
+			return fmt.Errorf("failed to discard orphaned blocks: %w", err)
+		}
+		return saveScanState(ctx, tx, chain, fork.Height, fork.Hash)
+	})
+}
+
+// orphanDeposit marks a deposit orphaned, reversing its credit if it has
+// been credited
+func (l *DepositListener) orphanDeposit(ctx context.Context, tx pgx.Tx, d orphanedDeposit) error {
+	reversed := false
+	if d.CreditedAt != nil && d.ReversedAt == nil {
+		var err error
+		if reversed, err = l.reverseDepositCredit(ctx, tx, d); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(ctx, `
+		UPDATE deposits
+		SET status = 'orphaned',
+		    orphaned_at = NOW(),
+		    reversed_at = CASE WHEN $2 THEN NOW() ELSE reversed_at END,
+		    withdrawable_at = NULL,
+		    updated_at = NOW()
+		WHERE id = $1
+	`, d.ID, reversed)
+	if err != nil {
+		return fmt.Errorf("failed to orphan deposit: %w", err)
+	}
+
+	l.logger.Warn("Deposit orphaned by chain reorganisation",
+		zap.String("deposit_id", d.ID.String()),
+		zap.String("account_id", d.AccountID.String()),
+		zap.String("status", d.Status),
+		zap.String("amount", d.Amount.String()),
+		zap.Bool("reversed", reversed),
+	)
+	return nil
+}
+
+// reverseDepositCredit posts a compensating journal for a credited deposit.
+// If the account no longer has the funds available they have been
+// withdrawn or committed elsewhere, so the account is frozen for manual
+// recovery instead; it reports whether the credit was reversed.
+func (l *DepositListener) reverseDepositCredit(ctx context.Context, tx pgx.Tx, d orphanedDeposit) (bool, error) {
+	_, err := postDepositJournal(ctx, tx, journal.Journal{
+		Type:        journal.TypeAdjustment,
+		ReferenceID: &d.ID,
+		Description: "Deposit reversed after chain reorganisation",
+	}, d.AccountID, d.Currency, d.Amount.Neg())
+	if errors.Is(err, journal.ErrInsufficientBalance) {
+		if _, err := tx.Exec(ctx, `
+			UPDATE accounts SET status = 'frozen', updated_at = NOW() WHERE id = $1
+		`, d.AccountID); err != nil {
+			return false, fmt.Errorf("failed to freeze account: %w", err)
+		}
+		l.logger.Error("Orphaned deposit already spent, account frozen",
+			zap.String("deposit_id", d.ID.String()),
+			zap.String("account_id", d.AccountID.String()),
+			zap.String("amount", d.Amount.String()),
+		)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// postDepositJournal moves amount between the custody account and the
+// customer's wallet as one deposit journal, returning the customer's new
+// balance. Nothing is written if the customer cannot cover a negative
+// amount.
+func postDepositJournal(ctx context.Context, tx pgx.Tx, j journal.Journal, accountID uuid.UUID, currency string, amount decimal.Decimal) (decimal.Decimal, error) {
+	referenceType := "deposit"
+	j.ReferenceType = &referenceType
+	j.Postings = []journal.Posting{
+		{AccountID: custodyAccount(currency), Currency: currency, Amount: amount.Neg()},
+		{AccountID: accountID, Currency: currency, Amount: amount},
+	}
+	entries, err := journal.Post(ctx, tx, &j)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return entries[1].BalanceAfter, nil
+}
@@ -0,0 +1,262 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+const depositAddress = "bcrt1qcr8te4kr609gcawutmrza0j4xv80jy8zeqchgx"
+
+// amount matches a decimal argument by value
+type amount string
+
+func (a amount) Match(v interface{}) bool {
+	d, ok := v.(decimal.Decimal)
+	return ok && d.Equal(decimal.RequireFromString(string(a)))
+}
+
+func newTestListener(t *testing.T, node *fakeNode) (*DepositListener, pgxmock.PgxPoolIface, uuid.UUID) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+
+	accountID := uuid.New()
+	watchList := NewWatchList()
+	watchList.Watch(WatchedAddress{AccountID: accountID, Currency: "BTC", Network: networkBitcoin, Address: depositAddress})
+
+	l := NewDepositListener(node.client(), nil, nil, watchList, DefaultConfirmationPolicy(), database.New(mock, zap.NewNop()), zap.NewNop())
+	return l, mock, accountID
+}
+
+// expectScannedBlocks returns the listener's record of heights from..to,
+// newest first, as they were on node before any fork
+func expectScannedBlocks(mock pgxmock.PgxPoolIface, hashes map[int64]string, from, to int64) {
+	rows := pgxmock.NewRows([]string{"height", "hash"})
+	for h := to; h >= from; h-- {
+		rows.AddRow(h, hashes[h])
+	}
+	mock.ExpectQuery("SELECT height, hash FROM scanned_blocks").
+		WithArgs(networkBitcoin, maxReorgDepth).
+		WillReturnRows(rows)
+}
+
+func expectOrphanedDeposits(mock pgxmock.PgxPoolIface, forkHeight int64, depositID, accountID uuid.UUID, value string) {
+	creditedAt := time.Now().Add(-time.Hour)
+	mock.ExpectQuery("SELECT id, account_id, currency, amount, status, credited_at, reversed_at").
+		WithArgs(networkBitcoin, forkHeight).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "account_id", "currency", "amount", "status", "credited_at", "reversed_at"}).
+			AddRow(depositID, accountID, "BTC", decimal.RequireFromString(value), "credited", &creditedAt, (*time.Time)(nil)))
+}
+
+func expectLockWallets(mock pgxmock.PgxPoolIface, accountID uuid.UUID, available string) {
+	mock.ExpectQuery("INSERT INTO wallets").
+		WithArgs(journal.HotWalletAccountID, "BTC", "hot", journal.FeeAccountID).
+		WillReturnRows(pgxmock.NewRows([]string{"available_balance", "allow_negative"}).AddRow(decimal.NewFromInt(-100), true))
+	mock.ExpectQuery("INSERT INTO wallets").
+		WithArgs(accountID, "BTC", "hot", journal.FeeAccountID).
+		WillReturnRows(pgxmock.NewRows([]string{"available_balance", "allow_negative"}).AddRow(decimal.RequireFromString(available), false))
+}
+
+func expectRewound(mock pgxmock.PgxPoolIface, height int64, hash string) {
+	mock.ExpectExec("UPDATE bitcoin_utxos").
+		WithArgs(height).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("DELETE FROM scanned_blocks").
+		WithArgs(networkBitcoin, height).
+		WillReturnResult(pgxmock.NewResult("DELETE", 2))
+	mock.ExpectExec("INSERT INTO chain_scan_state").
+		WithArgs(networkBitcoin, height, hash).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+}
+
+func expectScannedBlock(mock pgxmock.PgxPoolIface, height int64, hash string) {
+	mock.ExpectExec("INSERT INTO scanned_blocks").
+		WithArgs(networkBitcoin, height, hash).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("DELETE FROM scanned_blocks").
+		WithArgs(networkBitcoin, height-maxReorgDepth).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectExec("INSERT INTO chain_scan_state").
+		WithArgs(networkBitcoin, height, hash).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+}
+
+func chainHashes(node *fakeNode, to int64) map[int64]string {
+	hashes := make(map[int64]string)
+	for h := int64(0); h <= to; h++ {
+		hashes[h] = node.hashAt(h)
+	}
+	return hashes
+}
+
+func TestReorgWithoutForkLeavesDepositsAlone(t *testing.T) {
+	node := newFakeNode(t, 3)
+	l, mock, _ := newTestListener(t, node)
+
+	expectScannedBlocks(mock, chainHashes(node, 3), 1, 3)
+
+	if err := l.checkBitcoinReorg(context.Background()); err != nil {
+		t.Fatalf("checkBitcoinReorg() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A credited deposit in an orphaned block is reversed with a compensating
+// journal. When the transaction is mined again on the new branch the
+// deposit is recorded again from there.
+func TestReorgReversesCreditedDepositAndRescansNewBranch(t *testing.T) {
+	node := newFakeNode(t, 3)
+	node.pay(3, "tx-1", depositAddress, "0.50000000")
+	scanned := chainHashes(node, 3)
+
+	node.fork(1, "b", 3)
+	node.pay(3, "tx-1", depositAddress, "0.50000000")
+
+	l, mock, accountID := newTestListener(t, node)
+	depositID, referenceType := uuid.New(), "deposit"
+
+	expectScannedBlocks(mock, scanned, 1, 3)
+
+	mock.ExpectBegin()
+	expectOrphanedDeposits(mock, 1, depositID, accountID, "0.5")
+	expectLockWallets(mock, accountID, "0.75")
+	mock.ExpectQuery("INSERT INTO journals").
+		WithArgs("adjustment", &depositID, &referenceType, pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectQuery("UPDATE wallets").
+		WithArgs(amount("0.5"), decimal.Zero, journal.HotWalletAccountID, "BTC").
+		WillReturnRows(pgxmock.NewRows([]string{"balance"}).AddRow(decimal.RequireFromString("-99.5")))
+	mock.ExpectQuery("INSERT INTO ledger_entries").
+		WithArgs(pgxmock.AnyArg(), journal.HotWalletAccountID, "BTC", amount("0.5"), pgxmock.AnyArg(), "adjustment", &depositID, &referenceType, pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectQuery("UPDATE wallets").
+		WithArgs(amount("-0.5"), decimal.Zero, accountID, "BTC").
+		WillReturnRows(pgxmock.NewRows([]string{"balance"}).AddRow(decimal.RequireFromString("0.25")))
+	mock.ExpectQuery("INSERT INTO ledger_entries").
+		WithArgs(pgxmock.AnyArg(), accountID, "BTC", amount("-0.5"), pgxmock.AnyArg(), "adjustment", &depositID, &referenceType, pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectExec("UPDATE deposits").
+		WithArgs(depositID, true).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectRewound(mock, 1, scanned[1])
+	mock.ExpectCommit()
+
+	// Scanning resumes from the fork and finds the transaction again
+	mock.ExpectQuery("SELECT last_height FROM chain_scan_state").
+		WithArgs(networkBitcoin).
+		WillReturnRows(pgxmock.NewRows([]string{"last_height"}).AddRow(int64(1)))
+
+	mock.ExpectBegin()
+	expectScannedBlock(mock, 2, node.hashAt(2))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO deposits").
+		WithArgs(accountID, "BTC", amount("0.5"), depositAddress, "tx-1", 0, networkBitcoin,
+			int64(3), node.hashAt(3), int64(2), 3, 6).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(depositID))
+	mock.ExpectExec("UPDATE deposit_addresses").
+		WithArgs(networkBitcoin, depositAddress).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mock.ExpectExec("INSERT INTO bitcoin_utxos").
+		WithArgs("tx-1", 0, int64(50000000), "", int64(3), networkBitcoin, depositAddress).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	expectScannedBlock(mock, 3, node.hashAt(3))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	expectScannedBlock(mock, 4, node.hashAt(4))
+	mock.ExpectCommit()
+
+	if err := l.scanBitcoinBlocks(context.Background()); err != nil {
+		t.Fatalf("scanBitcoinBlocks() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// If the credited funds have already left the account the credit cannot
+// be reversed, so the account is frozen
+func TestReorgFreezesAccountWhenDepositAlreadySpent(t *testing.T) {
+	node := newFakeNode(t, 3)
+	scanned := chainHashes(node, 3)
+	node.fork(2, "b", 1)
+
+	l, mock, accountID := newTestListener(t, node)
+	depositID := uuid.New()
+
+	expectScannedBlocks(mock, scanned, 1, 3)
+	mock.ExpectBegin()
+	expectOrphanedDeposits(mock, 2, depositID, accountID, "0.5")
+	expectLockWallets(mock, accountID, "0.1")
+	mock.ExpectExec("UPDATE accounts SET status = 'frozen'").
+		WithArgs(accountID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("UPDATE deposits").
+		WithArgs(depositID, false).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectRewound(mock, 2, scanned[2])
+	mock.ExpectCommit()
+
+	if err := l.checkBitcoinReorg(context.Background()); err != nil {
+		t.Fatalf("checkBitcoinReorg() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A shorter replacement chain leaves scanned heights above the new tip
+func TestReorgToShorterChain(t *testing.T) {
+	node := newFakeNode(t, 4)
+	scanned := chainHashes(node, 4)
+	node.fork(1, "b", 1)
+
+	l, mock, _ := newTestListener(t, node)
+
+	expectScannedBlocks(mock, scanned, 0, 4)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, account_id, currency, amount, status, credited_at, reversed_at").
+		WithArgs(networkBitcoin, int64(1)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "account_id", "currency", "amount", "status", "credited_at", "reversed_at"}))
+	expectRewound(mock, 1, scanned[1])
+	mock.ExpectCommit()
+
+	if err := l.checkBitcoinReorg(context.Background()); err != nil {
+		t.Fatalf("checkBitcoinReorg() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReorgDeeperThanHistoryStopsScanning(t *testing.T) {
+	node := newFakeNode(t, 5)
+	scanned := chainHashes(node, 5)
+	node.fork(1, "b", 5)
+
+	l, mock, _ := newTestListener(t, node)
+	expectScannedBlocks(mock, scanned, 3, 5)
+
+	if err := l.checkBitcoinReorg(context.Background()); !errors.Is(err, ErrReorgTooDeep) {
+		t.Fatalf("checkBitcoinReorg() error = %v, want ErrReorgTooDeep", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,46 @@
+// BitCurrent Exchange - RLP Encoding
+package blockchain
+
+import "math/big"
+
+// Recursive Length Prefix encoding, as much of it as signing transactions
+// needs: byte strings, unsigned integers and lists
+
+// rlpBytes encodes a byte string
+func rlpBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return []byte{b[0]}
+	}
+	return append(rlpHeader(0x80, len(b)), b...)
+}
+
+// rlpBig encodes an unsigned integer without leading zeros; nil is zero
+func rlpBig(n *big.Int) []byte {
+	if n == nil {
+		return rlpBytes(nil)
+	}
+	return rlpBytes(n.Bytes())
+}
+
+func rlpUint(n uint64) []byte {
+	return rlpBig(new(big.Int).SetUint64(n))
+}
+
+// rlpList encodes a list of already encoded items
+func rlpList(items ...[]byte) []byte {
+	var payload []byte
+	for _, item := range items {
+		payload = append(payload, item...)
+	}
+	return append(rlpHeader(0xc0, len(payload)), payload...)
+}
+
+// rlpHeader prefixes a payload of n bytes; offset is 0x80 for strings and
+// 0xc0 for lists
+func rlpHeader(offset byte, n int) []byte {
+	if n < 56 {
+		return []byte{offset + byte(n)}
+	}
+	size := big.NewInt(int64(n)).Bytes()
+	return append([]byte{offset + 55 + byte(len(size))}, size...)
+}
@@ -0,0 +1,236 @@
+// BitCurrent Exchange - ERC-20 Token Registry
+package blockchain
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+)
+
+const networkEthereum = "ethereum"
+
+// maxTokenDecimals is the precision of the ledger's amount columns
+const maxTokenDecimals = 18
+
+// ErrInvalidToken means a token's registry entry is unusable
+var ErrInvalidToken = errors.New("invalid token")
+
+// Token is an ERC-20 token accepted for deposits and withdrawals
+type Token struct {
+	Symbol   string `mapstructure:"symbol"`
+	Contract string `mapstructure:"contract"`
+	// Decimals is the token's own precision, 6 for USDC and USDT
+	Decimals int32  `mapstructure:"decimals"`
+	Network  string `mapstructure:"network"`
+}
+
+// MainnetTokens are the tokens accepted on Ethereum mainnet unless
+// ethereum.tokens lists others
+var MainnetTokens = []Token{
+	{Symbol: "USDC", Contract: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", Decimals: 6, Network: networkEthereum},
+	{Symbol: "USDT", Contract: "0xdAC17F958D2ee523a2206206994597C13D831ec7", Decimals: 6, Network: networkEthereum},
+}
+
+// TokenRegistry looks tokens up by symbol or by contract. A nil registry
+// has no tokens.
+type TokenRegistry struct {
+	bySymbol   map[string]Token
+	byContract map[string]Token
+}
+
+// NewTokenRegistry creates a registry of tokens and registers each token's
+// decimals as its currency's scale
+func NewTokenRegistry(tokens []Token) (*TokenRegistry, error) {
+	r := &TokenRegistry{
+		bySymbol:   make(map[string]Token),
+		byContract: make(map[string]Token),
+	}
+	for _, t := range tokens {
+		t.Symbol = strings.ToUpper(t.Symbol)
+		if t.Symbol == "" || t.Network == "" {
+			return nil, fmt.Errorf("%w: %s needs a symbol and network", ErrInvalidToken, t.Contract)
+		}
+		if _, err := decodeAddress(t.Contract); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidToken, t.Symbol, err)
+		}
+		if t.Decimals < 0 || t.Decimals > maxTokenDecimals {
+			return nil, fmt.Errorf("%w: %s has %d decimals, at most %d are supported",
+				ErrInvalidToken, t.Symbol, t.Decimals, maxTokenDecimals)
+		}
+		contract := contractKey(t.Network, t.Contract)
+		if _, ok := r.bySymbol[t.Symbol]; ok {
+			return nil, fmt.Errorf("%w: %s listed twice", ErrInvalidToken, t.Symbol)
+		}
+		if _, ok := r.byContract[contract]; ok {
+			return nil, fmt.Errorf("%w: contract %s listed twice", ErrInvalidToken, t.Contract)
+		}
+		r.bySymbol[t.Symbol] = t
+		r.byContract[contract] = t
+		decimal.RegisterCurrency(t.Symbol, t.Decimals)
+	}
+	return r, nil
+}
+
+// BySymbol returns the token for a currency
+func (r *TokenRegistry) BySymbol(symbol string) (Token, bool) {
+	if r == nil {
+		return Token{}, false
+	}
+	t, ok := r.bySymbol[strings.ToUpper(symbol)]
+	return t, ok
+}
+
+// ByContract returns the token at a contract address on network
+func (r *TokenRegistry) ByContract(network, contract string) (Token, bool) {
+	if r == nil {
+		return Token{}, false
+	}
+	t, ok := r.byContract[contractKey(network, contract)]
+	return t, ok
+}
+
+// Tokens returns the tokens on network in symbol order
+func (r *TokenRegistry) Tokens(network string) []Token {
+	if r == nil {
+		return nil
+	}
+	var tokens []Token
+	for _, t := range r.bySymbol {
+		if t.Network == network {
+			tokens = append(tokens, t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Symbol < tokens[j].Symbol })
+	return tokens
+}
+
+// Symbols returns the currencies of every token in symbol order
+func (r *TokenRegistry) Symbols() []string {
+	if r == nil {
+		return nil
+	}
+	symbols := make([]string, 0, len(r.bySymbol))
+	for s := range r.bySymbol {
+		symbols = append(symbols, s)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+func contractKey(network, contract string) string {
+	return network + ":" + strings.ToLower(contract)
+}
+
+// ERC-20 function selectors and the Transfer event topic
+var (
+	transferSelector  = keccak256([]byte("transfer(address,uint256)"))[:4]
+	balanceOfSelector = keccak256([]byte("balanceOf(address)"))[:4]
+	transferTopic     = "0x" + hex.EncodeToString(keccak256([]byte("Transfer(address,address,uint256)")))
+)
+
+// EncodeTransfer returns the call data of an ERC-20 transfer of amount,
+// in the token's smallest unit, to address
+func EncodeTransfer(to string, amount *big.Int) ([]byte, error) {
+	recipient, err := decodeAddress(to)
+	if err != nil {
+		return nil, err
+	}
+	if amount.Sign() < 0 || amount.BitLen() > 256 {
+		return nil, fmt.Errorf("token amount %s out of range", amount)
+	}
+	data := make([]byte, 0, 4+2*32)
+	data = append(data, transferSelector...)
+	data = append(data, abiWord(recipient)...)
+	return append(data, abiWord(amount.Bytes())...), nil
+}
+
+func encodeBalanceOf(address string) ([]byte, error) {
+	owner, err := decodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, balanceOfSelector...), abiWord(owner)...), nil
+}
+
+// abiWord left-pads b to a 32-byte ABI word
+func abiWord(b []byte) []byte {
+	word := make([]byte, 32)
+	copy(word[32-len(b):], b)
+	return word
+}
+
+// TokenTransfer is an ERC-20 Transfer event
+type TokenTransfer struct {
+	Token       Token
+	From        string
+	To          string
+	Amount      *big.Int
+	TxHash      string
+	LogIndex    uint64
+	BlockNumber uint64
+	BlockHash   string
+}
+
+// TokenTransfers returns the Transfer events of tokens in blocks from to
+// to inclusive. Events that do not follow the ERC-20 layout are skipped.
+func (c *EthereumClient) TokenTransfers(ctx context.Context, tokens []Token, from, to uint64) ([]TokenTransfer, error) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	byContract := make(map[string]Token, len(tokens))
+	contracts := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		byContract[strings.ToLower(t.Contract)] = t
+		contracts = append(contracts, t.Contract)
+	}
+
+	logs, err := c.GetLogs(ctx, LogFilter{
+		FromBlock: from,
+		ToBlock:   to,
+		Addresses: contracts,
+		Topics:    [][]string{{transferTopic}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var transfers []TokenTransfer
+	for _, l := range logs {
+		token, ok := byContract[strings.ToLower(l.Address)]
+		// ERC-721 transfers share the topic but index the token ID
+		if !ok || len(l.Topics) != 3 || len(l.Data) != 32 {
+			continue
+		}
+		fromAddr, err1 := topicAddress(l.Topics[1])
+		toAddr, err2 := topicAddress(l.Topics[2])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		transfers = append(transfers, TokenTransfer{
+			Token:       token,
+			From:        fromAddr,
+			To:          toAddr,
+			Amount:      new(big.Int).SetBytes(l.Data),
+			TxHash:      l.TxHash,
+			LogIndex:    l.Index,
+			BlockNumber: l.BlockNumber,
+			BlockHash:   l.BlockHash,
+		})
+	}
+	return transfers, nil
+}
+
+// topicAddress decodes an address indexed in a log topic
+func topicAddress(topic string) (string, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(topic, "0x"))
+	if err != nil || len(b) != 32 {
+		return "", fmt.Errorf("invalid address topic %q", topic)
+	}
+	return "0x" + hex.EncodeToString(b[12:]), nil
+}
@@ -0,0 +1,155 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+const usdcContract = "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
+
+func TestEncodeTransfer(t *testing.T) {
+	data, err := EncodeTransfer(ethAddress, big.NewInt(1000000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a9059cbb" +
+		"0000000000000000000000009858effd232b4033e47d90003d41ec34ecaeda94" +
+		"00000000000000000000000000000000000000000000000000000000000f4240"
+	if got := hex.EncodeToString(data); got != want {
+		t.Errorf("EncodeTransfer() = %s, want %s", got, want)
+	}
+
+	if _, err := EncodeTransfer("0x1234", big.NewInt(1)); err == nil {
+		t.Error("EncodeTransfer() accepted an invalid address")
+	}
+	if _, err := EncodeTransfer(ethAddress, big.NewInt(-1)); err == nil {
+		t.Error("EncodeTransfer() accepted a negative amount")
+	}
+}
+
+func TestNewTokenRegistry(t *testing.T) {
+	tokens, err := NewTokenRegistry([]Token{
+		{Symbol: "usdc", Contract: usdcContract, Decimals: 6, Network: networkEthereum},
+		{Symbol: "TST", Contract: "0x" + strings.Repeat("11", 20), Decimals: 9, Network: networkEthereum},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, ok := tokens.ByContract(networkEthereum, strings.ToLower(usdcContract)); !ok || token.Symbol != "USDC" {
+		t.Errorf("ByContract() = %+v, %v", token, ok)
+	}
+	if decimal.ScaleOf("TST") != 9 {
+		t.Errorf("ScaleOf(TST) = %d, want the token's 9 decimals", decimal.ScaleOf("TST"))
+	}
+	if got := tokens.Symbols(); len(got) != 2 || got[0] != "TST" || got[1] != "USDC" {
+		t.Errorf("Symbols() = %v", got)
+	}
+
+	var none *TokenRegistry
+	if _, ok := none.BySymbol("USDC"); ok || len(none.Tokens(networkEthereum)) != 0 {
+		t.Error("nil registry has tokens")
+	}
+
+	invalid := map[string][]Token{
+		"bad contract":  {{Symbol: "X", Contract: "0x12", Decimals: 6, Network: networkEthereum}},
+		"too precise":   {{Symbol: "X", Contract: usdcContract, Decimals: 24, Network: networkEthereum}},
+		"no network":    {{Symbol: "X", Contract: usdcContract, Decimals: 6}},
+		"same symbol":   {MainnetTokens[0], {Symbol: "USDC", Contract: "0x" + strings.Repeat("22", 20), Decimals: 6, Network: networkEthereum}},
+		"same contract": {MainnetTokens[0], {Symbol: "USDX", Contract: strings.ToLower(usdcContract), Decimals: 6, Network: networkEthereum}},
+	}
+	for name, list := range invalid {
+		if _, err := NewTokenRegistry(list); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: error = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestGetTokenBalance(t *testing.T) {
+	node := newFakeEthNode(t, 100)
+	node.tokenBalances[strings.ToLower(usdcContract)] = map[string]*big.Int{
+		strings.ToLower(ethAddress): big.NewInt(2500000),
+	}
+
+	got, err := node.client().GetTokenBalance(context.Background(), ethAddress, usdcContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Int64() != 2500000 {
+		t.Errorf("GetTokenBalance() = %s, want 2500000", got)
+	}
+}
+
+// Transfers to watched addresses are recorded in the token's decimals;
+// others, zero-value transfers and non-ERC-20 events are ignored
+func TestScanTokenTransfers(t *testing.T) {
+	node := newFakeEthNode(t, 99)
+	tokens, err := NewTokenRegistry(MainnetTokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	accountID := uuid.New()
+	watchList := NewWatchList()
+	watchList.Watch(WatchedAddress{AccountID: accountID, Currency: "USDC", Network: networkEthereum, Address: ethAddress})
+	l := NewDepositListener(nil, node.client(), tokens, watchList, DefaultConfirmationPolicy(), database.New(mock, zap.NewNop()), zap.NewNop())
+
+	node.mine()
+	sender := "0x" + strings.Repeat("33", 20)
+	node.emit(usdcContract, sender, "0x"+strings.Repeat("44", 20), 7000000)
+	txHash := node.emit(usdcContract, sender, ethAddress, 2500000)
+	node.emit(usdcContract, sender, ethAddress, 0)
+	node.mu.Lock()
+	nft := node.logs[0]
+	nft.Address = "0x" + strings.Repeat("55", 20)
+	nft.Topics = append(nft.Topics, addressTopic(sender))
+	node.logs = append(node.logs, nft)
+	node.mu.Unlock()
+
+	mock.ExpectQuery("SELECT height, hash FROM scanned_blocks").
+		WithArgs(networkEthereum, maxReorgDepth).
+		WillReturnRows(pgxmock.NewRows([]string{"height", "hash"}).AddRow(int64(99), fakeBlockHash(99)))
+	mock.ExpectQuery("SELECT last_height FROM chain_scan_state").
+		WithArgs(networkEthereum).
+		WillReturnRows(pgxmock.NewRows([]string{"last_height"}).AddRow(int64(99)))
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO deposits").
+		WithArgs(accountID, "USDC", amount("2.5"), ethAddress, txHash, 1, networkEthereum,
+			int64(100), fakeBlockHash(100), int64(1), 12, 24).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectExec("UPDATE deposit_addresses").
+		WithArgs(networkEthereum, ethAddress).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("INSERT INTO scanned_blocks").
+		WithArgs(networkEthereum, int64(100), fakeBlockHash(100)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("DELETE FROM scanned_blocks").
+		WithArgs(networkEthereum, int64(100)-maxReorgDepth).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectExec("INSERT INTO chain_scan_state").
+		WithArgs(networkEthereum, int64(100), fakeBlockHash(100)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	if err := l.scanTokenTransfers(context.Background()); err != nil {
+		t.Fatalf("scanTokenTransfers() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
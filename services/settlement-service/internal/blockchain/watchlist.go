@@ -0,0 +1,57 @@
+// BitCurrent Exchange - Deposit Address Watch-List
+package blockchain
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// WatchedAddress is a deposit address the listener credits to an account
+type WatchedAddress struct {
+	AccountID uuid.UUID
+	Currency  string
+	Network   string
+	Address   string
+}
+
+// WatchList is the set of deposit addresses the listener scans for.
+// Addresses stay watched after rotation, since senders may reuse them.
+type WatchList struct {
+	mu        sync.RWMutex
+	addresses map[string]WatchedAddress
+}
+
+// NewWatchList creates an empty watch-list
+func NewWatchList() *WatchList {
+	return &WatchList{addresses: make(map[string]WatchedAddress)}
+}
+
+// Watch adds an address to the watch-list
+func (w *WatchList) Watch(addr WatchedAddress) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.addresses[watchKey(addr.Network, addr.Address)] = addr
+}
+
+// Lookup returns the watched address on network, if any
+func (w *WatchList) Lookup(network, address string) (WatchedAddress, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	addr, ok := w.addresses[watchKey(network, address)]
+	return addr, ok
+}
+
+// Len returns the number of watched addresses
+func (w *WatchList) Len() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.addresses)
+}
+
+// Ethereum addresses are case-insensitive (EIP-55 case is only a checksum)
+// and bech32 addresses are lowercase, so keys are lowercased
+func watchKey(network, address string) string {
+	return network + ":" + strings.ToLower(address)
+}
@@ -0,0 +1,35 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// Lookups ignore address case but not network, and rotated addresses stay
+// watched alongside their replacements
+func TestWatchList(t *testing.T) {
+	w := NewWatchList()
+	accountID := uuid.New()
+	old := WatchedAddress{AccountID: accountID, Currency: "ETH", Network: "ethereum", Address: "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"}
+	rotated := WatchedAddress{AccountID: accountID, Currency: "ETH", Network: "ethereum", Address: "0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0"}
+	w.Watch(old)
+	w.Watch(rotated)
+	w.Watch(old)
+
+	if w.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", w.Len())
+	}
+	for _, want := range []WatchedAddress{old, rotated} {
+		got, ok := w.Lookup("ethereum", want.Address)
+		if !ok || got != want {
+			t.Errorf("Lookup(%s) = %+v, %v; want %+v", want.Address, got, ok, want)
+		}
+	}
+	if got, ok := w.Lookup("ethereum", "0x9858effd232b4033e47d90003d41ec34ecaeda94"); !ok || got != old {
+		t.Errorf("Lookup(lowercase) = %+v, %v; want %+v", got, ok, old)
+	}
+	if _, ok := w.Lookup("bitcoin", old.Address); ok {
+		t.Error("Lookup(bitcoin) found an ethereum address")
+	}
+}
@@ -0,0 +1,133 @@
+// BitCurrent Exchange - Withdrawal Approval Handler
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/withdrawal"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// ApprovalHandler serves the withdrawal approval queue to admins
+type ApprovalHandler struct {
+	approvals *withdrawal.Approvals
+	logger    *zap.Logger
+}
+
+func NewApprovalHandler(approvals *withdrawal.Approvals, logger *zap.Logger) *ApprovalHandler {
+	return &ApprovalHandler{
+		approvals: approvals,
+		logger:    logger,
+	}
+}
+
+// AdminHeader carries the ID of the admin the API gateway authenticated.
+// Approval routes are internal, so only the gateway can set it.
+const AdminHeader = "X-Admin-ID"
+
+type WithdrawalDecisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ListQueue returns the withdrawals waiting for approval
+func (h *ApprovalHandler) ListQueue(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	queue, err := h.approvals.Queue(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list withdrawal approvals", zap.Error(err))
+		respondError(w, http.StatusInternalServerError, "Failed to list approval queue")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"withdrawals": queue,
+	})
+}
+
+// ListDecisions returns every approval and rejection of a withdrawal
+func (h *ApprovalHandler) ListDecisions(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid withdrawal ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	decisions, err := h.approvals.Decisions(ctx, id)
+	if err != nil {
+		h.logger.Error("Failed to list withdrawal decisions", zap.Error(err))
+		respondError(w, http.StatusInternalServerError, "Failed to list approvals")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"approvals": decisions,
+	})
+}
+
+// Approve records an admin's approval of a withdrawal
+func (h *ApprovalHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, h.approvals.Approve)
+}
+
+// Reject records an admin's rejection of a withdrawal
+func (h *ApprovalHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, h.approvals.Reject)
+}
+
+func (h *ApprovalHandler) decide(w http.ResponseWriter, r *http.Request,
+	decide func(ctx context.Context, withdrawalID, approverID uuid.UUID, reason string) (*withdrawal.ApprovalResult, error)) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid withdrawal ID")
+		return
+	}
+
+	approverID, err := uuid.Parse(r.Header.Get(AdminHeader))
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Authenticated admin required")
+		return
+	}
+
+	var req WithdrawalDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	result, err := decide(ctx, id, approverID, req.Reason)
+	switch {
+	case errors.Is(err, withdrawal.ErrWithdrawalNotFound):
+		respondError(w, http.StatusNotFound, "Withdrawal not found")
+	case errors.Is(err, withdrawal.ErrNotApprover),
+		errors.Is(err, withdrawal.ErrSelfApproval):
+		respondError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, withdrawal.ErrWithdrawalNotPending),
+		errors.Is(err, withdrawal.ErrWithdrawalExpired),
+		errors.Is(err, withdrawal.ErrAlreadyDecided):
+		respondError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, withdrawal.ErrReasonRequired):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		h.logger.Error("Failed to record withdrawal decision",
+			zap.String("withdrawal_id", id.String()),
+			zap.Error(err),
+		)
+		respondError(w, http.StatusInternalServerError, "Failed to record decision")
+	default:
+		respondJSON(w, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,107 @@
+// BitCurrent Exchange - Bitcoin Transaction Signing Handler
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/withdrawal"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// BitcoinTxHandler hands unsigned withdrawal PSBTs to the signers and takes
+// their signatures back
+type BitcoinTxHandler struct {
+	builder *withdrawal.BitcoinTxBuilder
+	logger  *zap.Logger
+}
+
+func NewBitcoinTxHandler(builder *withdrawal.BitcoinTxBuilder, logger *zap.Logger) *BitcoinTxHandler {
+	return &BitcoinTxHandler{
+		builder: builder,
+		logger:  logger,
+	}
+}
+
+type SubmitSignaturesRequest struct {
+	PSBT string `json:"psbt"`
+}
+
+// GetTransaction returns a withdrawal transaction with its PSBT
+func (h *BitcoinTxHandler) GetTransaction(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.builder.Get(ctx, id)
+	if errors.Is(err, withdrawal.ErrBitcoinTransactionNotFound) {
+		respondError(w, http.StatusNotFound, "Transaction not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to load bitcoin transaction", zap.Error(err))
+		respondError(w, http.StatusInternalServerError, "Failed to load transaction")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, tx)
+}
+
+// SubmitSignatures merges a signer's PSBT. The transaction is broadcast
+// as soon as every input is signed.
+func (h *BitcoinTxHandler) SubmitSignatures(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	var req SubmitSignaturesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PSBT == "" {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	tx, err := h.builder.SubmitSignatures(ctx, id, req.PSBT)
+	switch {
+	case errors.Is(err, withdrawal.ErrBitcoinTransactionNotFound):
+		respondError(w, http.StatusNotFound, "Transaction not found")
+	case errors.Is(err, withdrawal.ErrAlreadyBroadcast):
+		respondError(w, http.StatusConflict, "Transaction has already been broadcast")
+	case errors.Is(err, withdrawal.ErrBroadcastRejected):
+		// Its withdrawals are back in the queue for a new transaction
+		respondError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, withdrawal.ErrBroadcastFailed):
+		// The signatures are kept and the broadcast is retried
+		h.logger.Warn("Bitcoin transaction broadcast failed",
+			zap.String("bitcoin_transaction_id", id.String()),
+			zap.Error(err),
+		)
+		respondError(w, http.StatusServiceUnavailable, "Transaction signed; broadcast will be retried")
+	case errors.Is(err, withdrawal.ErrInvalidPSBT),
+		errors.Is(err, withdrawal.ErrPSBTMismatch),
+		errors.Is(err, withdrawal.ErrInvalidSignature):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		h.logger.Error("Failed to submit signatures",
+			zap.String("bitcoin_transaction_id", id.String()),
+			zap.Error(err),
+		)
+		respondError(w, http.StatusInternalServerError, "Failed to submit signatures")
+	default:
+		respondJSON(w, http.StatusOK, tx)
+	}
+}
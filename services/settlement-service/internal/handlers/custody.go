@@ -0,0 +1,56 @@
+// BitCurrent Exchange - Custody Split Handler
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/withdrawal"
+	"go.uber.org/zap"
+)
+
+// CustodyHandler reports how each asset is spread over the hot, warm and
+// cold wallets and the moves proposed to rebalance it
+type CustodyHandler struct {
+	rebalancer *withdrawal.Rebalancer
+	logger     *zap.Logger
+}
+
+func NewCustodyHandler(rebalancer *withdrawal.Rebalancer, logger *zap.Logger) *CustodyHandler {
+	return &CustodyHandler{
+		rebalancer: rebalancer,
+		logger:     logger,
+	}
+}
+
+// GetSplit returns each asset's split as of the rebalancer's last pass
+func (h *CustodyHandler) GetSplit(w http.ResponseWriter, r *http.Request) {
+	splits, measuredAt := h.rebalancer.Split()
+	if measuredAt.IsZero() {
+		respondError(w, http.StatusServiceUnavailable, "Custody has not been measured yet")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"assets":      splits,
+		"measured_at": measuredAt,
+	})
+}
+
+// ListRebalances returns the moves waiting for signatures or confirmation
+func (h *CustodyHandler) ListRebalances(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rebalances, err := h.rebalancer.Open(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list custody rebalances", zap.Error(err))
+		respondError(w, http.StatusInternalServerError, "Failed to list rebalances")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"rebalances": rebalances,
+	})
+}
@@ -4,25 +4,41 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
 type DepositHandler struct {
-	db     *database.PostgresDB
-	logger *zap.Logger
+	db        *database.PostgresDB
+	addresses *wallet.AddressAllocator
+	watchList *blockchain.WatchList
+	policy    *blockchain.ConfirmationPolicy
+	logger    *zap.Logger
 }
 
-func NewDepositHandler(db *database.PostgresDB, logger *zap.Logger) *DepositHandler {
+func NewDepositHandler(
+	db *database.PostgresDB,
+	addresses *wallet.AddressAllocator,
+	watchList *blockchain.WatchList,
+	policy *blockchain.ConfirmationPolicy,
+	logger *zap.Logger,
+) *DepositHandler {
 	return &DepositHandler{
-		db:     db,
-		logger: logger,
+		db:        db,
+		addresses: addresses,
+		watchList: watchList,
+		policy:    policy,
+		logger:    logger,
 	}
 }
 
@@ -38,6 +54,9 @@ type GenerateAddressResponse struct {
 	Message string `json:"message"`
 }
 
+// GenerateAddress returns the account's deposit address for a currency.
+// The same address is returned until it receives funds, then a new one is
+// derived from the network's xpub.
 func (h *DepositHandler) GenerateAddress(w http.ResponseWriter, r *http.Request) {
 	var req GenerateAddressRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -50,38 +69,56 @@ func (h *DepositHandler) GenerateAddress(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// TODO: Generate actual deposit address based on currency
-	// For BTC: Use Bitcoin Core RPC or HD wallet derivation
-	// For ETH: Use go-ethereum to derive address
-	// For now, generate a mock address
+	accountID, err := uuid.Parse(req.AccountID)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid account ID")
+		return
+	}
 
-	var address string
-	switch req.Currency {
-	case "BTC":
-		address = fmt.Sprintf("bc1q%s", generateMockHash(28))
-		if req.Network == "" {
-			req.Network = "bitcoin"
-		}
-	case "ETH", "MATIC":
-		address = fmt.Sprintf("0x%s", generateMockHash(40))
-		if req.Network == "" {
-			req.Network = "ethereum"
-		}
-	default:
+	network, err := wallet.ChainForCurrency(req.Currency)
+	if err != nil {
 		respondError(w, http.StatusBadRequest, "Unsupported currency")
 		return
 	}
+	if req.Network != "" && req.Network != network {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("%s deposits are only accepted on %s", req.Currency, network))
+		return
+	}
 
-	h.logger.Info("Deposit address generated",
-		zap.String("account_id", req.AccountID),
-		zap.String("currency", req.Currency),
-		zap.String("address", address),
-	)
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	addr, created, err := h.addresses.Issue(ctx, accountID, req.Currency, network)
+	if errors.Is(err, wallet.ErrChainDisabled) {
+		respondError(w, http.StatusServiceUnavailable, "Deposits are not enabled on "+network)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to issue deposit address",
+			zap.String("account_id", req.AccountID),
+			zap.String("currency", req.Currency),
+			zap.Error(err),
+		)
+		respondError(w, http.StatusInternalServerError, "Failed to generate deposit address")
+		return
+	}
+
+	h.watchList.Watch(blockchain.WatchedAddress{
+		AccountID: accountID,
+		Currency:  addr.Currency,
+		Network:   addr.Chain,
+		Address:   addr.Address,
+	})
+
+	message := "Existing deposit address returned"
+	if created {
+		message = "Deposit address generated successfully"
+	}
 
 	respondJSON(w, http.StatusOK, GenerateAddressResponse{
-		Address: address,
-		Network: req.Network,
-		Message: "Deposit address generated successfully",
+		Address: addr.Address,
+		Network: addr.Chain,
+		Message: message,
 	})
 }
 
@@ -90,6 +127,7 @@ type ProcessDepositRequest struct {
 	Currency      string `json:"currency"`
 	Amount        string `json:"amount"`
 	TxID          string `json:"txid"`
+	Vout          int    `json:"vout"`
 	Address       string `json:"address"`
 	Network       string `json:"network"`
 	Confirmations int    `json:"confirmations"`
@@ -102,17 +140,31 @@ func (h *DepositHandler) ProcessDeposit(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
+	amount, err := decimal.ParseAmount(req.Amount, req.Currency)
+	if err != nil || !amount.IsPositive() {
+		respondError(w, http.StatusBadRequest, "Invalid amount")
+		return
+	}
 
-	// Check required confirmations
-	requiredConf := 6 // Default for BTC
-	if req.Currency == "ETH" {
-		requiredConf = 12
+	if req.Network == "" {
+		if req.Network, err = wallet.ChainForCurrency(req.Currency); err != nil {
+			respondError(w, http.StatusBadRequest, "Unsupported currency")
+			return
+		}
+	}
+
+	// Thresholds are fixed when the deposit is first recorded
+	required, err := h.policy.Resolve(req.Currency, req.Network, amount)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("%s deposits are not accepted on %s", req.Currency, req.Network))
+		return
 	}
 
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
 	status := "pending"
-	if req.Confirmations >= requiredConf {
+	if req.Confirmations >= required.Credit {
 		status = "confirmed"
 	}
 
@@ -120,18 +172,18 @@ func (h *DepositHandler) ProcessDeposit(w http.ResponseWriter, r *http.Request)
 	var depositID uuid.UUID
 	query := `
 		INSERT INTO deposits (
-			account_id, currency, amount, address, txid, network,
-			confirmations, required_confirmations, status
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		ON CONFLICT (txid) DO UPDATE
-		SET confirmations = $7, status = $9, updated_at = NOW()
+			account_id, currency, amount, address, txid, vout, network,
+			confirmations, required_confirmations, withdrawable_confirmations, status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (txid, vout) DO UPDATE
+		SET confirmations = $8, status = $11, updated_at = NOW()
 		RETURNING id
 	`
 
-	err := h.db.Pool.QueryRow(
+	err = h.db.Pool.QueryRow(
 		ctx, query,
-		req.AccountID, req.Currency, req.Amount, req.Address, req.TxID,
-		req.Network, req.Confirmations, requiredConf, status,
+		req.AccountID, req.Currency, amount, req.Address, req.TxID, req.Vout,
+		req.Network, req.Confirmations, required.Credit, required.Withdraw, status,
 	).Scan(&depositID)
 
 	if err != nil {
@@ -140,6 +192,16 @@ func (h *DepositHandler) ProcessDeposit(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// A funded address is rotated on the account's next request
+	if req.Address != "" {
+		if err := h.addresses.MarkFunded(ctx, req.Network, req.Address); err != nil {
+			h.logger.Warn("Failed to mark deposit address funded",
+				zap.String("address", req.Address),
+				zap.Error(err),
+			)
+		}
+	}
+
 	// If confirmed, credit the account
 	if status == "confirmed" {
 		// TODO: Call ledger service to credit balance
@@ -147,7 +209,7 @@ func (h *DepositHandler) ProcessDeposit(w http.ResponseWriter, r *http.Request)
 		h.logger.Info("Deposit confirmed and credited",
 			zap.String("deposit_id", depositID.String()),
 			zap.String("account_id", req.AccountID),
-			zap.String("amount", req.Amount),
+			zap.String("amount", amount.String()),
 		)
 	}
 
@@ -155,7 +217,8 @@ func (h *DepositHandler) ProcessDeposit(w http.ResponseWriter, r *http.Request)
 		"deposit_id":    depositID.String(),
 		"status":        status,
 		"confirmations": req.Confirmations,
-		"required":      requiredConf,
+		"required":      required.Credit,
+		"withdrawable":  required.Withdraw,
 	})
 }
 
@@ -167,29 +230,38 @@ func (h *DepositHandler) GetDeposit(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	var deposit struct {
-		ID            string `json:"id"`
-		AccountID     string `json:"account_id"`
-		Currency      string `json:"currency"`
-		Amount        string `json:"amount"`
-		TxID          string `json:"txid"`
-		Confirmations int    `json:"confirmations"`
-		Required      int    `json:"required_confirmations"`
-		Status        string `json:"status"`
-		CreatedAt     string `json:"created_at"`
+		ID             string     `json:"id"`
+		AccountID      string     `json:"account_id"`
+		Currency       string     `json:"currency"`
+		Network        *string    `json:"network,omitempty"`
+		Amount         string     `json:"amount"`
+		TxID           string     `json:"txid"`
+		Vout           *int       `json:"vout,omitempty"`
+		Confirmations  int        `json:"confirmations"`
+		Required       int        `json:"required_confirmations"`
+		Withdrawable   int        `json:"withdrawable_confirmations"`
+		Status         string     `json:"status"`
+		Tradable       bool       `json:"tradable"`
+		CanWithdraw    bool       `json:"withdrawable"`
+		CreditedAt     *time.Time `json:"credited_at,omitempty"`
+		WithdrawableAt *time.Time `json:"withdrawable_at,omitempty"`
+		CreatedAt      string     `json:"created_at"`
 	}
 	var createdAt time.Time
 
 	query := `
-		SELECT id, account_id, currency, amount, txid, confirmations,
-		       required_confirmations, status, created_at
+		SELECT id, account_id, currency, network, amount, txid, vout, confirmations,
+		       required_confirmations, withdrawable_confirmations, status,
+		       credited_at, withdrawable_at, created_at
 		FROM deposits
 		WHERE id = $1
 	`
 
 	err := h.db.Pool.QueryRow(ctx, query, depositID).Scan(
-		&deposit.ID, &deposit.AccountID, &deposit.Currency, &deposit.Amount,
-		&deposit.TxID, &deposit.Confirmations, &deposit.Required,
-		&deposit.Status, &createdAt,
+		&deposit.ID, &deposit.AccountID, &deposit.Currency, &deposit.Network, &deposit.Amount,
+		&deposit.TxID, &deposit.Vout, &deposit.Confirmations, &deposit.Required,
+		&deposit.Withdrawable, &deposit.Status,
+		&deposit.CreditedAt, &deposit.WithdrawableAt, &createdAt,
 	)
 
 	if err != nil {
@@ -198,20 +270,12 @@ func (h *DepositHandler) GetDeposit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	deposit.CreatedAt = createdAt.Format(time.RFC3339)
+	deposit.Tradable = deposit.Status == "credited"
+	deposit.CanWithdraw = deposit.Tradable && deposit.WithdrawableAt != nil
 
 	respondJSON(w, http.StatusOK, deposit)
 }
 
-// Helper function to generate mock hash
-func generateMockHash(length int) string {
-	chars := "0123456789abcdef"
-	result := ""
-	for i := 0; i < length; i++ {
-		result += string(chars[i%len(chars)])
-	}
-	return result
-}
-
 // Helper functions
 
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+// BIP84 test vector mnemonic; its first receive address is
+// bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func newTestDepositHandler(t *testing.T) (*DepositHandler, *blockchain.WatchList, pgxmock.PgxPoolIface) {
+	t.Helper()
+	master, err := wallet.MasterKeyFromMnemonic(testMnemonic, "", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := wallet.AccountXpub(master, wallet.ChainBitcoin, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hd, err := wallet.NewHDWallet(wallet.HDConfig{Network: "mainnet", BitcoinXpub: xpub}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+
+	db := database.New(mock, zap.NewNop())
+	watchList := blockchain.NewWatchList()
+	h := NewDepositHandler(db, wallet.NewAddressAllocator(db, hd, zap.NewNop()), watchList, blockchain.DefaultConfirmationPolicy(), zap.NewNop())
+	return h, watchList, mock
+}
+
+// A newly derived address is watched as soon as it is handed out, so a
+// deposit to it is credited without waiting for a restart
+func TestGenerateAddressWatchesNewAddress(t *testing.T) {
+	h, watchList, mock := newTestDepositHandler(t)
+	accountID := uuid.New()
+	const address = "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT next_index FROM hd_index_counters").
+		WithArgs(wallet.ChainBitcoin).
+		WillReturnRows(pgxmock.NewRows([]string{"next_index"}).AddRow(int64(0)))
+	mock.ExpectQuery("FROM deposit_addresses").
+		WithArgs(accountID, "BTC", wallet.ChainBitcoin).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery("INSERT INTO deposit_addresses").
+		WithArgs(accountID, "BTC", wallet.ChainBitcoin, int64(0), "m/84'/0'/0'/0/0", address).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(uuid.New(), time.Now()))
+	mock.ExpectExec("UPDATE hd_index_counters").
+		WithArgs(wallet.ChainBitcoin, int64(1)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	body, _ := json.Marshal(GenerateAddressRequest{AccountID: accountID.String(), Currency: "BTC"})
+	rec := httptest.NewRecorder()
+	h.GenerateAddress(rec, httptest.NewRequest(http.MethodPost, "/deposits/address", bytes.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resp GenerateAddressResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Address != address || resp.Network != wallet.ChainBitcoin {
+		t.Errorf("response = %+v, want %s on bitcoin", resp, address)
+	}
+
+	watched, ok := watchList.Lookup(wallet.ChainBitcoin, address)
+	if !ok {
+		t.Fatal("new address is not on the watch-list")
+	}
+	if watched.AccountID != accountID || watched.Currency != "BTC" {
+		t.Errorf("watched = %+v, want BTC for %s", watched, accountID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/banking"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
@@ -39,16 +40,16 @@ func NewGBPPaymentHandler(
 }
 
 type InitiateGBPDepositRequest struct {
-	AccountID string  `json:"account_id"`
-	Amount    float64 `json:"amount"`
+	AccountID string          `json:"account_id"`
+	Amount    decimal.Decimal `json:"amount"`
 }
 
 type InitiateGBPDepositResponse struct {
-	DepositID    string      `json:"deposit_id"`
-	Reference    string      `json:"reference"`
-	Amount       float64     `json:"amount"`
-	BankDetails  BankDetails `json:"bank_details"`
-	Instructions string      `json:"instructions"`
+	DepositID    string          `json:"deposit_id"`
+	Reference    string          `json:"reference"`
+	Amount       decimal.Decimal `json:"amount"`
+	BankDetails  BankDetails     `json:"bank_details"`
+	Instructions string          `json:"instructions"`
 }
 
 type BankDetails struct {
@@ -65,8 +66,8 @@ func (h *GBPPaymentHandler) InitiateGBPDeposit(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	if req.Amount <= 0 {
-		respondError(w, http.StatusBadRequest, "Amount must be positive")
+	amount, ok := validateGBPAmount(w, req.Amount)
+	if !ok {
 		return
 	}
 
@@ -75,14 +76,13 @@ func (h *GBPPaymentHandler) InitiateGBPDeposit(w http.ResponseWriter, r *http.Re
 
 	// Create deposit record
 	var depositID uuid.UUID
-	amountStr := fmt.Sprintf("%.2f", req.Amount)
 	query := `
 		INSERT INTO deposits (account_id, currency, amount, status)
 		VALUES ($1, 'GBP', $2, 'pending')
 		RETURNING id
 	`
 
-	err := h.db.Pool.QueryRow(ctx, query, req.AccountID, amountStr).Scan(&depositID)
+	err := h.db.Pool.QueryRow(ctx, query, req.AccountID, amount).Scan(&depositID)
 	if err != nil {
 		h.logger.Error("Failed to create deposit", zap.Error(err))
 		respondError(w, http.StatusInternalServerError, "Failed to initiate deposit")
@@ -95,21 +95,21 @@ func (h *GBPPaymentHandler) InitiateGBPDeposit(w http.ResponseWriter, r *http.Re
 	h.logger.Info("GBP deposit initiated",
 		zap.String("deposit_id", depositID.String()),
 		zap.String("reference", reference),
-		zap.Float64("amount", req.Amount),
+		zap.String("amount", amount.String()),
 	)
 
 	// Return bank details for transfer
 	respondJSON(w, http.StatusCreated, InitiateGBPDepositResponse{
 		DepositID: depositID.String(),
 		Reference: reference,
-		Amount:    req.Amount,
+		Amount:    amount,
 		BankDetails: BankDetails{
 			AccountName:   "BitCurrent Exchange Ltd",
 			SortCode:      "04-00-75", // ClearBank sort code
 			AccountNumber: "12345678", // TODO: Use real safeguarding account
 			BankName:      "ClearBank Limited",
 		},
-		Instructions: fmt.Sprintf("Transfer £%.2f to the account above using reference: %s", req.Amount, reference),
+		Instructions: fmt.Sprintf("Transfer £%s to the account above using reference: %s", amount, reference),
 	})
 }
 
@@ -146,7 +146,7 @@ func (h *GBPPaymentHandler) ProcessGBPWithdrawal(w http.ResponseWriter, r *http.
 	var withdrawal struct {
 		ID        uuid.UUID
 		AccountID uuid.UUID
-		Amount    string
+		Amount    decimal.Decimal
 		Status    string
 	}
 
@@ -170,15 +170,11 @@ func (h *GBPPaymentHandler) ProcessGBPWithdrawal(w http.ResponseWriter, r *http.
 		return
 	}
 
-	// Convert amount to float
-	var amount float64
-	fmt.Sscanf(withdrawal.Amount, "%f", &amount)
-
 	// Send Faster Payment via ClearBank
 	fpReq := banking.FasterPaymentRequest{
 		EndToEndID:            withdrawal.ID.String(),
 		Reference:             fmt.Sprintf("BitCurrent Withdrawal"),
-		Amount:                amount,
+		Amount:                withdrawal.Amount,
 		CreditorAccountName:   req.AccountName,
 		CreditorSortCode:      req.SortCode,
 		CreditorAccountNumber: req.AccountNumber,
@@ -221,8 +217,8 @@ func (h *GBPPaymentHandler) ProcessGBPWithdrawal(w http.ResponseWriter, r *http.
 
 // InstantDepositRequest represents an instant deposit via Open Banking
 type InstantDepositRequest struct {
-	AccountID string  `json:"account_id"`
-	Amount    float64 `json:"amount"`
+	AccountID string          `json:"account_id"`
+	Amount    decimal.Decimal `json:"amount"`
 }
 
 func (h *GBPPaymentHandler) InitiateInstantDeposit(w http.ResponseWriter, r *http.Request) {
@@ -232,19 +228,23 @@ func (h *GBPPaymentHandler) InitiateInstantDeposit(w http.ResponseWriter, r *htt
 		return
 	}
 
+	amount, ok := validateGBPAmount(w, req.Amount)
+	if !ok {
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
 	// Create deposit record
 	var depositID uuid.UUID
-	amountStr := fmt.Sprintf("%.2f", req.Amount)
 	query := `
 		INSERT INTO deposits (account_id, currency, amount, status)
 		VALUES ($1, 'GBP', $2, 'pending')
 		RETURNING id
 	`
 
-	err := h.db.Pool.QueryRow(ctx, query, req.AccountID, amountStr).Scan(&depositID)
+	err := h.db.Pool.QueryRow(ctx, query, req.AccountID, amount).Scan(&depositID)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to create deposit")
 		return
@@ -259,14 +259,28 @@ func (h *GBPPaymentHandler) InitiateInstantDeposit(w http.ResponseWriter, r *htt
 
 	h.logger.Info("Instant deposit initiated",
 		zap.String("deposit_id", depositID.String()),
-		zap.Float64("amount", req.Amount),
+		zap.String("amount", amount.String()),
 	)
 
 	respondJSON(w, http.StatusCreated, map[string]interface{}{
 		"deposit_id": depositID.String(),
 		"reference":  reference,
-		"amount":     req.Amount,
+		"amount":     amount,
 		"type":       "instant_deposit",
 		"next_step":  "Redirect to Open Banking for authorization",
 	})
 }
+
+// validateGBPAmount checks a GBP amount is positive and whole pence, writing
+// a 400 response if not. The amount is returned at 2 decimal places.
+func validateGBPAmount(w http.ResponseWriter, amount decimal.Decimal) (decimal.Decimal, bool) {
+	if !amount.IsPositive() {
+		respondError(w, http.StatusBadRequest, "Amount must be positive")
+		return decimal.Zero, false
+	}
+	if err := decimal.CheckPrecision(amount, "GBP"); err != nil {
+		respondError(w, http.StatusBadRequest, "Amount must be in whole pence")
+		return decimal.Zero, false
+	}
+	return amount.RoundCurrency("GBP", decimal.RoundDown), true
+}
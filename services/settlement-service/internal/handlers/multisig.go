@@ -0,0 +1,143 @@
+// BitCurrent Exchange - Multi-Signature Wallet Signing Handler
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// MultiSigHandler hands pending hot, warm and cold wallet spends to their
+// signers and collects the signatures
+type MultiSigHandler struct {
+	wallets map[string]*wallet.MultiSigWallet
+	logger  *zap.Logger
+}
+
+// NewMultiSigHandler serves wallets keyed by wallet type
+func NewMultiSigHandler(wallets map[string]*wallet.MultiSigWallet, logger *zap.Logger) *MultiSigHandler {
+	return &MultiSigHandler{
+		wallets: wallets,
+		logger:  logger,
+	}
+}
+
+type SubmitMultiSigSignatureRequest struct {
+	SignerIndex *int   `json:"signer_index"`
+	PSBT        string `json:"psbt"`
+}
+
+// wallet finds the wallet named in the path, answering 404 if there is none
+func (h *MultiSigHandler) wallet(w http.ResponseWriter, r *http.Request) *wallet.MultiSigWallet {
+	msw, ok := h.wallets[mux.Vars(r)["wallet"]]
+	if !ok {
+		respondError(w, http.StatusNotFound, "Wallet not found")
+	}
+	return msw
+}
+
+// ListPending returns a wallet's transactions waiting for signatures
+func (h *MultiSigHandler) ListPending(w http.ResponseWriter, r *http.Request) {
+	msw := h.wallet(w, r)
+	if msw == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	pending, err := msw.Pending(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list multi-sig transactions", zap.Error(err))
+		respondError(w, http.StatusInternalServerError, "Failed to list transactions")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"address":      msw.Address(),
+		"transactions": pending,
+	})
+}
+
+// GetTransaction returns a multi-sig transaction with its PSBT
+func (h *MultiSigHandler) GetTransaction(w http.ResponseWriter, r *http.Request) {
+	msw := h.wallet(w, r)
+	if msw == nil {
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := msw.Get(ctx, id)
+	if errors.Is(err, wallet.ErrMultiSigTxNotFound) {
+		respondError(w, http.StatusNotFound, "Transaction not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to load multi-sig transaction", zap.Error(err))
+		respondError(w, http.StatusInternalServerError, "Failed to load transaction")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, tx)
+}
+
+// SubmitSignature adds a signer's PSBT signatures. The transaction is
+// broadcast once enough signers have signed.
+func (h *MultiSigHandler) SubmitSignature(w http.ResponseWriter, r *http.Request) {
+	msw := h.wallet(w, r)
+	if msw == nil {
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	var req SubmitMultiSigSignatureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SignerIndex == nil || req.PSBT == "" {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	tx, err := msw.SignTransaction(ctx, id, *req.SignerIndex, req.PSBT)
+	switch {
+	case errors.Is(err, wallet.ErrMultiSigTxNotFound):
+		respondError(w, http.StatusNotFound, "Transaction not found")
+	case errors.Is(err, wallet.ErrMultiSigTxClosed):
+		respondError(w, http.StatusConflict, "Transaction is no longer collecting signatures")
+	case errors.Is(err, wallet.ErrMultiSigBroadcastFailed):
+		// The signatures are kept; submitting again retries
+		respondError(w, http.StatusBadGateway, err.Error())
+	case errors.Is(err, wallet.ErrUnknownSigner),
+		errors.Is(err, wallet.ErrInvalidMultiSigPSBT),
+		errors.Is(err, wallet.ErrMultiSigPSBTMismatch),
+		errors.Is(err, wallet.ErrInvalidMultiSigSignature):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		h.logger.Error("Failed to submit multi-sig signature",
+			zap.String("multisig_transaction_id", id.String()),
+			zap.Error(err),
+		)
+		respondError(w, http.StatusInternalServerError, "Failed to submit signature")
+	default:
+		respondJSON(w, http.StatusOK, tx)
+	}
+}
@@ -0,0 +1,123 @@
+// BitCurrent Exchange - Deposit Sweep Signing Handler
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/withdrawal"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// SweepHandler hands unsigned Ethereum deposit sweeps to the offline
+// deposit key and takes its signatures back. Bitcoin consolidations are
+// signed through /bitcoin/transactions like withdrawals.
+type SweepHandler struct {
+	sweeper *withdrawal.Sweeper
+	logger  *zap.Logger
+}
+
+func NewSweepHandler(sweeper *withdrawal.Sweeper, logger *zap.Logger) *SweepHandler {
+	return &SweepHandler{
+		sweeper: sweeper,
+		logger:  logger,
+	}
+}
+
+type SubmitSweepSignatureRequest struct {
+	// Signature is the hex [R || S || V] signature of the signing hash
+	Signature string `json:"signature"`
+}
+
+// ListUnsigned returns the sweeps waiting for a signature
+func (h *SweepHandler) ListUnsigned(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sweeps, err := h.sweeper.Unsigned(ctx)
+	if err != nil {
+		h.logger.Error("Failed to list unsigned sweeps", zap.Error(err))
+		respondError(w, http.StatusInternalServerError, "Failed to list sweeps")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"sweeps": sweeps,
+	})
+}
+
+// GetSweep returns a sweep
+func (h *SweepHandler) GetSweep(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid sweep ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sweep, err := h.sweeper.Get(ctx, id)
+	if errors.Is(err, withdrawal.ErrSweepNotFound) {
+		respondError(w, http.StatusNotFound, "Sweep not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to load sweep", zap.Error(err))
+		respondError(w, http.StatusInternalServerError, "Failed to load sweep")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, sweep)
+}
+
+// SubmitSignature signs an Ethereum sweep and broadcasts it
+func (h *SweepHandler) SubmitSignature(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid sweep ID")
+		return
+	}
+
+	var req SubmitSweepSignatureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Signature == "" {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(req.Signature, "0x"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Signature must be hex")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	sweep, err := h.sweeper.SubmitSignature(ctx, id, sig)
+	switch {
+	case errors.Is(err, withdrawal.ErrSweepNotFound):
+		respondError(w, http.StatusNotFound, "Sweep not found")
+	case errors.Is(err, withdrawal.ErrSweepNotUnsigned):
+		respondError(w, http.StatusConflict, "Sweep is not waiting for a signature")
+	case errors.Is(err, withdrawal.ErrEthereumRejected):
+		// The sweep is failed and built again on the next pass
+		respondError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, withdrawal.ErrInvalidSweepSignature):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		h.logger.Error("Failed to submit sweep signature",
+			zap.String("sweep_id", id.String()),
+			zap.Error(err),
+		)
+		respondError(w, http.StatusInternalServerError, "Failed to submit signature")
+	default:
+		respondJSON(w, http.StatusOK, sweep)
+	}
+}
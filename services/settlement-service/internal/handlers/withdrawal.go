@@ -4,122 +4,84 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/withdrawal"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
 type WithdrawalHandler struct {
-	db     *database.PostgresDB
-	logger *zap.Logger
+	db       *database.PostgresDB
+	requests *withdrawal.Requests
+	logger   *zap.Logger
 }
 
-func NewWithdrawalHandler(db *database.PostgresDB, logger *zap.Logger) *WithdrawalHandler {
+func NewWithdrawalHandler(db *database.PostgresDB, requests *withdrawal.Requests, logger *zap.Logger) *WithdrawalHandler {
 	return &WithdrawalHandler{
-		db:     db,
-		logger: logger,
+		db:       db,
+		requests: requests,
+		logger:   logger,
 	}
 }
 
-type ProcessWithdrawalRequest struct {
-	WithdrawalID string `json:"withdrawal_id"`
+type RequestWithdrawalRequest struct {
+	AccountID string `json:"account_id"`
+	Currency  string `json:"currency"`
+	Amount    string `json:"amount"`
+	Address   string `json:"address,omitempty"`
 }
 
-type ProcessWithdrawalResponse struct {
-	Success bool   `json:"success"`
-	TxID    string `json:"txid,omitempty"`
-	Status  string `json:"status"`
-	Message string `json:"message"`
-}
-
-func (h *WithdrawalHandler) ProcessWithdrawal(w http.ResponseWriter, r *http.Request) {
-	var req ProcessWithdrawalRequest
+// RequestWithdrawal records a withdrawal request and holds its amount plus
+// fee until the withdrawal completes, fails or is rejected
+func (h *WithdrawalHandler) RequestWithdrawal(w http.ResponseWriter, r *http.Request) {
+	var req RequestWithdrawalRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	if req.WithdrawalID == "" {
-		respondError(w, http.StatusBadRequest, "Withdrawal ID is required")
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-	defer cancel()
-
-	// Get withdrawal details
-	var withdrawal struct {
-		ID        uuid.UUID
-		AccountID uuid.UUID
-		Currency  string
-		Amount    string
-		Fee       string
-		Address   string
-		Network   string
-		Status    string
-	}
-
-	query := `
-		SELECT id, account_id, currency, amount, fee, address, network, status
-		FROM withdrawals
-		WHERE id = $1 AND status = 'pending'
-		FOR UPDATE
-	`
-
-	err := h.db.Pool.QueryRow(ctx, query, req.WithdrawalID).Scan(
-		&withdrawal.ID, &withdrawal.AccountID, &withdrawal.Currency,
-		&withdrawal.Amount, &withdrawal.Fee, &withdrawal.Address,
-		&withdrawal.Network, &withdrawal.Status,
-	)
-
+	accountID, err := uuid.Parse(req.AccountID)
 	if err != nil {
-		respondError(w, http.StatusNotFound, "Withdrawal not found or already processed")
+		respondError(w, http.StatusBadRequest, "Invalid account ID")
 		return
 	}
 
-	// TODO: Debit balance from ledger service before broadcasting
-
-	// TODO: Broadcast transaction to blockchain
-	// For BTC: Use Bitcoin Core RPC sendtoaddress
-	// For ETH: Use go-ethereum to create and sign transaction
-	// For now, simulate with mock txid
-
-	txid := fmt.Sprintf("0x%s", generateMockHash(64))
-
-	// Update withdrawal status
-	updateQuery := `
-		UPDATE withdrawals
-		SET status = 'processing',
-		    txid = $1,
-		    processed_at = NOW(),
-		    updated_at = NOW()
-		WHERE id = $2
-	`
-
-	_, err = h.db.Pool.Exec(ctx, updateQuery, txid, withdrawal.ID)
-	if err != nil {
-		h.logger.Error("Failed to update withdrawal", zap.Error(err))
-		respondError(w, http.StatusInternalServerError, "Failed to process withdrawal")
+	amount, err := decimal.ParseAmount(req.Amount, req.Currency)
+	if err != nil || !amount.IsPositive() {
+		respondError(w, http.StatusBadRequest, "Invalid amount")
 		return
 	}
 
-	h.logger.Info("Withdrawal processed",
-		zap.String("withdrawal_id", withdrawal.ID.String()),
-		zap.String("txid", txid),
-		zap.String("currency", withdrawal.Currency),
-	)
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
 
-	respondJSON(w, http.StatusOK, ProcessWithdrawalResponse{
-		Success: true,
-		TxID:    txid,
-		Status:  "processing",
-		Message: "Withdrawal transaction broadcast to blockchain",
+	requested, err := h.requests.Request(ctx, withdrawal.WithdrawalRequest{
+		AccountID: accountID,
+		Currency:  req.Currency,
+		Amount:    amount,
+		Address:   req.Address,
 	})
+	switch {
+	case errors.Is(err, withdrawal.ErrUnsupportedCurrency),
+		errors.Is(err, withdrawal.ErrAddressRequired):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, withdrawal.ErrInsufficientBalance):
+		respondError(w, http.StatusUnprocessableEntity, err.Error())
+	case err != nil:
+		h.logger.Error("Failed to request withdrawal",
+			zap.String("account_id", accountID.String()),
+			zap.Error(err),
+		)
+		respondError(w, http.StatusInternalServerError, "Failed to request withdrawal")
+	default:
+		respondJSON(w, http.StatusCreated, requested)
+	}
 }
 
 func (h *WithdrawalHandler) GetWithdrawalStatus(w http.ResponseWriter, r *http.Request) {
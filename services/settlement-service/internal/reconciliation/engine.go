@@ -6,11 +6,14 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"sort"
+	"math/big"
 	"time"
 
 	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/holds"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
@@ -20,6 +23,7 @@ type ReconciliationEngine struct {
 	db        *database.PostgresDB
 	btcClient *blockchain.BitcoinClient
 	ethClient *blockchain.EthereumClient
+	tokens    *blockchain.TokenRegistry
 	logger    *zap.Logger
 }
 
@@ -28,12 +32,14 @@ func NewReconciliationEngine(
 	db *database.PostgresDB,
 	btcClient *blockchain.BitcoinClient,
 	ethClient *blockchain.EthereumClient,
+	tokens *blockchain.TokenRegistry,
 	logger *zap.Logger,
 ) *ReconciliationEngine {
 	return &ReconciliationEngine{
 		db:        db,
 		btcClient: btcClient,
 		ethClient: ethClient,
+		tokens:    tokens,
 		logger:    logger,
 	}
 }
@@ -45,6 +51,19 @@ type ReconciliationResult struct {
 	MerkleRoot   string                    `json:"merkle_root"`
 	TotalUsers   int                       `json:"total_users"`
 	Status       string                    `json:"status"`
+	// StuckHolds are withdrawals whose funds are still held after they
+	// finished, or long after they were requested
+	StuckHolds   []StuckHold               `json:"stuck_holds,omitempty"`
+}
+
+// StuckHold is a withdrawal hold reconciliation expected to be closed
+type StuckHold struct {
+	WithdrawalID uuid.UUID `json:"withdrawal_id"`
+	AccountID    uuid.UUID `json:"account_id"`
+	Currency     string    `json:"currency"`
+	HeldAmount   string    `json:"held_amount"`
+	Status       string    `json:"status"`
+	HeldSince    time.Time `json:"held_since"`
 }
 
 // AssetReconciliation holds per-asset reconciliation data
@@ -56,8 +75,27 @@ type AssetReconciliation struct {
 	VariancePercent float64 `json:"variance_percent"`
 	Status          string  `json:"status"`
 	WalletCount     int     `json:"wallet_count"`
+	// Custody is what each of our wallets holds: the hot wallet, the
+	// deposit addresses not yet swept, and network fees paid moving funds
+	// between them
+	Custody map[string]string `json:"custody,omitempty"`
+	// Reserved is the balance reserved across wallets, which must equal
+	// what is left of the active order and withdrawal holds
+	Reserved string `json:"reserved,omitempty"`
 }
 
+// custodyAccounts name the system accounts holding customer crypto. They
+// run negative by what they hold.
+var custodyAccounts = map[string]string{
+	journal.HotWalletAccountID.String():      "hot_wallet",
+	journal.DepositAddressAccountID.String(): "deposit_addresses",
+	journal.NetworkFeeAccountID.String():     "network_fees",
+}
+
+// stuckHoldAge is how long a withdrawal may hold funds before it is flagged.
+// Unapproved requests expire and unseen broadcasts fail well before this.
+const stuckHoldAge = 7 * 24 * time.Hour
+
 // RunDailyReconciliation performs complete daily reconciliation
 func (e *ReconciliationEngine) RunDailyReconciliation(ctx context.Context) (*ReconciliationResult, error) {
 	e.logger.Info("Starting daily reconciliation")
@@ -70,6 +108,7 @@ func (e *ReconciliationEngine) RunDailyReconciliation(ctx context.Context) (*Rec
 	
 	// Get list of currencies
 	currencies := []string{"BTC", "ETH", "GBP", "SOL", "MATIC", "ADA"}
+	currencies = append(currencies, e.tokens.Symbols()...)
 	
 	for _, currency := range currencies {
 		assetResult, err := e.reconcileAsset(ctx, currency)
@@ -85,6 +124,13 @@ func (e *ReconciliationEngine) RunDailyReconciliation(ctx context.Context) (*Rec
 		result.Assets[currency] = *assetResult
 	}
 	
+	stuck, err := e.findStuckHolds(ctx)
+	if err != nil {
+		e.logger.Error("Failed to check withdrawal holds", zap.Error(err))
+		result.Status = "partial"
+	}
+	result.StuckHolds = stuck
+	
 	// Generate Merkle proof of reserves
 	merkleRoot, err := e.generateMerkleProof(ctx)
 	if err != nil {
@@ -104,6 +150,7 @@ func (e *ReconciliationEngine) RunDailyReconciliation(ctx context.Context) (*Rec
 		zap.String("status", result.Status),
 		zap.Int("assets", len(result.Assets)),
 		zap.Int("users", totalUsers),
+		zap.Int("stuck_holds", len(result.StuckHolds)),
 	)
 	
 	return result, nil
@@ -111,7 +158,7 @@ func (e *ReconciliationEngine) RunDailyReconciliation(ctx context.Context) (*Rec
 
 func (e *ReconciliationEngine) reconcileAsset(ctx context.Context, currency string) (*AssetReconciliation, error) {
 	// Get database balance (total of all user wallets)
-	var dbBalance string
+	var dbBalance decimal.Decimal
 	var walletCount int
 	
 	query := `
@@ -127,11 +174,39 @@ func (e *ReconciliationEngine) reconcileAsset(ctx context.Context, currency stri
 	
 	result := &AssetReconciliation{
 		Currency:        currency,
-		DatabaseBalance: dbBalance,
+		DatabaseBalance: dbBalance.String(),
 		WalletCount:     walletCount,
 		Status:          "OK",
 	}
 	
+	custody, err := e.getCustodyBreakdown(ctx, currency)
+	if err != nil {
+		return nil, err
+	}
+	result.Custody = custody
+	
+	// Every reserved unit belongs to an active hold
+	var reserved, open decimal.Decimal
+	reservedQuery := `
+		SELECT
+			COALESCE((SELECT SUM(reserved_balance) FROM wallets WHERE currency = $1), 0),
+			COALESCE((SELECT SUM(amount - consumed - released) FROM balance_holds WHERE status = 'active' AND currency = $1), 0)
+	`
+	if err := e.db.Pool.QueryRow(ctx, reservedQuery, currency).Scan(&reserved, &open); err != nil {
+		return nil, fmt.Errorf("failed to query balance holds: %w", err)
+	}
+	if !reserved.IsZero() || !open.IsZero() {
+		result.Reserved = reserved.String()
+	}
+	if !reserved.Equal(open) {
+		e.logger.Warn("Reserved balance does not match active holds",
+			zap.String("currency", currency),
+			zap.String("reserved_balance", reserved.String()),
+			zap.String("active_holds", open.String()),
+		)
+		result.Status = "ALERT"
+	}
+	
 	// For crypto assets, get on-chain balance
 	if currency == "BTC" {
 		chainBalance, err := e.getBitcoinChainBalance(ctx)
@@ -139,7 +214,7 @@ func (e *ReconciliationEngine) reconcileAsset(ctx context.Context, currency stri
 			e.logger.Warn("Failed to get Bitcoin chain balance", zap.Error(err))
 			result.Status = "WARNING"
 		} else {
-			result.ChainBalance = chainBalance
+			result.ChainBalance = chainBalance.String()
 			result.Difference = e.calculateDifference(dbBalance, chainBalance)
 			result.VariancePercent = e.calculateVariancePercent(dbBalance, chainBalance)
 			
@@ -153,10 +228,24 @@ func (e *ReconciliationEngine) reconcileAsset(ctx context.Context, currency stri
 			e.logger.Warn("Failed to get Ethereum chain balance", zap.Error(err))
 			result.Status = "WARNING"
 		} else {
-			result.ChainBalance = chainBalance
+			result.ChainBalance = chainBalance.String()
 			result.Difference = e.calculateDifference(dbBalance, chainBalance)
 			result.VariancePercent = e.calculateVariancePercent(dbBalance, chainBalance)
 			
+			if result.VariancePercent > 0.01 {
+				result.Status = "ALERT"
+			}
+		}
+	} else if token, ok := e.tokens.BySymbol(currency); ok {
+		chainBalance, err := e.getTokenChainBalance(ctx, token)
+		if err != nil {
+			e.logger.Warn("Failed to get token chain balance", zap.String("currency", currency), zap.Error(err))
+			result.Status = "WARNING"
+		} else {
+			result.ChainBalance = chainBalance.String()
+			result.Difference = e.calculateDifference(dbBalance, chainBalance)
+			result.VariancePercent = e.calculateVariancePercent(dbBalance, chainBalance)
+
 			if result.VariancePercent > 0.01 {
 				result.Status = "ALERT"
 			}
@@ -167,7 +256,78 @@ func (e *ReconciliationEngine) reconcileAsset(ctx context.Context, currency stri
 	return result, nil
 }
 
-func (e *ReconciliationEngine) getBitcoinChainBalance(ctx context.Context) (string, error) {
+// getCustodyBreakdown splits what the exchange holds of currency between
+// its custody accounts
+func (e *ReconciliationEngine) getCustodyBreakdown(ctx context.Context, currency string) (map[string]string, error) {
+	accountIDs := make([]string, 0, len(custodyAccounts))
+	for id := range custodyAccounts {
+		accountIDs = append(accountIDs, id)
+	}
+	rows, err := e.db.Pool.Query(ctx, `
+		SELECT account_id::text, balance
+		FROM wallets
+		WHERE currency = $1 AND account_id::text = ANY($2)
+	`, currency, accountIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query custody balances: %w", err)
+	}
+	defer rows.Close()
+
+	var custody map[string]string
+	for rows.Next() {
+		var accountID string
+		var balance decimal.Decimal
+		if err := rows.Scan(&accountID, &balance); err != nil {
+			return nil, err
+		}
+		if custody == nil {
+			custody = make(map[string]string)
+		}
+		custody[custodyAccounts[accountID]] = balance.Neg().String()
+	}
+	return custody, rows.Err()
+}
+
+// findStuckHolds returns active withdrawal holds whose withdrawal reached
+// a final status or is missing, or that are older than stuckHoldAge
+func (e *ReconciliationEngine) findStuckHolds(ctx context.Context) ([]StuckHold, error) {
+	rows, err := e.db.Pool.Query(ctx, `
+		SELECT h.reference_id, h.account_id, h.currency, h.amount - h.consumed - h.released,
+		       COALESCE(w.status, 'missing'), h.created_at
+		FROM balance_holds h
+		LEFT JOIN withdrawals w ON w.id = h.reference_id
+		WHERE h.reference_type = $1 AND h.status = 'active'
+		  AND (w.id IS NULL
+		       OR w.status IN ('completed', 'failed', 'cancelled', 'rejected', 'expired')
+		       OR h.created_at < $2)
+		ORDER BY h.created_at
+	`, holds.ReferenceWithdrawal, time.Now().Add(-stuckHoldAge))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stuck []StuckHold
+	for rows.Next() {
+		var h StuckHold
+		var amount decimal.Decimal
+		if err := rows.Scan(&h.WithdrawalID, &h.AccountID, &h.Currency, &amount, &h.Status, &h.HeldSince); err != nil {
+			return nil, err
+		}
+		h.HeldAmount = amount.String()
+		e.logger.Warn("Withdrawal hold stuck",
+			zap.String("withdrawal_id", h.WithdrawalID.String()),
+			zap.String("status", h.Status),
+			zap.String("currency", h.Currency),
+			zap.String("held", h.HeldAmount),
+			zap.Time("held_since", h.HeldSince),
+		)
+		stuck = append(stuck, h)
+	}
+	return stuck, rows.Err()
+}
+
+func (e *ReconciliationEngine) getBitcoinChainBalance(ctx context.Context) (decimal.Decimal, error) {
 	// Get all Bitcoin wallet addresses
 	query := `
 		SELECT DISTINCT address FROM wallets WHERE currency = 'BTC' AND address IS NOT NULL
@@ -175,11 +335,11 @@ func (e *ReconciliationEngine) getBitcoinChainBalance(ctx context.Context) (stri
 	
 	rows, err := e.db.Pool.Query(ctx, query)
 	if err != nil {
-		return "0", err
+		return decimal.Zero, err
 	}
 	defer rows.Close()
 	
-	var totalBalance float64
+	totalBalance := decimal.Zero
 	for rows.Next() {
 		var address string
 		if err := rows.Scan(&address); err != nil {
@@ -195,13 +355,13 @@ func (e *ReconciliationEngine) getBitcoinChainBalance(ctx context.Context) (stri
 			continue
 		}
 		
-		totalBalance += balance
+		totalBalance = totalBalance.Add(balance)
 	}
 	
-	return fmt.Sprintf("%.8f", totalBalance), nil
+	return totalBalance, nil
 }
 
-func (e *ReconciliationEngine) getEthereumChainBalance(ctx context.Context, currency string) (string, error) {
+func (e *ReconciliationEngine) getEthereumChainBalance(ctx context.Context, currency string) (decimal.Decimal, error) {
 	// Get all Ethereum wallet addresses
 	query := `
 		SELECT DISTINCT address FROM wallets WHERE currency = $1 AND address IS NOT NULL
@@ -209,38 +369,86 @@ func (e *ReconciliationEngine) getEthereumChainBalance(ctx context.Context, curr
 	
 	rows, err := e.db.Pool.Query(ctx, query, currency)
 	if err != nil {
-		return "0", err
+		return decimal.Zero, err
 	}
 	defer rows.Close()
 	
-	totalBalance := int64(0)
+	// Sum in wei; individual balances can exceed int64
+	totalWei := new(big.Int)
 	for rows.Next() {
 		var address string
 		if err := rows.Scan(&address); err != nil {
 			continue
 		}
 		
-		balance, err := e.ethClient.GetBalance(address)
+		balance, err := e.ethClient.GetBalance(ctx, address)
 		if err != nil {
 			continue
 		}
 		
-		totalBalance += balance.Int64()
+		totalWei.Add(totalWei, balance)
 	}
 	
 	// Convert wei to ETH
-	ethBalance := float64(totalBalance) / 1e18
-	return fmt.Sprintf("%.8f", ethBalance), nil
+	return decimal.NewFromBigInt(totalWei, decimal.ScaleOf(currency)), nil
+}
+
+// getTokenChainBalance sums the token's balance over its wallet addresses,
+// converting from the token's own decimals
+func (e *ReconciliationEngine) getTokenChainBalance(ctx context.Context, token blockchain.Token) (decimal.Decimal, error) {
+	rows, err := e.db.Pool.Query(ctx, `
+		SELECT DISTINCT address FROM wallets WHERE currency = $1 AND address IS NOT NULL
+	`, token.Symbol)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	defer rows.Close()
+
+	total := new(big.Int)
+	for rows.Next() {
+		var address string
+		if err := rows.Scan(&address); err != nil {
+			continue
+		}
+
+		balance, err := e.ethClient.GetTokenBalance(ctx, address, token.Contract)
+		if err != nil {
+			e.logger.Warn("Failed to get token balance for address",
+				zap.String("currency", token.Symbol),
+				zap.String("address", address),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		total.Add(total, balance)
+	}
+
+	return decimal.NewFromBigInt(total, token.Decimals), nil
 }
 
-func (e *ReconciliationEngine) calculateDifference(db, chain string) string {
-	// TODO: Implement proper decimal arithmetic
-	return "0"
+// calculateDifference returns chain - db; positive means the chain holds
+// more than customers are owed
+func (e *ReconciliationEngine) calculateDifference(db, chain decimal.Decimal) string {
+	return chain.Sub(db).String()
 }
 
-func (e *ReconciliationEngine) calculateVariancePercent(db, chain string) float64 {
-	// TODO: Implement proper calculation
-	return 0.0
+// calculateVariancePercent returns |chain - db| as a percentage of db
+func (e *ReconciliationEngine) calculateVariancePercent(db, chain decimal.Decimal) float64 {
+	diff := chain.Sub(db).Abs()
+	if db.IsZero() {
+		if diff.IsZero() {
+			return 0
+		}
+		return 100
+	}
+	
+	variance, err := diff.Mul(decimal.NewFromInt(100)).Div(db.Abs(), 6, decimal.RoundHalfUp)
+	if err != nil {
+		return 100
+	}
+	
+	return variance.Float64()
 }
 
 func (e *ReconciliationEngine) updateDepositConfirmations(ctx context.Context, depositID uuid.UUID, confirmations int) error {
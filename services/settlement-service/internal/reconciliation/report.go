@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
@@ -60,8 +61,7 @@ func (r *ReportGenerator) GenerateProofOfReserves(ctx context.Context, result *R
 			report.TotalReserves[currency] = asset.ChainBalance
 
 			// Calculate coverage ratio (reserves / liabilities)
-			// TODO: Implement proper decimal division
-			report.CoverageRatio[currency] = 1.0 // Placeholder
+			report.CoverageRatio[currency] = coverageRatio(asset.ChainBalance, asset.DatabaseBalance)
 		}
 	}
 
@@ -80,6 +80,28 @@ func (r *ReportGenerator) GenerateProofOfReserves(ctx context.Context, result *R
 	return report, nil
 }
 
+// coverageRatio returns reserves / liabilities. Zero liabilities are fully
+// covered by definition.
+func coverageRatio(reserves, liabilities string) float64 {
+	res, err := decimal.NewFromString(reserves)
+	if err != nil {
+		return 0
+	}
+	liab, err := decimal.NewFromString(liabilities)
+	if err != nil {
+		return 0
+	}
+	if liab.IsZero() {
+		return 1.0
+	}
+
+	ratio, err := res.Div(liab, 6, decimal.RoundDown)
+	if err != nil {
+		return 0
+	}
+	return ratio.Float64()
+}
+
 func (r *ReportGenerator) saveReport(ctx context.Context, report *ProofOfReservesReport) error {
 	// TODO: Create proof_of_reserves table
 	// For now, log the report
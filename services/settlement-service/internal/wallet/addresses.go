@@ -0,0 +1,211 @@
+// BitCurrent Exchange - Deposit Address Allocation
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// ErrUnsupportedCurrency means the currency has no deposit network
+var ErrUnsupportedCurrency = errors.New("unsupported deposit currency")
+
+// chainCurrencies lists the currencies deposited on each chain
+var chainCurrencies = map[string][]string{
+	ChainBitcoin:  {"BTC"},
+	ChainEthereum: {"ETH", "MATIC"},
+}
+
+// RegisterChainCurrency adds a currency deposited on chain, such as a
+// configured token. Call it at startup, before addresses are issued.
+func RegisterChainCurrency(chain, currency string) {
+	for _, c := range chainCurrencies[chain] {
+		if c == currency {
+			return
+		}
+	}
+	chainCurrencies[chain] = append(chainCurrencies[chain], currency)
+}
+
+// ChainForCurrency returns the network a currency is deposited on
+func ChainForCurrency(currency string) (string, error) {
+	for chain, currencies := range chainCurrencies {
+		for _, c := range currencies {
+			if c == currency {
+				return chain, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currency)
+}
+
+// DepositAddress is an HD-derived address assigned to an account
+type DepositAddress struct {
+	ID              uuid.UUID  `json:"id"`
+	AccountID       uuid.UUID  `json:"account_id"`
+	Currency        string     `json:"currency"`
+	Chain           string     `json:"chain"`
+	DerivationIndex uint32     `json:"derivation_index"`
+	DerivationPath  string     `json:"derivation_path"`
+	Address         string     `json:"address"`
+	FundedAt        *time.Time `json:"funded_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// AddressAllocator hands out deposit addresses, persisting the next index
+// per chain so no index is ever issued twice
+type AddressAllocator struct {
+	db     *database.PostgresDB
+	hd     *HDWallet
+	logger *zap.Logger
+}
+
+// NewAddressAllocator creates a new address allocator
+func NewAddressAllocator(db *database.PostgresDB, hd *HDWallet, logger *zap.Logger) *AddressAllocator {
+	return &AddressAllocator{
+		db:     db,
+		hd:     hd,
+		logger: logger,
+	}
+}
+
+// Issue returns the account's address for currency on chain. The address
+// is reused until it receives funds; after that a new one is derived at
+// the chain's next index. The second result reports whether the address
+// is new.
+func (a *AddressAllocator) Issue(ctx context.Context, accountID uuid.UUID, currency, chain string) (*DepositAddress, bool, error) {
+	if !a.hd.Enabled(chain) {
+		return nil, false, fmt.Errorf("%w: %s", ErrChainDisabled, chain)
+	}
+
+	var addr *DepositAddress
+	created := false
+	err := a.db.WithTx(ctx, func(tx pgx.Tx) error {
+		// The counter row lock serialises issuance per chain, so concurrent
+		// requests for the same account see each other's address
+		var index int64
+		err := tx.QueryRow(ctx, `
+			SELECT next_index FROM hd_index_counters WHERE chain = $1 FOR UPDATE
+		`, chain).Scan(&index)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrUnknownChain, chain)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock address index: %w", err)
+		}
+
+		addr, err = current(ctx, tx, accountID, currency, chain)
+		if err != nil || addr != nil {
+			return err
+		}
+
+		address, path, err := a.hd.DeriveAddress(chain, uint32(index))
+		if err != nil {
+			return err
+		}
+
+		addr = &DepositAddress{
+			AccountID:       accountID,
+			Currency:        currency,
+			Chain:           chain,
+			DerivationIndex: uint32(index),
+			DerivationPath:  path,
+			Address:         address,
+		}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO deposit_addresses (account_id, currency, chain, derivation_index, derivation_path, address)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at
+		`, accountID, currency, chain, index, path, address).Scan(&addr.ID, &addr.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to store deposit address: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, `
+			UPDATE hd_index_counters SET next_index = $2, updated_at = NOW() WHERE chain = $1
+		`, chain, index+1); err != nil {
+			return fmt.Errorf("failed to advance address index: %w", err)
+		}
+		created = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if created {
+		a.logger.Info("Deposit address allocated",
+			zap.String("account_id", accountID.String()),
+			zap.String("currency", currency),
+			zap.String("chain", chain),
+			zap.String("path", addr.DerivationPath),
+			zap.String("address", addr.Address),
+		)
+	}
+	return addr, created, nil
+}
+
+func current(ctx context.Context, tx pgx.Tx, accountID uuid.UUID, currency, chain string) (*DepositAddress, error) {
+	addr := &DepositAddress{AccountID: accountID, Currency: currency, Chain: chain}
+	var index int64
+	err := tx.QueryRow(ctx, `
+		SELECT id, derivation_index, derivation_path, address, created_at
+		FROM deposit_addresses
+		WHERE account_id = $1 AND currency = $2 AND chain = $3 AND funded_at IS NULL
+	`, accountID, currency, chain).Scan(&addr.ID, &index, &addr.DerivationPath, &addr.Address, &addr.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load deposit address: %w", err)
+	}
+	addr.DerivationIndex = uint32(index)
+	return addr, nil
+}
+
+// MarkFunded records that address has received funds, so the account's
+// next request is given a fresh address
+func (a *AddressAllocator) MarkFunded(ctx context.Context, chain, address string) error {
+	_, err := a.db.Pool.Exec(ctx, `
+		UPDATE deposit_addresses
+		SET funded_at = NOW()
+		WHERE chain = $1 AND LOWER(address) = LOWER($2) AND funded_at IS NULL
+	`, chain, address)
+	if err != nil {
+		return fmt.Errorf("failed to mark deposit address funded: %w", err)
+	}
+	return nil
+}
+
+// All returns every issued address, funded or not, for loading the
+// deposit listener's watch-list
+func (a *AddressAllocator) All(ctx context.Context) ([]DepositAddress, error) {
+	rows, err := a.db.Pool.Query(ctx, `
+		SELECT id, account_id, currency, chain, derivation_index, derivation_path, address, funded_at, created_at
+		FROM deposit_addresses
+		ORDER BY chain, derivation_index
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deposit addresses: %w", err)
+	}
+	defer rows.Close()
+
+	var addrs []DepositAddress
+	for rows.Next() {
+		var addr DepositAddress
+		var index int64
+		if err := rows.Scan(&addr.ID, &addr.AccountID, &addr.Currency, &addr.Chain, &index,
+			&addr.DerivationPath, &addr.Address, &addr.FundedAt, &addr.CreatedAt); err != nil {
+			return nil, err
+		}
+		addr.DerivationIndex = uint32(index)
+		addrs = append(addrs, addr)
+	}
+	return addrs, rows.Err()
+}
@@ -0,0 +1,138 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+// newTestAllocator issues Bitcoin addresses from the BIP84 test vector
+// account; Ethereum is disabled
+func newTestAllocator(t *testing.T) (*AddressAllocator, pgxmock.PgxPoolIface) {
+	t.Helper()
+	master, err := MasterKeyFromMnemonic(testMnemonic, "", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := AccountXpub(master, ChainBitcoin, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hd, err := NewHDWallet(HDConfig{Network: "mainnet", BitcoinXpub: xpub}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+	return NewAddressAllocator(database.New(mock, zap.NewNop()), hd, zap.NewNop()), mock
+}
+
+func expectIndexLock(mock pgxmock.PgxPoolIface, chain string, next int64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT next_index FROM hd_index_counters").
+		WithArgs(chain).
+		WillReturnRows(pgxmock.NewRows([]string{"next_index"}).AddRow(next))
+}
+
+// expectAllocation expects an account without an unfunded address to be
+// given the address at index, advancing the counter past it
+func expectAllocation(mock pgxmock.PgxPoolIface, accountID uuid.UUID, index int64, path, address string) {
+	expectIndexLock(mock, ChainBitcoin, index)
+	mock.ExpectQuery("FROM deposit_addresses").
+		WithArgs(accountID, "BTC", ChainBitcoin).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery("INSERT INTO deposit_addresses").
+		WithArgs(accountID, "BTC", ChainBitcoin, index, path, address).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(uuid.New(), time.Now()))
+	mock.ExpectExec("UPDATE hd_index_counters").
+		WithArgs(ChainBitcoin, index+1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+}
+
+// An account keeps its address until it is funded, then rotates to the
+// chain's next index
+func TestIssueReusesUntilFundedThenRotates(t *testing.T) {
+	a, mock := newTestAllocator(t)
+	ctx := context.Background()
+	accountID := uuid.New()
+	const first, second = "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"
+
+	expectAllocation(mock, accountID, 0, "m/84'/0'/0'/0/0", first)
+	addr, created, err := a.Issue(ctx, accountID, "BTC", ChainBitcoin)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if !created || addr.Address != first || addr.DerivationIndex != 0 {
+		t.Errorf("Issue() = %s at %d, created %v; want new %s at 0", addr.Address, addr.DerivationIndex, created, first)
+	}
+
+	// Unfunded, so the same address comes back and the index is not used
+	expectIndexLock(mock, ChainBitcoin, 1)
+	mock.ExpectQuery("FROM deposit_addresses").
+		WithArgs(accountID, "BTC", ChainBitcoin).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "derivation_index", "derivation_path", "address", "created_at"}).
+			AddRow(addr.ID, int64(0), "m/84'/0'/0'/0/0", first, addr.CreatedAt))
+	mock.ExpectCommit()
+	again, created, err := a.Issue(ctx, accountID, "BTC", ChainBitcoin)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if created || again.Address != first {
+		t.Errorf("Issue() = %s, created %v; want existing %s", again.Address, created, first)
+	}
+
+	mock.ExpectExec("UPDATE deposit_addresses").
+		WithArgs(ChainBitcoin, first).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	if err := a.MarkFunded(ctx, ChainBitcoin, first); err != nil {
+		t.Fatalf("MarkFunded() error = %v", err)
+	}
+
+	expectAllocation(mock, accountID, 1, "m/84'/0'/0'/0/1", second)
+	rotated, created, err := a.Issue(ctx, accountID, "BTC", ChainBitcoin)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if !created || rotated.Address != second || rotated.DerivationIndex != 1 {
+		t.Errorf("Issue() = %s at %d, created %v; want new %s at 1", rotated.Address, rotated.DerivationIndex, created, second)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIssueRejectsUnavailableChains(t *testing.T) {
+	a, mock := newTestAllocator(t)
+	ctx := context.Background()
+
+	if _, _, err := a.Issue(ctx, uuid.New(), "ETH", ChainEthereum); !errors.Is(err, ErrChainDisabled) {
+		t.Errorf("Issue(ethereum) error = %v, want ErrChainDisabled", err)
+	}
+
+	// An enabled chain without an index counter issues nothing
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT next_index FROM hd_index_counters").
+		WithArgs(ChainBitcoin).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectRollback()
+	if _, _, err := a.Issue(ctx, uuid.New(), "BTC", ChainBitcoin); !errors.Is(err, ErrUnknownChain) {
+		t.Errorf("Issue(bitcoin) error = %v, want ErrUnknownChain", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
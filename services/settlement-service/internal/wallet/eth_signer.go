@@ -0,0 +1,47 @@
+// BitCurrent Exchange - Ethereum Hot Wallet Signer
+package wallet
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+// EthereumKeySigner signs for the Ethereum hot wallet with a private key
+// held in memory. Deposit keys stay offline; only the hot wallet's key is
+// given to the server.
+type EthereumKeySigner struct {
+	key     *btcec.PrivateKey
+	address string
+}
+
+// NewEthereumKeySigner creates a signer from a hex-encoded secp256k1
+// private key
+func NewEthereumKeySigner(hexKey string) (*EthereumKeySigner, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil || len(b) != btcec.PrivKeyBytesLen {
+		return nil, errors.New("invalid Ethereum private key")
+	}
+	key, pub := btcec.PrivKeyFromBytes(b)
+	hash := keccak256(pub.SerializeUncompressed()[1:])
+	return &EthereumKeySigner{key: key, address: ChecksumAddress(hash[12:])}, nil
+}
+
+// Address returns the hot wallet's EIP-55 checksummed address
+func (s *EthereumKeySigner) Address() string {
+	return s.address
+}
+
+// SignHash signs a 32-byte hash, returning [R || S || V]
+func (s *EthereumKeySigner) SignHash(ctx context.Context, hash []byte) ([]byte, error) {
+	if len(hash) != 32 {
+		return nil, errors.New("hash must be 32 bytes")
+	}
+	// SignCompact returns [27 + recovery id || R || S], with low S
+	compact := ecdsa.SignCompact(s.key, hash, false)
+	return append(compact[1:], compact[0]-27), nil
+}
@@ -0,0 +1,36 @@
+package wallet
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestEthereumKeySigner(t *testing.T) {
+	// The EIP-155 example key and its address
+	signer, err := NewEthereumKeySigner("0x" + strings.Repeat("46", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := signer.Address(), "0x9d8A62f656a8d1615C1294fd71e9CFb3E4855A4F"; got != want {
+		t.Errorf("Address() = %s, want %s", got, want)
+	}
+
+	sig, err := signer.SignHash(context.Background(), make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sig) != 65 || sig[64] > 1 {
+		t.Errorf("signature %x is not [R || S || V]", sig)
+	}
+	// Low S, as Ethereum requires
+	if sig[32] >= 0x80 {
+		t.Errorf("S is in the upper half of the curve order")
+	}
+
+	for _, key := range []string{"", "46", strings.Repeat("zz", 32)} {
+		if _, err := NewEthereumKeySigner(key); err == nil {
+			t.Errorf("NewEthereumKeySigner(%q) succeeded", key)
+		}
+	}
+}
@@ -2,101 +2,382 @@
 package wallet
 
 import (
-	"crypto/rand"
-	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
-	"github.com/google/uuid"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/tyler-smith/go-bip39"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/sha3"
 )
 
-// HDWallet manages hierarchical deterministic wallet generation
+// Chains with HD-derived deposit addresses
+const (
+	ChainBitcoin  = "bitcoin"
+	ChainEthereum = "ethereum"
+)
+
+// BIP43 purposes and SLIP-44 coin types
+const (
+	purposeBIP44 = 44
+	purposeBIP84 = 84
+
+	coinBitcoin        = 0
+	coinBitcoinTestnet = 1
+	coinEthereum       = 60
+
+	// Deposit addresses come from the external (receive) chain, change
+	// addresses from the internal one
+	externalChain = 0
+	internalChain = 1
+)
+
+var (
+	ErrPrivateKey      = errors.New("deposit wallets must be configured with an extended public key")
+	ErrNotAccountLevel = errors.New("extended key is not an account-level (depth 3) key")
+	ErrChainDisabled   = errors.New("no extended public key configured for chain")
+	ErrUnknownChain    = errors.New("unknown chain")
+)
+
+// HDConfig holds the account-level extended public keys deposit addresses
+// are derived from: m/84'/0'/0' for Bitcoin and m/44'/60'/0' for Ethereum.
+// The matching private keys stay offline.
+type HDConfig struct {
+	// Network is "mainnet", "testnet" or "regtest"
+	Network      string
+	BitcoinXpub  string
+	EthereumXpub string
+	// BitcoinFingerprint is the hex fingerprint of the Bitcoin master key,
+	// recorded in PSBTs so signers can find their key
+	BitcoinFingerprint string
+}
+
+// HDWallet derives deposit addresses from account-level xpubs (BIP32).
+// Bitcoin uses BIP84 native segwit, Ethereum BIP44. It never holds private
+// keys.
 type HDWallet struct {
-	logger *zap.Logger
-}
-
-// NewHDWallet creates a new HD wallet manager
-func NewHDWallet(logger *zap.Logger) *HDWallet {
-	return &HDWallet{
-		logger: logger,
-	}
-}
-
-// GenerateBitcoinAddress generates a Bitcoin deposit address
-// In production, this would use BIP32/BIP44 derivation
-func (w *HDWallet) GenerateBitcoinAddress(accountID uuid.UUID, index uint32) (string, error) {
-	// TODO: Implement proper BIP32/BIP44 derivation
-	// For now, generate a deterministic mock address based on account ID
-	
-	seed := fmt.Sprintf("%s-%d", accountID.String(), index)
-	hash := sha256.Sum256([]byte(seed))
-	addressHash := hex.EncodeToString(hash[:20])
-	
-	// Mock Bitcoin address (bc1q prefix for bech32)
-	address := fmt.Sprintf("bc1q%s", addressHash[:40])
-	
-	w.logger.Info("Generated Bitcoin address",
-		zap.String("account_id", accountID.String()),
-		zap.Uint32("index", index),
-		zap.String("address", address),
-	)
-	
-	return address, nil
-}
-
-// GenerateEthereumAddress generates an Ethereum deposit address
-// In production, this would use proper key derivation
-func (w *HDWallet) GenerateEthereumAddress(accountID uuid.UUID, index uint32) (string, error) {
-	// TODO: Implement proper Ethereum key derivation with go-ethereum
-	// For now, generate a deterministic mock address
-	
-	seed := fmt.Sprintf("%s-%d-eth", accountID.String(), index)
-	hash := sha256.Sum256([]byte(seed))
-	addressHash := hex.EncodeToString(hash[:20])
-	
-	// Mock Ethereum address (0x prefix)
-	address := fmt.Sprintf("0x%s", addressHash)
-	
-	w.logger.Info("Generated Ethereum address",
-		zap.String("account_id", accountID.String()),
-		zap.Uint32("index", index),
+	params      *chaincfg.Params
+	accounts    map[string]*hdkeychain.ExtendedKey
+	fingerprint uint32
+	logger      *zap.Logger
+}
+
+// NewHDWallet creates an HD wallet from cfg. Chains without an xpub are
+// disabled.
+func NewHDWallet(cfg HDConfig, logger *zap.Logger) (*HDWallet, error) {
+	params, err := NetworkParams(cfg.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &HDWallet{
+		params:   params,
+		accounts: make(map[string]*hdkeychain.ExtendedKey),
+		logger:   logger,
+	}
+
+	for chain, xpub := range map[string]string{
+		ChainBitcoin:  cfg.BitcoinXpub,
+		ChainEthereum: cfg.EthereumXpub,
+	} {
+		if xpub == "" {
+			continue
+		}
+		key, err := ParseAccountXpub(xpub)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s xpub: %w", chain, err)
+		}
+		w.accounts[chain] = key
+	}
+
+	if cfg.BitcoinFingerprint != "" {
+		fp, err := hex.DecodeString(cfg.BitcoinFingerprint)
+		if err != nil || len(fp) != 4 {
+			return nil, fmt.Errorf("invalid bitcoin fingerprint %q", cfg.BitcoinFingerprint)
+		}
+		// PSBTs serialise the fingerprint as little-endian uint32
+		w.fingerprint = binary.LittleEndian.Uint32(fp)
+	}
+
+	return w, nil
+}
+
+// NetworkParams maps a network name to Bitcoin chain parameters
+func NetworkParams(network string) (*chaincfg.Params, error) {
+	switch network {
+	case "", "mainnet":
+		return &chaincfg.MainNetParams, nil
+	case "testnet":
+		return &chaincfg.TestNet3Params, nil
+	case "regtest":
+		return &chaincfg.RegressionNetParams, nil
+	}
+	return nil, fmt.Errorf("unknown network %q", network)
+}
+
+// ParseAccountXpub parses an account-level extended public key. SLIP-132
+// variants (zpub, vpub) are accepted: only the key material is used.
+func ParseAccountXpub(s string) (*hdkeychain.ExtendedKey, error) {
+	key, err := hdkeychain.NewKeyFromString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if key.IsPrivate() {
+		return nil, ErrPrivateKey
+	}
+	if key.Depth() != 3 {
+		return nil, ErrNotAccountLevel
+	}
+	return key, nil
+}
+
+// Params returns the Bitcoin network the wallet derives addresses for
+func (w *HDWallet) Params() *chaincfg.Params {
+	return w.params
+}
+
+// Enabled reports whether addresses can be derived for chain
+func (w *HDWallet) Enabled(chain string) bool {
+	return w.accounts[chain] != nil
+}
+
+// DeriveAddress derives the deposit address at index on chain's external
+// branch, returning it with its full derivation path
+func (w *HDWallet) DeriveAddress(chain string, index uint32) (address, path string, err error) {
+	account, ok := w.accounts[chain]
+	if !ok {
+		if chain != ChainBitcoin && chain != ChainEthereum {
+			return "", "", fmt.Errorf("%w: %s", ErrUnknownChain, chain)
+		}
+		return "", "", fmt.Errorf("%w: %s", ErrChainDisabled, chain)
+	}
+	if index >= hdkeychain.HardenedKeyStart {
+		return "", "", fmt.Errorf("address index %d out of range", index)
+	}
+
+	key, err := deriveChild(account, externalChain, index)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch chain {
+	case ChainBitcoin:
+		address, err = bitcoinAddress(key, w.params)
+		path = fmt.Sprintf("m/%d'/%d'/%d'/%d/%d", purposeBIP84, w.bitcoinCoinType(), account.ChildIndex()-hdkeychain.HardenedKeyStart, externalChain, index)
+	case ChainEthereum:
+		address, err = ethereumAddress(key)
+		path = fmt.Sprintf("m/%d'/%d'/%d'/%d/%d", purposeBIP44, coinEthereum, account.ChildIndex()-hdkeychain.HardenedKeyStart, externalChain, index)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	w.logger.Debug("Derived deposit address",
+		zap.String("chain", chain),
+		zap.String("path", path),
 		zap.String("address", address),
 	)
-	
-	return address, nil
+	return address, path, nil
 }
 
-// GenerateMnemonic generates a BIP39 mnemonic phrase
-// WARNING: This is a simplified mock - use proper BIP39 library in production
-func (w *HDWallet) GenerateMnemonic() (string, error) {
-	// Generate 128 bits of entropy
-	entropy := make([]byte, 16)
-	if _, err := rand.Read(entropy); err != nil {
-		return "", fmt.Errorf("failed to generate entropy: %w", err)
+// DeriveChangeAddress derives the Bitcoin change address at index on the
+// internal branch, returning it with its full derivation path
+func (w *HDWallet) DeriveChangeAddress(index uint32) (address, path string, err error) {
+	account, ok := w.accounts[ChainBitcoin]
+	if !ok {
+		return "", "", fmt.Errorf("%w: %s", ErrChainDisabled, ChainBitcoin)
+	}
+	if index >= hdkeychain.HardenedKeyStart {
+		return "", "", fmt.Errorf("address index %d out of range", index)
 	}
-	
-	// TODO: Implement proper BIP39 mnemonic generation
-	// For now, return hex representation
-	mnemonic := hex.EncodeToString(entropy)
-	
-	w.logger.Info("Generated mnemonic (mock)")
-	
-	return mnemonic, nil
+
+	key, err := deriveChild(account, internalChain, index)
+	if err != nil {
+		return "", "", err
+	}
+	if address, err = bitcoinAddress(key, w.params); err != nil {
+		return "", "", err
+	}
+	path = fmt.Sprintf("m/%d'/%d'/%d'/%d/%d", purposeBIP84, w.bitcoinCoinType(), account.ChildIndex()-hdkeychain.HardenedKeyStart, internalChain, index)
+	return address, path, nil
 }
 
-// DeriveKey derives a child key from master key
-// TODO: Implement proper BIP32 derivation
-func (w *HDWallet) DeriveKey(masterKey string, path string) (string, error) {
-	// Placeholder for BIP32 key derivation
-	// In production, use: github.com/btcsuite/btcd/btcec
-	// or: github.com/tyler-smith/go-bip32
-	
-	hash := sha256.Sum256([]byte(masterKey + path))
-	derivedKey := hex.EncodeToString(hash[:])
-	
-	return derivedKey, nil
+// BitcoinDerivation returns the public key and BIP32 path of a key under
+// the Bitcoin account, as recorded in PSBT inputs for the signers. path is
+// a full path such as m/84'/0'/0'/1/7.
+func (w *HDWallet) BitcoinDerivation(path string) (*psbt.Bip32Derivation, error) {
+	account, ok := w.accounts[ChainBitcoin]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrChainDisabled, ChainBitcoin)
+	}
+
+	indexes, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	h := uint32(hdkeychain.HardenedKeyStart)
+	if len(indexes) != 5 || indexes[0] != h+purposeBIP84 || indexes[1] != h+w.bitcoinCoinType() ||
+		indexes[2] != account.ChildIndex() || indexes[3] > internalChain || indexes[4] >= h {
+		return nil, fmt.Errorf("path %s is not under the bitcoin account", path)
+	}
+
+	key, err := deriveChild(account, indexes[3], indexes[4])
+	if err != nil {
+		return nil, err
+	}
+	pub, err := key.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	return &psbt.Bip32Derivation{
+		PubKey:               pub.SerializeCompressed(),
+		MasterKeyFingerprint: w.fingerprint,
+		Bip32Path:            indexes,
+	}, nil
 }
 
+// parsePath parses a BIP32 path such as m/84'/0'/0'/0/1
+func parsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 || parts[0] != "m" {
+		return nil, fmt.Errorf("invalid derivation path %q", path)
+	}
 
+	indexes := make([]uint32, len(parts)-1)
+	for i, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'")
+		n, err := strconv.ParseUint(strings.TrimSuffix(part, "'"), 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid derivation path %q", path)
+		}
+		indexes[i] = uint32(n)
+		if hardened {
+			indexes[i] += hdkeychain.HardenedKeyStart
+		}
+	}
+	return indexes, nil
+}
+
+func (w *HDWallet) bitcoinCoinType() uint32 {
+	if w.params.Net == chaincfg.MainNetParams.Net {
+		return coinBitcoin
+	}
+	return coinBitcoinTestnet
+}
+
+func deriveChild(key *hdkeychain.ExtendedKey, path ...uint32) (*hdkeychain.ExtendedKey, error) {
+	for _, i := range path {
+		var err error
+		if key, err = key.Derive(i); err != nil {
+			return nil, fmt.Errorf("failed to derive child %d: %w", i, err)
+		}
+	}
+	return key, nil
+}
+
+// bitcoinAddress encodes a key as a P2WPKH (bech32) address
+func bitcoinAddress(key *hdkeychain.ExtendedKey, params *chaincfg.Params) (string, error) {
+	pub, err := key.ECPubKey()
+	if err != nil {
+		return "", err
+	}
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(pub.SerializeCompressed()), params)
+	if err != nil {
+		return "", err
+	}
+	return addr.EncodeAddress(), nil
+}
 
+// ethereumAddress encodes a key as an EIP-55 checksummed address
+func ethereumAddress(key *hdkeychain.ExtendedKey) (string, error) {
+	pub, err := key.ECPubKey()
+	if err != nil {
+		return "", err
+	}
+	hash := keccak256(pub.SerializeUncompressed()[1:])
+	return ChecksumAddress(hash[12:]), nil
+}
+
+// ChecksumAddress formats a 20-byte Ethereum address with EIP-55 mixed-case
+// checksum
+func ChecksumAddress(addr []byte) string {
+	hexAddr := hex.EncodeToString(addr)
+	hash := keccak256([]byte(hexAddr))
+
+	out := make([]byte, len(hexAddr))
+	for i, c := range []byte(hexAddr) {
+		nibble := hash[i/2] >> 4
+		if i%2 == 1 {
+			nibble = hash[i/2] & 0x0f
+		}
+		if c >= 'a' && nibble >= 8 {
+			c -= 'a' - 'A'
+		}
+		out[i] = c
+	}
+	return "0x" + string(out)
+}
+
+func keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Offline key ceremony helpers. These handle private keys and are meant for
+// the air-gapped tooling that produces the xpubs, never the deposit server.
+
+// GenerateMnemonic generates a 24-word BIP39 mnemonic
+func GenerateMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(256)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate entropy: %w", err)
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// MasterKeyFromMnemonic derives the BIP32 master key from a BIP39 mnemonic
+// and optional passphrase
+func MasterKeyFromMnemonic(mnemonic, passphrase string, params *chaincfg.Params) (*hdkeychain.ExtendedKey, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return hdkeychain.NewMaster(seed, params)
+}
+
+// AccountXpub derives the account-level extended public key for chain from
+// a master key: m/84'/coin'/account' for Bitcoin, m/44'/60'/account' for
+// Ethereum
+func AccountXpub(master *hdkeychain.ExtendedKey, chain string, account uint32, params *chaincfg.Params) (string, error) {
+	var purpose, coin uint32
+	switch chain {
+	case ChainBitcoin:
+		purpose, coin = purposeBIP84, coinBitcoin
+		if params.Net != chaincfg.MainNetParams.Net {
+			coin = coinBitcoinTestnet
+		}
+	case ChainEthereum:
+		purpose, coin = purposeBIP44, coinEthereum
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownChain, chain)
+	}
+
+	h := uint32(hdkeychain.HardenedKeyStart)
+	key, err := deriveChild(master, h+purpose, h+coin, h+account)
+	if err != nil {
+		return "", err
+	}
+	pub, err := key.Neuter()
+	if err != nil {
+		return "", err
+	}
+	return pub.String(), nil
+}
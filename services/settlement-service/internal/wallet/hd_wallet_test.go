@@ -0,0 +1,204 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/tyler-smith/go-bip39"
+	"go.uber.org/zap"
+)
+
+// Test mnemonic used by the BIP39, BIP84 and common Ethereum test vectors
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestBIP39Seed(t *testing.T) {
+	seed := bip39.NewSeed(testMnemonic, "TREZOR")
+	want := "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"
+	if got := hex.EncodeToString(seed); got != want {
+		t.Errorf("seed = %s, want %s", got, want)
+	}
+
+	master, err := MasterKeyFromMnemonic(testMnemonic, "TREZOR", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMaster := "xprv9s21ZrQH143K3h3fDYiay8mocZ3afhfULfb5GX8kCBdno77K4HiA15Tg23wpbeF1pLfs1c5SPmYHrEpTuuRhxMwvKDwqdKiGJS9XFKzUsAF"
+	if got := master.String(); got != wantMaster {
+		t.Errorf("master = %s, want %s", got, wantMaster)
+	}
+}
+
+// BIP32 test vector 1: public derivation from an xpub matches the published
+// child xpubs
+func TestBIP32PublicDerivation(t *testing.T) {
+	parent, err := hdkeychain.NewKeyFromString("xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := parent.Derive(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"
+	if got := child.String(); got != want {
+		t.Errorf("m/0H/1 = %s, want %s", got, want)
+	}
+}
+
+// BIP84 test vectors
+func TestDeriveBitcoinAddress(t *testing.T) {
+	master, err := MasterKeyFromMnemonic(testMnemonic, "", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := AccountXpub(master, ChainBitcoin, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The published vector is a SLIP-132 zpub of the same key
+	const zpub = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+	for _, key := range []string{xpub, zpub} {
+		w, err := NewHDWallet(HDConfig{Network: "mainnet", BitcoinXpub: key}, zap.NewNop())
+		if err != nil {
+			t.Fatalf("NewHDWallet(%s) error = %v", key, err)
+		}
+
+		for i, want := range []string{
+			"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+			"bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g",
+		} {
+			addr, path, err := w.DeriveAddress(ChainBitcoin, uint32(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addr != want {
+				t.Errorf("address %d = %s, want %s", i, addr, want)
+			}
+			if wantPath := fmt.Sprintf("m/84'/0'/0'/0/%d", i); path != wantPath {
+				t.Errorf("path %d = %s, want %s", i, path, wantPath)
+			}
+		}
+	}
+}
+
+// BIP84 change vector and the PSBT derivation recorded for it
+func TestDeriveChangeAddressAndDerivation(t *testing.T) {
+	master, err := MasterKeyFromMnemonic(testMnemonic, "", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := AccountXpub(master, ChainBitcoin, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewHDWallet(HDConfig{Network: "mainnet", BitcoinXpub: xpub, BitcoinFingerprint: "73c5da0a"}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, path, err := w.DeriveChangeAddress(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"; addr != want {
+		t.Errorf("change address = %s, want %s", addr, want)
+	}
+	if want := "m/84'/0'/0'/1/0"; path != want {
+		t.Errorf("change path = %s, want %s", path, want)
+	}
+
+	derivation, err := w.BitcoinDerivation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "03025324888e429ab8e3dbaf1f7802648b9cd01e9b418485c5fa4c1b9b5700e1a6"; hex.EncodeToString(derivation.PubKey) != want {
+		t.Errorf("pubkey = %x, want %s", derivation.PubKey, want)
+	}
+	// 73c5da0a serialised little-endian
+	if derivation.MasterKeyFingerprint != 0x0adac573 {
+		t.Errorf("fingerprint = %08x, want 0adac573", derivation.MasterKeyFingerprint)
+	}
+	h := uint32(hdkeychain.HardenedKeyStart)
+	wantPath := []uint32{h + 84, h, h, 1, 0}
+	if fmt.Sprint(derivation.Bip32Path) != fmt.Sprint(wantPath) {
+		t.Errorf("path = %v, want %v", derivation.Bip32Path, wantPath)
+	}
+
+	for _, bad := range []string{"m/44'/0'/0'/0/0", "m/84'/0'/1'/0/0", "m/84'/0'/0'/2/0", "m/84'/0'/0'/0", "84'/0'/0'/0/0"} {
+		if _, err := w.BitcoinDerivation(bad); err == nil {
+			t.Errorf("BitcoinDerivation(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestDeriveEthereumAddress(t *testing.T) {
+	master, err := MasterKeyFromMnemonic(testMnemonic, "", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := AccountXpub(master, ChainEthereum, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewHDWallet(HDConfig{EthereumXpub: xpub}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, path, err := w.DeriveAddress(ChainEthereum, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"; addr != want {
+		t.Errorf("address = %s, want %s", addr, want)
+	}
+	if want := "m/44'/60'/0'/0/0"; path != want {
+		t.Errorf("path = %s, want %s", path, want)
+	}
+	if _, _, err := w.DeriveAddress(ChainBitcoin, 0); !errors.Is(err, ErrChainDisabled) {
+		t.Errorf("bitcoin error = %v, want ErrChainDisabled", err)
+	}
+}
+
+func TestNewHDWalletRejectsPrivateKeys(t *testing.T) {
+	master, err := MasterKeyFromMnemonic(testMnemonic, "", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := uint32(hdkeychain.HardenedKeyStart)
+	account, err := deriveChild(master, h+84, h, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewHDWallet(HDConfig{BitcoinXpub: account.String()}, zap.NewNop()); !errors.Is(err, ErrPrivateKey) {
+		t.Errorf("xprv error = %v, want ErrPrivateKey", err)
+	}
+	pub, _ := master.Neuter()
+	if _, err := NewHDWallet(HDConfig{BitcoinXpub: pub.String()}, zap.NewNop()); !errors.Is(err, ErrNotAccountLevel) {
+		t.Errorf("master xpub error = %v, want ErrNotAccountLevel", err)
+	}
+}
+
+func TestChecksumAddress(t *testing.T) {
+	// EIP-55 examples
+	for _, want := range []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		raw, err := hex.DecodeString(want[2:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ChecksumAddress(raw); got != want {
+			t.Errorf("ChecksumAddress() = %s, want %s", got, want)
+		}
+	}
+}
@@ -2,117 +2,599 @@
 package wallet
 
 import (
-	"crypto/rand"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 )
 
+// maxMultiSigKeys is the most keys OP_CHECKMULTISIG accepts
+const maxMultiSigKeys = 20
+
+var (
+	ErrInvalidMultiSigConfig    = errors.New("invalid multi-sig configuration")
+	ErrMultiSigTxNotFound       = errors.New("multi-sig transaction not found")
+	ErrMultiSigTxClosed         = errors.New("multi-sig transaction is no longer collecting signatures")
+	ErrUnknownSigner            = errors.New("unknown multi-sig signer")
+	ErrInvalidMultiSigPSBT      = errors.New("invalid multi-sig PSBT")
+	ErrMultiSigPSBTMismatch     = errors.New("PSBT does not match the pending transaction")
+	ErrInvalidMultiSigSignature = errors.New("multi-sig signature does not validate")
+	ErrMultiSigBroadcastFailed  = errors.New("multi-sig transaction could not be broadcast")
+)
+
 // MultiSigConfig represents multi-signature configuration
 type MultiSigConfig struct {
 	RequiredSignatures int      // M in M-of-N
 	TotalSigners       int      // N in M-of-N
-	SignerKeys         []string // Public keys of signers
+	SignerKeys         []string // Compressed public keys of signers, hex
 	WalletType         string   // "hot", "warm", "cold"
+	Network            string   // "mainnet", "testnet" or "regtest"
+}
+
+// RawTransactionSender broadcasts a serialised Bitcoin transaction, as
+// blockchain.BitcoinClient does
+type RawTransactionSender interface {
+	SendRawTransaction(txHex string) (string, error)
 }
 
-// MultiSigWallet manages multi-signature wallet operations
+// MultiSigTransaction is a spend from a multi-sig wallet collecting
+// signatures. Signers are the indexes into SignerKeys that have signed.
+type MultiSigTransaction struct {
+	ID          uuid.UUID  `json:"id"`
+	WalletType  string     `json:"wallet_type"`
+	Address     string     `json:"address"`
+	TxID        string     `json:"txid"`
+	PSBT        string     `json:"psbt"`
+	Description string     `json:"description,omitempty"`
+	Required    int        `json:"required_signatures"`
+	Signers     []int      `json:"signers"`
+	Status      string     `json:"status"`
+	BroadcastAt *time.Time `json:"broadcast_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// MultiSigWallet manages multi-signature wallet operations. Bitcoin funds
+// sit on one P2WSH address paying an M-of-N OP_CHECKMULTISIG of the signer
+// keys, sorted as BIP67 describes. Spends are held as PSBTs until M signers
+// have each signed every input, then finalised and broadcast.
 type MultiSigWallet struct {
-	config MultiSigConfig
-	logger *zap.Logger
+	db      *database.PostgresDB
+	node    RawTransactionSender
+	config  MultiSigConfig
+	params  *chaincfg.Params
+	keys    [][]byte
+	script  []byte
+	address btcutil.Address
+	logger  *zap.Logger
 }
 
 // NewMultiSigWallet creates a new multi-sig wallet manager
-func NewMultiSigWallet(config MultiSigConfig, logger *zap.Logger) *MultiSigWallet {
-	return &MultiSigWallet{
+func NewMultiSigWallet(db *database.PostgresDB, node RawTransactionSender, config MultiSigConfig, logger *zap.Logger) (*MultiSigWallet, error) {
+	params, err := NetworkParams(config.Network)
+	if err != nil {
+		return nil, err
+	}
+	if config.TotalSigners == 0 {
+		config.TotalSigners = len(config.SignerKeys)
+	}
+	if config.TotalSigners != len(config.SignerKeys) || config.TotalSigners > maxMultiSigKeys {
+		return nil, fmt.Errorf("%w: %s wallet has %d signer keys for %d signers",
+			ErrInvalidMultiSigConfig, config.WalletType, len(config.SignerKeys), config.TotalSigners)
+	}
+	if config.RequiredSignatures < 1 || config.RequiredSignatures > config.TotalSigners {
+		return nil, fmt.Errorf("%w: %s wallet needs %d of %d signatures",
+			ErrInvalidMultiSigConfig, config.WalletType, config.RequiredSignatures, config.TotalSigners)
+	}
+
+	w := &MultiSigWallet{
+		db:     db,
+		node:   node,
 		config: config,
+		params: params,
 		logger: logger,
 	}
+	seen := make(map[string]bool)
+	pubKeys := make([]*btcutil.AddressPubKey, 0, len(config.SignerKeys))
+	for i, k := range config.SignerKeys {
+		key, err := hex.DecodeString(strings.TrimPrefix(k, "0x"))
+		if err != nil || len(key) != btcec.PubKeyBytesLenCompressed {
+			return nil, fmt.Errorf("%w: signer key %d is not a compressed public key", ErrInvalidMultiSigConfig, i)
+		}
+		if seen[string(key)] {
+			return nil, fmt.Errorf("%w: signer key %d is repeated", ErrInvalidMultiSigConfig, i)
+		}
+		seen[string(key)] = true
+		pub, err := btcutil.NewAddressPubKey(key, params)
+		if err != nil {
+			return nil, fmt.Errorf("%w: signer key %d: %v", ErrInvalidMultiSigConfig, i, err)
+		}
+		w.keys = append(w.keys, key)
+		pubKeys = append(pubKeys, pub)
+	}
+
+	// BIP67: any party can rebuild the script from the keys alone
+	sort.Slice(pubKeys, func(i, j int) bool {
+		return bytes.Compare(pubKeys[i].ScriptAddress(), pubKeys[j].ScriptAddress()) < 0
+	})
+	if w.script, err = txscript.MultiSigScript(pubKeys, config.RequiredSignatures); err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(w.script)
+	if w.address, err = btcutil.NewAddressWitnessScriptHash(hash[:], params); err != nil {
+		return nil, err
+	}
+	return w, nil
 }
 
-// CreateMultiSigAddress creates a multi-signature address
-func (w *MultiSigWallet) CreateMultiSigAddress(currency string) (string, error) {
-	// TODO: Implement actual multi-sig address creation
-	// For Bitcoin: Use P2SH or P2WSH
-	// For Ethereum: Use Gnosis Safe or custom contract
+// Address returns the wallet's P2WSH address
+func (w *MultiSigWallet) Address() string {
+	return w.address.EncodeAddress()
+}
 
-	if currency == "BTC" {
-		return w.createBitcoinMultiSig()
-	} else if currency == "ETH" {
-		return w.createEthereumMultiSig()
-	}
+// WitnessScript returns the M-of-N script the address commits to
+func (w *MultiSigWallet) WitnessScript() []byte {
+	return w.script
+}
 
-	return "", fmt.Errorf("unsupported currency: %s", currency)
+// InputVBytes is the most virtual size an input spending the wallet adds
+// to a transaction once signed, for fee estimates
+func (w *MultiSigWallet) InputVBytes() int64 {
+	// Item count, the dummy element OP_CHECKMULTISIG pops, M signatures of
+	// up to 73 bytes and the script, each with its length
+	witness := 2 + int64(w.config.RequiredSignatures)*74 +
+		int64(wire.VarIntSerializeSize(uint64(len(w.script)))) + int64(len(w.script))
+	// Outpoint, empty script sig and sequence are 41 bytes; witness data
+	// counts a quarter
+	return 41 + (witness+3)/4
 }
 
-func (w *MultiSigWallet) createBitcoinMultiSig() (string, error) {
-	// Mock Bitcoin multi-sig address (P2WSH format)
-	address := fmt.Sprintf("bc1q%s", generateRandomHash(58))
+// CreateMultiSigAddress creates a multi-signature address. Only Bitcoin is
+// supported; an Ethereum multisig needs a deployed contract such as a Safe.
+func (w *MultiSigWallet) CreateMultiSigAddress(currency string) (string, error) {
+	if currency != "BTC" {
+		return "", fmt.Errorf("unsupported currency: %s", currency)
+	}
 
 	w.logger.Info("Created Bitcoin multi-sig address",
-		zap.String("address", address),
+		zap.String("address", w.Address()),
+		zap.String("wallet_type", w.config.WalletType),
 		zap.Int("required", w.config.RequiredSignatures),
 		zap.Int("total", w.config.TotalSigners),
 	)
 
-	return address, nil
+	return w.Address(), nil
 }
 
-func (w *MultiSigWallet) createEthereumMultiSig() (string, error) {
-	// Mock Ethereum multi-sig address (Gnosis Safe format)
-	address := fmt.Sprintf("0x%s", generateRandomHash(40))
+// Propose stores a PSBT spending the wallet's outputs to collect
+// signatures. Every input must carry the output it spends, paid to the
+// wallet's address; the witness script is added for the signers.
+func (w *MultiSigWallet) Propose(ctx context.Context, encoded, description string) (*MultiSigTransaction, error) {
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(encoded), true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMultiSigPSBT, err)
+	}
+	pkScript, err := txscript.PayToAddrScript(w.address)
+	if err != nil {
+		return nil, err
+	}
+	for i := range packet.Inputs {
+		in := &packet.Inputs[i]
+		if in.WitnessUtxo == nil || !bytes.Equal(in.WitnessUtxo.PkScript, pkScript) {
+			return nil, fmt.Errorf("%w: input %d does not spend from %s", ErrInvalidMultiSigPSBT, i, w.Address())
+		}
+		if in.WitnessScript != nil && !bytes.Equal(in.WitnessScript, w.script) {
+			return nil, fmt.Errorf("%w: input %d has another witness script", ErrInvalidMultiSigPSBT, i)
+		}
+		// Signatures only count once submitted and checked
+		in.WitnessScript, in.PartialSigs = w.script, nil
+	}
+	if encoded, err = packet.B64Encode(); err != nil {
+		return nil, fmt.Errorf("failed to encode PSBT: %w", err)
+	}
 
-	w.logger.Info("Created Ethereum multi-sig address",
-		zap.String("address", address),
-		zap.Int("required", w.config.RequiredSignatures),
-		zap.Int("total", w.config.TotalSigners),
-	)
+	t := &MultiSigTransaction{
+		WalletType:  w.config.WalletType,
+		Address:     w.Address(),
+		TxID:        packet.UnsignedTx.TxHash().String(),
+		PSBT:        encoded,
+		Description: description,
+		Required:    w.config.RequiredSignatures,
+		Signers:     []int{},
+		Status:      "pending",
+	}
+	err = w.db.Pool.QueryRow(ctx, `
+		INSERT INTO multisig_transactions (wallet_type, address, txid, psbt, description, required_signatures)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, t.WalletType, t.Address, t.TxID, t.PSBT, t.Description, t.Required).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store multi-sig transaction: %w", err)
+	}
 
-	return address, nil
+	w.logger.Info("Multi-sig transaction proposed",
+		zap.String("id", t.ID.String()),
+		zap.String("wallet_type", t.WalletType),
+		zap.String("txid", t.TxID),
+		zap.String("description", description),
+	)
+	return t, nil
 }
 
-// SignTransaction adds a signature to a pending transaction
-func (w *MultiSigWallet) SignTransaction(txID uuid.UUID, signerIndex int, signature string) error {
-	// TODO: Implement signature verification and storage
-	// Store signatures in database
-	// Check if threshold is met
-	// If met, broadcast transaction
+// SignTransaction adds a signer's signatures to a pending transaction.
+// signed is the signer's copy of the PSBT with their partial signature on
+// every input; each is checked against the signer's key. Once
+// RequiredSignatures signers have signed, the transaction is finalised and
+// broadcast. If the broadcast fails the signatures are kept, and any signer
+// submitting again retries it.
+func (w *MultiSigWallet) SignTransaction(ctx context.Context, txID uuid.UUID, signerIndex int, signed string) (*MultiSigTransaction, error) {
+	if signerIndex < 0 || signerIndex >= len(w.keys) {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownSigner, signerIndex)
+	}
+	signedPacket, err := psbt.NewFromRawBytes(strings.NewReader(signed), true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMultiSigPSBT, err)
+	}
+
+	var result *MultiSigTransaction
+	var broadcastErr error
+	err = w.db.WithTx(ctx, func(tx pgx.Tx) error {
+		t, err := w.load(ctx, tx, txID, true)
+		if err != nil {
+			return err
+		}
+		if t.Status != "pending" {
+			return ErrMultiSigTxClosed
+		}
+		packet, err := psbt.NewFromRawBytes(strings.NewReader(t.PSBT), true)
+		if err != nil {
+			return fmt.Errorf("failed to decode stored PSBT: %w", err)
+		}
+		if signedPacket.UnsignedTx.TxHash() != packet.UnsignedTx.TxHash() {
+			return ErrMultiSigPSBTMismatch
+		}
+
+		sigs, err := w.verifySignatures(packet, signedPacket, signerIndex)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO multisig_signatures (transaction_id, signer_index, signer_key, signatures)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (transaction_id, signer_index) DO UPDATE
+			SET signer_key = EXCLUDED.signer_key, signatures = EXCLUDED.signatures
+			WHERE multisig_signatures.signer_key <> EXCLUDED.signer_key
+		`, txID, signerIndex, hex.EncodeToString(w.keys[signerIndex]), sigs); err != nil {
+			return fmt.Errorf("failed to store signatures: %w", err)
+		}
+
+		signatures, err := w.signatures(ctx, tx, txID)
+		if err != nil {
+			return err
+		}
+		t.Signers = t.Signers[:0]
+		for _, s := range signatures {
+			t.Signers = append(t.Signers, s.index)
+		}
+		result = t
+		if len(signatures) < t.Required {
+			return nil
+		}
+
+		final, err := w.finalize(packet, signatures[:t.Required])
+		if err != nil {
+			return err
+		}
+		var raw bytes.Buffer
+		if err := final.Serialize(&raw); err != nil {
+			return err
+		}
+		if _, err := w.node.SendRawTransaction(hex.EncodeToString(raw.Bytes())); err != nil {
+			broadcastErr = fmt.Errorf("%w: %v", ErrMultiSigBroadcastFailed, err)
+			return nil
+		}
+
+		if t.PSBT, err = packet.B64Encode(); err != nil {
+			return fmt.Errorf("failed to encode PSBT: %w", err)
+		}
+		t.Status = "broadcast"
+		return tx.QueryRow(ctx, `
+			UPDATE multisig_transactions
+			SET status = 'broadcast', psbt = $2, broadcast_at = NOW(), updated_at = NOW()
+			WHERE id = $1
+			RETURNING broadcast_at
+		`, txID, t.PSBT).Scan(&t.BroadcastAt)
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	w.logger.Info("Transaction signature added",
 		zap.String("tx_id", txID.String()),
 		zap.Int("signer_index", signerIndex),
+		zap.Int("signatures", len(result.Signers)),
+		zap.Int("required", result.Required),
 	)
+	if broadcastErr != nil {
+		w.logger.Warn("Multi-sig transaction broadcast failed",
+			zap.String("tx_id", txID.String()),
+			zap.Error(broadcastErr),
+		)
+		return nil, broadcastErr
+	}
+	if result.Status == "broadcast" {
+		w.logger.Info("Multi-sig transaction broadcast",
+			zap.String("tx_id", txID.String()),
+			zap.String("txid", result.TxID),
+			zap.String("wallet_type", result.WalletType),
+		)
+	}
+	return result, nil
+}
+
+// GetRequiredSignatures returns the number of signatures still needed
+func (w *MultiSigWallet) GetRequiredSignatures(ctx context.Context, txID uuid.UUID) (int, error) {
+	var required, signed int
+	err := w.db.Pool.QueryRow(ctx, `
+		SELECT t.required_signatures, COUNT(s.signer_index)
+		FROM multisig_transactions t
+		LEFT JOIN multisig_signatures s ON s.transaction_id = t.id
+		WHERE t.id = $1 AND t.wallet_type = $2
+		GROUP BY t.id
+	`, txID, w.config.WalletType).Scan(&required, &signed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrMultiSigTxNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return max(required-signed, 0), nil
+}
+
+// Get returns a transaction with the signers that have signed it
+func (w *MultiSigWallet) Get(ctx context.Context, txID uuid.UUID) (*MultiSigTransaction, error) {
+	var result *MultiSigTransaction
+	err := w.db.WithTx(ctx, func(tx pgx.Tx) error {
+		t, err := w.load(ctx, tx, txID, false)
+		if err != nil {
+			return err
+		}
+		signatures, err := w.signatures(ctx, tx, txID)
+		if err != nil {
+			return err
+		}
+		for _, s := range signatures {
+			t.Signers = append(t.Signers, s.index)
+		}
+		result = t
+		return nil
+	})
+	return result, err
+}
 
+// Pending lists the wallet's transactions still collecting signatures
+func (w *MultiSigWallet) Pending(ctx context.Context) ([]MultiSigTransaction, error) {
+	rows, err := w.db.Pool.Query(ctx, `
+		SELECT t.id, t.txid, t.psbt, COALESCE(t.description, ''), t.required_signatures, t.created_at,
+		       COALESCE(array_agg(s.signer_index ORDER BY s.signer_index) FILTER (WHERE s.signer_index IS NOT NULL), '{}')
+		FROM multisig_transactions t
+		LEFT JOIN multisig_signatures s ON s.transaction_id = t.id
+		WHERE t.wallet_type = $1 AND t.status = 'pending'
+		GROUP BY t.id
+		ORDER BY t.created_at
+	`, w.config.WalletType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending multi-sig transactions: %w", err)
+	}
+	defer rows.Close()
+
+	pending := []MultiSigTransaction{}
+	for rows.Next() {
+		t := MultiSigTransaction{WalletType: w.config.WalletType, Address: w.Address(), Status: "pending"}
+		var signers []int32
+		if err := rows.Scan(&t.ID, &t.TxID, &t.PSBT, &t.Description, &t.Required, &t.CreatedAt, &signers); err != nil {
+			return nil, err
+		}
+		t.Signers = make([]int, len(signers))
+		for i, s := range signers {
+			t.Signers[i] = int(s)
+		}
+		pending = append(pending, t)
+	}
+	return pending, rows.Err()
+}
+
+// Cancel stops a pending transaction collecting signatures
+func (w *MultiSigWallet) Cancel(ctx context.Context, txID uuid.UUID) error {
+	tag, err := w.db.Pool.Exec(ctx, `
+		UPDATE multisig_transactions
+		SET status = 'cancelled', cancelled_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND wallet_type = $2 AND status = 'pending'
+	`, txID, w.config.WalletType)
+	if err != nil {
+		return fmt.Errorf("failed to cancel multi-sig transaction: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := w.Get(ctx, txID); err != nil {
+			return err
+		}
+		return ErrMultiSigTxClosed
+	}
+
+	w.logger.Info("Multi-sig transaction cancelled", zap.String("tx_id", txID.String()))
 	return nil
 }
 
-// GetRequiredSignatures returns the number of signatures still needed
-func (w *MultiSigWallet) GetRequiredSignatures(txID uuid.UUID) (int, error) {
-	// TODO: Query database for existing signatures
-	// Return: config.RequiredSignatures - len(existingSignatures)
+// load reads one of the wallet's transactions, locking it for update if
+// asked
+func (w *MultiSigWallet) load(ctx context.Context, tx pgx.Tx, txID uuid.UUID, forUpdate bool) (*MultiSigTransaction, error) {
+	query := `
+		SELECT address, txid, psbt, COALESCE(description, ''), required_signatures, status, broadcast_at, created_at
+		FROM multisig_transactions
+		WHERE id = $1 AND wallet_type = $2
+	`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	t := &MultiSigTransaction{ID: txID, WalletType: w.config.WalletType, Signers: []int{}}
+	err := tx.QueryRow(ctx, query, txID, w.config.WalletType).
+		Scan(&t.Address, &t.TxID, &t.PSBT, &t.Description, &t.Required, &t.Status, &t.BroadcastAt, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrMultiSigTxNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// signerSignatures are one signer's signatures, one per input
+type signerSignatures struct {
+	index      int
+	signatures [][]byte
+}
+
+// signatures returns the stored signatures of a transaction in signer
+// order. Those made with a key since rotated out are ignored.
+func (w *MultiSigWallet) signatures(ctx context.Context, tx pgx.Tx, txID uuid.UUID) ([]signerSignatures, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT signer_index, signer_key, signatures
+		FROM multisig_signatures
+		WHERE transaction_id = $1
+		ORDER BY signer_index
+	`, txID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signatures: %w", err)
+	}
+	defer rows.Close()
+
+	var result []signerSignatures
+	for rows.Next() {
+		var s signerSignatures
+		var key string
+		if err := rows.Scan(&s.index, &key, &s.signatures); err != nil {
+			return nil, err
+		}
+		if s.index < len(w.keys) && key == hex.EncodeToString(w.keys[s.index]) {
+			result = append(result, s)
+		}
+	}
+	return result, rows.Err()
+}
 
-	return w.config.RequiredSignatures, nil
+// verifySignatures checks the signer's partial signature on every input of
+// signed against the stored packet and returns them in input order. Only
+// SIGHASH_ALL is accepted, so no signature can be reused with other
+// outputs.
+func (w *MultiSigWallet) verifySignatures(packet, signed *psbt.Packet, signer int) ([][]byte, error) {
+	key := w.keys[signer]
+	pub, err := btcec.ParsePubKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	unsigned := packet.UnsignedTx
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	for i, in := range unsigned.TxIn {
+		prevOuts.AddPrevOut(in.PreviousOutPoint, packet.Inputs[i].WitnessUtxo)
+	}
+	hashes := txscript.NewTxSigHashes(unsigned, prevOuts)
+
+	sigs := make([][]byte, len(packet.Inputs))
+	for i := range packet.Inputs {
+		var sig []byte
+		for _, ps := range signed.Inputs[i].PartialSigs {
+			if bytes.Equal(ps.PubKey, key) {
+				sig = ps.Signature
+			}
+		}
+		if len(sig) == 0 {
+			return nil, fmt.Errorf("%w: input %d is not signed by signer %d", ErrInvalidMultiSigSignature, i, signer)
+		}
+		if txscript.SigHashType(sig[len(sig)-1]) != txscript.SigHashAll {
+			return nil, fmt.Errorf("%w: input %d is not signed SIGHASH_ALL", ErrInvalidMultiSigSignature, i)
+		}
+		parsed, err := ecdsa.ParseDERSignature(sig[:len(sig)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: input %d: %v", ErrInvalidMultiSigSignature, i, err)
+		}
+		hash, err := txscript.CalcWitnessSigHash(w.script, hashes, txscript.SigHashAll, unsigned, i, packet.Inputs[i].WitnessUtxo.Value)
+		if err != nil {
+			return nil, err
+		}
+		if !parsed.Verify(hash, pub) {
+			return nil, fmt.Errorf("%w: input %d", ErrInvalidMultiSigSignature, i)
+		}
+		sigs[i] = sig
+	}
+	return sigs, nil
 }
 
-// Helper function
-func generateRandomHash(length int) string {
-	bytes := make([]byte, length/2)
-	rand.Read(bytes)
-	return fmt.Sprintf("%x", bytes)[:length]
+// finalize puts exactly the given signers' signatures on every input,
+// finalises the packet and returns the transaction, checked against its
+// inputs' scripts
+func (w *MultiSigWallet) finalize(packet *psbt.Packet, signers []signerSignatures) (*wire.MsgTx, error) {
+	for i := range packet.Inputs {
+		in := &packet.Inputs[i]
+		in.PartialSigs = nil
+		for _, s := range signers {
+			in.PartialSigs = append(in.PartialSigs, &psbt.PartialSig{PubKey: w.keys[s.index], Signature: s.signatures[i]})
+		}
+		if err := psbt.Finalize(packet, i); err != nil {
+			return nil, fmt.Errorf("failed to finalise input %d: %w", i, err)
+		}
+	}
+	final, err := psbt.Extract(packet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract transaction: %w", err)
+	}
+
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	for i, in := range final.TxIn {
+		prevOuts.AddPrevOut(in.PreviousOutPoint, packet.Inputs[i].WitnessUtxo)
+	}
+	hashes := txscript.NewTxSigHashes(final, prevOuts)
+	for i := range final.TxIn {
+		prev := packet.Inputs[i].WitnessUtxo
+		vm, err := txscript.NewEngine(prev.PkScript, final, i, txscript.StandardVerifyFlags, nil, hashes, prev.Value, prevOuts)
+		if err == nil {
+			err = vm.Execute()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: input %d: %v", ErrInvalidMultiSigSignature, i, err)
+		}
+	}
+	return final, nil
 }
 
-// WalletThresholds defines custody distribution
+// WalletThresholds defines custody distribution, as fractions of funds
 type WalletThresholds struct {
-	HotWalletPercent  float64 // 2% of funds
-	WarmWalletPercent float64 // 8% of funds
-	ColdWalletPercent float64 // 90% of funds
+	HotWalletPercent  decimal.Decimal // 2% of funds
+	WarmWalletPercent decimal.Decimal // 8% of funds
+	ColdWalletPercent decimal.Decimal // 90% of funds
 }
 
 var DefaultThresholds = WalletThresholds{
-	HotWalletPercent:  0.02,
-	WarmWalletPercent: 0.08,
-	ColdWalletPercent: 0.90,
+	HotWalletPercent:  decimal.RequireFromString("0.02"),
+	WarmWalletPercent: decimal.RequireFromString("0.08"),
+	ColdWalletPercent: decimal.RequireFromString("0.90"),
 }
 
 // Multi-sig configurations for different wallet types
@@ -0,0 +1,274 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+// recordingNode keeps the transactions broadcast through it
+type recordingNode struct {
+	sent []string
+}
+
+func (n *recordingNode) SendRawTransaction(txHex string) (string, error) {
+	n.sent = append(n.sent, txHex)
+	return "", nil
+}
+
+// signerKeys returns the private keys 1, 2 and 3
+func signerKeys() []*btcec.PrivateKey {
+	var keys []*btcec.PrivateKey
+	for i := byte(1); i <= 3; i++ {
+		secret := make([]byte, 32)
+		secret[31] = i
+		priv, _ := btcec.PrivKeyFromBytes(secret)
+		keys = append(keys, priv)
+	}
+	return keys
+}
+
+func hotPolicy(keys []*btcec.PrivateKey) MultiSigConfig {
+	policy := HotWalletConfig
+	for _, k := range keys {
+		policy.SignerKeys = append(policy.SignerKeys, hex.EncodeToString(k.PubKey().SerializeCompressed()))
+	}
+	return policy
+}
+
+func newTestMultiSig(t *testing.T, node RawTransactionSender) (*MultiSigWallet, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+	w, err := NewMultiSigWallet(database.New(mock, zap.NewNop()), node, hotPolicy(signerKeys()), zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, mock
+}
+
+func TestMultiSigAddressIgnoresKeyOrder(t *testing.T) {
+	keys := signerKeys()
+	w, err := NewMultiSigWallet(nil, nil, hotPolicy(keys), zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed, err := NewMultiSigWallet(nil, nil, hotPolicy([]*btcec.PrivateKey{keys[2], keys[1], keys[0]}), zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Address() != reversed.Address() {
+		t.Errorf("address depends on key order: %s and %s", w.Address(), reversed.Address())
+	}
+	if !strings.HasPrefix(w.Address(), "bc1q") || len(w.Address()) != 62 {
+		t.Errorf("address = %s, want a mainnet P2WSH address", w.Address())
+	}
+
+	keyCount, required, err := txscript.CalcMultiSigStats(w.WitnessScript())
+	if err != nil || keyCount != 3 || required != 2 {
+		t.Errorf("witness script is %d of %d (%v), want 2 of 3", required, keyCount, err)
+	}
+	if _, err := w.CreateMultiSigAddress("ETH"); err == nil {
+		t.Error("CreateMultiSigAddress(ETH) succeeded, want unsupported")
+	}
+}
+
+func TestNewMultiSigWalletRejectsBadPolicy(t *testing.T) {
+	keys := hotPolicy(signerKeys()).SignerKeys
+	uncompressed := hex.EncodeToString(signerKeys()[0].PubKey().SerializeUncompressed())
+	tests := map[string]MultiSigConfig{
+		"no signatures":       {RequiredSignatures: 0, SignerKeys: keys},
+		"more than signers":   {RequiredSignatures: 4, SignerKeys: keys},
+		"missing signer keys": {RequiredSignatures: 2, TotalSigners: 5, SignerKeys: keys},
+		"repeated key":        {RequiredSignatures: 2, SignerKeys: []string{keys[0], keys[1], keys[0]}},
+		"uncompressed key":    {RequiredSignatures: 2, SignerKeys: []string{keys[0], keys[1], uncompressed}},
+	}
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewMultiSigWallet(nil, nil, cfg, zap.NewNop()); !errors.Is(err, ErrInvalidMultiSigConfig) {
+				t.Errorf("NewMultiSigWallet() error = %v, want ErrInvalidMultiSigConfig", err)
+			}
+		})
+	}
+}
+
+// spendPacket is a PSBT spending 100000 sats from the wallet
+func spendPacket(t *testing.T, w *MultiSigWallet) string {
+	t.Helper()
+	pkScript, err := txscript.PayToAddrScript(w.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev, _ := chainhash.NewHashFromStr(strings.Repeat("ab", 32))
+	unsigned := wire.NewMsgTx(2)
+	unsigned.AddTxIn(wire.NewTxIn(wire.NewOutPoint(prev, 0), nil, nil))
+	unsigned.AddTxOut(wire.NewTxOut(90000, pkScript))
+	packet, err := psbt.NewFromUnsignedTx(unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet.Inputs[0].WitnessUtxo = wire.NewTxOut(100000, pkScript)
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+// sign signs the packet's input with priv as a signer would, returning the
+// packet and the signature
+func sign(t *testing.T, w *MultiSigWallet, encoded string, priv *btcec.PrivateKey) (string, []byte) {
+	t.Helper()
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(encoded), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	prevOuts.AddPrevOut(packet.UnsignedTx.TxIn[0].PreviousOutPoint, packet.Inputs[0].WitnessUtxo)
+	hashes := txscript.NewTxSigHashes(packet.UnsignedTx, prevOuts)
+	sig, err := txscript.RawTxInWitnessSignature(packet.UnsignedTx, hashes, 0, 100000, w.WitnessScript(), txscript.SigHashAll, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet.Inputs[0].PartialSigs = append(packet.Inputs[0].PartialSigs, &psbt.PartialSig{
+		PubKey:    priv.PubKey().SerializeCompressed(),
+		Signature: sig,
+	})
+	signed, err := packet.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed, sig
+}
+
+func expectPending(mock pgxmock.PgxPoolIface, t *MultiSigTransaction) {
+	mock.ExpectQuery("FROM multisig_transactions").
+		WithArgs(t.ID, "hot").
+		WillReturnRows(pgxmock.NewRows([]string{"address", "txid", "psbt", "description", "required_signatures", "status", "broadcast_at", "created_at"}).
+			AddRow(t.Address, t.TxID, t.PSBT, t.Description, 2, "pending", (*time.Time)(nil), t.CreatedAt))
+}
+
+func TestMultiSigCollectsSignaturesAndBroadcasts(t *testing.T) {
+	node := &recordingNode{}
+	w, mock := newTestMultiSig(t, node)
+	keys := signerKeys()
+	ctx := context.Background()
+	id := uuid.New()
+
+	mock.ExpectQuery("INSERT INTO multisig_transactions").
+		WithArgs("hot", w.Address(), pgxmock.AnyArg(), pgxmock.AnyArg(), "Top up hot wallet", 2).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(id, time.Now()))
+	proposed, err := w.Propose(ctx, spendPacket(t, w), "Top up hot wallet")
+	if err != nil {
+		t.Fatalf("Propose() error = %v", err)
+	}
+
+	// The first signer leaves it one short
+	first, firstSig := sign(t, w, proposed.PSBT, keys[0])
+	key0 := hex.EncodeToString(keys[0].PubKey().SerializeCompressed())
+	mock.ExpectBegin()
+	expectPending(mock, proposed)
+	mock.ExpectExec("INSERT INTO multisig_signatures").
+		WithArgs(id, 0, key0, [][]byte{firstSig}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectQuery("FROM multisig_signatures").
+		WithArgs(id).
+		WillReturnRows(pgxmock.NewRows([]string{"signer_index", "signer_key", "signatures"}).
+			AddRow(0, key0, [][]byte{firstSig}))
+	mock.ExpectCommit()
+
+	got, err := w.SignTransaction(ctx, id, 0, first)
+	if err != nil {
+		t.Fatalf("SignTransaction(0) error = %v", err)
+	}
+	if got.Status != "pending" || len(node.sent) != 0 {
+		t.Fatalf("after one signature status = %s with %d broadcasts, want pending", got.Status, len(node.sent))
+	}
+
+	// The third completes 2 of 3
+	third, thirdSig := sign(t, w, proposed.PSBT, keys[2])
+	key2 := hex.EncodeToString(keys[2].PubKey().SerializeCompressed())
+	now := time.Now()
+	mock.ExpectBegin()
+	expectPending(mock, proposed)
+	mock.ExpectExec("INSERT INTO multisig_signatures").
+		WithArgs(id, 2, key2, [][]byte{thirdSig}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectQuery("FROM multisig_signatures").
+		WithArgs(id).
+		WillReturnRows(pgxmock.NewRows([]string{"signer_index", "signer_key", "signatures"}).
+			AddRow(0, key0, [][]byte{firstSig}).
+			AddRow(2, key2, [][]byte{thirdSig}))
+	mock.ExpectQuery("SET status = 'broadcast'").
+		WithArgs(id, pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"broadcast_at"}).AddRow(&now))
+	mock.ExpectCommit()
+
+	got, err = w.SignTransaction(ctx, id, 2, third)
+	if err != nil {
+		t.Fatalf("SignTransaction(2) error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if got.Status != "broadcast" || len(got.Signers) != 2 || len(node.sent) != 1 {
+		t.Fatalf("SignTransaction() = %+v after %d broadcasts, want broadcast once by signers 0 and 2", got, len(node.sent))
+	}
+
+	raw, _ := hex.DecodeString(node.sent[0])
+	var final wire.MsgTx
+	if err := final.Deserialize(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	witness := final.TxIn[0].Witness
+	if final.TxHash().String() != proposed.TxID || len(witness) != 4 || !bytes.Equal(witness[3], w.WitnessScript()) {
+		t.Errorf("broadcast %s with witness of %d items, want %s spending through the witness script", final.TxHash(), len(witness), proposed.TxID)
+	}
+}
+
+func TestMultiSigRejectsSignatureFromOtherKey(t *testing.T) {
+	node := &recordingNode{}
+	w, mock := newTestMultiSig(t, node)
+	proposed := &MultiSigTransaction{ID: uuid.New(), Address: w.Address(), CreatedAt: time.Now()}
+
+	// Propose adds the witness script the signer needs
+	encoded := spendPacket(t, w)
+	packet, _ := psbt.NewFromRawBytes(strings.NewReader(encoded), true)
+	packet.Inputs[0].WitnessScript = w.WitnessScript()
+	proposed.PSBT, _ = packet.B64Encode()
+	proposed.TxID = packet.UnsignedTx.TxHash().String()
+
+	// Signed by the second key but submitted as the first signer's
+	signed, _ := sign(t, w, proposed.PSBT, signerKeys()[1])
+	mock.ExpectBegin()
+	expectPending(mock, proposed)
+	mock.ExpectRollback()
+
+	_, err := w.SignTransaction(context.Background(), proposed.ID, 0, signed)
+	if !errors.Is(err, ErrInvalidMultiSigSignature) {
+		t.Errorf("SignTransaction() error = %v, want ErrInvalidMultiSigSignature", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if len(node.sent) != 0 {
+		t.Error("transaction broadcast without enough signatures")
+	}
+}
@@ -0,0 +1,646 @@
+// BitCurrent Exchange - Withdrawal Approvals
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// MaxApprovers is the most approvals any withdrawal needs, and what a
+// currency without bands needs
+const MaxApprovers = 2
+
+var (
+	ErrWithdrawalNotFound   = errors.New("withdrawal not found")
+	ErrWithdrawalNotPending = errors.New("withdrawal is not awaiting approval")
+	ErrWithdrawalExpired    = errors.New("withdrawal approval window has passed")
+	ErrNotApprover          = errors.New("approver is not an active admin")
+	ErrSelfApproval         = errors.New("approver requested the withdrawal")
+	ErrAlreadyDecided       = errors.New("approver has already decided on the withdrawal")
+	ErrReasonRequired       = errors.New("a reason is required")
+)
+
+// ApprovalBand sets the approvals needed for withdrawals up to MaxAmount.
+// The last band of a currency has no MaxAmount.
+type ApprovalBand struct {
+	// MaxAmount is the largest withdrawal the band covers, empty for no limit
+	MaxAmount string `mapstructure:"max_amount"`
+	// Approvers is the distinct admins who must approve, 0 to MaxApprovers
+	Approvers int `mapstructure:"approvers"`
+}
+
+type approvalBand struct {
+	maxAmount *decimal.Decimal
+	approvers int
+}
+
+// ApprovalPolicy resolves how many admins must approve a withdrawal from
+// its currency and amount
+type ApprovalPolicy struct {
+	bands map[string][]approvalBand
+}
+
+// DefaultApprovalBands is used for any currency not configured under
+// withdrawals.approvals.bands
+var DefaultApprovalBands = map[string][]ApprovalBand{
+	"BTC": {
+		{MaxAmount: "0.1", Approvers: 0},
+		{MaxAmount: "2", Approvers: 1},
+		{Approvers: 2},
+	},
+	"ETH": {
+		{MaxAmount: "2", Approvers: 0},
+		{MaxAmount: "50", Approvers: 1},
+		{Approvers: 2},
+	},
+	"MATIC": {
+		{MaxAmount: "5000", Approvers: 0},
+		{MaxAmount: "100000", Approvers: 1},
+		{Approvers: 2},
+	},
+	"USDC": {
+		{MaxAmount: "5000", Approvers: 0},
+		{MaxAmount: "100000", Approvers: 1},
+		{Approvers: 2},
+	},
+	"USDT": {
+		{MaxAmount: "5000", Approvers: 0},
+		{MaxAmount: "100000", Approvers: 1},
+		{Approvers: 2},
+	},
+	"GBP": {
+		{MaxAmount: "5000", Approvers: 0},
+		{MaxAmount: "100000", Approvers: 1},
+		{Approvers: 2},
+	},
+}
+
+// NewApprovalPolicy builds a policy from bands keyed by currency. Bands
+// must be in increasing MaxAmount order, end with an unbounded band, and
+// never need fewer approvers than the band below.
+func NewApprovalPolicy(rules map[string][]ApprovalBand) (*ApprovalPolicy, error) {
+	p := &ApprovalPolicy{bands: make(map[string][]approvalBand)}
+	for currency, bands := range rules {
+		resolved, err := resolveBands(bands)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", currency, err)
+		}
+		p.bands[strings.ToUpper(currency)] = resolved
+	}
+	return p, nil
+}
+
+// DefaultApprovalPolicy returns the policy for DefaultApprovalBands
+func DefaultApprovalPolicy() *ApprovalPolicy {
+	p, err := NewApprovalPolicy(DefaultApprovalBands)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Merge returns a policy using overrides where set and p elsewhere
+func (p *ApprovalPolicy) Merge(overrides *ApprovalPolicy) *ApprovalPolicy {
+	merged := &ApprovalPolicy{bands: make(map[string][]approvalBand)}
+	for k, b := range p.bands {
+		merged.bands[k] = b
+	}
+	for k, b := range overrides.bands {
+		merged.bands[k] = b
+	}
+	return merged
+}
+
+// Required returns the approvals a withdrawal needs
+func (p *ApprovalPolicy) Required(currency string, amount decimal.Decimal) int {
+	for _, b := range p.bands[strings.ToUpper(currency)] {
+		if b.maxAmount == nil || amount.LessThanOrEqual(*b.maxAmount) {
+			return b.approvers
+		}
+	}
+	return MaxApprovers
+}
+
+func resolveBands(bands []ApprovalBand) ([]approvalBand, error) {
+	if len(bands) == 0 {
+		return nil, errors.New("no bands")
+	}
+
+	resolved := make([]approvalBand, len(bands))
+	for i, b := range bands {
+		if b.Approvers < 0 || b.Approvers > MaxApprovers {
+			return nil, fmt.Errorf("band %d: approvers must be 0 to %d", i, MaxApprovers)
+		}
+		if i > 0 && b.Approvers < resolved[i-1].approvers {
+			return nil, fmt.Errorf("band %d: approvers must not decrease", i)
+		}
+		resolved[i].approvers = b.Approvers
+
+		last := i == len(bands)-1
+		if b.MaxAmount == "" {
+			if !last {
+				return nil, fmt.Errorf("band %d: only the last band may be unbounded", i)
+			}
+			continue
+		}
+		if last {
+			return nil, errors.New("last band must be unbounded")
+		}
+		max, err := decimal.NewFromString(b.MaxAmount)
+		if err != nil || !max.IsPositive() {
+			return nil, fmt.Errorf("band %d: invalid max_amount %q", i, b.MaxAmount)
+		}
+		if i > 0 && !max.GreaterThan(*resolved[i-1].maxAmount) {
+			return nil, fmt.Errorf("band %d: max_amount must increase", i)
+		}
+		resolved[i].maxAmount = &max
+	}
+	return resolved, nil
+}
+
+// ApprovalConfig controls how often pending withdrawals are checked and how
+// long they may wait for approval
+type ApprovalConfig struct {
+	Interval    time.Duration
+	ExpireAfter time.Duration
+}
+
+// DefaultApprovalConfig returns the approval defaults
+func DefaultApprovalConfig() ApprovalConfig {
+	return ApprovalConfig{
+		Interval:    time.Minute,
+		ExpireAfter: 72 * time.Hour,
+	}
+}
+
+// Approval is one admin's decision on a withdrawal
+type Approval struct {
+	ApproverID uuid.UUID `json:"approver_id"`
+	Decision   string    `json:"decision"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PendingApproval is a withdrawal waiting for admins to approve it
+type PendingApproval struct {
+	ID                uuid.UUID       `json:"id"`
+	AccountID         uuid.UUID       `json:"account_id"`
+	RequesterID       uuid.UUID       `json:"requester_id"`
+	Currency          string          `json:"currency"`
+	Amount            decimal.Decimal `json:"amount"`
+	Fee               decimal.Decimal `json:"fee"`
+	Address           string          `json:"address"`
+	RequiredApprovals int             `json:"required_approvals"`
+	Approvals         []Approval      `json:"approvals"`
+	CreatedAt         time.Time       `json:"created_at"`
+	ExpiresAt         time.Time       `json:"expires_at"`
+}
+
+// ApprovalResult is a withdrawal's state after a decision
+type ApprovalResult struct {
+	WithdrawalID      uuid.UUID `json:"withdrawal_id"`
+	Status            string    `json:"status"`
+	RequiredApprovals int       `json:"required_approvals"`
+	Approvals         int       `json:"approvals"`
+}
+
+// Approvals gates pending withdrawals on admin approval. Each withdrawal
+// needs the approvals its value band requires from distinct active admins,
+// none of them its requester; those needing none are approved on the next
+// pass. One rejection ends a request, and requests left pending past
+// ExpireAfter expire. Either way the withdrawal's hold is released.
+type Approvals struct {
+	db     *database.PostgresDB
+	policy *ApprovalPolicy
+	config ApprovalConfig
+	logger *zap.Logger
+}
+
+// NewApprovals creates the withdrawal approval queue
+func NewApprovals(db *database.PostgresDB, policy *ApprovalPolicy, cfg ApprovalConfig, logger *zap.Logger) *Approvals {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultApprovalConfig().Interval
+	}
+	if cfg.ExpireAfter <= 0 {
+		cfg.ExpireAfter = DefaultApprovalConfig().ExpireAfter
+	}
+	return &Approvals{
+		db:     db,
+		policy: policy,
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// Start runs approval passes until ctx is cancelled
+func (a *Approvals) Start(ctx context.Context) error {
+	a.logger.Info("Starting withdrawal approvals", zap.Duration("interval", a.config.Interval))
+
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.logger.Info("Withdrawal approvals stopped")
+			return ctx.Err()
+
+		case <-ticker.C:
+			if err := a.RunOnce(ctx); err != nil {
+				a.logger.Error("Withdrawal approval pass failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// RunOnce expires stale requests, then approves those needing no approvers
+func (a *Approvals) RunOnce(ctx context.Context) error {
+	if err := a.expire(ctx); err != nil {
+		return err
+	}
+	return a.approveUnbanded(ctx)
+}
+
+// expire closes requests pending longer than ExpireAfter and releases
+// their holds
+func (a *Approvals) expire(ctx context.Context) error {
+	var expired []uuid.UUID
+	err := a.db.WithTx(ctx, func(tx pgx.Tx) error {
+		expired = nil
+		rows, err := tx.Query(ctx, `
+			UPDATE withdrawals
+			SET status = 'expired',
+			    failure_reason = 'Not approved in time',
+			    updated_at = NOW()
+			WHERE status = 'pending' AND created_at < $1
+			RETURNING id
+		`, time.Now().Add(-a.config.ExpireAfter))
+		if err != nil {
+			return fmt.Errorf("failed to expire withdrawals: %w", err)
+		}
+		for rows.Next() {
+			var id uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			expired = append(expired, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range expired {
+			if _, err := releaseWithdrawalHold(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range expired {
+		a.logger.Warn("Withdrawal expired awaiting approval", zap.String("withdrawal_id", id.String()))
+	}
+	return nil
+}
+
+// approveUnbanded approves pending withdrawals whose band needs no
+// approvers
+func (a *Approvals) approveUnbanded(ctx context.Context) error {
+	rows, err := a.db.Pool.Query(ctx, `
+		SELECT id, currency, amount
+		FROM withdrawals
+		WHERE status = 'pending'
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to list pending withdrawals: %w", err)
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		var currency string
+		var amount decimal.Decimal
+		if err := rows.Scan(&id, &currency, &amount); err != nil {
+			rows.Close()
+			return err
+		}
+		if a.policy.Required(currency, amount) == 0 {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		_, err := a.db.Pool.Exec(ctx, `
+			UPDATE withdrawals
+			SET status = 'approved',
+			    required_approvals = 0,
+			    approved_at = NOW(),
+			    updated_at = NOW()
+			WHERE id = $1 AND status = 'pending'
+		`, id)
+		if err != nil {
+			return fmt.Errorf("failed to approve withdrawal: %w", err)
+		}
+		a.logger.Info("Withdrawal approved without review", zap.String("withdrawal_id", id.String()))
+	}
+	return nil
+}
+
+// pendingWithdrawal is a withdrawal locked for a decision
+type pendingWithdrawal struct {
+	currency    string
+	amount      decimal.Decimal
+	requesterID uuid.UUID
+	required    int
+}
+
+// lockPending locks a pending withdrawal for approverID to decide on,
+// checking the approver is an active admin
+func (a *Approvals) lockPending(ctx context.Context, tx pgx.Tx, withdrawalID, approverID uuid.UUID) (*pendingWithdrawal, error) {
+	var w pendingWithdrawal
+	var status string
+	var required *int16
+	var createdAt time.Time
+	err := tx.QueryRow(ctx, `
+		SELECT w.currency, w.amount, w.status, w.required_approvals, w.created_at, a.user_id
+		FROM withdrawals w
+		JOIN accounts a ON a.id = w.account_id
+		WHERE w.id = $1
+		FOR UPDATE OF w
+	`, withdrawalID).Scan(&w.currency, &w.amount, &status, &required, &createdAt, &w.requesterID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWithdrawalNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load withdrawal: %w", err)
+	}
+	if status != "pending" {
+		return nil, ErrWithdrawalNotPending
+	}
+	// Left for the next pass to expire and release
+	if time.Since(createdAt) > a.config.ExpireAfter {
+		return nil, ErrWithdrawalExpired
+	}
+
+	var admin bool
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(is_admin, FALSE) FROM users WHERE id = $1 AND status = 'active'
+	`, approverID).Scan(&admin)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !admin) {
+		return nil, ErrNotApprover
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load approver: %w", err)
+	}
+
+	// The requirement is fixed by the first decision, so a policy change
+	// does not move a withdrawal already under review
+	w.required = a.policy.Required(w.currency, w.amount)
+	if required != nil {
+		w.required = int(*required)
+	}
+	return &w, nil
+}
+
+// recordDecision stores an approver's decision, failing if they have
+// already made one
+func recordDecision(ctx context.Context, tx pgx.Tx, withdrawalID, approverID uuid.UUID, decision, reason string) error {
+	result, err := tx.Exec(ctx, `
+		INSERT INTO withdrawal_approvals (withdrawal_id, approver_id, decision, reason)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (withdrawal_id, approver_id) DO NOTHING
+	`, withdrawalID, approverID, decision, reason)
+	if err != nil {
+		return fmt.Errorf("failed to record %s decision: %w", decision, err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrAlreadyDecided
+	}
+	return nil
+}
+
+// Approve records an admin's approval of a pending withdrawal, approving
+// it once its band's approvals are in. Requesters cannot approve their own
+// withdrawals.
+func (a *Approvals) Approve(ctx context.Context, withdrawalID, approverID uuid.UUID, reason string) (*ApprovalResult, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+
+	result := &ApprovalResult{WithdrawalID: withdrawalID, Status: "pending"}
+	err := a.db.WithTx(ctx, func(tx pgx.Tx) error {
+		w, err := a.lockPending(ctx, tx, withdrawalID, approverID)
+		if err != nil {
+			return err
+		}
+		if w.requesterID == approverID {
+			return ErrSelfApproval
+		}
+		if err := recordDecision(ctx, tx, withdrawalID, approverID, "approved", reason); err != nil {
+			return err
+		}
+		result.RequiredApprovals = w.required
+
+		if err := tx.QueryRow(ctx, `
+			SELECT COUNT(*) FROM withdrawal_approvals
+			WHERE withdrawal_id = $1 AND decision = 'approved'
+		`, withdrawalID).Scan(&result.Approvals); err != nil {
+			return fmt.Errorf("failed to count approvals: %w", err)
+		}
+
+		// approved_by is whoever completed the approvals
+		if result.Approvals >= w.required {
+			result.Status = "approved"
+			_, err = tx.Exec(ctx, `
+				UPDATE withdrawals
+				SET status = 'approved',
+				    required_approvals = $2,
+				    approved_at = NOW(),
+				    approved_by = $3,
+				    updated_at = NOW()
+				WHERE id = $1
+			`, withdrawalID, w.required, approverID)
+		} else {
+			_, err = tx.Exec(ctx, `
+				UPDATE withdrawals
+				SET required_approvals = $2, updated_at = NOW()
+				WHERE id = $1
+			`, withdrawalID, w.required)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update withdrawal: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.logger.Info("Withdrawal approval recorded",
+		zap.String("withdrawal_id", withdrawalID.String()),
+		zap.String("approver_id", approverID.String()),
+		zap.Int("approvals", result.Approvals),
+		zap.Int("required_approvals", result.RequiredApprovals),
+		zap.String("status", result.Status),
+	)
+	return result, nil
+}
+
+// Reject records an admin's rejection of a pending withdrawal, closing it
+// and releasing its hold
+func (a *Approvals) Reject(ctx context.Context, withdrawalID, approverID uuid.UUID, reason string) (*ApprovalResult, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+
+	result := &ApprovalResult{WithdrawalID: withdrawalID, Status: "rejected"}
+	err := a.db.WithTx(ctx, func(tx pgx.Tx) error {
+		w, err := a.lockPending(ctx, tx, withdrawalID, approverID)
+		if err != nil {
+			return err
+		}
+		if err := recordDecision(ctx, tx, withdrawalID, approverID, "rejected", reason); err != nil {
+			return err
+		}
+		result.RequiredApprovals = w.required
+
+		if _, err := tx.Exec(ctx, `
+			UPDATE withdrawals
+			SET status = 'rejected',
+			    required_approvals = $2,
+			    failure_reason = $3,
+			    updated_at = NOW()
+			WHERE id = $1
+		`, withdrawalID, w.required, "Rejected: "+reason); err != nil {
+			return fmt.Errorf("failed to reject withdrawal: %w", err)
+		}
+		_, err = releaseWithdrawalHold(ctx, tx, withdrawalID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.logger.Info("Withdrawal rejected",
+		zap.String("withdrawal_id", withdrawalID.String()),
+		zap.String("approver_id", approverID.String()),
+		zap.String("reason", reason),
+	)
+	return result, nil
+}
+
+// Queue returns the withdrawals waiting for approval, oldest first
+func (a *Approvals) Queue(ctx context.Context) ([]PendingApproval, error) {
+	rows, err := a.db.Pool.Query(ctx, `
+		SELECT w.id, w.account_id, a.user_id, w.currency, w.amount, w.fee,
+		       w.address, w.required_approvals, w.created_at
+		FROM withdrawals w
+		JOIN accounts a ON a.id = w.account_id
+		WHERE w.status = 'pending'
+		ORDER BY w.created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending withdrawals: %w", err)
+	}
+	defer rows.Close()
+
+	var queue []PendingApproval
+	index := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var p PendingApproval
+		var required *int16
+		if err := rows.Scan(&p.ID, &p.AccountID, &p.RequesterID, &p.Currency, &p.Amount, &p.Fee,
+			&p.Address, &required, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		p.RequiredApprovals = a.policy.Required(p.Currency, p.Amount)
+		if required != nil {
+			p.RequiredApprovals = int(*required)
+		}
+		// Approved on the next pass without review
+		if p.RequiredApprovals == 0 {
+			continue
+		}
+		p.Approvals = []Approval{}
+		p.ExpiresAt = p.CreatedAt.Add(a.config.ExpireAfter)
+		index[p.ID] = len(queue)
+		queue = append(queue, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(queue) == 0 {
+		return queue, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(queue))
+	for _, p := range queue {
+		ids = append(ids, p.ID)
+	}
+	approvals, err := a.db.Pool.Query(ctx, `
+		SELECT withdrawal_id, approver_id, decision, reason, created_at
+		FROM withdrawal_approvals
+		WHERE withdrawal_id = ANY($1)
+		ORDER BY created_at
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list approvals: %w", err)
+	}
+	defer approvals.Close()
+
+	for approvals.Next() {
+		var id uuid.UUID
+		var ap Approval
+		if err := approvals.Scan(&id, &ap.ApproverID, &ap.Decision, &ap.Reason, &ap.CreatedAt); err != nil {
+			return nil, err
+		}
+		i := index[id]
+		queue[i].Approvals = append(queue[i].Approvals, ap)
+	}
+	return queue, approvals.Err()
+}
+
+// Decisions returns every approval and rejection of a withdrawal
+func (a *Approvals) Decisions(ctx context.Context, withdrawalID uuid.UUID) ([]Approval, error) {
+	rows, err := a.db.Pool.Query(ctx, `
+		SELECT approver_id, decision, reason, created_at
+		FROM withdrawal_approvals
+		WHERE withdrawal_id = $1
+		ORDER BY created_at
+	`, withdrawalID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list approvals: %w", err)
+	}
+	defer rows.Close()
+
+	decisions := []Approval{}
+	for rows.Next() {
+		var ap Approval
+		if err := rows.Scan(&ap.ApproverID, &ap.Decision, &ap.Reason, &ap.CreatedAt); err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, ap)
+	}
+	return decisions, rows.Err()
+}
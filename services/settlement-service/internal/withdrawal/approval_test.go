@@ -0,0 +1,219 @@
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+func TestApprovalPolicyRequired(t *testing.T) {
+	policy := DefaultApprovalPolicy()
+
+	tests := []struct {
+		currency string
+		amount   string
+		want     int
+	}{
+		{"BTC", "0.05", 0},
+		{"BTC", "0.1", 0},
+		{"BTC", "0.10000001", 1},
+		{"BTC", "2", 1},
+		{"BTC", "25", 2},
+		{"btc", "1", 1},
+		{"GBP", "250000", 2},
+		{"DOGE", "1", MaxApprovers},
+	}
+
+	for _, tt := range tests {
+		got := policy.Required(tt.currency, decimal.RequireFromString(tt.amount))
+		if got != tt.want {
+			t.Errorf("Required(%s, %s) = %d, want %d", tt.currency, tt.amount, got, tt.want)
+		}
+	}
+
+	overrides, err := NewApprovalPolicy(map[string][]ApprovalBand{
+		"btc": {{MaxAmount: "1", Approvers: 1}, {Approvers: 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := policy.Merge(overrides)
+	if got := merged.Required("BTC", decimal.RequireFromString("0.05")); got != 1 {
+		t.Errorf("overridden Required(BTC, 0.05) = %d, want 1", got)
+	}
+	if got := merged.Required("ETH", decimal.RequireFromString("1")); got != 0 {
+		t.Errorf("merged Required(ETH, 1) = %d, want default 0", got)
+	}
+}
+
+func TestNewApprovalPolicyRejectsInvalidBands(t *testing.T) {
+	tests := map[string][]ApprovalBand{
+		"no bands":            {},
+		"too many approvers":  {{Approvers: 3}},
+		"bounded last band":   {{MaxAmount: "1", Approvers: 1}},
+		"unbounded middle":    {{Approvers: 0}, {Approvers: 1}},
+		"decreasing amount":   {{MaxAmount: "2", Approvers: 0}, {MaxAmount: "1", Approvers: 1}, {Approvers: 2}},
+		"decreasing approver": {{MaxAmount: "1", Approvers: 1}, {Approvers: 0}},
+		"invalid amount":      {{MaxAmount: "-1", Approvers: 0}, {Approvers: 1}},
+	}
+
+	for name, bands := range tests {
+		if _, err := NewApprovalPolicy(map[string][]ApprovalBand{"BTC": bands}); err == nil {
+			t.Errorf("%s: NewApprovalPolicy() succeeded", name)
+		}
+	}
+}
+
+func newTestApprovals(t *testing.T) (*Approvals, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+	return NewApprovals(database.New(mock, zap.NewNop()), DefaultApprovalPolicy(), DefaultApprovalConfig(), zap.NewNop()), mock
+}
+
+// expectPending expects a pending withdrawal of amount BTC to be locked and
+// the approver checked
+func expectPending(mock pgxmock.PgxPoolIface, withdrawalID, requesterID, approverID uuid.UUID, amount string, admin bool) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM withdrawals w").
+		WithArgs(withdrawalID).
+		WillReturnRows(pgxmock.NewRows([]string{"currency", "amount", "status", "required_approvals", "created_at", "user_id"}).
+			AddRow("BTC", decimal.RequireFromString(amount), "pending", (*int16)(nil), time.Now().Add(-time.Hour), requesterID))
+	mock.ExpectQuery("SELECT COALESCE\\(is_admin, FALSE\\) FROM users").
+		WithArgs(approverID).
+		WillReturnRows(pgxmock.NewRows([]string{"is_admin"}).AddRow(admin))
+}
+
+// A withdrawal in the two-approver band stays pending after one approval
+// and is approved by a second, different admin
+func TestApproveNeedsDistinctAdmins(t *testing.T) {
+	approvals, mock := newTestApprovals(t)
+	withdrawalID, requesterID := uuid.New(), uuid.New()
+	first, second := uuid.New(), uuid.New()
+
+	for i, approverID := range []uuid.UUID{first, second} {
+		expectPending(mock, withdrawalID, requesterID, approverID, "5", true)
+		mock.ExpectExec("INSERT INTO withdrawal_approvals").
+			WithArgs(withdrawalID, approverID, "approved", "Verified with customer").
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM withdrawal_approvals").
+			WithArgs(withdrawalID).
+			WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(i + 1))
+		if i == 0 {
+			mock.ExpectExec("SET required_approvals = \\$2").
+				WithArgs(withdrawalID, 2).
+				WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		} else {
+			mock.ExpectExec("SET status = 'approved'").
+				WithArgs(withdrawalID, 2, approverID).
+				WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		}
+		mock.ExpectCommit()
+	}
+
+	result, err := approvals.Approve(context.Background(), withdrawalID, first, " Verified with customer ")
+	if err != nil {
+		t.Fatalf("first Approve() error = %v", err)
+	}
+	if result.Status != "pending" || result.Approvals != 1 || result.RequiredApprovals != 2 {
+		t.Errorf("after first approval: %+v", result)
+	}
+	result, err = approvals.Approve(context.Background(), withdrawalID, second, "Verified with customer")
+	if err != nil {
+		t.Fatalf("second Approve() error = %v", err)
+	}
+	if result.Status != "approved" || result.Approvals != 2 {
+		t.Errorf("after second approval: %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApproveRefusesRequesterAndNonAdmins(t *testing.T) {
+	approvals, mock := newTestApprovals(t)
+	withdrawalID, requesterID, other := uuid.New(), uuid.New(), uuid.New()
+
+	expectPending(mock, withdrawalID, requesterID, requesterID, "1", true)
+	mock.ExpectRollback()
+	expectPending(mock, withdrawalID, requesterID, other, "1", false)
+	mock.ExpectRollback()
+
+	if _, err := approvals.Approve(context.Background(), withdrawalID, requesterID, "Mine"); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("self approval error = %v, want ErrSelfApproval", err)
+	}
+	if _, err := approvals.Approve(context.Background(), withdrawalID, other, "Looks fine"); !errors.Is(err, ErrNotApprover) {
+		t.Errorf("non-admin approval error = %v, want ErrNotApprover", err)
+	}
+	if _, err := approvals.Approve(context.Background(), withdrawalID, other, "  "); !errors.Is(err, ErrReasonRequired) {
+		t.Errorf("approval without reason error = %v, want ErrReasonRequired", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A rejection closes the withdrawal and returns its held balance
+func TestRejectReleasesHold(t *testing.T) {
+	approvals, mock := newTestApprovals(t)
+	withdrawalID, requesterID, approverID := uuid.New(), uuid.New(), uuid.New()
+	accountID := uuid.New()
+
+	expectPending(mock, withdrawalID, requesterID, approverID, "1", true)
+	mock.ExpectExec("INSERT INTO withdrawal_approvals").
+		WithArgs(withdrawalID, approverID, "rejected", "Address on sanctions list").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("SET status = 'rejected'").
+		WithArgs(withdrawalID, 1, "Rejected: Address on sanctions list").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectHoldReturned(mock, withdrawalID, accountID, "BTC", "1.0001")
+	mock.ExpectCommit()
+
+	result, err := approvals.Reject(context.Background(), withdrawalID, approverID, "Address on sanctions list")
+	if err != nil {
+		t.Fatalf("Reject() error = %v", err)
+	}
+	if result.Status != "rejected" {
+		t.Errorf("status = %s, want rejected", result.Status)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Stale requests expire, and those in a no-approver band are approved
+func TestApprovalsRunOnce(t *testing.T) {
+	approvals, mock := newTestApprovals(t)
+	stale, small, large := uuid.New(), uuid.New(), uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SET status = 'expired'").
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(stale))
+	expectNoHold(mock, stale)
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT id, currency, amount").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "currency", "amount"}).
+			AddRow(small, "BTC", decimal.RequireFromString("0.01")).
+			AddRow(large, "BTC", decimal.RequireFromString("3")))
+	mock.ExpectExec("SET status = 'approved'").
+		WithArgs(small).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	if err := approvals.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
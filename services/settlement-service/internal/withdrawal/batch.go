@@ -0,0 +1,138 @@
+// BitCurrent Exchange - Bitcoin Withdrawal Batching
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// BatchConfig controls batching of Bitcoin withdrawals. When enabled,
+// approved withdrawals wait until MaxSize of them are queued or the oldest
+// has waited Window, then all are paid by one transaction.
+type BatchConfig struct {
+	Enabled bool
+	Window  time.Duration
+	MaxSize int
+}
+
+// DefaultBatchConfig returns the batching defaults, with batching off
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		Window:  10 * time.Minute,
+		MaxSize: 50,
+	}
+}
+
+type batchCandidate struct {
+	ID         uuid.UUID
+	Amount     decimal.Decimal
+	Address    string
+	ApprovedAt time.Time
+}
+
+// batchReady reports whether a queue of count withdrawals, the oldest
+// approved at oldest, should be paid now
+func (c BatchConfig) batchReady(count int, oldest, now time.Time) bool {
+	if count == 0 {
+		return false
+	}
+	return count >= c.MaxSize || now.Sub(oldest) >= c.Window
+}
+
+// processBitcoinBatch pays the queued approved Bitcoin withdrawals in one
+// transaction once the batch is full or its window has passed. Withdrawals
+// that can never be paid are failed first so they do not hold the rest up.
+func (p *Processor) processBitcoinBatch(ctx context.Context) error {
+	rows, err := p.db.Pool.Query(ctx, `
+		SELECT id, amount, address, COALESCE(approved_at, created_at)
+		FROM withdrawals
+		WHERE status = 'approved' AND currency = 'BTC'
+		ORDER BY COALESCE(approved_at, created_at), id
+		LIMIT $1
+	`, p.batch.MaxSize)
+	if err != nil {
+		return fmt.Errorf("failed to load queued bitcoin withdrawals: %w", err)
+	}
+	var queued []batchCandidate
+	for rows.Next() {
+		var c batchCandidate
+		if err := rows.Scan(&c.ID, &c.Amount, &c.Address, &c.ApprovedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		queued = append(queued, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(queued) == 0 || !p.batch.batchReady(len(queued), queued[0].ApprovedAt, time.Now()) {
+		return nil
+	}
+
+	payments := make([]Payment, 0, len(queued))
+	for _, c := range queued {
+		payment, err := bitcoinPayment(c.ID, c.Address, c.Amount)
+		if err == nil {
+			_, err = p.btcTx.paymentOutput(payment)
+		}
+		if err != nil {
+			p.logger.Error("Failed to process withdrawal",
+				zap.String("withdrawal_id", c.ID.String()),
+				zap.Error(err),
+			)
+			p.markWithdrawalFailed(ctx, c.ID, err.Error())
+			continue
+		}
+		payments = append(payments, payment)
+	}
+	if len(payments) == 0 {
+		return nil
+	}
+
+	btx, err := p.btcTx.Build(ctx, payments)
+	switch {
+	case errors.Is(err, ErrInsufficientFunds):
+		// The hot wallet is short; the batch waits for funds
+		p.logger.Warn("Insufficient UTXOs for withdrawal batch, will retry",
+			zap.Int("batch_size", len(payments)),
+		)
+		return nil
+	case errors.Is(err, ErrWithdrawalUnavailable):
+		// Another processor took one of them; the rest are still queued
+		return nil
+	case err != nil:
+		return err
+	}
+
+	p.logger.Info("Bitcoin withdrawal batch awaiting signatures",
+		zap.String("bitcoin_transaction_id", btx.ID.String()),
+		zap.String("txid", btx.TxID),
+		zap.Int("batch_size", len(payments)),
+		zap.Int64("fee_sats", btx.Fee),
+	)
+	return nil
+}
+
+// bitcoinPayment converts a withdrawal to a Payment in satoshis
+func bitcoinPayment(withdrawalID uuid.UUID, address string, amount decimal.Decimal) (Payment, error) {
+	if !amount.IsPositive() {
+		return Payment{}, fmt.Errorf("invalid withdrawal amount: %s", amount)
+	}
+	sats, err := amount.MinorUnits(8)
+	if err != nil {
+		return Payment{}, err
+	}
+	return Payment{
+		WithdrawalID: withdrawalID,
+		Address:      address,
+		Amount:       sats.Int64(),
+	}, nil
+}
@@ -0,0 +1,264 @@
+package withdrawal
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+func TestBatchReady(t *testing.T) {
+	cfg := BatchConfig{Enabled: true, Window: 10 * time.Minute, MaxSize: 3}
+	now := time.Now()
+	tests := map[string]struct {
+		count  int
+		oldest time.Time
+		want   bool
+	}{
+		"empty":          {0, now.Add(-time.Hour), false},
+		"filling":        {2, now.Add(-time.Minute), false},
+		"full":           {3, now, true},
+		"window elapsed": {1, now.Add(-10 * time.Minute), true},
+	}
+	for name, tt := range tests {
+		if got := cfg.batchReady(tt.count, tt.oldest, now); got != tt.want {
+			t.Errorf("%s: batchReady = %v, want %v", name, got, tt.want)
+		}
+	}
+}
+
+type queuedWithdrawal struct {
+	id         uuid.UUID
+	address    string
+	approvedAt time.Time
+}
+
+// newBatchFixture returns a processor batching up to maxSize withdrawals
+// through the fixture's builder
+func newBatchFixture(t *testing.T, maxSize int) (*builderFixture, *Processor) {
+	t.Helper()
+	f := newBuilderFixture(t)
+	p := NewProcessor(f.builder.db, nil, nil, nil, f.builder, nil, ProcessorConfig{
+		Batch: BatchConfig{Enabled: true, Window: 10 * time.Minute, MaxSize: maxSize},
+	}, zap.NewNop())
+	return f, p
+}
+
+// payee returns a receive address of the fixture's wallet to pay
+func (f *builderFixture) payee(t *testing.T, index uint32) string {
+	t.Helper()
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(f.depositScript(t, index), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addrs[0].EncodeAddress()
+}
+
+// queue returns count withdrawals of 0.001 BTC approved age ago
+func (f *builderFixture) queue(t *testing.T, count int, age time.Duration) []queuedWithdrawal {
+	t.Helper()
+	queued := make([]queuedWithdrawal, count)
+	for i := range queued {
+		queued[i] = queuedWithdrawal{uuid.New(), f.payee(t, uint32(10+i)), time.Now().Add(-age)}
+	}
+	return queued
+}
+
+func expectQueued(mock pgxmock.PgxPoolIface, maxSize int, queued []queuedWithdrawal) {
+	rows := pgxmock.NewRows([]string{"id", "amount", "address", "approved_at"})
+	for _, q := range queued {
+		rows.AddRow(q.id, decimal.RequireFromString("0.001"), q.address, q.approvedAt)
+	}
+	mock.ExpectQuery("WHERE status = 'approved' AND currency = 'BTC'").
+		WithArgs(maxSize).
+		WillReturnRows(rows)
+}
+
+// expectBatchBuild expects one transaction paying 100000 sats to each of
+// queued from the fixture's 500000 sat UTXO. The transaction returned is
+// filled in as it is stored.
+func (f *builderFixture) expectBatchBuild(t *testing.T, id uuid.UUID, queued []queuedWithdrawal) *BitcoinTransaction {
+	t.Helper()
+	btx := f.expectBatchTransaction(t, id, queued)
+	for _, q := range queued {
+		f.mock.ExpectExec("UPDATE withdrawals").
+			WithArgs(id, pgxmock.AnyArg(), pgxmock.AnyArg(), q.id).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	}
+	f.mock.ExpectCommit()
+	return btx
+}
+
+// expectBatchTransaction expects the batch transaction to be stored, up to
+// linking its withdrawals
+func (f *builderFixture) expectBatchTransaction(t *testing.T, id uuid.UUID, queued []queuedWithdrawal) *BitcoinTransaction {
+	t.Helper()
+	mock := f.mock
+	// 1 input and a change output besides the payments at 10 sat/vB
+	vsize := int64(11 + 68 + 31*(len(queued)+1))
+	fee := vsize * 10
+	btx := &BitcoinTransaction{ID: id, Fee: fee, FeeRate: 10, VSize: vsize, Status: "unsigned", Kind: "payment", CreatedAt: time.Now()}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM bitcoin_utxos").
+		WillReturnRows(pgxmock.NewRows([]string{"txid", "vout", "amount_sats", "script_pub_key", "derivation_path"}).
+			AddRow(testUTXOTxID, int64(1), int64(500000), hex.EncodeToString(f.depositScript(t, 0)), "m/84'/0'/0'/0/0"))
+	mock.ExpectQuery("SELECT next_index FROM hd_index_counters").
+		WithArgs(changeCounter).
+		WillReturnRows(pgxmock.NewRows([]string{"next_index"}).AddRow(int64(0)))
+	mock.ExpectExec("UPDATE hd_index_counters").
+		WithArgs(changeCounter, int64(1)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery("INSERT INTO bitcoin_transactions").
+		WithArgs(capture{&btx.TxID}, capture{&btx.PSBT}, fee, int64(10), vsize, "payment", (*uuid.UUID)(nil)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(id, btx.CreatedAt))
+	mock.ExpectExec("UPDATE bitcoin_utxos").
+		WithArgs(testUTXOTxID, int64(1), id).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("INSERT INTO bitcoin_utxos").
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), 500000-int64(len(queued))*100000-fee,
+			pgxmock.AnyArg(), pgxmock.AnyArg(), "m/84'/0'/0'/1/0").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	return btx
+}
+
+// A batch still filling inside its window is left queued
+func TestProcessBitcoinBatchWaitsForWindow(t *testing.T) {
+	f, p := newBatchFixture(t, 3)
+	expectQueued(f.mock, 3, f.queue(t, 2, time.Minute))
+
+	if err := p.processBitcoinBatch(context.Background()); err != nil {
+		t.Fatalf("processBitcoinBatch() error = %v", err)
+	}
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// At MaxSize the queued withdrawals are paid by one transaction without
+// waiting for the window; later ones are left for the next batch
+func TestProcessBitcoinBatchPaysFullBatchTogether(t *testing.T) {
+	f, p := newBatchFixture(t, 3)
+	queued := f.queue(t, 3, time.Minute)
+	id := uuid.New()
+	expectQueued(f.mock, 3, queued)
+	btx := f.expectBatchBuild(t, id, queued)
+
+	if err := p.processBitcoinBatch(context.Background()); err != nil {
+		t.Fatalf("processBitcoinBatch() error = %v", err)
+	}
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(btx.PSBT), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paid := 0
+	for _, out := range packet.UnsignedTx.TxOut {
+		if out.Value == 100000 {
+			paid++
+		}
+	}
+	if len(packet.UnsignedTx.TxOut) != 4 || paid != 3 {
+		t.Errorf("outputs = %+v, want 3 payments and change", packet.UnsignedTx.TxOut)
+	}
+}
+
+// Once the window passes a part-filled batch is paid too
+func TestProcessBitcoinBatchPaysAfterWindow(t *testing.T) {
+	f, p := newBatchFixture(t, 50)
+	queued := f.queue(t, 2, 10*time.Minute)
+	expectQueued(f.mock, 50, queued)
+	f.expectBatchBuild(t, uuid.New(), queued)
+
+	if err := p.processBitcoinBatch(context.Background()); err != nil {
+		t.Fatalf("processBitcoinBatch() error = %v", err)
+	}
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A build that fails leaves the whole batch approved: nothing is linked
+// to a transaction unless all of it is
+func TestProcessBitcoinBatchLeavesBatchQueuedWhenBuildFails(t *testing.T) {
+	f, p := newBatchFixture(t, 3)
+	queued := f.queue(t, 3, time.Minute)
+
+	// The UTXO set cannot be read
+	expectQueued(f.mock, 3, queued)
+	f.mock.ExpectBegin()
+	f.mock.ExpectQuery("FROM bitcoin_utxos").WillReturnError(errors.New("connection reset"))
+	f.mock.ExpectRollback()
+	if err := p.processBitcoinBatch(context.Background()); err == nil {
+		t.Error("processBitcoinBatch() error = nil, want the build error")
+	}
+
+	// The hot wallet cannot cover the batch; it waits for funds
+	expectQueued(f.mock, 3, queued)
+	f.mock.ExpectBegin()
+	f.mock.ExpectQuery("FROM bitcoin_utxos").
+		WillReturnRows(pgxmock.NewRows([]string{"txid", "vout", "amount_sats", "script_pub_key", "derivation_path"}).
+			AddRow(testUTXOTxID, int64(1), int64(250000), hex.EncodeToString(f.depositScript(t, 0)), "m/84'/0'/0'/0/0"))
+	f.mock.ExpectRollback()
+	if err := p.processBitcoinBatch(context.Background()); err != nil {
+		t.Errorf("processBitcoinBatch() error = %v, want nil while short of funds", err)
+	}
+
+	// One of them was taken by another processor; the rest stay queued
+	id := uuid.New()
+	expectQueued(f.mock, 3, queued)
+	f.expectBatchTransaction(t, id, queued)
+	for i, q := range queued {
+		linked := int64(1)
+		if i == 2 {
+			linked = 0
+		}
+		f.mock.ExpectExec("UPDATE withdrawals").
+			WithArgs(id, pgxmock.AnyArg(), pgxmock.AnyArg(), q.id).
+			WillReturnResult(pgxmock.NewResult("UPDATE", linked))
+	}
+	f.mock.ExpectRollback()
+	if err := p.processBitcoinBatch(context.Background()); err != nil {
+		t.Errorf("processBitcoinBatch() error = %v, want nil when a withdrawal is taken", err)
+	}
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A batch the node rejects is failed and every withdrawal in it requeued
+func TestRejectedBatchIsRequeuedWhole(t *testing.T) {
+	f, p := newBatchFixture(t, 3)
+	f.node.reject = &blockchain.RPCError{Code: -26, Message: "min relay fee not met"}
+	queued := f.queue(t, 3, time.Minute)
+	id := uuid.New()
+	expectQueued(f.mock, 3, queued)
+	btx := f.expectBatchBuild(t, id, queued)
+	if err := p.processBitcoinBatch(context.Background()); err != nil {
+		t.Fatalf("processBitcoinBatch() error = %v", err)
+	}
+
+	f.expectSigned(btx)
+	f.expectRequeued(btx, int64(len(queued)))
+
+	if _, err := f.builder.SubmitSignatures(context.Background(), id, f.sign(t, btx.PSBT, 0, 0)); !errors.Is(err, ErrBroadcastRejected) {
+		t.Fatalf("SubmitSignatures() error = %v, want ErrBroadcastRejected", err)
+	}
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
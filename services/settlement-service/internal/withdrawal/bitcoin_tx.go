@@ -0,0 +1,820 @@
+// BitCurrent Exchange - PSBT Bitcoin Withdrawals
+package withdrawal
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// feeTargetBlocks is the confirmation target passed to estimatesmartfee
+const feeTargetBlocks = 6
+
+// changeCounter is the hd_index_counters row for the internal branch
+const changeCounter = "bitcoin-change"
+
+// rbfSequence is set on every input so the transaction signals BIP125
+// replaceability and can be fee bumped
+const rbfSequence = wire.MaxTxInSequenceNum - 2
+
+var (
+	ErrBitcoinTransactionNotFound = errors.New("bitcoin transaction not found")
+	ErrAlreadyBroadcast           = errors.New("bitcoin transaction has already been broadcast")
+	ErrInvalidPSBT                = errors.New("invalid PSBT")
+	ErrPSBTMismatch               = errors.New("PSBT does not match the stored transaction")
+	ErrInvalidSignature           = errors.New("PSBT signatures do not validate")
+	ErrWithdrawalUnavailable      = errors.New("withdrawal is no longer waiting for a transaction")
+	ErrBroadcastRejected          = errors.New("bitcoin transaction rejected by the network")
+	ErrBroadcastFailed            = errors.New("bitcoin transaction signed but not yet broadcast")
+)
+
+// Payment is one withdrawal output. Amount is in satoshis.
+type Payment struct {
+	WithdrawalID uuid.UUID
+	Address      string
+	Amount       int64
+}
+
+// PaymentOutput ties a withdrawal to its output in a transaction.
+// FeeShare is the withdrawal's part of the network fee in satoshis.
+type PaymentOutput struct {
+	WithdrawalID uuid.UUID `json:"withdrawal_id"`
+	Index        uint32    `json:"output_index"`
+	FeeShare     int64     `json:"fee_share_sats"`
+}
+
+// BitcoinTransaction is a withdrawal transaction built from our UTXOs. PSBT
+// is the base64 BIP174 packet handed to the signers.
+type BitcoinTransaction struct {
+	ID          uuid.UUID       `json:"id"`
+	TxID        string          `json:"txid"`
+	PSBT        string          `json:"psbt"`
+	Fee         int64           `json:"fee_sats"`
+	FeeRate     int64           `json:"fee_rate"`
+	VSize       int64           `json:"vsize"`
+	Status      string          `json:"status"`
+	Kind        string          `json:"kind"`
+	ParentID    *uuid.UUID      `json:"parent_id,omitempty"`
+	Outputs     []PaymentOutput `json:"outputs,omitempty"`
+	BroadcastAt *time.Time      `json:"broadcast_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// BitcoinTxBuilder builds unsigned withdrawal transactions from the tracked
+// UTXO set and broadcasts them once the signers have signed
+type BitcoinTxBuilder struct {
+	db        *database.PostgresDB
+	btcClient *blockchain.BitcoinClient
+	hd        *wallet.HDWallet
+	logger    *zap.Logger
+}
+
+// NewBitcoinTxBuilder creates a new Bitcoin transaction builder
+func NewBitcoinTxBuilder(
+	db *database.PostgresDB,
+	btcClient *blockchain.BitcoinClient,
+	hd *wallet.HDWallet,
+	logger *zap.Logger,
+) *BitcoinTxBuilder {
+	return &BitcoinTxBuilder{
+		db:        db,
+		btcClient: btcClient,
+		hd:        hd,
+		logger:    logger,
+	}
+}
+
+// feeRate returns the node's fee estimate in whole sat/vB, rounded up
+func (b *BitcoinTxBuilder) feeRate() (int64, error) {
+	perKvB, err := b.btcClient.EstimateFee(feeTargetBlocks)
+	if err != nil {
+		return 0, fmt.Errorf("failed to estimate fee: %w", err)
+	}
+
+	// BTC/kvB to sat/vB is × 10^8 / 10^3
+	rate, err := perKvB.Mul(decimal.NewFromInt(100000)).Round(0, decimal.RoundUp).MinorUnits(0)
+	if err != nil {
+		return 0, err
+	}
+	if rate.Int64() < 1 {
+		return 1, nil
+	}
+	return rate.Int64(), nil
+}
+
+// paymentOutput returns the output for a payment, checking the address is
+// for our network and the amount is not dust
+func (b *BitcoinTxBuilder) paymentOutput(p Payment) (*wire.TxOut, error) {
+	params := b.hd.Params()
+	addr, err := btcutil.DecodeAddress(p.Address, params)
+	if err != nil || !addr.IsForNet(params) {
+		return nil, fmt.Errorf("invalid Bitcoin address %q", p.Address)
+	}
+	script, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported Bitcoin address %q: %w", p.Address, err)
+	}
+	if p.Amount < dustLimit(script) {
+		return nil, fmt.Errorf("%w: %d sats to %s", ErrDustOutput, p.Amount, p.Address)
+	}
+	return wire.NewTxOut(p.Amount, script), nil
+}
+
+// Build selects UTXOs for payments and stores the unsigned transaction as
+// a PSBT, with one output per payment. The inputs are marked spent by it
+// and every payment's withdrawal moved to processing and linked to its
+// output in the same database transaction, so concurrent builds never
+// select the same outputs and a batch is created whole or not at all.
+func (b *BitcoinTxBuilder) Build(ctx context.Context, payments []Payment) (*BitcoinTransaction, error) {
+	if len(payments) == 0 {
+		return nil, fmt.Errorf("no payments to build")
+	}
+
+	feeRate, err := b.feeRate()
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]*wire.TxOut, 0, len(payments)+1)
+	var total, outputVSize int64
+	for _, p := range payments {
+		out, err := b.paymentOutput(p)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, out)
+		total += p.Amount
+		outputVSize += outputVBytes(len(out.PkScript))
+	}
+
+	var result *BitcoinTransaction
+	err = b.db.WithTx(ctx, func(tx pgx.Tx) error {
+		utxos, err := lockAvailableUTXOs(ctx, tx)
+		if err != nil {
+			return err
+		}
+		sel, err := SelectCoins(utxos, total, outputVSize, feeRate)
+		if err != nil {
+			return err
+		}
+
+		unsigned, err := unsignedTx(sel.Inputs)
+		if err != nil {
+			return err
+		}
+
+		var change *UTXO
+		changeIndex := -1
+		if sel.Change > 0 {
+			if change, err = b.nextChangeOutput(ctx, tx, sel.Change); err != nil {
+				return err
+			}
+			// A fixed position would tell observers which output is ours
+			changeIndex = rand.IntN(len(outputs) + 1)
+			outputs = append(outputs[:changeIndex], append([]*wire.TxOut{wire.NewTxOut(change.Amount, change.ScriptPubKey)}, outputs[changeIndex:]...)...)
+		}
+		unsigned.TxOut = outputs
+
+		encoded, err := b.signingPacket(unsigned, sel.Inputs, change, changeIndex)
+		if err != nil {
+			return err
+		}
+
+		result = &BitcoinTransaction{
+			TxID:    unsigned.TxHash().String(),
+			PSBT:    encoded,
+			Fee:     sel.Fee,
+			FeeRate: feeRate,
+			VSize:   sel.VSize,
+			Status:  "unsigned",
+			Kind:    "payment",
+			Outputs: make([]PaymentOutput, len(payments)),
+		}
+		sizes := make([]int64, len(payments))
+		for i, p := range payments {
+			index := i
+			if changeIndex >= 0 && i >= changeIndex {
+				index++
+			}
+			result.Outputs[i] = PaymentOutput{WithdrawalID: p.WithdrawalID, Index: uint32(index)}
+			sizes[i] = outputVBytes(len(outputs[index].PkScript))
+		}
+		for i, share := range shareFee(sel.Fee, feeRate, sizes) {
+			result.Outputs[i].FeeShare = share
+		}
+		if err := storeTransaction(ctx, tx, result); err != nil {
+			return err
+		}
+
+		if err := spendUTXOs(ctx, tx, sel.Inputs, result.ID); err != nil {
+			return err
+		}
+
+		if change != nil {
+			if err := b.storeChangeOutput(ctx, tx, result.TxID, changeIndex, change); err != nil {
+				return err
+			}
+		}
+
+		// Any withdrawal cancelled or taken by another build aborts the
+		// whole transaction
+		for _, out := range result.Outputs {
+			tag, err := tx.Exec(ctx, `
+				UPDATE withdrawals
+				SET bitcoin_transaction_id = $1,
+				    bitcoin_output_index = $2,
+				    network_fee_sats = $3,
+				    status = 'processing',
+				    processed_at = COALESCE(processed_at, NOW()),
+				    updated_at = NOW()
+				WHERE id = $4 AND status IN ('approved', 'processing') AND bitcoin_transaction_id IS NULL
+			`, result.ID, int64(out.Index), out.FeeShare, out.WithdrawalID)
+			if err != nil {
+				return fmt.Errorf("failed to link withdrawal: %w", err)
+			}
+			if tag.RowsAffected() == 0 {
+				return fmt.Errorf("%w: %s", ErrWithdrawalUnavailable, out.WithdrawalID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b.logger.Info("Bitcoin withdrawal transaction built",
+		zap.String("id", result.ID.String()),
+		zap.String("txid", result.TxID),
+		zap.Int("payments", len(payments)),
+		zap.Int64("fee_sats", result.Fee),
+		zap.Int64("fee_rate", result.FeeRate),
+	)
+	return result, nil
+}
+
+// unsignedTx starts a transaction spending inputs, each signalling BIP125
+func unsignedTx(inputs []UTXO) (*wire.MsgTx, error) {
+	unsigned := wire.NewMsgTx(2)
+	for _, u := range inputs {
+		hash, err := chainhash.NewHashFromStr(u.TxID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UTXO txid %s: %w", u.TxID, err)
+		}
+		in := wire.NewTxIn(wire.NewOutPoint(hash, u.Vout), nil, nil)
+		in.Sequence = rbfSequence
+		unsigned.AddTxIn(in)
+	}
+	return unsigned, nil
+}
+
+// signingPacket wraps unsigned in a PSBT carrying what the signers need:
+// each input's previous output and key derivation, and the derivation of
+// the change at changeIndex if there is change
+func (b *BitcoinTxBuilder) signingPacket(unsigned *wire.MsgTx, inputs []UTXO, change *UTXO, changeIndex int) (string, error) {
+	packet, err := psbt.NewFromUnsignedTx(unsigned)
+	if err != nil {
+		return "", fmt.Errorf("failed to create PSBT: %w", err)
+	}
+	for i, u := range inputs {
+		derivation, err := b.hd.BitcoinDerivation(u.DerivationPath)
+		if err != nil {
+			return "", fmt.Errorf("UTXO %s:%d: %w", u.TxID, u.Vout, err)
+		}
+		packet.Inputs[i].WitnessUtxo = wire.NewTxOut(u.Amount, u.ScriptPubKey)
+		packet.Inputs[i].SighashType = txscript.SigHashAll
+		packet.Inputs[i].Bip32Derivation = []*psbt.Bip32Derivation{derivation}
+	}
+	if change != nil {
+		// Lets the signers recognise the change as ours
+		derivation, err := b.hd.BitcoinDerivation(change.DerivationPath)
+		if err != nil {
+			return "", err
+		}
+		packet.Outputs[changeIndex].Bip32Derivation = []*psbt.Bip32Derivation{derivation}
+	}
+
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode PSBT: %w", err)
+	}
+	return encoded, nil
+}
+
+// storeTransaction inserts a new unsigned transaction, setting its ID
+func storeTransaction(ctx context.Context, tx pgx.Tx, t *BitcoinTransaction) error {
+	err := tx.QueryRow(ctx, `
+		INSERT INTO bitcoin_transactions (txid, psbt, fee_sats, fee_rate, vsize, kind, parent_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, t.TxID, t.PSBT, t.Fee, t.FeeRate, t.VSize, t.Kind, t.ParentID).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to store bitcoin transaction: %w", err)
+	}
+	return nil
+}
+
+// spendUTXOs marks inputs spent by the transaction with ID spentBy
+func spendUTXOs(ctx context.Context, tx pgx.Tx, inputs []UTXO, spentBy uuid.UUID) error {
+	for _, u := range inputs {
+		if _, err := tx.Exec(ctx, `
+			UPDATE bitcoin_utxos
+			SET status = 'spent', spent_by = $3, updated_at = NOW()
+			WHERE txid = $1 AND vout = $2
+		`, u.TxID, int64(u.Vout), spentBy); err != nil {
+			return fmt.Errorf("failed to mark UTXO spent: %w", err)
+		}
+	}
+	return nil
+}
+
+// storeChangeOutput records a transaction's change, spendable once the
+// transaction confirms
+func (b *BitcoinTxBuilder) storeChangeOutput(ctx context.Context, tx pgx.Tx, txid string, index int, change *UTXO) error {
+	addr, err := txscript.ParsePkScript(change.ScriptPubKey)
+	if err != nil {
+		return err
+	}
+	address, err := addr.Address(b.hd.Params())
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO bitcoin_utxos (txid, vout, amount_sats, address, script_pub_key, derivation_path, status)
+		VALUES ($1, $2, $3, $4, $5, $6, 'pending')
+	`, txid, index, change.Amount, address.EncodeAddress(),
+		hex.EncodeToString(change.ScriptPubKey), change.DerivationPath); err != nil {
+		return fmt.Errorf("failed to store change output: %w", err)
+	}
+	return nil
+}
+
+// lockAvailableUTXOs loads the spendable UTXO set, skipping outputs another
+// build has locked
+func lockAvailableUTXOs(ctx context.Context, tx pgx.Tx) ([]UTXO, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT txid, vout, amount_sats, script_pub_key, derivation_path
+		FROM bitcoin_utxos
+		WHERE status = 'available'
+		ORDER BY amount_sats DESC
+		FOR UPDATE SKIP LOCKED
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load UTXOs: %w", err)
+	}
+	return scanUTXOs(rows)
+}
+
+// scanUTXOs reads rows of txid, vout, amount_sats, script_pub_key and
+// derivation_path
+func scanUTXOs(rows pgx.Rows) ([]UTXO, error) {
+	defer rows.Close()
+
+	var utxos []UTXO
+	for rows.Next() {
+		var u UTXO
+		var vout int64
+		var script string
+		if err := rows.Scan(&u.TxID, &vout, &u.Amount, &script, &u.DerivationPath); err != nil {
+			return nil, err
+		}
+		u.Vout = uint32(vout)
+		var err error
+		if u.ScriptPubKey, err = hex.DecodeString(script); err != nil {
+			return nil, fmt.Errorf("invalid script for UTXO %s:%d: %w", u.TxID, vout, err)
+		}
+		utxos = append(utxos, u)
+	}
+	return utxos, rows.Err()
+}
+
+// nextChangeOutput derives a fresh change address from the internal branch
+func (b *BitcoinTxBuilder) nextChangeOutput(ctx context.Context, tx pgx.Tx, amount int64) (*UTXO, error) {
+	var index int64
+	if err := tx.QueryRow(ctx, `
+		SELECT next_index FROM hd_index_counters WHERE chain = $1 FOR UPDATE
+	`, changeCounter).Scan(&index); err != nil {
+		return nil, fmt.Errorf("failed to lock change index: %w", err)
+	}
+
+	address, path, err := b.hd.DeriveChangeAddress(uint32(index))
+	if err != nil {
+		return nil, err
+	}
+	addr, err := btcutil.DecodeAddress(address, b.hd.Params())
+	if err != nil {
+		return nil, err
+	}
+	script, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE hd_index_counters SET next_index = $2, updated_at = NOW() WHERE chain = $1
+	`, changeCounter, index+1); err != nil {
+		return nil, fmt.Errorf("failed to advance change index: %w", err)
+	}
+	return &UTXO{Amount: amount, ScriptPubKey: script, DerivationPath: path}, nil
+}
+
+// Get returns a stored Bitcoin transaction
+func (b *BitcoinTxBuilder) Get(ctx context.Context, id uuid.UUID) (*BitcoinTransaction, error) {
+	t := &BitcoinTransaction{ID: id}
+	err := b.db.Pool.QueryRow(ctx, `
+		SELECT txid, psbt, fee_sats, fee_rate, vsize, status, kind, parent_id, broadcast_at, created_at
+		FROM bitcoin_transactions
+		WHERE id = $1
+	`, id).Scan(&t.TxID, &t.PSBT, &t.Fee, &t.FeeRate, &t.VSize, &t.Status, &t.Kind, &t.ParentID, &t.BroadcastAt, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrBitcoinTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// SubmitSignatures merges a PSBT returned by a signer into the stored one.
+// Once every input is signed the transaction is finalised, checked against
+// its inputs' scripts and stored as signed, then broadcast, and its
+// withdrawals get the txid for the Monitor to follow. If the node rejects
+// a payment outright it is failed and all of its withdrawals go back to
+// the approved queue together; a rejected fee bump is dropped, leaving the
+// transaction it bumps as it was, and a rejected consolidation or
+// rebalance fails its sweep or rebalance. A broadcast that may yet succeed
+// leaves the transaction signed for BroadcastSigned to send again.
+func (b *BitcoinTxBuilder) SubmitSignatures(ctx context.Context, id uuid.UUID, signed string) (*BitcoinTransaction, error) {
+	signedPacket, err := psbt.NewFromRawBytes(strings.NewReader(signed), true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPSBT, err)
+	}
+
+	var result *BitcoinTransaction
+	var packet *psbt.Packet
+	err = b.db.WithTx(ctx, func(tx pgx.Tx) error {
+		t, err := lockBitcoinTransaction(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if t.Status != "unsigned" && t.Status != "signed" {
+			return ErrAlreadyBroadcast
+		}
+
+		stored, err := psbt.NewFromRawBytes(strings.NewReader(t.PSBT), true)
+		if err != nil {
+			return fmt.Errorf("failed to decode stored PSBT: %w", err)
+		}
+		if signedPacket.UnsignedTx.TxHash() != stored.UnsignedTx.TxHash() {
+			return ErrPSBTMismatch
+		}
+		result = t
+		if t.Status == "signed" {
+			// Complete already; this submission retries the broadcast
+			packet = stored
+			return nil
+		}
+
+		mergeSignatures(stored, signedPacket)
+		complete, err := finalize(stored)
+		if err != nil {
+			return err
+		}
+		if complete {
+			final, err := psbt.Extract(stored)
+			if err != nil {
+				return fmt.Errorf("failed to extract transaction: %w", err)
+			}
+			if err := verifyScripts(final, stored); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+			}
+			t.Status = "signed"
+			packet = stored
+		}
+
+		// Stored before it is sent so a broadcast whose outcome is unknown
+		// is never forgotten
+		if t.PSBT, err = stored.B64Encode(); err != nil {
+			return fmt.Errorf("failed to encode PSBT: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE bitcoin_transactions
+			SET psbt = $2, status = $3, updated_at = NOW()
+			WHERE id = $1
+		`, id, t.PSBT, t.Status); err != nil {
+			return fmt.Errorf("failed to store signatures: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if packet == nil {
+		return result, nil
+	}
+	return b.broadcast(ctx, result, packet)
+}
+
+// BroadcastSigned sends again every transaction left signed by a broadcast
+// that did not get through
+func (b *BitcoinTxBuilder) BroadcastSigned(ctx context.Context) error {
+	rows, err := b.db.Pool.Query(ctx, `
+		SELECT id FROM bitcoin_transactions WHERE status = 'signed' ORDER BY created_at
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query signed transactions: %w", err)
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		t, err := b.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if t.Status != "signed" {
+			continue
+		}
+		packet, err := psbt.NewFromRawBytes(strings.NewReader(t.PSBT), true)
+		if err != nil {
+			return fmt.Errorf("failed to decode stored PSBT: %w", err)
+		}
+		if _, err := b.broadcast(ctx, t, packet); err != nil {
+			b.logger.Warn("Bitcoin transaction broadcast failed",
+				zap.String("id", id.String()),
+				zap.Error(err),
+			)
+		}
+	}
+	return nil
+}
+
+// broadcast sends a signed transaction to the node outside any database
+// transaction, then records the outcome. Only a definite rejection fails
+// it; any other error leaves it signed to be sent again.
+func (b *BitcoinTxBuilder) broadcast(ctx context.Context, t *BitcoinTransaction, packet *psbt.Packet) (*BitcoinTransaction, error) {
+	final, err := psbt.Extract(packet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract transaction: %w", err)
+	}
+	var raw bytes.Buffer
+	if err := final.Serialize(&raw); err != nil {
+		return nil, err
+	}
+
+	// Fee bumping counts blocks from here
+	height, err := b.btcClient.GetBlockHeight()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block height: %w", err)
+	}
+	_, err = b.btcClient.SendRawTransaction(hex.EncodeToString(raw.Bytes()))
+	switch {
+	case err == nil, errors.Is(err, blockchain.ErrAlreadyInMempool), errors.Is(err, blockchain.ErrAlreadyInChain):
+		// An earlier attempt may have got it out before failing to record it
+	case blockchain.IsBroadcastRejected(err):
+		return nil, b.reject(ctx, t, err)
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrBroadcastFailed, err)
+	}
+
+	recorded := false
+	err = b.db.WithTx(ctx, func(tx pgx.Tx) error {
+		current, err := lockBitcoinTransaction(ctx, tx, t.ID)
+		if err != nil {
+			return err
+		}
+		if current.Status != "signed" {
+			// Recorded by a concurrent attempt
+			*t = *current
+			return nil
+		}
+		err = tx.QueryRow(ctx, `
+			UPDATE bitcoin_transactions
+			SET status = 'broadcast',
+			    broadcast_at = NOW(),
+			    broadcast_height = $2,
+			    updated_at = NOW()
+			WHERE id = $1
+			RETURNING broadcast_at
+		`, t.ID, height).Scan(&t.BroadcastAt)
+		if err != nil {
+			return fmt.Errorf("failed to record broadcast: %w", err)
+		}
+		t.Status = "broadcast"
+		recorded = true
+		return recordBroadcast(ctx, tx, t, packet)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if recorded {
+		b.logger.Info("Bitcoin withdrawal transaction broadcast",
+			zap.String("id", t.ID.String()),
+			zap.String("txid", t.TxID),
+			zap.String("kind", t.Kind),
+		)
+	}
+	return t, nil
+}
+
+// reject fails a signed transaction the node refused: a payment's
+// withdrawals are requeued, a fee bump discarded and a consolidation or
+// rebalance failed
+func (b *BitcoinTxBuilder) reject(ctx context.Context, t *BitcoinTransaction, broadcastErr error) error {
+	var requeued int64
+	err := b.db.WithTx(ctx, func(tx pgx.Tx) error {
+		current, err := lockBitcoinTransaction(ctx, tx, t.ID)
+		if err != nil {
+			return err
+		}
+		if current.Status != "signed" {
+			return nil
+		}
+		switch t.Kind {
+		case "consolidation":
+			return rejectConsolidation(ctx, tx, t.ID, broadcastErr.Error())
+		case "rebalance":
+			return rejectRebalance(ctx, tx, t.ID, broadcastErr.Error())
+		case "replacement", "cpfp":
+			return discardFeeBump(ctx, tx, t.ID)
+		}
+		requeued, err = requeueBitcoinTransaction(ctx, tx, t.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	rejected := fmt.Errorf("%w: %v", ErrBroadcastRejected, broadcastErr)
+	b.logger.Warn("Bitcoin withdrawal transaction rejected",
+		zap.String("id", t.ID.String()),
+		zap.Int64("withdrawals_requeued", requeued),
+		zap.Error(rejected),
+	)
+	return rejected
+}
+
+// lockBitcoinTransaction loads a transaction for update
+func lockBitcoinTransaction(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*BitcoinTransaction, error) {
+	t := &BitcoinTransaction{ID: id}
+	err := tx.QueryRow(ctx, `
+		SELECT txid, psbt, fee_sats, fee_rate, vsize, status, kind, parent_id, broadcast_at, created_at
+		FROM bitcoin_transactions
+		WHERE id = $1
+		FOR UPDATE
+	`, id).Scan(&t.TxID, &t.PSBT, &t.Fee, &t.FeeRate, &t.VSize, &t.Status, &t.Kind, &t.ParentID, &t.BroadcastAt, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrBitcoinTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// recordBroadcast points the withdrawals a transaction pays at its txid and
+// records the txid, with each withdrawal's share of its fee, against them.
+// A consolidation or rebalance has no withdrawals; its sweep or rebalance
+// follows it instead.
+func recordBroadcast(ctx context.Context, tx pgx.Tx, t *BitcoinTransaction, packet *psbt.Packet) error {
+	if t.Kind == "consolidation" {
+		return recordConsolidationBroadcast(ctx, tx, t)
+	}
+	if t.Kind == "rebalance" {
+		return recordRebalanceBroadcast(ctx, tx, t)
+	}
+	if t.Kind == "payment" {
+		if _, err := tx.Exec(ctx, `
+			UPDATE withdrawals
+			SET txid = $2, last_seen_at = NOW(), updated_at = NOW()
+			WHERE bitcoin_transaction_id = $1 AND status = 'processing'
+		`, t.ID, t.TxID); err != nil {
+			return fmt.Errorf("failed to record withdrawal txid: %w", err)
+		}
+		// Build worked out each withdrawal's share
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO withdrawal_txids (withdrawal_id, txid, bitcoin_transaction_id, fee_sats)
+			SELECT id, $2, $1, COALESCE(network_fee_sats, 0)
+			FROM withdrawals
+			WHERE bitcoin_transaction_id = $1 AND status = 'processing'
+			ON CONFLICT DO NOTHING
+		`, t.ID, t.TxID); err != nil {
+			return fmt.Errorf("failed to record withdrawal txid: %w", err)
+		}
+		return nil
+	}
+	return recordFeeBump(ctx, tx, t, packet)
+}
+
+// requeueBitcoinTransaction fails a transaction the network will not
+// accept, releasing its inputs, and returns its withdrawals to the approved
+// queue to be paid by a new one. It returns how many were requeued.
+func requeueBitcoinTransaction(ctx context.Context, tx pgx.Tx, bitcoinTxID uuid.UUID) (int64, error) {
+	if err := releaseBitcoinTransaction(ctx, tx, bitcoinTxID); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE withdrawals
+		SET status = 'approved',
+		    bitcoin_transaction_id = NULL,
+		    bitcoin_output_index = NULL,
+		    network_fee_sats = NULL,
+		    processed_at = NULL,
+		    updated_at = NOW()
+		WHERE bitcoin_transaction_id = $1 AND status = 'processing'
+	`, bitcoinTxID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue withdrawals: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// mergeSignatures copies signatures and finalised inputs from a signer's
+// copy of the packet into ours
+func mergeSignatures(dst, src *psbt.Packet) {
+	for i := range dst.Inputs {
+		in, signed := &dst.Inputs[i], src.Inputs[i]
+		if in.FinalScriptWitness == nil && signed.FinalScriptWitness != nil {
+			in.FinalScriptWitness = signed.FinalScriptWitness
+			in.FinalScriptSig = signed.FinalScriptSig
+			in.PartialSigs = nil
+			continue
+		}
+
+		for _, sig := range signed.PartialSigs {
+			known := false
+			for _, have := range in.PartialSigs {
+				if bytes.Equal(have.PubKey, sig.PubKey) {
+					known = true
+					break
+				}
+			}
+			if !known {
+				in.PartialSigs = append(in.PartialSigs, sig)
+			}
+		}
+	}
+}
+
+// finalize finalises every input that has its signatures, reporting whether
+// all of them are
+func finalize(packet *psbt.Packet) (bool, error) {
+	for i := range packet.Inputs {
+		if _, err := psbt.MaybeFinalize(packet, i); err != nil && !errors.Is(err, psbt.ErrNotFinalizable) {
+			return false, fmt.Errorf("failed to finalise input %d: %w", i, err)
+		}
+	}
+	return packet.IsComplete(), nil
+}
+
+// verifyScripts runs each input's script against the transaction, so a bad
+// signature is rejected here rather than by the node
+func verifyScripts(tx *wire.MsgTx, packet *psbt.Packet) error {
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	for i, in := range tx.TxIn {
+		prevOuts.AddPrevOut(in.PreviousOutPoint, packet.Inputs[i].WitnessUtxo)
+	}
+	hashes := txscript.NewTxSigHashes(tx, prevOuts)
+
+	for i := range tx.TxIn {
+		prev := packet.Inputs[i].WitnessUtxo
+		vm, err := txscript.NewEngine(prev.PkScript, tx, i, txscript.StandardVerifyFlags, nil, hashes, prev.Value, prevOuts)
+		if err != nil {
+			return err
+		}
+		if err := vm.Execute(); err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+	return nil
+}
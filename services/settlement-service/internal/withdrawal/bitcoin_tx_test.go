@@ -0,0 +1,455 @@
+package withdrawal
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+// BIP84 test mnemonic; its master fingerprint is 73c5da0a
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+// Another BIP84 vector address, standing in for a customer's
+const testPayee = "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"
+
+type builderFixture struct {
+	builder *BitcoinTxBuilder
+	mock    pgxmock.PgxPoolIface
+	node    *walletNode
+	// Account key m/84'/0'/0', private, for signing
+	account *hdkeychain.ExtendedKey
+}
+
+func newBuilderFixture(t *testing.T) *builderFixture {
+	t.Helper()
+	params := &chaincfg.MainNetParams
+	master, err := wallet.MasterKeyFromMnemonic(testMnemonic, "", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := wallet.AccountXpub(master, wallet.ChainBitcoin, 0, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hd, err := wallet.NewHDWallet(wallet.HDConfig{Network: "mainnet", BitcoinXpub: xpub, BitcoinFingerprint: "73c5da0a"}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := master
+	for _, i := range []uint32{84, 0, 0} {
+		if account, err = account.Derive(hdkeychain.HardenedKeyStart + i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	node := &walletNode{height: 800000}
+	server := httptest.NewServer(http.HandlerFunc(node.serve))
+	t.Cleanup(server.Close)
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+
+	btc := blockchain.NewBitcoinClient(blockchain.BitcoinConfig{RPCURL: server.URL}, zap.NewNop())
+	return &builderFixture{
+		builder: NewBitcoinTxBuilder(database.New(mock, zap.NewNop()), btc, hd, zap.NewNop()),
+		mock:    mock,
+		node:    node,
+		account: account,
+	}
+}
+
+// depositScript is the P2WPKH script of receive address index
+func (f *builderFixture) depositScript(t *testing.T, index uint32) []byte {
+	t.Helper()
+	key, err := f.account.Derive(0)
+	if err == nil {
+		key, err = key.Derive(index)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := key.ECPubKey()
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(pub.SerializeCompressed()), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, _ := txscript.PayToAddrScript(addr)
+	return script
+}
+
+// sign signs every input of packet with the key at branch/index under the
+// account, as a signer holding the private keys would
+func (f *builderFixture) sign(t *testing.T, encoded string, branch, index uint32) string {
+	t.Helper()
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(encoded), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := f.account.Derive(branch)
+	if err == nil {
+		key, err = key.Derive(index)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, _ := key.ECPrivKey()
+
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	for i, in := range packet.UnsignedTx.TxIn {
+		prevOuts.AddPrevOut(in.PreviousOutPoint, packet.Inputs[i].WitnessUtxo)
+	}
+	hashes := txscript.NewTxSigHashes(packet.UnsignedTx, prevOuts)
+	for i := range packet.Inputs {
+		in := &packet.Inputs[i]
+		sig, err := txscript.RawTxInWitnessSignature(packet.UnsignedTx, hashes, i,
+			in.WitnessUtxo.Value, in.WitnessUtxo.PkScript, txscript.SigHashAll, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Added directly rather than through psbt.Updater, which would
+		// refuse a key that does not match the input
+		in.PartialSigs = append(in.PartialSigs, &psbt.PartialSig{
+			PubKey:    priv.PubKey().SerializeCompressed(),
+			Signature: sig,
+		})
+	}
+	signed, err := packet.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+const testUTXOTxID = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+
+func (f *builderFixture) build(t *testing.T, id, withdrawalID uuid.UUID) *BitcoinTransaction {
+	t.Helper()
+	mock := f.mock
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM bitcoin_utxos").
+		WillReturnRows(pgxmock.NewRows([]string{"txid", "vout", "amount_sats", "script_pub_key", "derivation_path"}).
+			AddRow(testUTXOTxID, int64(1), int64(500000), hex.EncodeToString(f.depositScript(t, 0)), "m/84'/0'/0'/0/0"))
+	mock.ExpectQuery("SELECT next_index FROM hd_index_counters").
+		WithArgs(changeCounter).
+		WillReturnRows(pgxmock.NewRows([]string{"next_index"}).AddRow(int64(0)))
+	mock.ExpectExec("UPDATE hd_index_counters").
+		WithArgs(changeCounter, int64(1)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	// 1 input and 2 outputs: 11 + 68 + 31 + 31 vB at 10 sat/vB
+	mock.ExpectQuery("INSERT INTO bitcoin_transactions").
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), int64(1410), int64(10), int64(141), "payment", (*uuid.UUID)(nil)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(id, time.Now()))
+	mock.ExpectExec("UPDATE bitcoin_utxos").
+		WithArgs(testUTXOTxID, int64(1), id).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("INSERT INTO bitcoin_utxos").
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), int64(500000-100000-1410),
+			"bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el", pgxmock.AnyArg(), "m/84'/0'/0'/1/0").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	// The change goes at a random position; the one payment pays the whole
+	// fee
+	mock.ExpectExec("UPDATE withdrawals").
+		WithArgs(id, pgxmock.AnyArg(), int64(1410), withdrawalID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	btx, err := f.builder.Build(context.Background(), []Payment{{WithdrawalID: withdrawalID, Address: testPayee, Amount: 100000}})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	return btx
+}
+
+func (f *builderFixture) expectStored(btx *BitcoinTransaction) {
+	f.mock.ExpectBegin()
+	f.expectLocked(btx, "unsigned")
+}
+
+// expectLocked expects btx to be loaded for update with status
+func (f *builderFixture) expectLocked(btx *BitcoinTransaction, status string) {
+	f.mock.ExpectQuery("FROM bitcoin_transactions").
+		WithArgs(btx.ID).
+		WillReturnRows(pgxmock.NewRows([]string{"txid", "psbt", "fee_sats", "fee_rate", "vsize", "status", "kind", "parent_id", "broadcast_at", "created_at"}).
+			AddRow(btx.TxID, btx.PSBT, btx.Fee, btx.FeeRate, btx.VSize, status, btx.Kind, btx.ParentID, (*time.Time)(nil), btx.CreatedAt))
+}
+
+// expectSigned expects the completed signatures to be stored, and the
+// transaction marked signed, in a database transaction of their own before
+// the broadcast's outcome is recorded in the next
+func (f *builderFixture) expectSigned(btx *BitcoinTransaction) {
+	f.expectStored(btx)
+	f.mock.ExpectExec("SET psbt = \\$2, status = \\$3").
+		WithArgs(btx.ID, pgxmock.AnyArg(), "signed").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	f.mock.ExpectCommit()
+}
+
+// expectBroadcastRecorded expects a signed payment to be recorded as
+// broadcast at the node's height
+func (f *builderFixture) expectBroadcastRecorded(btx *BitcoinTransaction) {
+	broadcastAt := time.Now()
+	f.mock.ExpectBegin()
+	f.expectLocked(btx, "signed")
+	f.mock.ExpectQuery("SET status = 'broadcast'").
+		WithArgs(btx.ID, f.node.height).
+		WillReturnRows(pgxmock.NewRows([]string{"broadcast_at"}).AddRow(&broadcastAt))
+	f.mock.ExpectExec("UPDATE withdrawals").
+		WithArgs(btx.ID, btx.TxID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	f.mock.ExpectExec("INSERT INTO withdrawal_txids").
+		WithArgs(btx.ID, btx.TxID).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	f.mock.ExpectCommit()
+}
+
+// expectRequeued expects a rejected payment to be failed and its
+// withdrawals requeued
+func (f *builderFixture) expectRequeued(btx *BitcoinTransaction, withdrawals int64) {
+	f.mock.ExpectBegin()
+	f.expectLocked(btx, "signed")
+	f.mock.ExpectExec("WITH failed AS").
+		WithArgs(btx.ID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	f.mock.ExpectExec("SET status = 'approved'").
+		WithArgs(btx.ID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", withdrawals))
+	f.mock.ExpectCommit()
+}
+
+func TestBuildProducesPSBTForSigners(t *testing.T) {
+	f := newBuilderFixture(t)
+	btx := f.build(t, uuid.New(), uuid.New())
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(btx.PSBT), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := packet.UnsignedTx.TxHash().String(); got != btx.TxID {
+		t.Errorf("PSBT txid = %s, want %s", got, btx.TxID)
+	}
+	if len(packet.UnsignedTx.TxIn) != 1 || len(packet.UnsignedTx.TxOut) != 2 {
+		t.Fatalf("tx has %d inputs and %d outputs, want 1 and 2", len(packet.UnsignedTx.TxIn), len(packet.UnsignedTx.TxOut))
+	}
+	if !signalsRBF(packet.UnsignedTx) {
+		t.Error("transaction does not signal BIP125 replaceability")
+	}
+
+	in := packet.Inputs[0]
+	if in.WitnessUtxo == nil || in.WitnessUtxo.Value != 500000 {
+		t.Errorf("witness utxo = %+v, want 500000 sats", in.WitnessUtxo)
+	}
+	if len(in.Bip32Derivation) != 1 || in.Bip32Derivation[0].MasterKeyFingerprint != 0x0adac573 {
+		t.Errorf("input derivation = %+v, want fingerprint 73c5da0a", in.Bip32Derivation)
+	}
+
+	var paid, change bool
+	for i, out := range packet.UnsignedTx.TxOut {
+		if out.Value == 100000 {
+			paid = len(packet.Outputs[i].Bip32Derivation) == 0
+		} else {
+			change = out.Value == 500000-100000-1410 && len(packet.Outputs[i].Bip32Derivation) == 1
+		}
+	}
+	if !paid || !change {
+		t.Errorf("outputs = %+v, want payment and marked change", packet.UnsignedTx.TxOut)
+	}
+	if len(btx.Outputs) != 1 || packet.UnsignedTx.TxOut[btx.Outputs[0].Index].Value != 100000 || btx.Outputs[0].FeeShare != 1410 {
+		t.Errorf("payment outputs = %+v, want the 100000 sat output paying 1410", btx.Outputs)
+	}
+}
+
+func TestSubmitSignaturesBroadcastsFinalTransaction(t *testing.T) {
+	f := newBuilderFixture(t)
+	id, withdrawalID := uuid.New(), uuid.New()
+	btx := f.build(t, id, withdrawalID)
+	signed := f.sign(t, btx.PSBT, 0, 0)
+
+	f.expectSigned(btx)
+	f.expectBroadcastRecorded(btx)
+
+	got, err := f.builder.SubmitSignatures(context.Background(), id, signed)
+	if err != nil {
+		t.Fatalf("SubmitSignatures() error = %v", err)
+	}
+	if got.Status != "broadcast" {
+		t.Errorf("status = %s, want broadcast", got.Status)
+	}
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if len(f.node.broadcast) != 1 {
+		t.Fatalf("broadcast %d transactions, want 1", len(f.node.broadcast))
+	}
+	raw, _ := hex.DecodeString(f.node.broadcast[0])
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if tx.TxHash().String() != btx.TxID {
+		t.Errorf("broadcast txid = %s, want %s", tx.TxHash(), btx.TxID)
+	}
+	if len(tx.TxIn[0].Witness) != 2 {
+		t.Errorf("witness has %d items, want signature and key", len(tx.TxIn[0].Witness))
+	}
+}
+
+// A transaction the node refuses outright is failed and its whole batch
+// requeued
+func TestSubmitSignaturesRequeuesRejectedBatch(t *testing.T) {
+	for _, reject := range []*blockchain.RPCError{
+		{Code: -26, Message: "min relay fee not met"},
+		{Code: -26, Message: "mandatory-script-verify-flag-failed"},
+		{Code: -22, Message: "TX decode failed"},
+	} {
+		f := newBuilderFixture(t)
+		f.node.reject = reject
+		id := uuid.New()
+		btx := f.build(t, id, uuid.New())
+		signed := f.sign(t, btx.PSBT, 0, 0)
+
+		f.expectSigned(btx)
+		f.expectRequeued(btx, 1)
+
+		if _, err := f.builder.SubmitSignatures(context.Background(), id, signed); !errors.Is(err, ErrBroadcastRejected) {
+			t.Fatalf("%s: SubmitSignatures() error = %v, want ErrBroadcastRejected", reject.Message, err)
+		}
+		if err := f.mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// A broadcast that may yet succeed, or may already have, leaves the
+// transaction signed and its withdrawals where they are
+func TestSubmitSignaturesKeepsTransactionOnRetryableError(t *testing.T) {
+	for _, reject := range []*blockchain.RPCError{
+		{Code: -28, Message: "Loading block index..."},
+		{Code: -26, Message: "txn-mempool-conflict"},
+		{Code: -25, Message: "bad-txns-inputs-missingorspent"},
+		{Code: -1, Message: "internal error"},
+	} {
+		f := newBuilderFixture(t)
+		f.node.reject = reject
+		id := uuid.New()
+		btx := f.build(t, id, uuid.New())
+
+		f.expectSigned(btx)
+
+		_, err := f.builder.SubmitSignatures(context.Background(), id, f.sign(t, btx.PSBT, 0, 0))
+		if !errors.Is(err, ErrBroadcastFailed) {
+			t.Fatalf("%s: SubmitSignatures() error = %v, want ErrBroadcastFailed", reject.Message, err)
+		}
+		if err := f.mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// A signed transaction is sent again when signatures are resubmitted or by
+// BroadcastSigned; one the node already has is recorded as broadcast
+func TestSignedTransactionIsBroadcastAgain(t *testing.T) {
+	f := newBuilderFixture(t)
+	f.node.reject = &blockchain.RPCError{Code: -28, Message: "Verifying blocks..."}
+	id := uuid.New()
+	btx := f.build(t, id, uuid.New())
+	signed := f.sign(t, btx.PSBT, 0, 0)
+	var stored string
+	f.expectStored(btx)
+	f.mock.ExpectExec("SET psbt = \\$2, status = \\$3").
+		WithArgs(id, capture{&stored}, "signed").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	f.mock.ExpectCommit()
+	if _, err := f.builder.SubmitSignatures(context.Background(), id, signed); !errors.Is(err, ErrBroadcastFailed) {
+		t.Fatalf("SubmitSignatures() error = %v, want ErrBroadcastFailed", err)
+	}
+	btx.PSBT = stored
+
+	// Resubmitted while the node is still warming up
+	f.mock.ExpectBegin()
+	f.expectLocked(btx, "signed")
+	f.mock.ExpectCommit()
+	if _, err := f.builder.SubmitSignatures(context.Background(), id, signed); !errors.Is(err, ErrBroadcastFailed) {
+		t.Fatalf("resubmitted SubmitSignatures() error = %v, want ErrBroadcastFailed", err)
+	}
+
+	// Picked up once the node is ready, after an earlier attempt got it
+	// into the mempool
+	f.node.reject = &blockchain.RPCError{Code: -26, Message: "txn-already-in-mempool"}
+	f.mock.ExpectQuery("WHERE status = 'signed'").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(id))
+	f.mock.ExpectQuery("FROM bitcoin_transactions").
+		WithArgs(id).
+		WillReturnRows(pgxmock.NewRows([]string{"txid", "psbt", "fee_sats", "fee_rate", "vsize", "status", "kind", "parent_id", "broadcast_at", "created_at"}).
+			AddRow(btx.TxID, stored, btx.Fee, btx.FeeRate, btx.VSize, "signed", btx.Kind, btx.ParentID, (*time.Time)(nil), btx.CreatedAt))
+	f.expectBroadcastRecorded(btx)
+	if err := f.builder.BroadcastSigned(context.Background()); err != nil {
+		t.Fatalf("BroadcastSigned() error = %v", err)
+	}
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSubmitSignaturesRejectsWrongKey(t *testing.T) {
+	f := newBuilderFixture(t)
+	id := uuid.New()
+	btx := f.build(t, id, uuid.New())
+	// Signed with the key for receive address 1, not the input's
+	signed := f.sign(t, btx.PSBT, 0, 1)
+
+	f.expectStored(btx)
+	f.mock.ExpectRollback()
+
+	if _, err := f.builder.SubmitSignatures(context.Background(), id, signed); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("SubmitSignatures() error = %v, want ErrInvalidSignature", err)
+	}
+	if len(f.node.broadcast) != 0 {
+		t.Errorf("broadcast %v, want nothing", f.node.broadcast)
+	}
+}
+
+func TestSubmitSignaturesRejectsOtherTransaction(t *testing.T) {
+	f := newBuilderFixture(t)
+	id := uuid.New()
+	btx := f.build(t, id, uuid.New())
+
+	other := wire.NewMsgTx(2)
+	other.AddTxOut(wire.NewTxOut(1000, f.depositScript(t, 0)))
+	packet, err := psbt.NewFromUnsignedTx(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, _ := packet.B64Encode()
+
+	f.expectStored(btx)
+	f.mock.ExpectRollback()
+
+	if _, err := f.builder.SubmitSignatures(context.Background(), id, encoded); !errors.Is(err, ErrPSBTMismatch) {
+		t.Errorf("SubmitSignatures() error = %v, want ErrPSBTMismatch", err)
+	}
+}
@@ -0,0 +1,218 @@
+// BitCurrent Exchange - Bitcoin Coin Selection
+package withdrawal
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// Virtual sizes of the parts of a transaction spending P2WPKH outputs
+const (
+	// Version, locktime, input and output counts and the segwit marker
+	// (10.5 vB, rounded up)
+	txOverheadVBytes = 11
+	// Outpoint, sequence, empty scriptSig and a 107-byte witness
+	p2wpkhInputVBytes = 68
+	// OP_0 <20-byte key hash>
+	p2wpkhScriptLen = 22
+
+	// Bitcoin Core's default dust relay fee, in sat/vB
+	dustRelayFeeRate = 3
+
+	// maxBnBTries bounds the changeless search
+	maxBnBTries = 100000
+)
+
+var (
+	ErrInsufficientFunds = errors.New("insufficient confirmed UTXOs for withdrawal")
+	ErrDustOutput        = errors.New("withdrawal amount is below the dust limit")
+)
+
+// UTXO is a spendable output of ours. Amount is in satoshis.
+type UTXO struct {
+	TxID           string
+	Vout           uint32
+	Amount         int64
+	ScriptPubKey   []byte
+	DerivationPath string
+}
+
+// Selection is the inputs chosen for a transaction. Change is zero when the
+// transaction has no change output; Fee is what the inputs leave after the
+// payments and change.
+type Selection struct {
+	Inputs []UTXO
+	Change int64
+	Fee    int64
+	VSize  int64
+}
+
+// outputVBytes is the size of an output paying script
+func outputVBytes(scriptLen int) int64 {
+	return 8 + 1 + int64(scriptLen)
+}
+
+// dustLimit is the smallest output paying script that Bitcoin Core relays:
+// the output costs more than a third of its value to create and spend
+func dustLimit(script []byte) int64 {
+	spendVBytes := int64(148)
+	if txscript.IsWitnessProgram(script) {
+		spendVBytes = 67
+	}
+	return (outputVBytes(len(script)) + spendVBytes) * dustRelayFeeRate
+}
+
+// SelectCoins picks inputs from utxos to pay amount to outputs of
+// outputVSize at feeRate sat/vB. It first searches for a set whose excess
+// over the target is less than a change output would cost to create and
+// later spend, so the transaction needs no change. Otherwise it takes the
+// smallest single output that covers the payment with change, or the
+// largest outputs until they do. Change that would be dust goes to the fee.
+func SelectCoins(utxos []UTXO, amount, outputVSize, feeRate int64) (*Selection, error) {
+	inputFee := feeRate * p2wpkhInputVBytes
+	changeFee := feeRate * outputVBytes(p2wpkhScriptLen)
+	costOfChange := changeFee + inputFee
+	minChange := dustLimit(make([]byte, p2wpkhScriptLen))
+	target := amount + feeRate*(txOverheadVBytes+outputVSize)
+
+	// Outputs worth less than the fee to spend them are never selected
+	candidates := make([]UTXO, 0, len(utxos))
+	for _, u := range utxos {
+		if u.Amount-inputFee > 0 {
+			candidates = append(candidates, u)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Amount > candidates[j].Amount })
+
+	effective := func(u UTXO) int64 { return u.Amount - inputFee }
+
+	selected := branchAndBound(candidates, effective, target, costOfChange)
+	if selected == nil {
+		selected = selectWithChange(candidates, effective, target+changeFee+minChange)
+	}
+	if selected == nil {
+		// Nothing covers change; spend everything if it pays without
+		var total int64
+		for _, u := range candidates {
+			total += effective(u)
+		}
+		if total < target {
+			return nil, ErrInsufficientFunds
+		}
+		selected = candidates
+	}
+
+	sel := &Selection{Inputs: selected}
+	var in int64
+	for _, u := range selected {
+		in += u.Amount
+	}
+	sel.VSize = txOverheadVBytes + outputVSize + int64(len(selected))*p2wpkhInputVBytes
+
+	excess := in - amount - feeRate*sel.VSize
+	if excess-changeFee >= minChange && excess > costOfChange {
+		sel.Change = excess - changeFee
+		sel.VSize += outputVBytes(p2wpkhScriptLen)
+	}
+	sel.Fee = in - amount - sel.Change
+	return sel, nil
+}
+
+// branchAndBound searches for the subset of candidates (sorted largest
+// first) whose effective value lands in [target, target+window] with the
+// least excess, or returns nil
+func branchAndBound(candidates []UTXO, effective func(UTXO) int64, target, window int64) []UTXO {
+	remaining := make([]int64, len(candidates)+1)
+	for i := len(candidates) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + effective(candidates[i])
+	}
+
+	var best []int
+	bestExcess := int64(-1)
+	current := make([]int, 0, len(candidates))
+	tries := 0
+
+	var search func(i int, value int64)
+	search = func(i int, value int64) {
+		tries++
+		if tries > maxBnBTries || value > target+window {
+			return
+		}
+		if value >= target {
+			if excess := value - target; bestExcess < 0 || excess < bestExcess {
+				bestExcess = excess
+				best = append(best[:0], current...)
+			}
+			return
+		}
+		if i == len(candidates) || value+remaining[i] < target {
+			return
+		}
+
+		current = append(current, i)
+		search(i+1, value+effective(candidates[i]))
+		current = current[:len(current)-1]
+
+		// Skipping an output equal to the one just tried explores the same
+		// sums again
+		next := i + 1
+		for next < len(candidates) && effective(candidates[next]) == effective(candidates[i]) {
+			next++
+		}
+		search(next, value)
+	}
+	search(0, 0)
+
+	if best == nil {
+		return nil
+	}
+	selected := make([]UTXO, len(best))
+	for i, idx := range best {
+		selected[i] = candidates[idx]
+	}
+	return selected
+}
+
+// selectWithChange returns the smallest single candidate reaching target,
+// or failing that the largest candidates until their sum does
+func selectWithChange(candidates []UTXO, effective func(UTXO) int64, target int64) []UTXO {
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if effective(candidates[i]) >= target {
+			return []UTXO{candidates[i]}
+		}
+	}
+
+	var value int64
+	for i, u := range candidates {
+		value += effective(u)
+		if value >= target {
+			return candidates[:i+1]
+		}
+	}
+	return nil
+}
+
+// shareFee splits a transaction's fee between its payments. Each pays for
+// its own output at feeRate, given outputSizes in vbytes, and an equal part
+// of the rest: the inputs, change and transaction overhead that every
+// payment in the batch benefits from. Leftover satoshis go to the first
+// payments.
+func shareFee(fee, feeRate int64, outputSizes []int64) []int64 {
+	shares := make([]int64, len(outputSizes))
+	shared := fee
+	for i, size := range outputSizes {
+		shares[i] = size * feeRate
+		shared -= shares[i]
+	}
+
+	n := int64(len(shares))
+	for i := range shares {
+		shares[i] += shared / n
+		if int64(i) < shared%n {
+			shares[i]++
+		}
+	}
+	return shares
+}
@@ -0,0 +1,135 @@
+package withdrawal
+
+import (
+	"errors"
+	"testing"
+)
+
+// A P2WPKH payment at 10 sat/vB needs 100000 + 10 × (11 + 31) = 100420
+// sats of effective value; each input costs 680 sats to spend
+const (
+	testFeeRate     = 10
+	testPayment     = 100000
+	testOutputVSize = 31
+)
+
+func utxos(amounts ...int64) []UTXO {
+	out := make([]UTXO, len(amounts))
+	for i, a := range amounts {
+		out[i] = UTXO{TxID: "tx", Vout: uint32(i), Amount: a}
+	}
+	return out
+}
+
+func TestSelectCoinsFindsChangelessSet(t *testing.T) {
+	// 69320 + 31120 effective lands 20 sats over the target, less than a
+	// change output would cost
+	sel, err := SelectCoins(utxos(500000, 70000, 31800, 5000), testPayment, testOutputVSize, testFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sel.Inputs) != 2 || sel.Inputs[0].Amount != 70000 || sel.Inputs[1].Amount != 31800 {
+		t.Fatalf("inputs = %+v, want 70000 and 31800", sel.Inputs)
+	}
+	if sel.Change != 0 {
+		t.Errorf("change = %d, want none", sel.Change)
+	}
+	// The 20-sat excess goes to the miner
+	if sel.Fee != 1800 || sel.VSize != 178 {
+		t.Errorf("fee = %d, vsize = %d, want 1800 and 178", sel.Fee, sel.VSize)
+	}
+}
+
+func TestSelectCoinsDropsExcessBelowCostOfChange(t *testing.T) {
+	// 900 sats over the target: a change output costs 310 to create and 680
+	// to spend later, so it is cheaper to give the excess up
+	sel, err := SelectCoins(utxos(101320+680), testPayment, testOutputVSize, testFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel.Change != 0 || sel.Fee != 2000 {
+		t.Errorf("change = %d, fee = %d, want 0 and 2000", sel.Change, sel.Fee)
+	}
+}
+
+func TestSelectCoinsMakesChange(t *testing.T) {
+	sel, err := SelectCoins(utxos(5000, 500000, 300000), testPayment, testOutputVSize, testFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The smallest output that covers the payment and change
+	if len(sel.Inputs) != 1 || sel.Inputs[0].Amount != 300000 {
+		t.Fatalf("inputs = %+v, want 300000", sel.Inputs)
+	}
+	if sel.VSize != 141 || sel.Fee != 1410 || sel.Change != 300000-testPayment-1410 {
+		t.Errorf("vsize = %d, fee = %d, change = %d", sel.VSize, sel.Fee, sel.Change)
+	}
+}
+
+func TestSelectCoinsAccumulatesLargestFirst(t *testing.T) {
+	sel, err := SelectCoins(utxos(40000, 60000, 50000, 45000), testPayment, testOutputVSize, testFeeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No pair lands within the changeless window and no single output
+	// covers the payment
+	if len(sel.Inputs) != 2 || sel.Inputs[0].Amount != 60000 || sel.Inputs[1].Amount != 50000 {
+		t.Fatalf("inputs = %+v, want 60000 and 50000", sel.Inputs)
+	}
+	if want := sel.VSize * testFeeRate; sel.Fee != want {
+		t.Errorf("fee = %d, want %d for %d vB", sel.Fee, want, sel.VSize)
+	}
+	if sel.Change != 110000-testPayment-sel.Fee {
+		t.Errorf("change = %d, want %d", sel.Change, 110000-testPayment-sel.Fee)
+	}
+}
+
+func TestSelectCoinsSkipsUneconomicalOutputs(t *testing.T) {
+	// 600 sats cost 680 to spend at 10 sat/vB and are worth nothing
+	many := make([]int64, 200)
+	for i := range many {
+		many[i] = 600
+	}
+	if _, err := SelectCoins(utxos(many...), testPayment, testOutputVSize, testFeeRate); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("error = %v, want ErrInsufficientFunds", err)
+	}
+}
+
+func TestSelectCoinsInsufficientFunds(t *testing.T) {
+	if _, err := SelectCoins(utxos(50000, 50000), testPayment, testOutputVSize, testFeeRate); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("error = %v, want ErrInsufficientFunds", err)
+	}
+}
+
+func TestDustLimit(t *testing.T) {
+	tests := map[string]struct {
+		script []byte
+		want   int64
+	}{
+		"p2wpkh": {append([]byte{0x00, 0x14}, make([]byte, 20)...), 294},
+		"p2wsh":  {append([]byte{0x00, 0x20}, make([]byte, 32)...), 330},
+		"p2pkh":  {make([]byte, 25), 546},
+	}
+	for name, tt := range tests {
+		if got := dustLimit(tt.script); got != tt.want {
+			t.Errorf("%s: dustLimit = %d, want %d", name, got, tt.want)
+		}
+	}
+}
+
+func TestShareFee(t *testing.T) {
+	// Two P2WPKH payments and a P2WSH one share 1000 sats of inputs, change
+	// and overhead on top of their own outputs at 10 sat/vB
+	shares := shareFee(310+310+430+1000, testFeeRate, []int64{31, 31, 43})
+	want := []int64{310 + 334, 310 + 333, 430 + 333}
+	var total int64
+	for i := range want {
+		if shares[i] != want[i] {
+			t.Errorf("share %d = %d, want %d", i, shares[i], want[i])
+		}
+		total += shares[i]
+	}
+	if total != 2050 {
+		t.Errorf("shares total %d, want the whole 2050 fee", total)
+	}
+}
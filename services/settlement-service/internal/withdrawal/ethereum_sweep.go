@@ -0,0 +1,620 @@
+// BitCurrent Exchange - Ethereum Deposit Address Sweeping
+package withdrawal
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// sweepBatchSize caps the deposit addresses swept in one pass
+const sweepBatchSize = 50
+
+// sweepEthereum starts a sweep of every Ethereum deposit address credited
+// at least the minimum since its last sweep. Addresses with deposits not
+// yet withdrawable are left until a reorg can no longer take them back.
+func (s *Sweeper) sweepEthereum(ctx context.Context) error {
+	currencies := []string{"ETH"}
+	for _, t := range s.tokens.Tokens(wallet.ChainEthereum) {
+		currencies = append(currencies, t.Symbol)
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT da.address, da.derivation_path, da.currency
+		FROM deposit_addresses da
+		JOIN deposits d ON d.address = da.address AND d.currency = da.currency
+		WHERE da.chain = 'ethereum' AND da.currency = ANY($1)
+		  AND d.status = 'credited'
+		  AND d.credited_at > COALESCE((
+			SELECT MAX(s.created_at) FROM sweeps s
+			WHERE s.from_address = da.address AND s.status = 'confirmed'
+		  ), '-infinity')
+		  AND NOT EXISTS (
+			SELECT 1 FROM sweeps s
+			WHERE s.from_address = da.address AND s.status IN ('funding', 'unsigned', 'broadcast')
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM deposits u
+			WHERE u.address = da.address
+			  AND (u.status IN ('pending', 'confirmed') OR (u.status = 'credited' AND u.withdrawable_at IS NULL))
+		  )
+		GROUP BY da.address, da.derivation_path, da.currency
+		HAVING SUM(d.amount) >= CASE WHEN da.currency = 'ETH' THEN $2::numeric ELSE $3::numeric END
+		ORDER BY MIN(d.credited_at)
+		LIMIT $4
+	`, currencies, s.config.MinEthAmount, s.config.MinTokenAmount, sweepBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to query deposit addresses to sweep: %w", err)
+	}
+	var due []Sweep
+	for rows.Next() {
+		sw := Sweep{Chain: wallet.ChainEthereum}
+		if err := rows.Scan(&sw.FromAddress, &sw.DerivationPath, &sw.Currency); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, sw)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range due {
+		if err := s.prepareEthereumSweep(ctx, &due[i]); err != nil {
+			s.logger.Warn("Failed to sweep Ethereum deposit address",
+				zap.String("address", due[i].FromAddress),
+				zap.String("currency", due[i].Currency),
+				zap.Error(err),
+			)
+		}
+	}
+	return nil
+}
+
+// prepareEthereumSweep builds the transaction emptying a deposit address
+// of its currency into the hot wallet and stores it for the signer. A
+// token address without the ETH to pay for the transfer is sent it from
+// the hot wallet first, and the sweep waits in funding.
+func (s *Sweeper) prepareEthereumSweep(ctx context.Context, sw *Sweep) error {
+	hot := s.ethTx.Address()
+	nonce, err := s.ethClient.GetTransactionCount(ctx, sw.FromAddress, "latest")
+	if err != nil {
+		return fmt.Errorf("failed to get nonce: %w", err)
+	}
+	balance, err := s.ethClient.GetBalance(ctx, sw.FromAddress)
+	if err != nil {
+		return fmt.Errorf("failed to get balance: %w", err)
+	}
+	fees, err := s.ethClient.SuggestFees(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get fees: %w", err)
+	}
+	feeCap := minBig(fees.MaxFeePerGas, s.ethTx.maxFee)
+	t := &blockchain.DynamicFeeTx{
+		ChainID:   big.NewInt(s.ethClient.ChainID()),
+		Nonce:     nonce,
+		GasTipCap: minBig(fees.PriorityFee, feeCap),
+		GasFeeCap: feeCap,
+	}
+
+	token, isToken := s.tokens.BySymbol(sw.Currency)
+	if !isToken {
+		t.Gas, t.To = ethTransferGas, hot
+		t.Value = new(big.Int).Sub(balance, gasCost(t))
+		if t.Value.Sign() <= 0 {
+			return s.dropSweep(ctx, sw, "balance does not cover gas")
+		}
+		sw.Amount = decimal.NewFromBigInt(t.Value, 18)
+		return s.storeUnsignedSweep(ctx, sw, t)
+	}
+
+	held, err := s.ethClient.GetTokenBalance(ctx, sw.FromAddress, token.Contract)
+	if err != nil {
+		return fmt.Errorf("failed to get token balance: %w", err)
+	}
+	if held.Sign() == 0 {
+		return s.dropSweep(ctx, sw, "nothing to sweep")
+	}
+	if t.Data, err = blockchain.EncodeTransfer(hot, held); err != nil {
+		return err
+	}
+	gas, err := s.ethClient.EstimateGas(ctx, blockchain.CallMsg{From: sw.FromAddress, To: token.Contract, Data: t.Data})
+	if err != nil {
+		return fmt.Errorf("failed to estimate gas: %w", err)
+	}
+	// Token contracts may cost more by the time it is mined; unused gas
+	// stays on the address
+	t.Gas, t.To, t.Value = gas+gas/4, token.Contract, new(big.Int)
+	sw.Amount = decimal.NewFromBigInt(held, token.Decimals)
+
+	if need := gasCost(t); balance.Cmp(need) < 0 {
+		return s.topUp(ctx, sw, need.Sub(need, balance))
+	}
+	return s.storeUnsignedSweep(ctx, sw, t)
+}
+
+// gasCost is the most a transaction can pay for gas
+func gasCost(t *blockchain.DynamicFeeTx) *big.Int {
+	return new(big.Int).Mul(new(big.Int).SetUint64(t.Gas), t.GasFeeCap)
+}
+
+// topUp sends a deposit address wei from the hot wallet for gas, leaving
+// its sweep in funding until the transfer is booked
+func (s *Sweeper) topUp(ctx context.Context, sw *Sweep, wei *big.Int) error {
+	txHash, err := s.ethTx.Transfer(ctx, sw.FromAddress, wei, func(tx pgx.Tx, nonce uint64, txHash string) error {
+		n, value := int64(nonce), wei.String()
+		sw.Status, sw.TopUpNonce, sw.TopUpWei = "funding", &n, &value
+		return saveEthereumSweep(ctx, tx, sw)
+	})
+	if err != nil {
+		// A rejected top-up's sweep finds the nonce released and fails
+		return fmt.Errorf("failed to send gas: %w", err)
+	}
+	s.logger.Info("Gas sent to Ethereum deposit address",
+		zap.String("sweep_id", sw.ID.String()),
+		zap.String("address", sw.FromAddress),
+		zap.String("currency", sw.Currency),
+		zap.String("value_wei", wei.String()),
+		zap.String("txid", txHash),
+	)
+	return nil
+}
+
+// storeUnsignedSweep stores t as the sweep's transaction, waiting for the
+// deposit key to sign it
+func (s *Sweeper) storeUnsignedSweep(ctx context.Context, sw *Sweep, t *blockchain.DynamicFeeTx) error {
+	hash, err := t.SigningHash()
+	if err != nil {
+		return err
+	}
+	nonce, gas := int64(t.Nonce), int64(t.Gas)
+	value, feeCap, tipCap := t.Value.String(), t.GasFeeCap.String(), t.GasTipCap.String()
+	signingHash := "0x" + hex.EncodeToString(hash)
+	sw.Status, sw.ToAddress, sw.Nonce, sw.ValueWei, sw.Data, sw.GasLimit = "unsigned", t.To, &nonce, &value, t.Data, &gas
+	sw.MaxFeePerGas, sw.MaxPriorityFeePerGas, sw.SigningHash = &feeCap, &tipCap, &signingHash
+
+	if err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return saveEthereumSweep(ctx, tx, sw)
+	}); err != nil {
+		return err
+	}
+	s.logger.Info("Ethereum deposit sweep waiting for signature",
+		zap.String("sweep_id", sw.ID.String()),
+		zap.String("address", sw.FromAddress),
+		zap.String("currency", sw.Currency),
+		zap.String("amount", sw.Amount.String()),
+	)
+	return nil
+}
+
+// dropSweep gives up on a sweep with nothing left to move. One not yet
+// stored is simply not started.
+func (s *Sweeper) dropSweep(ctx context.Context, sw *Sweep, reason string) error {
+	if sw.ID == uuid.Nil {
+		s.logger.Debug("Ethereum deposit address not swept",
+			zap.String("address", sw.FromAddress),
+			zap.String("currency", sw.Currency),
+			zap.String("reason", reason),
+		)
+		return nil
+	}
+	return s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return failSweep(ctx, tx, sw.ID, reason, nil)
+	})
+}
+
+// saveEthereumSweep inserts a new sweep, setting its ID, or updates a
+// stored one
+func saveEthereumSweep(ctx context.Context, tx pgx.Tx, sw *Sweep) error {
+	if sw.ID == uuid.Nil {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO sweeps (
+				chain, currency, amount, status, from_address, derivation_path, to_address,
+				nonce, value_wei, data, gas_limit, max_fee_per_gas, max_priority_fee_per_gas,
+				signing_hash, topup_nonce, topup_wei
+			) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9::numeric, $10, $11, $12::numeric, $13::numeric, $14, $15, $16::numeric)
+			RETURNING id, created_at
+		`, sw.Chain, sw.Currency, sw.Amount, sw.Status, sw.FromAddress, sw.DerivationPath, sw.ToAddress,
+			sw.Nonce, sw.ValueWei, sw.Data, sw.GasLimit, sw.MaxFeePerGas, sw.MaxPriorityFeePerGas,
+			sw.SigningHash, sw.TopUpNonce, sw.TopUpWei).Scan(&sw.ID, &sw.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to record sweep: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE sweeps
+		SET amount = $2, status = $3, to_address = NULLIF($4, ''), nonce = $5, value_wei = $6::numeric,
+		    data = $7, gas_limit = $8, max_fee_per_gas = $9::numeric, max_priority_fee_per_gas = $10::numeric,
+		    signing_hash = $11, topup_nonce = $12, topup_wei = $13::numeric, updated_at = NOW()
+		WHERE id = $1
+	`, sw.ID, sw.Amount, sw.Status, sw.ToAddress, sw.Nonce, sw.ValueWei,
+		sw.Data, sw.GasLimit, sw.MaxFeePerGas, sw.MaxPriorityFeePerGas,
+		sw.SigningHash, sw.TopUpNonce, sw.TopUpWei); err != nil {
+		return fmt.Errorf("failed to update sweep: %w", err)
+	}
+	return nil
+}
+
+// settleEthereumSweeps moves every Ethereum sweep in flight on: funded
+// addresses get their transaction, mined sweeps are booked, and sweeps left
+// unsigned past SignTimeout or dropped by the node are failed so the
+// address is swept again at current fees
+func (s *Sweeper) settleEthereumSweeps(ctx context.Context) error {
+	if _, err := s.db.Pool.Exec(ctx, `
+		UPDATE sweeps
+		SET status = 'failed', failure_reason = 'not signed in time', completed_at = NOW(), updated_at = NOW()
+		WHERE chain = 'ethereum' AND status = 'unsigned' AND updated_at < $1
+	`, time.Now().Add(-s.config.SignTimeout)); err != nil {
+		return fmt.Errorf("failed to expire unsigned sweeps: %w", err)
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+sweepColumns+`
+		FROM sweeps
+		WHERE chain = 'ethereum' AND status IN ('funding', 'broadcast')
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query open sweeps: %w", err)
+	}
+	var open []Sweep
+	for rows.Next() {
+		var sw Sweep
+		if err := rows.Scan(sweepFields(&sw)...); err != nil {
+			rows.Close()
+			return err
+		}
+		open = append(open, sw)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(open) == 0 {
+		return nil
+	}
+
+	tip, err := s.ethClient.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get block number: %w", err)
+	}
+	for i := range open {
+		sw := &open[i]
+		var err error
+		if sw.Status == "funding" {
+			err = s.settleTopUp(ctx, sw, tip)
+		} else {
+			err = s.settleEthereumSweep(ctx, sw, tip)
+		}
+		if err != nil {
+			s.logger.Warn("Failed to settle Ethereum deposit sweep",
+				zap.String("sweep_id", sw.ID.String()),
+				zap.String("status", sw.Status),
+				zap.Error(err),
+			)
+		}
+	}
+	return nil
+}
+
+// settleTopUp books a sweep's gas top-up once mined and confirmed, then
+// builds the sweep itself. The top-up is found through its hot wallet
+// nonce, as the replacer may have re-signed it under another hash.
+func (s *Sweeper) settleTopUp(ctx context.Context, sw *Sweep, tip uint64) error {
+	if sw.TopUpNonce == nil {
+		return s.prepareEthereumSweep(ctx, sw)
+	}
+
+	hot := s.ethTx.Address()
+	var status, to string
+	var txid *string
+	var previous []string
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT status, COALESCE(to_address, ''), txid, previous_txids
+		FROM ethereum_nonces
+		WHERE address = $1 AND nonce = $2
+	`, hot, *sw.TopUpNonce).Scan(&status, &to, &txid, &previous)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to load gas top-up: %w", err)
+	}
+	// A released nonce, or one reused for something else, never paid us
+	if errors.Is(err, pgx.ErrNoRows) || status == "released" || !strings.EqualFold(to, sw.FromAddress) {
+		return s.dropSweep(ctx, sw, "gas top-up dropped")
+	}
+
+	hashes := previous
+	if txid != nil {
+		hashes = append([]string{*txid}, previous...)
+	}
+	var receipt *blockchain.Receipt
+	for _, h := range hashes {
+		if receipt, err = s.ethClient.GetTransactionReceipt(ctx, h); err != nil {
+			return err
+		}
+		if receipt != nil {
+			break
+		}
+	}
+	if receipt == nil || receipt.Confirmations(tip) < s.config.Confirmations {
+		return nil
+	}
+
+	value, ok := new(big.Int).SetString(*sw.TopUpWei, 10)
+	if !ok {
+		return fmt.Errorf("invalid stored top-up %q", *sw.TopUpWei)
+	}
+	fee := decimal.NewFromBigInt(receiptFee(receipt, nil), 18)
+	booked := false
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			UPDATE sweeps SET topup_nonce = NULL, updated_at = NOW()
+			WHERE id = $1 AND status = 'funding' AND topup_nonce = $2
+		`, sw.ID, *sw.TopUpNonce)
+		if err != nil {
+			return fmt.Errorf("failed to record gas top-up: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return nil
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE ethereum_nonces SET status = 'confirmed', updated_at = NOW()
+			WHERE address = $1 AND nonce = $2 AND status = 'broadcast'
+		`, hot, *sw.TopUpNonce); err != nil {
+			return fmt.Errorf("failed to confirm gas top-up nonce: %w", err)
+		}
+
+		postings := []journal.Posting{
+			{AccountID: journal.HotWalletAccountID, Currency: "ETH", Amount: fee, EntryType: "fee"},
+			{AccountID: journal.NetworkFeeAccountID, Currency: "ETH", Amount: fee.Neg(), EntryType: "fee"},
+		}
+		if receipt.Status == 1 {
+			moved := decimal.NewFromBigInt(value, 18)
+			postings = append(postings,
+				journal.Posting{AccountID: journal.HotWalletAccountID, Currency: "ETH", Amount: moved, EntryType: "transfer"},
+				journal.Posting{AccountID: journal.DepositAddressAccountID, Currency: "ETH", Amount: moved.Neg(), EntryType: "transfer"},
+			)
+		}
+		booked = true
+		return postCustodyJournal(ctx, tx, "sweep", sw.ID, "Gas for deposit address sweep", postings)
+	})
+	if err != nil || !booked {
+		return err
+	}
+
+	sw.TopUpNonce = nil
+	return s.prepareEthereumSweep(ctx, sw)
+}
+
+// settleEthereumSweep books a broadcast sweep once mined and confirmed:
+// its amount moves from the deposit addresses to the hot wallet, and the
+// gas it burnt, reverted or not, is paid from the deposit address
+func (s *Sweeper) settleEthereumSweep(ctx context.Context, sw *Sweep, tip uint64) error {
+	if sw.TxID == nil {
+		return fmt.Errorf("broadcast sweep has no txid")
+	}
+	receipt, err := s.ethClient.GetTransactionReceipt(ctx, *sw.TxID)
+	if err != nil {
+		return err
+	}
+	if receipt == nil {
+		if sw.BroadcastAt == nil || time.Since(*sw.BroadcastAt) < s.config.DropAfter {
+			return nil
+		}
+		known, err := s.ethClient.HasTransaction(ctx, *sw.TxID)
+		if err != nil || known {
+			return err
+		}
+		if err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			return failSweep(ctx, tx, sw.ID, "transaction dropped", nil)
+		}); err != nil {
+			return err
+		}
+		s.logger.Warn("Ethereum deposit sweep dropped",
+			zap.String("sweep_id", sw.ID.String()),
+			zap.String("txid", *sw.TxID),
+		)
+		return nil
+	}
+	if receipt.Confirmations(tip) < s.config.Confirmations {
+		return nil
+	}
+
+	var feeCap *big.Int
+	if sw.MaxFeePerGas != nil {
+		feeCap, _ = new(big.Int).SetString(*sw.MaxFeePerGas, 10)
+	}
+	fee := decimal.NewFromBigInt(receiptFee(receipt, feeCap), 18)
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var status string
+		if err := tx.QueryRow(ctx, `
+			SELECT status FROM sweeps WHERE id = $1 FOR UPDATE
+		`, sw.ID).Scan(&status); err != nil {
+			return fmt.Errorf("failed to lock sweep: %w", err)
+		}
+		if status != "broadcast" {
+			return nil
+		}
+
+		postings := []journal.Posting{
+			{AccountID: journal.DepositAddressAccountID, Currency: "ETH", Amount: fee, EntryType: "fee"},
+			{AccountID: journal.NetworkFeeAccountID, Currency: "ETH", Amount: fee.Neg(), EntryType: "fee"},
+		}
+		if receipt.Status == 0 {
+			if err := postCustodyJournal(ctx, tx, "sweep", sw.ID, "Reverted deposit address sweep", postings); err != nil {
+				return err
+			}
+			return failSweep(ctx, tx, sw.ID, "transaction reverted", &fee)
+		}
+		postings = append(postings,
+			journal.Posting{AccountID: journal.DepositAddressAccountID, Currency: sw.Currency, Amount: sw.Amount, EntryType: "transfer"},
+			journal.Posting{AccountID: journal.HotWalletAccountID, Currency: sw.Currency, Amount: sw.Amount.Neg(), EntryType: "transfer"},
+		)
+		if err := postCustodyJournal(ctx, tx, "sweep", sw.ID, "Deposit address sweep", postings); err != nil {
+			return err
+		}
+		return completeSweep(ctx, tx, sw.ID, fee)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Ethereum deposit sweep confirmed",
+		zap.String("sweep_id", sw.ID.String()),
+		zap.String("txid", *sw.TxID),
+		zap.String("currency", sw.Currency),
+		zap.String("amount", sw.Amount.String()),
+		zap.Uint64("status", receipt.Status),
+	)
+	return nil
+}
+
+// receiptFee is the wei a mined transaction paid for gas. Nodes that do
+// not report the effective price are charged feeCap, the most it could
+// have been.
+func receiptFee(r *blockchain.Receipt, feeCap *big.Int) *big.Int {
+	price := r.EffectiveGasPrice
+	if price == nil {
+		price = feeCap
+	}
+	if price == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Mul(new(big.Int).SetUint64(r.GasUsed), price)
+}
+
+// SubmitSignature takes the deposit key's [R || S || V] signature of an
+// Ethereum sweep's signing hash and broadcasts the signed sweep. A
+// signature that does not recover to the deposit address is refused; a
+// sweep the node rejects is failed and built again on the next pass.
+func (s *Sweeper) SubmitSignature(ctx context.Context, id uuid.UUID, sig []byte) (*Sweep, error) {
+	if len(sig) != 65 || sig[64] > 1 {
+		return nil, fmt.Errorf("%w: want 65 bytes ending in recovery id 0 or 1", ErrInvalidSweepSignature)
+	}
+
+	sw := &Sweep{}
+	var raw []byte
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			SELECT `+sweepColumns+`
+			FROM sweeps
+			WHERE id = $1
+			FOR UPDATE
+		`, id).Scan(sweepFields(sw)...)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrSweepNotFound
+		}
+		if err != nil {
+			return err
+		}
+		// Consolidations are signed through their PSBT
+		if sw.Chain != wallet.ChainEthereum || sw.Status != "unsigned" || s.ethClient == nil {
+			return ErrSweepNotUnsigned
+		}
+
+		t, err := sw.transaction(s.ethClient.ChainID())
+		if err != nil {
+			return err
+		}
+		var txHash string
+		raw, txHash, err = blockchain.SignTransaction(ctx, offlineSignature{sw.FromAddress, sig}, t)
+		if errors.Is(err, blockchain.ErrSignerMismatch) {
+			return fmt.Errorf("%w: %v", ErrInvalidSweepSignature, err)
+		}
+		if err != nil {
+			return err
+		}
+
+		sw.Status, sw.TxID = "broadcast", &txHash
+		return tx.QueryRow(ctx, `
+			UPDATE sweeps
+			SET status = 'broadcast', txid = $2, broadcast_at = NOW(), updated_at = NOW()
+			WHERE id = $1
+			RETURNING broadcast_at
+		`, id, txHash).Scan(&sw.BroadcastAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.ethClient.SendTransaction(ctx, raw)
+	var rpcErr *blockchain.RPCError
+	switch {
+	case err == nil, errors.Is(err, blockchain.ErrAlreadyKnown):
+	case errors.As(err, &rpcErr):
+		if failErr := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			return failSweep(ctx, tx, id, rpcErr.Error(), nil)
+		}); failErr != nil {
+			return nil, failErr
+		}
+		return nil, fmt.Errorf("%w: %v", ErrEthereumRejected, err)
+	default:
+		// Found dropped after DropAfter if the node never got it
+		s.logger.Warn("Ethereum sweep broadcast failed, left to the sweeper",
+			zap.String("sweep_id", id.String()),
+			zap.String("txid", *sw.TxID),
+			zap.Error(err),
+		)
+	}
+
+	s.logger.Info("Ethereum deposit sweep broadcast",
+		zap.String("sweep_id", id.String()),
+		zap.String("txid", *sw.TxID),
+	)
+	return sw, nil
+}
+
+// transaction rebuilds the unsigned transaction a sweep stores
+func (sw *Sweep) transaction(chainID int64) (*blockchain.DynamicFeeTx, error) {
+	if sw.Nonce == nil || sw.ValueWei == nil || sw.GasLimit == nil || sw.MaxFeePerGas == nil || sw.MaxPriorityFeePerGas == nil {
+		return nil, fmt.Errorf("sweep %s has no transaction", sw.ID)
+	}
+	value, ok1 := new(big.Int).SetString(*sw.ValueWei, 10)
+	feeCap, ok2 := new(big.Int).SetString(*sw.MaxFeePerGas, 10)
+	tipCap, ok3 := new(big.Int).SetString(*sw.MaxPriorityFeePerGas, 10)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, fmt.Errorf("sweep %s has an invalid stored transaction", sw.ID)
+	}
+	return &blockchain.DynamicFeeTx{
+		ChainID:   big.NewInt(chainID),
+		Nonce:     uint64(*sw.Nonce),
+		GasTipCap: tipCap,
+		GasFeeCap: feeCap,
+		Gas:       uint64(*sw.GasLimit),
+		To:        sw.ToAddress,
+		Value:     value,
+		Data:      sw.Data,
+	}, nil
+}
+
+// offlineSignature is a signature made away from the server for address.
+// blockchain.SignTransaction checks it recovers to the address like one
+// made here.
+type offlineSignature struct {
+	address string
+	sig     []byte
+}
+
+// Address implements blockchain.EthereumSigner
+func (o offlineSignature) Address() string {
+	return o.address
+}
+
+// SignHash implements blockchain.EthereumSigner
+func (o offlineSignature) SignHash(ctx context.Context, hash []byte) ([]byte, error) {
+	return o.sig, nil
+}
@@ -0,0 +1,544 @@
+// BitCurrent Exchange - Ethereum Withdrawal Transactions
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// ethTransferGas is the gas used by a plain ETH transfer
+const ethTransferGas = 21000
+
+var (
+	ErrEthereumRejected = errors.New("ethereum transaction rejected by the node")
+	ErrEthereumFeeCap   = errors.New("replacement would exceed the fee cap")
+	ErrNotReplaceable   = errors.New("no broadcast transaction at that nonce")
+	// ErrInsufficientTokens means the hot wallet holds too little of a
+	// token for a withdrawal
+	ErrInsufficientTokens = errors.New("insufficient hot wallet token balance")
+)
+
+// EthereumSendConfig controls fees of hot wallet transactions and the
+// replacement of stuck ones
+type EthereumSendConfig struct {
+	Interval time.Duration
+	// StuckAfter is how long a broadcast transaction may go unmined before
+	// it is replaced with a higher tip
+	StuckAfter time.Duration
+	// MaxFeePerGas caps the fee cap of any transaction, in gwei
+	MaxFeePerGas int64
+}
+
+// DefaultEthereumSendConfig returns the Ethereum sending defaults
+func DefaultEthereumSendConfig() EthereumSendConfig {
+	return EthereumSendConfig{
+		Interval:     time.Minute,
+		StuckAfter:   10 * time.Minute,
+		MaxFeePerGas: 500,
+	}
+}
+
+// EthereumTxSender signs and broadcasts EIP-1559 transactions from the
+// Ethereum hot wallet. Each transaction is recorded with its nonce before
+// it is broadcast, so one the node never received looks dropped rather
+// than being lost.
+type EthereumTxSender struct {
+	db     *database.PostgresDB
+	client *blockchain.EthereumClient
+	signer blockchain.EthereumSigner
+	nonces *NonceManager
+	config EthereumSendConfig
+	maxFee *big.Int
+	logger *zap.Logger
+}
+
+// NewEthereumTxSender creates a sender for the signer's address
+func NewEthereumTxSender(
+	db *database.PostgresDB,
+	client *blockchain.EthereumClient,
+	signer blockchain.EthereumSigner,
+	cfg EthereumSendConfig,
+	logger *zap.Logger,
+) *EthereumTxSender {
+	defaults := DefaultEthereumSendConfig()
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaults.Interval
+	}
+	if cfg.StuckAfter <= 0 {
+		cfg.StuckAfter = defaults.StuckAfter
+	}
+	if cfg.MaxFeePerGas <= 0 {
+		cfg.MaxFeePerGas = defaults.MaxFeePerGas
+	}
+	return &EthereumTxSender{
+		db:     db,
+		client: client,
+		signer: signer,
+		nonces: NewNonceManager(logger),
+		config: cfg,
+		maxFee: new(big.Int).Mul(big.NewInt(cfg.MaxFeePerGas), big.NewInt(1e9)),
+		logger: logger,
+	}
+}
+
+// Address returns the hot wallet address transactions are sent from
+func (s *EthereumTxSender) Address() string {
+	return s.signer.Address()
+}
+
+// Send pays value wei to address for a withdrawal, with data as the call
+// data, and returns the transaction hash. The withdrawal's txid is set with
+// the nonce. A rejected transaction releases its nonce and wraps
+// ErrEthereumRejected.
+func (s *EthereumTxSender) Send(ctx context.Context, withdrawalID uuid.UUID, to string, value *big.Int, data []byte) (string, error) {
+	from := s.signer.Address()
+	t, chainNonce, err := s.prepare(ctx, to, value, data)
+	if err != nil {
+		return "", err
+	}
+
+	var raw []byte
+	var txHash string
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if t.Nonce, err = s.nonces.Allocate(ctx, tx, from, chainNonce, withdrawalID); err != nil {
+			return err
+		}
+		if raw, txHash, err = blockchain.SignTransaction(ctx, s.signer, t); err != nil {
+			return err
+		}
+		if err := recordEthereumTx(ctx, tx, from, t, txHash); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE withdrawals SET txid = $2, updated_at = NOW() WHERE id = $1
+		`, withdrawalID, txHash)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.broadcast(ctx, raw, txHash); err != nil {
+		rejectErr := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			if err := releaseEthereumNonce(ctx, tx, withdrawalID); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, `
+				UPDATE withdrawals SET txid = NULL, updated_at = NOW() WHERE id = $1 AND txid = $2
+			`, withdrawalID, txHash)
+			return err
+		})
+		if rejectErr != nil {
+			return "", rejectErr
+		}
+		return "", err
+	}
+
+	s.logger.Info("Ethereum withdrawal broadcast",
+		zap.String("withdrawal_id", withdrawalID.String()),
+		zap.String("txid", txHash),
+		zap.Uint64("nonce", t.Nonce),
+	)
+	return txHash, nil
+}
+
+// Transfer pays value wei from the hot wallet to address for the exchange
+// itself, such as gas for a deposit address, and returns the transaction
+// hash. record is called with the nonce and hash in the transaction that
+// reserves the nonce. A rejected transaction releases its nonce and wraps
+// ErrEthereumRejected.
+func (s *EthereumTxSender) Transfer(ctx context.Context, to string, value *big.Int, record func(tx pgx.Tx, nonce uint64, txHash string) error) (string, error) {
+	from := s.signer.Address()
+	t, chainNonce, err := s.prepare(ctx, to, value, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var raw []byte
+	var txHash string
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if t.Nonce, err = s.nonces.AllocateInternal(ctx, tx, from, chainNonce); err != nil {
+			return err
+		}
+		if raw, txHash, err = blockchain.SignTransaction(ctx, s.signer, t); err != nil {
+			return err
+		}
+		if err := recordEthereumTx(ctx, tx, from, t, txHash); err != nil {
+			return err
+		}
+		return record(tx, t.Nonce, txHash)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.broadcast(ctx, raw, txHash); err != nil {
+		if _, releaseErr := s.db.Pool.Exec(ctx, `
+			UPDATE ethereum_nonces SET status = 'released', updated_at = NOW()
+			WHERE address = $1 AND nonce = $2 AND txid = $3
+		`, from, int64(t.Nonce), txHash); releaseErr != nil {
+			return "", releaseErr
+		}
+		return "", err
+	}
+
+	s.logger.Info("Ethereum hot wallet transfer broadcast",
+		zap.String("to", to),
+		zap.String("value_wei", value.String()),
+		zap.String("txid", txHash),
+		zap.Uint64("nonce", t.Nonce),
+	)
+	return txHash, nil
+}
+
+// prepare builds an unsigned transaction from the hot wallet at the node's
+// fees, capped by MaxFeePerGas, and returns it with the address's
+// transaction count in the latest block
+func (s *EthereumTxSender) prepare(ctx context.Context, to string, value *big.Int, data []byte) (*blockchain.DynamicFeeTx, uint64, error) {
+	from := s.signer.Address()
+	chainNonce, err := s.client.GetTransactionCount(ctx, from, "latest")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	fees, err := s.client.SuggestFees(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get fees: %w", err)
+	}
+	gas, err := s.client.EstimateGas(ctx, blockchain.CallMsg{From: from, To: to, Value: value, Data: data})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to estimate gas: %w", err)
+	}
+
+	feeCap := minBig(fees.MaxFeePerGas, s.maxFee)
+	return &blockchain.DynamicFeeTx{
+		ChainID:   big.NewInt(s.client.ChainID()),
+		GasTipCap: minBig(fees.PriorityFee, feeCap),
+		GasFeeCap: feeCap,
+		Gas:       gas,
+		To:        to,
+		Value:     value,
+		Data:      data,
+	}, chainNonce, nil
+}
+
+// broadcast sends a recorded transaction, returning an error only when the
+// node rejected it. A transaction lost on the way stays recorded and is
+// rebroadcast by replacement or found dropped by the monitor.
+func (s *EthereumTxSender) broadcast(ctx context.Context, raw []byte, txHash string) error {
+	_, err := s.client.SendTransaction(ctx, raw)
+	var rpcErr *blockchain.RPCError
+	switch {
+	case err == nil, errors.Is(err, blockchain.ErrAlreadyKnown):
+		return nil
+	case errors.As(err, &rpcErr):
+		return fmt.Errorf("%w: %v", ErrEthereumRejected, err)
+	}
+	s.logger.Warn("Ethereum broadcast failed, transaction left to the monitor",
+		zap.String("txid", txHash),
+		zap.Error(err),
+	)
+	return nil
+}
+
+// recordEthereumTx stores a signed transaction against its nonce as
+// broadcast
+func recordEthereumTx(ctx context.Context, tx pgx.Tx, from string, t *blockchain.DynamicFeeTx, txHash string) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE ethereum_nonces
+		SET status = 'broadcast', txid = $3, to_address = $4, value_wei = $5::numeric, data = $6,
+		    gas_limit = $7, max_fee_per_gas = $8::numeric, max_priority_fee_per_gas = $9::numeric,
+		    broadcast_at = NOW(), updated_at = NOW()
+		WHERE address = $1 AND nonce = $2
+	`, from, int64(t.Nonce), txHash, t.To, t.Value.String(), t.Data,
+		int64(t.Gas), t.GasFeeCap.String(), t.GasTipCap.String())
+	if err != nil {
+		return fmt.Errorf("failed to record ethereum transaction: %w", err)
+	}
+	return nil
+}
+
+// Start replaces stuck transactions until ctx is cancelled
+func (s *EthereumTxSender) Start(ctx context.Context) error {
+	s.logger.Info("Starting Ethereum transaction replacer",
+		zap.String("address", s.signer.Address()),
+		zap.Duration("interval", s.config.Interval),
+	)
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Ethereum transaction replacer stopped")
+			return ctx.Err()
+
+		case <-ticker.C:
+			if err := s.ReplaceStuck(ctx); err != nil {
+				s.logger.Error("Ethereum transaction replacement failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// ReplaceStuck fills nonce gaps left by dropped transactions, which hold
+// up every later transaction, then replaces every transaction broadcast
+// more than StuckAfter ago whose nonce the chain has not yet used
+func (s *EthereumTxSender) ReplaceStuck(ctx context.Context) error {
+	from := s.signer.Address()
+	chainNonce, err := s.client.GetTransactionCount(ctx, from, "latest")
+	if err != nil {
+		return fmt.Errorf("failed to get nonce: %w", err)
+	}
+
+	gaps, err := s.queryNonces(ctx, `
+		SELECT r.nonce FROM ethereum_nonces r
+		WHERE r.address = $1 AND r.status = 'released' AND r.nonce >= $2
+		  AND EXISTS (
+			SELECT 1 FROM ethereum_nonces b
+			WHERE b.address = r.address AND b.status = 'broadcast' AND b.nonce > r.nonce
+		  )
+		ORDER BY r.nonce
+	`, from, int64(chainNonce))
+	if err != nil {
+		return fmt.Errorf("failed to query nonce gaps: %w", err)
+	}
+	for _, nonce := range gaps {
+		if err := s.fillGap(ctx, nonce); err != nil {
+			s.logger.Warn("Failed to fill Ethereum nonce gap",
+				zap.Uint64("nonce", nonce),
+				zap.Error(err),
+			)
+		}
+	}
+
+	stuck, err := s.queryNonces(ctx, `
+		SELECT nonce FROM ethereum_nonces
+		WHERE address = $1 AND status = 'broadcast' AND nonce >= $2 AND broadcast_at < $3
+		ORDER BY nonce
+	`, from, int64(chainNonce), time.Now().Add(-s.config.StuckAfter))
+	if err != nil {
+		return fmt.Errorf("failed to query stuck transactions: %w", err)
+	}
+	for _, nonce := range stuck {
+		txHash, err := s.Replace(ctx, nonce)
+		if err != nil {
+			s.logger.Warn("Failed to replace stuck Ethereum transaction",
+				zap.Uint64("nonce", nonce),
+				zap.Error(err),
+			)
+			continue
+		}
+		s.logger.Info("Replaced stuck Ethereum transaction",
+			zap.Uint64("nonce", nonce),
+			zap.String("txid", txHash),
+		)
+	}
+	return nil
+}
+
+func (s *EthereumTxSender) queryNonces(ctx context.Context, query string, args ...interface{}) ([]uint64, error) {
+	rows, err := s.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nonces []uint64
+	for rows.Next() {
+		var nonce int64
+		if err := rows.Scan(&nonce); err != nil {
+			return nil, err
+		}
+		nonces = append(nonces, uint64(nonce))
+	}
+	return nonces, rows.Err()
+}
+
+// fillGap uses a released nonce for a transfer of nothing to the hot wallet
+// itself, so the transactions after it can be mined
+func (s *EthereumTxSender) fillGap(ctx context.Context, nonce uint64) error {
+	fees, err := s.client.SuggestFees(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get fees: %w", err)
+	}
+
+	from := s.signer.Address()
+	feeCap := minBig(fees.MaxFeePerGas, s.maxFee)
+	t := &blockchain.DynamicFeeTx{
+		ChainID:   big.NewInt(s.client.ChainID()),
+		Nonce:     nonce,
+		GasTipCap: minBig(fees.PriorityFee, feeCap),
+		GasFeeCap: feeCap,
+		Gas:       ethTransferGas,
+		To:        from,
+		Value:     new(big.Int),
+	}
+
+	var raw []byte
+	var txHash string
+	reclaimed := false
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if reclaimed, err = s.nonces.Reclaim(ctx, tx, from, nonce); err != nil || !reclaimed {
+			return err
+		}
+		if raw, txHash, err = blockchain.SignTransaction(ctx, s.signer, t); err != nil {
+			return err
+		}
+		return recordEthereumTx(ctx, tx, from, t, txHash)
+	})
+	if err != nil || !reclaimed {
+		return err
+	}
+
+	if err := s.broadcast(ctx, raw, txHash); err != nil {
+		if _, releaseErr := s.db.Pool.Exec(ctx, `
+			UPDATE ethereum_nonces SET status = 'released', updated_at = NOW()
+			WHERE address = $1 AND nonce = $2 AND txid = $3
+		`, from, int64(nonce), txHash); releaseErr != nil {
+			return releaseErr
+		}
+		return err
+	}
+
+	s.logger.Info("Filled Ethereum nonce gap",
+		zap.Uint64("nonce", nonce),
+		zap.String("txid", txHash),
+	)
+	return nil
+}
+
+// Replace re-signs the transaction at nonce with a higher tip and fee cap
+// and broadcasts it, returning the new hash. Nodes only accept a
+// replacement raising both by at least 10%. The withdrawal follows the new
+// hash; the old one is kept, as it may still be mined instead.
+func (s *EthereumTxSender) Replace(ctx context.Context, nonce uint64) (string, error) {
+	fees, err := s.client.SuggestFees(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get fees: %w", err)
+	}
+
+	from := s.signer.Address()
+	var t *blockchain.DynamicFeeTx
+	var raw []byte
+	var oldHash, txHash, feeCap, tipCap string
+	var withdrawalID *uuid.UUID
+	err = s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var value string
+		var gas int64
+		t = &blockchain.DynamicFeeTx{ChainID: big.NewInt(s.client.ChainID()), Nonce: nonce}
+		err := tx.QueryRow(ctx, `
+			SELECT txid, withdrawal_id, to_address, value_wei::text, data, gas_limit,
+			       max_fee_per_gas::text, max_priority_fee_per_gas::text
+			FROM ethereum_nonces
+			WHERE address = $1 AND nonce = $2 AND status = 'broadcast'
+			FOR UPDATE
+		`, from, int64(nonce)).Scan(&oldHash, &withdrawalID, &t.To, &value, &t.Data, &gas, &feeCap, &tipCap)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotReplaceable
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load ethereum transaction: %w", err)
+		}
+		t.Gas = uint64(gas)
+		var ok bool
+		if t.Value, ok = new(big.Int).SetString(value, 10); !ok {
+			return fmt.Errorf("invalid stored value %q", value)
+		}
+		oldFeeCap, ok1 := new(big.Int).SetString(feeCap, 10)
+		oldTipCap, ok2 := new(big.Int).SetString(tipCap, 10)
+		if !ok1 || !ok2 {
+			return fmt.Errorf("invalid stored fees %s/%s", feeCap, tipCap)
+		}
+
+		t.GasTipCap = maxBig(fees.PriorityFee, replacementFee(oldTipCap))
+		t.GasFeeCap = maxBig(fees.MaxFeePerGas, replacementFee(oldFeeCap), t.GasTipCap)
+		if t.GasFeeCap.Cmp(s.maxFee) > 0 {
+			return fmt.Errorf("%w: %s wei per gas", ErrEthereumFeeCap, t.GasFeeCap)
+		}
+
+		if raw, txHash, err = blockchain.SignTransaction(ctx, s.signer, t); err != nil {
+			return err
+		}
+		if err := recordEthereumTx(ctx, tx, from, t, txHash); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE ethereum_nonces
+			SET previous_txids = array_append(previous_txids, $3)
+			WHERE address = $1 AND nonce = $2
+		`, from, int64(nonce), oldHash); err != nil {
+			return fmt.Errorf("failed to record replaced transaction: %w", err)
+		}
+		if withdrawalID == nil {
+			return nil
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE withdrawals SET txid = $2, updated_at = NOW() WHERE id = $1 AND status = 'processing'
+		`, *withdrawalID, txHash)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.broadcast(ctx, raw, txHash); err != nil {
+		// The node kept the old transaction; so do we
+		revertErr := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, `
+				UPDATE ethereum_nonces
+				SET txid = $3, previous_txids = array_remove(previous_txids, $3),
+				    max_fee_per_gas = $4::numeric, max_priority_fee_per_gas = $5::numeric, updated_at = NOW()
+				WHERE address = $1 AND nonce = $2 AND txid = $6
+			`, from, int64(nonce), oldHash, feeCap, tipCap, txHash); err != nil {
+				return err
+			}
+			if withdrawalID == nil {
+				return nil
+			}
+			_, err := tx.Exec(ctx, `
+				UPDATE withdrawals SET txid = $2, updated_at = NOW() WHERE id = $1 AND txid = $3
+			`, *withdrawalID, oldHash, txHash)
+			return err
+		})
+		if revertErr != nil {
+			return "", revertErr
+		}
+		return "", err
+	}
+	return txHash, nil
+}
+
+// replacementFee is the smallest fee a node accepts in place of fee: 10%
+// more, rounded up
+func replacementFee(fee *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(fee, big.NewInt(11))
+	bumped.Add(bumped, big.NewInt(9))
+	return bumped.Quo(bumped, big.NewInt(10))
+}
+
+func minBig(a, b *big.Int) *big.Int {
+	if a.Cmp(b) < 0 {
+		return a
+	}
+	return b
+}
+
+func maxBig(values ...*big.Int) *big.Int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v.Cmp(m) > 0 {
+			m = v
+		}
+	}
+	return m
+}
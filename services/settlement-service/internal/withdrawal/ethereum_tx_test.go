@@ -0,0 +1,238 @@
+package withdrawal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+// hotWalletAddress is the address of the EIP-155 example key
+const hotWalletAddress = "0x9d8A62f656a8d1615C1294fd71e9CFb3E4855A4F"
+
+const ethPayee = "0x3535353535353535353535353535353535353535"
+
+// ethNode answers the nonce, fee, gas, balance and broadcast RPCs the
+// sender and sweeper use. Fees are a 25 gwei next base fee and a 2 gwei
+// tip; every address holds balance wei and tokens of any token.
+type ethNode struct {
+	nonce   uint64
+	balance int64
+	tokens  int64
+	sent    []string
+	reject  *blockchain.RPCError
+}
+
+func (n *ethNode) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	var result interface{}
+	var rpcErr *blockchain.RPCError
+	switch req.Method {
+	case "eth_getTransactionCount":
+		result = "0x" + big.NewInt(int64(n.nonce)).Text(16)
+	case "eth_feeHistory":
+		result = map[string]interface{}{
+			"baseFeePerGas": []string{"0x4a817c800", "0x5d21dba00"},
+			"reward":        [][]string{{"0x77359400"}},
+		}
+	case "eth_estimateGas":
+		result = "0x5208"
+	case "eth_getBalance":
+		result = "0x" + big.NewInt(n.balance).Text(16)
+	case "eth_call":
+		result = fmt.Sprintf("0x%064x", n.tokens)
+	case "eth_sendRawTransaction":
+		if n.reject != nil {
+			rpcErr = n.reject
+			break
+		}
+		var raw string
+		json.Unmarshal(req.Params[0], &raw)
+		n.sent = append(n.sent, raw)
+		result = "0x" + strings.Repeat("00", 32)
+	default:
+		rpcErr = &blockchain.RPCError{Code: -32601, Message: "method not found"}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result, "error": rpcErr})
+}
+
+func newTestSender(t *testing.T, node *ethNode) (*EthereumTxSender, pgxmock.PgxPoolIface) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(node.serve))
+	t.Cleanup(server.Close)
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+
+	signer, err := wallet.NewEthereumKeySigner(strings.Repeat("46", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := blockchain.NewEthereumClient(blockchain.EthereumConfig{RPCURL: server.URL, ChainID: 1}, zap.NewNop())
+	return NewEthereumTxSender(database.New(mock, zap.NewNop()), client, signer, DefaultEthereumSendConfig(), zap.NewNop()), mock
+}
+
+// expectFreshNonce expects a nonce allocation with nothing released, taking
+// next from the account. withdrawalID is nil for the hot wallet's own
+// transfers.
+func expectFreshNonce(mock pgxmock.PgxPoolIface, chainNonce, next int64, withdrawalID interface{}) {
+	mock.ExpectExec("INSERT INTO ethereum_accounts").
+		WithArgs(hotWalletAddress, chainNonce).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+	mock.ExpectQuery("SELECT next_nonce FROM ethereum_accounts").
+		WithArgs(hotWalletAddress).
+		WillReturnRows(pgxmock.NewRows([]string{"next_nonce"}).AddRow(next))
+	mock.ExpectQuery("SET status = 'confirmed'").
+		WithArgs(hotWalletAddress, chainNonce).
+		WillReturnRows(pgxmock.NewRows([]string{"nonce", "txid", "withdrawal_id"}))
+	mock.ExpectQuery("WHERE address = \\$1 AND status = 'released'").
+		WithArgs(hotWalletAddress).
+		WillReturnRows(pgxmock.NewRows([]string{"nonce"}))
+	nonce := max(chainNonce, next)
+	mock.ExpectExec("INSERT INTO ethereum_nonces").
+		WithArgs(hotWalletAddress, nonce, withdrawalID).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("UPDATE ethereum_accounts SET next_nonce").
+		WithArgs(hotWalletAddress, nonce+1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+}
+
+func TestEthereumTxSenderSend(t *testing.T) {
+	node := &ethNode{nonce: 5}
+	sender, mock := newTestSender(t, node)
+	withdrawalID := uuid.New()
+
+	// Nonces 5 to 7 are pending; the chain has only seen 0 to 4
+	var txid string
+	mock.ExpectBegin()
+	expectFreshNonce(mock, 5, 8, withdrawalID)
+	mock.ExpectExec("UPDATE ethereum_nonces").
+		WithArgs(hotWalletAddress, int64(8), capture{&txid}, ethPayee, "1000000000000000000", []byte(nil),
+			int64(21000), "52000000000", "2000000000").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("UPDATE withdrawals SET txid").
+		WithArgs(withdrawalID, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	got, err := sender.Send(context.Background(), withdrawalID, ethPayee, big.NewInt(1e18), nil)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got != txid || len(node.sent) != 1 {
+		t.Errorf("Send() = %s after %d broadcasts, want %s broadcast once", got, len(node.sent), txid)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEthereumTxSenderReleasesRejectedNonce(t *testing.T) {
+	node := &ethNode{reject: &blockchain.RPCError{Code: -32000, Message: "insufficient funds for gas * price + value"}}
+	sender, mock := newTestSender(t, node)
+	withdrawalID := uuid.New()
+
+	mock.ExpectBegin()
+	expectFreshNonce(mock, 0, 0, withdrawalID)
+	mock.ExpectExec("UPDATE ethereum_nonces").
+		WithArgs(hotWalletAddress, int64(0), pgxmock.AnyArg(), ethPayee, "1000000000000000000", []byte(nil),
+			int64(21000), "52000000000", "2000000000").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("UPDATE withdrawals SET txid").
+		WithArgs(withdrawalID, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("SET status = 'released'").
+		WithArgs(withdrawalID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("UPDATE withdrawals SET txid = NULL").
+		WithArgs(withdrawalID, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	_, err := sender.Send(context.Background(), withdrawalID, ethPayee, big.NewInt(1e18), nil)
+	if !errors.Is(err, ErrEthereumRejected) {
+		t.Errorf("Send() error = %v, want ErrEthereumRejected", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A released nonce is handed out before a fresh one
+func TestNonceManagerReusesReleasedNonce(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	db := database.New(mock, zap.NewNop())
+	withdrawalID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO ethereum_accounts").
+		WithArgs(hotWalletAddress, int64(9)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+	mock.ExpectQuery("SELECT next_nonce FROM ethereum_accounts").
+		WithArgs(hotWalletAddress).
+		WillReturnRows(pgxmock.NewRows([]string{"next_nonce"}).AddRow(int64(12)))
+	// Nonce 3 was released but the chain has used it since
+	txid := "0xabc"
+	mock.ExpectQuery("SET status = 'confirmed'").
+		WithArgs(hotWalletAddress, int64(9)).
+		WillReturnRows(pgxmock.NewRows([]string{"nonce", "txid", "withdrawal_id"}).AddRow(int64(3), &txid, (*uuid.UUID)(nil)))
+	mock.ExpectQuery("WHERE address = \\$1 AND status = 'released'").
+		WithArgs(hotWalletAddress).
+		WillReturnRows(pgxmock.NewRows([]string{"nonce"}).AddRow(int64(10)))
+	mock.ExpectExec("SET status = 'reserved', withdrawal_id = \\$3").
+		WithArgs(hotWalletAddress, int64(10), withdrawalID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	var nonce uint64
+	err = db.WithTx(context.Background(), func(tx pgx.Tx) error {
+		var err error
+		nonce, err = NewNonceManager(zap.NewNop()).Allocate(context.Background(), tx, hotWalletAddress, 9, withdrawalID)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 10 {
+		t.Errorf("Allocate() = %d, want released nonce 10", nonce)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReplacementFee(t *testing.T) {
+	for fee, want := range map[int64]int64{0: 0, 10: 11, 19: 21, 2e9: 22e8} {
+		if got := replacementFee(big.NewInt(fee)); got.Int64() != want {
+			t.Errorf("replacementFee(%d) = %s, want %d", fee, got, want)
+		}
+	}
+}
@@ -0,0 +1,728 @@
+// BitCurrent Exchange - Bitcoin Withdrawal Fee Bumping
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// incrementalRelayFee is Bitcoin Core's default incrementalrelayfee in
+	// sat/vB: a replacement must pay at least this for its own size on top
+	// of everything it replaces
+	incrementalRelayFee = 1
+
+	// cpfpChildVBytes is the size of a child spending one P2WPKH change
+	// output to one P2WPKH output
+	cpfpChildVBytes = txOverheadVBytes + p2wpkhInputVBytes + 8 + 1 + p2wpkhScriptLen
+)
+
+var (
+	ErrFeeCapReached = errors.New("fee bump would exceed the fee cap")
+	ErrCannotBump    = errors.New("transaction cannot be fee bumped")
+)
+
+// BumpConfig controls fee bumping of stuck Bitcoin withdrawals
+type BumpConfig struct {
+	Interval time.Duration
+	// StuckAfter is how many blocks a broadcast transaction may go
+	// unconfirmed before it is bumped
+	StuckAfter int64
+	// MaxFeeRate caps the fee rate of a bump, in sat/vB
+	MaxFeeRate int64
+	// MaxFee caps what a transaction and all of its bumps pay together, in
+	// satoshis
+	MaxFee int64
+}
+
+// DefaultBumpConfig returns the fee bumping defaults
+func DefaultBumpConfig() BumpConfig {
+	return BumpConfig{
+		Interval:   5 * time.Minute,
+		StuckAfter: feeTargetBlocks,
+		MaxFeeRate: 500,
+		MaxFee:     1000000,
+	}
+}
+
+// FeeBumper watches broadcast withdrawal transactions and bumps those that
+// stay unconfirmed past StuckAfter blocks. A transaction signalling BIP125
+// is replaced by one paying the extra fee out of its change; one that does
+// not is paid for by a child spending its change (CPFP). Bumps are built as
+// PSBTs for the signers like any other withdrawal transaction.
+type FeeBumper struct {
+	db        *database.PostgresDB
+	btcClient *blockchain.BitcoinClient
+	builder   *BitcoinTxBuilder
+	config    BumpConfig
+	logger    *zap.Logger
+}
+
+// NewFeeBumper creates a fee bumper
+func NewFeeBumper(
+	db *database.PostgresDB,
+	btcClient *blockchain.BitcoinClient,
+	builder *BitcoinTxBuilder,
+	cfg BumpConfig,
+	logger *zap.Logger,
+) *FeeBumper {
+	defaults := DefaultBumpConfig()
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaults.Interval
+	}
+	if cfg.StuckAfter <= 0 {
+		cfg.StuckAfter = defaults.StuckAfter
+	}
+	if cfg.MaxFeeRate <= 0 {
+		cfg.MaxFeeRate = defaults.MaxFeeRate
+	}
+	if cfg.MaxFee <= 0 {
+		cfg.MaxFee = defaults.MaxFee
+	}
+	return &FeeBumper{
+		db:        db,
+		btcClient: btcClient,
+		builder:   builder,
+		config:    cfg,
+		logger:    logger,
+	}
+}
+
+// Start runs fee bumping passes until ctx is cancelled
+func (f *FeeBumper) Start(ctx context.Context) error {
+	f.logger.Info("Starting fee bumper",
+		zap.Duration("interval", f.config.Interval),
+		zap.Int64("stuck_after_blocks", f.config.StuckAfter),
+	)
+
+	ticker := time.NewTicker(f.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			f.logger.Info("Fee bumper stopped")
+			return ctx.Err()
+
+		case <-ticker.C:
+			if err := f.RunOnce(ctx); err != nil {
+				f.logger.Error("Fee bumping failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// stuckTransaction is a broadcast transaction due a bump. ChildFee and
+// ChildVSize are of the CPFP children already broadcast for it.
+type stuckTransaction struct {
+	ID         uuid.UUID
+	TxID       string
+	PSBT       string
+	Fee        int64
+	VSize      int64
+	ChildFee   int64
+	ChildVSize int64
+}
+
+// bumpPlan is the transaction a bump builds: a "replacement" paying Fee in
+// place of the stuck one, or a "cpfp" child paying Fee on top of it
+type bumpPlan struct {
+	Kind    string
+	Fee     int64
+	FeeRate int64
+}
+
+// RunOnce resends signed transactions, settles mined CPFP children and
+// bumps every stuck transaction that has no bump waiting for signatures
+func (f *FeeBumper) RunOnce(ctx context.Context) error {
+	// Transactions signed but not broadcast are sent again before anything
+	// is judged stuck
+	if err := f.builder.BroadcastSigned(ctx); err != nil {
+		return err
+	}
+	if err := f.settleChildren(ctx); err != nil {
+		return err
+	}
+
+	tip, err := f.btcClient.GetBlockHeight()
+	if err != nil {
+		return fmt.Errorf("failed to get block height: %w", err)
+	}
+
+	rows, err := f.db.Pool.Query(ctx, `
+		SELECT t.id, t.txid, t.psbt, t.fee_sats, t.vsize,
+		       COALESCE(SUM(c.fee_sats), 0)::BIGINT, COALESCE(SUM(c.vsize), 0)::BIGINT
+		FROM bitcoin_transactions t
+		LEFT JOIN bitcoin_transactions c
+		       ON c.parent_id = t.id AND c.kind = 'cpfp' AND c.status = 'broadcast'
+		WHERE t.kind IN ('payment', 'replacement') AND t.status = 'broadcast'
+		  AND NOT EXISTS (
+		      SELECT 1 FROM bitcoin_transactions u
+		      WHERE u.parent_id = t.id AND u.status IN ('unsigned', 'signed')
+		  )
+		GROUP BY t.id
+		HAVING GREATEST(MAX(COALESCE(t.broadcast_height, 0)), MAX(c.broadcast_height)) <= $1
+		ORDER BY t.created_at
+	`, tip-f.config.StuckAfter)
+	if err != nil {
+		return fmt.Errorf("failed to query stuck transactions: %w", err)
+	}
+	var stuck []stuckTransaction
+	for rows.Next() {
+		var s stuckTransaction
+		if err := rows.Scan(&s.ID, &s.TxID, &s.PSBT, &s.Fee, &s.VSize, &s.ChildFee, &s.ChildVSize); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan stuck transaction: %w", err)
+		}
+		stuck = append(stuck, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(stuck) == 0 {
+		return nil
+	}
+
+	target, err := f.builder.feeRate()
+	if err != nil {
+		return err
+	}
+	for _, s := range stuck {
+		err := f.bump(ctx, s, target)
+		switch {
+		case errors.Is(err, ErrFeeCapReached), errors.Is(err, ErrCannotBump):
+			f.logger.Warn("Stuck Bitcoin withdrawal transaction not bumped",
+				zap.String("bitcoin_transaction_id", s.ID.String()),
+				zap.String("txid", s.TxID),
+				zap.Error(err),
+			)
+		case err != nil:
+			f.logger.Error("Failed to bump Bitcoin withdrawal transaction",
+				zap.String("bitcoin_transaction_id", s.ID.String()),
+				zap.String("txid", s.TxID),
+				zap.Error(err),
+			)
+		}
+	}
+	return nil
+}
+
+// bump builds a replacement or CPFP child for a stuck transaction. One the
+// node no longer has is left to the Monitor, which handles dropped
+// transactions.
+func (f *FeeBumper) bump(ctx context.Context, s stuckTransaction, target int64) error {
+	raw, err := f.btcClient.GetRawTransaction(s.TxID)
+	if errors.Is(err, blockchain.ErrTransactionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if raw.Confirmations > 0 {
+		return nil
+	}
+
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(s.PSBT), true)
+	if err != nil {
+		return fmt.Errorf("failed to decode stored PSBT: %w", err)
+	}
+	change, err := f.changeOutput(ctx, s.TxID, packet)
+	if err != nil {
+		return err
+	}
+
+	plan, err := planBump(s, packet.UnsignedTx, change, target, f.config)
+	if err != nil {
+		return err
+	}
+
+	var bumped *BitcoinTransaction
+	if plan.Kind == "replacement" {
+		bumped, err = f.builder.buildReplacement(ctx, s, packet.UnsignedTx, change, plan)
+	} else {
+		bumped, err = f.builder.buildChild(ctx, s, change, plan)
+	}
+	if err != nil {
+		return err
+	}
+
+	f.logger.Info("Stuck Bitcoin withdrawal transaction bumped, awaiting signatures",
+		zap.String("bitcoin_transaction_id", s.ID.String()),
+		zap.String("txid", s.TxID),
+		zap.String("bump_id", bumped.ID.String()),
+		zap.String("kind", bumped.Kind),
+		zap.Int64("fee_sats", bumped.Fee),
+		zap.Int64("fee_rate", bumped.FeeRate),
+	)
+	return nil
+}
+
+// changeOutput returns a transaction's change, recognised by the
+// derivation Build gives it for the signers, or nil if it has none. Change
+// already spent by a CPFP child has no TxID, since it cannot be spent again.
+func (f *FeeBumper) changeOutput(ctx context.Context, txid string, packet *psbt.Packet) (*UTXO, error) {
+	index := -1
+	for i, out := range packet.Outputs {
+		if len(out.Bip32Derivation) > 0 {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, nil
+	}
+
+	var status string
+	err := f.db.Pool.QueryRow(ctx, `
+		SELECT status FROM bitcoin_utxos WHERE txid = $1 AND vout = $2
+	`, txid, index).Scan(&status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load change output: %w", err)
+	}
+
+	change := &UTXO{Vout: uint32(index)}
+	if status == "pending" {
+		change.TxID = txid
+	}
+	return change, nil
+}
+
+// planBump works out the bump for a stuck transaction given the node's fee
+// estimate. The new rate is the estimate, or a quarter more than the stuck
+// package pays if that is already at the estimate, capped by the config.
+func planBump(s stuckTransaction, unsigned *wire.MsgTx, change *UTXO, target int64, cfg BumpConfig) (*bumpPlan, error) {
+	paid := s.Fee + s.ChildFee
+	size := s.VSize + s.ChildVSize
+	current := paid / size
+
+	rate := min(max(target, current+current/4, current+1), cfg.MaxFeeRate)
+	if rate <= current {
+		return nil, fmt.Errorf("%w: already paying %d sat/vB", ErrFeeCapReached, current)
+	}
+	if change == nil {
+		return nil, fmt.Errorf("%w: no change output to pay from", ErrCannotBump)
+	}
+	changeOut := unsigned.TxOut[change.Vout]
+
+	if signalsRBF(unsigned) {
+		// BIP125: the replacement pays for everything it evicts, children
+		// included, and for relaying itself
+		minFee := paid + incrementalRelayFee*s.VSize
+		fee := min(max(rate*s.VSize, minFee), cfg.MaxFee)
+		if fee < minFee {
+			return nil, fmt.Errorf("%w: replacement needs %d sats", ErrFeeCapReached, minFee)
+		}
+		if changeOut.Value-(fee-s.Fee) < dustLimit(changeOut.PkScript) {
+			return nil, fmt.Errorf("%w: change of %d sats cannot pay %d more", ErrCannotBump, changeOut.Value, fee-s.Fee)
+		}
+		return &bumpPlan{Kind: "replacement", Fee: fee, FeeRate: fee / s.VSize}, nil
+	}
+
+	if change.TxID == "" {
+		return nil, fmt.Errorf("%w: change already spent by a CPFP child", ErrCannotBump)
+	}
+	// The child lifts the whole package to rate
+	fee := min(max(rate*(size+cpfpChildVBytes)-paid, incrementalRelayFee*cpfpChildVBytes), cfg.MaxFee-paid)
+	if (paid+fee)/(size+cpfpChildVBytes) <= current || fee < incrementalRelayFee*cpfpChildVBytes {
+		return nil, fmt.Errorf("%w: package already pays %d sats", ErrFeeCapReached, paid)
+	}
+	if changeOut.Value-fee < dustLimit(make([]byte, p2wpkhScriptLen)) {
+		return nil, fmt.Errorf("%w: change of %d sats cannot pay a %d sat child", ErrCannotBump, changeOut.Value, fee)
+	}
+	return &bumpPlan{Kind: "cpfp", Fee: fee, FeeRate: fee / cpfpChildVBytes}, nil
+}
+
+// signalsRBF reports whether a transaction opts in to BIP125 replacement
+func signalsRBF(tx *wire.MsgTx) bool {
+	for _, in := range tx.TxIn {
+		if in.Sequence < wire.MaxTxInSequenceNum-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// buildReplacement stores a transaction spending the same inputs and paying
+// the same outputs as parent, with the extra fee taken from its change
+func (b *BitcoinTxBuilder) buildReplacement(ctx context.Context, parent stuckTransaction, unsigned *wire.MsgTx, change *UTXO, plan *bumpPlan) (*BitcoinTransaction, error) {
+	replacement := unsigned.Copy()
+	replacement.TxOut[change.Vout].Value -= plan.Fee - parent.Fee
+	changeOut := replacement.TxOut[change.Vout]
+
+	result := &BitcoinTransaction{
+		TxID:     replacement.TxHash().String(),
+		Fee:      plan.Fee,
+		FeeRate:  plan.FeeRate,
+		VSize:    parent.VSize,
+		Status:   "unsigned",
+		Kind:     "replacement",
+		ParentID: &parent.ID,
+	}
+	err := b.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if err := lockBumpable(ctx, tx, parent.ID); err != nil {
+			return err
+		}
+
+		// The signed PSBT has lost its derivations; the UTXO set has them
+		rows, err := tx.Query(ctx, `
+			SELECT txid, vout, amount_sats, script_pub_key, derivation_path
+			FROM bitcoin_utxos
+			WHERE spent_by = $1
+		`, parent.ID)
+		if err != nil {
+			return fmt.Errorf("failed to load inputs: %w", err)
+		}
+		spent, err := scanUTXOs(rows)
+		if err != nil {
+			return err
+		}
+		inputs, err := matchInputs(replacement, spent)
+		if err != nil {
+			return err
+		}
+
+		var path string
+		if err := tx.QueryRow(ctx, `
+			SELECT derivation_path FROM bitcoin_utxos WHERE txid = $1 AND vout = $2
+		`, parent.TxID, int64(change.Vout)).Scan(&path); err != nil {
+			return fmt.Errorf("failed to load change output: %w", err)
+		}
+		newChange := &UTXO{Amount: changeOut.Value, ScriptPubKey: changeOut.PkScript, DerivationPath: path}
+
+		if result.PSBT, err = b.signingPacket(replacement, inputs, newChange, int(change.Vout)); err != nil {
+			return err
+		}
+		if err := storeTransaction(ctx, tx, result); err != nil {
+			return err
+		}
+		return b.storeChangeOutput(ctx, tx, result.TxID, int(change.Vout), newChange)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// buildChild stores a CPFP child spending parent's change to a fresh change
+// address, paying plan.Fee
+func (b *BitcoinTxBuilder) buildChild(ctx context.Context, parent stuckTransaction, change *UTXO, plan *bumpPlan) (*BitcoinTransaction, error) {
+	result := &BitcoinTransaction{
+		Fee:      plan.Fee,
+		FeeRate:  plan.FeeRate,
+		VSize:    cpfpChildVBytes,
+		Status:   "unsigned",
+		Kind:     "cpfp",
+		ParentID: &parent.ID,
+	}
+	err := b.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if err := lockBumpable(ctx, tx, parent.ID); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, `
+			SELECT txid, vout, amount_sats, script_pub_key, derivation_path
+			FROM bitcoin_utxos
+			WHERE txid = $1 AND vout = $2 AND status = 'pending'
+			FOR UPDATE
+		`, parent.TxID, int64(change.Vout))
+		if err != nil {
+			return fmt.Errorf("failed to lock change output: %w", err)
+		}
+		inputs, err := scanUTXOs(rows)
+		if err != nil {
+			return err
+		}
+		if len(inputs) == 0 {
+			return fmt.Errorf("%w: change already spent", ErrCannotBump)
+		}
+
+		newChange, err := b.nextChangeOutput(ctx, tx, inputs[0].Amount-plan.Fee)
+		if err != nil {
+			return err
+		}
+		child, err := unsignedTx(inputs)
+		if err != nil {
+			return err
+		}
+		child.AddTxOut(wire.NewTxOut(newChange.Amount, newChange.ScriptPubKey))
+
+		result.TxID = child.TxHash().String()
+		if result.PSBT, err = b.signingPacket(child, inputs, newChange, 0); err != nil {
+			return err
+		}
+		if err := storeTransaction(ctx, tx, result); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE bitcoin_utxos
+			SET status = 'spent', spent_by = $3, updated_at = NOW()
+			WHERE txid = $1 AND vout = $2
+		`, parent.TxID, int64(change.Vout), result.ID); err != nil {
+			return fmt.Errorf("failed to mark change spent: %w", err)
+		}
+		return b.storeChangeOutput(ctx, tx, result.TxID, 0, newChange)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// lockBumpable locks a transaction about to be bumped, checking it is
+// still broadcast and has no other bump waiting for signatures
+func lockBumpable(ctx context.Context, tx pgx.Tx, id uuid.UUID) error {
+	var status string
+	var pending bool
+	err := tx.QueryRow(ctx, `
+		SELECT status, EXISTS (
+			SELECT 1 FROM bitcoin_transactions WHERE parent_id = $1 AND status IN ('unsigned', 'signed')
+		)
+		FROM bitcoin_transactions
+		WHERE id = $1
+		FOR UPDATE
+	`, id).Scan(&status, &pending)
+	if err != nil {
+		return fmt.Errorf("failed to lock bitcoin transaction: %w", err)
+	}
+	if status != "broadcast" || pending {
+		return fmt.Errorf("%w: transaction is %s", ErrCannotBump, status)
+	}
+	return nil
+}
+
+// matchInputs orders utxos to match the inputs of tx
+func matchInputs(tx *wire.MsgTx, utxos []UTXO) ([]UTXO, error) {
+	inputs := make([]UTXO, len(tx.TxIn))
+	for i, in := range tx.TxIn {
+		found := false
+		for _, u := range utxos {
+			if u.TxID == in.PreviousOutPoint.Hash.String() && u.Vout == in.PreviousOutPoint.Index {
+				inputs[i], found = u, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("input %s is not a tracked UTXO", in.PreviousOutPoint)
+		}
+	}
+	return inputs, nil
+}
+
+// settleChildren confirms broadcast CPFP children once mined, making their
+// change spendable. Their parents are confirmed by the Monitor with the
+// withdrawals they pay.
+func (f *FeeBumper) settleChildren(ctx context.Context) error {
+	rows, err := f.db.Pool.Query(ctx, `
+		SELECT id, txid FROM bitcoin_transactions
+		WHERE kind = 'cpfp' AND status = 'broadcast'
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query CPFP transactions: %w", err)
+	}
+	type child struct {
+		ID   uuid.UUID
+		TxID string
+	}
+	var children []child
+	for rows.Next() {
+		var c child
+		if err := rows.Scan(&c.ID, &c.TxID); err != nil {
+			rows.Close()
+			return err
+		}
+		children = append(children, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range children {
+		raw, err := f.btcClient.GetRawTransaction(c.TxID)
+		if errors.Is(err, blockchain.ErrTransactionNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if raw.Confirmations <= 0 {
+			continue
+		}
+		if err := f.db.WithTx(ctx, func(tx pgx.Tx) error {
+			return confirmBitcoinTransaction(ctx, tx, c.ID)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordFeeBump records a broadcast bump against the withdrawals of the
+// transaction it bumps. Each withdrawal's share of a replacement's fee is
+// worked out as Build does, and the withdrawals move over to it; a CPFP
+// child's fee is split evenly and added to what they have paid.
+func recordFeeBump(ctx context.Context, tx pgx.Tx, t *BitcoinTransaction, packet *psbt.Packet) error {
+	if t.ParentID == nil {
+		return fmt.Errorf("fee bump %s has no parent transaction", t.ID)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, COALESCE(bitcoin_output_index, 0)
+		FROM withdrawals
+		WHERE bitcoin_transaction_id = $1 AND status = 'processing'
+		ORDER BY bitcoin_output_index
+		FOR UPDATE
+	`, *t.ParentID)
+	if err != nil {
+		return fmt.Errorf("failed to lock bumped withdrawals: %w", err)
+	}
+	var ids []uuid.UUID
+	var sizes []int64
+	for rows.Next() {
+		var id uuid.UUID
+		var index int64
+		if err := rows.Scan(&id, &index); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+		if t.Kind == "replacement" {
+			sizes = append(sizes, outputVBytes(len(packet.UnsignedTx.TxOut[index].PkScript)))
+		} else {
+			sizes = append(sizes, 0)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		shares := shareFee(t.Fee, t.FeeRate, sizes)
+		if t.Kind == "cpfp" {
+			shares = shareFee(t.Fee, 0, sizes)
+		}
+		for i, id := range ids {
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO withdrawal_txids (withdrawal_id, txid, bitcoin_transaction_id, fee_sats)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT DO NOTHING
+			`, id, t.TxID, t.ID, shares[i]); err != nil {
+				return fmt.Errorf("failed to record withdrawal txid: %w", err)
+			}
+			if t.Kind != "cpfp" {
+				continue
+			}
+			if _, err := tx.Exec(ctx, `
+				UPDATE withdrawals
+				SET network_fee_sats = COALESCE(network_fee_sats, 0) + $2, updated_at = NOW()
+				WHERE id = $1
+			`, id, shares[i]); err != nil {
+				return fmt.Errorf("failed to add CPFP fee: %w", err)
+			}
+		}
+	}
+
+	if t.Kind == "replacement" {
+		return supersede(ctx, tx, *t.ParentID, t.ID)
+	}
+	return nil
+}
+
+// supersede makes to the live transaction for the withdrawals paid by
+// from: a replacement just broadcast, or a replaced transaction that was
+// mined after all. from's CPFP children are evicted with it and its change
+// set aside in case it is mined in turn; the withdrawals follow to, with
+// the fee share recorded for it.
+func supersede(ctx context.Context, tx pgx.Tx, from, to uuid.UUID) error {
+	if _, err := tx.Exec(ctx, `
+		UPDATE bitcoin_transactions
+		SET status = CASE WHEN id = $1 THEN 'replaced' ELSE 'broadcast' END,
+		    updated_at = NOW()
+		WHERE id IN ($1, $2) AND status IN ('broadcast', 'replaced')
+	`, from, to); err != nil {
+		return fmt.Errorf("failed to mark transaction replaced: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		WITH evicted AS (
+			UPDATE bitcoin_transactions
+			SET status = 'failed', updated_at = NOW()
+			WHERE parent_id = $1 AND kind = 'cpfp' AND status IN ('unsigned', 'signed', 'broadcast')
+			RETURNING txid
+		)
+		DELETE FROM bitcoin_utxos u
+		USING evicted e
+		WHERE u.txid = e.txid
+	`, from); err != nil {
+		return fmt.Errorf("failed to fail evicted CPFP transactions: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		WITH inputs AS (
+			UPDATE bitcoin_utxos
+			SET spent_by = $2, updated_at = NOW()
+			WHERE spent_by = $1
+		), set_aside AS (
+			UPDATE bitcoin_utxos
+			SET status = 'orphaned', spent_by = NULL, updated_at = NOW()
+			WHERE txid = (SELECT txid FROM bitcoin_transactions WHERE id = $1)
+		)
+		UPDATE bitcoin_utxos
+		SET status = 'pending', updated_at = NOW()
+		WHERE txid = (SELECT txid FROM bitcoin_transactions WHERE id = $2)
+		  AND status = 'orphaned'
+	`, from, to); err != nil {
+		return fmt.Errorf("failed to move inputs to replacement: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE withdrawals w
+		SET bitcoin_transaction_id = $2,
+		    txid = wt.txid,
+		    network_fee_sats = wt.fee_sats,
+		    last_seen_at = NOW(),
+		    updated_at = NOW()
+		FROM withdrawal_txids wt
+		WHERE w.bitcoin_transaction_id = $1 AND w.status = 'processing'
+		  AND wt.withdrawal_id = w.id AND wt.bitcoin_transaction_id = $2
+	`, from, to); err != nil {
+		return fmt.Errorf("failed to move withdrawals to replacement: %w", err)
+	}
+	return nil
+}
+
+// discardFeeBump fails a bump the network rejected. A CPFP child's input,
+// its parent's change, goes back to pending.
+func discardFeeBump(ctx context.Context, tx pgx.Tx, id uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		WITH failed AS (
+			UPDATE bitcoin_transactions
+			SET status = 'failed', updated_at = NOW()
+			WHERE id = $1
+			RETURNING txid
+		), freed AS (
+			UPDATE bitcoin_utxos
+			SET status = 'pending', spent_by = NULL, updated_at = NOW()
+			WHERE spent_by = $1
+		)
+		DELETE FROM bitcoin_utxos u
+		USING failed f
+		WHERE u.txid = f.txid AND u.status = 'pending'
+	`, id)
+	if err != nil {
+		return fmt.Errorf("failed to discard fee bump: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package withdrawal
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+)
+
+// stuckTx pays 100000 sats with change, 1 input and 2 outputs at 10 sat/vB
+func stuckTx(sequence uint32, change int64) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	in := wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil)
+	in.Sequence = sequence
+	tx.AddTxIn(in)
+	script := append([]byte{0x00, 0x14}, make([]byte, 20)...)
+	tx.AddTxOut(wire.NewTxOut(100000, script))
+	tx.AddTxOut(wire.NewTxOut(change, script))
+	return tx
+}
+
+func TestPlanBump(t *testing.T) {
+	s := stuckTransaction{Fee: 1410, VSize: 141}
+	unspent := &UTXO{TxID: "parent", Vout: 1}
+	cfg := DefaultBumpConfig()
+
+	tests := map[string]struct {
+		s      stuckTransaction
+		tx     *wire.MsgTx
+		change *UTXO
+		target int64
+		cfg    BumpConfig
+		want   *bumpPlan
+		err    error
+	}{
+		// At the estimate already: a quarter more, 12 sat/vB
+		"replace at increased rate": {s, stuckTx(rbfSequence, 398590), unspent, 10, cfg,
+			&bumpPlan{Kind: "replacement", Fee: 1692, FeeRate: 12}, nil},
+		"replace at estimate": {s, stuckTx(rbfSequence, 398590), unspent, 40, cfg,
+			&bumpPlan{Kind: "replacement", Fee: 5640, FeeRate: 40}, nil},
+		// 12 × (141 + 110) less the 1410 already paid
+		"cpfp without signal": {s, stuckTx(wire.MaxTxInSequenceNum, 398590), unspent, 10, cfg,
+			&bumpPlan{Kind: "cpfp", Fee: 1602, FeeRate: 14}, nil},
+		// A replacement must add at least 141 sats
+		"total fee cap": {s, stuckTx(rbfSequence, 398590), unspent, 10, BumpConfig{MaxFeeRate: 500, MaxFee: 1500},
+			nil, ErrFeeCapReached},
+		"fee rate cap": {s, stuckTx(rbfSequence, 398590), unspent, 40, BumpConfig{MaxFeeRate: 10, MaxFee: cfg.MaxFee},
+			nil, ErrFeeCapReached},
+		"no change": {s, stuckTx(rbfSequence, 398590), nil, 10, cfg,
+			nil, ErrCannotBump},
+		"change would be dust": {s, stuckTx(rbfSequence, 500), unspent, 10, cfg,
+			nil, ErrCannotBump},
+		"change already spent by child": {s, stuckTx(wire.MaxTxInSequenceNum, 398590), &UTXO{Vout: 1}, 10, cfg,
+			nil, ErrCannotBump},
+	}
+	for name, tt := range tests {
+		got, err := planBump(tt.s, tt.tx, tt.change, tt.target, tt.cfg)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: error = %v, want %v", name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", name, err)
+			continue
+		}
+		if *got != *tt.want {
+			t.Errorf("%s: plan = %+v, want %+v", name, got, tt.want)
+		}
+	}
+}
+
+// capture matches any argument, keeping it
+type capture struct{ value *string }
+
+func (c capture) Match(v interface{}) bool {
+	*c.value, _ = v.(string)
+	return true
+}
+
+// A transaction left unconfirmed for six blocks is replaced; once the
+// replacement is signed and broadcast its withdrawal follows it
+func TestFeeBumperReplacesStuckTransaction(t *testing.T) {
+	f := newBuilderFixture(t)
+	parentID, withdrawalID, bumpID := uuid.New(), uuid.New(), uuid.New()
+	parent := f.build(t, parentID, withdrawalID)
+
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(parent.PSBT), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changeIndex := 0
+	if len(packet.Outputs[1].Bip32Derivation) > 0 {
+		changeIndex = 1
+	}
+
+	f.node.height = 800010
+	f.node.raw = map[string]int64{parent.TxID: 0}
+	bumper := NewFeeBumper(f.builder.db, f.builder.btcClient, f.builder, DefaultBumpConfig(), f.builder.logger)
+
+	f.mock.ExpectQuery("WHERE status = 'signed'").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}))
+	f.mock.ExpectQuery("WHERE kind = 'cpfp' AND status = 'broadcast'").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "txid"}))
+	f.mock.ExpectQuery("FROM bitcoin_transactions t").
+		WithArgs(int64(800004)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "txid", "psbt", "fee_sats", "vsize", "child_fee", "child_vsize"}).
+			AddRow(parentID, parent.TxID, parent.PSBT, parent.Fee, parent.VSize, int64(0), int64(0)))
+	f.mock.ExpectQuery("SELECT status FROM bitcoin_utxos").
+		WithArgs(parent.TxID, changeIndex).
+		WillReturnRows(pgxmock.NewRows([]string{"status"}).AddRow("pending"))
+	f.mock.ExpectBegin()
+	f.mock.ExpectQuery("FROM bitcoin_transactions").
+		WithArgs(parentID).
+		WillReturnRows(pgxmock.NewRows([]string{"status", "pending"}).AddRow("broadcast", false))
+	f.mock.ExpectQuery("WHERE spent_by = \\$1").
+		WithArgs(parentID).
+		WillReturnRows(pgxmock.NewRows([]string{"txid", "vout", "amount_sats", "script_pub_key", "derivation_path"}).
+			AddRow(testUTXOTxID, int64(1), int64(500000), hex.EncodeToString(f.depositScript(t, 0)), "m/84'/0'/0'/0/0"))
+	f.mock.ExpectQuery("SELECT derivation_path FROM bitcoin_utxos").
+		WithArgs(parent.TxID, int64(changeIndex)).
+		WillReturnRows(pgxmock.NewRows([]string{"derivation_path"}).AddRow("m/84'/0'/0'/1/0"))
+	// 12 sat/vB over the same 141 vB, 282 sats more out of the change
+	var txid, encoded string
+	f.mock.ExpectQuery("INSERT INTO bitcoin_transactions").
+		WithArgs(capture{&txid}, capture{&encoded}, int64(1692), int64(12), int64(141), "replacement", &parentID).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(bumpID, time.Now()))
+	f.mock.ExpectExec("INSERT INTO bitcoin_utxos").
+		WithArgs(pgxmock.AnyArg(), changeIndex, int64(500000-100000-1692),
+			"bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el", pgxmock.AnyArg(), "m/84'/0'/0'/1/0").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	f.mock.ExpectCommit()
+
+	if err := bumper.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	replacement, err := psbt.NewFromRawBytes(strings.NewReader(encoded), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replacement.UnsignedTx.TxIn[0].PreviousOutPoint != packet.UnsignedTx.TxIn[0].PreviousOutPoint {
+		t.Error("replacement does not spend the stuck transaction's input")
+	}
+	if len(replacement.Inputs[0].Bip32Derivation) != 1 || len(replacement.Outputs[changeIndex].Bip32Derivation) != 1 {
+		t.Error("replacement PSBT is missing derivations for the signers")
+	}
+
+	locked := func(status string) {
+		f.mock.ExpectQuery("FROM bitcoin_transactions").
+			WithArgs(bumpID).
+			WillReturnRows(pgxmock.NewRows([]string{"txid", "psbt", "fee_sats", "fee_rate", "vsize", "status", "kind", "parent_id", "broadcast_at", "created_at"}).
+				AddRow(txid, encoded, int64(1692), int64(12), int64(141), status, "replacement", &parentID, (*time.Time)(nil), time.Now()))
+	}
+	f.mock.ExpectBegin()
+	locked("unsigned")
+	f.mock.ExpectExec("SET psbt = \\$2, status = \\$3").
+		WithArgs(bumpID, pgxmock.AnyArg(), "signed").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	f.mock.ExpectCommit()
+	f.mock.ExpectBegin()
+	locked("signed")
+	broadcastAt := time.Now()
+	f.mock.ExpectQuery("SET status = 'broadcast'").
+		WithArgs(bumpID, f.node.height).
+		WillReturnRows(pgxmock.NewRows([]string{"broadcast_at"}).AddRow(&broadcastAt))
+	f.mock.ExpectQuery("FROM withdrawals").
+		WithArgs(parentID).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "bitcoin_output_index"}).AddRow(withdrawalID, int64(1-changeIndex)))
+	f.mock.ExpectExec("INSERT INTO withdrawal_txids").
+		WithArgs(withdrawalID, txid, bumpID, int64(1692)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	f.mock.ExpectExec("SET status = CASE").
+		WithArgs(parentID, bumpID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+	f.mock.ExpectExec("WITH evicted AS").
+		WithArgs(parentID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	f.mock.ExpectExec("WITH inputs AS").
+		WithArgs(parentID, bumpID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	f.mock.ExpectExec("UPDATE withdrawals w").
+		WithArgs(parentID, bumpID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	f.mock.ExpectCommit()
+
+	got, err := f.builder.SubmitSignatures(context.Background(), bumpID, f.sign(t, encoded, 0, 0))
+	if err != nil {
+		t.Fatalf("SubmitSignatures() error = %v", err)
+	}
+	if got.Status != "broadcast" || len(f.node.broadcast) != 1 {
+		t.Errorf("status = %s after %d broadcasts, want broadcast once", got.Status, len(f.node.broadcast))
+	}
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,217 @@
+// BitCurrent Exchange - Withdrawal Holds
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/holds"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnsupportedCurrency = errors.New("currency cannot be withdrawn")
+	ErrAddressRequired     = errors.New("address is required for crypto withdrawals")
+	ErrInsufficientBalance = errors.New("insufficient withdrawable balance")
+)
+
+// WithdrawalRequest is a customer's request to withdraw Amount. GBP is
+// paid to the account's verified bank account and needs no address.
+type WithdrawalRequest struct {
+	AccountID uuid.UUID
+	Currency  string
+	Amount    decimal.Decimal
+	Address   string
+}
+
+// RequestedWithdrawal is a withdrawal with its funds held
+type RequestedWithdrawal struct {
+	ID         uuid.UUID       `json:"id"`
+	AccountID  uuid.UUID       `json:"account_id"`
+	Currency   string          `json:"currency"`
+	Amount     decimal.Decimal `json:"amount"`
+	Fee        decimal.Decimal `json:"fee"`
+	HeldAmount decimal.Decimal `json:"held_amount"`
+	Address    string          `json:"address,omitempty"`
+	Network    string          `json:"network,omitempty"`
+	Status     string          `json:"status"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// Requests creates withdrawals, holding the amount plus fee from the
+// account's withdrawable balance until the withdrawal completes or fails
+type Requests struct {
+	db     *database.PostgresDB
+	fees   map[string]decimal.Decimal
+	logger *zap.Logger
+}
+
+// NewRequests creates the withdrawal request intake. fees is the flat fee
+// charged per withdrawal by currency; currencies not listed are free.
+func NewRequests(db *database.PostgresDB, fees map[string]decimal.Decimal, logger *zap.Logger) *Requests {
+	normalised := make(map[string]decimal.Decimal, len(fees))
+	for currency, fee := range fees {
+		normalised[strings.ToUpper(currency)] = fee
+	}
+	return &Requests{
+		db:     db,
+		fees:   normalised,
+		logger: logger,
+	}
+}
+
+// Fee returns the fee charged for withdrawing currency
+func (r *Requests) Fee(currency string) decimal.Decimal {
+	if fee, ok := r.fees[strings.ToUpper(currency)]; ok {
+		return fee
+	}
+	return decimal.Zero
+}
+
+// Request records a pending withdrawal and places a balance hold for its
+// amount plus fee, moving it from the account's available to its reserved
+// balance. Credited deposits short of their withdraw confirmations cannot
+// be withdrawn.
+func (r *Requests) Request(ctx context.Context, req WithdrawalRequest) (*RequestedWithdrawal, error) {
+	w := &RequestedWithdrawal{
+		AccountID: req.AccountID,
+		Currency:  strings.ToUpper(req.Currency),
+		Amount:    req.Amount,
+		Address:   req.Address,
+		Status:    "pending",
+	}
+	if w.Currency != "GBP" {
+		chain, err := wallet.ChainForCurrency(w.Currency)
+		if err != nil {
+			return nil, ErrUnsupportedCurrency
+		}
+		if w.Address == "" {
+			return nil, ErrAddressRequired
+		}
+		w.Network = chain
+	}
+	w.Fee = r.Fee(w.Currency)
+	w.HeldAmount = w.Amount.Add(w.Fee)
+
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var withdrawable decimal.Decimal
+		err := tx.QueryRow(ctx, `
+			SELECT available_balance - COALESCE((
+				SELECT SUM(amount) FROM deposits
+				WHERE account_id = $1 AND currency = $2
+				  AND status = 'credited' AND withdrawable_at IS NULL
+			), 0)
+			FROM wallets
+			WHERE account_id = $1 AND currency = $2
+			FOR UPDATE
+		`, w.AccountID, w.Currency).Scan(&withdrawable)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInsufficientBalance
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock wallet: %w", err)
+		}
+		if withdrawable.LessThan(w.HeldAmount) {
+			return ErrInsufficientBalance
+		}
+
+		if err := tx.QueryRow(ctx, `
+			INSERT INTO withdrawals (account_id, currency, amount, fee, address, network, status)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), 'pending')
+			RETURNING id, created_at
+		`, w.AccountID, w.Currency, w.Amount, w.Fee, w.Address, w.Network).Scan(&w.ID, &w.CreatedAt); err != nil {
+			return fmt.Errorf("failed to create withdrawal: %w", err)
+		}
+
+		_, _, err = holds.Place(ctx, tx, w.AccountID, w.Currency, w.HeldAmount, holds.ReferenceWithdrawal, w.ID)
+		if errors.Is(err, holds.ErrInsufficientBalance) || errors.Is(err, holds.ErrWalletNotFound) {
+			return ErrInsufficientBalance
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.logger.Info("Withdrawal requested",
+		zap.String("withdrawal_id", w.ID.String()),
+		zap.String("account_id", w.AccountID.String()),
+		zap.String("currency", w.Currency),
+		zap.String("held", w.HeldAmount.String()),
+	)
+	return w, nil
+}
+
+// lockHold locks a withdrawal's active balance hold, returning nil if its
+// hold is closed or it never had one
+func lockHold(ctx context.Context, tx pgx.Tx, withdrawalID uuid.UUID) (*holds.Hold, error) {
+	hold, err := holds.Get(ctx, tx, holds.ReferenceWithdrawal, withdrawalID)
+	if errors.Is(err, holds.ErrHoldNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status != holds.StatusActive {
+		return nil, nil
+	}
+	return hold, nil
+}
+
+// DebitWithdrawalHold pays a completed withdrawal out of its hold: the
+// amount leaves custody and the fee goes to the fee account, and the hold
+// is closed. It runs in the transaction that completes the withdrawal; a
+// withdrawal without an active hold debits nothing.
+func DebitWithdrawalHold(ctx context.Context, tx pgx.Tx, withdrawalID uuid.UUID) error {
+	hold, err := lockHold(ctx, tx, withdrawalID)
+	if err != nil || hold == nil {
+		return err
+	}
+
+	var amount, fee decimal.Decimal
+	if err := tx.QueryRow(ctx, `
+		SELECT amount, fee FROM withdrawals WHERE id = $1
+	`, withdrawalID).Scan(&amount, &fee); err != nil {
+		return fmt.Errorf("failed to load withdrawal: %w", err)
+	}
+
+	// A withdrawal without a fee posts no fee entry
+	referenceType := holds.ReferenceWithdrawal
+	if _, err := journal.Post(ctx, tx, &journal.Journal{
+		Type:          journal.TypeWithdrawal,
+		ReferenceType: &referenceType,
+		ReferenceID:   &withdrawalID,
+		Description:   "Withdrawal completed",
+		Postings: journal.NonZero(
+			journal.Posting{AccountID: hold.AccountID, Currency: hold.Currency, Amount: amount.Add(fee).Neg(), EntryType: journal.TypeWithdrawal, Hold: hold},
+			journal.Posting{AccountID: journal.CustodyAccount(hold.Currency), Currency: hold.Currency, Amount: amount, EntryType: journal.TypeWithdrawal},
+			journal.Posting{AccountID: journal.FeeAccountID, Currency: hold.Currency, Amount: fee, EntryType: journal.TypeFee},
+		),
+	}); err != nil {
+		return err
+	}
+
+	// Closes the hold, returning anything it held beyond the amount and fee
+	_, _, err = holds.ReleaseLocked(ctx, tx, hold)
+	return err
+}
+
+// releaseWithdrawalHold returns what is left of a withdrawal's balance hold
+// to available balance and closes it. A withdrawal without an active hold
+// releases nothing.
+func releaseWithdrawalHold(ctx context.Context, tx pgx.Tx, withdrawalID uuid.UUID) (decimal.Decimal, error) {
+	_, released, err := holds.Release(ctx, tx, holds.ReferenceWithdrawal, withdrawalID)
+	if errors.Is(err, holds.ErrHoldNotFound) {
+		return decimal.Zero, nil
+	}
+	return released, err
+}
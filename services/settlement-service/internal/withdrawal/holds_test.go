@@ -0,0 +1,289 @@
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/holds"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+// amountArg matches a decimal argument by value rather than representation
+type amountArg struct{ decimal.Decimal }
+
+func (a amountArg) Match(v interface{}) bool {
+	d, ok := v.(decimal.Decimal)
+	return ok && d.Equal(a.Decimal)
+}
+
+var holdColumns = []string{
+	"id", "account_id", "currency", "amount", "consumed", "released",
+	"reference_type", "reference_id", "status", "created_at", "closed_at",
+}
+
+func withdrawalHold(withdrawalID, accountID uuid.UUID, currency, held string) *holds.Hold {
+	return &holds.Hold{
+		ID:            uuid.New(),
+		AccountID:     accountID,
+		Currency:      currency,
+		Amount:        decimal.RequireFromString(held),
+		ReferenceType: holds.ReferenceWithdrawal,
+		ReferenceID:   withdrawalID,
+		Status:        holds.StatusActive,
+		CreatedAt:     time.Now(),
+	}
+}
+
+func holdRows(h *holds.Hold) *pgxmock.Rows {
+	return pgxmock.NewRows(holdColumns).AddRow(
+		h.ID, h.AccountID, h.Currency, h.Amount, h.Consumed, h.Released,
+		h.ReferenceType, h.ReferenceID, h.Status, h.CreatedAt, h.ClosedAt,
+	)
+}
+
+// expectJournal expects postings booked as one journal, each wallet
+// holding just enough to cover the debits its hold does not
+func expectJournal(mock pgxmock.PgxPoolIface, journalType, referenceType string, referenceID uuid.UUID, description string, postings ...journal.Posting) {
+	postings = journal.NonZero(postings...)
+	type wallet struct {
+		accountID uuid.UUID
+		currency  string
+	}
+	needed := make(map[wallet]decimal.Decimal)
+	covered := make([]decimal.Decimal, len(postings))
+	var wallets []wallet
+	for i, p := range postings {
+		w := wallet{p.AccountID, p.Currency}
+		if _, ok := needed[w]; !ok {
+			wallets = append(wallets, w)
+			needed[w] = decimal.Zero
+		}
+		if p.Amount.IsNegative() {
+			covered[i] = p.Hold.Covers(p.AccountID, p.Currency, p.Amount.Neg())
+			needed[w] = needed[w].Sub(p.Amount).Sub(covered[i])
+		}
+	}
+	sort.SliceStable(wallets, func(i, j int) bool {
+		return wallets[i].accountID.String() < wallets[j].accountID.String()
+	})
+	for _, w := range wallets {
+		walletType := "hot"
+		if w.currency == "GBP" {
+			walletType = "fiat"
+		}
+		mock.ExpectQuery("INSERT INTO wallets").
+			WithArgs(w.accountID, w.currency, walletType, journal.FeeAccountID).
+			WillReturnRows(pgxmock.NewRows([]string{"available_balance", "allow_negative"}).AddRow(needed[w], false))
+	}
+
+	journalID := uuid.New()
+	mock.ExpectQuery("INSERT INTO journals").
+		WithArgs(journalType, &referenceID, &referenceType, description).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(journalID))
+	for i, p := range postings {
+		if covered[i].IsPositive() {
+			mock.ExpectExec("UPDATE balance_holds SET consumed").
+				WithArgs(amountArg{covered[i]}, p.Hold.ID).
+				WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		}
+		mock.ExpectQuery("UPDATE wallets").
+			WithArgs(p.Amount, amountArg{covered[i]}, p.AccountID, p.Currency).
+			WillReturnRows(pgxmock.NewRows([]string{"balance"}).AddRow(p.Amount))
+		mock.ExpectQuery("INSERT INTO ledger_entries").
+			WithArgs(journalID, p.AccountID, p.Currency, p.Amount, p.Amount, p.EntryType, &referenceID, &referenceType, description).
+			WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	}
+}
+
+// expectWithdrawalJournal expects a withdrawal journal posting postings
+func expectWithdrawalJournal(mock pgxmock.PgxPoolIface, withdrawalID uuid.UUID, description string, postings ...journal.Posting) {
+	expectJournal(mock, "withdrawal", "withdrawal", withdrawalID, description, postings...)
+}
+
+// expectNoHold expects a withdrawal without a balance hold
+func expectNoHold(mock pgxmock.PgxPoolIface, withdrawalID uuid.UUID) {
+	mock.ExpectQuery("FROM balance_holds").
+		WithArgs(holds.ReferenceWithdrawal, withdrawalID).
+		WillReturnRows(pgxmock.NewRows(holdColumns))
+}
+
+// expectHoldReturned expects a withdrawal's hold of held to be released
+// back to accountID's available balance
+func expectHoldReturned(mock pgxmock.PgxPoolIface, withdrawalID, accountID uuid.UUID, currency, held string) {
+	hold := withdrawalHold(withdrawalID, accountID, currency, held)
+	mock.ExpectQuery("FROM balance_holds").
+		WithArgs(holds.ReferenceWithdrawal, withdrawalID).
+		WillReturnRows(holdRows(hold))
+	expectHoldClosed(mock, hold, hold.Remaining())
+}
+
+// expectHoldClosed expects hold to be closed, releasing released
+func expectHoldClosed(mock pgxmock.PgxPoolIface, hold *holds.Hold, released decimal.Decimal) {
+	if released.IsPositive() {
+		mock.ExpectExec("SET reserved_balance = reserved_balance - \\$1").
+			WithArgs(amountArg{released}, hold.AccountID, hold.Currency).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	}
+	closed := *hold
+	closed.Released = closed.Released.Add(released)
+	closed.Status = holds.StatusClosed
+	mock.ExpectQuery("UPDATE balance_holds").
+		WithArgs(amountArg{released}, hold.ID).
+		WillReturnRows(holdRows(&closed))
+}
+
+func newTestRequests(t *testing.T) (*Requests, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+	fees := map[string]decimal.Decimal{"btc": decimal.RequireFromString("0.0001")}
+	return NewRequests(database.New(mock, zap.NewNop()), fees, zap.NewNop()), mock
+}
+
+// A request reserves the amount plus fee in a hold referencing the
+// withdrawal
+func TestRequestHoldsAmountPlusFee(t *testing.T) {
+	requests, mock := newTestRequests(t)
+	accountID, withdrawalID := uuid.New(), uuid.New()
+	amount, held := decimal.RequireFromString("0.5"), decimal.RequireFromString("0.5001")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM wallets").
+		WithArgs(accountID, "BTC").
+		WillReturnRows(pgxmock.NewRows([]string{"withdrawable"}).AddRow(decimal.RequireFromString("1")))
+	mock.ExpectQuery("INSERT INTO withdrawals").
+		WithArgs(accountID, "BTC", amount, decimal.RequireFromString("0.0001"), "bc1qdestination", "bitcoin").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(withdrawalID, time.Now()))
+	mock.ExpectQuery("SELECT available_balance").
+		WithArgs(accountID, "BTC").
+		WillReturnRows(pgxmock.NewRows([]string{"available_balance"}).AddRow(decimal.RequireFromString("1")))
+	expectNoHold(mock, withdrawalID)
+	mock.ExpectExec("SET available_balance = available_balance - \\$1").
+		WithArgs(amountArg{held}, accountID, "BTC").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery("INSERT INTO balance_holds").
+		WithArgs(accountID, "BTC", amountArg{held}, holds.ReferenceWithdrawal, withdrawalID).
+		WillReturnRows(holdRows(withdrawalHold(withdrawalID, accountID, "BTC", "0.5001")))
+	mock.ExpectCommit()
+
+	w, err := requests.Request(context.Background(), WithdrawalRequest{
+		AccountID: accountID,
+		Currency:  "btc",
+		Amount:    amount,
+		Address:   "bc1qdestination",
+	})
+	if err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	if w.ID != withdrawalID || !w.HeldAmount.Equal(held) || w.Status != "pending" {
+		t.Errorf("Request() = %+v", w)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequestRefusesUnfundedOrInvalid(t *testing.T) {
+	requests, mock := newTestRequests(t)
+	accountID := uuid.New()
+
+	// 0.5 plus the 0.0001 fee is more than is withdrawable
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM wallets").
+		WithArgs(accountID, "BTC").
+		WillReturnRows(pgxmock.NewRows([]string{"withdrawable"}).AddRow(decimal.RequireFromString("0.5")))
+	mock.ExpectRollback()
+
+	tests := []struct {
+		req  WithdrawalRequest
+		want error
+	}{
+		{WithdrawalRequest{AccountID: accountID, Currency: "BTC", Amount: decimal.RequireFromString("0.5"), Address: "bc1q"}, ErrInsufficientBalance},
+		{WithdrawalRequest{AccountID: accountID, Currency: "DOGE", Amount: decimal.RequireFromString("1"), Address: "D8"}, ErrUnsupportedCurrency},
+		{WithdrawalRequest{AccountID: accountID, Currency: "ETH", Amount: decimal.RequireFromString("1")}, ErrAddressRequired},
+	}
+	for _, tt := range tests {
+		if _, err := requests.Request(context.Background(), tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("Request(%s) error = %v, want %v", tt.req.Currency, err, tt.want)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Completion consumes the hold, paying the amount out of custody and the fee
+// to the fee account, and closes it
+func TestDebitWithdrawalHold(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	db := database.New(mock, zap.NewNop())
+
+	tests := []struct {
+		currency string
+		custody  uuid.UUID
+		amount   string
+		fee      string
+	}{
+		{"BTC", journal.HotWalletAccountID, "0.5", "0.0001"},
+		{"GBP", journal.SafeguardingAccountID, "250", "1.5"},
+		{"GBP", journal.SafeguardingAccountID, "100", "0"},
+	}
+	for _, tt := range tests {
+		withdrawalID, accountID := uuid.New(), uuid.New()
+		amount, fee := decimal.RequireFromString(tt.amount), decimal.RequireFromString(tt.fee)
+		held := amount.Add(fee)
+		hold := withdrawalHold(withdrawalID, accountID, tt.currency, held.String())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("FROM balance_holds").
+			WithArgs(holds.ReferenceWithdrawal, withdrawalID).
+			WillReturnRows(holdRows(hold))
+		mock.ExpectQuery("SELECT amount, fee FROM withdrawals").
+			WithArgs(withdrawalID).
+			WillReturnRows(pgxmock.NewRows([]string{"amount", "fee"}).AddRow(amount, fee))
+		expectWithdrawalJournal(mock, withdrawalID, "Withdrawal completed",
+			journal.Posting{AccountID: accountID, Currency: tt.currency, Amount: held.Neg(), EntryType: "withdrawal", Hold: hold},
+			journal.Posting{AccountID: tt.custody, Currency: tt.currency, Amount: amount, EntryType: "withdrawal"},
+			journal.Posting{AccountID: journal.FeeAccountID, Currency: tt.currency, Amount: fee, EntryType: "fee"},
+		)
+		expectHoldClosed(mock, hold, decimal.Zero)
+		mock.ExpectCommit()
+
+		if err := db.WithTx(context.Background(), func(tx pgx.Tx) error {
+			return DebitWithdrawalHold(context.Background(), tx, withdrawalID)
+		}); err != nil {
+			t.Fatalf("DebitWithdrawalHold(%s) error = %v", tt.currency, err)
+		}
+	}
+
+	// Withdrawals requested before holds debit nothing
+	legacy := uuid.New()
+	mock.ExpectBegin()
+	expectNoHold(mock, legacy)
+	mock.ExpectCommit()
+	if err := db.WithTx(context.Background(), func(tx pgx.Tx) error {
+		return DebitWithdrawalHold(context.Background(), tx, legacy)
+	}); err != nil {
+		t.Fatalf("DebitWithdrawalHold(legacy) error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
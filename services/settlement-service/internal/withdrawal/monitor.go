@@ -0,0 +1,678 @@
+// BitCurrent Exchange - Withdrawal Monitor
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// MonitorConfig controls how often processing withdrawals are checked and
+// how long a transaction may go unseen before it is treated as dropped
+type MonitorConfig struct {
+	Interval  time.Duration
+	DropAfter time.Duration
+}
+
+// DefaultMonitorConfig returns the monitor defaults
+func DefaultMonitorConfig() MonitorConfig {
+	return MonitorConfig{
+		Interval:  time.Minute,
+		DropAfter: time.Hour,
+	}
+}
+
+// PaymentStatusSource reports the status of an outbound bank payment
+type PaymentStatusSource interface {
+	GetPaymentStatus(ctx context.Context, paymentID string) (string, error)
+}
+
+// Monitor follows processing withdrawals until they complete or fail.
+// Crypto withdrawals complete once their transaction reaches the
+// confirmations a deposit of the same size needs before it is credited;
+// GBP withdrawals complete when the bank reports the payment processed.
+type Monitor struct {
+	db        *database.PostgresDB
+	btcClient *blockchain.BitcoinClient
+	ethClient *blockchain.EthereumClient
+	bank      PaymentStatusSource
+	policy    *blockchain.ConfirmationPolicy
+	config    MonitorConfig
+	logger    *zap.Logger
+}
+
+// NewMonitor creates a withdrawal monitor. Any of the chain clients and
+// bank may be nil, leaving those withdrawals in processing.
+func NewMonitor(
+	db *database.PostgresDB,
+	btcClient *blockchain.BitcoinClient,
+	ethClient *blockchain.EthereumClient,
+	bank PaymentStatusSource,
+	policy *blockchain.ConfirmationPolicy,
+	cfg MonitorConfig,
+	logger *zap.Logger,
+) *Monitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultMonitorConfig().Interval
+	}
+	if cfg.DropAfter <= 0 {
+		cfg.DropAfter = DefaultMonitorConfig().DropAfter
+	}
+	return &Monitor{
+		db:        db,
+		btcClient: btcClient,
+		ethClient: ethClient,
+		bank:      bank,
+		policy:    policy,
+		config:    cfg,
+		logger:    logger,
+	}
+}
+
+// Start runs monitor passes until ctx is cancelled
+func (m *Monitor) Start(ctx context.Context) error {
+	m.logger.Info("Starting withdrawal monitor", zap.Duration("interval", m.config.Interval))
+
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.logger.Info("Withdrawal monitor stopped")
+			return ctx.Err()
+
+		case <-ticker.C:
+			if err := m.RunOnce(ctx); err != nil {
+				m.logger.Error("Withdrawal monitoring failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+type processingWithdrawal struct {
+	ID            uuid.UUID
+	Currency      string
+	Amount        decimal.Decimal
+	TxID          string
+	Confirmations int
+	LastSeen      time.Time
+	// BitcoinTxID is set for Bitcoin withdrawals built as PSBTs, which may
+	// share their transaction with others in a batch
+	BitcoinTxID *uuid.UUID
+}
+
+// onEthereum reports whether the withdrawal is paid on Ethereum
+func (w processingWithdrawal) onEthereum() bool {
+	chain, err := wallet.ChainForCurrency(w.Currency)
+	return err == nil && chain == wallet.ChainEthereum
+}
+
+// txStatus is what the chain or bank reports for a withdrawal
+type txStatus struct {
+	// Seen is set while the transaction is in the mempool or a block, or
+	// the bank payment is in progress
+	Seen          bool
+	Confirmations int
+	BlockHash     string
+	Completed     bool
+	// Failure is set when the transaction can never complete
+	Failure string
+}
+
+// RunOnce checks every processing withdrawal once
+func (m *Monitor) RunOnce(ctx context.Context) error {
+	query := `
+		SELECT id, currency, amount, txid, confirmations,
+		       COALESCE(last_seen_at, processed_at, created_at), bitcoin_transaction_id
+		FROM withdrawals
+		WHERE status = 'processing' AND txid IS NOT NULL
+		ORDER BY processed_at
+		LIMIT 500
+	`
+
+	rows, err := m.db.Pool.Query(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to query processing withdrawals: %w", err)
+	}
+
+	var withdrawals []processingWithdrawal
+	for rows.Next() {
+		var w processingWithdrawal
+		if err := rows.Scan(&w.ID, &w.Currency, &w.Amount, &w.TxID, &w.Confirmations, &w.LastSeen, &w.BitcoinTxID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan withdrawal: %w", err)
+		}
+		withdrawals = append(withdrawals, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, w := range withdrawals {
+		if err := m.check(ctx, w); err != nil {
+			m.logger.Error("Failed to check withdrawal",
+				zap.String("withdrawal_id", w.ID.String()),
+				zap.String("txid", w.TxID),
+				zap.Error(err),
+			)
+		}
+	}
+	return nil
+}
+
+func (m *Monitor) check(ctx context.Context, w processingWithdrawal) error {
+	if w.Currency == "GBP" {
+		if m.bank == nil {
+			return nil
+		}
+		st, err := m.checkBankPayment(ctx, w)
+		if err != nil {
+			return err
+		}
+		return m.apply(ctx, w, st, 0)
+	}
+
+	chain, err := wallet.ChainForCurrency(w.Currency)
+	if err != nil {
+		return err
+	}
+	required, err := m.policy.Resolve(w.Currency, chain, w.Amount)
+	if err != nil {
+		return err
+	}
+
+	var st txStatus
+	switch chain {
+	case wallet.ChainBitcoin:
+		if m.btcClient == nil {
+			return nil
+		}
+		st, err = m.checkBitcoinTx(w)
+		if err == nil && !st.Seen && w.BitcoinTxID != nil {
+			st, err = m.followReplaced(ctx, &w, st)
+		}
+	case wallet.ChainEthereum:
+		if m.ethClient == nil {
+			return nil
+		}
+		st, err = m.checkEthereumTx(ctx, &w)
+	}
+	if err != nil {
+		return err
+	}
+
+	st.Completed = st.Seen && st.Confirmations >= required.Credit
+	return m.apply(ctx, w, st, required.Credit)
+}
+
+func (m *Monitor) apply(ctx context.Context, w processingWithdrawal, st txStatus, required int) error {
+	switch {
+	case st.Failure != "":
+		return m.fail(ctx, w, st.Failure, st.Seen)
+
+	case st.Completed:
+		return m.complete(ctx, w, st, required)
+
+	case st.Seen:
+		_, err := m.db.Pool.Exec(ctx, `
+			UPDATE withdrawals
+			SET confirmations = $2,
+			    required_confirmations = NULLIF($3, 0),
+			    block_hash = NULLIF($4, ''),
+			    last_seen_at = NOW(),
+			    updated_at = NOW()
+			WHERE id = $1 AND status = 'processing'
+		`, w.ID, st.Confirmations, required, st.BlockHash)
+		return err
+	}
+
+	if time.Since(w.LastSeen) < m.config.DropAfter {
+		return nil
+	}
+	if w.Currency != "GBP" {
+		if err := m.abandon(ctx, w); err != nil {
+			return fmt.Errorf("failed to abandon dropped transaction: %w", err)
+		}
+	}
+	return m.fail(ctx, w, "transaction dropped from mempool", false)
+}
+
+func (m *Monitor) complete(ctx context.Context, w processingWithdrawal, st txStatus, required int) error {
+	completed := false
+	err := m.db.WithTx(ctx, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `
+			UPDATE withdrawals
+			SET status = 'completed',
+			    confirmations = $2,
+			    required_confirmations = NULLIF($3, 0),
+			    block_hash = NULLIF($4, ''),
+			    last_seen_at = NOW(),
+			    completed_at = NOW(),
+			    updated_at = NOW()
+			WHERE id = $1 AND status = 'processing'
+		`, w.ID, st.Confirmations, required, st.BlockHash)
+		if err != nil || result.RowsAffected() == 0 {
+			return err
+		}
+		completed = true
+		if err := DebitWithdrawalHold(ctx, tx, w.ID); err != nil {
+			return err
+		}
+		if w.onEthereum() {
+			return confirmEthereumNonce(ctx, tx, w.ID)
+		}
+		if w.BitcoinTxID == nil {
+			return nil
+		}
+		return confirmBitcoinTransaction(ctx, tx, *w.BitcoinTxID)
+	})
+	if err != nil {
+		return err
+	}
+
+	if completed {
+		m.logger.Info("Withdrawal completed",
+			zap.String("withdrawal_id", w.ID.String()),
+			zap.String("txid", w.TxID),
+			zap.Int("confirmations", st.Confirmations),
+		)
+	}
+	return nil
+}
+
+// fail fails a withdrawal and releases its hold. Every withdrawal paid by
+// the same Bitcoin transaction fails with it, in one database transaction.
+// An Ethereum transaction's nonce is used up if it was mined, and released
+// for reuse if not.
+func (m *Monitor) fail(ctx context.Context, w processingWithdrawal, reason string, mined bool) error {
+	var released decimal.Decimal
+	batch := []uuid.UUID{w.ID}
+	err := m.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if w.BitcoinTxID != nil {
+			var err error
+			if batch, err = batchWithdrawals(ctx, tx, *w.BitcoinTxID); err != nil {
+				return err
+			}
+		}
+
+		for _, id := range batch {
+			failed, err := failWithdrawal(ctx, tx, id, reason)
+			if err != nil {
+				return err
+			}
+			if !failed {
+				continue
+			}
+			amount, err := releaseWithdrawalHold(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if id == w.ID {
+				released = amount
+			}
+		}
+
+		if w.onEthereum() {
+			if mined {
+				return confirmEthereumNonce(ctx, tx, w.ID)
+			}
+			return releaseEthereumNonce(ctx, tx, w.ID)
+		}
+		if w.BitcoinTxID == nil {
+			return nil
+		}
+		return releaseBitcoinTransaction(ctx, tx, *w.BitcoinTxID)
+	})
+	if err != nil {
+		return err
+	}
+
+	m.logger.Warn("Withdrawal failed",
+		zap.String("withdrawal_id", w.ID.String()),
+		zap.String("txid", w.TxID),
+		zap.String("reason", reason),
+		zap.String("released", released.String()),
+		zap.Int("batch_size", len(batch)),
+	)
+	return nil
+}
+
+// batchWithdrawals locks the processing withdrawals paid by a Bitcoin
+// transaction
+func batchWithdrawals(ctx context.Context, tx pgx.Tx, bitcoinTxID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT id FROM withdrawals
+		WHERE bitcoin_transaction_id = $1 AND status = 'processing'
+		ORDER BY id
+		FOR UPDATE
+	`, bitcoinTxID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock batch withdrawals: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// checkBitcoinTx looks the withdrawal up in the node's wallet, which sent
+// it. A negative confirmation count means a conflicting transaction was
+// mined instead. Withdrawals signed from PSBTs are not wallet transactions
+// and are looked up by txid.
+func (m *Monitor) checkBitcoinTx(w processingWithdrawal) (txStatus, error) {
+	tx, err := m.btcClient.GetWalletTransaction(w.TxID)
+	if errors.Is(err, blockchain.ErrTransactionNotFound) {
+		return m.checkRawBitcoinTx(w)
+	}
+	if err != nil {
+		return txStatus{}, err
+	}
+
+	switch {
+	case tx != nil && tx.Confirmations < 0:
+		return txStatus{Failure: "transaction conflicted with one in the active chain"}, nil
+	case tx != nil && tx.Confirmations > 0:
+		return txStatus{Seen: true, Confirmations: int(tx.Confirmations), BlockHash: tx.BlockHash}, nil
+	}
+
+	inMempool, err := m.btcClient.InMempool(w.TxID)
+	if err != nil {
+		return txStatus{}, err
+	}
+	return txStatus{Seen: inMempool}, nil
+}
+
+// followReplaced handles a fee-bumped withdrawal whose transaction the node
+// no longer has. If a transaction it replaced was mined, or is back in the
+// mempool, the withdrawal and its batch follow that one instead.
+func (m *Monitor) followReplaced(ctx context.Context, w *processingWithdrawal, st txStatus) (txStatus, error) {
+	rows, err := m.db.Pool.Query(ctx, `
+		SELECT t.id, t.txid
+		FROM withdrawal_txids wt
+		JOIN bitcoin_transactions t ON t.id = wt.bitcoin_transaction_id
+		WHERE wt.withdrawal_id = $1 AND t.status = 'replaced'
+		ORDER BY wt.created_at DESC
+	`, w.ID)
+	if err != nil {
+		return st, fmt.Errorf("failed to query replaced transactions: %w", err)
+	}
+	type replaced struct {
+		ID   uuid.UUID
+		TxID string
+	}
+	var candidates []replaced
+	for rows.Next() {
+		var r replaced
+		if err := rows.Scan(&r.ID, &r.TxID); err != nil {
+			rows.Close()
+			return st, err
+		}
+		candidates = append(candidates, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return st, err
+	}
+
+	for _, r := range candidates {
+		tx, err := m.btcClient.GetRawTransaction(r.TxID)
+		if errors.Is(err, blockchain.ErrTransactionNotFound) {
+			continue
+		}
+		if err != nil {
+			return st, err
+		}
+
+		if err := m.db.WithTx(ctx, func(tx pgx.Tx) error {
+			return supersede(ctx, tx, *w.BitcoinTxID, r.ID)
+		}); err != nil {
+			return st, err
+		}
+		m.logger.Warn("Replaced Bitcoin transaction mined instead of its replacement",
+			zap.String("withdrawal_id", w.ID.String()),
+			zap.String("replacement_txid", w.TxID),
+			zap.String("txid", r.TxID),
+		)
+		w.TxID, w.BitcoinTxID = r.TxID, &r.ID
+		return txStatus{Seen: true, Confirmations: int(tx.Confirmations), BlockHash: tx.BlockHash}, nil
+	}
+	return st, nil
+}
+
+// checkRawBitcoinTx finds a transaction in the mempool or a block. One
+// that is in neither has been dropped or double-spent and is left to the
+// DropAfter timeout.
+func (m *Monitor) checkRawBitcoinTx(w processingWithdrawal) (txStatus, error) {
+	tx, err := m.btcClient.GetRawTransaction(w.TxID)
+	if errors.Is(err, blockchain.ErrTransactionNotFound) {
+		return txStatus{}, nil
+	}
+	if err != nil {
+		return txStatus{}, err
+	}
+	return txStatus{Seen: true, Confirmations: int(tx.Confirmations), BlockHash: tx.BlockHash}, nil
+}
+
+// checkEthereumTx reads the transaction receipt. A mined transaction with
+// status 0 was reverted and can never complete. A transaction replaced at
+// its nonce may be mined in place of the replacement, so while the current
+// hash has no receipt the earlier ones are checked too.
+func (m *Monitor) checkEthereumTx(ctx context.Context, w *processingWithdrawal) (txStatus, error) {
+	receipt, err := m.ethClient.GetTransactionReceipt(ctx, w.TxID)
+	if err != nil {
+		return txStatus{}, err
+	}
+	if receipt == nil {
+		if receipt, err = m.followReplacedEthereum(ctx, w); err != nil || receipt == nil {
+			// Not mined; the transaction is either pending or dropped
+			return txStatus{}, err
+		}
+	}
+
+	if receipt.Status == 0 {
+		return txStatus{Seen: true, Failure: "transaction reverted"}, nil
+	}
+
+	tip, err := m.ethClient.BlockNumber(ctx)
+	if err != nil {
+		return txStatus{}, err
+	}
+	return txStatus{Seen: true, Confirmations: receipt.Confirmations(tip), BlockHash: receipt.BlockHash}, nil
+}
+
+// followReplacedEthereum looks for a receipt of any hash the withdrawal's
+// transaction had before it was replaced, and moves the withdrawal to the
+// one that was mined
+func (m *Monitor) followReplacedEthereum(ctx context.Context, w *processingWithdrawal) (*blockchain.Receipt, error) {
+	var previous []string
+	err := m.db.Pool.QueryRow(ctx, `
+		SELECT previous_txids FROM ethereum_nonces
+		WHERE withdrawal_id = $1 AND status = 'broadcast'
+	`, w.ID).Scan(&previous)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load replaced transactions: %w", err)
+	}
+
+	for _, txid := range previous {
+		receipt, err := m.ethClient.GetTransactionReceipt(ctx, txid)
+		if err != nil {
+			return nil, err
+		}
+		if receipt == nil {
+			continue
+		}
+
+		err = m.db.WithTx(ctx, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, `
+				UPDATE ethereum_nonces
+				SET txid = $2, previous_txids = array_append(array_remove(previous_txids, $2), txid),
+				    updated_at = NOW()
+				WHERE withdrawal_id = $1 AND status = 'broadcast'
+			`, w.ID, txid); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, `
+				UPDATE withdrawals SET txid = $2, updated_at = NOW() WHERE id = $1 AND status = 'processing'
+			`, w.ID, txid)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to follow replaced transaction: %w", err)
+		}
+
+		m.logger.Warn("Replaced Ethereum transaction was mined instead",
+			zap.String("withdrawal_id", w.ID.String()),
+			zap.String("replacement_txid", w.TxID),
+			zap.String("txid", txid),
+		)
+		w.TxID = txid
+		return receipt, nil
+	}
+	return nil, nil
+}
+
+// checkBankPayment maps the bank's payment status. The payment reference
+// is stored as the withdrawal's txid.
+func (m *Monitor) checkBankPayment(ctx context.Context, w processingWithdrawal) (txStatus, error) {
+	status, err := m.bank.GetPaymentStatus(ctx, w.TxID)
+	if err != nil {
+		return txStatus{}, err
+	}
+
+	switch bankPaymentState(status) {
+	case "completed":
+		return txStatus{Seen: true, Completed: true}, nil
+	case "failed":
+		return txStatus{Failure: "bank payment " + strings.ToLower(status)}, nil
+	}
+	return txStatus{Seen: true}, nil
+}
+
+// bankPaymentState classifies a Modulr payment status as completed, failed
+// or pending
+func bankPaymentState(status string) string {
+	status = strings.ToUpper(status)
+	switch {
+	case status == "PROCESSED" || status == "EXT_PROCESSED":
+		return "completed"
+	case status == "CANCELLED" || status == "REJECTED" || strings.HasPrefix(status, "ER_"):
+		return "failed"
+	}
+	return "pending"
+}
+
+// abandon stops the node from rebroadcasting a dropped transaction, so it
+// cannot be mined after the withdrawal has failed. A transaction the node
+// refuses to abandon is still live and the withdrawal stays processing.
+// Ethereum nodes cannot abandon a transaction; one the node still knows is
+// live, and is left for replacement with a higher tip.
+func (m *Monitor) abandon(ctx context.Context, w processingWithdrawal) error {
+	chain, err := wallet.ChainForCurrency(w.Currency)
+	if err != nil {
+		return err
+	}
+	switch chain {
+	case wallet.ChainBitcoin:
+		err = m.btcClient.AbandonTransaction(w.TxID)
+		if errors.Is(err, blockchain.ErrTransactionNotFound) {
+			return nil
+		}
+		return err
+	case wallet.ChainEthereum:
+		known, err := m.ethClient.HasTransaction(ctx, w.TxID)
+		if err != nil {
+			return err
+		}
+		if known {
+			return errors.New("transaction is still pending")
+		}
+	}
+	return nil
+}
+
+// failWithdrawal marks a withdrawal that has not completed as failed,
+// reporting false if it had already reached a final status
+func failWithdrawal(ctx context.Context, tx pgx.Tx, withdrawalID uuid.UUID, reason string) (bool, error) {
+	result, err := tx.Exec(ctx, `
+		UPDATE withdrawals
+		SET status = 'failed',
+		    failure_reason = $1,
+		    failed_at = NOW(),
+		    updated_at = NOW()
+		WHERE id = $2 AND status IN ('pending', 'approved', 'processing')
+	`, reason, withdrawalID)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark withdrawal failed: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// confirmBitcoinTransaction marks a PSBT transaction confirmed and makes
+// its change spendable
+func confirmBitcoinTransaction(ctx context.Context, tx pgx.Tx, bitcoinTxID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		WITH confirmed AS (
+			UPDATE bitcoin_transactions
+			SET status = 'confirmed', updated_at = NOW()
+			WHERE id = $1 AND status = 'broadcast'
+			RETURNING txid
+		)
+		UPDATE bitcoin_utxos u
+		SET status = 'available', updated_at = NOW()
+		FROM confirmed c
+		WHERE u.txid = c.txid AND u.status = 'pending'
+	`, bitcoinTxID)
+	if err != nil {
+		return fmt.Errorf("failed to confirm bitcoin transaction: %w", err)
+	}
+	return nil
+}
+
+// releaseBitcoinTransaction marks a PSBT transaction that will never
+// confirm failed, with any fee bumps of it, returns their inputs to the
+// spendable set and drops their change, which will never exist
+func releaseBitcoinTransaction(ctx context.Context, tx pgx.Tx, bitcoinTxID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		WITH failed AS (
+			UPDATE bitcoin_transactions
+			SET status = 'failed', updated_at = NOW()
+			WHERE (id = $1 OR parent_id = $1) AND status IN ('unsigned', 'signed', 'broadcast')
+			RETURNING id, txid
+		), inputs AS (
+			UPDATE bitcoin_utxos u
+			SET status = 'available', spent_by = NULL, updated_at = NOW()
+			FROM failed f
+			WHERE u.spent_by = f.id AND u.status = 'spent'
+			  AND u.txid NOT IN (SELECT txid FROM failed)
+		)
+		DELETE FROM bitcoin_utxos u
+		USING failed f
+		WHERE u.txid = f.txid
+	`, bitcoinTxID)
+	if err != nil {
+		return fmt.Errorf("failed to release bitcoin transaction inputs: %w", err)
+	}
+	return nil
+}
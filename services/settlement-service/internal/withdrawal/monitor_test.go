@@ -0,0 +1,277 @@
+package withdrawal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+// walletNode answers the wallet, mempool and broadcast RPCs the monitor and
+// transaction builder use. Transactions missing from both maps are unknown
+// to the node; raw holds the confirmations of transactions outside the
+// wallet; scans holds the UTXO set scan of addresses outside it.
+type walletNode struct {
+	confirmations map[string]int64
+	mempool       map[string]bool
+	raw           map[string]int64
+	scans         map[string]blockchain.AddressScan
+	height        int64
+	abandoned     []string
+	broadcast     []string
+	reject        *blockchain.RPCError
+}
+
+func (n *walletNode) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	var result interface{}
+	var rpcErr *blockchain.RPCError
+	notFound := &blockchain.RPCError{Code: -5, Message: "Invalid or non-wallet transaction id"}
+	var txid string
+	if len(req.Params) > 0 {
+		json.Unmarshal(req.Params[0], &txid)
+	}
+	switch req.Method {
+	case "getblockcount":
+		result = n.height
+	case "estimatesmartfee":
+		// 10 sat/vB
+		result = map[string]interface{}{"feerate": json.Number("0.00010000"), "blocks": 6}
+	case "sendrawtransaction":
+		if n.reject != nil {
+			rpcErr = n.reject
+			break
+		}
+		n.broadcast = append(n.broadcast, txid)
+		result = "broadcast"
+	case "getrawtransaction":
+		c, ok := n.raw[txid]
+		if !ok {
+			rpcErr = &blockchain.RPCError{Code: -5, Message: "No such mempool or blockchain transaction"}
+			break
+		}
+		result = blockchain.RawTransaction{TxID: txid, Confirmations: c}
+	case "gettransaction":
+		c, ok := n.confirmations[txid]
+		if !ok {
+			rpcErr = notFound
+			break
+		}
+		result = blockchain.WalletTransaction{TxID: txid, Confirmations: c, BlockHash: "00ab"}
+	case "getmempoolentry":
+		if !n.mempool[txid] {
+			rpcErr = &blockchain.RPCError{Code: -5, Message: "Transaction not in mempool"}
+			break
+		}
+		result = map[string]interface{}{"vsize": 141}
+	case "abandontransaction":
+		n.abandoned = append(n.abandoned, txid)
+	case "scantxoutset":
+		var descriptors []string
+		json.Unmarshal(req.Params[1], &descriptors)
+		scan, ok := n.scans[strings.TrimSuffix(strings.TrimPrefix(descriptors[0], "addr("), ")")]
+		if !ok {
+			scan.Total = "0"
+		}
+		result = map[string]interface{}{"success": true, "total_amount": scan.Total, "unspents": scan.Unspents}
+	default:
+		rpcErr = &blockchain.RPCError{Code: -32601, Message: "Method not found"}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "error": rpcErr, "id": "1"})
+}
+
+func newTestMonitor(t *testing.T, node *walletNode) (*Monitor, pgxmock.PgxPoolIface) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(node.serve))
+	t.Cleanup(server.Close)
+
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+
+	btc := blockchain.NewBitcoinClient(blockchain.BitcoinConfig{RPCURL: server.URL}, zap.NewNop())
+	m := NewMonitor(database.New(mock, zap.NewNop()), btc, nil, nil,
+		blockchain.DefaultConfirmationPolicy(), DefaultMonitorConfig(), zap.NewNop())
+	return m, mock
+}
+
+var processingColumns = []string{"id", "currency", "amount", "txid", "confirmations", "last_seen", "bitcoin_transaction_id"}
+
+func expectProcessing(mock pgxmock.PgxPoolIface, id uuid.UUID, txid, amount string, lastSeen time.Time, bitcoinTxID *uuid.UUID) {
+	mock.ExpectQuery("SELECT id, currency, amount, txid, confirmations").
+		WillReturnRows(pgxmock.NewRows(processingColumns).
+			AddRow(id, "BTC", decimal.RequireFromString(amount), txid, 0, lastSeen, bitcoinTxID))
+}
+
+func TestMonitorCompletesWithdrawalAtPolicyThreshold(t *testing.T) {
+	node := &walletNode{confirmations: map[string]int64{"tx-small": 1, "tx-large": 2}}
+	m, mock := newTestMonitor(t, node)
+
+	small, large, btxID := uuid.New(), uuid.New(), uuid.New()
+	mock.ExpectQuery("SELECT id, currency, amount, txid, confirmations").
+		WillReturnRows(pgxmock.NewRows(processingColumns).
+			AddRow(small, "BTC", decimal.RequireFromString("0.05"), "tx-small", 0, time.Now(), &btxID).
+			AddRow(large, "BTC", decimal.RequireFromString("5"), "tx-large", 1, time.Now(), (*uuid.UUID)(nil)))
+
+	// 0.05 BTC needs one confirmation, 5 BTC needs six
+	mock.ExpectBegin()
+	mock.ExpectExec("SET status = 'completed'").
+		WithArgs(small, 1, 1, "00ab").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectNoHold(mock, small)
+	mock.ExpectExec("WITH confirmed AS").
+		WithArgs(btxID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mock.ExpectCommit()
+	mock.ExpectExec("SET confirmations = \\$2").
+		WithArgs(large, 2, 6, "00ab").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	if err := m.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A transaction gone from the mempool past DropAfter is abandoned in the
+// wallet and the withdrawal's hold released
+func TestMonitorFailsDroppedWithdrawalAndReleasesHold(t *testing.T) {
+	node := &walletNode{confirmations: map[string]int64{"tx-dropped": 0}}
+	m, mock := newTestMonitor(t, node)
+
+	id, accountID := uuid.New(), uuid.New()
+	expectProcessing(mock, id, "tx-dropped", "0.5", time.Now().Add(-2*time.Hour), nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SET status = 'failed'").
+		WithArgs("transaction dropped from mempool", id).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectHoldReturned(mock, id, accountID, "BTC", "0.5001")
+	mock.ExpectCommit()
+
+	if err := m.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if len(node.abandoned) != 1 || node.abandoned[0] != "tx-dropped" {
+		t.Errorf("abandoned = %v, want [tx-dropped]", node.abandoned)
+	}
+}
+
+func TestMonitorWaitsForMempoolTransaction(t *testing.T) {
+	node := &walletNode{
+		confirmations: map[string]int64{"tx-waiting": 0},
+		mempool:       map[string]bool{"tx-waiting": true},
+	}
+	m, mock := newTestMonitor(t, node)
+
+	id := uuid.New()
+	expectProcessing(mock, id, "tx-waiting", "0.5", time.Now().Add(-2*time.Hour), nil)
+	mock.ExpectExec("SET confirmations = \\$2").
+		WithArgs(id, 0, 3, "").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	if err := m.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if len(node.abandoned) != 0 {
+		t.Errorf("abandoned = %v, want none", node.abandoned)
+	}
+}
+
+func TestMonitorFailsConflictedWithdrawal(t *testing.T) {
+	node := &walletNode{confirmations: map[string]int64{"tx-conflicted": -3}}
+	m, mock := newTestMonitor(t, node)
+
+	id := uuid.New()
+	expectProcessing(mock, id, "tx-conflicted", "0.5", time.Now(), nil)
+	mock.ExpectBegin()
+	mock.ExpectExec("SET status = 'failed'").
+		WithArgs("transaction conflicted with one in the active chain", id).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectNoHold(mock, id)
+	mock.ExpectCommit()
+
+	if err := m.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A dropped batch transaction fails every withdrawal it paid, not just the
+// one the monitor was looking at, and releases its inputs
+func TestMonitorFailsWholeBatch(t *testing.T) {
+	node := &walletNode{confirmations: map[string]int64{"tx-batch": -1}}
+	m, mock := newTestMonitor(t, node)
+
+	id, other, btxID := uuid.New(), uuid.New(), uuid.New()
+	expectProcessing(mock, id, "tx-batch", "0.5", time.Now(), &btxID)
+	// Nothing it replaced was mined instead
+	mock.ExpectQuery("FROM withdrawal_txids").
+		WithArgs(id).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "txid"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery("WHERE bitcoin_transaction_id = \\$1 AND status = 'processing'").
+		WithArgs(btxID).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(id).AddRow(other))
+	for _, w := range []uuid.UUID{id, other} {
+		mock.ExpectExec("SET status = 'failed'").
+			WithArgs("transaction conflicted with one in the active chain", w).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		expectNoHold(mock, w)
+	}
+	mock.ExpectExec("WITH failed AS").
+		WithArgs(btxID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectCommit()
+
+	if err := m.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBankPaymentState(t *testing.T) {
+	tests := map[string]string{
+		"PROCESSED":     "completed",
+		"ext_processed": "completed",
+		"ER_INVALID":    "failed",
+		"CANCELLED":     "failed",
+		"SUBMITTED":     "pending",
+		"VALIDATED":     "pending",
+	}
+	for status, want := range tests {
+		if got := bankPaymentState(status); got != want {
+			t.Errorf("bankPaymentState(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
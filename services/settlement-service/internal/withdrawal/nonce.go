@@ -0,0 +1,176 @@
+// BitCurrent Exchange - Ethereum Nonce Allocation
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// NonceManager hands out nonces for hot wallet addresses. Allocation locks
+// the address's row in ethereum_accounts, so replicas never hand out the
+// same nonce. A nonce whose transaction was dropped is released and handed
+// out again before any fresh one, filling the gap that would otherwise hold
+// up every later transaction from the address.
+type NonceManager struct {
+	logger *zap.Logger
+}
+
+// NewNonceManager creates a nonce manager
+func NewNonceManager(logger *zap.Logger) *NonceManager {
+	return &NonceManager{logger: logger}
+}
+
+// Allocate reserves a nonce for a withdrawal from address within tx.
+// chainNonce is the address's transaction count in the latest block; every
+// nonce below it has been used on chain.
+func (n *NonceManager) Allocate(ctx context.Context, tx pgx.Tx, address string, chainNonce uint64, withdrawalID uuid.UUID) (uint64, error) {
+	return n.allocate(ctx, tx, address, chainNonce, withdrawalID)
+}
+
+// AllocateInternal reserves a nonce within tx for a transaction paying no
+// withdrawal, such as a gas top-up
+func (n *NonceManager) AllocateInternal(ctx context.Context, tx pgx.Tx, address string, chainNonce uint64) (uint64, error) {
+	return n.allocate(ctx, tx, address, chainNonce, nil)
+}
+
+// allocate reserves a nonce for withdrawalID, a uuid.UUID or nil
+func (n *NonceManager) allocate(ctx context.Context, tx pgx.Tx, address string, chainNonce uint64, withdrawalID interface{}) (uint64, error) {
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO ethereum_accounts (address, next_nonce)
+		VALUES ($1, $2)
+		ON CONFLICT (address) DO NOTHING
+	`, address, int64(chainNonce)); err != nil {
+		return 0, fmt.Errorf("failed to create nonce account: %w", err)
+	}
+
+	var next int64
+	if err := tx.QueryRow(ctx, `
+		SELECT next_nonce FROM ethereum_accounts WHERE address = $1 FOR UPDATE
+	`, address).Scan(&next); err != nil {
+		return 0, fmt.Errorf("failed to lock nonce account: %w", err)
+	}
+
+	// A released nonce the chain has passed was used after all: the dropped
+	// transaction was mined late
+	rows, err := tx.Query(ctx, `
+		UPDATE ethereum_nonces
+		SET status = 'confirmed', updated_at = NOW()
+		WHERE address = $1 AND status = 'released' AND nonce < $2
+		RETURNING nonce, txid, withdrawal_id
+	`, address, int64(chainNonce))
+	if err != nil {
+		return 0, fmt.Errorf("failed to retire used nonces: %w", err)
+	}
+	for rows.Next() {
+		var nonce int64
+		var txid *string
+		var withdrawal *uuid.UUID
+		if err := rows.Scan(&nonce, &txid, &withdrawal); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		fields := []zap.Field{zap.String("address", address), zap.Int64("nonce", nonce)}
+		if txid != nil {
+			fields = append(fields, zap.String("txid", *txid))
+		}
+		if withdrawal != nil {
+			fields = append(fields, zap.String("withdrawal_id", withdrawal.String()))
+		}
+		n.logger.Error("Released Ethereum nonce was used on chain", fields...)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var released int64
+	err = tx.QueryRow(ctx, `
+		SELECT nonce FROM ethereum_nonces
+		WHERE address = $1 AND status = 'released'
+		ORDER BY nonce
+		LIMIT 1
+	`, address).Scan(&released)
+	switch {
+	case err == nil:
+		if _, err := tx.Exec(ctx, `
+			UPDATE ethereum_nonces
+			SET status = 'reserved', withdrawal_id = $3, txid = NULL, previous_txids = '{}',
+			    broadcast_at = NULL, updated_at = NOW()
+			WHERE address = $1 AND nonce = $2
+		`, address, released, withdrawalID); err != nil {
+			return 0, fmt.Errorf("failed to reuse released nonce: %w", err)
+		}
+		return uint64(released), nil
+	case !errors.Is(err, pgx.ErrNoRows):
+		return 0, fmt.Errorf("failed to find released nonce: %w", err)
+	}
+
+	nonce := max(next, int64(chainNonce))
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO ethereum_nonces (address, nonce, withdrawal_id)
+		VALUES ($1, $2, $3)
+	`, address, nonce, withdrawalID); err != nil {
+		return 0, fmt.Errorf("failed to reserve nonce: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE ethereum_accounts SET next_nonce = $2, updated_at = NOW() WHERE address = $1
+	`, address, nonce+1); err != nil {
+		return 0, fmt.Errorf("failed to advance nonce: %w", err)
+	}
+	return uint64(nonce), nil
+}
+
+// Reclaim reserves a specific released nonce within tx, for a transaction
+// filling its gap. It reports false if the nonce is no longer released.
+func (n *NonceManager) Reclaim(ctx context.Context, tx pgx.Tx, address string, nonce uint64) (bool, error) {
+	var next int64
+	if err := tx.QueryRow(ctx, `
+		SELECT next_nonce FROM ethereum_accounts WHERE address = $1 FOR UPDATE
+	`, address).Scan(&next); err != nil {
+		return false, fmt.Errorf("failed to lock nonce account: %w", err)
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE ethereum_nonces
+		SET status = 'reserved', withdrawal_id = NULL, txid = NULL, previous_txids = '{}',
+		    broadcast_at = NULL, updated_at = NOW()
+		WHERE address = $1 AND nonce = $2 AND status = 'released'
+	`, address, int64(nonce))
+	if err != nil {
+		return false, fmt.Errorf("failed to reclaim nonce: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// releaseEthereumNonce hands the nonce of a withdrawal whose transaction
+// was dropped or rejected back for reuse
+func releaseEthereumNonce(ctx context.Context, tx pgx.Tx, withdrawalID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE ethereum_nonces
+		SET status = 'released', updated_at = NOW()
+		WHERE withdrawal_id = $1 AND status IN ('reserved', 'broadcast')
+	`, withdrawalID)
+	if err != nil {
+		return fmt.Errorf("failed to release ethereum nonce: %w", err)
+	}
+	return nil
+}
+
+// confirmEthereumNonce records that a withdrawal's transaction was mined,
+// using up its nonce whether it succeeded or reverted
+func confirmEthereumNonce(ctx context.Context, tx pgx.Tx, withdrawalID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE ethereum_nonces
+		SET status = 'confirmed', updated_at = NOW()
+		WHERE withdrawal_id = $1 AND status = 'broadcast'
+	`, withdrawalID)
+	if err != nil {
+		return fmt.Errorf("failed to confirm ethereum nonce: %w", err)
+	}
+	return nil
+}
@@ -3,20 +3,56 @@ package withdrawal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
 	"time"
 
 	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
 	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 )
 
+// ErrNoEthereumSigner means no Ethereum hot wallet signer is configured;
+// Ethereum withdrawals stay approved until one is
+var ErrNoEthereumSigner = errors.New("no Ethereum signer configured")
+
+// ErrNoBitcoinWallet means no Bitcoin hot wallet is configured; Bitcoin
+// withdrawals stay approved until one is
+var ErrNoBitcoinWallet = errors.New("no Bitcoin hot wallet configured")
+
+// ErrNoFasterPayments means GBP cannot be paid out yet; GBP withdrawals stay
+// approved until the Faster Payments integration sends them
+var ErrNoFasterPayments = errors.New("no Faster Payments integration")
+
+// ProcessorConfig controls how often approved withdrawals are picked up and
+// how Bitcoin ones are batched
+type ProcessorConfig struct {
+	Interval time.Duration
+	Batch    BatchConfig
+}
+
+// DefaultProcessorConfig returns the processor defaults
+func DefaultProcessorConfig() ProcessorConfig {
+	return ProcessorConfig{
+		Interval: 30 * time.Second,
+		Batch:    DefaultBatchConfig(),
+	}
+}
+
 // Processor handles withdrawal processing and blockchain broadcasting
 type Processor struct {
 	db        *database.PostgresDB
 	btcClient *blockchain.BitcoinClient
 	ethClient *blockchain.EthereumClient
+	tokens    *blockchain.TokenRegistry
+	btcTx     *BitcoinTxBuilder
+	ethTx     *EthereumTxSender
+	interval  time.Duration
+	batch     BatchConfig
 	logger    *zap.Logger
 }
 
@@ -25,27 +61,71 @@ func NewProcessor(
 	db *database.PostgresDB,
 	btcClient *blockchain.BitcoinClient,
 	ethClient *blockchain.EthereumClient,
+	tokens *blockchain.TokenRegistry,
+	btcTx *BitcoinTxBuilder,
+	ethTx *EthereumTxSender,
+	cfg ProcessorConfig,
 	logger *zap.Logger,
 ) *Processor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultProcessorConfig().Interval
+	}
+	batch := cfg.Batch
+	if batch.Window <= 0 {
+		batch.Window = DefaultBatchConfig().Window
+	}
+	if batch.MaxSize <= 0 {
+		batch.MaxSize = DefaultBatchConfig().MaxSize
+	}
 	return &Processor{
 		db:        db,
 		btcClient: btcClient,
 		ethClient: ethClient,
+		tokens:    tokens,
+		btcTx:     btcTx,
+		ethTx:     ethTx,
+		interval:  cfg.Interval,
+		batch:     batch,
 		logger:    logger,
 	}
 }
 
-// ProcessPendingWithdrawals processes all approved withdrawals
+// Start processes approved withdrawals until ctx is cancelled
+func (p *Processor) Start(ctx context.Context) error {
+	p.logger.Info("Starting withdrawal processor",
+		zap.Duration("interval", p.interval),
+		zap.Bool("batching", p.batch.Enabled),
+	)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.logger.Info("Withdrawal processor stopped")
+			return ctx.Err()
+
+		case <-ticker.C:
+			if err := p.ProcessPendingWithdrawals(ctx); err != nil {
+				p.logger.Error("Withdrawal processing failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// ProcessPendingWithdrawals processes all approved withdrawals. With
+// batching enabled Bitcoin withdrawals are left to processBitcoinBatch.
 func (p *Processor) ProcessPendingWithdrawals(ctx context.Context) error {
 	query := `
-		SELECT id, account_id, currency, amount, fee, address, network
+		SELECT id, account_id, currency, amount, fee, address, COALESCE(network, '')
 		FROM withdrawals
-		WHERE status = 'approved'
+		WHERE status = 'approved' AND NOT ($1 AND currency = 'BTC')
 		ORDER BY created_at ASC
 		LIMIT 100
 	`
 	
-	rows, err := p.db.Pool.Query(ctx, query)
+	rows, err := p.db.Pool.Query(ctx, query, p.batch.Enabled)
 	if err != nil {
 		return err
 	}
@@ -56,8 +136,8 @@ func (p *Processor) ProcessPendingWithdrawals(ctx context.Context) error {
 			ID        uuid.UUID
 			AccountID uuid.UUID
 			Currency  string
-			Amount    string
-			Fee       string
+			Amount    decimal.Decimal
+			Fee       decimal.Decimal
 			Address   string
 			Network   string
 		}
@@ -78,7 +158,30 @@ func (p *Processor) ProcessPendingWithdrawals(ctx context.Context) error {
 		}
 		
 		// Process withdrawal
-		if err := p.processWithdrawal(ctx, &withdrawal); err != nil {
+		err = p.processWithdrawal(ctx, &withdrawal)
+		if errors.Is(err, ErrWithdrawalUnavailable) {
+			// Claimed by another processor or cancelled since the query
+			continue
+		}
+		if errors.Is(err, ErrInsufficientFunds) {
+			// The hot wallet is short, not the withdrawal at fault
+			p.logger.Warn("Insufficient UTXOs for withdrawal, will retry",
+				zap.String("withdrawal_id", withdrawal.ID.String()),
+			)
+			p.requeueWithdrawal(ctx, withdrawal.ID)
+			continue
+		}
+		if errors.Is(err, ErrNoBitcoinWallet) || errors.Is(err, ErrNoEthereumSigner) || errors.Is(err, ErrEthereumRejected) || errors.Is(err, ErrInsufficientTokens) || errors.Is(err, ErrNoFasterPayments) {
+			// Waits in the queue rather than failing; a rejected transaction
+			// has released its nonce and is rebuilt next time
+			p.logger.Warn("Withdrawal not sent, will retry",
+				zap.String("withdrawal_id", withdrawal.ID.String()),
+				zap.Error(err),
+			)
+			p.requeueWithdrawal(ctx, withdrawal.ID)
+			continue
+		}
+		if err != nil {
 			p.logger.Error("Failed to process withdrawal",
 				zap.String("withdrawal_id", withdrawal.ID.String()),
 				zap.Error(err),
@@ -87,6 +190,11 @@ func (p *Processor) ProcessPendingWithdrawals(ctx context.Context) error {
 			continue
 		}
 	}
+	rows.Close()
+	
+	if p.batch.Enabled && p.btcTx != nil {
+		return p.processBitcoinBatch(ctx)
+	}
 	
 	return nil
 }
@@ -96,36 +204,44 @@ func (p *Processor) processWithdrawal(ctx context.Context, w interface{}) error
 		ID        uuid.UUID
 		AccountID uuid.UUID
 		Currency  string
-		Amount    string
-		Fee       string
+		Amount    decimal.Decimal
+		Fee       decimal.Decimal
 		Address   string
 		Network   string
 	})
 	
-	// Update status to processing
+	// Update status to processing; only one processor claims it
 	updateQuery := `
 		UPDATE withdrawals
 		SET status = 'processing', processed_at = NOW()
-		WHERE id = $1
+		WHERE id = $1 AND status = 'approved'
 	`
 	
-	if _, err := p.db.Pool.Exec(ctx, updateQuery, withdrawal.ID); err != nil {
+	tag, err := p.db.Pool.Exec(ctx, updateQuery, withdrawal.ID)
+	if err != nil {
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return ErrWithdrawalUnavailable
+	}
 	
 	// Broadcast transaction based on currency
 	var txid string
-	var err error
 	
 	switch withdrawal.Currency {
 	case "BTC":
-		txid, err = p.processBitcoinWithdrawal(withdrawal.Address, withdrawal.Amount)
+		// Broadcast happens once the PSBT is signed, which sets the txid
+		return p.processBitcoinWithdrawal(ctx, withdrawal.ID, withdrawal.Address, withdrawal.Amount)
 	case "ETH":
-		txid, err = p.processEthereumWithdrawal(withdrawal.Address, withdrawal.Amount)
+		txid, err = p.processEthereumWithdrawal(ctx, withdrawal.ID, withdrawal.Address, withdrawal.Amount)
 	case "GBP":
 		txid, err = p.processFiatWithdrawal(withdrawal)
 	default:
-		return fmt.Errorf("unsupported currency: %s", withdrawal.Currency)
+		token, ok := p.tokens.BySymbol(withdrawal.Currency)
+		if !ok {
+			return fmt.Errorf("unsupported currency: %s", withdrawal.Currency)
+		}
+		txid, err = p.processTokenWithdrawal(ctx, withdrawal.ID, token, withdrawal.Address, withdrawal.Amount)
 	}
 	
 	if err != nil {
@@ -149,51 +265,91 @@ func (p *Processor) processWithdrawal(ctx context.Context, w interface{}) error
 		zap.String("currency", withdrawal.Currency),
 	)
 	
-	// TODO: Monitor transaction for confirmations
-	// TODO: Update status to 'completed' once confirmed
+	// The Monitor follows the transaction from here
 	
 	return nil
 }
 
-func (p *Processor) processBitcoinWithdrawal(address, amount string) (string, error) {
-	// Validate address
-	valid, err := p.btcClient.ValidateAddress(address)
+func (p *Processor) processBitcoinWithdrawal(ctx context.Context, withdrawalID uuid.UUID, address string, amount decimal.Decimal) error {
+	if p.btcTx == nil {
+		return ErrNoBitcoinWallet
+	}
+	payment, err := bitcoinPayment(withdrawalID, address, amount)
 	if err != nil {
-		return "", err
+		return err
+	}
+	
+	// Built from our UTXOs as a PSBT for the signers; the builder checks
+	// the address against the wallet's network
+	btx, err := p.btcTx.Build(ctx, []Payment{payment})
+	if err != nil {
+		return err
 	}
 	
-	if !valid {
-		return "", fmt.Errorf("invalid Bitcoin address")
+	p.logger.Info("Bitcoin withdrawal awaiting signatures",
+		zap.String("withdrawal_id", withdrawalID.String()),
+		zap.String("bitcoin_transaction_id", btx.ID.String()),
+		zap.String("txid", btx.TxID),
+	)
+	
+	return nil
+}
+
+func (p *Processor) processEthereumWithdrawal(ctx context.Context, withdrawalID uuid.UUID, address string, amount decimal.Decimal) (string, error) {
+	if p.ethTx == nil {
+		return "", ErrNoEthereumSigner
 	}
 	
-	// Convert amount to float64
-	var amountFloat float64
-	fmt.Sscanf(amount, "%f", &amountFloat)
+	// Validate address
+	if !p.ethClient.ValidateAddress(address) {
+		return "", fmt.Errorf("invalid Ethereum address")
+	}
 	
-	// Send transaction
-	// TODO: This should use multi-sig wallet, not direct send
-	txid, err := p.btcClient.SendToAddress(address, amountFloat)
+	if !amount.IsPositive() {
+		return "", fmt.Errorf("invalid withdrawal amount: %s", amount)
+	}
+	wei, err := amount.MinorUnits(18)
 	if err != nil {
 		return "", err
 	}
 	
-	return txid, nil
+	// Signed from the hot wallet with the next free nonce
+	return p.ethTx.Send(ctx, withdrawalID, address, wei, nil)
 }
 
-func (p *Processor) processEthereumWithdrawal(address, amount string) (string, error) {
-	// Validate address
+// processTokenWithdrawal pays an ERC-20 withdrawal as a transfer call on
+// the token's contract, in the token's own decimals
+func (p *Processor) processTokenWithdrawal(ctx context.Context, withdrawalID uuid.UUID, token blockchain.Token, address string, amount decimal.Decimal) (string, error) {
+	if p.ethTx == nil {
+		return "", ErrNoEthereumSigner
+	}
 	if !p.ethClient.ValidateAddress(address) {
 		return "", fmt.Errorf("invalid Ethereum address")
 	}
-	
-	// TODO: Convert amount to big.Int (wei)
-	// TODO: Get gas price
-	// TODO: Send transaction with multi-sig
-	
-	// Mock transaction
-	txHash := fmt.Sprintf("0x%s", generateMockHash(64))
-	
-	return txHash, nil
+	if !amount.IsPositive() {
+		return "", fmt.Errorf("invalid withdrawal amount: %s", amount)
+	}
+	units, err := amount.MinorUnits(token.Decimals)
+	if err != nil {
+		return "", err
+	}
+	data, err := blockchain.EncodeTransfer(address, units)
+	if err != nil {
+		return "", err
+	}
+
+	// A transfer the hot wallet cannot cover would fail gas estimation, so
+	// it waits for a top-up instead
+	balance, err := p.ethClient.GetTokenBalance(ctx, p.ethTx.Address(), token.Contract)
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s balance: %w", token.Symbol, err)
+	}
+	if balance.Cmp(units) < 0 {
+		return "", fmt.Errorf("%w: %s %s held, %s needed", ErrInsufficientTokens, decimal.NewFromBigInt(balance, token.Decimals),
+			token.Symbol, amount)
+	}
+
+	return p.ethTx.Send(ctx, withdrawalID, token.Contract, new(big.Int), data)
 }
 
 func (p *Processor) processFiatWithdrawal(w interface{}) (string, error) {
@@ -201,73 +357,37 @@ func (p *Processor) processFiatWithdrawal(w interface{}) (string, error) {
 	// 1. Validate bank account
 	// 2. Call Faster Payments API
 	// 3. Return payment reference
-	
-	reference := fmt.Sprintf("FP%s", generateMockHash(16))
-	
-	p.logger.Info("Fiat withdrawal processed (mock)",
-		zap.String("reference", reference),
-	)
-	
-	return reference, nil
+	//
+	// Until then nothing is sent, and the Monitor has no payment to follow
+	return "", ErrNoFasterPayments
 }
 
 func (p *Processor) markWithdrawalFailed(ctx context.Context, withdrawalID uuid.UUID, reason string) error {
-	query := `
-		UPDATE withdrawals
-		SET status = 'failed',
-		    failure_reason = $1,
-		    failed_at = NOW(),
-		    updated_at = NOW()
-		WHERE id = $2
-	`
-	
-	_, err := p.db.Pool.Exec(ctx, query, reason, withdrawalID)
+	// Held funds go back to the account with the status change
+	err := p.db.WithTx(ctx, func(tx pgx.Tx) error {
+		failed, err := failWithdrawal(ctx, tx, withdrawalID, reason)
+		if err != nil || !failed {
+			return err
+		}
+		_, err = releaseWithdrawalHold(ctx, tx, withdrawalID)
+		return err
+	})
 	if err != nil {
 		p.logger.Error("Failed to mark withdrawal as failed", zap.Error(err))
 		return err
 	}
 	
-	// TODO: Release reserved balance back to available balance
-	
 	return nil
 }
 
-// ApproveWithdrawal approves a pending withdrawal
-func (p *Processor) ApproveWithdrawal(ctx context.Context, withdrawalID uuid.UUID, approverID uuid.UUID) error {
-	query := `
+// requeueWithdrawal puts a withdrawal back in the approved queue
+func (p *Processor) requeueWithdrawal(ctx context.Context, withdrawalID uuid.UUID) {
+	_, err := p.db.Pool.Exec(ctx, `
 		UPDATE withdrawals
-		SET status = 'approved',
-		    approved_at = NOW(),
-		    approved_by = $1,
-		    updated_at = NOW()
-		WHERE id = $2 AND status = 'pending'
-	`
-	
-	result, err := p.db.Pool.Exec(ctx, query, approverID, withdrawalID)
+		SET status = 'approved', processed_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'processing'
+	`, withdrawalID)
 	if err != nil {
-		return err
+		p.logger.Error("Failed to requeue withdrawal", zap.Error(err))
 	}
-	
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("withdrawal not found or already processed")
-	}
-	
-	p.logger.Info("Withdrawal approved",
-		zap.String("withdrawal_id", withdrawalID.String()),
-		zap.String("approver_id", approverID.String()),
-	)
-	
-	return nil
 }
-
-func generateMockHash(length int) string {
-	chars := "0123456789abcdef"
-	result := ""
-	for i := 0; i < length; i++ {
-		result += string(chars[i%len(chars)])
-	}
-	return result
-}
-
-
-
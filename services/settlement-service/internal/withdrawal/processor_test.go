@@ -0,0 +1,74 @@
+package withdrawal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/holds"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+// A GBP withdrawal is requested without a network and is still picked up
+// by the processor once approved, then waits in the queue as nothing can pay
+// it out yet
+func TestGBPWithdrawalRequestedThenProcessed(t *testing.T) {
+	requests, mock := newTestRequests(t)
+	accountID, withdrawalID := uuid.New(), uuid.New()
+	amount := decimal.RequireFromString("250")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM wallets").
+		WithArgs(accountID, "GBP").
+		WillReturnRows(pgxmock.NewRows([]string{"withdrawable"}).AddRow(decimal.RequireFromString("1000")))
+	mock.ExpectQuery("INSERT INTO withdrawals").
+		WithArgs(accountID, "GBP", amount, decimal.Zero, "", "").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(withdrawalID, time.Now()))
+	mock.ExpectQuery("SELECT available_balance").
+		WithArgs(accountID, "GBP").
+		WillReturnRows(pgxmock.NewRows([]string{"available_balance"}).AddRow(decimal.RequireFromString("1000")))
+	expectNoHold(mock, withdrawalID)
+	mock.ExpectExec("SET available_balance = available_balance - \\$1").
+		WithArgs(amountArg{amount}, accountID, "GBP").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery("INSERT INTO balance_holds").
+		WithArgs(accountID, "GBP", amountArg{amount}, holds.ReferenceWithdrawal, withdrawalID).
+		WillReturnRows(holdRows(withdrawalHold(withdrawalID, accountID, "GBP", "250")))
+	mock.ExpectCommit()
+
+	w, err := requests.Request(context.Background(), WithdrawalRequest{
+		AccountID: accountID,
+		Currency:  "GBP",
+		Amount:    amount,
+	})
+	if err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	if w.Network != "" {
+		t.Errorf("Request() network = %q, want none", w.Network)
+	}
+
+	// Approved, the row comes back with the NULL network as empty
+	p := NewProcessor(database.New(mock, zap.NewNop()), nil, nil, nil, nil, nil, DefaultProcessorConfig(), zap.NewNop())
+	mock.ExpectQuery("COALESCE\\(network, ''\\)").
+		WithArgs(false).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "account_id", "currency", "amount", "fee", "address", "network"}).
+			AddRow(withdrawalID, accountID, "GBP", amount, decimal.Zero, "", ""))
+	mock.ExpectExec("SET status = 'processing', processed_at = NOW\\(\\)").
+		WithArgs(withdrawalID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("SET status = 'approved', processed_at = NULL").
+		WithArgs(withdrawalID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	if err := p.ProcessPendingWithdrawals(context.Background()); err != nil {
+		t.Fatalf("ProcessPendingWithdrawals() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
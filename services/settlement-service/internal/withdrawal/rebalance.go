@@ -0,0 +1,1138 @@
+// BitCurrent Exchange - Hot/Warm/Cold Custody Rebalancing
+package withdrawal
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Custody tiers, named as the multisig wallets are
+const (
+	tierHot  = "hot"
+	tierWarm = "warm"
+	tierCold = "cold"
+)
+
+// RebalanceConfig controls how custody is kept at its target split
+type RebalanceConfig struct {
+	Interval time.Duration
+	// Thresholds is the share of each asset to hold in each wallet
+	Thresholds wallet.WalletThresholds
+	// Tolerance is how far, as a fraction of its target, the hot or warm
+	// wallet may drift before a move is proposed
+	Tolerance decimal.Decimal
+	// CoverageWindow is how far ahead the hot wallet must cover expected
+	// withdrawals: those queued, plus the volume paid over Lookback scaled
+	// to the window. The hot target is raised to cover them.
+	CoverageWindow time.Duration
+	Lookback       time.Duration
+	// MinBitcoinAmount is the smallest move worth proposing, in BTC
+	MinBitcoinAmount decimal.Decimal
+	// DropAfter is how long a broadcast move may go unseen by the node
+	// before it is treated as dropped
+	DropAfter time.Duration
+	// EthereumWarmAddress and EthereumColdAddress hold Ethereum assets
+	// outside the hot wallet. They are contract wallets moved by their own
+	// owners, so Ethereum assets are measured and alerted on only.
+	EthereumWarmAddress string
+	EthereumColdAddress string
+}
+
+// DefaultRebalanceConfig returns the rebalancing defaults
+func DefaultRebalanceConfig() RebalanceConfig {
+	return RebalanceConfig{
+		Interval:         15 * time.Minute,
+		Thresholds:       wallet.DefaultThresholds,
+		Tolerance:        decimal.RequireFromString("0.25"),
+		CoverageWindow:   24 * time.Hour,
+		Lookback:         7 * 24 * time.Hour,
+		MinBitcoinAmount: decimal.RequireFromString("0.01"),
+		DropAfter:        time.Hour,
+	}
+}
+
+// CustodySplit is how much of an asset each wallet holds on chain, and the
+// withdrawals the hot wallet is expected to pay over the coverage window.
+// Covered is false when the hot wallet holds less than those.
+type CustodySplit struct {
+	Currency            string          `json:"currency"`
+	Hot                 decimal.Decimal `json:"hot"`
+	Warm                decimal.Decimal `json:"warm"`
+	Cold                decimal.Decimal `json:"cold"`
+	HotShare            float64         `json:"hot_share"`
+	WarmShare           float64         `json:"warm_share"`
+	ColdShare           float64         `json:"cold_share"`
+	ExpectedWithdrawals decimal.Decimal `json:"expected_withdrawals"`
+	Covered             bool            `json:"covered"`
+}
+
+// newCustodySplit works out the shares of what each wallet holds
+func newCustodySplit(currency string, hot, warm, cold, expected decimal.Decimal) CustodySplit {
+	s := CustodySplit{
+		Currency:            currency,
+		Hot:                 hot,
+		Warm:                warm,
+		Cold:                cold,
+		ExpectedWithdrawals: expected,
+		Covered:             hot.GreaterThanOrEqual(expected),
+	}
+	if total := decimal.Sum(hot, warm, cold); total.IsPositive() {
+		t := total.Float64()
+		s.HotShare = hot.Float64() / t
+		s.WarmShare = warm.Float64() / t
+		s.ColdShare = cold.Float64() / t
+	}
+	return s
+}
+
+// CustodyRebalance is a proposed move between wallets. A move out of the
+// hot wallet waits for the hot wallet's signers at BitcoinTxID, one out of
+// the warm wallet for its multisig signers at MultiSigTxID. OutputIndex is
+// the output paying ToAddress.
+type CustodyRebalance struct {
+	ID             uuid.UUID           `json:"id"`
+	Currency       string              `json:"currency"`
+	FromTier       string              `json:"from"`
+	ToTier         string              `json:"to"`
+	Amount         decimal.Decimal     `json:"amount"`
+	Fee            decimal.NullDecimal `json:"fee"`
+	Status         string              `json:"status"`
+	MultiSigTxID   *uuid.UUID          `json:"multisig_transaction_id,omitempty"`
+	BitcoinTxID    *uuid.UUID          `json:"bitcoin_transaction_id,omitempty"`
+	ToAddress      string              `json:"to_address"`
+	OutputIndex    int                 `json:"output_index"`
+	DerivationPath string              `json:"-"`
+	TxID           *string             `json:"txid,omitempty"`
+	Reason         string              `json:"reason,omitempty"`
+	CreatedAt      time.Time           `json:"created_at"`
+}
+
+// Rebalancer keeps each asset spread over the hot, warm and cold wallets as
+// WalletThresholds says, measuring what each holds on chain. Bitcoin moves
+// are proposed, never sent: the hot wallet is topped up from the warm
+// multisig wallet, and excess in either goes to the cold wallet, each
+// waiting for its wallet's signers. Whenever the hot wallet holds less than
+// the withdrawals expected over the coverage window it raises an alert.
+type Rebalancer struct {
+	db        *database.PostgresDB
+	btcClient *blockchain.BitcoinClient
+	builder   *BitcoinTxBuilder
+	warm      *wallet.MultiSigWallet
+	cold      *wallet.MultiSigWallet
+	ethTx     *EthereumTxSender
+	tokens    *blockchain.TokenRegistry
+	config    RebalanceConfig
+	logger    *zap.Logger
+
+	mu         sync.Mutex
+	splits     []CustodySplit
+	measuredAt time.Time
+}
+
+// NewRebalancer creates a rebalancer. Bitcoin needs builder, and moves
+// need the warm and cold wallets; Ethereum assets need ethTx. Any may be
+// nil to leave that part alone.
+func NewRebalancer(
+	db *database.PostgresDB,
+	btcClient *blockchain.BitcoinClient,
+	builder *BitcoinTxBuilder,
+	warm *wallet.MultiSigWallet,
+	cold *wallet.MultiSigWallet,
+	ethTx *EthereumTxSender,
+	tokens *blockchain.TokenRegistry,
+	cfg RebalanceConfig,
+	logger *zap.Logger,
+) *Rebalancer {
+	defaults := DefaultRebalanceConfig()
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaults.Interval
+	}
+	if cfg.Thresholds.HotWalletPercent.IsZero() && cfg.Thresholds.WarmWalletPercent.IsZero() && cfg.Thresholds.ColdWalletPercent.IsZero() {
+		cfg.Thresholds = defaults.Thresholds
+	}
+	if !cfg.Tolerance.IsPositive() {
+		cfg.Tolerance = defaults.Tolerance
+	}
+	if cfg.CoverageWindow <= 0 {
+		cfg.CoverageWindow = defaults.CoverageWindow
+	}
+	if cfg.Lookback <= 0 {
+		cfg.Lookback = defaults.Lookback
+	}
+	if cfg.MinBitcoinAmount.IsZero() {
+		cfg.MinBitcoinAmount = defaults.MinBitcoinAmount
+	}
+	if cfg.DropAfter <= 0 {
+		cfg.DropAfter = defaults.DropAfter
+	}
+	return &Rebalancer{
+		db:        db,
+		btcClient: btcClient,
+		builder:   builder,
+		warm:      warm,
+		cold:      cold,
+		ethTx:     ethTx,
+		tokens:    tokens,
+		config:    cfg,
+		logger:    logger,
+	}
+}
+
+// Start runs rebalancing passes until ctx is cancelled
+func (r *Rebalancer) Start(ctx context.Context) error {
+	r.logger.Info("Starting custody rebalancer",
+		zap.Duration("interval", r.config.Interval),
+		zap.Bool("bitcoin", r.builder != nil),
+		zap.Bool("ethereum", r.ethTx != nil),
+	)
+
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Custody rebalancer stopped")
+			return ctx.Err()
+
+		case <-ticker.C:
+			if err := r.RunOnce(ctx); err != nil {
+				r.logger.Error("Custody rebalancing failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// RunOnce settles moves in flight, measures every asset and proposes the
+// Bitcoin moves needed to bring it back to its target split
+func (r *Rebalancer) RunOnce(ctx context.Context) error {
+	var errs []error
+	var splits []CustodySplit
+	if r.builder != nil {
+		if err := r.settleBitcoin(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("bitcoin: %w", err))
+		} else {
+			split, err := r.rebalanceBitcoin(ctx)
+			if split != nil {
+				splits = append(splits, *split)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("bitcoin: %w", err))
+			}
+		}
+	}
+	if r.ethTx != nil {
+		eth, err := r.ethereumSplits(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ethereum: %w", err))
+		}
+		for _, s := range eth {
+			r.checkCoverage(s)
+			r.checkEthereumSplit(s)
+		}
+		splits = append(splits, eth...)
+	}
+
+	r.mu.Lock()
+	r.splits, r.measuredAt = splits, time.Now()
+	r.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// Split returns every asset's custody split as last measured. Scanning the
+// multisig wallets walks the node's whole UTXO set, so it is only done
+// once a pass.
+func (r *Rebalancer) Split() ([]CustodySplit, time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.splits, r.measuredAt
+}
+
+// checkCoverage raises the alert for a hot wallet that cannot pay the
+// withdrawals expected over the coverage window
+func (r *Rebalancer) checkCoverage(s CustodySplit) {
+	if s.Covered {
+		return
+	}
+	r.logger.Error("Hot wallet cannot cover expected withdrawals",
+		zap.String("currency", s.Currency),
+		zap.String("hot", s.Hot.String()),
+		zap.String("expected_withdrawals", s.ExpectedWithdrawals.String()),
+		zap.Duration("window", r.config.CoverageWindow),
+	)
+}
+
+// checkEthereumSplit warns when Ethereum custody drifts from its targets;
+// moving it is left to the warm and cold wallets' owners
+func (r *Rebalancer) checkEthereumSplit(s CustodySplit) {
+	if r.config.EthereumWarmAddress == "" && r.config.EthereumColdAddress == "" {
+		return
+	}
+	th, tol := r.config.Thresholds, r.config.Tolerance
+	total := decimal.Sum(s.Hot, s.Warm, s.Cold)
+	hotTarget, warmTarget := total.Mul(th.HotWalletPercent), total.Mul(th.WarmWalletPercent)
+	if belowTarget(s.Hot, hotTarget, tol) || aboveTarget(s.Hot, hotTarget, tol) || aboveTarget(s.Warm, warmTarget, tol) {
+		r.logger.Warn("Ethereum custody is off its target split",
+			zap.String("currency", s.Currency),
+			zap.Float64("hot_share", s.HotShare),
+			zap.Float64("warm_share", s.WarmShare),
+			zap.Float64("cold_share", s.ColdShare),
+		)
+	}
+}
+
+// expectedWithdrawals is what the hot wallet should be ready to pay over
+// the coverage window: withdrawals queued, plus the recent rate
+func (r *Rebalancer) expectedWithdrawals(ctx context.Context, currency string) (decimal.Decimal, error) {
+	var recent, queued decimal.Decimal
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(amount) FILTER (WHERE status IN ('processing', 'completed') AND created_at >= $2), 0),
+		       COALESCE(SUM(amount) FILTER (WHERE status IN ('pending', 'approved')), 0)
+		FROM withdrawals
+		WHERE currency = $1
+	`, currency, time.Now().Add(-r.config.Lookback)).Scan(&recent, &queued)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to sum %s withdrawals: %w", currency, err)
+	}
+
+	rate, err := recent.Mul(decimal.NewFromInt(int64(r.config.CoverageWindow))).
+		Div(decimal.NewFromInt(int64(r.config.Lookback)), decimal.ScaleOf(currency), decimal.RoundUp)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return rate.Add(queued), nil
+}
+
+// bitcoinCustody is what each Bitcoin wallet holds, in satoshis, with the
+// warm wallet's outputs to spend
+type bitcoinCustody struct {
+	hot, warm, cold int64
+	warmOutputs     []UTXO
+}
+
+// bitcoinSplit measures Bitcoin custody: the hot wallet's tracked outputs,
+// including change and deposits not yet spendable, and the warm and cold
+// wallets' confirmed outputs
+func (r *Rebalancer) bitcoinSplit(ctx context.Context) (*CustodySplit, *bitcoinCustody, error) {
+	held := &bitcoinCustody{}
+	if err := r.db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(amount_sats), 0)
+		FROM bitcoin_utxos
+		WHERE status IN ('available', 'pending')
+	`).Scan(&held.hot); err != nil {
+		return nil, nil, fmt.Errorf("failed to sum hot wallet outputs: %w", err)
+	}
+
+	var err error
+	if r.warm != nil {
+		if held.warm, held.warmOutputs, err = r.scanMultiSig(r.warm); err != nil {
+			return nil, nil, err
+		}
+	}
+	if r.cold != nil {
+		if held.cold, _, err = r.scanMultiSig(r.cold); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	expected, err := r.expectedWithdrawals(ctx, "BTC")
+	if err != nil {
+		return nil, nil, err
+	}
+	split := newCustodySplit("BTC", decimal.New(held.hot, 8), decimal.New(held.warm, 8), decimal.New(held.cold, 8), expected)
+	return &split, held, nil
+}
+
+// scanMultiSig returns the total and outputs of a multisig wallet
+func (r *Rebalancer) scanMultiSig(w *wallet.MultiSigWallet) (int64, []UTXO, error) {
+	scan, err := r.btcClient.ScanAddress(w.Address())
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to scan %s: %w", w.Address(), err)
+	}
+	total, err := btcSats(scan.Total)
+	if err != nil {
+		return 0, nil, err
+	}
+	outputs := make([]UTXO, 0, len(scan.Unspents))
+	for _, o := range scan.Unspents {
+		amount, err := btcSats(o.Amount)
+		if err != nil {
+			return 0, nil, err
+		}
+		script, err := hex.DecodeString(o.ScriptPubKey)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid script for output %s:%d: %w", o.TxID, o.Vout, err)
+		}
+		outputs = append(outputs, UTXO{TxID: o.TxID, Vout: o.Vout, Amount: amount, ScriptPubKey: script})
+	}
+	return total, outputs, nil
+}
+
+// btcSats converts a BTC amount from the node to satoshis
+func btcSats(n json.Number) (int64, error) {
+	amount, err := decimal.NewFromString(n.String())
+	if err != nil {
+		return 0, fmt.Errorf("invalid BTC amount %q: %w", n, err)
+	}
+	sats, err := amount.MinorUnits(8)
+	if err != nil {
+		return 0, err
+	}
+	return sats.Int64(), nil
+}
+
+// plannedMove is a move between wallets, in satoshis
+type plannedMove struct {
+	From   string
+	To     string
+	Amount int64
+	Reason string
+}
+
+// planBitcoinMoves works out the moves that bring Bitcoin custody back
+// within tolerance of its targets. The hot target is raised to the
+// withdrawals expected. A hot wallet short of its target is topped up from
+// warm before warm sends its own excess to cold.
+func planBitcoinMoves(held *bitcoinCustody, expected int64, th wallet.WalletThresholds, tolerance decimal.Decimal) []plannedMove {
+	total := held.hot + held.warm + held.cold
+	if total <= 0 {
+		return nil
+	}
+	hotTarget := max(satsShare(total, th.HotWalletPercent), expected)
+	warmTarget := satsShare(total, th.WarmWalletPercent)
+	hot, warm := decimal.NewFromInt(held.hot), decimal.NewFromInt(held.warm)
+
+	var moves []plannedMove
+	switch {
+	case belowTarget(hot, decimal.NewFromInt(hotTarget), tolerance):
+		moves = append(moves, plannedMove{
+			From:   tierWarm,
+			To:     tierHot,
+			Amount: min(hotTarget-held.hot, held.warm),
+			Reason: fmt.Sprintf("hot wallet holds %s BTC against a target of %s", decimal.New(held.hot, 8), decimal.New(hotTarget, 8)),
+		})
+		return moves
+	case aboveTarget(hot, decimal.NewFromInt(hotTarget), tolerance):
+		moves = append(moves, plannedMove{
+			From:   tierHot,
+			To:     tierCold,
+			Amount: held.hot - hotTarget,
+			Reason: fmt.Sprintf("hot wallet holds %s BTC against a target of %s", decimal.New(held.hot, 8), decimal.New(hotTarget, 8)),
+		})
+	}
+	if aboveTarget(warm, decimal.NewFromInt(warmTarget), tolerance) {
+		moves = append(moves, plannedMove{
+			From:   tierWarm,
+			To:     tierCold,
+			Amount: held.warm - warmTarget,
+			Reason: fmt.Sprintf("warm wallet holds %s BTC against a target of %s", decimal.New(held.warm, 8), decimal.New(warmTarget, 8)),
+		})
+	}
+	return moves
+}
+
+// satsShare returns fraction of total satoshis, rounded down to whole
+// satoshis
+func satsShare(total int64, fraction decimal.Decimal) int64 {
+	// Truncated to whole satoshis, so MinorUnits cannot lose precision
+	sats, _ := decimal.NewFromInt(total).Mul(fraction).Truncate(0).MinorUnits(0)
+	return sats.Int64()
+}
+
+// belowTarget reports whether held is more than tolerance, as a fraction
+// of target, short of target
+func belowTarget(held, target, tolerance decimal.Decimal) bool {
+	return held.LessThan(target.Sub(target.Mul(tolerance)))
+}
+
+// aboveTarget reports whether held is more than tolerance, as a fraction
+// of target, over target
+func aboveTarget(held, target, tolerance decimal.Decimal) bool {
+	return held.GreaterThan(target.Add(target.Mul(tolerance)))
+}
+
+// rebalanceBitcoin measures Bitcoin custody and proposes the moves it
+// needs, skipping any wallet with a move already in flight
+func (r *Rebalancer) rebalanceBitcoin(ctx context.Context) (*CustodySplit, error) {
+	split, held, err := r.bitcoinSplit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.checkCoverage(*split)
+
+	expected, err := split.ExpectedWithdrawals.Round(8, decimal.RoundUp).MinorUnits(8)
+	if err != nil {
+		return nil, err
+	}
+	minAmount, err := r.config.MinBitcoinAmount.MinorUnits(8)
+	if err != nil {
+		return nil, err
+	}
+	open, err := r.openMoves(ctx, "BTC")
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, m := range planBitcoinMoves(held, expected.Int64(), r.config.Thresholds, r.config.Tolerance) {
+		if open[m.From] || r.cold == nil && m.To == tierCold || r.warm == nil && m.From == tierWarm {
+			continue
+		}
+		if m.Amount < minAmount.Int64() {
+			r.logger.Debug("Custody move too small to propose",
+				zap.String("from", m.From),
+				zap.String("to", m.To),
+				zap.Int64("amount_sats", m.Amount),
+			)
+			continue
+		}
+
+		var rb *CustodyRebalance
+		if m.From == tierHot {
+			rb, err = r.proposeFromHot(ctx, m)
+		} else {
+			rb, err = r.proposeFromWarm(ctx, held.warmOutputs, m, minAmount.Int64())
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s to %s: %w", m.From, m.To, err))
+			continue
+		}
+		if rb == nil {
+			continue
+		}
+		r.logger.Info("Custody rebalance proposed",
+			zap.String("id", rb.ID.String()),
+			zap.String("currency", rb.Currency),
+			zap.String("from", rb.FromTier),
+			zap.String("to", rb.ToTier),
+			zap.String("amount", rb.Amount.String()),
+			zap.String("reason", rb.Reason),
+		)
+	}
+	return split, errors.Join(errs...)
+}
+
+// openMoves returns the wallets with a move of currency in flight
+func (r *Rebalancer) openMoves(ctx context.Context, currency string) (map[string]bool, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT from_tier FROM custody_rebalances
+		WHERE currency = $1 AND status IN ('proposed', 'broadcast')
+	`, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query open rebalances: %w", err)
+	}
+	defer rows.Close()
+
+	open := make(map[string]bool)
+	for rows.Next() {
+		var tier string
+		if err := rows.Scan(&tier); err != nil {
+			return nil, err
+		}
+		open[tier] = true
+	}
+	return open, rows.Err()
+}
+
+// proposeFromHot builds a PSBT sending hot wallet outputs to the cold
+// wallet for the hot wallet's signers. It returns nil if the spendable
+// outputs cannot pay for it yet.
+func (r *Rebalancer) proposeFromHot(ctx context.Context, m plannedMove) (*CustodyRebalance, error) {
+	rb := &CustodyRebalance{
+		Currency:  "BTC",
+		FromTier:  m.From,
+		ToTier:    m.To,
+		Amount:    decimal.New(m.Amount, 8),
+		ToAddress: r.cold.Address(),
+		Reason:    m.Reason,
+	}
+	t, err := r.builder.buildRebalance(ctx, rb)
+	if errors.Is(err, ErrInsufficientFunds) {
+		r.logger.Debug("Hot wallet outputs not yet spendable for a rebalance", zap.Int64("amount_sats", m.Amount))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.logger.Info("Bitcoin rebalance transaction built",
+		zap.String("id", t.ID.String()),
+		zap.String("txid", t.TxID),
+		zap.Int64("fee_sats", t.Fee),
+	)
+	return rb, nil
+}
+
+// buildRebalance stores a transaction paying rb.Amount of the spendable
+// outputs to rb.ToAddress, with change back to the hot wallet, and records
+// rb against it. Like a withdrawal it goes to the signers as a PSBT.
+func (b *BitcoinTxBuilder) buildRebalance(ctx context.Context, rb *CustodyRebalance) (*BitcoinTransaction, error) {
+	amount, err := rb.Amount.MinorUnits(8)
+	if err != nil {
+		return nil, err
+	}
+	out, err := b.paymentOutput(Payment{Address: rb.ToAddress, Amount: amount.Int64()})
+	if err != nil {
+		return nil, err
+	}
+	feeRate, err := b.feeRate()
+	if err != nil {
+		return nil, err
+	}
+
+	var result *BitcoinTransaction
+	err = b.db.WithTx(ctx, func(tx pgx.Tx) error {
+		utxos, err := lockAvailableUTXOs(ctx, tx)
+		if err != nil {
+			return err
+		}
+		sel, err := SelectCoins(utxos, out.Value, outputVBytes(len(out.PkScript)), feeRate)
+		if err != nil {
+			return err
+		}
+		unsigned, err := unsignedTx(sel.Inputs)
+		if err != nil {
+			return err
+		}
+		unsigned.TxOut = []*wire.TxOut{out}
+
+		var change *UTXO
+		if sel.Change > 0 {
+			if change, err = b.nextChangeOutput(ctx, tx, sel.Change); err != nil {
+				return err
+			}
+			unsigned.AddTxOut(wire.NewTxOut(change.Amount, change.ScriptPubKey))
+		}
+		encoded, err := b.signingPacket(unsigned, sel.Inputs, change, 1)
+		if err != nil {
+			return err
+		}
+
+		result = &BitcoinTransaction{
+			TxID:    unsigned.TxHash().String(),
+			PSBT:    encoded,
+			Fee:     sel.Fee,
+			FeeRate: feeRate,
+			VSize:   sel.VSize,
+			Status:  "unsigned",
+			Kind:    "rebalance",
+		}
+		if err := storeTransaction(ctx, tx, result); err != nil {
+			return err
+		}
+		if err := spendUTXOs(ctx, tx, sel.Inputs, result.ID); err != nil {
+			return err
+		}
+		if change != nil {
+			if err := b.storeChangeOutput(ctx, tx, result.TxID, 1, change); err != nil {
+				return err
+			}
+		}
+
+		rb.BitcoinTxID = &result.ID
+		return insertRebalance(ctx, tx, rb)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// proposeFromWarm proposes a warm wallet spend for its multisig signers,
+// paying a fresh hot wallet address or the cold wallet. If the warm wallet
+// holds less than the move it sends all it has, as long as that is at
+// least minAmount.
+func (r *Rebalancer) proposeFromWarm(ctx context.Context, outputs []UTXO, m plannedMove, minAmount int64) (*CustodyRebalance, error) {
+	feeRate, err := r.builder.feeRate()
+	if err != nil {
+		return nil, err
+	}
+	params := r.builder.hd.Params()
+	warmScript, err := addressScript(r.warm.Address(), params)
+	if err != nil {
+		return nil, err
+	}
+
+	rb := &CustodyRebalance{Currency: "BTC", FromTier: m.From, ToTier: m.To, Reason: m.Reason}
+	var destScript []byte
+	if m.To == tierHot {
+		// The output joins the hot wallet's spendable set once confirmed
+		var dest *UTXO
+		if err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+			dest, err = r.builder.nextChangeOutput(ctx, tx, 0)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		destScript, rb.DerivationPath = dest.ScriptPubKey, dest.DerivationPath
+		if rb.ToAddress, err = scriptAddress(destScript, params); err != nil {
+			return nil, err
+		}
+	} else {
+		rb.ToAddress = r.cold.Address()
+		if destScript, err = addressScript(rb.ToAddress, params); err != nil {
+			return nil, err
+		}
+	}
+
+	sel, amount, err := selectMultiSigInputs(outputs, m.Amount, r.warm.InputVBytes(), destScript, warmScript, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	if amount < minAmount {
+		r.logger.Debug("Warm wallet holds too little to move", zap.Int64("amount_sats", amount))
+		return nil, nil
+	}
+	unsigned, err := unsignedTx(sel.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	unsigned.AddTxOut(wire.NewTxOut(amount, destScript))
+	if sel.Change > 0 {
+		unsigned.AddTxOut(wire.NewTxOut(sel.Change, warmScript))
+	}
+	packet, err := psbt.NewFromUnsignedTx(unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PSBT: %w", err)
+	}
+	for i, u := range sel.Inputs {
+		packet.Inputs[i].WitnessUtxo = wire.NewTxOut(u.Amount, u.ScriptPubKey)
+		packet.Inputs[i].SighashType = txscript.SigHashAll
+	}
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode PSBT: %w", err)
+	}
+
+	proposal, err := r.warm.Propose(ctx, encoded, "Custody rebalance: "+m.Reason)
+	if err != nil {
+		return nil, err
+	}
+	rb.Amount = decimal.New(amount, 8)
+	rb.MultiSigTxID = &proposal.ID
+	if err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return insertRebalance(ctx, tx, rb)
+	}); err != nil {
+		// Without its rebalance nothing would follow the spend
+		if cancelErr := r.warm.Cancel(ctx, proposal.ID); cancelErr != nil {
+			r.logger.Error("Failed to cancel unrecorded multi-sig proposal",
+				zap.String("multisig_transaction_id", proposal.ID.String()),
+				zap.Error(cancelErr),
+			)
+		}
+		return nil, err
+	}
+	return rb, nil
+}
+
+// selectMultiSigInputs picks multisig outputs, largest first, to send
+// amount to destScript with change to changeScript. Change too small to
+// keep goes to the destination as well. If the outputs cannot pay amount
+// they are all sent, less the fee. It returns the selection and what the
+// destination receives.
+func selectMultiSigInputs(outputs []UTXO, amount, inputVBytes int64, destScript, changeScript []byte, feeRate int64) (*Selection, int64, error) {
+	sorted := append([]UTXO(nil), outputs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Amount > sorted[j].Amount })
+
+	sel := &Selection{}
+	var total int64
+	for _, u := range sorted {
+		// Outputs worth less than spending them are left alone
+		if u.Amount <= inputVBytes*feeRate {
+			continue
+		}
+		sel.Inputs = append(sel.Inputs, u)
+		total += u.Amount
+
+		sel.VSize = txOverheadVBytes + int64(len(sel.Inputs))*inputVBytes + outputVBytes(len(destScript))
+		withChange := sel.VSize + outputVBytes(len(changeScript))
+		if total < amount+withChange*feeRate {
+			continue
+		}
+		if change := total - amount - withChange*feeRate; change >= dustLimit(changeScript) {
+			sel.VSize, sel.Change, sel.Fee = withChange, change, withChange*feeRate
+			return sel, amount, nil
+		}
+		sel.Fee = sel.VSize * feeRate
+		return sel, total - sel.Fee, nil
+	}
+
+	if len(sel.Inputs) == 0 || total <= sel.VSize*feeRate+dustLimit(destScript) {
+		return nil, 0, ErrInsufficientFunds
+	}
+	sel.Fee = sel.VSize * feeRate
+	return sel, total - sel.Fee, nil
+}
+
+// addressScript returns the script paying address
+func addressScript(address string, params *chaincfg.Params) ([]byte, error) {
+	addr, err := btcutil.DecodeAddress(address, params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Bitcoin address %q: %w", address, err)
+	}
+	return txscript.PayToAddrScript(addr)
+}
+
+// scriptAddress returns the address script pays
+func scriptAddress(script []byte, params *chaincfg.Params) (string, error) {
+	pk, err := txscript.ParsePkScript(script)
+	if err != nil {
+		return "", err
+	}
+	addr, err := pk.Address(params)
+	if err != nil {
+		return "", err
+	}
+	return addr.EncodeAddress(), nil
+}
+
+// insertRebalance records a proposed move, setting its ID
+func insertRebalance(ctx context.Context, tx pgx.Tx, rb *CustodyRebalance) error {
+	rb.Status = "proposed"
+	var path *string
+	if rb.DerivationPath != "" {
+		path = &rb.DerivationPath
+	}
+	err := tx.QueryRow(ctx, `
+		INSERT INTO custody_rebalances (
+			currency, from_tier, to_tier, amount, multisig_transaction_id, bitcoin_transaction_id,
+			to_address, output_index, derivation_path, reason
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at
+	`, rb.Currency, rb.FromTier, rb.ToTier, rb.Amount, rb.MultiSigTxID, rb.BitcoinTxID,
+		rb.ToAddress, rb.OutputIndex, path, rb.Reason).Scan(&rb.ID, &rb.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record rebalance: %w", err)
+	}
+	return nil
+}
+
+// openRebalance is a Bitcoin move in flight with its transaction's state
+type openRebalance struct {
+	CustodyRebalance
+	MultiSigStatus string
+	PSBT           string
+	FeeSats        int64
+	BroadcastAt    *time.Time
+}
+
+// settleBitcoin follows moves in flight: a warm wallet spend once its
+// signers broadcast it, and any move until it confirms or is dropped.
+// A confirmed top-up's output joins the hot wallet's spendable set, and
+// every move's fee is booked as it leaves custody.
+func (r *Rebalancer) settleBitcoin(ctx context.Context) error {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT r.id, r.from_tier, r.to_tier, r.amount, r.status, r.multisig_transaction_id, r.bitcoin_transaction_id,
+		       r.to_address, r.output_index, COALESCE(r.derivation_path, ''),
+		       COALESCE(m.status, ''), COALESCE(m.txid, b.txid), COALESCE(m.psbt, ''), COALESCE(b.fee_sats, 0),
+		       COALESCE(r.broadcast_at, m.broadcast_at)
+		FROM custody_rebalances r
+		LEFT JOIN multisig_transactions m ON m.id = r.multisig_transaction_id
+		LEFT JOIN bitcoin_transactions b ON b.id = r.bitcoin_transaction_id
+		WHERE r.currency = 'BTC' AND r.status IN ('proposed', 'broadcast')
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query open rebalances: %w", err)
+	}
+	var open []openRebalance
+	for rows.Next() {
+		o := openRebalance{CustodyRebalance: CustodyRebalance{Currency: "BTC"}}
+		var txid string
+		if err := rows.Scan(&o.ID, &o.FromTier, &o.ToTier, &o.Amount, &o.Status, &o.MultiSigTxID, &o.BitcoinTxID,
+			&o.ToAddress, &o.OutputIndex, &o.DerivationPath,
+			&o.MultiSigStatus, &txid, &o.PSBT, &o.FeeSats, &o.BroadcastAt); err != nil {
+			rows.Close()
+			return err
+		}
+		o.TxID = &txid
+		open = append(open, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, o := range open {
+		if err := r.settleRebalance(ctx, &o); err != nil {
+			return fmt.Errorf("rebalance %s: %w", o.ID, err)
+		}
+	}
+	return nil
+}
+
+// settleRebalance moves one open move on as far as its transaction allows
+func (r *Rebalancer) settleRebalance(ctx context.Context, o *openRebalance) error {
+	if o.MultiSigTxID != nil {
+		switch o.MultiSigStatus {
+		case "pending":
+			return nil
+		case "cancelled":
+			if _, err := r.db.Pool.Exec(ctx, `
+				UPDATE custody_rebalances
+				SET status = 'cancelled', completed_at = NOW(), updated_at = NOW()
+				WHERE id = $1
+			`, o.ID); err != nil {
+				return fmt.Errorf("failed to cancel rebalance: %w", err)
+			}
+			r.logger.Info("Custody rebalance cancelled by its signers", zap.String("id", o.ID.String()))
+			return nil
+		}
+		if o.Status == "proposed" {
+			if _, err := r.db.Pool.Exec(ctx, `
+				UPDATE custody_rebalances
+				SET status = 'broadcast', txid = $2, broadcast_at = $3, updated_at = NOW()
+				WHERE id = $1
+			`, o.ID, *o.TxID, o.BroadcastAt); err != nil {
+				return fmt.Errorf("failed to record rebalance broadcast: %w", err)
+			}
+		}
+	} else if o.Status == "proposed" {
+		// Waiting for the hot wallet's signers
+		return nil
+	}
+
+	raw, err := r.btcClient.GetRawTransaction(*o.TxID)
+	if errors.Is(err, blockchain.ErrTransactionNotFound) {
+		if o.BroadcastAt == nil || time.Since(*o.BroadcastAt) < r.config.DropAfter {
+			return nil
+		}
+		if err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+			if o.BitcoinTxID != nil {
+				if err := releaseBitcoinTransaction(ctx, tx, *o.BitcoinTxID); err != nil {
+					return err
+				}
+			}
+			return failRebalance(ctx, tx, o.ID, "transaction dropped")
+		}); err != nil {
+			return err
+		}
+		r.logger.Warn("Custody rebalance dropped",
+			zap.String("id", o.ID.String()),
+			zap.String("txid", *o.TxID),
+		)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if raw.Confirmations <= 0 {
+		return nil
+	}
+
+	var topUp *wire.TxOut
+	fee := o.FeeSats
+	if o.MultiSigTxID != nil {
+		packet, err := psbt.NewFromRawBytes(strings.NewReader(o.PSBT), true)
+		if err != nil {
+			return fmt.Errorf("failed to decode multi-sig PSBT: %w", err)
+		}
+		if fee, err = packetFee(packet); err != nil {
+			return err
+		}
+		if o.ToTier == tierHot {
+			if o.OutputIndex >= len(packet.UnsignedTx.TxOut) {
+				return fmt.Errorf("output %d missing from %s", o.OutputIndex, *o.TxID)
+			}
+			topUp = packet.UnsignedTx.TxOut[o.OutputIndex]
+		}
+	}
+
+	feeAmount := decimal.New(fee, 8)
+	if err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if o.BitcoinTxID != nil {
+			if err := confirmBitcoinTransaction(ctx, tx, *o.BitcoinTxID); err != nil {
+				return err
+			}
+		}
+		if topUp != nil {
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO bitcoin_utxos (txid, vout, amount_sats, address, script_pub_key, derivation_path, status)
+				VALUES ($1, $2, $3, $4, $5, $6, 'available')
+				ON CONFLICT (txid, vout) DO NOTHING
+			`, *o.TxID, o.OutputIndex, topUp.Value, o.ToAddress,
+				hex.EncodeToString(topUp.PkScript), o.DerivationPath); err != nil {
+				return fmt.Errorf("failed to store top-up output: %w", err)
+			}
+		}
+		// Custody moves stay with the hot wallet account; only the fee
+		// leaves
+		if err := postCustodyJournal(ctx, tx, "rebalance", o.ID, "Custody rebalance", []journal.Posting{
+			{AccountID: journal.HotWalletAccountID, Currency: "BTC", Amount: feeAmount, EntryType: "fee"},
+			{AccountID: journal.NetworkFeeAccountID, Currency: "BTC", Amount: feeAmount.Neg(), EntryType: "fee"},
+		}); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE custody_rebalances
+			SET status = 'confirmed', txid = $2, fee = $3, completed_at = NOW(), updated_at = NOW()
+			WHERE id = $1
+		`, o.ID, *o.TxID, feeAmount)
+		if err != nil {
+			return fmt.Errorf("failed to complete rebalance: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	r.logger.Info("Custody rebalance confirmed",
+		zap.String("id", o.ID.String()),
+		zap.String("from", o.FromTier),
+		zap.String("to", o.ToTier),
+		zap.String("txid", *o.TxID),
+		zap.Int64("fee_sats", fee),
+	)
+	return nil
+}
+
+// packetFee is what a PSBT's inputs leave after its outputs
+func packetFee(packet *psbt.Packet) (int64, error) {
+	var fee int64
+	for i, in := range packet.Inputs {
+		if in.WitnessUtxo == nil {
+			return 0, fmt.Errorf("input %d is missing its previous output", i)
+		}
+		fee += in.WitnessUtxo.Value
+	}
+	for _, out := range packet.UnsignedTx.TxOut {
+		fee -= out.Value
+	}
+	return fee, nil
+}
+
+// failRebalance marks a rebalance failed
+func failRebalance(ctx context.Context, tx pgx.Tx, id uuid.UUID, reason string) error {
+	if _, err := tx.Exec(ctx, `
+		UPDATE custody_rebalances
+		SET status = 'failed', failure_reason = $2, completed_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, id, reason); err != nil {
+		return fmt.Errorf("failed to fail rebalance: %w", err)
+	}
+	return nil
+}
+
+// recordRebalanceBroadcast moves a hot wallet rebalance on with its
+// transaction
+func recordRebalanceBroadcast(ctx context.Context, tx pgx.Tx, t *BitcoinTransaction) error {
+	if _, err := tx.Exec(ctx, `
+		UPDATE custody_rebalances
+		SET status = 'broadcast', txid = $2, broadcast_at = NOW(), updated_at = NOW()
+		WHERE bitcoin_transaction_id = $1 AND status = 'proposed'
+	`, t.ID, t.TxID); err != nil {
+		return fmt.Errorf("failed to record rebalance broadcast: %w", err)
+	}
+	return nil
+}
+
+// rejectRebalance fails a hot wallet rebalance the network would not
+// accept, returning its inputs to the spendable set
+func rejectRebalance(ctx context.Context, tx pgx.Tx, id uuid.UUID, reason string) error {
+	if err := releaseBitcoinTransaction(ctx, tx, id); err != nil {
+		return err
+	}
+	var rebalanceID uuid.UUID
+	err := tx.QueryRow(ctx, `
+		SELECT id FROM custody_rebalances WHERE bitcoin_transaction_id = $1
+	`, id).Scan(&rebalanceID)
+	if err != nil {
+		return fmt.Errorf("failed to find rebalance: %w", err)
+	}
+	return failRebalance(ctx, tx, rebalanceID, reason)
+}
+
+// Open returns the moves in flight, oldest first
+func (r *Rebalancer) Open(ctx context.Context) ([]CustodyRebalance, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT id, currency, from_tier, to_tier, amount, fee, status, multisig_transaction_id,
+		       bitcoin_transaction_id, to_address, output_index, txid, COALESCE(reason, ''), created_at
+		FROM custody_rebalances
+		WHERE status IN ('proposed', 'broadcast')
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query open rebalances: %w", err)
+	}
+	defer rows.Close()
+
+	rebalances := []CustodyRebalance{}
+	for rows.Next() {
+		var rb CustodyRebalance
+		if err := rows.Scan(&rb.ID, &rb.Currency, &rb.FromTier, &rb.ToTier, &rb.Amount, &rb.Fee, &rb.Status,
+			&rb.MultiSigTxID, &rb.BitcoinTxID, &rb.ToAddress, &rb.OutputIndex, &rb.TxID, &rb.Reason, &rb.CreatedAt); err != nil {
+			return nil, err
+		}
+		rebalances = append(rebalances, rb)
+	}
+	return rebalances, rows.Err()
+}
+
+// ethereumSplits measures ETH and each token: the hot wallet's balance and
+// those of the configured warm and cold addresses
+func (r *Rebalancer) ethereumSplits(ctx context.Context) ([]CustodySplit, error) {
+	assets := []*blockchain.Token{nil}
+	for _, token := range r.tokens.Tokens(wallet.ChainEthereum) {
+		assets = append(assets, &token)
+	}
+
+	splits := make([]CustodySplit, 0, len(assets))
+	for _, token := range assets {
+		currency := "ETH"
+		if token != nil {
+			currency = token.Symbol
+		}
+		var held [3]decimal.Decimal
+		for i, address := range []string{r.ethTx.Address(), r.config.EthereumWarmAddress, r.config.EthereumColdAddress} {
+			balance, err := r.ethereumBalance(ctx, address, token)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get %s balance of %s: %w", currency, address, err)
+			}
+			held[i] = balance
+		}
+		expected, err := r.expectedWithdrawals(ctx, currency)
+		if err != nil {
+			return nil, err
+		}
+		splits = append(splits, newCustodySplit(currency, held[0], held[1], held[2], expected))
+	}
+	return splits, nil
+}
+
+// ethereumBalance returns what address holds of ETH, or of token if set
+func (r *Rebalancer) ethereumBalance(ctx context.Context, address string, token *blockchain.Token) (decimal.Decimal, error) {
+	if address == "" {
+		return decimal.Zero, nil
+	}
+	if token == nil {
+		wei, err := r.ethTx.client.GetBalance(ctx, address)
+		if err != nil {
+			return decimal.Zero, err
+		}
+		return decimal.NewFromBigInt(wei, decimal.ScaleOf("ETH")), nil
+	}
+	units, err := r.ethTx.client.GetTokenBalance(ctx, address, token.Contract)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return decimal.NewFromBigInt(units, token.Decimals), nil
+}
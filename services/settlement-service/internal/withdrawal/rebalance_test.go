@@ -0,0 +1,338 @@
+package withdrawal
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+func TestPlanBitcoinMoves(t *testing.T) {
+	tests := []struct {
+		name     string
+		held     bitcoinCustody
+		expected int64
+		want     []plannedMove
+	}{
+		{
+			name: "on target",
+			held: bitcoinCustody{hot: 2e8, warm: 8e8, cold: 90e8},
+		},
+		{
+			name: "within tolerance",
+			held: bitcoinCustody{hot: 1.6e8, warm: 9.5e8, cold: 88.9e8},
+		},
+		{
+			name: "hot short tops up from warm first",
+			held: bitcoinCustody{hot: 0.5e8, warm: 20e8, cold: 79.5e8},
+			want: []plannedMove{{From: tierWarm, To: tierHot, Amount: 1.5e8}},
+		},
+		{
+			name: "top-up capped at warm",
+			held: bitcoinCustody{hot: 0, warm: 0.5e8, cold: 99.5e8},
+			want: []plannedMove{{From: tierWarm, To: tierHot, Amount: 0.5e8}},
+		},
+		{
+			name: "hot and warm excess go cold",
+			held: bitcoinCustody{hot: 10e8, warm: 20e8, cold: 70e8},
+			want: []plannedMove{
+				{From: tierHot, To: tierCold, Amount: 8e8},
+				{From: tierWarm, To: tierCold, Amount: 12e8},
+			},
+		},
+		{
+			name:     "expected withdrawals raise the hot target",
+			held:     bitcoinCustody{hot: 2e8, warm: 8e8, cold: 90e8},
+			expected: 5e8,
+			want:     []plannedMove{{From: tierWarm, To: tierHot, Amount: 3e8}},
+		},
+		{
+			name: "nothing held",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moves := planBitcoinMoves(&tt.held, tt.expected, wallet.DefaultThresholds, decimal.RequireFromString("0.25"))
+			if len(moves) != len(tt.want) {
+				t.Fatalf("planBitcoinMoves() = %+v, want %+v", moves, tt.want)
+			}
+			for i, m := range moves {
+				w := tt.want[i]
+				if m.From != w.From || m.To != w.To || m.Amount != w.Amount {
+					t.Errorf("move %d = %s to %s of %d, want %s to %s of %d", i, m.From, m.To, m.Amount, w.From, w.To, w.Amount)
+				}
+			}
+		})
+	}
+}
+
+// A wallet exactly at the edge of its tolerance is left alone. In float64
+// 2 BTC × 1.15 comes to just under 2.3 BTC, which would have moved it.
+func TestPlanBitcoinMovesAtToleranceEdge(t *testing.T) {
+	tolerance := decimal.RequireFromString("0.15")
+	held := bitcoinCustody{hot: 2.3e8, warm: 9.2e8, cold: 88.5e8}
+	if moves := planBitcoinMoves(&held, 0, wallet.DefaultThresholds, tolerance); len(moves) != 0 {
+		t.Errorf("planBitcoinMoves() = %+v, want none", moves)
+	}
+
+	held.hot++
+	moves := planBitcoinMoves(&held, 0, wallet.DefaultThresholds, tolerance)
+	if len(moves) != 1 || moves[0].From != tierHot || moves[0].To != tierCold || moves[0].Amount != 0.3e8+1 {
+		t.Errorf("planBitcoinMoves() = %+v, want hot to cold of %d", moves, int64(0.3e8+1))
+	}
+}
+
+// multiSigKeys returns the compressed public keys of private keys first
+// to first+n-1
+func multiSigKeys(first, n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		var secret [32]byte
+		secret[31] = byte(first + i)
+		_, pub := btcec.PrivKeyFromBytes(secret[:])
+		keys[i] = hex.EncodeToString(pub.SerializeCompressed())
+	}
+	return keys
+}
+
+func newTestRebalancer(t *testing.T, f *builderFixture) (*Rebalancer, *wallet.MultiSigWallet, *wallet.MultiSigWallet) {
+	t.Helper()
+	var wallets []*wallet.MultiSigWallet
+	for i, walletType := range []string{tierWarm, tierCold} {
+		w, err := wallet.NewMultiSigWallet(f.builder.db, f.builder.btcClient, wallet.MultiSigConfig{
+			RequiredSignatures: 2,
+			SignerKeys:         multiSigKeys(1+3*i, 3),
+			WalletType:         walletType,
+			Network:            "mainnet",
+		}, zap.NewNop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		wallets = append(wallets, w)
+	}
+	r := NewRebalancer(f.builder.db, f.builder.btcClient, f.builder, wallets[0], wallets[1], nil, nil,
+		DefaultRebalanceConfig(), zap.NewNop())
+	return r, wallets[0], wallets[1]
+}
+
+var openRebalanceColumns = []string{
+	"id", "from_tier", "to_tier", "amount", "status", "multisig_transaction_id", "bitcoin_transaction_id",
+	"to_address", "output_index", "derivation_path",
+	"multisig_status", "txid", "psbt", "fee_sats", "broadcast_at",
+}
+
+// A hot wallet well short of its 2% is topped up by a warm wallet spend
+// proposed to the warm signers, paying a fresh hot wallet address
+func TestRebalancerProposesWarmTopUp(t *testing.T) {
+	f := newBuilderFixture(t)
+	r, warm, cold := newTestRebalancer(t, f)
+	warmScript, err := addressScript(warm.Address(), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.node.scans = map[string]blockchain.AddressScan{
+		warm.Address(): {Total: "20", Unspents: []blockchain.ScannedOutput{
+			{TxID: testUTXOTxID, Vout: 1, ScriptPubKey: hex.EncodeToString(warmScript), Amount: "20", Height: 799000},
+		}},
+		cold.Address(): {Total: "80"},
+	}
+	msID, rebalanceID := uuid.New(), uuid.New()
+	mock := f.mock
+
+	mock.ExpectQuery("FROM custody_rebalances r").
+		WillReturnRows(pgxmock.NewRows(openRebalanceColumns))
+	mock.ExpectQuery("FROM bitcoin_utxos").
+		WillReturnRows(pgxmock.NewRows([]string{"sum"}).AddRow(int64(1000000)))
+	mock.ExpectQuery("FROM withdrawals").
+		WithArgs("BTC", pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"recent", "queued"}).AddRow(decimal.Zero, decimal.Zero))
+	mock.ExpectQuery("SELECT from_tier FROM custody_rebalances").
+		WithArgs("BTC").
+		WillReturnRows(pgxmock.NewRows([]string{"from_tier"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT next_index FROM hd_index_counters").
+		WithArgs(changeCounter).
+		WillReturnRows(pgxmock.NewRows([]string{"next_index"}).AddRow(int64(5)))
+	mock.ExpectExec("UPDATE hd_index_counters").
+		WithArgs(changeCounter, int64(6)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+	var encoded string
+	mock.ExpectQuery("INSERT INTO multisig_transactions").
+		WithArgs("warm", warm.Address(), pgxmock.AnyArg(), capture{&encoded}, pgxmock.AnyArg(), 2).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(msID, time.Now()))
+	// Total 100.01 BTC; the hot target is 2.0002 BTC
+	path := "m/84'/0'/0'/1/5"
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO custody_rebalances").
+		WithArgs("BTC", tierWarm, tierHot, decimal.New(199020000, 8), &msID, (*uuid.UUID)(nil),
+			pgxmock.AnyArg(), 0, &path, pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(rebalanceID, time.Now()))
+	mock.ExpectCommit()
+
+	if err := r.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(encoded), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packet.UnsignedTx.TxIn) != 1 || len(packet.UnsignedTx.TxOut) != 2 {
+		t.Fatalf("tx has %d inputs and %d outputs, want 1 and 2", len(packet.UnsignedTx.TxIn), len(packet.UnsignedTx.TxOut))
+	}
+	if !strings.EqualFold(hex.EncodeToString(packet.Inputs[0].WitnessScript), hex.EncodeToString(warm.WitnessScript())) {
+		t.Error("input is missing the warm wallet's witness script")
+	}
+	if out := packet.UnsignedTx.TxOut[0]; out.Value != 199020000 {
+		t.Errorf("top-up pays %d sats, want 199020000", out.Value)
+	}
+	// 1 P2WSH 2-of-3 input, the top-up and change back to warm at 10 sat/vB
+	fee, err := packetFee(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee != 1900 {
+		t.Errorf("fee = %d sats, want 1900", fee)
+	}
+	if change := packet.UnsignedTx.TxOut[1]; hex.EncodeToString(change.PkScript) != hex.EncodeToString(warmScript) {
+		t.Error("change does not return to the warm wallet")
+	}
+
+	splits, measuredAt := r.Split()
+	if measuredAt.IsZero() || len(splits) != 1 {
+		t.Fatalf("Split() = %+v, want the Bitcoin split", splits)
+	}
+	if s := splits[0]; !s.Hot.Equal(decimal.New(1000000, 8)) || !s.Cold.Equal(decimal.NewFromInt(80)) || !s.Covered {
+		t.Errorf("split = %+v", s)
+	}
+}
+
+// topUpPacket spends 1 BTC from the warm wallet, paying 0.5 BTC to the hot
+// wallet at output 0 with change, for a 2000 sat fee
+func topUpPacket(t *testing.T, warmScript, hotScript []byte) (*psbt.Packet, string) {
+	t.Helper()
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{7}, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(50000000, hotScript))
+	tx.AddTxOut(wire.NewTxOut(49998000, warmScript))
+	packet, err := psbt.NewFromUnsignedTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet.Inputs[0].WitnessUtxo = wire.NewTxOut(100000000, warmScript)
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet, encoded
+}
+
+// Once the signers' top-up confirms, its output joins the hot wallet's
+// spendable set and the fee is booked
+func TestRebalancerSettlesConfirmedTopUp(t *testing.T) {
+	f := newBuilderFixture(t)
+	r, warm, _ := newTestRebalancer(t, f)
+	warmScript, err := addressScript(warm.Address(), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hotScript := f.depositScript(t, 3)
+	hotAddress, err := scriptAddress(hotScript, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, encoded := topUpPacket(t, warmScript, hotScript)
+	txid := packet.UnsignedTx.TxHash().String()
+	f.node.raw = map[string]int64{txid: 1}
+	id, msID := uuid.New(), uuid.New()
+	broadcastAt := time.Now().Add(-10 * time.Minute)
+	mock := f.mock
+
+	mock.ExpectQuery("FROM custody_rebalances r").
+		WillReturnRows(pgxmock.NewRows(openRebalanceColumns).
+			AddRow(id, tierWarm, tierHot, decimal.RequireFromString("0.5"), "proposed", &msID, (*uuid.UUID)(nil),
+				hotAddress, 0, "m/84'/0'/0'/1/3", "broadcast", txid, encoded, int64(0), &broadcastAt))
+	mock.ExpectExec("UPDATE custody_rebalances").
+		WithArgs(id, txid, &broadcastAt).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO bitcoin_utxos").
+		WithArgs(txid, 0, int64(50000000), hotAddress, hex.EncodeToString(hotScript), "m/84'/0'/0'/1/3").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	fee := decimal.New(2000, 8)
+	expectJournal(mock, "transfer", "rebalance", id, "Custody rebalance",
+		journal.Posting{AccountID: journal.HotWalletAccountID, Currency: "BTC", Amount: fee, EntryType: "fee"},
+		journal.Posting{AccountID: journal.NetworkFeeAccountID, Currency: "BTC", Amount: fee.Neg(), EntryType: "fee"},
+	)
+	mock.ExpectExec("UPDATE custody_rebalances").
+		WithArgs(id, txid, fee).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	if err := r.settleBitcoin(context.Background()); err != nil {
+		t.Fatalf("settleBitcoin() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A rebalance its signers never broadcast is left waiting; one they
+// cancelled is closed
+func TestRebalancerFollowsMultiSigProposal(t *testing.T) {
+	f := newBuilderFixture(t)
+	r, _, _ := newTestRebalancer(t, f)
+	waiting, cancelled := uuid.New(), uuid.New()
+	msID := uuid.New()
+	mock := f.mock
+
+	rows := pgxmock.NewRows(openRebalanceColumns)
+	for _, row := range []struct {
+		id     uuid.UUID
+		status string
+	}{{waiting, "pending"}, {cancelled, "cancelled"}} {
+		rows.AddRow(row.id, tierWarm, tierCold, decimal.NewFromInt(5), "proposed", &msID, (*uuid.UUID)(nil),
+			"bc1q-cold", 0, "", row.status, fmt.Sprintf("%064x", 1), "", int64(0), (*time.Time)(nil))
+	}
+	mock.ExpectQuery("FROM custody_rebalances r").WillReturnRows(rows)
+	mock.ExpectExec("UPDATE custody_rebalances").
+		WithArgs(cancelled).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	if err := r.settleBitcoin(context.Background()); err != nil {
+		t.Fatalf("settleBitcoin() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScannedAmountsInSats(t *testing.T) {
+	for in, want := range map[string]int64{"0": 0, "20": 2000000000, "0.00012345": 12345} {
+		got, err := btcSats(json.Number(in))
+		if err != nil || got != want {
+			t.Errorf("btcSats(%s) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+}
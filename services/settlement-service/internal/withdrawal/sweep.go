@@ -0,0 +1,557 @@
+// BitCurrent Exchange - Deposit Address Sweeping
+package withdrawal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/journal"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrSweepNotFound         = errors.New("sweep not found")
+	ErrSweepNotUnsigned      = errors.New("sweep is not waiting for a signature")
+	ErrInvalidSweepSignature = errors.New("signature is not from the deposit address")
+)
+
+// errNothingToConsolidate rolls back a consolidation not worth building
+var errNothingToConsolidate = errors.New("nothing to consolidate")
+
+// SweepConfig controls when deposit addresses are swept
+type SweepConfig struct {
+	Interval time.Duration
+	// MaxFeeRate is the highest fee estimate, in sat/vB, at which Bitcoin
+	// deposit outputs are consolidated
+	MaxFeeRate int64
+	// MinInputs is how many deposit outputs must be waiting before a
+	// consolidation is built; MaxInputs caps one consolidation
+	MinInputs int
+	MaxInputs int
+	// MinEthAmount and MinTokenAmount are the least credited since the
+	// last sweep for an Ethereum deposit address to be swept
+	MinEthAmount   decimal.Decimal
+	MinTokenAmount decimal.Decimal
+	// Confirmations an Ethereum sweep or gas top-up needs before it is
+	// booked
+	Confirmations int
+	// SignTimeout is how long an Ethereum sweep may wait for its signature
+	// before it is built again at current fees
+	SignTimeout time.Duration
+	// DropAfter is how long a broadcast sweep may go unseen by the node
+	// before it is treated as dropped
+	DropAfter time.Duration
+}
+
+// DefaultSweepConfig returns the sweeping defaults
+func DefaultSweepConfig() SweepConfig {
+	return SweepConfig{
+		Interval:       10 * time.Minute,
+		MaxFeeRate:     5,
+		MinInputs:      20,
+		MaxInputs:      200,
+		MinEthAmount:   decimal.RequireFromString("0.05"),
+		MinTokenAmount: decimal.NewFromInt(100),
+		Confirmations:  12,
+		SignTimeout:    time.Hour,
+		DropAfter:      time.Hour,
+	}
+}
+
+// Sweep is a move of deposited funds into the hot wallet. A Bitcoin sweep
+// consolidates deposit outputs through the PSBT at BitcoinTxID. An Ethereum
+// sweep empties one deposit address; the signer holding the deposit key
+// signs SigningHash, the hash of the unsigned transaction described.
+type Sweep struct {
+	ID          uuid.UUID           `json:"id"`
+	Chain       string              `json:"chain"`
+	Currency    string              `json:"currency"`
+	Amount      decimal.Decimal     `json:"amount"`
+	Fee         decimal.NullDecimal `json:"fee"`
+	Status      string              `json:"status"`
+	BitcoinTxID *uuid.UUID          `json:"bitcoin_transaction_id,omitempty"`
+
+	FromAddress          string  `json:"from_address,omitempty"`
+	DerivationPath       string  `json:"derivation_path,omitempty"`
+	ToAddress            string  `json:"to_address,omitempty"`
+	Nonce                *int64  `json:"nonce,omitempty"`
+	ValueWei             *string `json:"value_wei,omitempty"`
+	Data                 []byte  `json:"data,omitempty"`
+	GasLimit             *int64  `json:"gas_limit,omitempty"`
+	MaxFeePerGas         *string `json:"max_fee_per_gas,omitempty"`
+	MaxPriorityFeePerGas *string `json:"max_priority_fee_per_gas,omitempty"`
+	SigningHash          *string `json:"signing_hash,omitempty"`
+	TxID                 *string `json:"txid,omitempty"`
+
+	TopUpNonce    *int64     `json:"-"`
+	TopUpWei      *string    `json:"topup_wei,omitempty"`
+	FailureReason *string    `json:"failure_reason,omitempty"`
+	BroadcastAt   *time.Time `json:"broadcast_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Sweeper moves deposited funds into the hot wallet. Bitcoin deposit
+// outputs are consolidated into one hot wallet output while fees are low,
+// so withdrawals do not spend from thousands of addresses. ETH and token
+// balances are swept from each Ethereum deposit address once its deposits
+// are settled; a token address is first sent gas from the hot wallet. Every
+// sweep is booked as a transfer between system accounts, with its network
+// fee, so the ledger knows which wallet holds what.
+type Sweeper struct {
+	db        *database.PostgresDB
+	btcClient *blockchain.BitcoinClient
+	builder   *BitcoinTxBuilder
+	ethClient *blockchain.EthereumClient
+	ethTx     *EthereumTxSender
+	tokens    *blockchain.TokenRegistry
+	config    SweepConfig
+	logger    *zap.Logger
+}
+
+// NewSweeper creates a sweeper. Bitcoin consolidation needs builder and
+// Ethereum sweeping needs ethTx; either may be nil to leave that chain
+// alone.
+func NewSweeper(
+	db *database.PostgresDB,
+	btcClient *blockchain.BitcoinClient,
+	builder *BitcoinTxBuilder,
+	ethClient *blockchain.EthereumClient,
+	ethTx *EthereumTxSender,
+	tokens *blockchain.TokenRegistry,
+	cfg SweepConfig,
+	logger *zap.Logger,
+) *Sweeper {
+	defaults := DefaultSweepConfig()
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaults.Interval
+	}
+	if cfg.MaxFeeRate <= 0 {
+		cfg.MaxFeeRate = defaults.MaxFeeRate
+	}
+	if cfg.MinInputs <= 0 {
+		cfg.MinInputs = defaults.MinInputs
+	}
+	if cfg.MaxInputs <= 0 {
+		cfg.MaxInputs = defaults.MaxInputs
+	}
+	if cfg.MinEthAmount.IsZero() {
+		cfg.MinEthAmount = defaults.MinEthAmount
+	}
+	if cfg.MinTokenAmount.IsZero() {
+		cfg.MinTokenAmount = defaults.MinTokenAmount
+	}
+	if cfg.Confirmations <= 0 {
+		cfg.Confirmations = defaults.Confirmations
+	}
+	if cfg.SignTimeout <= 0 {
+		cfg.SignTimeout = defaults.SignTimeout
+	}
+	if cfg.DropAfter <= 0 {
+		cfg.DropAfter = defaults.DropAfter
+	}
+	return &Sweeper{
+		db:        db,
+		btcClient: btcClient,
+		builder:   builder,
+		ethClient: ethClient,
+		ethTx:     ethTx,
+		tokens:    tokens,
+		config:    cfg,
+		logger:    logger,
+	}
+}
+
+// Start runs sweeping passes until ctx is cancelled
+func (s *Sweeper) Start(ctx context.Context) error {
+	s.logger.Info("Starting deposit sweeper",
+		zap.Duration("interval", s.config.Interval),
+		zap.Bool("bitcoin", s.builder != nil),
+		zap.Bool("ethereum", s.ethTx != nil),
+	)
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Deposit sweeper stopped")
+			return ctx.Err()
+
+		case <-ticker.C:
+			if err := s.RunOnce(ctx); err != nil {
+				s.logger.Error("Deposit sweeping failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// RunOnce settles sweeps in flight and starts new ones on each chain
+func (s *Sweeper) RunOnce(ctx context.Context) error {
+	var errs []error
+	if s.builder != nil {
+		if err := s.settleConsolidations(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("bitcoin: %w", err))
+		} else if err := s.consolidate(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("bitcoin: %w", err))
+		}
+	}
+	if s.ethTx != nil {
+		if err := s.settleEthereumSweeps(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("ethereum: %w", err))
+		} else if err := s.sweepEthereum(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("ethereum: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// consolidate builds a consolidation of deposit outputs if fees are low
+// and none is already in flight
+func (s *Sweeper) consolidate(ctx context.Context) error {
+	var open bool
+	if err := s.db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM sweeps WHERE chain = 'bitcoin' AND status IN ('unsigned', 'broadcast')
+		)
+	`).Scan(&open); err != nil {
+		return fmt.Errorf("failed to check open consolidations: %w", err)
+	}
+	if open {
+		return nil
+	}
+
+	feeRate, err := s.builder.feeRate()
+	if err != nil {
+		return err
+	}
+	if feeRate > s.config.MaxFeeRate {
+		s.logger.Debug("Fees too high to consolidate deposit outputs",
+			zap.Int64("fee_rate", feeRate),
+			zap.Int64("max_fee_rate", s.config.MaxFeeRate),
+		)
+		return nil
+	}
+
+	t, err := s.builder.buildConsolidation(ctx, feeRate, s.config.MinInputs, s.config.MaxInputs)
+	if err != nil || t == nil {
+		return err
+	}
+	s.logger.Info("Bitcoin deposit consolidation built",
+		zap.String("id", t.ID.String()),
+		zap.String("txid", t.TxID),
+		zap.Int64("fee_sats", t.Fee),
+		zap.Int64("fee_rate", t.FeeRate),
+	)
+	return nil
+}
+
+// buildConsolidation stores a transaction spending up to maxInputs of the
+// smallest available deposit outputs to one change output, or returns nil
+// if fewer than minInputs are worth spending at feeRate. Like a withdrawal
+// transaction it goes to the signers as a PSBT.
+func (b *BitcoinTxBuilder) buildConsolidation(ctx context.Context, feeRate int64, minInputs, maxInputs int) (*BitcoinTransaction, error) {
+	var result *BitcoinTransaction
+	err := b.db.WithTx(ctx, func(tx pgx.Tx) error {
+		// Deposit addresses are on the external branch; change is already
+		// in one place
+		rows, err := tx.Query(ctx, `
+			SELECT txid, vout, amount_sats, script_pub_key, derivation_path
+			FROM bitcoin_utxos
+			WHERE status = 'available' AND derivation_path ~ '/0/[0-9]+$' AND amount_sats > $1
+			ORDER BY amount_sats
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		`, p2wpkhInputVBytes*feeRate, maxInputs)
+		if err != nil {
+			return fmt.Errorf("failed to load deposit UTXOs: %w", err)
+		}
+		inputs, err := scanUTXOs(rows)
+		if err != nil {
+			return err
+		}
+		if len(inputs) < minInputs {
+			return errNothingToConsolidate
+		}
+
+		var total int64
+		for _, u := range inputs {
+			total += u.Amount
+		}
+		vsize := txOverheadVBytes + int64(len(inputs))*p2wpkhInputVBytes + outputVBytes(p2wpkhScriptLen)
+		fee := vsize * feeRate
+
+		change, err := b.nextChangeOutput(ctx, tx, total-fee)
+		if err != nil {
+			return err
+		}
+		if change.Amount < dustLimit(change.ScriptPubKey) {
+			return errNothingToConsolidate
+		}
+		unsigned, err := unsignedTx(inputs)
+		if err != nil {
+			return err
+		}
+		unsigned.TxOut = []*wire.TxOut{wire.NewTxOut(change.Amount, change.ScriptPubKey)}
+		encoded, err := b.signingPacket(unsigned, inputs, change, 0)
+		if err != nil {
+			return err
+		}
+
+		result = &BitcoinTransaction{
+			TxID:    unsigned.TxHash().String(),
+			PSBT:    encoded,
+			Fee:     fee,
+			FeeRate: feeRate,
+			VSize:   vsize,
+			Status:  "unsigned",
+			Kind:    "consolidation",
+		}
+		if err := storeTransaction(ctx, tx, result); err != nil {
+			return err
+		}
+		if err := spendUTXOs(ctx, tx, inputs, result.ID); err != nil {
+			return err
+		}
+		if err := b.storeChangeOutput(ctx, tx, result.TxID, 0, change); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO sweeps (chain, currency, amount, status, bitcoin_transaction_id)
+			VALUES ('bitcoin', 'BTC', $1, 'unsigned', $2)
+		`, decimal.New(total, 8), result.ID); err != nil {
+			return fmt.Errorf("failed to record sweep: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, errNothingToConsolidate) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// settleConsolidations books mined consolidations and fails those the node
+// has lost. Fee bumping leaves consolidations alone; one stuck at a low
+// rate waits for fees to fall.
+func (s *Sweeper) settleConsolidations(ctx context.Context) error {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT s.id, t.id, t.txid, t.fee_sats, t.broadcast_at
+		FROM sweeps s
+		JOIN bitcoin_transactions t ON t.id = s.bitcoin_transaction_id
+		WHERE s.chain = 'bitcoin' AND s.status = 'broadcast'
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query broadcast consolidations: %w", err)
+	}
+	type consolidation struct {
+		SweepID     uuid.UUID
+		ID          uuid.UUID
+		TxID        string
+		Fee         int64
+		BroadcastAt *time.Time
+	}
+	var open []consolidation
+	for rows.Next() {
+		var c consolidation
+		if err := rows.Scan(&c.SweepID, &c.ID, &c.TxID, &c.Fee, &c.BroadcastAt); err != nil {
+			rows.Close()
+			return err
+		}
+		open = append(open, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range open {
+		raw, err := s.btcClient.GetRawTransaction(c.TxID)
+		if errors.Is(err, blockchain.ErrTransactionNotFound) {
+			if c.BroadcastAt == nil || time.Since(*c.BroadcastAt) < s.config.DropAfter {
+				continue
+			}
+			if err := s.btcClient.AbandonTransaction(c.TxID); err != nil && !errors.Is(err, blockchain.ErrTransactionNotFound) {
+				return fmt.Errorf("failed to abandon consolidation %s: %w", c.TxID, err)
+			}
+			if err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+				if err := releaseBitcoinTransaction(ctx, tx, c.ID); err != nil {
+					return err
+				}
+				return failSweep(ctx, tx, c.SweepID, "transaction dropped", nil)
+			}); err != nil {
+				return err
+			}
+			s.logger.Warn("Bitcoin deposit consolidation dropped",
+				zap.String("sweep_id", c.SweepID.String()),
+				zap.String("txid", c.TxID),
+			)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if raw.Confirmations <= 0 {
+			continue
+		}
+
+		fee := decimal.New(c.Fee, 8)
+		if err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+			if err := confirmBitcoinTransaction(ctx, tx, c.ID); err != nil {
+				return err
+			}
+			// The outputs stay with the hot wallet; only the fee leaves
+			if err := postCustodyJournal(ctx, tx, "sweep", c.SweepID, "Bitcoin deposit consolidation", []journal.Posting{
+				{AccountID: journal.HotWalletAccountID, Currency: "BTC", Amount: fee, EntryType: "fee"},
+				{AccountID: journal.NetworkFeeAccountID, Currency: "BTC", Amount: fee.Neg(), EntryType: "fee"},
+			}); err != nil {
+				return err
+			}
+			return completeSweep(ctx, tx, c.SweepID, fee)
+		}); err != nil {
+			return err
+		}
+		s.logger.Info("Bitcoin deposit consolidation confirmed",
+			zap.String("sweep_id", c.SweepID.String()),
+			zap.String("txid", c.TxID),
+			zap.Int64("fee_sats", c.Fee),
+		)
+	}
+	return nil
+}
+
+// recordConsolidationBroadcast moves a consolidation's sweep on with its
+// transaction
+func recordConsolidationBroadcast(ctx context.Context, tx pgx.Tx, t *BitcoinTransaction) error {
+	if _, err := tx.Exec(ctx, `
+		UPDATE sweeps
+		SET status = 'broadcast', txid = $2, broadcast_at = NOW(), updated_at = NOW()
+		WHERE bitcoin_transaction_id = $1 AND status = 'unsigned'
+	`, t.ID, t.TxID); err != nil {
+		return fmt.Errorf("failed to record sweep broadcast: %w", err)
+	}
+	return nil
+}
+
+// rejectConsolidation fails a consolidation the network would not accept,
+// returning its inputs to the spendable set
+func rejectConsolidation(ctx context.Context, tx pgx.Tx, id uuid.UUID, reason string) error {
+	if err := releaseBitcoinTransaction(ctx, tx, id); err != nil {
+		return err
+	}
+	var sweepID uuid.UUID
+	err := tx.QueryRow(ctx, `
+		SELECT id FROM sweeps WHERE bitcoin_transaction_id = $1
+	`, id).Scan(&sweepID)
+	if err != nil {
+		return fmt.Errorf("failed to find sweep: %w", err)
+	}
+	return failSweep(ctx, tx, sweepID, reason, nil)
+}
+
+// Unsigned returns the sweeps waiting for signatures, oldest first
+func (s *Sweeper) Unsigned(ctx context.Context) ([]Sweep, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+sweepColumns+`
+		FROM sweeps
+		WHERE status = 'unsigned'
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unsigned sweeps: %w", err)
+	}
+	defer rows.Close()
+
+	var sweeps []Sweep
+	for rows.Next() {
+		var sw Sweep
+		if err := rows.Scan(sweepFields(&sw)...); err != nil {
+			return nil, err
+		}
+		sweeps = append(sweeps, sw)
+	}
+	return sweeps, rows.Err()
+}
+
+// Get returns a sweep
+func (s *Sweeper) Get(ctx context.Context, id uuid.UUID) (*Sweep, error) {
+	sw := &Sweep{}
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT `+sweepColumns+`
+		FROM sweeps
+		WHERE id = $1
+	`, id).Scan(sweepFields(sw)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSweepNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+const sweepColumns = `id, chain, currency, amount, fee, status, bitcoin_transaction_id,
+	COALESCE(from_address, ''), COALESCE(derivation_path, ''), COALESCE(to_address, ''), nonce, value_wei::text, data, gas_limit,
+	max_fee_per_gas::text, max_priority_fee_per_gas::text, signing_hash, txid,
+	topup_nonce, topup_wei::text, failure_reason, broadcast_at, created_at`
+
+// sweepFields returns the scan targets for sweepColumns
+func sweepFields(sw *Sweep) []interface{} {
+	return []interface{}{
+		&sw.ID, &sw.Chain, &sw.Currency, &sw.Amount, &sw.Fee, &sw.Status, &sw.BitcoinTxID,
+		&sw.FromAddress, &sw.DerivationPath, &sw.ToAddress, &sw.Nonce, &sw.ValueWei, &sw.Data, &sw.GasLimit,
+		&sw.MaxFeePerGas, &sw.MaxPriorityFeePerGas, &sw.SigningHash, &sw.TxID,
+		&sw.TopUpNonce, &sw.TopUpWei, &sw.FailureReason, &sw.BroadcastAt, &sw.CreatedAt,
+	}
+}
+
+// completeSweep marks a sweep confirmed with the fee it paid
+func completeSweep(ctx context.Context, tx pgx.Tx, id uuid.UUID, fee decimal.Decimal) error {
+	if _, err := tx.Exec(ctx, `
+		UPDATE sweeps
+		SET status = 'confirmed', fee = $2, completed_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, id, fee); err != nil {
+		return fmt.Errorf("failed to complete sweep: %w", err)
+	}
+	return nil
+}
+
+// failSweep marks a sweep failed, with the fee it paid if it was mined
+func failSweep(ctx context.Context, tx pgx.Tx, id uuid.UUID, reason string, fee *decimal.Decimal) error {
+	if _, err := tx.Exec(ctx, `
+		UPDATE sweeps
+		SET status = 'failed', failure_reason = $2, fee = $3, completed_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, id, reason, fee); err != nil {
+		return fmt.Errorf("failed to fail sweep: %w", err)
+	}
+	return nil
+}
+
+// postCustodyJournal books movements of the exchange's own funds between
+// system accounts as one transfer journal referring to the sweep or
+// rebalance behind them. Sweeps move funds between the accounts standing
+// for where they are held, so the ledger follows them from deposit
+// addresses to the hot wallet.
+func postCustodyJournal(ctx context.Context, tx pgx.Tx, referenceType string, referenceID uuid.UUID, description string, postings []journal.Posting) error {
+	_, err := journal.Post(ctx, tx, &journal.Journal{
+		Type:          journal.TypeTransfer,
+		ReferenceType: &referenceType,
+		ReferenceID:   &referenceID,
+		Description:   description,
+		Postings:      journal.NonZero(postings...),
+	})
+	return err
+}
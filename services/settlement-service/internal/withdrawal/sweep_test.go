@@ -0,0 +1,250 @@
+package withdrawal
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/blockchain"
+	"github.com/bitcurrent-exchange/platform/services/settlement-service/internal/wallet"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+func newTestSweeper(t *testing.T, node *ethNode) (*Sweeper, pgxmock.PgxPoolIface) {
+	t.Helper()
+	sender, mock := newTestSender(t, node)
+	tokens, err := blockchain.NewTokenRegistry(blockchain.MainnetTokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSweeper(sender.db, nil, nil, sender.client, sender, tokens, DefaultSweepConfig(), zap.NewNop()), mock
+}
+
+// depositKey stands in for the offline key of one deposit address
+func depositKey(t *testing.T) *wallet.EthereumKeySigner {
+	t.Helper()
+	key, err := wallet.NewEthereumKeySigner(strings.Repeat("11", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestBuildConsolidationSpendsDepositOutputs(t *testing.T) {
+	f := newBuilderFixture(t)
+	id := uuid.New()
+	mock := f.mock
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM bitcoin_utxos").
+		WithArgs(int64(136), 200).
+		WillReturnRows(pgxmock.NewRows([]string{"txid", "vout", "amount_sats", "script_pub_key", "derivation_path"}).
+			AddRow(testUTXOTxID, int64(0), int64(30000), hex.EncodeToString(f.depositScript(t, 0)), "m/84'/0'/0'/0/0").
+			AddRow(testUTXOTxID, int64(1), int64(50000), hex.EncodeToString(f.depositScript(t, 1)), "m/84'/0'/0'/0/1"))
+	mock.ExpectQuery("SELECT next_index FROM hd_index_counters").
+		WithArgs(changeCounter).
+		WillReturnRows(pgxmock.NewRows([]string{"next_index"}).AddRow(int64(0)))
+	mock.ExpectExec("UPDATE hd_index_counters").
+		WithArgs(changeCounter, int64(1)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	// 2 inputs and 1 output: 11 + 2*68 + 31 vB at 2 sat/vB
+	mock.ExpectQuery("INSERT INTO bitcoin_transactions").
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), int64(356), int64(2), int64(178), "consolidation", (*uuid.UUID)(nil)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(id, time.Now()))
+	mock.ExpectExec("UPDATE bitcoin_utxos").
+		WithArgs(testUTXOTxID, int64(0), id).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("UPDATE bitcoin_utxos").
+		WithArgs(testUTXOTxID, int64(1), id).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("INSERT INTO bitcoin_utxos").
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), int64(80000-356),
+			"bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el", pgxmock.AnyArg(), "m/84'/0'/0'/1/0").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("INSERT INTO sweeps").
+		WithArgs(decimal.New(80000, 8), id).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	btx, err := f.builder.buildConsolidation(context.Background(), 2, 2, 200)
+	if err != nil {
+		t.Fatalf("buildConsolidation() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(btx.PSBT), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packet.UnsignedTx.TxIn) != 2 || len(packet.UnsignedTx.TxOut) != 1 {
+		t.Fatalf("tx has %d inputs and %d outputs, want 2 and 1", len(packet.UnsignedTx.TxIn), len(packet.UnsignedTx.TxOut))
+	}
+	if out := packet.UnsignedTx.TxOut[0]; out.Value != 80000-356 || len(packet.Outputs[0].Bip32Derivation) != 1 {
+		t.Errorf("output = %+v, want 79644 sats to marked change", out)
+	}
+}
+
+func TestBuildConsolidationWaitsForEnoughInputs(t *testing.T) {
+	f := newBuilderFixture(t)
+	f.mock.ExpectBegin()
+	f.mock.ExpectQuery("FROM bitcoin_utxos").
+		WithArgs(int64(136), 200).
+		WillReturnRows(pgxmock.NewRows([]string{"txid", "vout", "amount_sats", "script_pub_key", "derivation_path"}).
+			AddRow(testUTXOTxID, int64(0), int64(30000), hex.EncodeToString(f.depositScript(t, 0)), "m/84'/0'/0'/0/0"))
+	f.mock.ExpectRollback()
+
+	btx, err := f.builder.buildConsolidation(context.Background(), 2, 20, 200)
+	if btx != nil || err != nil {
+		t.Errorf("buildConsolidation() = %v, %v, want nothing to consolidate", btx, err)
+	}
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSweeperTopsUpTokenAddressGas(t *testing.T) {
+	node := &ethNode{tokens: 250000000}
+	sweeper, mock := newTestSweeper(t, node)
+	deposit := depositKey(t)
+	id := uuid.New()
+
+	// The token transfer needs 21000 gas plus a quarter at 52 gwei, and the
+	// address holds no ETH
+	var txid string
+	mock.ExpectBegin()
+	expectFreshNonce(mock, 0, 0, nil)
+	mock.ExpectExec("UPDATE ethereum_nonces").
+		WithArgs(hotWalletAddress, int64(0), capture{&txid}, deposit.Address(), "1365000000000000", []byte(nil),
+			int64(21000), "52000000000", "2000000000").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery("INSERT INTO sweeps").
+		WithArgs("ethereum", "USDC", pgxmock.AnyArg(), "funding", deposit.Address(), "m/44'/60'/0'/0/7", "",
+			pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(),
+			pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(id, time.Now()))
+	mock.ExpectCommit()
+
+	sw := &Sweep{Chain: wallet.ChainEthereum, Currency: "USDC", FromAddress: deposit.Address(), DerivationPath: "m/44'/60'/0'/0/7"}
+	if err := sweeper.prepareEthereumSweep(context.Background(), sw); err != nil {
+		t.Fatalf("prepareEthereumSweep() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if len(node.sent) != 1 || txid == "" {
+		t.Errorf("%d transactions broadcast, want the gas top-up", len(node.sent))
+	}
+	if sw.ID != id || sw.Status != "funding" || sw.TopUpNonce == nil || *sw.TopUpNonce != 0 || *sw.TopUpWei != "1365000000000000" {
+		t.Errorf("sweep = %+v, want funding by nonce 0 with 1365000000000000 wei", sw)
+	}
+	if !sw.Amount.Equal(decimal.NewFromInt(250)) {
+		t.Errorf("sweep amount = %s, want 250", sw.Amount)
+	}
+}
+
+// unsignedSweep is an ETH sweep of from waiting for its signature
+func unsignedSweep(from string) *Sweep {
+	nonce, gas := int64(3), int64(21000)
+	value, feeCap, tipCap, hash := "98908000000000000", "52000000000", "2000000000", "0x"+strings.Repeat("ab", 32)
+	return &Sweep{
+		ID: uuid.New(), Chain: wallet.ChainEthereum, Currency: "ETH", Amount: decimal.RequireFromString("0.098908"),
+		Status: "unsigned", FromAddress: from, DerivationPath: "m/44'/60'/0'/0/7", ToAddress: hotWalletAddress,
+		Nonce: &nonce, ValueWei: &value, GasLimit: &gas, MaxFeePerGas: &feeCap, MaxPriorityFeePerGas: &tipCap,
+		SigningHash: &hash, CreatedAt: time.Now(),
+	}
+}
+
+func expectSweepRow(mock pgxmock.PgxPoolIface, sw *Sweep) {
+	mock.ExpectQuery("FROM sweeps").
+		WithArgs(sw.ID).
+		WillReturnRows(pgxmock.NewRows([]string{
+			"id", "chain", "currency", "amount", "fee", "status", "bitcoin_transaction_id",
+			"from_address", "derivation_path", "to_address", "nonce", "value_wei", "data", "gas_limit",
+			"max_fee_per_gas", "max_priority_fee_per_gas", "signing_hash", "txid",
+			"topup_nonce", "topup_wei", "failure_reason", "broadcast_at", "created_at",
+		}).AddRow(
+			sw.ID, sw.Chain, sw.Currency, sw.Amount, sw.Fee, sw.Status, sw.BitcoinTxID,
+			sw.FromAddress, sw.DerivationPath, sw.ToAddress, sw.Nonce, sw.ValueWei, sw.Data, sw.GasLimit,
+			sw.MaxFeePerGas, sw.MaxPriorityFeePerGas, sw.SigningHash, sw.TxID,
+			sw.TopUpNonce, sw.TopUpWei, sw.FailureReason, sw.BroadcastAt, sw.CreatedAt,
+		))
+}
+
+// signSweep signs sw's transaction with key, as the offline signer would
+func signSweep(t *testing.T, key *wallet.EthereumKeySigner, sw *Sweep) []byte {
+	t.Helper()
+	tx, err := sw.transaction(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := tx.SigningHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := key.SignHash(context.Background(), hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestSweeperSubmitSignatureBroadcastsSweep(t *testing.T) {
+	node := &ethNode{}
+	sweeper, mock := newTestSweeper(t, node)
+	deposit := depositKey(t)
+	sw := unsignedSweep(deposit.Address())
+
+	var txid string
+	now := time.Now()
+	mock.ExpectBegin()
+	expectSweepRow(mock, sw)
+	mock.ExpectQuery("SET status = 'broadcast'").
+		WithArgs(sw.ID, capture{&txid}).
+		WillReturnRows(pgxmock.NewRows([]string{"broadcast_at"}).AddRow(&now))
+	mock.ExpectCommit()
+
+	got, err := sweeper.SubmitSignature(context.Background(), sw.ID, signSweep(t, deposit, sw))
+	if err != nil {
+		t.Fatalf("SubmitSignature() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if got.Status != "broadcast" || got.TxID == nil || *got.TxID != txid || len(node.sent) != 1 {
+		t.Errorf("SubmitSignature() = %+v after %d broadcasts, want broadcast once as %s", got, len(node.sent), txid)
+	}
+}
+
+func TestSweeperSubmitSignatureRefusesOtherKey(t *testing.T) {
+	node := &ethNode{}
+	sweeper, mock := newTestSweeper(t, node)
+	sw := unsignedSweep(depositKey(t).Address())
+	other, err := wallet.NewEthereumKeySigner(strings.Repeat("46", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	expectSweepRow(mock, sw)
+	mock.ExpectRollback()
+
+	_, err = sweeper.SubmitSignature(context.Background(), sw.ID, signSweep(t, other, sw))
+	if !errors.Is(err, ErrInvalidSweepSignature) {
+		t.Errorf("SubmitSignature() error = %v, want ErrInvalidSweepSignature", err)
+	}
+	if len(node.sent) != 0 {
+		t.Error("sweep signed by another key was broadcast")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,126 @@
+// BitCurrent Exchange - JWT Authentication
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidToken is returned for malformed or badly signed tokens
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken is returned when a token is past its expiry
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Roles carried in Claims.Role. Admins are users with users.is_admin set.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Claims are the custom JWT claims issued by the API gateway
+type Claims struct {
+	UserID    uuid.UUID `json:"user_id"`
+	AccountID uuid.UUID `json:"account_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	KYCLevel  int       `json:"kyc_level"`
+	jwt.RegisteredClaims
+}
+
+// JWTManager issues and validates HMAC-SHA256 signed tokens
+type JWTManager struct {
+	secret []byte
+	issuer string
+	expiry time.Duration
+	now    func() time.Time
+}
+
+// NewJWTManager creates a new JWT manager
+func NewJWTManager(secret, issuer string, expiry time.Duration) *JWTManager {
+	return &JWTManager{
+		secret: []byte(secret),
+		issuer: issuer,
+		expiry: expiry,
+		now:    time.Now,
+	}
+}
+
+// GenerateToken issues a signed token for a user
+func (m *JWTManager) GenerateToken(userID, accountID uuid.UUID, email, role string, kycLevel int) (string, error) {
+	if len(m.secret) == 0 {
+		return "", errors.New("jwt secret is not configured")
+	}
+
+	now := m.now()
+	claims := &Claims{
+		UserID:    userID,
+		AccountID: accountID,
+		Email:     email,
+		Role:      role,
+		KYCLevel:  kycLevel,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    m.issuer,
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.expiry)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(m.secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return signed, nil
+}
+
+// ValidateToken parses a token and verifies its signature, issuer and expiry
+func (m *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, m.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(m.now),
+	)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.UserID == uuid.Nil {
+		return nil, fmt.Errorf("%w: missing user id", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// RefreshToken validates an existing token and issues a new one with the
+// same identity claims and a fresh expiry
+func (m *JWTManager) RefreshToken(tokenString string) (string, error) {
+	claims, err := m.ValidateToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+
+	return m.GenerateToken(claims.UserID, claims.AccountID, claims.Email, claims.Role, claims.KYCLevel)
+}
+
+func (m *JWTManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return m.secret, nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestJWTRoundTrip(t *testing.T) {
+	m := NewJWTManager("test-secret", "bitcurrent", time.Hour)
+	userID, accountID := uuid.New(), uuid.New()
+
+	token, err := m.GenerateToken(userID, accountID, "alice@example.com", "user", 2)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+
+	claims, err := m.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	if claims.UserID != userID || claims.AccountID != accountID {
+		t.Errorf("claims ids = %s/%s, want %s/%s", claims.UserID, claims.AccountID, userID, accountID)
+	}
+	if claims.Email != "alice@example.com" || claims.Role != "user" || claims.KYCLevel != 2 {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestJWTExpired(t *testing.T) {
+	m := NewJWTManager("test-secret", "bitcurrent", time.Minute)
+	issued := time.Now().Add(-time.Hour)
+	m.now = func() time.Time { return issued }
+
+	token, err := m.GenerateToken(uuid.New(), uuid.New(), "a@b.c", "user", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.now = time.Now
+	if _, err := m.ValidateToken(token); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("ValidateToken() error = %v, want ErrExpiredToken", err)
+	}
+}
+
+func TestJWTRejectsWrongSecretAndIssuer(t *testing.T) {
+	token, err := NewJWTManager("secret-a", "bitcurrent", time.Hour).
+		GenerateToken(uuid.New(), uuid.New(), "a@b.c", "user", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewJWTManager("secret-b", "bitcurrent", time.Hour).ValidateToken(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("wrong secret: error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := NewJWTManager("secret-a", "someone-else", time.Hour).ValidateToken(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("wrong issuer: error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestJWTRefresh(t *testing.T) {
+	m := NewJWTManager("test-secret", "bitcurrent", time.Hour)
+	userID := uuid.New()
+
+	token, err := m.GenerateToken(userID, uuid.New(), "a@b.c", "admin", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refreshed, err := m.RefreshToken(token)
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+
+	claims, err := m.ValidateToken(refreshed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != userID || claims.Role != "admin" || claims.KYCLevel != 3 {
+		t.Errorf("refreshed claims lost identity: %+v", claims)
+	}
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// RFC 6238 Appendix B test secret (ASCII "12345678901234567890")
+var rfc6238Secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit values; the 6-digit code is the low-order 6 digits.
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	m := NewTOTPManager("BitCurrent")
+	for _, v := range vectors {
+		m.now = func() time.Time { return time.Unix(v.unix, 0) }
+		ok, err := m.ValidateCode(rfc6238Secret, v.code)
+		if err != nil {
+			t.Fatalf("T=%d: ValidateCode() error = %v", v.unix, err)
+		}
+		if !ok {
+			t.Errorf("T=%d: code %s rejected", v.unix, v.code)
+		}
+	}
+}
+
+func TestTOTPSkewWindow(t *testing.T) {
+	m := NewTOTPManager("BitCurrent")
+
+	// Code for T=59 is still accepted one step later but not two
+	m.now = func() time.Time { return time.Unix(59+30, 0) }
+	if ok, _ := m.ValidateCode(rfc6238Secret, "287082"); !ok {
+		t.Error("code rejected within one step of skew")
+	}
+	m.now = func() time.Time { return time.Unix(59+90, 0) }
+	if ok, _ := m.ValidateCode(rfc6238Secret, "287082"); ok {
+		t.Error("code accepted outside skew window")
+	}
+}
+
+func TestTOTPGeneratedSecretValidates(t *testing.T) {
+	m := NewTOTPManager("BitCurrent")
+	secret, err := m.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := decodeSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := hotp(key, uint64(m.now().Unix()/30), totpDigits)
+
+	if ok, err := m.ValidateCode(secret, code); err != nil || !ok {
+		t.Errorf("ValidateCode() = %v, %v; want true", ok, err)
+	}
+	if _, err := m.ValidateCode("not base32!", code); err == nil {
+		t.Error("expected error for malformed secret")
+	}
+}
+
+func TestTOTPQRCodeURL(t *testing.T) {
+	m := NewTOTPManager("BitCurrent")
+	raw := m.GenerateQRCodeURL("alice@example.com", "JBSWY3DPEHPK3PXP")
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("unexpected URL %s", raw)
+	}
+	if got := u.Query().Get("secret"); got != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("secret = %q", got)
+	}
+	if got := u.Query().Get("issuer"); got != "BitCurrent" {
+		t.Errorf("issuer = %q", got)
+	}
+}
+
+func TestTOTPBackupCodes(t *testing.T) {
+	codes, err := NewTOTPManager("BitCurrent").GenerateBackupCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("got %d codes, want 10", len(codes))
+	}
+
+	pattern := regexp.MustCompile(`^[A-Z2-9]{4}-[A-Z2-9]{4}$`)
+	seen := make(map[string]bool)
+	for _, c := range codes {
+		if !pattern.MatchString(c) {
+			t.Errorf("code %q has unexpected format", c)
+		}
+		if seen[c] {
+			t.Errorf("duplicate code %q", c)
+		}
+		seen[c] = true
+	}
+}
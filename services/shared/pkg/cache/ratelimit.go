@@ -0,0 +1,57 @@
+// BitCurrent Exchange - Redis Rate Limiter
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RateLimiter implements a fixed-window request counter in Redis.
+// Counters are shared across replicas so limits hold cluster-wide.
+type RateLimiter struct {
+	cache  *RedisCache
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// NewRateLimiter creates a new rate limiter backed by cache
+func NewRateLimiter(cache *RedisCache, logger *zap.Logger) *RateLimiter {
+	return &RateLimiter{
+		cache:  cache,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Allow records a request against key and reports whether it is within
+// limit requests per window.
+func (l *RateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	if limit <= 0 || window <= 0 {
+		return false, fmt.Errorf("invalid rate limit: %d per %s", limit, window)
+	}
+
+	windowStart := l.now().UnixNano() / int64(window)
+	windowKey := fmt.Sprintf("%s:%d", key, windowStart)
+
+	pipe := l.cache.client.TxPipeline()
+	incr := pipe.Incr(ctx, windowKey)
+	pipe.Expire(ctx, windowKey, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+
+	count := incr.Val()
+	if count > int64(limit) {
+		l.logger.Debug("Rate limit reached",
+			zap.String("key", key),
+			zap.Int64("count", count),
+			zap.Int("limit", limit),
+		)
+		return false, nil
+	}
+
+	return true, nil
+}
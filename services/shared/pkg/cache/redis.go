@@ -0,0 +1,140 @@
+// BitCurrent Exchange - Shared Redis Cache
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// ErrCacheMiss is returned when a key does not exist
+var ErrCacheMiss = errors.New("cache: key not found")
+
+// Config holds Redis configuration
+type Config struct {
+	URL         string
+	Password    string
+	PoolSize    int
+	MinIdleConn int
+	MaxRetries  int
+}
+
+// RedisCache wraps a Redis client
+type RedisCache struct {
+	client *redis.Client
+	logger *zap.Logger
+}
+
+// NewRedisCache connects to Redis and verifies connectivity
+func NewRedisCache(cfg Config, logger *zap.Logger) (*RedisCache, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("redis URL is required")
+	}
+
+	opts, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+
+	if cfg.Password != "" {
+		opts.Password = cfg.Password
+	}
+	if cfg.PoolSize > 0 {
+		opts.PoolSize = cfg.PoolSize
+	}
+	if cfg.MinIdleConn > 0 {
+		opts.MinIdleConns = cfg.MinIdleConn
+	}
+	if cfg.MaxRetries > 0 {
+		opts.MaxRetries = cfg.MaxRetries
+	}
+
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to ping redis: %w", err)
+	}
+
+	logger.Info("Connected to Redis", zap.String("addr", opts.Addr), zap.Int("db", opts.DB))
+
+	return &RedisCache{
+		client: client,
+		logger: logger,
+	}, nil
+}
+
+// Client exposes the underlying Redis client
+func (c *RedisCache) Client() *redis.Client {
+	return c.client
+}
+
+// Get returns the raw string value for key
+func (c *RedisCache) Get(ctx context.Context, key string) (string, error) {
+	val, err := c.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrCacheMiss
+	}
+	return val, err
+}
+
+// Set stores a raw value with a TTL (0 means no expiry)
+func (c *RedisCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+// SetNX stores a value only if the key does not already exist
+func (c *RedisCache) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return c.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+// Delete removes keys
+func (c *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	return c.client.Del(ctx, keys...).Err()
+}
+
+// GetJSON decodes a JSON value stored at key into dest.
+// Returns ErrCacheMiss if the key does not exist.
+func (c *RedisCache) GetJSON(ctx context.Context, key string, dest interface{}) error {
+	data, err := c.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ErrCacheMiss
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("failed to decode cached value: %w", err)
+	}
+
+	return nil
+}
+
+// SetJSON encodes value as JSON and stores it with a TTL
+func (c *RedisCache) SetJSON(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode value: %w", err)
+	}
+
+	return c.client.Set(ctx, key, data, ttl).Err()
+}
+
+// Health checks Redis connectivity
+func (c *RedisCache) Health(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+// Close closes the Redis client
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"go.uber.org/zap"
+)
+
+func newTestCache(t *testing.T) (*RedisCache, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	c, err := NewRedisCache(Config{URL: "redis://" + mr.Addr()}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewRedisCache() error = %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, mr
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	c, mr := newTestCache(t)
+	ctx := context.Background()
+
+	type ticker struct {
+		Symbol string `json:"symbol"`
+		Last   string `json:"last"`
+	}
+
+	if err := c.SetJSON(ctx, "ticker:BTC-GBP", ticker{"BTC-GBP", "50000.00"}, time.Minute); err != nil {
+		t.Fatalf("SetJSON() error = %v", err)
+	}
+
+	var got ticker
+	if err := c.GetJSON(ctx, "ticker:BTC-GBP", &got); err != nil {
+		t.Fatalf("GetJSON() error = %v", err)
+	}
+	if got.Last != "50000.00" {
+		t.Errorf("Last = %q, want 50000.00", got.Last)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if err := c.GetJSON(ctx, "ticker:BTC-GBP", &got); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("GetJSON() after expiry error = %v, want ErrCacheMiss", err)
+	}
+}
+
+func TestGetMiss(t *testing.T) {
+	c, _ := newTestCache(t)
+	if _, err := c.Get(context.Background(), "missing"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("Get() error = %v, want ErrCacheMiss", err)
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+
+	now := time.Unix(1_700_000_000, 0)
+	limiter := NewRateLimiter(c, zap.NewNop())
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, err := limiter.Allow(ctx, "ratelimit:1.2.3.4", 3, time.Minute)
+		if err != nil || !ok {
+			t.Fatalf("request %d: Allow() = %v, %v; want true", i+1, ok, err)
+		}
+	}
+
+	ok, err := limiter.Allow(ctx, "ratelimit:1.2.3.4", 3, time.Minute)
+	if err != nil || ok {
+		t.Fatalf("4th request: Allow() = %v, %v; want false", ok, err)
+	}
+
+	// A new window resets the counter
+	now = now.Add(time.Minute)
+	ok, err = limiter.Allow(ctx, "ratelimit:1.2.3.4", 3, time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("next window: Allow() = %v, %v; want true", ok, err)
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv(EnvConfigFile, "")
+	t.Chdir(t.TempDir())
+
+	if err := Load("test-service"); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := GetString("service.name"); got != "test-service" {
+		t.Errorf("service.name = %q, want %q", got, "test-service")
+	}
+	if got := GetInt("server.port"); got != 8080 {
+		t.Errorf("server.port = %d, want 8080", got)
+	}
+	if got := GetDuration("jwt.expiry"); got != 24*time.Hour {
+		t.Errorf("jwt.expiry = %s, want 24h", got)
+	}
+}
+
+func TestLoadFileAndEnvOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	contents := []byte("server:\n  port: 9000\ndatabase:\n  url: postgresql://file/db\n")
+	if err := os.WriteFile(path, contents, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(EnvConfigFile, path)
+	t.Setenv("DATABASE_URL", "postgresql://env/db")
+
+	if err := Load("test-service"); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := GetInt("server.port"); got != 9000 {
+		t.Errorf("server.port = %d, want 9000 from file", got)
+	}
+	if got := GetString("database.url"); got != "postgresql://env/db" {
+		t.Errorf("database.url = %q, want env override", got)
+	}
+}
+
+func TestLoadInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("server: [unclosed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvConfigFile, path)
+
+	if err := Load("test-service"); err == nil {
+		t.Fatal("Load() expected error for malformed config")
+	}
+}
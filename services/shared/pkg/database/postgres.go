@@ -0,0 +1,127 @@
+// BitCurrent Exchange - Shared PostgreSQL Connection Pool
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// Config holds PostgreSQL pool configuration
+type Config struct {
+	URL             string
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+}
+
+// Pool is the subset of *pgxpool.Pool the services rely on.
+// Keeping it an interface lets tests substitute an in-memory stand-in
+// such as pgxmock without a running database.
+type Pool interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Ping(ctx context.Context) error
+	Close()
+}
+
+// PostgresDB wraps a PostgreSQL connection pool
+type PostgresDB struct {
+	Pool   Pool
+	logger *zap.Logger
+}
+
+// NewPostgresDB creates a connection pool and verifies connectivity
+func NewPostgresDB(cfg Config, logger *zap.Logger) (*PostgresDB, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("database URL is required")
+	}
+
+	poolCfg, err := pgxpool.ParseConfig(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolCfg.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	logger.Info("Connected to PostgreSQL",
+		zap.String("host", poolCfg.ConnConfig.Host),
+		zap.String("database", poolCfg.ConnConfig.Database),
+		zap.Int32("max_conns", poolCfg.MaxConns),
+	)
+
+	return New(pool, logger), nil
+}
+
+// New wraps an existing pool
+func New(pool Pool, logger *zap.Logger) *PostgresDB {
+	return &PostgresDB{
+		Pool:   pool,
+		logger: logger,
+	}
+}
+
+// Health checks database connectivity
+func (db *PostgresDB) Health(ctx context.Context) error {
+	return db.Pool.Ping(ctx)
+}
+
+// WithTx runs fn inside a transaction, committing on success and rolling
+// back on error or panic.
+func (db *PostgresDB) WithTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the connection pool
+func (db *PostgresDB) Close() {
+	db.Pool.Close()
+	db.logger.Info("PostgreSQL connection pool closed")
+}
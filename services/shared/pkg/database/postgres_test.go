@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+func newMockDB(t *testing.T) (*PostgresDB, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+	return New(mock, zap.NewNop()), mock
+}
+
+func TestNewPostgresDBRequiresURL(t *testing.T) {
+	if _, err := NewPostgresDB(Config{}, zap.NewNop()); err == nil {
+		t.Fatal("expected error for empty URL")
+	}
+}
+
+func TestHealth(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectPing()
+
+	if err := db.Health(context.Background()); err != nil {
+		t.Fatalf("Health() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithTxCommits(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE wallets").WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	err := db.WithTx(context.Background(), func(tx pgx.Tx) error {
+		_, err := tx.Exec(context.Background(), "UPDATE wallets SET balance = 0")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	wantErr := errors.New("boom")
+	err := db.WithTx(context.Background(), func(tx pgx.Tx) error {
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("WithTx() error = %v, want %v", err, wantErr)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
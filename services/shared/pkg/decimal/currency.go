@@ -0,0 +1,75 @@
+// BitCurrent Exchange - Per-Currency Precision
+package decimal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultScale is used for currencies without an explicit entry
+const DefaultScale int32 = 8
+
+// currencyScales holds the smallest unit of each supported asset
+var currencyScales = map[string]int32{
+	"BTC":   8,  // satoshi
+	"ETH":   18, // wei
+	"MATIC": 18,
+	"SOL":   9, // lamport
+	"ADA":   6, // lovelace
+	"USDT":  6,
+	"USDC":  6,
+	"GBP":   2, // pence
+	"EUR":   2,
+	"USD":   2,
+}
+
+// ScaleOf returns the number of decimal places for currency
+func ScaleOf(currency string) int32 {
+	if scale, ok := currencyScales[strings.ToUpper(currency)]; ok {
+		return scale
+	}
+	return DefaultScale
+}
+
+// RegisterCurrency sets the scale for a currency, e.g. for a newly listed
+// token. It is not safe to call concurrently with other functions in this
+// package and is intended for startup only.
+func RegisterCurrency(currency string, scale int32) {
+	currencyScales[strings.ToUpper(currency)] = scale
+}
+
+// ParseAmount parses s as an amount of currency, rejecting values with more
+// decimal places than the currency supports (e.g. 0.123 GBP). The result is
+// returned at the currency's scale.
+func ParseAmount(s, currency string) (Decimal, error) {
+	d, err := NewFromString(s)
+	if err != nil {
+		return Decimal{}, err
+	}
+
+	if err := CheckPrecision(d, currency); err != nil {
+		return Decimal{}, err
+	}
+
+	return d.Round(ScaleOf(currency), RoundDown), nil
+}
+
+// CheckPrecision returns ErrPrecisionLoss if d has more decimal places than
+// currency supports. Trailing zeros are allowed.
+func CheckPrecision(d Decimal, currency string) error {
+	scale := ScaleOf(currency)
+	if !d.Round(scale, RoundDown).Equal(d) {
+		return fmt.Errorf("%w: %s supports %d decimal places", ErrPrecisionLoss, strings.ToUpper(currency), scale)
+	}
+	return nil
+}
+
+// RoundCurrency rounds d to the scale of currency
+func (d Decimal) RoundCurrency(currency string, mode RoundingMode) Decimal {
+	return d.Round(ScaleOf(currency), mode)
+}
+
+// StringCurrency formats d at the scale of currency, rounding half-up
+func (d Decimal) StringCurrency(currency string) string {
+	return d.StringFixed(ScaleOf(currency))
+}
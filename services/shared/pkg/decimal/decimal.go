@@ -0,0 +1,323 @@
+// BitCurrent Exchange - Fixed-Precision Decimal Arithmetic
+//
+// Package decimal provides an exact decimal type for money. Values are an
+// arbitrary-precision integer coefficient plus a scale (digits after the
+// decimal point), so 0.1 + 0.2 is exactly 0.3 and amounts survive the round
+// trip through PostgreSQL NUMERIC without float rounding.
+package decimal
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidDecimal is returned when a string cannot be parsed
+	ErrInvalidDecimal = errors.New("decimal: invalid value")
+	// ErrDivisionByZero is returned by Div when the divisor is zero
+	ErrDivisionByZero = errors.New("decimal: division by zero")
+	// ErrPrecisionLoss is returned when a value has more decimal places
+	// than the target scale allows
+	ErrPrecisionLoss = errors.New("decimal: value exceeds allowed precision")
+)
+
+// maxScale bounds parsed exponents so hostile input like "1e-999999999"
+// cannot force huge allocations
+const maxScale = 1000
+
+// Zero is the zero value; the uninitialised Decimal{} is also zero
+var Zero = Decimal{}
+
+// Decimal is an immutable fixed-point number: coef × 10^-scale.
+// All operations return new values and never modify their operands.
+type Decimal struct {
+	coef  *big.Int
+	scale int32
+}
+
+// New returns coef × 10^-scale, e.g. New(150, 2) is 1.50
+func New(coef int64, scale int32) Decimal {
+	if scale < 0 {
+		return NewFromBigInt(big.NewInt(coef), scale)
+	}
+	return Decimal{coef: big.NewInt(coef), scale: scale}
+}
+
+// NewFromInt returns an integer value with scale 0
+func NewFromInt(v int64) Decimal {
+	return Decimal{coef: big.NewInt(v)}
+}
+
+// NewFromBigInt returns v × 10^-scale. It is the inverse of MinorUnits and is
+// used to convert satoshis (scale 8) or wei (scale 18) to whole units.
+func NewFromBigInt(v *big.Int, scale int32) Decimal {
+	coef := new(big.Int).Set(v)
+	if scale < 0 {
+		coef.Mul(coef, pow10(-scale))
+		scale = 0
+	}
+	return Decimal{coef: coef, scale: scale}
+}
+
+// NewFromString parses a decimal string such as "123", "-0.00012345" or
+// "1.5e-3". The scale of the result matches the digits given, so "1.50"
+// keeps scale 2.
+func NewFromString(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Decimal{}, fmt.Errorf("%w: empty string", ErrInvalidDecimal)
+	}
+
+	mantissa, exp := s, int64(0)
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mantissa = s[:i]
+		e, err := strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+		}
+		exp = e
+	}
+
+	neg := false
+	switch {
+	case strings.HasPrefix(mantissa, "-"):
+		neg = true
+		mantissa = mantissa[1:]
+	case strings.HasPrefix(mantissa, "+"):
+		mantissa = mantissa[1:]
+	}
+
+	intPart, fracPart := mantissa, ""
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		intPart, fracPart = mantissa[:i], mantissa[i+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+	}
+
+	coef, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+	}
+	if neg {
+		coef.Neg(coef)
+	}
+
+	scale := int64(len(fracPart)) - exp
+	if scale < -maxScale || scale > maxScale {
+		return Decimal{}, fmt.Errorf("%w: exponent out of range in %q", ErrInvalidDecimal, s)
+	}
+
+	return NewFromBigInt(coef, int32(scale)), nil
+}
+
+// RequireFromString is like NewFromString but panics on error.
+// Only use it for constants known to be valid.
+func RequireFromString(s string) Decimal {
+	d, err := NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// pow10 returns 10^n for n >= 0
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// bigInt returns the coefficient, treating the zero value as 0
+func (d Decimal) bigInt() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return d.coef
+}
+
+// rescale returns the coefficient expressed at a larger scale
+func (d Decimal) rescale(scale int32) *big.Int {
+	if scale == d.scale {
+		return d.bigInt()
+	}
+	return new(big.Int).Mul(d.bigInt(), pow10(scale-d.scale))
+}
+
+// align returns both coefficients at the larger of the two scales
+func align(a, b Decimal) (*big.Int, *big.Int, int32) {
+	scale := a.scale
+	if b.scale > scale {
+		scale = b.scale
+	}
+	return a.rescale(scale), b.rescale(scale), scale
+}
+
+// Scale returns the number of digits after the decimal point
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// Add returns d + o
+func (d Decimal) Add(o Decimal) Decimal {
+	a, b, scale := align(d, o)
+	return Decimal{coef: new(big.Int).Add(a, b), scale: scale}
+}
+
+// Sub returns d - o
+func (d Decimal) Sub(o Decimal) Decimal {
+	a, b, scale := align(d, o)
+	return Decimal{coef: new(big.Int).Sub(a, b), scale: scale}
+}
+
+// Mul returns d × o exactly; the result scale is the sum of both scales
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.bigInt(), o.bigInt()), scale: d.scale + o.scale}
+}
+
+// Div returns d ÷ o rounded to scale digits using mode
+func (d Decimal) Div(o Decimal, scale int32, mode RoundingMode) (Decimal, error) {
+	if o.IsZero() {
+		return Decimal{}, ErrDivisionByZero
+	}
+
+	// d/o = (dc/10^ds) / (oc/10^os); shift so the quotient has `scale` digits
+	num := new(big.Int).Set(d.bigInt())
+	den := new(big.Int).Set(o.bigInt())
+	shift := scale + o.scale - d.scale
+	if shift >= 0 {
+		num.Mul(num, pow10(shift))
+	} else {
+		den.Mul(den, pow10(-shift))
+	}
+
+	return Decimal{coef: divRound(num, den, mode), scale: scale}, nil
+}
+
+// Neg returns -d
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: new(big.Int).Neg(d.bigInt()), scale: d.scale}
+}
+
+// Abs returns |d|
+func (d Decimal) Abs() Decimal {
+	return Decimal{coef: new(big.Int).Abs(d.bigInt()), scale: d.scale}
+}
+
+// Cmp returns -1, 0 or +1 as d is less than, equal to or greater than o
+func (d Decimal) Cmp(o Decimal) int {
+	a, b, _ := align(d, o)
+	return a.Cmp(b)
+}
+
+// Equal reports whether d == o, ignoring scale (1.5 equals 1.50)
+func (d Decimal) Equal(o Decimal) bool { return d.Cmp(o) == 0 }
+
+// LessThan reports whether d < o
+func (d Decimal) LessThan(o Decimal) bool { return d.Cmp(o) < 0 }
+
+// LessThanOrEqual reports whether d <= o
+func (d Decimal) LessThanOrEqual(o Decimal) bool { return d.Cmp(o) <= 0 }
+
+// GreaterThan reports whether d > o
+func (d Decimal) GreaterThan(o Decimal) bool { return d.Cmp(o) > 0 }
+
+// GreaterThanOrEqual reports whether d >= o
+func (d Decimal) GreaterThanOrEqual(o Decimal) bool { return d.Cmp(o) >= 0 }
+
+// Sign returns -1, 0 or +1
+func (d Decimal) Sign() int { return d.bigInt().Sign() }
+
+// IsZero reports whether d == 0
+func (d Decimal) IsZero() bool { return d.Sign() == 0 }
+
+// IsPositive reports whether d > 0
+func (d Decimal) IsPositive() bool { return d.Sign() > 0 }
+
+// IsNegative reports whether d < 0
+func (d Decimal) IsNegative() bool { return d.Sign() < 0 }
+
+// Min returns the smaller of a and b
+func Min(a, b Decimal) Decimal {
+	if b.LessThan(a) {
+		return b
+	}
+	return a
+}
+
+// Max returns the larger of a and b
+func Max(a, b Decimal) Decimal {
+	if b.GreaterThan(a) {
+		return b
+	}
+	return a
+}
+
+// Sum returns the total of values
+func Sum(values ...Decimal) Decimal {
+	total := Zero
+	for _, v := range values {
+		total = total.Add(v)
+	}
+	return total
+}
+
+// MinorUnits returns d as an integer count of 10^-scale units, e.g.
+// satoshis for scale 8 or wei for scale 18. It returns ErrPrecisionLoss if
+// d has non-zero digits beyond scale; round first if truncation is intended.
+func (d Decimal) MinorUnits(scale int32) (*big.Int, error) {
+	if scale >= d.scale {
+		return d.rescale(scale), nil
+	}
+
+	q, r := new(big.Int).QuoRem(d.bigInt(), pow10(d.scale-scale), new(big.Int))
+	if r.Sign() != 0 {
+		return nil, fmt.Errorf("%w: %s at scale %d", ErrPrecisionLoss, d, scale)
+	}
+	return q, nil
+}
+
+// Float64 returns the nearest float64. Use only for ratios, metrics and
+// logging, never for amounts that are stored or compared.
+func (d Decimal) Float64() float64 {
+	f, _ := new(big.Rat).SetFrac(d.bigInt(), pow10(d.scale)).Float64()
+	return f
+}
+
+// String returns the plain decimal representation with exactly Scale()
+// digits after the point, e.g. "0.00010000" or "-12.5"
+func (d Decimal) String() string {
+	coef := d.bigInt()
+	digits := new(big.Int).Abs(coef).String()
+
+	if d.scale > 0 {
+		if pad := int(d.scale) - len(digits) + 1; pad > 0 {
+			digits = strings.Repeat("0", pad) + digits
+		}
+		point := len(digits) - int(d.scale)
+		digits = digits[:point] + "." + digits[point:]
+	}
+
+	if coef.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// StringFixed rounds half-up to scale digits and formats the result
+func (d Decimal) StringFixed(scale int32) string {
+	return d.Round(scale, RoundHalfUp).String()
+}
@@ -0,0 +1,279 @@
+package decimal
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestNewFromString(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"0", "0", false},
+		{"123", "123", false},
+		{"-0.00012345", "-0.00012345", false},
+		{"+1.50", "1.50", false},
+		{".5", "0.5", false},
+		{"5.", "5", false},
+		{"1.5e-3", "0.0015", false},
+		{"1.5E3", "1500", false},
+		{"  42.10 ", "42.10", false},
+		{"", "", true},
+		{".", "", true},
+		{"1,000", "", true},
+		{"NaN", "", true},
+		{"1e", "", true},
+		{"--1", "", true},
+		{"1e-99999", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NewFromString(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewFromString(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("NewFromString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestArithmeticIsExact(t *testing.T) {
+	a := RequireFromString("0.1")
+	b := RequireFromString("0.2")
+	if got := a.Add(b); !got.Equal(RequireFromString("0.3")) {
+		t.Errorf("0.1 + 0.2 = %s, want 0.3", got)
+	}
+
+	if got := RequireFromString("1").Sub(RequireFromString("0.00000001")); got.String() != "0.99999999" {
+		t.Errorf("1 - 1 sat = %s", got)
+	}
+
+	if got := RequireFromString("0.5").Mul(RequireFromString("50000.00")); got.String() != "25000.000" {
+		t.Errorf("0.5 * 50000.00 = %s", got)
+	}
+
+	// 18-decimal ETH amounts stay exact
+	wei := RequireFromString("0.000000000000000001")
+	if got := RequireFromString("1").Add(wei); got.String() != "1.000000000000000001" {
+		t.Errorf("1 ETH + 1 wei = %s", got)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// The bug this package exists to fix: lexical "9999" > "10000"
+	small := RequireFromString("9999")
+	large := RequireFromString("100000")
+	threshold := RequireFromString("10000")
+
+	if small.GreaterThan(threshold) {
+		t.Error("9999 > 10000")
+	}
+	if !large.GreaterThan(threshold) {
+		t.Error("100000 <= 10000")
+	}
+	if !RequireFromString("1.5").Equal(RequireFromString("1.50")) {
+		t.Error("1.5 != 1.50")
+	}
+	if Max(small, large) != large || Min(small, large) != small {
+		t.Error("Min/Max returned wrong operand")
+	}
+}
+
+func TestZeroValue(t *testing.T) {
+	var d Decimal
+	if !d.IsZero() || d.String() != "0" {
+		t.Errorf("zero value = %s", d)
+	}
+	if got := d.Add(RequireFromString("1.25")); got.String() != "1.25" {
+		t.Errorf("0 + 1.25 = %s", got)
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		in   string
+		mode RoundingMode
+		want string
+	}{
+		{"1.25", RoundDown, "1.2"},
+		{"-1.29", RoundDown, "-1.2"},
+		{"1.21", RoundUp, "1.3"},
+		{"-1.21", RoundUp, "-1.3"},
+		{"1.25", RoundHalfUp, "1.3"},
+		{"-1.25", RoundHalfUp, "-1.3"},
+		{"1.24", RoundHalfUp, "1.2"},
+		{"1.25", RoundHalfEven, "1.2"},
+		{"1.35", RoundHalfEven, "1.4"},
+		{"-1.25", RoundHalfEven, "-1.2"},
+		{"1.251", RoundHalfEven, "1.3"},
+		{"-1.21", RoundFloor, "-1.3"},
+		{"1.29", RoundFloor, "1.2"},
+		{"1.21", RoundCeiling, "1.3"},
+		{"-1.29", RoundCeiling, "-1.2"},
+		{"1.20", RoundUp, "1.2"},
+	}
+
+	for _, tt := range tests {
+		got := RequireFromString(tt.in).Round(1, tt.mode)
+		if got.String() != tt.want {
+			t.Errorf("Round(%s, 1, %s) = %s, want %s", tt.in, tt.mode, got, tt.want)
+		}
+	}
+
+	if got := RequireFromString("1.5").Round(4, RoundDown); got.String() != "1.5000" {
+		t.Errorf("increasing scale = %s, want 1.5000", got)
+	}
+}
+
+func TestDiv(t *testing.T) {
+	got, err := RequireFromString("1").Div(RequireFromString("3"), 8, RoundHalfEven)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "0.33333333" {
+		t.Errorf("1/3 = %s", got)
+	}
+
+	got, _ = RequireFromString("2").Div(RequireFromString("3"), 2, RoundHalfUp)
+	if got.String() != "0.67" {
+		t.Errorf("2/3 = %s", got)
+	}
+
+	got, _ = RequireFromString("-10").Div(RequireFromString("4"), 0, RoundFloor)
+	if got.String() != "-3" {
+		t.Errorf("floor(-10/4) = %s", got)
+	}
+
+	got, _ = RequireFromString("0.000123").Div(RequireFromString("1000"), 2, RoundHalfUp)
+	if got.String() != "0.00" {
+		t.Errorf("tiny/1000 at 2dp = %s", got)
+	}
+
+	if _, err := RequireFromString("1").Div(Zero, 2, RoundDown); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("divide by zero error = %v", err)
+	}
+}
+
+func TestCurrencyScale(t *testing.T) {
+	if ScaleOf("btc") != 8 || ScaleOf("ETH") != 18 || ScaleOf("GBP") != 2 {
+		t.Errorf("unexpected scales: BTC=%d ETH=%d GBP=%d", ScaleOf("BTC"), ScaleOf("ETH"), ScaleOf("GBP"))
+	}
+
+	if got := RequireFromString("0.123456789").RoundCurrency("BTC", RoundDown); got.String() != "0.12345678" {
+		t.Errorf("BTC round = %s", got)
+	}
+	if got := RequireFromString("9999.999").StringCurrency("GBP"); got != "10000.00" {
+		t.Errorf("GBP format = %s", got)
+	}
+
+	if _, err := ParseAmount("10.001", "GBP"); !errors.Is(err, ErrPrecisionLoss) {
+		t.Errorf("ParseAmount(10.001 GBP) error = %v, want ErrPrecisionLoss", err)
+	}
+	amt, err := ParseAmount("10.5", "GBP")
+	if err != nil || amt.String() != "10.50" {
+		t.Errorf("ParseAmount(10.5 GBP) = %s, %v", amt, err)
+	}
+	if _, err := ParseAmount("10.10000", "GBP"); err != nil {
+		t.Errorf("trailing zeros rejected: %v", err)
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	sats, err := RequireFromString("0.015").MinorUnits(8)
+	if err != nil || sats.Int64() != 1_500_000 {
+		t.Errorf("0.015 BTC = %v sats, %v", sats, err)
+	}
+
+	wei, err := RequireFromString("1.5").MinorUnits(18)
+	if err != nil || wei.String() != "1500000000000000000" {
+		t.Errorf("1.5 ETH = %v wei, %v", wei, err)
+	}
+
+	if _, err := RequireFromString("0.000000001").MinorUnits(8); !errors.Is(err, ErrPrecisionLoss) {
+		t.Errorf("sub-satoshi error = %v", err)
+	}
+
+	back := NewFromBigInt(big.NewInt(1_500_000), 8)
+	if back.String() != "0.01500000" {
+		t.Errorf("NewFromBigInt = %s", back)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var v struct {
+		Amount Decimal     `json:"amount"`
+		Fee    NullDecimal `json:"fee"`
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount": 0.1, "fee": null}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Amount.String() != "0.1" || v.Fee.Valid {
+		t.Errorf("number decode = %s, fee valid %v", v.Amount, v.Fee.Valid)
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount": "12345678901234567890.123456789012345678", "fee": "0.0001"}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Amount.String() != "12345678901234567890.123456789012345678" {
+		t.Errorf("string decode lost precision: %s", v.Amount)
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"amount":"12345678901234567890.123456789012345678","fee":"0.0001"}` {
+		t.Errorf("marshal = %s", out)
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount": "abc"}`), &v); err == nil {
+		t.Error("expected error for invalid amount")
+	}
+}
+
+func TestNumericRoundTrip(t *testing.T) {
+	d := RequireFromString("-1234.56780000")
+
+	n, err := d.NumericValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var back Decimal
+	if err := back.ScanNumeric(n); err != nil {
+		t.Fatal(err)
+	}
+	if back.String() != d.String() {
+		t.Errorf("round trip = %s, want %s", back, d)
+	}
+
+	// PostgreSQL can return a positive exponent for whole numbers
+	if err := back.ScanNumeric(pgtype.Numeric{Int: big.NewInt(12), Exp: 3, Valid: true}); err != nil {
+		t.Fatal(err)
+	}
+	if back.String() != "12000" {
+		t.Errorf("positive exponent = %s", back)
+	}
+
+	if err := back.ScanNumeric(pgtype.Numeric{}); err == nil {
+		t.Error("expected error scanning NULL into Decimal")
+	}
+
+	var nd NullDecimal
+	if err := nd.ScanNumeric(pgtype.Numeric{}); err != nil || nd.Valid {
+		t.Errorf("NULL into NullDecimal = %+v, %v", nd, err)
+	}
+
+	if err := back.Scan("0.5"); err != nil || back.String() != "0.5" {
+		t.Errorf("Scan(text) = %s, %v", back, err)
+	}
+}
@@ -0,0 +1,165 @@
+// BitCurrent Exchange - Decimal Encoding (JSON, PostgreSQL)
+package decimal
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// MarshalJSON encodes d as a JSON string ("1.50") so clients never see a
+// float that their JSON parser might round
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// UnmarshalJSON accepts both JSON strings ("1.50") and numbers (1.50).
+// Numbers are parsed from their literal text, never via float64.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*d = Zero
+		return nil
+	}
+
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		data = data[1 : len(data)-1]
+	}
+
+	parsed, err := NewFromString(string(data))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler (used by YAML and query params)
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *Decimal) UnmarshalText(text []byte) error {
+	parsed, err := NewFromString(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// ScanNumeric implements pgtype.NumericScanner so NUMERIC columns scan
+// directly into a Decimal without going through text or float
+func (d *Decimal) ScanNumeric(v pgtype.Numeric) error {
+	if !v.Valid {
+		return fmt.Errorf("decimal: cannot scan NULL into Decimal")
+	}
+	if v.NaN || v.InfinityModifier != pgtype.Finite {
+		return fmt.Errorf("%w: NaN or infinity", ErrInvalidDecimal)
+	}
+
+	coef := v.Int
+	if coef == nil {
+		coef = new(big.Int)
+	}
+	*d = NewFromBigInt(coef, -v.Exp)
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer for query parameters
+func (d Decimal) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{
+		Int:   new(big.Int).Set(d.bigInt()),
+		Exp:   -d.scale,
+		Valid: true,
+	}, nil
+}
+
+// Scan implements sql.Scanner for columns that are not NUMERIC (e.g. TEXT
+// or an expression cast to text)
+func (d *Decimal) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return fmt.Errorf("decimal: cannot scan NULL into Decimal")
+	case string:
+		return d.UnmarshalText([]byte(v))
+	case []byte:
+		return d.UnmarshalText(v)
+	case int64:
+		*d = NewFromInt(v)
+		return nil
+	case pgtype.Numeric:
+		return d.ScanNumeric(v)
+	default:
+		return fmt.Errorf("decimal: cannot scan %T into Decimal", src)
+	}
+}
+
+// Value implements driver.Valuer, encoding d as its exact string form
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// NullDecimal is a Decimal that may be NULL in the database
+type NullDecimal struct {
+	Decimal Decimal
+	Valid   bool
+}
+
+// ScanNumeric implements pgtype.NumericScanner
+func (n *NullDecimal) ScanNumeric(v pgtype.Numeric) error {
+	if !v.Valid {
+		*n = NullDecimal{}
+		return nil
+	}
+	n.Valid = true
+	return n.Decimal.ScanNumeric(v)
+}
+
+// NumericValue implements pgtype.NumericValuer
+func (n NullDecimal) NumericValue() (pgtype.Numeric, error) {
+	if !n.Valid {
+		return pgtype.Numeric{}, nil
+	}
+	return n.Decimal.NumericValue()
+}
+
+// Scan implements sql.Scanner
+func (n *NullDecimal) Scan(src interface{}) error {
+	if src == nil {
+		*n = NullDecimal{}
+		return nil
+	}
+	n.Valid = true
+	return n.Decimal.Scan(src)
+}
+
+// Value implements driver.Valuer
+func (n NullDecimal) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Decimal.Value()
+}
+
+// MarshalJSON encodes NULL as JSON null
+func (n NullDecimal) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return n.Decimal.MarshalJSON()
+}
+
+// UnmarshalJSON decodes JSON null as an invalid NullDecimal
+func (n *NullDecimal) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		*n = NullDecimal{}
+		return nil
+	}
+	n.Valid = true
+	return n.Decimal.UnmarshalJSON(data)
+}
@@ -0,0 +1,96 @@
+// BitCurrent Exchange - Decimal Rounding
+package decimal
+
+import "math/big"
+
+// RoundingMode selects how values are rounded when precision is reduced
+type RoundingMode int
+
+const (
+	// RoundDown truncates toward zero (1.29 -> 1.2, -1.29 -> -1.2)
+	RoundDown RoundingMode = iota
+	// RoundUp rounds away from zero (1.21 -> 1.3, -1.21 -> -1.3)
+	RoundUp
+	// RoundHalfUp rounds to nearest, ties away from zero (1.25 -> 1.3)
+	RoundHalfUp
+	// RoundHalfEven rounds to nearest, ties to even (1.25 -> 1.2, 1.35 -> 1.4)
+	RoundHalfEven
+	// RoundFloor rounds toward negative infinity (-1.21 -> -1.3)
+	RoundFloor
+	// RoundCeiling rounds toward positive infinity (1.21 -> 1.3)
+	RoundCeiling
+)
+
+// String returns the mode name
+func (m RoundingMode) String() string {
+	switch m {
+	case RoundDown:
+		return "down"
+	case RoundUp:
+		return "up"
+	case RoundHalfUp:
+		return "half_up"
+	case RoundHalfEven:
+		return "half_even"
+	case RoundFloor:
+		return "floor"
+	case RoundCeiling:
+		return "ceiling"
+	default:
+		return "unknown"
+	}
+}
+
+// Round returns d rounded to scale digits after the point. Increasing the
+// scale is exact and just pads with zeros.
+func (d Decimal) Round(scale int32, mode RoundingMode) Decimal {
+	if scale >= d.scale {
+		return Decimal{coef: d.rescale(scale), scale: scale}
+	}
+	return Decimal{coef: divRound(d.bigInt(), pow10(d.scale-scale), mode), scale: scale}
+}
+
+// Truncate drops digits beyond scale (RoundDown)
+func (d Decimal) Truncate(scale int32) Decimal {
+	return d.Round(scale, RoundDown)
+}
+
+// divRound returns num/den rounded to an integer using mode
+func divRound(num, den *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	negative := (num.Sign() < 0) != (den.Sign() < 0)
+
+	// Compare the discarded remainder against half the divisor
+	twiceR := new(big.Int).Abs(r)
+	twiceR.Lsh(twiceR, 1)
+	half := twiceR.Cmp(new(big.Int).Abs(den))
+
+	var awayFromZero bool
+	switch mode {
+	case RoundDown:
+		awayFromZero = false
+	case RoundUp:
+		awayFromZero = true
+	case RoundHalfUp:
+		awayFromZero = half >= 0
+	case RoundHalfEven:
+		awayFromZero = half > 0 || (half == 0 && q.Bit(0) == 1)
+	case RoundFloor:
+		awayFromZero = negative
+	case RoundCeiling:
+		awayFromZero = !negative
+	}
+
+	if awayFromZero {
+		if negative {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
@@ -0,0 +1,242 @@
+// BitCurrent Exchange - Balance Holds
+package holds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Reference types a hold can be taken for
+const (
+	ReferenceOrder      = "order"
+	ReferenceWithdrawal = "withdrawal"
+)
+
+// Hold statuses
+const (
+	StatusActive = "active"
+	StatusClosed = "closed"
+)
+
+var (
+	ErrWalletNotFound      = errors.New("wallet not found")
+	ErrInsufficientBalance = errors.New("insufficient available balance")
+	ErrHoldNotFound        = errors.New("hold not found")
+	ErrHoldMismatch        = errors.New("hold already exists with different terms")
+)
+
+// Hold is reserved balance earmarked for a single order or withdrawal.
+// Amount = Consumed + Released + the part still reserved.
+type Hold struct {
+	ID            uuid.UUID       `json:"id"`
+	AccountID     uuid.UUID       `json:"account_id"`
+	Currency      string          `json:"currency"`
+	Amount        decimal.Decimal `json:"amount"`
+	Consumed      decimal.Decimal `json:"consumed"`
+	Released      decimal.Decimal `json:"released"`
+	ReferenceType string          `json:"reference_type"`
+	ReferenceID   uuid.UUID       `json:"reference_id"`
+	Status        string          `json:"status"`
+	CreatedAt     time.Time       `json:"created_at"`
+	ClosedAt      *time.Time      `json:"closed_at,omitempty"`
+}
+
+// Remaining returns the part of the hold still sitting in reserved_balance
+func (h *Hold) Remaining() decimal.Decimal {
+	return h.Amount.Sub(h.Consumed).Sub(h.Released)
+}
+
+// Covers returns how much of a debit of amount on an account's currency
+// wallet the hold can cover, without consuming it. A hold only covers
+// debits on its own wallet.
+func (h *Hold) Covers(accountID uuid.UUID, currency string, amount decimal.Decimal) decimal.Decimal {
+	if h == nil || h.Status != StatusActive || h.AccountID != accountID || h.Currency != currency {
+		return decimal.Zero
+	}
+	covered := decimal.Min(amount, h.Remaining())
+	if !covered.IsPositive() {
+		return decimal.Zero
+	}
+	return covered
+}
+
+// ValidReferenceType reports whether t is a known reference type
+func ValidReferenceType(t string) bool {
+	return t == ReferenceOrder || t == ReferenceWithdrawal
+}
+
+const holdColumns = `
+	id, account_id, currency, amount, consumed, released,
+	reference_type, reference_id, status, created_at, closed_at
+`
+
+func scanHold(row pgx.Row) (*Hold, error) {
+	var h Hold
+	err := row.Scan(
+		&h.ID, &h.AccountID, &h.Currency, &h.Amount, &h.Consumed, &h.Released,
+		&h.ReferenceType, &h.ReferenceID, &h.Status, &h.CreatedAt, &h.ClosedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Get loads the hold for a reference, locking it for the rest of tx.
+// Holds are always locked before their wallet row.
+func Get(ctx context.Context, tx pgx.Tx, referenceType string, referenceID uuid.UUID) (*Hold, error) {
+	return get(ctx, tx, referenceType, referenceID, true)
+}
+
+func get(ctx context.Context, tx pgx.Tx, referenceType string, referenceID uuid.UUID, lock bool) (*Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM balance_holds
+		WHERE reference_type = $1 AND reference_id = $2`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	h, err := scanHold(tx.QueryRow(ctx, query, referenceType, referenceID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrHoldNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hold: %w", err)
+	}
+	return h, nil
+}
+
+// Place moves amount from available to reserved balance and records it as
+// the hold for the reference. Placing the same hold again returns the
+// existing one with created=false; different terms give ErrHoldMismatch.
+func Place(ctx context.Context, tx pgx.Tx, accountID uuid.UUID, currency string, amount decimal.Decimal, referenceType string, referenceID uuid.UUID) (hold *Hold, created bool, err error) {
+	// Locking the wallet serialises concurrent holds on it, including two
+	// attempts to place the same hold
+	var available decimal.Decimal
+	lockQuery := `
+		SELECT available_balance
+		FROM wallets
+		WHERE account_id = $1 AND currency = $2
+		FOR UPDATE
+	`
+	err = tx.QueryRow(ctx, lockQuery, accountID, currency).Scan(&available)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, ErrWalletNotFound
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to lock wallet: %w", err)
+	}
+
+	existing, err := get(ctx, tx, referenceType, referenceID, false)
+	if err == nil {
+		if existing.AccountID != accountID || existing.Currency != currency || !existing.Amount.Equal(amount) {
+			return existing, false, ErrHoldMismatch
+		}
+		return existing, false, nil
+	}
+	if !errors.Is(err, ErrHoldNotFound) {
+		return nil, false, err
+	}
+
+	if available.LessThan(amount) {
+		return nil, false, ErrInsufficientBalance
+	}
+
+	updateQuery := `
+		UPDATE wallets
+		SET available_balance = available_balance - $1,
+		    reserved_balance = reserved_balance + $1,
+		    updated_at = NOW()
+		WHERE account_id = $2 AND currency = $3
+	`
+	if _, err := tx.Exec(ctx, updateQuery, amount, accountID, currency); err != nil {
+		return nil, false, fmt.Errorf("failed to reserve balance: %w", err)
+	}
+
+	insertQuery := `
+		INSERT INTO balance_holds (account_id, currency, amount, reference_type, reference_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + holdColumns
+
+	hold, err = scanHold(tx.QueryRow(ctx, insertQuery, accountID, currency, amount, referenceType, referenceID))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to record hold: %w", err)
+	}
+
+	return hold, true, nil
+}
+
+// Release returns whatever is left of the hold to available balance and
+// closes it. Releasing a closed hold is a no-op that returns zero.
+func Release(ctx context.Context, tx pgx.Tx, referenceType string, referenceID uuid.UUID) (*Hold, decimal.Decimal, error) {
+	hold, err := Get(ctx, tx, referenceType, referenceID)
+	if err != nil {
+		return nil, decimal.Zero, err
+	}
+	return release(ctx, tx, hold)
+}
+
+// ReleaseLocked is Release for a hold already locked with Get
+func ReleaseLocked(ctx context.Context, tx pgx.Tx, hold *Hold) (*Hold, decimal.Decimal, error) {
+	return release(ctx, tx, hold)
+}
+
+func release(ctx context.Context, tx pgx.Tx, hold *Hold) (*Hold, decimal.Decimal, error) {
+	if hold.Status != StatusActive {
+		return hold, decimal.Zero, nil
+	}
+
+	remaining := hold.Remaining()
+	if remaining.IsPositive() {
+		walletQuery := `
+			UPDATE wallets
+			SET reserved_balance = reserved_balance - $1,
+			    available_balance = available_balance + $1,
+			    updated_at = NOW()
+			WHERE account_id = $2 AND currency = $3
+		`
+		if _, err := tx.Exec(ctx, walletQuery, remaining, hold.AccountID, hold.Currency); err != nil {
+			return nil, decimal.Zero, fmt.Errorf("failed to release balance: %w", err)
+		}
+	}
+
+	closeQuery := `
+		UPDATE balance_holds
+		SET released = released + $1, status = 'closed', closed_at = NOW()
+		WHERE id = $2
+		RETURNING ` + holdColumns
+
+	hold, err := scanHold(tx.QueryRow(ctx, closeQuery, remaining, hold.ID))
+	if err != nil {
+		return nil, decimal.Zero, fmt.Errorf("failed to close hold: %w", err)
+	}
+
+	return hold, remaining, nil
+}
+
+// Consume draws a debit of amount against a hold locked with Get and
+// returns how much of it the hold covered. The caller takes any excess from
+// available balance and moves the wallet's reserved balance accordingly.
+func Consume(ctx context.Context, tx pgx.Tx, hold *Hold, amount decimal.Decimal) (decimal.Decimal, error) {
+	if hold == nil {
+		return decimal.Zero, nil
+	}
+
+	covered := hold.Covers(hold.AccountID, hold.Currency, amount)
+	if !covered.IsPositive() {
+		return decimal.Zero, nil
+	}
+
+	query := `UPDATE balance_holds SET consumed = consumed + $1 WHERE id = $2`
+	if _, err := tx.Exec(ctx, query, covered, hold.ID); err != nil {
+		return decimal.Zero, fmt.Errorf("failed to consume hold: %w", err)
+	}
+
+	hold.Consumed = hold.Consumed.Add(covered)
+	return covered, nil
+}
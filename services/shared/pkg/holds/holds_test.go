@@ -0,0 +1,278 @@
+package holds
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+)
+
+// amount matches a decimal argument by value rather than representation
+type amount string
+
+func (a amount) Match(v interface{}) bool {
+	d, ok := v.(decimal.Decimal)
+	return ok && d.Equal(decimal.RequireFromString(string(a)))
+}
+
+var holdColumnNames = []string{
+	"id", "account_id", "currency", "amount", "consumed", "released",
+	"reference_type", "reference_id", "status", "created_at", "closed_at",
+}
+
+func holdRows(h *Hold) *pgxmock.Rows {
+	return pgxmock.NewRows(holdColumnNames).AddRow(
+		h.ID, h.AccountID, h.Currency, h.Amount, h.Consumed, h.Released,
+		h.ReferenceType, h.ReferenceID, h.Status, h.CreatedAt, h.ClosedAt,
+	)
+}
+
+func testHold(accountID, orderID uuid.UUID, held, consumed string) *Hold {
+	return &Hold{
+		ID:            uuid.New(),
+		AccountID:     accountID,
+		Currency:      "GBP",
+		Amount:        decimal.RequireFromString(held),
+		Consumed:      decimal.RequireFromString(consumed),
+		Released:      decimal.Zero,
+		ReferenceType: ReferenceOrder,
+		ReferenceID:   orderID,
+		Status:        StatusActive,
+		CreatedAt:     time.Now(),
+	}
+}
+
+func newTestTx(t *testing.T) (pgx.Tx, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+	mock.ExpectBegin()
+	tx, err := mock.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx, mock
+}
+
+func expectWalletLock(mock pgxmock.PgxPoolIface, accountID uuid.UUID, available string) {
+	mock.ExpectQuery("SELECT available_balance").
+		WithArgs(accountID, "GBP").
+		WillReturnRows(pgxmock.NewRows([]string{"available_balance"}).AddRow(decimal.RequireFromString(available)))
+}
+
+func TestPlaceReservesBalance(t *testing.T) {
+	tx, mock := newTestTx(t)
+	accountID, orderID := uuid.New(), uuid.New()
+	placed := testHold(accountID, orderID, "100", "0")
+
+	expectWalletLock(mock, accountID, "250")
+	mock.ExpectQuery("FROM balance_holds").
+		WithArgs(ReferenceOrder, orderID).
+		WillReturnRows(pgxmock.NewRows(holdColumnNames))
+	mock.ExpectExec("SET available_balance = available_balance - \\$1").
+		WithArgs(amount("100"), accountID, "GBP").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery("INSERT INTO balance_holds").
+		WithArgs(accountID, "GBP", amount("100"), ReferenceOrder, orderID).
+		WillReturnRows(holdRows(placed))
+
+	hold, created, err := Place(context.Background(), tx, accountID, "GBP", decimal.RequireFromString("100"), ReferenceOrder, orderID)
+	if err != nil {
+		t.Fatalf("Place() error = %v", err)
+	}
+	if !created || hold.ID != placed.ID {
+		t.Errorf("Place() = %v, created %v; want the new hold", hold.ID, created)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Placing a hold again for the same reference returns the existing hold
+// without reserving anything more
+func TestPlaceIsIdempotentPerReference(t *testing.T) {
+	tx, mock := newTestTx(t)
+	accountID, orderID := uuid.New(), uuid.New()
+	existing := testHold(accountID, orderID, "100", "40")
+
+	// Only 10 is left available, but the hold is already in place
+	expectWalletLock(mock, accountID, "10")
+	mock.ExpectQuery("FROM balance_holds").
+		WithArgs(ReferenceOrder, orderID).
+		WillReturnRows(holdRows(existing))
+
+	hold, created, err := Place(context.Background(), tx, accountID, "GBP", decimal.RequireFromString("100.00"), ReferenceOrder, orderID)
+	if err != nil {
+		t.Fatalf("Place() error = %v", err)
+	}
+	if created || hold.ID != existing.ID {
+		t.Errorf("Place() = %v, created %v; want the existing hold", hold.ID, created)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPlaceRejectsMismatchedHold(t *testing.T) {
+	tx, mock := newTestTx(t)
+	accountID, orderID := uuid.New(), uuid.New()
+
+	expectWalletLock(mock, accountID, "1000")
+	mock.ExpectQuery("FROM balance_holds").
+		WithArgs(ReferenceOrder, orderID).
+		WillReturnRows(holdRows(testHold(accountID, orderID, "100", "0")))
+
+	_, created, err := Place(context.Background(), tx, accountID, "GBP", decimal.RequireFromString("150"), ReferenceOrder, orderID)
+	if !errors.Is(err, ErrHoldMismatch) || created {
+		t.Errorf("Place() error = %v, created %v; want ErrHoldMismatch", err, created)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPlaceRefusesUnfundedHold(t *testing.T) {
+	tx, mock := newTestTx(t)
+	accountID, orderID := uuid.New(), uuid.New()
+
+	expectWalletLock(mock, accountID, "99.99")
+	mock.ExpectQuery("FROM balance_holds").
+		WithArgs(ReferenceOrder, orderID).
+		WillReturnRows(pgxmock.NewRows(holdColumnNames))
+
+	if _, _, err := Place(context.Background(), tx, accountID, "GBP", decimal.RequireFromString("100"), ReferenceOrder, orderID); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("Place() error = %v, want ErrInsufficientBalance", err)
+	}
+
+	mock.ExpectQuery("SELECT available_balance").
+		WithArgs(accountID, "BTC").
+		WillReturnRows(pgxmock.NewRows([]string{"available_balance"}))
+	if _, _, err := Place(context.Background(), tx, accountID, "BTC", decimal.RequireFromString("1"), ReferenceOrder, orderID); !errors.Is(err, ErrWalletNotFound) {
+		t.Errorf("Place() error = %v, want ErrWalletNotFound", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Release returns only what was not consumed and closes the hold
+func TestReleaseReturnsRemaining(t *testing.T) {
+	tx, mock := newTestTx(t)
+	accountID, orderID := uuid.New(), uuid.New()
+	active := testHold(accountID, orderID, "100", "30")
+	closed := *active
+	closed.Released = decimal.RequireFromString("70")
+	closed.Status = StatusClosed
+
+	mock.ExpectQuery("FROM balance_holds .* FOR UPDATE").
+		WithArgs(ReferenceOrder, orderID).
+		WillReturnRows(holdRows(active))
+	mock.ExpectExec("SET reserved_balance = reserved_balance - \\$1").
+		WithArgs(amount("70"), accountID, "GBP").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery("UPDATE balance_holds").
+		WithArgs(amount("70"), active.ID).
+		WillReturnRows(holdRows(&closed))
+
+	hold, released, err := Release(context.Background(), tx, ReferenceOrder, orderID)
+	if err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if !released.Equal(decimal.RequireFromString("70")) || hold.Status != StatusClosed {
+		t.Errorf("Release() released %s, status %s; want 70, closed", released, hold.Status)
+	}
+
+	// Releasing it again changes nothing
+	mock.ExpectQuery("FROM balance_holds .* FOR UPDATE").
+		WithArgs(ReferenceOrder, orderID).
+		WillReturnRows(holdRows(&closed))
+	if _, released, err := Release(context.Background(), tx, ReferenceOrder, orderID); err != nil || !released.IsZero() {
+		t.Errorf("second Release() = %s, %v; want 0, nil", released, err)
+	}
+
+	mock.ExpectQuery("FROM balance_holds .* FOR UPDATE").
+		WithArgs(ReferenceWithdrawal, orderID).
+		WillReturnRows(pgxmock.NewRows(holdColumnNames))
+	if _, _, err := Release(context.Background(), tx, ReferenceWithdrawal, orderID); !errors.Is(err, ErrHoldNotFound) {
+		t.Errorf("Release(unknown) error = %v, want ErrHoldNotFound", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Consume covers fills up to what is left of the hold
+func TestConsume(t *testing.T) {
+	tx, mock := newTestTx(t)
+	hold := testHold(uuid.New(), uuid.New(), "100", "30")
+
+	mock.ExpectExec("SET consumed = consumed \\+ \\$1").
+		WithArgs(amount("50"), hold.ID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	covered, err := Consume(context.Background(), tx, hold, decimal.RequireFromString("50"))
+	if err != nil || !covered.Equal(decimal.RequireFromString("50")) {
+		t.Errorf("Consume(50) = %s, %v; want 50", covered, err)
+	}
+
+	// Only 20 is left for a fill of 35
+	mock.ExpectExec("SET consumed = consumed \\+ \\$1").
+		WithArgs(amount("20"), hold.ID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	covered, err = Consume(context.Background(), tx, hold, decimal.RequireFromString("35"))
+	if err != nil || !covered.Equal(decimal.RequireFromString("20")) {
+		t.Errorf("Consume(35) = %s, %v; want 20", covered, err)
+	}
+	if !hold.Remaining().IsZero() {
+		t.Errorf("Remaining() = %s, want 0", hold.Remaining())
+	}
+
+	// Nothing more is covered by a used up, closed or missing hold
+	closed := testHold(uuid.New(), uuid.New(), "100", "0")
+	closed.Status = StatusClosed
+	for _, h := range []*Hold{hold, closed, nil} {
+		if covered, err := Consume(context.Background(), tx, h, decimal.RequireFromString("1")); err != nil || !covered.IsZero() {
+			t.Errorf("Consume() = %s, %v; want 0", covered, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A hold only covers debits on its own wallet, up to what is left of it
+func TestCoversOnlyItsOwnWallet(t *testing.T) {
+	accountID := uuid.New()
+	hold := testHold(accountID, uuid.New(), "100", "30")
+	closed := testHold(accountID, uuid.New(), "100", "0")
+	closed.Status = StatusClosed
+
+	tests := []struct {
+		name      string
+		hold      *Hold
+		accountID uuid.UUID
+		currency  string
+		amount    string
+		want      string
+	}{
+		{"within remaining", hold, accountID, "GBP", "50", "50"},
+		{"beyond remaining", hold, accountID, "GBP", "80", "70"},
+		{"other account", hold, uuid.New(), "GBP", "50", "0"},
+		{"other currency", hold, accountID, "BTC", "50", "0"},
+		{"closed", closed, accountID, "GBP", "50", "0"},
+		{"no hold", nil, accountID, "GBP", "50", "0"},
+	}
+	for _, tt := range tests {
+		got := tt.hold.Covers(tt.accountID, tt.currency, decimal.RequireFromString(tt.amount))
+		if !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("%s: Covers() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// BitCurrent Exchange - Hold Reconciler
+package holds
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ReconcilerConfig controls how often holds are checked and when an
+// unsettled one is reported
+type ReconcilerConfig struct {
+	Interval   time.Duration
+	StaleAfter time.Duration
+}
+
+// DefaultReconcilerConfig returns the reconciler defaults
+func DefaultReconcilerConfig() ReconcilerConfig {
+	return ReconcilerConfig{
+		Interval:   time.Minute,
+		StaleAfter: 15 * time.Minute,
+	}
+}
+
+// Reasons an active order hold is reported
+const (
+	OrphanNoOrder        = "order_not_found"
+	OrphanOrderPending   = "order_pending"
+	OrphanFillsUnapplied = "fills_not_applied"
+)
+
+// OrphanedHold is an active hold that could not be settled automatically
+type OrphanedHold struct {
+	HoldID      uuid.UUID       `json:"hold_id"`
+	AccountID   uuid.UUID       `json:"account_id"`
+	Currency    string          `json:"currency"`
+	Remaining   decimal.Decimal `json:"remaining"`
+	OrderID     uuid.UUID       `json:"order_id"`
+	OrderStatus string          `json:"order_status,omitempty"`
+	Reason      string          `json:"reason"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// ReconcileReport summarises one reconciler pass
+type ReconcileReport struct {
+	Released []*Hold        `json:"released"`
+	Orphaned []OrphanedHold `json:"orphaned"`
+}
+
+// Reconciler releases order holds the normal flow missed (for example a
+// crash between an order settling and its hold being released) and
+// reports holds it cannot safely release.
+//
+// An order is settled once it is in a final status and every unit is
+// accounted for: filled_quantity + cancelled_quantity = quantity. Until then
+// fills may still be in flight and the hold must stay.
+type Reconciler struct {
+	db     *database.PostgresDB
+	config ReconcilerConfig
+	logger *zap.Logger
+}
+
+// NewReconciler creates a hold reconciler
+func NewReconciler(db *database.PostgresDB, cfg ReconcilerConfig, logger *zap.Logger) *Reconciler {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultReconcilerConfig().Interval
+	}
+	if cfg.StaleAfter <= 0 {
+		cfg.StaleAfter = DefaultReconcilerConfig().StaleAfter
+	}
+	return &Reconciler{
+		db:     db,
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// Start runs reconciliation passes until ctx is cancelled
+func (r *Reconciler) Start(ctx context.Context) error {
+	r.logger.Info("Starting hold reconciler", zap.Duration("interval", r.config.Interval))
+
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Hold reconciler stopped")
+			return ctx.Err()
+
+		case <-ticker.C:
+			if _, err := r.RunOnce(ctx); err != nil {
+				r.logger.Error("Hold reconciliation failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// RunOnce releases every settled order's active hold and reports the
+// active holds that have been waiting longer than StaleAfter
+func (r *Reconciler) RunOnce(ctx context.Context) (*ReconcileReport, error) {
+	report := &ReconcileReport{
+		Released: []*Hold{},
+		Orphaned: []OrphanedHold{},
+	}
+
+	query := `
+		SELECT h.id, h.account_id, h.currency, h.amount - h.consumed - h.released,
+		       h.reference_id, h.created_at, o.status,
+		       o.status IN ('filled', 'cancelled', 'rejected', 'expired')
+		           AND o.filled_quantity + o.cancelled_quantity >= o.quantity,
+		       COALESCE(o.updated_at, h.created_at) < NOW() - make_interval(secs => $2)
+		FROM balance_holds h
+		LEFT JOIN orders o ON o.id = h.reference_id
+		WHERE h.reference_type = $1 AND h.status = 'active'
+		ORDER BY h.created_at
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, ReferenceOrder, r.config.StaleAfter.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query active holds: %w", err)
+	}
+
+	var settled []uuid.UUID
+	for rows.Next() {
+		var o OrphanedHold
+		var status *string
+		var isSettled *bool
+		var stale bool
+		if err := rows.Scan(&o.HoldID, &o.AccountID, &o.Currency, &o.Remaining,
+			&o.OrderID, &o.CreatedAt, &status, &isSettled, &stale); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan hold: %w", err)
+		}
+
+		switch {
+		case status == nil:
+			// Orders are written before their hold, so nothing will ever
+			// consume this one
+			if stale {
+				o.Reason = OrphanNoOrder
+				settled = append(settled, o.OrderID)
+				report.Orphaned = append(report.Orphaned, o)
+			}
+		case isSettled != nil && *isSettled:
+			settled = append(settled, o.OrderID)
+		case stale:
+			o.OrderStatus = *status
+			o.Reason = OrphanFillsUnapplied
+			if *status == "pending" {
+				o.Reason = OrphanOrderPending
+			}
+			report.Orphaned = append(report.Orphaned, o)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read active holds: %w", err)
+	}
+
+	for _, orderID := range settled {
+		hold, released, err := r.release(ctx, orderID)
+		if err != nil {
+			r.logger.Error("Failed to release hold",
+				zap.String("order_id", orderID.String()),
+				zap.Error(err),
+			)
+			continue
+		}
+		if released.IsPositive() {
+			report.Released = append(report.Released, hold)
+		}
+	}
+
+	for _, o := range report.Orphaned {
+		r.logger.Warn("Orphaned balance hold",
+			zap.String("hold_id", o.HoldID.String()),
+			zap.String("order_id", o.OrderID.String()),
+			zap.String("account_id", o.AccountID.String()),
+			zap.String("currency", o.Currency),
+			zap.String("remaining", o.Remaining.String()),
+			zap.String("reason", o.Reason),
+		)
+	}
+
+	if len(report.Released) > 0 || len(report.Orphaned) > 0 {
+		r.logger.Info("Hold reconciliation completed",
+			zap.Int("released", len(report.Released)),
+			zap.Int("orphaned", len(report.Orphaned)),
+		)
+	}
+
+	return report, nil
+}
+
+func (r *Reconciler) release(ctx context.Context, orderID uuid.UUID) (*Hold, decimal.Decimal, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, decimal.Zero, err
+	}
+	defer tx.Rollback(ctx)
+
+	hold, released, err := Release(ctx, tx, ReferenceOrder, orderID)
+	if err != nil {
+		return nil, decimal.Zero, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, decimal.Zero, err
+	}
+	return hold, released, nil
+}
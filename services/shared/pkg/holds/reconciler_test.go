@@ -0,0 +1,140 @@
+package holds
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+var activeHoldColumns = []string{
+	"id", "account_id", "currency", "remaining", "reference_id", "created_at",
+	"status", "settled", "stale",
+}
+
+func newTestReconciler(t *testing.T) (*Reconciler, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+	return NewReconciler(database.New(mock, zap.NewNop()), DefaultReconcilerConfig(), zap.NewNop()), mock
+}
+
+// expectRelease expects the hold for orderID to be released in its own
+// transaction
+func expectRelease(mock pgxmock.PgxPoolIface, hold *Hold) {
+	closed := *hold
+	closed.Released = hold.Remaining()
+	closed.Status = StatusClosed
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM balance_holds .* FOR UPDATE").
+		WithArgs(ReferenceOrder, hold.ReferenceID).
+		WillReturnRows(holdRows(hold))
+	mock.ExpectExec("SET reserved_balance = reserved_balance - \\$1").
+		WithArgs(amount(hold.Remaining().String()), hold.AccountID, hold.Currency).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery("UPDATE balance_holds").
+		WithArgs(amount(hold.Remaining().String()), hold.ID).
+		WillReturnRows(holdRows(&closed))
+	mock.ExpectCommit()
+}
+
+func TestReconcilerReleasesSettledAndReportsOrphaned(t *testing.T) {
+	reconciler, mock := newTestReconciler(t)
+	account := uuid.New()
+	status := func(s string) *string { return &s }
+	yes, no := true, false
+
+	noOrder := testHold(account, uuid.New(), "100", "0")
+	recentNoOrder := testHold(account, uuid.New(), "100", "0")
+	settled := testHold(account, uuid.New(), "100", "60")
+	pending := testHold(account, uuid.New(), "100", "0")
+	unapplied := testHold(account, uuid.New(), "100", "25")
+	open := testHold(account, uuid.New(), "100", "0")
+
+	row := func(rows *pgxmock.Rows, h *Hold, orderStatus *string, isSettled *bool, stale bool) *pgxmock.Rows {
+		return rows.AddRow(h.ID, h.AccountID, h.Currency, h.Remaining(), h.ReferenceID, h.CreatedAt, orderStatus, isSettled, stale)
+	}
+	rows := pgxmock.NewRows(activeHoldColumns)
+	row(rows, noOrder, nil, nil, true)
+	row(rows, recentNoOrder, nil, nil, false)
+	row(rows, settled, status("filled"), &yes, false)
+	row(rows, pending, status("pending"), &no, true)
+	row(rows, unapplied, status("cancelled"), &no, true)
+	row(rows, open, status("open"), &no, false)
+
+	mock.ExpectQuery("FROM balance_holds h").
+		WithArgs(ReferenceOrder, (15 * time.Minute).Seconds()).
+		WillReturnRows(rows)
+	expectRelease(mock, noOrder)
+	expectRelease(mock, settled)
+
+	report, err := reconciler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+
+	if len(report.Released) != 2 || report.Released[0].ID != noOrder.ID || report.Released[1].ID != settled.ID {
+		t.Errorf("Released = %v, want the holds without an order and for the settled order", report.Released)
+	}
+	if !report.Released[1].Released.Equal(decimal.RequireFromString("40")) {
+		t.Errorf("settled order released %s, want 40", report.Released[1].Released)
+	}
+
+	want := map[uuid.UUID]string{
+		noOrder.ID:   OrphanNoOrder,
+		pending.ID:   OrphanOrderPending,
+		unapplied.ID: OrphanFillsUnapplied,
+	}
+	if len(report.Orphaned) != len(want) {
+		t.Fatalf("Orphaned = %+v, want %d holds", report.Orphaned, len(want))
+	}
+	for _, o := range report.Orphaned {
+		if o.Reason != want[o.HoldID] {
+			t.Errorf("hold %s reported as %q, want %q", o.HoldID, o.Reason, want[o.HoldID])
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A failed release is logged and left for the next pass
+func TestReconcilerContinuesAfterFailedRelease(t *testing.T) {
+	reconciler, mock := newTestReconciler(t)
+	failing := testHold(uuid.New(), uuid.New(), "100", "0")
+	settled := testHold(uuid.New(), uuid.New(), "100", "0")
+	filled := "filled"
+	yes := true
+
+	mock.ExpectQuery("FROM balance_holds h").
+		WithArgs(ReferenceOrder, (15 * time.Minute).Seconds()).
+		WillReturnRows(pgxmock.NewRows(activeHoldColumns).
+			AddRow(failing.ID, failing.AccountID, failing.Currency, failing.Remaining(), failing.ReferenceID, failing.CreatedAt, &filled, &yes, false).
+			AddRow(settled.ID, settled.AccountID, settled.Currency, settled.Remaining(), settled.ReferenceID, settled.CreatedAt, &filled, &yes, false))
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM balance_holds .* FOR UPDATE").
+		WithArgs(ReferenceOrder, failing.ReferenceID).
+		WillReturnError(context.DeadlineExceeded)
+	mock.ExpectRollback()
+	expectRelease(mock, settled)
+
+	report, err := reconciler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if len(report.Released) != 1 || report.Released[0].ID != settled.ID {
+		t.Errorf("Released = %v, want only the second hold", report.Released)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,232 @@
+// BitCurrent Exchange - Idempotency Keys
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderKey carries the caller's idempotency key
+	HeaderKey = "Idempotency-Key"
+	// HeaderReplayed marks a response served from the store
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+var (
+	// ErrInProgress means another request holding the key has not finished
+	ErrInProgress = errors.New("a request with this idempotency key is still in progress")
+	// ErrMismatch means the key was first used for a different request
+	ErrMismatch = errors.New("idempotency key reused with a different request")
+	// ErrClaimLost means the key was taken over by another request after
+	// its claim timed out, so this request may no longer complete it
+	ErrClaimLost = errors.New("idempotency key claim was taken over")
+)
+
+// Response is a stored response, replayed for repeats of its request
+type Response struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// Store records idempotency keys with the hash of the request that first
+// used them and, once it finishes, that request's response
+type Store interface {
+	// Begin claims key for a request. It returns the stored response if the
+	// key has already completed for the same request hash, ErrMismatch if it
+	// was used for a different request and ErrInProgress if its first
+	// request is still running. A nil response and error means the caller
+	// holds the key under the returned claim token and must Complete or
+	// Release it with that token.
+	Begin(ctx context.Context, scope, key, requestHash string) (token string, resp *Response, err error)
+	// Complete stores the response for a claimed key. It returns
+	// ErrClaimLost if the claim is no longer the caller's.
+	Complete(ctx context.Context, scope, key, token string, resp *Response) error
+	// Release gives up a claimed key so the request can be retried. A claim
+	// that has been taken over is left alone.
+	Release(ctx context.Context, scope, key, token string) error
+}
+
+// Config controls the middleware
+type Config struct {
+	// Scope namespaces keys, normally by service
+	Scope string
+	// ScopeFunc, if set, narrows the scope per request (e.g. per user) so
+	// callers cannot collide with or replay each other's keys
+	ScopeFunc func(r *http.Request) string
+	// Required rejects mutations sent without a key
+	Required bool
+}
+
+// Middleware applies the Idempotency-Key contract to a handler: the first
+// request with a key runs and its response is stored; repeats with the same
+// key and payload get the stored response without running the handler
+// again; a key reused with a different payload gets 409.
+//
+// 5xx responses are not stored, so a request that failed on the server can
+// be retried with the same key.
+func Middleware(store Store, cfg Config, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(HeaderKey)
+			if key == "" {
+				if cfg.Required {
+					respondError(w, http.StatusBadRequest, HeaderKey+" header is required")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxKeyLength {
+				respondError(w, http.StatusBadRequest, HeaderKey+" is too long")
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "Failed to read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			scope := cfg.Scope
+			if cfg.ScopeFunc != nil {
+				scope += ":" + cfg.ScopeFunc(r)
+			}
+			hash := RequestHash(r.Method, r.URL.Path, body)
+
+			token, stored, err := store.Begin(r.Context(), scope, key, hash)
+			switch {
+			case errors.Is(err, ErrMismatch), errors.Is(err, ErrInProgress):
+				respondError(w, http.StatusConflict, err.Error())
+				return
+			case err != nil:
+				logger.Error("Failed to claim idempotency key", zap.String("scope", scope), zap.Error(err))
+				respondError(w, http.StatusServiceUnavailable, "Idempotency store unavailable")
+				return
+			case stored != nil:
+				logger.Debug("Replaying idempotent response",
+					zap.String("scope", scope),
+					zap.String("key", key),
+				)
+				replay(w, stored)
+				return
+			}
+
+			// Finish off the key even if the request was cancelled
+			storeCtx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+			defer cancel()
+
+			rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+			defer func() {
+				if !completed {
+					if err := store.Release(storeCtx, scope, key, token); err != nil {
+						logger.Error("Failed to release idempotency key", zap.String("scope", scope), zap.Error(err))
+					}
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+
+			if rec.status >= http.StatusInternalServerError {
+				return
+			}
+			resp := &Response{
+				StatusCode:  rec.status,
+				ContentType: rec.Header().Get("Content-Type"),
+				Body:        rec.body.Bytes(),
+			}
+			err = store.Complete(storeCtx, scope, key, token, resp)
+			if errors.Is(err, ErrClaimLost) {
+				// The request that took the key over owns it now
+				logger.Warn("Idempotency key taken over before completing",
+					zap.String("scope", scope),
+					zap.String("key", key),
+				)
+				completed = true
+				return
+			}
+			if err != nil {
+				logger.Error("Failed to store idempotent response", zap.String("scope", scope), zap.Error(err))
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// RequestHash fingerprints a request for comparison with a key's first use
+func RequestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(path))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ForwardKey derives the key a service sends downstream for a request it
+// received with key from the caller scope names. Retries of the request
+// then reach the downstream service with the same key, while callers using
+// the same key still get different ones.
+func ForwardKey(scope, key string) string {
+	h := sha256.New()
+	h.Write([]byte(scope))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(key))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder passes a response through while keeping a copy of it
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func replay(w http.ResponseWriter, resp *Response) {
+	if resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(resp.Body)
+}
+
+func respondError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   http.StatusText(status),
+		"message": message,
+	})
+}
@@ -0,0 +1,252 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/pashagolub/pgxmock/v4"
+	"go.uber.org/zap"
+)
+
+// counter is a handler that reports how many times it has run
+type counter struct {
+	calls  atomic.Int32
+	status int
+}
+
+func (c *counter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := c.calls.Add(1)
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(c.status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"call": n, "body": string(body)})
+}
+
+func send(h http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/internal/v1/balances/update", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func newHandler(cfg Config, status int) (http.Handler, *counter) {
+	c := &counter{status: status}
+	return Middleware(NewMemoryStore(), cfg, zap.NewNop())(c), c
+}
+
+func TestMiddlewareReplaysRepeatedRequest(t *testing.T) {
+	h, c := newHandler(Config{Scope: "ledger"}, http.StatusCreated)
+
+	first := send(h, "key-1", `{"amount":"10"}`)
+	second := send(h, "key-1", `{"amount":"10"}`)
+
+	if c.calls.Load() != 1 {
+		t.Fatalf("handler ran %d times, want 1", c.calls.Load())
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %q, want %d %q", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get(HeaderReplayed) != "true" {
+		t.Error("replayed response not marked")
+	}
+	if second.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("replayed Content-Type = %q", second.Header().Get("Content-Type"))
+	}
+}
+
+func TestMiddlewareRejectsKeyReuseWithDifferentPayload(t *testing.T) {
+	h, c := newHandler(Config{Scope: "ledger"}, http.StatusOK)
+
+	send(h, "key-1", `{"amount":"10"}`)
+	rec := send(h, "key-1", `{"amount":"11"}`)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want 409", rec.Code)
+	}
+	if c.calls.Load() != 1 {
+		t.Errorf("handler ran %d times, want 1", c.calls.Load())
+	}
+}
+
+func TestMiddlewareRetriesServerErrors(t *testing.T) {
+	h, c := newHandler(Config{Scope: "ledger"}, http.StatusInternalServerError)
+
+	send(h, "key-1", `{}`)
+	send(h, "key-1", `{}`)
+
+	if c.calls.Load() != 2 {
+		t.Errorf("handler ran %d times, want 2", c.calls.Load())
+	}
+}
+
+func TestMiddlewareWithoutKey(t *testing.T) {
+	h, c := newHandler(Config{Scope: "ledger"}, http.StatusOK)
+	send(h, "", `{}`)
+	send(h, "", `{}`)
+	if c.calls.Load() != 2 {
+		t.Errorf("handler ran %d times, want 2", c.calls.Load())
+	}
+
+	h, c = newHandler(Config{Scope: "ledger", Required: true}, http.StatusOK)
+	if rec := send(h, "", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 when key is required", rec.Code)
+	}
+	if c.calls.Load() != 0 {
+		t.Error("handler ran without a required key")
+	}
+}
+
+func TestMiddlewareScopesKeysPerCaller(t *testing.T) {
+	cfg := Config{
+		Scope:     "api",
+		ScopeFunc: func(r *http.Request) string { return r.Header.Get("X-User") },
+	}
+	h, c := newHandler(cfg, http.StatusOK)
+
+	for _, user := range []string{"alice", "bob"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/withdrawals", strings.NewReader(`{}`))
+		req.Header.Set(HeaderKey, "shared-key")
+		req.Header.Set("X-User", user)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if c.calls.Load() != 2 {
+		t.Errorf("handler ran %d times, want 2", c.calls.Load())
+	}
+}
+
+func TestForwardKey(t *testing.T) {
+	key := ForwardKey("alice", "shared-key")
+	if key != ForwardKey("alice", "shared-key") {
+		t.Error("ForwardKey() differs for the same caller and key")
+	}
+	if key == ForwardKey("bob", "shared-key") || key == ForwardKey("alice", "other-key") {
+		t.Error("ForwardKey() collides across callers or keys")
+	}
+	if len(key) > maxKeyLength {
+		t.Errorf("ForwardKey() is %d long, over the %d limit", len(key), maxKeyLength)
+	}
+}
+
+func TestMiddlewareRejectsConcurrentRequest(t *testing.T) {
+	store := NewMemoryStore()
+	hash := RequestHash(http.MethodPost, "/internal/v1/balances/update", []byte(`{}`))
+	if _, _, err := store.Begin(context.Background(), "ledger", "key-1", hash); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &counter{status: http.StatusOK}
+	h := Middleware(store, Config{Scope: "ledger"}, zap.NewNop())(c)
+	if rec := send(h, "key-1", `{}`); rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want 409 while the first request runs", rec.Code)
+	}
+}
+
+func TestPostgresStoreReplaysCompletedKey(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	store := NewPostgresStore(database.New(mock, zap.NewNop()), 0)
+
+	status, contentType := 201, "application/json"
+	mock.ExpectQuery("INSERT INTO idempotency_keys").
+		WithArgs("ledger", "key-1", "hash", pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"status"}))
+	mock.ExpectQuery("SELECT request_hash").
+		WithArgs("ledger", "key-1").
+		WillReturnRows(pgxmock.NewRows([]string{"request_hash", "status", "response_status", "response_content_type", "response_body"}).
+			AddRow("hash", "completed", &status, &contentType, []byte(`{"ok":true}`)))
+
+	_, resp, err := store.Begin(context.Background(), "ledger", "key-1", "hash")
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	if resp == nil || resp.StatusCode != 201 || string(resp.Body) != `{"ok":true}` {
+		t.Errorf("Begin() = %+v, want stored response", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A request whose claim was taken over after timing out may not complete or
+// release the key its successor now holds
+func TestPostgresStoreRequiresClaimToken(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	store := NewPostgresStore(database.New(mock, zap.NewNop()), 0)
+
+	mock.ExpectQuery("INSERT INTO idempotency_keys").
+		WithArgs("ledger", "key-1", "hash", pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"status"}).AddRow("processing"))
+	token, resp, err := store.Begin(context.Background(), "ledger", "key-1", "hash")
+	if err != nil || resp != nil || token == "" {
+		t.Fatalf("Begin() = %q, %+v, %v; want a claim token", token, resp, err)
+	}
+
+	complete := Response{StatusCode: 201, ContentType: "application/json", Body: []byte(`{}`)}
+	mock.ExpectExec("claim_token = \\$3 AND status = 'processing'").
+		WithArgs("ledger", "key-1", token, 201, "application/json", []byte(`{}`)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	if err := store.Complete(context.Background(), "ledger", "key-1", token, &complete); err != nil {
+		t.Errorf("Complete() error = %v", err)
+	}
+
+	mock.ExpectExec("claim_token = \\$3 AND status = 'processing'").
+		WithArgs("ledger", "key-1", "stale-token", 201, "application/json", []byte(`{}`)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	if err := store.Complete(context.Background(), "ledger", "key-1", "stale-token", &complete); !errors.Is(err, ErrClaimLost) {
+		t.Errorf("Complete(stale token) error = %v, want ErrClaimLost", err)
+	}
+
+	mock.ExpectExec("DELETE FROM idempotency_keys").
+		WithArgs("ledger", "key-1", "stale-token").
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	if err := store.Release(context.Background(), "ledger", "key-1", "stale-token"); err != nil {
+		t.Errorf("Release(stale token) error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemoryStoreRequiresClaimToken(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	token, _, err := store.Begin(ctx, "ledger", "key-1", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Release(ctx, "ledger", "key-1", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Complete(ctx, "ledger", "key-1", "other", &Response{StatusCode: 200}); !errors.Is(err, ErrClaimLost) {
+		t.Errorf("Complete(other token) error = %v, want ErrClaimLost", err)
+	}
+	if err := store.Complete(ctx, "ledger", "key-1", token, &Response{StatusCode: 200}); err != nil {
+		t.Errorf("Complete() error = %v", err)
+	}
+	if err := store.Complete(ctx, "ledger", "key-1", token, &Response{StatusCode: 500}); !errors.Is(err, ErrClaimLost) {
+		t.Errorf("second Complete() error = %v, want ErrClaimLost", err)
+	}
+	if _, resp, _ := store.Begin(ctx, "ledger", "key-1", "hash"); resp == nil || resp.StatusCode != 200 {
+		t.Errorf("Begin() = %+v, want the first response", resp)
+	}
+}
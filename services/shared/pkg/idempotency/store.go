@@ -0,0 +1,193 @@
+// BitCurrent Exchange - Idempotency Key Stores
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// DefaultTTL is how long a completed key is replayed for
+	DefaultTTL = 24 * time.Hour
+	// DefaultLockTimeout is how long a claim survives without completing
+	// before another request may take the key over (e.g. after a crash)
+	DefaultLockTimeout = time.Minute
+)
+
+// PostgresStore keeps keys in the idempotency_keys table
+type PostgresStore struct {
+	db          *database.PostgresDB
+	ttl         time.Duration
+	lockTimeout time.Duration
+}
+
+// NewPostgresStore creates a store replaying responses for ttl
+func NewPostgresStore(db *database.PostgresDB, ttl time.Duration) *PostgresStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &PostgresStore{
+		db:          db,
+		ttl:         ttl,
+		lockTimeout: DefaultLockTimeout,
+	}
+}
+
+func (s *PostgresStore) Begin(ctx context.Context, scope, key, requestHash string) (string, *Response, error) {
+	// Expired keys, and abandoned claims for the same request, are taken
+	// over under a new token so the previous holder can no longer finish them
+	token := uuid.New()
+	claimQuery := `
+		INSERT INTO idempotency_keys (scope, idempotency_key, request_hash, claim_token, expires_at)
+		VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => $5))
+		ON CONFLICT (scope, idempotency_key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash,
+		    claim_token = EXCLUDED.claim_token,
+		    status = 'processing',
+		    response_status = NULL,
+		    response_content_type = NULL,
+		    response_body = NULL,
+		    locked_at = NOW(),
+		    completed_at = NULL,
+		    expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < NOW()
+		   OR (idempotency_keys.status = 'processing'
+		       AND idempotency_keys.request_hash = EXCLUDED.request_hash
+		       AND idempotency_keys.locked_at < NOW() - make_interval(secs => $6))
+		RETURNING status
+	`
+	var status string
+	err := s.db.Pool.QueryRow(ctx, claimQuery, scope, key, requestHash, token,
+		s.ttl.Seconds(), s.lockTimeout.Seconds()).Scan(&status)
+	if err == nil {
+		return token.String(), nil, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+
+	var storedHash string
+	var statusCode *int
+	var contentType *string
+	var body []byte
+	lookupQuery := `
+		SELECT request_hash, status, response_status, response_content_type, response_body
+		FROM idempotency_keys
+		WHERE scope = $1 AND idempotency_key = $2
+	`
+	err = s.db.Pool.QueryRow(ctx, lookupQuery, scope, key).Scan(&storedHash, &status, &statusCode, &contentType, &body)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+
+	if storedHash != requestHash {
+		return "", nil, ErrMismatch
+	}
+	if status != "completed" || statusCode == nil {
+		return "", nil, ErrInProgress
+	}
+
+	resp := &Response{StatusCode: *statusCode, Body: body}
+	if contentType != nil {
+		resp.ContentType = *contentType
+	}
+	return "", resp, nil
+}
+
+func (s *PostgresStore) Complete(ctx context.Context, scope, key, token string, resp *Response) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status = 'completed',
+		    response_status = $4,
+		    response_content_type = $5,
+		    response_body = $6,
+		    completed_at = NOW()
+		WHERE scope = $1 AND idempotency_key = $2
+		  AND claim_token = $3 AND status = 'processing'
+	`
+	tag, err := s.db.Pool.Exec(ctx, query, scope, key, token, resp.StatusCode, resp.ContentType, resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrClaimLost
+	}
+	return nil
+}
+
+func (s *PostgresStore) Release(ctx context.Context, scope, key, token string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE scope = $1 AND idempotency_key = $2
+		  AND claim_token = $3 AND status = 'processing'
+	`
+	if _, err := s.db.Pool.Exec(ctx, query, scope, key, token); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// MemoryStore is an in-process Store for tests and single-instance use
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	hash  string
+	token string
+	resp  *Response
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+func (s *MemoryStore) Begin(ctx context.Context, scope, key, requestHash string) (string, *Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[scope+"\x00"+key]
+	if !ok {
+		token := uuid.NewString()
+		s.entries[scope+"\x00"+key] = &memoryEntry{hash: requestHash, token: token}
+		return token, nil, nil
+	}
+	if e.hash != requestHash {
+		return "", nil, ErrMismatch
+	}
+	if e.resp == nil {
+		return "", nil, ErrInProgress
+	}
+	return "", e.resp, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, scope, key, token string, resp *Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[scope+"\x00"+key]
+	if !ok || e.token != token || e.resp != nil {
+		return ErrClaimLost
+	}
+	e.resp = resp
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, scope, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[scope+"\x00"+key]; ok && e.token == token && e.resp == nil {
+		delete(s.entries, scope+"\x00"+key)
+	}
+	return nil
+}
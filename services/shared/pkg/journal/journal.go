@@ -0,0 +1,321 @@
+// BitCurrent Exchange - Journals
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/holds"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// System accounts seeded by the migrations (000013, 000014 and 000027).
+// Customer balances are liabilities, so the accounts mirroring where the
+// money actually sits run negative by the amount owed to customers.
+var (
+	FeeAccountID            = uuid.MustParse("00000000-0000-0000-0000-000000000100")
+	HotWalletAccountID      = uuid.MustParse("00000000-0000-0000-0000-000000000101")
+	SafeguardingAccountID   = uuid.MustParse("00000000-0000-0000-0000-000000000102")
+	DepositAddressAccountID = uuid.MustParse("00000000-0000-0000-0000-000000000103")
+	NetworkFeeAccountID     = uuid.MustParse("00000000-0000-0000-0000-000000000104")
+)
+
+// Journal and entry types
+const (
+	TypeDeposit    = "deposit"
+	TypeWithdrawal = "withdrawal"
+	TypeTrade      = "trade"
+	TypeFee        = "fee"
+	TypeTransfer   = "transfer"
+	TypeAdjustment = "adjustment"
+	TypeReward     = "reward"
+)
+
+var (
+	ErrEmptyJournal        = errors.New("journal needs at least two postings")
+	ErrInvalidType         = errors.New("invalid journal or entry type")
+	ErrZeroPosting         = errors.New("posting amount must not be zero")
+	ErrUnbalanced          = errors.New("journal postings do not sum to zero")
+	ErrAccountNotFound     = errors.New("account not found")
+	ErrInsufficientBalance = errors.New("insufficient available balance")
+)
+
+// Posting is one signed movement on one wallet. A debit can draw on a hold
+// locked with holds.Get, moving reserved rather than available balance.
+type Posting struct {
+	AccountID uuid.UUID
+	Currency  string
+	Amount    decimal.Decimal
+	// EntryType defaults to the journal's type
+	EntryType string
+	Hold      *holds.Hold
+}
+
+// Journal is a balanced set of postings booked together
+type Journal struct {
+	ID            uuid.UUID
+	Type          string
+	ReferenceType *string
+	ReferenceID   *uuid.UUID
+	Description   string
+	Postings      []Posting
+}
+
+// Entry is a ledger entry written by Post
+type Entry struct {
+	ID           uuid.UUID       `json:"id"`
+	AccountID    uuid.UUID       `json:"account_id"`
+	Currency     string          `json:"currency"`
+	Amount       decimal.Decimal `json:"amount"`
+	BalanceAfter decimal.Decimal `json:"balance_after"`
+	EntryType    string          `json:"entry_type"`
+}
+
+// ValidType reports whether t is a known journal or entry type
+func ValidType(t string) bool {
+	switch t {
+	case TypeDeposit, TypeWithdrawal, TypeTrade, TypeFee, TypeTransfer, TypeAdjustment, TypeReward:
+		return true
+	}
+	return false
+}
+
+// CustodyAccount returns the system account standing for where deposits of
+// currency are held: the bank safeguarding account for fiat, the hot wallet
+// for crypto
+func CustodyAccount(currency string) uuid.UUID {
+	if IsFiat(currency) {
+		return SafeguardingAccountID
+	}
+	return HotWalletAccountID
+}
+
+// IsFiat reports whether currency is a fiat currency
+func IsFiat(currency string) bool {
+	switch currency {
+	case "GBP", "EUR", "USD":
+		return true
+	}
+	return false
+}
+
+// NonZero returns postings without those of zero amount, for journals
+// whose fees or rounding can come to nothing
+func NonZero(postings ...Posting) []Posting {
+	nonZero := make([]Posting, 0, len(postings))
+	for _, p := range postings {
+		if !p.Amount.IsZero() {
+			nonZero = append(nonZero, p)
+		}
+	}
+	return nonZero
+}
+
+// Validate checks a journal's shape: known types, no zero postings and
+// every currency summing to zero
+func (j *Journal) Validate() error {
+	if !ValidType(j.Type) {
+		return ErrInvalidType
+	}
+	if len(j.Postings) < 2 {
+		return ErrEmptyJournal
+	}
+
+	sums := make(map[string]decimal.Decimal)
+	for _, p := range j.Postings {
+		if p.EntryType != "" && !ValidType(p.EntryType) {
+			return ErrInvalidType
+		}
+		if p.Amount.IsZero() {
+			return ErrZeroPosting
+		}
+		sums[p.Currency] = sums[p.Currency].Add(p.Amount)
+	}
+	for currency, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("%w: %s is off by %s", ErrUnbalanced, currency, sum)
+		}
+	}
+	return nil
+}
+
+// walletState is a locked wallet as Post tracks it through the journal
+type walletState struct {
+	available     decimal.Decimal
+	allowNegative bool
+}
+
+type walletKey struct {
+	accountID uuid.UUID
+	currency  string
+}
+
+// Post validates and books a journal in tx, setting j.ID, and returns its
+// entries in posting order. Wallets are created on first use and locked in
+// a fixed order. A debit is covered by its hold first and available balance
+// after that, with postings applied in order. Only system accounts other
+// than the fee account may run negative: if a posting would overdraw any
+// other wallet Post returns ErrInsufficientBalance before writing anything,
+// so the caller may carry on in the same transaction.
+func Post(ctx context.Context, tx pgx.Tx, j *Journal) ([]Entry, error) {
+	if err := j.Validate(); err != nil {
+		return nil, err
+	}
+
+	wallets, err := lockWallets(ctx, tx, j.Postings)
+	if err != nil {
+		return nil, err
+	}
+	drawn := make(map[*holds.Hold]decimal.Decimal)
+	for _, p := range j.Postings {
+		covered := covers(p, drawn[p.Hold])
+		drawn[p.Hold] = drawn[p.Hold].Add(covered)
+		w := wallets[walletKey{p.AccountID, p.Currency}]
+		w.available = w.available.Add(p.Amount).Add(covered)
+		if w.available.IsNegative() && !w.allowNegative {
+			return nil, fmt.Errorf("%w: %s %s", ErrInsufficientBalance, p.AccountID, p.Currency)
+		}
+	}
+
+	journalQuery := `
+		INSERT INTO journals (journal_type, reference_id, reference_type, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	if err := tx.QueryRow(ctx, journalQuery, j.Type, j.ReferenceID, j.ReferenceType, j.Description).Scan(&j.ID); err != nil {
+		return nil, fmt.Errorf("failed to create journal: %w", err)
+	}
+
+	entries := make([]Entry, 0, len(j.Postings))
+	for _, p := range j.Postings {
+		entry, err := apply(ctx, tx, j, p)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+
+	return entries, nil
+}
+
+// covers returns how much of a posting its hold covers once drawn has been
+// taken from it. Only a debit on the hold's own wallet can draw on it.
+func covers(p Posting, drawn decimal.Decimal) decimal.Decimal {
+	if !p.Amount.IsNegative() || p.Hold == nil {
+		return decimal.Zero
+	}
+	covered := decimal.Min(p.Hold.Covers(p.AccountID, p.Currency, p.Amount.Neg()), p.Hold.Remaining().Sub(drawn))
+	if !covered.IsPositive() {
+		return decimal.Zero
+	}
+	return covered
+}
+
+// lockWallets creates any wallet the journal touches for the first time and
+// locks them all, sorted by account and currency so concurrent journals on
+// shared accounts cannot deadlock
+func lockWallets(ctx context.Context, tx pgx.Tx, postings []Posting) (map[walletKey]*walletState, error) {
+	wallets := make(map[walletKey]*walletState)
+	var keys []walletKey
+	for _, p := range postings {
+		k := walletKey{p.AccountID, p.Currency}
+		if _, ok := wallets[k]; !ok {
+			wallets[k] = nil
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].accountID != keys[j].accountID {
+			return keys[i].accountID.String() < keys[j].accountID.String()
+		}
+		return keys[i].currency < keys[j].currency
+	})
+
+	// DO UPDATE (rather than DO NOTHING) takes the row lock on existing wallets
+	query := `
+		INSERT INTO wallets (account_id, currency, wallet_type, allow_negative)
+		SELECT a.id, $2, $3, a.account_type = 'system' AND a.id <> $4
+		FROM accounts a
+		WHERE a.id = $1
+		ON CONFLICT (account_id, currency) DO UPDATE SET account_id = EXCLUDED.account_id
+		RETURNING available_balance, allow_negative
+	`
+	for _, k := range keys {
+		var w walletState
+		err := tx.QueryRow(ctx, query, k.accountID, k.currency, walletType(k.currency), FeeAccountID).
+			Scan(&w.available, &w.allowNegative)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrAccountNotFound, k.accountID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock %s wallet of %s: %w", k.currency, k.accountID, err)
+		}
+		wallets[k] = &w
+	}
+	return wallets, nil
+}
+
+// apply moves one wallet and writes its ledger entry
+func apply(ctx context.Context, tx pgx.Tx, j *Journal, p Posting) (*Entry, error) {
+	covered := decimal.Zero
+	if covers(p, decimal.Zero).IsPositive() {
+		var err error
+		covered, err = holds.Consume(ctx, tx, p.Hold, p.Amount.Neg())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entry := Entry{
+		AccountID: p.AccountID,
+		Currency:  p.Currency,
+		Amount:    p.Amount,
+		EntryType: p.EntryType,
+	}
+	if entry.EntryType == "" {
+		entry.EntryType = j.Type
+	}
+
+	walletQuery := `
+		UPDATE wallets
+		SET balance = balance + $1,
+		    reserved_balance = reserved_balance - $2,
+		    available_balance = available_balance + $1 + $2,
+		    updated_at = NOW()
+		WHERE account_id = $3 AND currency = $4
+		RETURNING balance
+	`
+	err := tx.QueryRow(ctx, walletQuery, p.Amount, covered, p.AccountID, p.Currency).Scan(&entry.BalanceAfter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to post %s %s to account %s: %w", p.Amount, p.Currency, p.AccountID, err)
+	}
+
+	ledgerQuery := `
+		INSERT INTO ledger_entries (
+			journal_id, account_id, currency, amount, balance_after,
+			entry_type, reference_id, reference_type, description
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+	err = tx.QueryRow(ctx, ledgerQuery,
+		j.ID, p.AccountID, p.Currency, p.Amount, entry.BalanceAfter,
+		entry.EntryType, j.ReferenceID, j.ReferenceType, j.Description,
+	).Scan(&entry.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ledger entry: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// walletType classifies wallets created on first use
+func walletType(currency string) string {
+	if IsFiat(currency) {
+		return "fiat"
+	}
+	return "hot"
+}
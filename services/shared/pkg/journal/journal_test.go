@@ -0,0 +1,255 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/decimal"
+	"github.com/bitcurrent-exchange/platform/services/shared/pkg/holds"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+)
+
+// amountArg matches a decimal argument by value rather than representation
+type amountArg struct{ decimal.Decimal }
+
+func (a amountArg) Match(v interface{}) bool {
+	d, ok := v.(decimal.Decimal)
+	return ok && d.Equal(a.Decimal)
+}
+
+func amount(s string) amountArg {
+	return amountArg{decimal.RequireFromString(s)}
+}
+
+func posting(accountID uuid.UUID, currency, amount string) Posting {
+	return Posting{AccountID: accountID, Currency: currency, Amount: decimal.RequireFromString(amount)}
+}
+
+func newTestTx(t *testing.T) (pgx.Tx, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+	mock.ExpectBegin()
+	tx, err := mock.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx, mock
+}
+
+func expectWallet(mock pgxmock.PgxPoolIface, accountID uuid.UUID, currency, walletType, available string, allowNegative bool) {
+	mock.ExpectQuery("INSERT INTO wallets").
+		WithArgs(accountID, currency, walletType, FeeAccountID).
+		WillReturnRows(pgxmock.NewRows([]string{"available_balance", "allow_negative"}).
+			AddRow(decimal.RequireFromString(available), allowNegative))
+}
+
+// expectEntry expects a posting's wallet update and ledger entry
+func expectEntry(mock pgxmock.PgxPoolIface, j *Journal, accountID uuid.UUID, currency, value, covered, balance, entryType string) {
+	mock.ExpectQuery("UPDATE wallets").
+		WithArgs(amount(value), amount(covered), accountID, currency).
+		WillReturnRows(pgxmock.NewRows([]string{"balance"}).AddRow(decimal.RequireFromString(balance)))
+	mock.ExpectQuery("INSERT INTO ledger_entries").
+		WithArgs(j.ID, accountID, currency, amount(value), amount(balance),
+			entryType, j.ReferenceID, j.ReferenceType, j.Description).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+}
+
+func TestValidate(t *testing.T) {
+	user, other := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name    string
+		journal Journal
+		want    error
+	}{
+		{"balanced", Journal{Type: TypeDeposit, Postings: []Posting{
+			posting(user, "GBP", "100.00"), posting(SafeguardingAccountID, "GBP", "-100.00"),
+		}}, nil},
+		{"balanced per currency", Journal{Type: TypeTrade, Postings: []Posting{
+			posting(user, "BTC", "-1"), posting(other, "BTC", "1"),
+			posting(user, "GBP", "50000"), posting(other, "GBP", "-50000"),
+		}}, nil},
+		{"unbalanced", Journal{Type: TypeDeposit, Postings: []Posting{
+			posting(user, "GBP", "100.00"), posting(SafeguardingAccountID, "GBP", "-99.99"),
+		}}, ErrUnbalanced},
+		{"balanced only across currencies", Journal{Type: TypeTransfer, Postings: []Posting{
+			posting(user, "GBP", "1"), posting(other, "EUR", "-1"),
+		}}, ErrUnbalanced},
+		{"single posting", Journal{Type: TypeDeposit, Postings: []Posting{
+			posting(user, "GBP", "0"),
+		}}, ErrEmptyJournal},
+		{"zero posting", Journal{Type: TypeWithdrawal, Postings: []Posting{
+			posting(user, "GBP", "-250"), posting(SafeguardingAccountID, "GBP", "250"), posting(FeeAccountID, "GBP", "0"),
+		}}, ErrZeroPosting},
+		{"zero posting dropped", Journal{Type: TypeWithdrawal, Postings: NonZero(
+			posting(user, "GBP", "-250"), posting(SafeguardingAccountID, "GBP", "250"), posting(FeeAccountID, "GBP", "0"),
+		)}, nil},
+		{"unknown type", Journal{Type: "gift", Postings: []Posting{
+			posting(user, "GBP", "1"), posting(other, "GBP", "-1"),
+		}}, ErrInvalidType},
+		{"unknown entry type", Journal{Type: TypeTransfer, Postings: []Posting{
+			posting(user, "GBP", "1"), {AccountID: other, Currency: "GBP", Amount: decimal.NewFromInt(-1), EntryType: "gift"},
+		}}, ErrInvalidType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.journal.Validate()
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// Wallets are locked in account order and created as fiat for GBP; entries
+// are written in posting order
+func TestPost(t *testing.T) {
+	tx, mock := newTestTx(t)
+	user := uuid.MustParse("6f1c2a7e-8d3b-4c55-9a10-2b7e4f6d9c01")
+	referenceType, referenceID, journalID := "withdrawal", uuid.New(), uuid.New()
+
+	fee := posting(FeeAccountID, "GBP", "1.50")
+	fee.EntryType = TypeFee
+	j := &Journal{
+		Type:          TypeWithdrawal,
+		ReferenceType: &referenceType,
+		ReferenceID:   &referenceID,
+		Description:   "Withdrawal completed",
+		Postings: []Posting{
+			posting(user, "GBP", "-251.50"), posting(SafeguardingAccountID, "GBP", "250"), fee,
+		},
+	}
+
+	expectWallet(mock, FeeAccountID, "GBP", "fiat", "0", false)
+	expectWallet(mock, SafeguardingAccountID, "GBP", "fiat", "-1000", true)
+	expectWallet(mock, user, "GBP", "fiat", "251.50", false)
+	mock.ExpectQuery("INSERT INTO journals").
+		WithArgs(TypeWithdrawal, &referenceID, &referenceType, "Withdrawal completed").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(journalID))
+	posted := *j
+	posted.ID = journalID
+	expectEntry(mock, &posted, user, "GBP", "-251.50", "0", "0", TypeWithdrawal)
+	expectEntry(mock, &posted, SafeguardingAccountID, "GBP", "250", "0", "-750", TypeWithdrawal)
+	expectEntry(mock, &posted, FeeAccountID, "GBP", "1.50", "0", "1.50", TypeFee)
+
+	entries, err := Post(context.Background(), tx, j)
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	if j.ID != journalID || len(entries) != 3 || entries[0].AccountID != user || !entries[0].BalanceAfter.IsZero() {
+		t.Errorf("Post() = %s, %+v", j.ID, entries)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Nothing is written when a customer, or the fee account, would be
+// overdrawn
+func TestPostRejectsOverdraft(t *testing.T) {
+	tx, mock := newTestTx(t)
+	user := uuid.MustParse("6f1c2a7e-8d3b-4c55-9a10-2b7e4f6d9c01")
+
+	expectWallet(mock, SafeguardingAccountID, "GBP", "fiat", "-500", true)
+	expectWallet(mock, user, "GBP", "fiat", "40.00", false)
+	j := &Journal{Type: TypeWithdrawal, Postings: []Posting{
+		posting(user, "GBP", "-50.00"), posting(SafeguardingAccountID, "GBP", "50.00"),
+	}}
+	if _, err := Post(context.Background(), tx, j); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("Post() error = %v, want ErrInsufficientBalance", err)
+	}
+
+	expectWallet(mock, FeeAccountID, "BTC", "hot", "0.0001", false)
+	expectWallet(mock, NetworkFeeAccountID, "BTC", "hot", "-0.2", true)
+	j = &Journal{Type: TypeFee, Postings: []Posting{
+		posting(FeeAccountID, "BTC", "-0.0002"), posting(NetworkFeeAccountID, "BTC", "0.0002"),
+	}}
+	if _, err := Post(context.Background(), tx, j); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("Post() error = %v, want ErrInsufficientBalance", err)
+	}
+
+	expectWallet(mock, HotWalletAccountID, "BTC", "hot", "-100", true)
+	mock.ExpectQuery("INSERT INTO wallets").
+		WithArgs(user, "BTC", "hot", FeeAccountID).
+		WillReturnRows(pgxmock.NewRows([]string{"available_balance", "allow_negative"}))
+	j = &Journal{Type: TypeDeposit, Postings: []Posting{
+		posting(HotWalletAccountID, "BTC", "-1"), posting(user, "BTC", "1"),
+	}}
+	if _, err := Post(context.Background(), tx, j); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("Post() error = %v, want ErrAccountNotFound", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A debit drawing on a hold moves reserved balance, and only takes what the
+// hold does not cover from available balance
+func TestPostDrawsOnHold(t *testing.T) {
+	tx, mock := newTestTx(t)
+	user := uuid.MustParse("6f1c2a7e-8d3b-4c55-9a10-2b7e4f6d9c01")
+	journalID := uuid.New()
+	hold := &holds.Hold{
+		ID:        uuid.New(),
+		AccountID: user,
+		Currency:  "BTC",
+		Amount:    decimal.RequireFromString("0.5"),
+		Status:    holds.StatusActive,
+	}
+
+	j := &Journal{
+		Type:        TypeWithdrawal,
+		Description: "Withdrawal completed",
+		Postings: []Posting{
+			{AccountID: user, Currency: "BTC", Amount: decimal.RequireFromString("-0.6"), Hold: hold},
+			posting(HotWalletAccountID, "BTC", "0.6"),
+		},
+	}
+
+	expectWallet(mock, HotWalletAccountID, "BTC", "hot", "-100", true)
+	expectWallet(mock, user, "BTC", "hot", "0.1", false)
+	mock.ExpectQuery("INSERT INTO journals").
+		WithArgs(TypeWithdrawal, j.ReferenceID, j.ReferenceType, "Withdrawal completed").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(journalID))
+	mock.ExpectExec("UPDATE balance_holds SET consumed").
+		WithArgs(amount("0.5"), hold.ID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	posted := *j
+	posted.ID = journalID
+	expectEntry(mock, &posted, user, "BTC", "-0.6", "0.5", "0", TypeWithdrawal)
+	expectEntry(mock, &posted, HotWalletAccountID, "BTC", "0.6", "0", "-99.4", TypeWithdrawal)
+
+	if _, err := Post(context.Background(), tx, j); err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	if !hold.Remaining().IsZero() {
+		t.Errorf("hold remaining = %s, want 0", hold.Remaining())
+	}
+
+	// The hold is used up, so the same debit again would overdraw
+	expectWallet(mock, HotWalletAccountID, "BTC", "hot", "-99.4", true)
+	expectWallet(mock, user, "BTC", "hot", "0.1", false)
+	if _, err := Post(context.Background(), tx, j); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("Post() error = %v, want ErrInsufficientBalance", err)
+	}
+
+	// Another account's debit cannot draw on the hold
+	other := &holds.Hold{ID: uuid.New(), AccountID: uuid.New(), Currency: "BTC", Amount: decimal.NewFromInt(1), Status: holds.StatusActive}
+	j.Postings[0].Hold = other
+	expectWallet(mock, HotWalletAccountID, "BTC", "hot", "-99.4", true)
+	expectWallet(mock, user, "BTC", "hot", "0.1", false)
+	if _, err := Post(context.Background(), tx, j); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("Post() error = %v, want ErrInsufficientBalance", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
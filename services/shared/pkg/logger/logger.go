@@ -0,0 +1,68 @@
+// BitCurrent Exchange - Shared Structured Logger
+package logger
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Config holds logger configuration
+type Config struct {
+	Level       string   // debug, info, warn, error
+	Environment string   // development, staging, production
+	OutputPaths []string // e.g. "stdout", "/var/log/app.log"
+}
+
+// NewLogger builds a zap logger.
+// Production and staging emit JSON; anything else uses the human-readable
+// console encoder with colour levels.
+func NewLogger(cfg Config) (*zap.Logger, error) {
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	var zapCfg zap.Config
+	switch strings.ToLower(cfg.Environment) {
+	case "production", "prod", "staging":
+		zapCfg = zap.NewProductionConfig()
+		zapCfg.EncoderConfig.TimeKey = "timestamp"
+		zapCfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	default:
+		zapCfg = zap.NewDevelopmentConfig()
+		zapCfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	}
+
+	zapCfg.Level = zap.NewAtomicLevelAt(level)
+
+	if len(cfg.OutputPaths) > 0 {
+		zapCfg.OutputPaths = cfg.OutputPaths
+	}
+
+	logger, err := zapCfg.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build logger: %w", err)
+	}
+
+	if cfg.Environment != "" {
+		logger = logger.With(zap.String("env", cfg.Environment))
+	}
+
+	return logger, nil
+}
+
+func parseLevel(level string) (zapcore.Level, error) {
+	if level == "" {
+		return zapcore.InfoLevel, nil
+	}
+
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(strings.ToLower(level))); err != nil {
+		return l, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	return l, nil
+}
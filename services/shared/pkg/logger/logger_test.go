@@ -0,0 +1,27 @@
+package logger
+
+import "testing"
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"development default level", Config{Environment: "development"}, false},
+		{"production json", Config{Level: "warn", Environment: "production"}, false},
+		{"invalid level", Config{Level: "loud"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, err := NewLogger(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLogger() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if log != nil {
+				log.Info("test message")
+			}
+		})
+	}
+}